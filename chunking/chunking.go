@@ -0,0 +1,130 @@
+// Package chunking splits knowledge base text into chunks sized in tokens for embedding. Prose is split
+// along its structure, headings first, then paragraphs, lines, sentences and words; CSV files are grouped
+// by rows and JSON files are split into one chunk per record.
+package chunking
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Strategy selects how a text is split
+type Strategy string
+
+const (
+	// StrategyRecursive splits by markdown headings, then paragraphs, lines, sentences and words, and
+	// starts every chunk with the headings it falls under
+	StrategyRecursive Strategy = "recursive"
+	// StrategyCSV groups the rows of a CSV file, each written as "header: value" pairs
+	StrategyCSV Strategy = "csv"
+	// StrategyJSON makes a chunk of each record of a JSON file: the elements of an array, or the values
+	// of an object, with arrays in an object split into their elements
+	StrategyJSON Strategy = "json"
+)
+
+// Defaults and limits of chunk sizes, in estimated tokens
+const (
+	DefaultMaxTokens     = 500
+	DefaultOverlapTokens = 50
+	MinMaxTokens         = 50
+	MaxMaxTokens         = 4000 // Well below the input limits of the embedding providers
+)
+
+// Options configure a split
+type Options struct {
+	Strategy      Strategy // Recursive when empty
+	MaxTokens     int      // Largest chunk, DefaultMaxTokens when 0
+	OverlapTokens int      // Text repeated from the end of the previous chunk of the same section, none when 0
+}
+
+// Chunk is one piece of a split text with what is known about where it came from
+type Chunk struct {
+	Text        string
+	Tokens      int      // Estimated, see CountTokens
+	Index       int      // Position among the text's chunks, from 0
+	Total       int      // Chunks the text was split into
+	Strategy    Strategy // Strategy that made the chunk, recursive when a CSV or JSON text could not be parsed
+	HeadingPath []string // Headings the chunk falls under, outermost first
+	RowStart    int      // CSV rows of the chunk as a spreadsheet numbers them, the header being row 1
+	RowEnd      int
+	Record      string // JSON path of the record, e.g. "[3]" or "products[3]"
+}
+
+// Metadata returns what is known about the chunk as document metadata
+func (c Chunk) Metadata() map[string]string {
+	metadata := map[string]string{
+		"chunk_strategy": string(c.Strategy),
+		"chunk_tokens":   strconv.Itoa(c.Tokens),
+	}
+	if c.Total > 1 {
+		metadata["chunk"] = fmt.Sprintf("%d/%d", c.Index+1, c.Total)
+	}
+	if len(c.HeadingPath) > 0 {
+		metadata["heading_path"] = strings.Join(c.HeadingPath, " > ")
+	}
+	if c.RowStart > 0 {
+		if c.RowEnd > c.RowStart {
+			metadata["rows"] = fmt.Sprintf("%d-%d", c.RowStart, c.RowEnd)
+		} else {
+			metadata["rows"] = strconv.Itoa(c.RowStart)
+		}
+	}
+	if c.Record != "" {
+		metadata["record"] = c.Record
+	}
+	return metadata
+}
+
+// StrategyFor returns the strategy for a file by its name or URL path
+func StrategyFor(filename string) Strategy {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		return StrategyCSV
+	case ".json":
+		return StrategyJSON
+	}
+	return StrategyRecursive
+}
+
+// IsValidStrategy checks if a strategy is supported
+func IsValidStrategy(strategy Strategy) bool {
+	switch strategy {
+	case StrategyRecursive, StrategyCSV, StrategyJSON:
+		return true
+	}
+	return false
+}
+
+// Split splits a text into chunks of at most opts.MaxTokens estimated tokens. CSV and JSON texts that
+// cannot be parsed are split as prose.
+func Split(text string, opts Options) []Chunk {
+	if opts.MaxTokens <= 0 {
+		opts.MaxTokens = DefaultMaxTokens
+	}
+	// Overlap takes at most half of a chunk
+	opts.OverlapTokens = max(0, min(opts.OverlapTokens, opts.MaxTokens/2))
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	var chunks []Chunk
+	ok := false
+	switch opts.Strategy {
+	case StrategyCSV:
+		chunks, ok = splitCSV(text, opts)
+	case StrategyJSON:
+		chunks, ok = splitJSON(text, opts)
+	}
+	if !ok {
+		chunks = splitRecursive(text, opts)
+	}
+
+	for i := range chunks {
+		chunks[i].Index = i
+		chunks[i].Total = len(chunks)
+		chunks[i].Tokens = CountTokens(chunks[i].Text)
+	}
+	return chunks
+}
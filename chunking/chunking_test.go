@@ -0,0 +1,318 @@
+package chunking
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCountTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"chair", 2},
+		{"desk chair", 3},
+		{"Price: 120", 4},
+		{"სკამი", 3},
+		{"chair, desk", 4},
+	}
+	for _, tt := range tests {
+		if got := CountTokens(tt.text); got != tt.want {
+			t.Errorf("CountTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestStrategyFor(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     Strategy
+	}{
+		{"prices.csv", StrategyCSV},
+		{"PRICES.CSV", StrategyCSV},
+		{"https://example.com/feed/products.json", StrategyJSON},
+		{"faq.md", StrategyRecursive},
+		{"manual.pdf", StrategyRecursive},
+		{"notes", StrategyRecursive},
+	}
+	for _, tt := range tests {
+		if got := StrategyFor(tt.filename); got != tt.want {
+			t.Errorf("StrategyFor(%q) = %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestSplitRecursive(t *testing.T) {
+	text := "# Store\n\nWe sell furniture.\n\n## Delivery\n\nDelivery takes two days.\n\n## Returns\n\nReturns are free for thirty days."
+
+	tests := []struct {
+		name      string
+		maxTokens int
+		want      []Chunk
+	}{
+		{
+			name:      "fits one chunk",
+			maxTokens: 500,
+			want: []Chunk{
+				{Text: text, HeadingPath: []string{"Store"}},
+			},
+		},
+		{
+			name:      "sections packed up to the limit",
+			maxTokens: 20,
+			want: []Chunk{
+				{Text: "# Store\n\nWe sell furniture.\n\n## Delivery\n\nDelivery takes two days.", HeadingPath: []string{"Store"}},
+				{Text: "## Returns\n\nReturns are free for thirty days.", HeadingPath: []string{"Store", "Returns"}},
+			},
+		},
+		{
+			name:      "chunks start with their parent headings",
+			maxTokens: 30,
+			want: []Chunk{
+				{Text: "# Store\n\nWe sell furniture.\n\n## Delivery\n\nDelivery takes two days.", HeadingPath: []string{"Store"}},
+				{Text: "# Store\n\n## Returns\n\nReturns are free for thirty days.", HeadingPath: []string{"Store", "Returns"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := Split(text, Options{MaxTokens: tt.maxTokens})
+			if len(chunks) != len(tt.want) {
+				t.Fatalf("got %d chunks %q, want %d", len(chunks), chunkTexts(chunks), len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := chunks[i]
+				if got.Text != want.Text {
+					t.Errorf("chunk %d text = %q, want %q", i, got.Text, want.Text)
+				}
+				if strings.Join(got.HeadingPath, " > ") != strings.Join(want.HeadingPath, " > ") {
+					t.Errorf("chunk %d heading path = %q, want %q", i, got.HeadingPath, want.HeadingPath)
+				}
+				if got.Strategy != StrategyRecursive || got.Index != i || got.Total != len(tt.want) {
+					t.Errorf("chunk %d = strategy %q, %d of %d", i, got.Strategy, got.Index, got.Total)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitRecursiveHeadingInCodeBlock(t *testing.T) {
+	text := "# Setup\n\n```\n# not a heading\n```"
+	chunks := Split(text, Options{})
+	if len(chunks) != 1 || strings.Join(chunks[0].HeadingPath, " > ") != "Setup" {
+		t.Errorf("Split = %+v, want one chunk under Setup", chunks)
+	}
+}
+
+func TestSplitRecursiveOverlap(t *testing.T) {
+	var sentences []string
+	for i := 1; i <= 30; i++ {
+		sentences = append(sentences, fmt.Sprintf("Sentence number %d ends here.", i))
+	}
+	text := strings.Join(sentences, " ")
+
+	chunks := Split(text, Options{MaxTokens: 60, OverlapTokens: 10})
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want several", len(chunks))
+	}
+	for i := 1; i < len(chunks); i++ {
+		previous := chunks[i-1].Text
+		words := strings.Fields(chunks[i].Text)
+		if !strings.HasSuffix(previous, words[0]+" "+words[1]) && !strings.Contains(previous, words[0]+" "+words[1]) {
+			t.Errorf("chunk %d %q does not start with the end of chunk %d %q", i, chunks[i].Text, i-1, previous)
+		}
+	}
+
+	chunks = Split(text, Options{MaxTokens: 60})
+	joined := strings.Join(chunkTexts(chunks), " ")
+	if joined != text {
+		t.Errorf("chunks without overlap joined = %q, want the text", joined)
+	}
+}
+
+func TestSplitCSV(t *testing.T) {
+	text := "Product,Price,Color\nChair,120,Red\nDesk,450,\nLamp,35,White\n"
+
+	tests := []struct {
+		name      string
+		maxTokens int
+		want      []Chunk
+	}{
+		{
+			name:      "all rows in one chunk",
+			maxTokens: 500,
+			want: []Chunk{
+				{Text: "Row 2: Product: Chair; Price: 120; Color: Red\nRow 3: Product: Desk; Price: 450\nRow 4: Product: Lamp; Price: 35; Color: White", RowStart: 2, RowEnd: 4},
+			},
+		},
+		{
+			name:      "rows grouped up to the limit",
+			maxTokens: 30,
+			want: []Chunk{
+				{Text: "Row 2: Product: Chair; Price: 120; Color: Red\nRow 3: Product: Desk; Price: 450", RowStart: 2, RowEnd: 3},
+				{Text: "Row 4: Product: Lamp; Price: 35; Color: White", RowStart: 4, RowEnd: 4},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := Split(text, Options{Strategy: StrategyCSV, MaxTokens: tt.maxTokens})
+			if len(chunks) != len(tt.want) {
+				t.Fatalf("got %d chunks %q, want %d", len(chunks), chunkTexts(chunks), len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := chunks[i]
+				if got.Text != want.Text || got.RowStart != want.RowStart || got.RowEnd != want.RowEnd || got.Strategy != StrategyCSV {
+					t.Errorf("chunk %d = %q rows %d-%d (%s), want %q rows %d-%d", i, got.Text, got.RowStart, got.RowEnd, got.Strategy, want.Text, want.RowStart, want.RowEnd)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitCSVFallsBackToProse(t *testing.T) {
+	chunks := Split("Just one line without columns", Options{Strategy: StrategyCSV})
+	if len(chunks) != 1 || chunks[0].Strategy != StrategyRecursive {
+		t.Errorf("Split = %+v, want one recursive chunk", chunks)
+	}
+}
+
+func TestSplitJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Chunk
+	}{
+		{
+			name: "array elements",
+			text: `[{"name": "Chair", "price": 120}, {"name": "Desk", "price": 450}]`,
+			want: []Chunk{
+				{Text: `{"name":"Chair","price":120}`, Record: "[0]"},
+				{Text: `{"name":"Desk","price":450}`, Record: "[1]"},
+			},
+		},
+		{
+			name: "object keys with arrays split into elements",
+			text: `{"store": {"city": "Tbilisi"}, "products": [{"name": "Chair"}, {"name": "Lamp"}]}`,
+			want: []Chunk{
+				{Text: `store: {"city":"Tbilisi"}`, Record: "store"},
+				{Text: `products[0]: {"name":"Chair"}`, Record: "products[0]"},
+				{Text: `products[1]: {"name":"Lamp"}`, Record: "products[1]"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := Split(tt.text, Options{Strategy: StrategyJSON})
+			if len(chunks) != len(tt.want) {
+				t.Fatalf("got %d chunks %q, want %d", len(chunks), chunkTexts(chunks), len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := chunks[i]
+				if got.Text != want.Text || got.Record != want.Record || got.Strategy != StrategyJSON {
+					t.Errorf("chunk %d = %q record %q (%s), want %q record %q", i, got.Text, got.Record, got.Strategy, want.Text, want.Record)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitJSONFallsBackToProse(t *testing.T) {
+	chunks := Split("{not json", Options{Strategy: StrategyJSON})
+	if len(chunks) != 1 || chunks[0].Strategy != StrategyRecursive {
+		t.Errorf("Split = %+v, want one recursive chunk", chunks)
+	}
+}
+
+func TestSplitTokenLimits(t *testing.T) {
+	longWord := strings.Repeat("x", 2000)
+	georgian := strings.Repeat("მიწოდება უფასოა თბილისში ორ დღეში. ", 80)
+	paragraphs := strings.Repeat("# Catalog\n\n"+strings.Repeat("A sturdy oak chair for the dining room. ", 40)+"\n\n", 5)
+	var rows strings.Builder
+	rows.WriteString("Product,Description\n")
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&rows, "Item %d,%s\n", i, strings.Repeat("solid wood ", 10))
+	}
+	rows.WriteString("Huge," + strings.Repeat("very long description ", 60) + "\n")
+	records := `[` + strings.Repeat(`{"name":"Chair","description":"A sturdy oak chair for the dining room"},`, 30) + `{"notes":"` + strings.Repeat("long notes ", 200) + `"}]`
+
+	tests := []struct {
+		name     string
+		text     string
+		strategy Strategy
+	}{
+		{"run without spaces", longWord, StrategyRecursive},
+		{"georgian text", georgian, StrategyRecursive},
+		{"sections of long paragraphs", paragraphs, StrategyRecursive},
+		{"csv with a row larger than a chunk", rows.String(), StrategyCSV},
+		{"json with a record larger than a chunk", records, StrategyJSON},
+	}
+	for _, tt := range tests {
+		for _, maxTokens := range []int{MinMaxTokens, 120, DefaultMaxTokens} {
+			t.Run(fmt.Sprintf("%s/%d", tt.name, maxTokens), func(t *testing.T) {
+				chunks := Split(tt.text, Options{Strategy: tt.strategy, MaxTokens: maxTokens, OverlapTokens: DefaultOverlapTokens})
+				if len(chunks) == 0 {
+					t.Fatal("got no chunks")
+				}
+				for i, chunk := range chunks {
+					if chunk.Tokens > maxTokens {
+						t.Errorf("chunk %d has %d tokens, more than %d", i, chunk.Tokens, maxTokens)
+					}
+					if chunk.Tokens != CountTokens(chunk.Text) {
+						t.Errorf("chunk %d tokens = %d, want %d", i, chunk.Tokens, CountTokens(chunk.Text))
+					}
+					if strings.TrimSpace(chunk.Text) == "" {
+						t.Errorf("chunk %d is empty", i)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestChunkMetadata(t *testing.T) {
+	tests := []struct {
+		name  string
+		chunk Chunk
+		want  map[string]string
+	}{
+		{
+			name:  "only chunk",
+			chunk: Chunk{Strategy: StrategyRecursive, Tokens: 12, Total: 1},
+			want:  map[string]string{"chunk_strategy": "recursive", "chunk_tokens": "12"},
+		},
+		{
+			name:  "section chunk",
+			chunk: Chunk{Strategy: StrategyRecursive, Tokens: 40, Index: 1, Total: 3, HeadingPath: []string{"Store", "Delivery"}},
+			want:  map[string]string{"chunk_strategy": "recursive", "chunk_tokens": "40", "chunk": "2/3", "heading_path": "Store > Delivery"},
+		},
+		{
+			name:  "csv rows",
+			chunk: Chunk{Strategy: StrategyCSV, Tokens: 30, Index: 0, Total: 2, RowStart: 2, RowEnd: 9},
+			want:  map[string]string{"chunk_strategy": "csv", "chunk_tokens": "30", "chunk": "1/2", "rows": "2-9"},
+		},
+		{
+			name:  "json record",
+			chunk: Chunk{Strategy: StrategyJSON, Tokens: 8, Index: 3, Total: 4, Record: "products[3]"},
+			want:  map[string]string{"chunk_strategy": "json", "chunk_tokens": "8", "chunk": "4/4", "record": "products[3]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.chunk.Metadata()
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Metadata() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func chunkTexts(chunks []Chunk) []string {
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+	return texts
+}
@@ -0,0 +1,184 @@
+package chunking
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// splitCSV groups the rows of a CSV file with a header row into chunks. Every row is written as
+// "Row 5: Product: Chair; Price: 120", so a chunk keeps the column names of its values. Rows are never
+// split unless a single row is larger than a chunk.
+func splitCSV(text string, opts Options) ([]Chunk, bool) {
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil || len(records) < 2 || len(records[0]) < 2 {
+		return nil, false
+	}
+	header := records[0]
+
+	var chunks []Chunk
+	var lines []string
+	tokens, first, last := 0, 0, 0
+	flush := func() {
+		if len(lines) == 0 {
+			return
+		}
+		chunks = append(chunks, Chunk{Text: strings.Join(lines, "\n"), Strategy: StrategyCSV, RowStart: first, RowEnd: last})
+		lines, tokens = nil, 0
+	}
+
+	for i, record := range records[1:] {
+		row := i + 2
+		line := csvRowText(header, record, row)
+		if line == "" {
+			continue
+		}
+		lineTokens := CountTokens(line)
+		if len(lines) > 0 && tokens+lineTokens > opts.MaxTokens {
+			flush()
+		}
+		if lineTokens > opts.MaxTokens {
+			for _, part := range splitLarge(line, 3, opts) {
+				chunks = append(chunks, Chunk{Text: part, Strategy: StrategyCSV, RowStart: row, RowEnd: row})
+			}
+			continue
+		}
+		if len(lines) == 0 {
+			first = row
+		}
+		lines = append(lines, line)
+		tokens += lineTokens
+		last = row
+	}
+	flush()
+	return chunks, len(chunks) > 0
+}
+
+// csvRowText writes a row as "header: value" pairs, empty when all its values are
+func csvRowText(header, record []string, row int) string {
+	var fields []string
+	for i, value := range record {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		name := fmt.Sprintf("Column %d", i+1)
+		if i < len(header) && strings.TrimSpace(header[i]) != "" {
+			name = strings.TrimSpace(header[i])
+		}
+		fields = append(fields, name+": "+value)
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Row %d: %s", row, strings.Join(fields, "; "))
+}
+
+// jsonRecord is one record of a JSON file with its path
+type jsonRecord struct {
+	path  string
+	value json.RawMessage
+}
+
+// splitJSON makes a chunk of each record of a JSON array or object. Records are written as compact
+// JSON, prefixed with their key within an object, e.g. `products[3]: {"name":"Chair"}`. A record
+// larger than a chunk is indented and split by lines.
+func splitJSON(text string, opts Options) ([]Chunk, bool) {
+	text = strings.TrimSpace(text)
+	if !json.Valid([]byte(text)) {
+		return nil, false
+	}
+
+	var records []jsonRecord
+	switch text[0] {
+	case '[':
+		records = jsonArrayRecords("", json.RawMessage(text))
+	case '{':
+		records = jsonObjectRecords(text)
+	}
+	if len(records) == 0 {
+		return nil, false
+	}
+
+	var chunks []Chunk
+	for _, record := range records {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, record.value); err != nil {
+			continue
+		}
+		recordText := compact.String()
+		if !strings.HasPrefix(record.path, "[") {
+			recordText = record.path + ": " + recordText
+		}
+		if CountTokens(recordText) <= opts.MaxTokens {
+			chunks = append(chunks, Chunk{Text: recordText, Strategy: StrategyJSON, Record: record.path})
+			continue
+		}
+
+		var indented bytes.Buffer
+		json.Indent(&indented, record.value, "", "  ")
+		for _, part := range splitLarge(record.path+":\n"+indented.String(), 1, opts) {
+			chunks = append(chunks, Chunk{Text: part, Strategy: StrategyJSON, Record: record.path})
+		}
+	}
+	return chunks, len(chunks) > 0
+}
+
+// jsonArrayRecords returns the elements of an array, with paths under key
+func jsonArrayRecords(key string, value json.RawMessage) []jsonRecord {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(value, &elements); err != nil {
+		return nil
+	}
+	records := make([]jsonRecord, 0, len(elements))
+	for i, element := range elements {
+		records = append(records, jsonRecord{path: fmt.Sprintf("%s[%d]", key, i), value: element})
+	}
+	return records
+}
+
+// jsonObjectRecords returns the values of an object in the order they are written, with the elements
+// of array values as records of their own
+func jsonObjectRecords(text string) []jsonRecord {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	if _, err := decoder.Token(); err != nil {
+		return nil
+	}
+	var records []jsonRecord
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+		key, _ := token.(string)
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil
+		}
+		if trimmed := bytes.TrimSpace(value); len(trimmed) > 0 && trimmed[0] == '[' {
+			records = append(records, jsonArrayRecords(key, value)...)
+			continue
+		}
+		records = append(records, jsonRecord{path: key, value: value})
+	}
+	return records
+}
+
+// splitLarge splits a record too large for one chunk, starting at a level of splitText
+func splitLarge(text string, level int, opts Options) []string {
+	var pieces []piece
+	for _, p := range splitText(text, opts.MaxTokens, level) {
+		pieces = append(pieces, piece{part: p})
+	}
+	var texts []string
+	for _, chunk := range packPieces(pieces, opts) {
+		texts = append(texts, chunk.Text)
+	}
+	return texts
+}
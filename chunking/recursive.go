@@ -0,0 +1,284 @@
+package chunking
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// headingLine matches a markdown heading, as the extractors write the headings of documents and pages
+	headingLine = regexp.MustCompile(`^(#{1,6})\s+(.+?)[\s#]*$`)
+	// sentenceEnd matches the end of a sentence with the spaces after it
+	sentenceEnd = regexp.MustCompile(`[.!?…]+["'”»)\]]*\s+`)
+)
+
+// section is the text under one heading, down to the next heading of any level
+type section struct {
+	path     []string // Titles of the headings it falls under, its own last
+	headings []string // Heading lines of the path
+	body     string   // Starts with its own heading line, when it has one
+}
+
+// part is a piece of a section small enough for a chunk
+type part struct {
+	text   string
+	sep    string // Joins the part to the one before it
+	tokens int
+}
+
+// piece is a part placed in its section
+type piece struct {
+	part
+	path    []string
+	context []string // Heading lines put before the piece when it starts a chunk
+	section int
+	first   bool // Starts its section
+}
+
+// splitRecursive splits prose into sections by headings, sections into parts by paragraphs, lines,
+// sentences and words, and packs the parts into chunks. A chunk starts with the heading lines of the
+// section it starts in, so it says what it is about out of context.
+func splitRecursive(text string, opts Options) []Chunk {
+	var pieces []piece
+	for i, s := range parseSections(text) {
+		context := headingContext(s.headings, opts.MaxTokens)
+		budget := opts.MaxTokens - CountTokens(strings.Join(context, "\n"))
+		for j, p := range splitText(s.body, budget, 0) {
+			pc := piece{part: p, path: s.path, context: context, section: i, first: j == 0}
+			if j == 0 {
+				pc.sep = "\n\n"
+				// The section's own heading line is part of its first piece
+				if len(context) > 0 && context[len(context)-1] == s.headings[len(s.headings)-1] {
+					pc.context = context[:len(context)-1]
+				}
+			}
+			pieces = append(pieces, pc)
+		}
+	}
+	return packPieces(pieces, opts)
+}
+
+// parseSections splits a text at its markdown headings, leaving out headings in code blocks
+func parseSections(text string) []section {
+	type heading struct {
+		level int
+		title string
+		line  string
+	}
+	var sections []section
+	var open []heading
+	var lines []string
+	flush := func() {
+		body := strings.TrimSpace(strings.Join(lines, "\n"))
+		lines = nil
+		if body == "" {
+			return
+		}
+		s := section{body: body}
+		for _, h := range open {
+			s.path = append(s.path, h.title)
+			s.headings = append(s.headings, h.line)
+		}
+		sections = append(sections, s)
+	}
+
+	inCode := false
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inCode = !inCode
+		}
+		if match := headingLine.FindStringSubmatch(trimmed); match != nil && !inCode {
+			flush()
+			level := len(match[1])
+			for len(open) > 0 && open[len(open)-1].level >= level {
+				open = open[:len(open)-1]
+			}
+			open = append(open, heading{level: level, title: match[2], line: trimmed})
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	return sections
+}
+
+// headingContext returns the heading lines put before a section's chunks: all of them, only the
+// section's own when they would take more than a quarter of a chunk, or none when even that would
+func headingContext(headings []string, maxTokens int) []string {
+	if len(headings) == 0 || CountTokens(strings.Join(headings, "\n")) <= maxTokens/4 {
+		return headings
+	}
+	if own := headings[len(headings)-1:]; CountTokens(own[0]) <= maxTokens/4 {
+		return own
+	}
+	return nil
+}
+
+// splitText splits a text into parts of at most budget tokens, by paragraphs, then lines, sentences,
+// words and finally characters, going further down only for the parts that are still too large
+func splitText(text string, budget, level int) []part {
+	budget = max(budget, 1)
+	if tokens := CountTokens(text); tokens <= budget {
+		return []part{{text: text, tokens: tokens}}
+	}
+
+	var pieces []string
+	var sep string
+	switch level {
+	case 0:
+		pieces, sep = strings.Split(text, "\n\n"), "\n\n"
+	case 1:
+		pieces, sep = strings.Split(text, "\n"), "\n"
+	case 2:
+		pieces, sep = splitSentences(text), " "
+	case 3:
+		pieces, sep = strings.Fields(text), " "
+	default:
+		return splitRunes(text, budget)
+	}
+	if len(pieces) < 2 {
+		return splitText(text, budget, level+1)
+	}
+
+	var parts []part
+	for _, piece := range pieces {
+		piece = strings.TrimSpace(piece)
+		if piece == "" {
+			continue
+		}
+		sub := splitText(piece, budget, level+1)
+		sub[0].sep = sep
+		parts = append(parts, sub...)
+	}
+	return parts
+}
+
+// splitSentences splits a text after each sentence's closing punctuation
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for _, loc := range sentenceEnd.FindAllStringIndex(text, -1) {
+		sentences = append(sentences, text[start:loc[1]])
+		start = loc[1]
+	}
+	return append(sentences, text[start:])
+}
+
+// splitRunes cuts a text without spaces, such as a long URL, into parts of at most budget tokens
+func splitRunes(text string, budget int) []part {
+	var parts []part
+	var counter tokenCounter
+	start := 0
+	for i, r := range text {
+		next := counter
+		next.add(r)
+		if next.total() > budget && i > start {
+			parts = append(parts, part{text: text[start:i], tokens: counter.total()})
+			start = i
+			next = tokenCounter{}
+			next.add(r)
+		}
+		counter = next
+	}
+	return append(parts, part{text: text[start:], tokens: counter.total()})
+}
+
+// packPieces joins consecutive pieces into chunks of at most opts.MaxTokens tokens. A chunk that
+// continues the section the previous one ended in starts with the end of it, up to opts.OverlapTokens.
+func packPieces(pieces []piece, opts Options) []Chunk {
+	var chunks []Chunk
+	var body strings.Builder
+	var context []string
+	var paths [][]string
+	tokens := 0
+	sectionStart := 0 // Where the text of the last piece's section starts in body
+	previous := ""    // Text of the section the previous chunk ended in
+	var last *piece
+
+	flush := func() {
+		text := body.String()
+		if len(context) > 0 {
+			text = strings.Join(context, "\n") + "\n\n" + text
+		}
+		chunks = append(chunks, Chunk{
+			Text:        strings.TrimSpace(text),
+			Strategy:    StrategyRecursive,
+			HeadingPath: commonPath(paths),
+		})
+		previous = body.String()[sectionStart:]
+		body.Reset()
+		context, paths, tokens, sectionStart = nil, nil, 0, 0
+	}
+
+	for i := range pieces {
+		p := &pieces[i]
+		if body.Len() > 0 && tokens+p.tokens > opts.MaxTokens {
+			flush()
+		}
+		if body.Len() == 0 {
+			context = p.context
+			tokens = CountTokens(strings.Join(context, "\n"))
+			if !p.first && last != nil && last.section == p.section && opts.OverlapTokens > 0 {
+				if overlap := tailTokens(previous, min(opts.OverlapTokens, opts.MaxTokens-tokens-p.tokens)); overlap != "" {
+					body.WriteString(overlap)
+					tokens += CountTokens(overlap)
+				}
+			}
+		} else if last.section != p.section {
+			sectionStart = body.Len() + len(p.sep)
+		}
+		if body.Len() > 0 {
+			body.WriteString(p.sep)
+		}
+		body.WriteString(p.text)
+		tokens += p.tokens
+		paths = append(paths, p.path)
+		last = p
+	}
+	if body.Len() > 0 {
+		flush()
+	}
+	return chunks
+}
+
+// tailTokens returns the words at the end of a text that fit in n tokens
+func tailTokens(text string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	start := len(text)
+	for i := len(text) - 1; i > 0; i-- {
+		// Words start after a space; bytes of multibyte runes are never ASCII spaces
+		if !isASCIISpace(text[i-1]) || isASCIISpace(text[i]) {
+			continue
+		}
+		if CountTokens(text[i:]) > n {
+			break
+		}
+		start = i
+	}
+	return strings.TrimSpace(text[start:])
+}
+
+func isASCIISpace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\t'
+}
+
+// commonPath returns the headings all paths start with
+func commonPath(paths [][]string) []string {
+	if len(paths) == 0 {
+		return nil
+	}
+	common := paths[0]
+	for _, p := range paths[1:] {
+		n := 0
+		for n < len(common) && n < len(p) && common[n] == p[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	if len(common) == 0 {
+		return nil
+	}
+	return append([]string(nil), common...)
+}
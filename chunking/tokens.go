@@ -0,0 +1,56 @@
+package chunking
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Characters per token of the embedding providers' tokenizers, roughly. Their vocabularies are mostly
+// English, so Latin words take about four characters a token, while Georgian and other scripts are cut
+// into pieces of a character or two.
+const (
+	latinRunesPerToken = 4
+	otherRunesPerToken = 2
+)
+
+// CountTokens estimates the tokens of a text. Words are counted by their script, every punctuation
+// mark and symbol is a token and spaces are free, so the count of texts joined by whitespace is the sum
+// of their counts.
+func CountTokens(text string) int {
+	var counter tokenCounter
+	for _, r := range text {
+		counter.add(r)
+	}
+	return counter.total()
+}
+
+// tokenCounter counts tokens rune by rune
+type tokenCounter struct {
+	tokens int
+	latin  int // Runes of the current run of Latin letters and digits
+	other  int // Runes of the current run of letters of other scripts
+}
+
+func (c *tokenCounter) add(r rune) {
+	switch {
+	case r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+		c.latin++
+	case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+		c.other++
+	default:
+		c.flush()
+		if !unicode.IsSpace(r) {
+			c.tokens++
+		}
+	}
+}
+
+func (c *tokenCounter) flush() {
+	c.tokens += (c.latin+latinRunesPerToken-1)/latinRunesPerToken + (c.other+otherRunesPerToken-1)/otherRunesPerToken
+	c.latin, c.other = 0, 0
+}
+
+// total returns the tokens counted so far
+func (c *tokenCounter) total() int {
+	return c.tokens + (c.latin+latinRunesPerToken-1)/latinRunesPerToken + (c.other+otherRunesPerToken-1)/otherRunesPerToken
+}
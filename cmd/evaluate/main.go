@@ -0,0 +1,154 @@
+// Command evaluate runs a page's evaluation set through retrieval and generation and prints the scores.
+//
+//	go run ./cmd/evaluate -company acme -set 665f1c2e8b3a4d0012345678 -label "haiku" -model claude-3-5-haiku-20241022
+//	go run ./cmd/evaluate -company acme -set 665f1c2e8b3a4d0012345678 -compare 665f1d0a8b3a4d0012345679
+//
+// Runs are stored like the ones started from the admin API, so they can be compared there too.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"facebook-bot/config"
+	"facebook-bot/models"
+	"facebook-bot/services"
+)
+
+func main() {
+	companyID := flag.String("company", "", "company ID that owns the evaluation set")
+	setID := flag.String("set", "", "evaluation set ID")
+	label := flag.String("label", "", "label to tell this run apart from others")
+	model := flag.String("model", "", "Claude model to use instead of the page's")
+	maxTokens := flag.Int("max-tokens", 0, "max tokens to use instead of the page's")
+	promptTemplate := flag.String("prompt-template", "", "draft reply_system prompt template ID to use instead of the published one")
+	compare := flag.String("compare", "", "run ID to compare the new run against")
+	timeout := flag.Duration("timeout", 30*time.Minute, "timeout for the whole run")
+	verbose := flag.Bool("v", false, "print every case result")
+	flag.Parse()
+
+	if *companyID == "" || *setID == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		slog.Info("No .env file found")
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelWarn,
+	})))
+
+	cfg := config.LoadConfig()
+	services.SetAPIEndpoints(services.APIEndpoints{
+		AnthropicBaseURL: cfg.AnthropicAPIURL,
+		OpenAIBaseURL:    cfg.OpenAIAPIURL,
+		GraphAPIBaseURL:  cfg.GraphAPIURL,
+	})
+	if err := services.SetVectorIndex(services.VectorIndexConfig{
+		Backend:        cfg.VectorIndex,
+		AtlasIndexName: cfg.AtlasVectorIndexName,
+	}); err != nil {
+		fail("configure vector index", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	db, err := services.InitMongoDB(ctx, cfg.MongoURI)
+	if err != nil {
+		fail("connect to MongoDB", err)
+	}
+	defer db.Disconnect(context.Background())
+	services.InitServices(db, cfg.DatabaseName)
+
+	// Retrieval should take the same path as on the server
+	if err := services.BuildVectorIndex(ctx); err != nil {
+		fail("build vector index", err)
+	}
+
+	set, err := services.GetEvalSet(ctx, *setID, *companyID)
+	if err != nil {
+		fail("load evaluation set", err)
+	}
+	if set == nil {
+		fail("load evaluation set", fmt.Errorf("set %s not found for company %s", *setID, *companyID))
+	}
+
+	var base *models.EvalRun
+	if *compare != "" {
+		if base, err = services.GetEvalRun(ctx, *compare, *companyID); err != nil || base == nil {
+			fail("load run to compare with", fmt.Errorf("run %s not found: %v", *compare, err))
+		}
+	}
+
+	overrides := models.EvalOverrides{
+		Model:            *model,
+		MaxTokens:        *maxTokens,
+		PromptTemplateID: *promptTemplate,
+	}
+	run, err := services.StartEvalRun(ctx, set, *label, overrides, "cli")
+	if err != nil {
+		fail("start run", err)
+	}
+	fmt.Printf("Run %s: %d cases of %q with %s\n", run.ID.Hex(), len(set.Cases), set.Name, run.Config.Model)
+
+	if err := services.ExecuteEvalRun(ctx, set, run); err != nil {
+		fmt.Fprintf(os.Stderr, "Run finished with an error: %v\n", err)
+	}
+
+	if *verbose {
+		for _, result := range run.Results {
+			status := "PASS"
+			if !result.Passed {
+				status = "FAIL"
+			}
+			fmt.Printf("%s %-8s facts %.2f escalated %-5t language %-5t %5dms  %s\n",
+				status, result.CaseID, result.FactScore, result.Escalated, result.LanguageMatch, result.LatencyMs, result.Question)
+			if len(result.FactsMissing) > 0 {
+				fmt.Printf("     missing: %v\n", result.FactsMissing)
+			}
+			if result.Error != "" {
+				fmt.Printf("     error: %s\n", result.Error)
+			}
+		}
+	}
+
+	summary := run.Summary
+	fmt.Printf("Passed %d/%d (%.1f%%), errors %d\n", summary.Passed, summary.Cases, summary.PassRate*100, summary.Errors)
+	fmt.Printf("Fact score %.3f, escalation accuracy %.3f, language match %.3f\n",
+		summary.FactScore, summary.EscalationAccuracy, summary.LanguageMatchRate)
+	fmt.Printf("Latency avg %dms p95 %dms, tokens %d in / %d out, cost $%.4f\n",
+		summary.AvgLatencyMs, summary.P95LatencyMs, summary.InputTokens, summary.OutputTokens, summary.TotalCost)
+
+	if base != nil {
+		comparison, err := services.CompareEvalRuns(base, run)
+		if err != nil {
+			fail("compare runs", err)
+		}
+		out, _ := json.MarshalIndent(comparison.Delta, "", "  ")
+		fmt.Printf("Compared with %s:\n%s\n", base.ID.Hex(), out)
+		for _, caseComparison := range comparison.Cases {
+			if caseComparison.Change == models.EvalChangeImproved || caseComparison.Change == models.EvalChangeRegressed {
+				fmt.Printf("  %-9s %-8s %s\n", caseComparison.Change, caseComparison.CaseID, caseComparison.Question)
+			}
+		}
+	}
+
+	if run.Status != models.EvalStatusCompleted {
+		os.Exit(1)
+	}
+}
+
+// fail prints an error and exits
+func fail(action string, err error) {
+	fmt.Fprintf(os.Stderr, "Failed to %s: %v\n", action, err)
+	os.Exit(1)
+}
@@ -15,6 +15,15 @@ type Config struct {
 
 	// Server configuration
 	Port string
+
+	// External API base URLs, empty for the public endpoints
+	AnthropicAPIURL string
+	OpenAIAPIURL    string
+	GraphAPIURL     string
+
+	// Vector index backend: "memory" (default) or "atlas" for MongoDB Atlas $vectorSearch
+	VectorIndex          string
+	AtlasVectorIndexName string
 }
 
 func LoadConfig() *Config {
@@ -23,6 +32,13 @@ func LoadConfig() *Config {
 		DatabaseName: getEnv("MONGO_DB_NAME", "facebook_bot"),
 		VerifyToken:  getEnv("WEBHOOK_VERIFY_TOKEN", "webhook_verify_token"),
 		Port:         getEnv("PORT", "8080"),
+
+		AnthropicAPIURL: os.Getenv("ANTHROPIC_API_URL"),
+		OpenAIAPIURL:    os.Getenv("OPENAI_API_URL"),
+		GraphAPIURL:     os.Getenv("GRAPH_API_URL"),
+
+		VectorIndex:          getEnv("VECTOR_INDEX", "memory"),
+		AtlasVectorIndexName: getEnv("ATLAS_VECTOR_INDEX_NAME", "vector_index"),
 	}
 
 	// Validate required configuration
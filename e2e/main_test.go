@@ -0,0 +1,292 @@
+// Package e2e drives the webhook through the whole reply flow against a throwaway MongoDB
+// and fake Anthropic and Graph API servers.
+//
+// The tests are skipped unless E2E_MONGO_URI points at a MongoDB server, e.g.
+//
+//	E2E_MONGO_URI=mongodb://localhost:27017 go test ./e2e/
+//
+// Each run uses its own database, which is dropped afterwards.
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"facebook-bot/config"
+	"facebook-bot/models"
+	"facebook-bot/services"
+	"facebook-bot/testutil"
+	"facebook-bot/webhooks"
+)
+
+// replyTimeout bounds how long a test waits for the asynchronous webhook processing
+const replyTimeout = 15 * time.Second
+
+var (
+	app       *fiber.App
+	anthropic *testutil.FakeAnthropic
+	graph     *testutil.FakeGraph
+	database  *mongo.Database
+	idCounter atomic.Int64
+)
+
+func TestMain(m *testing.M) {
+	uri := os.Getenv("E2E_MONGO_URI")
+	if uri == "" {
+		fmt.Println("E2E_MONGO_URI not set, skipping end-to-end tests")
+		os.Exit(m.Run())
+	}
+
+	if os.Getenv("E2E_VERBOSE") == "" {
+		slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, err := services.InitMongoDB(ctx, uri)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to MongoDB: %v\n", err)
+		os.Exit(1)
+	}
+
+	services.InitServices(client, fmt.Sprintf("e2e_%d", time.Now().UnixNano()))
+	database = services.GetDatabase()
+	if err := services.InitPromptTemplates(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to seed prompt templates: %v\n", err)
+	}
+	if err := services.BuildVectorIndex(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to build vector index: %v\n", err)
+	}
+
+	anthropic = testutil.NewFakeAnthropic()
+	graph = testutil.NewFakeGraph("", "")
+	services.SetAPIEndpoints(services.APIEndpoints{
+		AnthropicBaseURL: anthropic.URL(),
+		GraphAPIBaseURL:  graph.URL(),
+	})
+
+	app = fiber.New()
+	webhooks.RegisterRoutes(app, &config.Config{VerifyToken: "e2e-verify-token"})
+
+	code := m.Run()
+
+	// Let webhook goroutines of the last test finish before the database goes away
+	time.Sleep(200 * time.Millisecond)
+
+	anthropic.Close()
+	graph.Close()
+
+	cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if err := database.Drop(cleanupCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to drop test database: %v\n", err)
+	}
+	client.Disconnect(cleanupCtx)
+	cleanupCancel()
+
+	os.Exit(code)
+}
+
+// scenario is a company with one page, seeded for a single test. Pages and models get unique
+// names so the company cache and the circuit breakers never carry state between tests.
+type scenario struct {
+	t             *testing.T
+	company       *models.Company
+	pageID        string
+	pageName      string
+	primaryModel  string
+	fallbackModel string
+}
+
+// newScenario resets the fakes and seeds a company whose page talks to them
+func newScenario(t *testing.T, configure ...func(*models.Company)) *scenario {
+	t.Helper()
+	if database == nil {
+		t.Skip("E2E_MONGO_URI not set")
+	}
+
+	id := idCounter.Add(1)
+	s := &scenario{
+		t:             t,
+		pageID:        fmt.Sprintf("page_%d_%d", time.Now().UnixNano(), id),
+		pageName:      fmt.Sprintf("E2E Page %d", id),
+		primaryModel:  fmt.Sprintf("claude-e2e-primary-%d", id),
+		fallbackModel: fmt.Sprintf("claude-e2e-fallback-%d", id),
+	}
+
+	anthropic.Reset()
+	graph.Reset()
+	graph.SetPage(s.pageID, s.pageName)
+
+	s.company = &models.Company{
+		CompanyID:       fmt.Sprintf("company_%d", id),
+		CompanyName:     "E2E Company",
+		DefaultLanguage: models.LanguageEnglish,
+		IsActive:        true,
+		Pages: []models.FacebookPage{{
+			PageID:          s.pageID,
+			PageName:        s.pageName,
+			PageAccessToken: "e2e-page-token",
+			ClaudeAPIKey:    "e2e-claude-key",
+			ClaudeModel:     s.primaryModel,
+			IsActive:        true,
+			MaxTokens:       512,
+			FallbackChain: []models.FallbackModel{
+				{Provider: models.UsageProviderAnthropic, Model: s.fallbackModel},
+			},
+		}},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	for _, fn := range configure {
+		fn(s.company)
+	}
+
+	if _, err := database.Collection("companies").InsertOne(context.Background(), s.company); err != nil {
+		t.Fatalf("failed to seed company: %v", err)
+	}
+	return s
+}
+
+// newCustomerID returns a customer ID unique to the test run
+func newCustomerID() string {
+	return fmt.Sprintf("user_%d_%d", time.Now().UnixNano(), idCounter.Add(1))
+}
+
+// postWebhook sends a webhook payload and checks it is accepted
+func (s *scenario) postWebhook(payload webhooks.WebhookEvent) {
+	s.t.Helper()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		s.t.Fatalf("failed to encode webhook: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		s.t.Fatalf("webhook request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != fiber.StatusOK || string(respBody) != "EVENT_RECEIVED" {
+		s.t.Fatalf("webhook returned %d %q", resp.StatusCode, respBody)
+	}
+}
+
+// sendMessage posts a Messenger message from a customer to the page
+func (s *scenario) sendMessage(customerID, text string) {
+	s.t.Helper()
+	s.postWebhook(webhooks.WebhookEvent{
+		Object: "page",
+		Entry: []webhooks.Entry{{
+			ID:   s.pageID,
+			Time: time.Now().UnixMilli(),
+			Messaging: []webhooks.Messaging{{
+				Sender:    webhooks.User{ID: customerID},
+				Recipient: webhooks.User{ID: s.pageID},
+				Timestamp: time.Now().UnixMilli(),
+				Message: &webhooks.Message{
+					MID:  fmt.Sprintf("mid_%d", idCounter.Add(1)),
+					Text: text,
+				},
+			}},
+		}},
+	})
+}
+
+// sendComment posts a comment of a user on one of the page's posts
+func (s *scenario) sendComment(commentID, postID, userID, userName, text string) {
+	s.t.Helper()
+	s.postWebhook(webhooks.WebhookEvent{
+		Object: "page",
+		Entry: []webhooks.Entry{{
+			ID:   s.pageID,
+			Time: time.Now().UnixMilli(),
+			Changes: []webhooks.Change{{
+				Field: "feed",
+				Value: webhooks.ChangeValue{
+					Item:        "comment",
+					CommentID:   commentID,
+					PostID:      postID,
+					ParentID:    postID,
+					From:        &webhooks.FacebookUser{ID: userID, Name: userName},
+					Message:     text,
+					CreatedTime: time.Now().Unix(),
+				},
+			}},
+		}},
+	})
+}
+
+// waitForResponse waits for the analytics record the handlers save once a message or comment is handled
+func (s *scenario) waitForResponse(filter bson.M) models.Response {
+	s.t.Helper()
+	filter["page_id"] = s.pageID
+
+	var response models.Response
+	ok := eventually(replyTimeout, func() bool {
+		err := database.Collection("responses").FindOne(context.Background(), filter).Decode(&response)
+		return err == nil
+	})
+	if !ok {
+		s.t.Fatalf("no response record matching %v within %s", filter, replyTimeout)
+	}
+	return response
+}
+
+// countMessages counts the stored Messenger messages of a customer
+func (s *scenario) countMessages(customerID string, isBot bool) int64 {
+	s.t.Helper()
+	count, err := database.Collection("messages").CountDocuments(context.Background(), bson.M{
+		"page_id": s.pageID,
+		"chat_id": customerID,
+		"is_bot":  isBot,
+	})
+	if err != nil {
+		s.t.Fatalf("failed to count messages: %v", err)
+	}
+	return count
+}
+
+// customer loads a customer of the page
+func (s *scenario) customer(customerID string) *models.Customer {
+	s.t.Helper()
+	customer, err := services.GetCustomer(context.Background(), customerID, s.pageID)
+	if err != nil {
+		s.t.Fatalf("failed to load customer: %v", err)
+	}
+	if customer == nil {
+		s.t.Fatalf("customer %s not found", customerID)
+	}
+	return customer
+}
+
+// eventually polls a condition until it holds or the timeout passes
+func eventually(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if condition() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+}
@@ -0,0 +1,460 @@
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"facebook-bot/models"
+	"facebook-bot/services"
+	"facebook-bot/testutil"
+)
+
+func TestMessengerReply(t *testing.T) {
+	s := newScenario(t)
+	customerID := newCustomerID()
+	graph.AddUser(customerID, testutil.GraphUser{FirstName: "Nino", LastName: "Beridze"})
+	anthropic.Enqueue(testutil.AgentIntentReply("continue_bot", "We are open from 10:00 to 19:00."))
+
+	s.sendMessage(customerID, "Hello, what are your opening hours today?")
+
+	sent, ok := graph.WaitForMessages(customerID, 1, replyTimeout)
+	if !ok {
+		t.Fatal("no reply sent to the customer")
+	}
+	if sent[0].Text != "We are open from 10:00 to 19:00." {
+		t.Errorf("reply = %q", sent[0].Text)
+	}
+	if sent[0].AccessToken != "e2e-page-token" {
+		t.Errorf("reply sent with access token %q", sent[0].AccessToken)
+	}
+
+	response := s.waitForResponse(bson.M{"sender_id": customerID})
+	if response.Tier != models.ReplyTierPrimary || response.Model != s.primaryModel {
+		t.Errorf("reply served by %s/%s, want primary/%s", response.Tier, response.Model, s.primaryModel)
+	}
+
+	requests := anthropic.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("model called %d times, want 1", len(requests))
+	}
+	if len(requests[0].Tools) != 1 || requests[0].Tools[0].Name != "detect_agent_request" {
+		t.Errorf("reply request tools = %+v", requests[0].Tools)
+	}
+	if content, _ := requests[0].Messages[0].Content.(string); !strings.Contains(content, "what are your opening hours") {
+		t.Errorf("customer message missing from prompt: %q", content)
+	}
+
+	if n := s.countMessages(customerID, false); n != 1 {
+		t.Errorf("stored %d customer messages, want 1", n)
+	}
+	if n := s.countMessages(customerID, true); n != 1 {
+		t.Errorf("stored %d bot messages, want 1", n)
+	}
+	if customer := s.customer(customerID); customer.FirstName != "Nino" || customer.Stop {
+		t.Errorf("customer = %+v", customer)
+	}
+}
+
+func TestMessengerReplyReadsPageKnowledgeFromCache(t *testing.T) {
+	s := newScenario(t)
+	var knowledge strings.Builder
+	for i := 1; i <= 60; i++ {
+		fmt.Fprintf(&knowledge, "Jacket model W%d is made of wool, costs %d GEL and ships within two days to Tbilisi, Batumi and Kutaisi.\n", i, 100+i)
+	}
+	_, err := database.Collection("vector_documents").InsertOne(context.Background(), bson.M{
+		"company_id": s.company.CompanyID,
+		"page_id":    s.pageID,
+		"content":    knowledge.String(),
+		"source":     "crm",
+		"channels":   bson.M{"messenger": true},
+		"is_active":  true,
+		"created_at": time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("failed to seed knowledge: %v", err)
+	}
+
+	first, second := newCustomerID(), newCustomerID()
+	anthropic.Enqueue(
+		testutil.AgentIntentReply("continue_bot", "Model W1 costs 101 GEL."),
+		testutil.AgentIntentReply("continue_bot", "Model W2 costs 102 GEL."),
+	)
+
+	s.sendMessage(first, "How much is the W1 jacket?")
+	if _, ok := graph.WaitForMessages(first, 1, replyTimeout); !ok {
+		t.Fatal("no reply sent to the first customer")
+	}
+	s.sendMessage(second, "How much is the W2 jacket?")
+	if _, ok := graph.WaitForMessages(second, 1, replyTimeout); !ok {
+		t.Fatal("no reply sent to the second customer")
+	}
+
+	requests := anthropic.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("model called %d times, want 2", len(requests))
+	}
+	system := requests[0].System
+	last := system[len(system)-1]
+	for _, block := range system {
+		if block.CacheControl != nil {
+			last = block
+		}
+	}
+	if last.CacheControl == nil || !strings.Contains(last.Text, "Jacket model W60") {
+		t.Errorf("system prompt %+v does not end its cached prefix with the page knowledge", system)
+	}
+
+	usage := anthropic.Usage()
+	if usage[0].CacheCreationInputTokens == 0 || usage[0].CacheReadInputTokens != 0 {
+		t.Errorf("first reply usage = %+v, want a cache write", usage[0])
+	}
+	if usage[1].CacheReadInputTokens == 0 || usage[1].CacheReadInputTokens != usage[0].CacheCreationInputTokens {
+		t.Errorf("second reply usage = %+v, want the first reply's %d cached tokens read", usage[1], usage[0].CacheCreationInputTokens)
+	}
+
+	// The cache read is recorded with the second customer's usage
+	recorded := eventually(replyTimeout, func() bool {
+		n, err := database.Collection("usage_events").CountDocuments(context.Background(), bson.M{
+			"customer_id":       second,
+			"cache_read_tokens": usage[1].CacheReadInputTokens,
+		})
+		return err == nil && n == 1
+	})
+	if !recorded {
+		t.Error("cache read tokens not recorded in usage events")
+	}
+}
+
+func TestMessengerToolOnlyAnswerMakesFollowUpCall(t *testing.T) {
+	s := newScenario(t)
+	customerID := newCustomerID()
+	anthropic.Enqueue(
+		testutil.AgentIntentReply("continue_bot", ""),
+		testutil.TextReply("Delivery takes two days."),
+	)
+
+	s.sendMessage(customerID, "How long does delivery take to Batumi?")
+
+	sent, ok := graph.WaitForMessages(customerID, 1, replyTimeout)
+	if !ok {
+		t.Fatal("no reply sent to the customer")
+	}
+	if sent[0].Text != "Delivery takes two days." {
+		t.Errorf("reply = %q", sent[0].Text)
+	}
+
+	requests := anthropic.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("model called %d times, want 2", len(requests))
+	}
+	if len(requests[1].Tools) != 0 {
+		t.Errorf("follow-up request has tools: %+v", requests[1].Tools)
+	}
+	if requests[1].Model != s.primaryModel {
+		t.Errorf("follow-up sent to %s, want the tier that answered (%s)", requests[1].Model, s.primaryModel)
+	}
+}
+
+func TestMessengerAgentRequestHandsOff(t *testing.T) {
+	s := newScenario(t)
+	customerID := newCustomerID()
+	anthropic.Enqueue(testutil.AgentIntentReply("wants_agent", "Connecting you with a colleague."))
+
+	s.sendMessage(customerID, "I want to talk to a real person please")
+
+	s.waitForResponse(bson.M{"sender_id": customerID})
+	if !s.customer(customerID).Stop {
+		t.Error("customer not handed to a human")
+	}
+	if sent := graph.SentMessages(); len(sent) != 0 {
+		t.Errorf("bot replied to an agent request: %+v", sent)
+	}
+
+	// Later messages wait for the human and never reach the model
+	calls := len(anthropic.Requests())
+	s.sendMessage(customerID, "Hello? Is anyone there?")
+	if !eventually(replyTimeout, func() bool { return s.countMessages(customerID, false) == 2 }) {
+		t.Fatal("second customer message not stored")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := len(anthropic.Requests()); got != calls {
+		t.Errorf("model called %d times after handoff", got-calls)
+	}
+	if sent := graph.SentMessages(); len(sent) != 0 {
+		t.Errorf("bot replied after handoff: %+v", sent)
+	}
+}
+
+func TestMessengerFallsBackWhenPrimaryModelFails(t *testing.T) {
+	s := newScenario(t)
+	customerID := newCustomerID()
+	anthropic.Enqueue(
+		testutil.ErrorReply(http.StatusInternalServerError, "internal error").ForModel(s.primaryModel),
+		testutil.AgentIntentReply("continue_bot", "Answer from the fallback model.").ForModel(s.fallbackModel),
+	)
+
+	s.sendMessage(customerID, "Do you have the blue jacket in size M?")
+
+	sent, ok := graph.WaitForMessages(customerID, 1, replyTimeout)
+	if !ok {
+		t.Fatal("no reply sent to the customer")
+	}
+	if sent[0].Text != "Answer from the fallback model." {
+		t.Errorf("reply = %q", sent[0].Text)
+	}
+
+	response := s.waitForResponse(bson.M{"sender_id": customerID})
+	if response.Tier != models.ReplyTierFallback || response.Model != s.fallbackModel {
+		t.Errorf("reply served by %s/%s, want fallback/%s", response.Tier, response.Model, s.fallbackModel)
+	}
+}
+
+func TestMessengerHandsOffWhenAllModelsFail(t *testing.T) {
+	s := newScenario(t)
+	customerID := newCustomerID()
+	anthropic.SetDefault(testutil.ErrorReply(http.StatusInternalServerError, "internal error"))
+
+	s.sendMessage(customerID, "Can I return an item I bought last week?")
+
+	sent, ok := graph.WaitForMessages(customerID, 1, replyTimeout)
+	if !ok {
+		t.Fatal("no handoff notice sent to the customer")
+	}
+	if want := services.LocalizedMessage(services.MessageKeyHumanHandoff, models.LanguageEnglish); sent[0].Text != want {
+		t.Errorf("handoff notice = %q, want %q", sent[0].Text, want)
+	}
+
+	response := s.waitForResponse(bson.M{"sender_id": customerID})
+	if response.Tier != models.ReplyTierHuman {
+		t.Errorf("reply tier = %q, want human", response.Tier)
+	}
+	if !s.customer(customerID).Stop {
+		t.Error("customer not handed to a human")
+	}
+	if got := len(anthropic.Requests()); got != 2 {
+		t.Errorf("model called %d times, want once per tier", got)
+	}
+}
+
+func TestMessengerSlowModelStillReplies(t *testing.T) {
+	s := newScenario(t)
+	customerID := newCustomerID()
+	anthropic.Enqueue(testutil.AgentIntentReply("continue_bot", "Sorry for the wait, yes we do.").WithDelay(500 * time.Millisecond))
+
+	s.sendMessage(customerID, "Do you ship to Kutaisi?")
+
+	sent, ok := graph.WaitForMessages(customerID, 1, replyTimeout)
+	if !ok {
+		t.Fatal("no reply sent to the customer")
+	}
+	if sent[0].Text != "Sorry for the wait, yes we do." {
+		t.Errorf("reply = %q", sent[0].Text)
+	}
+}
+
+func TestCommentReply(t *testing.T) {
+	s := newScenario(t)
+	userID := newCustomerID()
+	postID := s.pageID + "_post1"
+	commentID := postID + "_comment1"
+	graph.AddUser(userID, testutil.GraphUser{FirstName: "Giorgi", LastName: "Kapanadze"})
+	graph.AddPost(postID, "New winter collection is in stores now!")
+	graph.AddComment(commentID, userID)
+	anthropic.Enqueue(testutil.AgentIntentReply("continue_bot", "Thank you! Prices start at 49 GEL."))
+
+	s.sendComment(commentID, postID, userID, "Giorgi Kapanadze", "How much are the new jackets?")
+
+	reply, ok := graph.WaitForCommentReply(commentID, replyTimeout)
+	if !ok {
+		t.Fatal("no reply posted to the comment")
+	}
+	if reply.Message != "Thank you! Prices start at 49 GEL." {
+		t.Errorf("comment reply = %q", reply.Message)
+	}
+
+	response := s.waitForResponse(bson.M{"comment_id": commentID})
+	if response.Type != "comment" || response.Tier != models.ReplyTierPrimary {
+		t.Errorf("response record = %+v", response)
+	}
+
+	requests := anthropic.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("model called %d times, want 1", len(requests))
+	}
+	if content, _ := requests[0].Messages[0].Content.(string); !strings.Contains(content, "New winter collection") {
+		t.Errorf("post content missing from prompt: %q", content)
+	}
+}
+
+func TestCommentFromPageIsIgnored(t *testing.T) {
+	s := newScenario(t)
+	postID := s.pageID + "_post1"
+	commentID := postID + "_comment1"
+	graph.AddComment(commentID, s.pageID)
+
+	s.sendComment(commentID, postID, s.pageID, s.pageName, "Our winter sale starts tomorrow!")
+
+	time.Sleep(500 * time.Millisecond)
+	if replies := graph.CommentReplies(); len(replies) != 0 {
+		t.Errorf("bot replied to the page's own comment: %+v", replies)
+	}
+	if got := len(anthropic.Requests()); got != 0 {
+		t.Errorf("model called %d times for the page's own comment", got)
+	}
+}
+
+func TestMessengerEscalatesAngryCustomer(t *testing.T) {
+	s := newScenario(t, func(company *models.Company) {
+		company.Pages[0].EscalationRules = &models.EscalationRules{Enabled: true, OnAngry: true}
+	})
+	customerID := newCustomerID()
+	reply := testutil.AgentIntentReply("continue_bot", "I am sorry to hear that.")
+	reply.Content[0].Input.Sentiment = models.SentimentAngry
+	reply.Content[0].Input.Urgency = models.UrgencyMedium
+	anthropic.Enqueue(reply)
+
+	s.sendMessage(customerID, "Third time I'm writing about my order, where is it?")
+
+	sent, ok := graph.WaitForMessages(customerID, 1, replyTimeout)
+	if !ok {
+		t.Fatal("no handoff notice sent to the customer")
+	}
+	if want := services.LocalizedMessage(services.MessageKeyHumanHandoff, models.LanguageEnglish); sent[0].Text != want {
+		t.Errorf("handoff notice = %q, want %q", sent[0].Text, want)
+	}
+
+	s.waitForResponse(bson.M{"sender_id": customerID})
+	customer := s.customer(customerID)
+	if !customer.Stop {
+		t.Error("angry customer not handed to a human")
+	}
+	if customer.Sentiment == nil || customer.Sentiment.LastSentiment != models.SentimentAngry {
+		t.Errorf("customer sentiment = %+v", customer.Sentiment)
+	}
+
+	var message models.Message
+	err := database.Collection("messages").FindOne(context.Background(), bson.M{
+		"page_id": s.pageID,
+		"chat_id": customerID,
+		"is_bot":  false,
+	}).Decode(&message)
+	if err != nil {
+		t.Fatalf("customer message not stored: %v", err)
+	}
+	if message.Sentiment == nil || message.Sentiment.Source != models.SentimentSourceModel || message.Sentiment.Urgency != models.UrgencyMedium {
+		t.Errorf("message sentiment = %+v", message.Sentiment)
+	}
+}
+
+func TestMessengerEscalatesUnanswerableQuestion(t *testing.T) {
+	s := newScenario(t, func(company *models.Company) {
+		company.Pages[0].AnswerabilityPolicy = &models.AnswerabilityPolicy{
+			Enabled:        true,
+			OnUnanswerable: models.AnswerabilityActionEscalate,
+		}
+	})
+	customerID := newCustomerID()
+	reply := testutil.AgentIntentReply("continue_bot", "A colleague will help you with that.")
+	reply.Content[0].Input.Answerability = models.AnswerabilityUnanswerable
+	anthropic.Enqueue(reply)
+
+	s.sendMessage(customerID, "Do you ship to Antarctica?")
+
+	sent, ok := graph.WaitForMessages(customerID, 1, replyTimeout)
+	if !ok {
+		t.Fatal("no handoff notice sent to the customer")
+	}
+	if want := services.LocalizedMessage(services.MessageKeyHumanHandoff, models.LanguageEnglish); sent[0].Text != want {
+		t.Errorf("handoff notice = %q, want %q", sent[0].Text, want)
+	}
+
+	requests := anthropic.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("model called %d times, want 1", len(requests))
+	}
+	if input, _ := requests[0].Messages[0].Content.(string); !strings.Contains(input, "KNOWLEDGE BASE MATCH: none") {
+		t.Errorf("reply request does not carry the retrieval confidence: %q", input)
+	}
+
+	s.waitForResponse(bson.M{"sender_id": customerID})
+	if !s.customer(customerID).Stop {
+		t.Error("customer with an unanswerable question not handed to a human")
+	}
+
+	var question models.UnansweredQuestion
+	found := eventually(replyTimeout, func() bool {
+		return database.Collection("unanswered_questions").FindOne(context.Background(), bson.M{
+			"page_id":     s.pageID,
+			"customer_id": customerID,
+		}).Decode(&question) == nil
+	})
+	if !found {
+		t.Fatal("unanswered question not logged")
+	}
+	if question.Reason != models.UnansweredReasonUnanswerable || question.Action != models.AnswerabilityActionEscalate {
+		t.Errorf("unanswered question = %+v", question)
+	}
+	if question.Retrieval.Level != models.RetrievalLevelNone {
+		t.Errorf("retrieval confidence = %+v", question.Retrieval)
+	}
+}
+
+func TestInactiveHumanConversationIsHandedBackToBot(t *testing.T) {
+	s := newScenario(t, func(company *models.Company) {
+		company.Pages[0].HandBackPolicy = &models.HandBackPolicy{
+			Enabled:           true,
+			InactivityMinutes: 30,
+			TransitionMessage: "Our team is away, the assistant will help you in the meantime.",
+		}
+	})
+	customerID := newCustomerID()
+	anthropic.Enqueue(testutil.AgentIntentReply("wants_agent", ""))
+
+	s.sendMessage(customerID, "Can I talk to someone from the shop?")
+	s.waitForResponse(bson.M{"sender_id": customerID})
+	if !s.customer(customerID).Stop {
+		t.Fatal("customer not handed to a human")
+	}
+
+	// Nobody picks the conversation up for longer than the policy allows
+	stoppedAt := time.Now().Add(-31 * time.Minute)
+	_, err := database.Collection("customers").UpdateOne(context.Background(),
+		bson.M{"customer_id": customerID, "page_id": s.pageID},
+		bson.M{"$set": bson.M{"stopped_at": stoppedAt}})
+	if err != nil {
+		t.Fatalf("failed to backdate handoff: %v", err)
+	}
+
+	if _, err := services.RunHandBacks(context.Background(), time.Now()); err != nil {
+		t.Fatalf("hand-back run failed: %v", err)
+	}
+
+	customer := s.customer(customerID)
+	if customer.Stop || customer.HandBackReason != models.HandBackReasonInactivity {
+		t.Errorf("customer after hand-back = stop %v, reason %q", customer.Stop, customer.HandBackReason)
+	}
+	sent, ok := graph.WaitForMessages(customerID, 1, replyTimeout)
+	if !ok {
+		t.Fatal("no transition message sent")
+	}
+	if sent[0].Text != "Our team is away, the assistant will help you in the meantime." {
+		t.Errorf("transition message = %q", sent[0].Text)
+	}
+
+	// The bot answers again
+	anthropic.Enqueue(testutil.AgentIntentReply("continue_bot", "Yes, we are open on Sundays."))
+	s.sendMessage(customerID, "Are you open on Sundays?")
+	sent, ok = graph.WaitForMessages(customerID, 2, replyTimeout)
+	if !ok {
+		t.Fatal("bot did not answer after hand-back")
+	}
+	if sent[1].Text != "Yes, we are open on Sundays." {
+		t.Errorf("reply = %q", sent[1].Text)
+	}
+}
@@ -33,9 +33,31 @@ type PageFullRequest struct {
 	VoyageModel     string `json:"voyage_model,omitempty"`
 	GPTAPIKey       string `json:"gpt_api_key,omitempty"`
 	GPTModel        string `json:"gpt_model,omitempty"`
+	CohereAPIKey    string `json:"cohere_api_key,omitempty"`
 	SystemPrompt    string `json:"system_prompt,omitempty"`
 	IsActive        bool   `json:"is_active"`
 	MaxTokens       int    `json:"max_tokens"`
+
+	EmbeddingProvider string `json:"embedding_provider,omitempty"` // openai, voyage, cohere or mock
+	EmbeddingModel    string `json:"embedding_model,omitempty"`
+
+	HybridSearch *models.HybridSearch   `json:"hybrid_search,omitempty"` // Weights of the vector and keyword rankings in knowledge base search
+	Reranker     *models.RerankerConfig `json:"reranker,omitempty"`      // Second-stage reranking of retrieved chunks
+	Chunking     *models.ChunkingConfig `json:"chunking,omitempty"`      // Chunk sizes of knowledge base documents
+
+	LeadCaptureEnabled bool     `json:"lead_capture_enabled,omitempty"`
+	Vertical           string   `json:"vertical,omitempty"` // Prompt template vertical: store or real_estate
+	LinkAllowlist      []string `json:"link_allowlist,omitempty"`
+	GuardrailOnBlock   string   `json:"guardrail_on_block,omitempty"` // regenerate or escalate
+	KnowledgeLanguage  string   `json:"knowledge_language,omitempty"` // Language of the knowledge base documents
+
+	FallbackChain []models.FallbackModel `json:"fallback_chain,omitempty"` // Models tried when the Claude model fails
+
+	EscalationRules *models.EscalationRules `json:"escalation_rules,omitempty"` // Hand upset or hurried customers to a human
+
+	HandBackPolicy *models.HandBackPolicy `json:"hand_back_policy,omitempty"` // Return stalled human conversations to the bot
+
+	AnswerabilityPolicy *models.AnswerabilityPolicy `json:"answerability_policy,omitempty"` // Answer, clarify or escalate when the knowledge base has no answer
 }
 
 // PageUpdateRequest represents updates to an existing page configuration
@@ -49,9 +71,66 @@ type PageUpdateRequest struct {
 	VoyageModel     string `json:"voyage_model,omitempty"`
 	GPTAPIKey       string `json:"gpt_api_key,omitempty"`
 	GPTModel        string `json:"gpt_model,omitempty"`
+	CohereAPIKey    string `json:"cohere_api_key,omitempty"`
 	SystemPrompt    string `json:"system_prompt,omitempty"`
 	IsActive        *bool  `json:"is_active,omitempty"`
 	MaxTokens       *int   `json:"max_tokens,omitempty"`
+
+	EmbeddingProvider string `json:"embedding_provider,omitempty"` // Documents embedded with the previous model must be embedded again
+	EmbeddingModel    string `json:"embedding_model,omitempty"`
+
+	HybridSearch *models.HybridSearch   `json:"hybrid_search,omitempty"` // Replaces the page's weights
+	Reranker     *models.RerankerConfig `json:"reranker,omitempty"`      // Replaces the page's rerank settings
+	Chunking     *models.ChunkingConfig `json:"chunking,omitempty"`      // Replaces the page's chunk sizes
+
+	LeadCaptureEnabled *bool    `json:"lead_capture_enabled,omitempty"`
+	Vertical           string   `json:"vertical,omitempty"`
+	LinkAllowlist      []string `json:"link_allowlist,omitempty"` // An empty list removes all allowed hosts
+	GuardrailOnBlock   string   `json:"guardrail_on_block,omitempty"`
+	KnowledgeLanguage  string   `json:"knowledge_language,omitempty"`
+
+	FallbackChain []models.FallbackModel `json:"fallback_chain,omitempty"` // An empty list restores the default chain
+
+	EscalationRules *models.EscalationRules `json:"escalation_rules,omitempty"` // Replaces the page's rules, "enabled": false turns them off
+
+	HandBackPolicy *models.HandBackPolicy `json:"hand_back_policy,omitempty"` // Replaces the page's policy, "enabled": false turns it off
+
+	AnswerabilityPolicy *models.AnswerabilityPolicy `json:"answerability_policy,omitempty"` // Replaces the page's policy, "enabled": false turns it off
+
+	// Channel-specific overrides, created on first update
+	FacebookConfig  *ChannelConfigUpdateRequest `json:"facebook_config,omitempty"`
+	MessengerConfig *ChannelConfigUpdateRequest `json:"messenger_config,omitempty"`
+}
+
+// ChannelConfigUpdateRequest represents updates to a page's channel configuration
+type ChannelConfigUpdateRequest struct {
+	IsEnabled    *bool   `json:"is_enabled,omitempty"`
+	RAGEnabled   *bool   `json:"rag_enabled,omitempty"`
+	SystemPrompt *string `json:"system_prompt,omitempty"` // Empty string falls back to the page prompt
+}
+
+// applyChannelConfigUpdate applies an update to a channel configuration.
+// A missing configuration starts from the defaults used when a channel is not configured.
+func applyChannelConfigUpdate(config *models.ChannelConfig, req *ChannelConfigUpdateRequest) *models.ChannelConfig {
+	if req == nil {
+		return config
+	}
+	if config == nil {
+		config = &models.ChannelConfig{
+			IsEnabled:  true,
+			RAGEnabled: true,
+		}
+	}
+	if req.IsEnabled != nil {
+		config.IsEnabled = *req.IsEnabled
+	}
+	if req.RAGEnabled != nil {
+		config.RAGEnabled = *req.RAGEnabled
+	}
+	if req.SystemPrompt != nil {
+		config.SystemPrompt = *req.SystemPrompt
+	}
+	return config
 }
 
 // AdminCreateUser handles the creation of a new user with pre-hashed password for admin
@@ -446,6 +525,13 @@ func CreateCompany(c *fiber.Ctx) error {
 		})
 	}
 
+	if req.DefaultLanguage != "" && !models.IsSupportedLanguage(req.DefaultLanguage) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":           "არასწორი ენა",
+			"valid_languages": models.SupportedLanguages(),
+		})
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -572,6 +658,9 @@ func AddPageToCompany(c *fiber.Ctx) error {
 		newPage.VoyageModel = defaultPage.VoyageModel
 		newPage.GPTAPIKey = defaultPage.GPTAPIKey
 		newPage.GPTModel = defaultPage.GPTModel
+		newPage.CohereAPIKey = defaultPage.CohereAPIKey
+		newPage.EmbeddingProvider = defaultPage.EmbeddingProvider
+		newPage.EmbeddingModel = defaultPage.EmbeddingModel
 		newPage.SystemPrompt = defaultPage.SystemPrompt
 		newPage.MaxTokens = defaultPage.MaxTokens
 	}
@@ -636,6 +725,69 @@ func AddPageWithFullDetails(c *fiber.Ctx) error {
 		})
 	}
 
+	if req.Vertical != "" && !models.IsValidVertical(req.Vertical) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":           "არასწორი ვერტიკალი",
+			"valid_verticals": []string{models.VerticalStore, models.VerticalRealEstate},
+		})
+	}
+	if req.GuardrailOnBlock != "" && !models.IsValidGuardrailOnBlock(req.GuardrailOnBlock) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":         "არასწორი მოქმედება",
+			"valid_actions": []string{models.GuardrailOnBlockRegenerate, models.GuardrailOnBlockEscalate},
+		})
+	}
+	if req.KnowledgeLanguage != "" && !models.IsSupportedLanguage(req.KnowledgeLanguage) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":           "არასწორი ენა",
+			"valid_languages": models.SupportedLanguages(),
+		})
+	}
+	if req.EmbeddingProvider != "" && !models.IsValidEmbeddingProvider(req.EmbeddingProvider) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":           "არასწორი ემბედინგის პროვაიდერი",
+			"valid_providers": models.EmbeddingProviders(),
+		})
+	}
+	for _, fallback := range req.FallbackChain {
+		if !models.IsValidFallbackProvider(fallback.Provider) || fallback.Model == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":           "არასწორი სარეზერვო მოდელი",
+				"valid_providers": []string{models.UsageProviderAnthropic, models.UsageProviderOpenAI},
+			})
+		}
+	}
+	if !services.ValidateEscalationRules(req.EscalationRules) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "არასწორი ესკალაციის წესები",
+		})
+	}
+	if !services.ValidateHandBackPolicy(req.HandBackPolicy) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "ბოტზე დაბრუნების არასწორი წესები",
+		})
+	}
+	if !services.ValidateAnswerabilityPolicy(req.AnswerabilityPolicy) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "უპასუხო კითხვების არასწორი წესები",
+		})
+	}
+	if !services.ValidateHybridSearch(req.HybridSearch) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "ჰიბრიდული ძიების არასწორი წონები",
+		})
+	}
+	if !services.ValidateReranker(req.Reranker) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "რერანკერის არასწორი პარამეტრები",
+		})
+	}
+	if !services.ValidateChunking(req.Chunking) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "დაყოფის არასწორი პარამეტრები",
+		})
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -669,9 +821,27 @@ func AddPageWithFullDetails(c *fiber.Ctx) error {
 		VoyageModel:     req.VoyageModel,
 		GPTAPIKey:       req.GPTAPIKey,
 		GPTModel:        req.GPTModel,
+		CohereAPIKey:    req.CohereAPIKey,
 		SystemPrompt:    req.SystemPrompt,
 		IsActive:        req.IsActive,
 		MaxTokens:       req.MaxTokens,
+
+		EmbeddingProvider: req.EmbeddingProvider,
+		EmbeddingModel:    req.EmbeddingModel,
+		HybridSearch:      req.HybridSearch,
+		Reranker:          req.Reranker,
+		Chunking:          req.Chunking,
+
+		LeadCaptureEnabled: req.LeadCaptureEnabled,
+		Vertical:           req.Vertical,
+		LinkAllowlist:      req.LinkAllowlist,
+		GuardrailOnBlock:   req.GuardrailOnBlock,
+		KnowledgeLanguage:  req.KnowledgeLanguage,
+		FallbackChain:      req.FallbackChain,
+		EscalationRules:    req.EscalationRules,
+		HandBackPolicy:     req.HandBackPolicy,
+
+		AnswerabilityPolicy: req.AnswerabilityPolicy,
 	}
 
 	// Set defaults if not provided
@@ -725,6 +895,13 @@ func AddPageWithFullDetails(c *fiber.Ctx) error {
 			"system_prompt":     req.SystemPrompt,
 			"is_active":         req.IsActive,
 			"max_tokens":        newPage.MaxTokens,
+
+			"embedding_provider": newPage.EmbeddingProvider,
+			"embedding_model":    newPage.EmbeddingModel,
+
+			"lead_capture_enabled": newPage.LeadCaptureEnabled,
+			"vertical":             services.PageVertical(&newPage),
+			"knowledge_language":   newPage.KnowledgeLanguage,
 		},
 	})
 }
@@ -762,6 +939,69 @@ func UpdatePageConfiguration(c *fiber.Ctx) error {
 		})
 	}
 
+	if req.Vertical != "" && !models.IsValidVertical(req.Vertical) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":           "არასწორი ვერტიკალი",
+			"valid_verticals": []string{models.VerticalStore, models.VerticalRealEstate},
+		})
+	}
+	if req.GuardrailOnBlock != "" && !models.IsValidGuardrailOnBlock(req.GuardrailOnBlock) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":         "არასწორი მოქმედება",
+			"valid_actions": []string{models.GuardrailOnBlockRegenerate, models.GuardrailOnBlockEscalate},
+		})
+	}
+	if req.KnowledgeLanguage != "" && !models.IsSupportedLanguage(req.KnowledgeLanguage) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":           "არასწორი ენა",
+			"valid_languages": models.SupportedLanguages(),
+		})
+	}
+	if req.EmbeddingProvider != "" && !models.IsValidEmbeddingProvider(req.EmbeddingProvider) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":           "არასწორი ემბედინგის პროვაიდერი",
+			"valid_providers": models.EmbeddingProviders(),
+		})
+	}
+	for _, fallback := range req.FallbackChain {
+		if !models.IsValidFallbackProvider(fallback.Provider) || fallback.Model == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":           "არასწორი სარეზერვო მოდელი",
+				"valid_providers": []string{models.UsageProviderAnthropic, models.UsageProviderOpenAI},
+			})
+		}
+	}
+	if !services.ValidateEscalationRules(req.EscalationRules) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "არასწორი ესკალაციის წესები",
+		})
+	}
+	if !services.ValidateHandBackPolicy(req.HandBackPolicy) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "ბოტზე დაბრუნების არასწორი წესები",
+		})
+	}
+	if !services.ValidateAnswerabilityPolicy(req.AnswerabilityPolicy) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "უპასუხო კითხვების არასწორი წესები",
+		})
+	}
+	if !services.ValidateHybridSearch(req.HybridSearch) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "ჰიბრიდული ძიების არასწორი წონები",
+		})
+	}
+	if !services.ValidateReranker(req.Reranker) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "რერანკერის არასწორი პარამეტრები",
+		})
+	}
+	if !services.ValidateChunking(req.Chunking) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "დაყოფის არასწორი პარამეტრები",
+		})
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -809,6 +1049,24 @@ func UpdatePageConfiguration(c *fiber.Ctx) error {
 			if req.GPTModel != "" {
 				page.GPTModel = req.GPTModel
 			}
+			if req.CohereAPIKey != "" {
+				page.CohereAPIKey = req.CohereAPIKey
+			}
+			if req.EmbeddingProvider != "" {
+				page.EmbeddingProvider = req.EmbeddingProvider
+			}
+			if req.EmbeddingModel != "" {
+				page.EmbeddingModel = req.EmbeddingModel
+			}
+			if req.HybridSearch != nil {
+				page.HybridSearch = req.HybridSearch
+			}
+			if req.Reranker != nil {
+				page.Reranker = req.Reranker
+			}
+			if req.Chunking != nil {
+				page.Chunking = req.Chunking
+			}
 			if req.SystemPrompt != "" {
 				page.SystemPrompt = req.SystemPrompt
 			}
@@ -818,6 +1076,35 @@ func UpdatePageConfiguration(c *fiber.Ctx) error {
 			if req.MaxTokens != nil {
 				page.MaxTokens = *req.MaxTokens
 			}
+			if req.LeadCaptureEnabled != nil {
+				page.LeadCaptureEnabled = *req.LeadCaptureEnabled
+			}
+			if req.Vertical != "" {
+				page.Vertical = req.Vertical
+			}
+			if req.LinkAllowlist != nil {
+				page.LinkAllowlist = req.LinkAllowlist
+			}
+			if req.GuardrailOnBlock != "" {
+				page.GuardrailOnBlock = req.GuardrailOnBlock
+			}
+			if req.KnowledgeLanguage != "" {
+				page.KnowledgeLanguage = req.KnowledgeLanguage
+			}
+			if req.FallbackChain != nil {
+				page.FallbackChain = req.FallbackChain
+			}
+			if req.EscalationRules != nil {
+				page.EscalationRules = req.EscalationRules
+			}
+			if req.HandBackPolicy != nil {
+				page.HandBackPolicy = req.HandBackPolicy
+			}
+			if req.AnswerabilityPolicy != nil {
+				page.AnswerabilityPolicy = req.AnswerabilityPolicy
+			}
+			page.FacebookConfig = applyChannelConfigUpdate(page.FacebookConfig, req.FacebookConfig)
+			page.MessengerConfig = applyChannelConfigUpdate(page.MessengerConfig, req.MessengerConfig)
 		}
 		updatedPages[i] = page
 	}
@@ -894,10 +1181,28 @@ func GetCompany(c *fiber.Ctx) error {
 			"voyage_model":      page.VoyageModel,
 			"gpt_api_key":       "***HIDDEN***",
 			"gpt_model":         page.GPTModel,
+			"cohere_api_key":    "***HIDDEN***",
 			"system_prompt":     page.SystemPrompt,
 			"is_active":         page.IsActive,
 			"max_tokens":        page.MaxTokens,
 			"crm_links":         page.CRMLinks,
+
+			"lead_capture_enabled": page.LeadCaptureEnabled,
+			"vertical":             services.PageVertical(&page),
+			"link_allowlist":       page.LinkAllowlist,
+			"guardrail_on_block":   page.GuardrailOnBlock,
+			"knowledge_language":   page.KnowledgeLanguage,
+			"embedding_provider":   page.EmbeddingProvider,
+			"embedding_model":      page.EmbeddingModel,
+			"hybrid_search":        page.HybridSearch,
+			"reranker":             page.Reranker,
+			"chunking":             page.Chunking,
+			"fallback_chain":       page.FallbackChain,
+			"escalation_rules":     page.EscalationRules,
+			"hand_back_policy":     page.HandBackPolicy,
+			"answerability_policy": page.AnswerabilityPolicy,
+			"facebook_config":      page.FacebookConfig,
+			"messenger_config":     page.MessengerConfig,
 		})
 	}
 
@@ -910,13 +1215,191 @@ func GetCompany(c *fiber.Ctx) error {
 		"is_active":        company.IsActive,
 		"response_delay":   company.ResponseDelay,
 		"default_language": company.DefaultLanguage,
+		"system_prompt":    company.SystemPrompt,
 		"created_at":       company.CreatedAt,
 		"updated_at":       company.UpdatedAt,
+
+		"monthly_budget":          company.MonthlyBudget,
+		"budget_exceeded_action":  services.GetBudgetExceededAction(company),
+		"budget_fallback_message": company.BudgetFallbackMessage,
 	}
 
 	return c.JSON(response)
 }
 
+// UpdateCompanyBudget updates the company's monthly usage budget and what happens when it is exceeded
+func UpdateCompanyBudget(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	var req struct {
+		MonthlyBudget         *float64 `json:"monthly_budget,omitempty"` // USD, 0 disables the budget
+		BudgetExceededAction  string   `json:"budget_exceeded_action,omitempty"`
+		BudgetFallbackMessage *string  `json:"budget_fallback_message,omitempty"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "არასწორი მოთხოვნის ტექსტი",
+			"details": err.Error(),
+		})
+	}
+
+	setFields := bson.M{
+		"updated_at": time.Now(),
+	}
+
+	if req.MonthlyBudget != nil {
+		if *req.MonthlyBudget < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "ბიუჯეტი არ შეიძლება იყოს უარყოფითი",
+			})
+		}
+		setFields["monthly_budget"] = *req.MonthlyBudget
+	}
+	if req.BudgetExceededAction != "" {
+		if !models.IsValidBudgetAction(req.BudgetExceededAction) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "არასწორი მოქმედება",
+				"valid_actions": []string{
+					models.BudgetActionFallbackReply,
+					models.BudgetActionHumanOnly,
+				},
+			})
+		}
+		setFields["budget_exceeded_action"] = req.BudgetExceededAction
+	}
+	if req.BudgetFallbackMessage != nil {
+		setFields["budget_fallback_message"] = *req.BudgetFallbackMessage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := services.UpdateCompany(ctx, companyID.(string), bson.M{"$set": setFields}); err != nil {
+		slog.Error("Failed to update company budget", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "ბიუჯეტის განახლება ვერ მოხერხდა",
+			"details": err.Error(),
+		})
+	}
+
+	slog.Info("Company budget updated",
+		"companyID", companyID.(string),
+		"fields", len(setFields)-1)
+
+	return c.JSON(fiber.Map{
+		"message": "ბიუჯეტი წარმატებით განახლდა",
+	})
+}
+
+// UpdateCompanySettings updates company-wide defaults used by pages that don't override them
+func UpdateCompanySettings(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	var req struct {
+		SystemPrompt    *string `json:"system_prompt,omitempty"`
+		DefaultLanguage *string `json:"default_language,omitempty"`
+		ResponseDelay   *int    `json:"response_delay,omitempty"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "არასწორი მოთხოვნის ტექსტი",
+			"details": err.Error(),
+		})
+	}
+
+	setFields := bson.M{
+		"updated_at": time.Now(),
+	}
+	if req.SystemPrompt != nil {
+		setFields["system_prompt"] = *req.SystemPrompt
+	}
+	if req.DefaultLanguage != nil {
+		if *req.DefaultLanguage != "" && !models.IsSupportedLanguage(*req.DefaultLanguage) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":           "არასწორი ენა",
+				"valid_languages": models.SupportedLanguages(),
+			})
+		}
+		setFields["default_language"] = *req.DefaultLanguage
+	}
+	if req.ResponseDelay != nil {
+		if *req.ResponseDelay < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "პასუხის დაყოვნება არ შეიძლება იყოს უარყოფითი",
+			})
+		}
+		setFields["response_delay"] = *req.ResponseDelay
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := services.UpdateCompany(ctx, companyID.(string), bson.M{"$set": setFields}); err != nil {
+		slog.Error("Failed to update company settings", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "კომპანიის პარამეტრების განახლება ვერ მოხერხდა",
+			"details": err.Error(),
+		})
+	}
+
+	slog.Info("Company settings updated",
+		"companyID", companyID.(string),
+		"fields", len(setFields)-1)
+
+	return c.JSON(fiber.Map{
+		"message": "კომპანიის პარამეტრები წარმატებით განახლდა",
+	})
+}
+
+// GetEffectivePageConfig returns the configuration the bot actually uses for each channel of a page
+func GetEffectivePageConfig(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	pageID := c.Params("pageID")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	company, err := services.GetCompanyByID(ctx, companyID.(string))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "კომპანია ვერ მოიძებნა",
+			"details": err.Error(),
+		})
+	}
+
+	pageConfig := findCompanyPage(company, pageID)
+	if pageConfig == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "გვერდი კომპანიაში ვერ მოიძებნა",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"page_id":   pageConfig.PageID,
+		"page_name": pageConfig.PageName,
+		"channels": fiber.Map{
+			"facebook":  services.ResolveChannelConfig(company, pageConfig, "facebook"),
+			"messenger": services.ResolveChannelConfig(company, pageConfig, "messenger"),
+		},
+	})
+}
+
 // TestWebhookConnection tests the webhook connection for a specific page
 func TestWebhookConnection(c *fiber.Ctx) error {
 	var req struct {
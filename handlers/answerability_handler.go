@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"facebook-bot/models"
+	"facebook-bot/services"
+)
+
+// checkAnswerability applies the page's answerability policy to a generated reply and logs questions
+// the knowledge base could not answer. Returns the reply to send, or escalate=true when the
+// conversation should go to a human instead.
+func checkAnswerability(company *models.Company, pageConfig *models.FacebookPage, channel, customerID, question, language, reply string, trace *services.ReplyTrace, confidence *models.RetrievalConfidence) (string, bool) {
+	reason, action := services.CheckAnswerability(pageConfig, trace.Answerability, confidence)
+	if reason == "" {
+		return reply, false
+	}
+
+	services.RecordUnansweredQuestion(models.UnansweredQuestion{
+		CompanyID:     company.CompanyID,
+		PageID:        pageConfig.PageID,
+		CustomerID:    customerID,
+		Channel:       channel,
+		Question:      question,
+		Language:      language,
+		Answerability: trace.Answerability,
+		Reason:        reason,
+		Action:        action,
+		Retrieval:     *confidence,
+		Reply:         services.MaskSecrets(reply, pageConfig),
+	})
+
+	return services.ApplyAnswerabilityAction(reason, action, reply, language)
+}
+
+// GetUnansweredQuestions returns the company's log of questions the knowledge base could not answer
+func GetUnansweredQuestions(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Company ID not found in session",
+		})
+	}
+
+	pageID := c.Query("page_id")
+	reason := c.Query("reason")
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 50)
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 50
+	}
+	if limit > 200 {
+		limit = 200
+	}
+	skip := (page - 1) * limit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if pageID != "" {
+		if _, err := services.ValidatePageOwnership(ctx, pageID, companyID.(string)); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Page not found or access denied",
+			})
+		}
+	}
+
+	questions, totalCount, err := services.GetUnansweredQuestions(ctx, companyID.(string), pageID, reason, limit, skip)
+	if err != nil {
+		slog.Error("Failed to get unanswered questions", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve unanswered questions",
+		})
+	}
+
+	totalPages := (int(totalCount) + limit - 1) / limit
+	hasMore := page < totalPages
+
+	return c.JSON(fiber.Map{
+		"questions": questions,
+		"pagination": fiber.Map{
+			"page":        page,
+			"limit":       limit,
+			"total":       totalCount,
+			"total_pages": totalPages,
+			"has_more":    hasMore,
+		},
+	})
+}
+
+// GetKnowledgeGaps returns the unanswered questions customers asked most often
+func GetKnowledgeGaps(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Company ID not found in session",
+		})
+	}
+
+	from, to, errMsg := usageDateRange(c)
+	if errMsg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errMsg,
+		})
+	}
+
+	pageID := c.Query("page_id")
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 {
+		limit = 50
+	}
+	if limit > 200 {
+		limit = 200
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if pageID != "" {
+		if _, err := services.ValidatePageOwnership(ctx, pageID, companyID.(string)); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Page not found or access denied",
+			})
+		}
+	}
+
+	gaps, err := services.GetKnowledgeGaps(ctx, companyID.(string), pageID, from, to, limit)
+	if err != nil {
+		slog.Error("Failed to get knowledge gaps", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve knowledge gaps",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"from":    from.Format("2006-01-02"),
+		"to":      to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"page_id": pageID,
+		"gaps":    gaps,
+	})
+}
@@ -89,12 +89,26 @@ func HandleComment(change ChangeValue, pageID string) {
 		return
 	}
 
-	// Check if Facebook comments are enabled for this page
-	if pageConfig.FacebookConfig != nil && !pageConfig.FacebookConfig.IsEnabled {
+	// Resolve the effective channel configuration (channel overrides page overrides company)
+	channelConfig := services.ResolveChannelConfig(company, pageConfig, "facebook")
+	if !channelConfig.IsEnabled {
 		slog.Info("Facebook comments are disabled for this page, skipping bot response",
-			"pageID", pageID)
+			"pageID", pageID,
+			"source", channelConfig.EnabledSource)
 		return
 	}
+	pageConfig = services.ApplyChannelConfig(pageConfig, channelConfig)
+
+	// Bill all model calls made while handling this comment to the commenter
+	ctx = services.WithUsageScope(ctx, services.UsageScope{
+		CompanyID:  company.CompanyID,
+		PageID:     pageID,
+		CustomerID: senderID,
+	})
+
+	// Detect the commenter's language, falling back to the company default for short or ambiguous comments
+	language := services.ResolveLanguage(message, channelConfig.DefaultLanguage)
+	ctx = services.WithCustomerLanguage(ctx, language.Language)
 
 	// Additional check: if sender name matches page name, it's likely the bot
 	if senderName == pageConfig.PageName {
@@ -134,6 +148,8 @@ func HandleComment(change ChangeValue, pageID string) {
 		"pageName", pageConfig.PageName,
 		"companyID", company.CompanyID,
 		"message", message,
+		"language", language.Language,
+		"languageSource", language.Source,
 	)
 
 	// Fetch user details (first name and last name) from Facebook synchronously
@@ -193,11 +209,11 @@ func HandleComment(change ChangeValue, pageID string) {
 		return
 	}
 
-	// Save the user's comment with first and last name
-	err = services.SaveCommentWithNames(
+	// Save the user's comment with first and last name and detected language
+	err = services.SaveCommentWithLanguage(
 		ctx, commentID, postID, parentID, postContent,
 		senderID, senderName, firstName, lastName, pageID, pageConfig.PageName,
-		message, false, // isBot = false for user comments
+		message, language.Language, false, // isBot = false for user comments
 	)
 
 	if err != nil {
@@ -205,6 +221,29 @@ func HandleComment(change ChangeValue, pageID string) {
 		return
 	}
 
+	// Skip model calls when the company has used up its monthly budget
+	if services.IsBudgetExceeded(ctx, company) {
+		if services.GetBudgetExceededAction(company) == models.BudgetActionHumanOnly {
+			slog.Info("Budget exceeded, leaving comment for a human",
+				"commentID", commentID,
+				"pageID", pageID)
+			return
+		}
+
+		reply := services.GetBudgetFallbackMessage(company, language.Language)
+		responseData, err := services.ReplyToCommentWithResponse(ctx, commentID, reply, pageConfig.PageAccessToken)
+		if err != nil {
+			slog.Error("Failed to send budget fallback reply to comment", "error", err)
+			return
+		}
+		if responseData != nil && responseData.ID != "" {
+			if err := services.SaveBotReply(ctx, responseData.ID, commentID, postID, reply, pageID, pageConfig.PageName); err != nil {
+				slog.Error("Failed to save bot reply", "error", err)
+			}
+		}
+		return
+	}
+
 	// If this is a reply, fetch the parent comment for additional context
 	var parentCommentText string
 	if isReply {
@@ -236,24 +275,42 @@ func HandleComment(change ChangeValue, pageID string) {
 
 	// Check vector database for available RAG documents and retrieve context if found
 	var ragContext string
-
-	// Try to get relevant context from vector database
-	ragContext, err = services.GetRAGContextForChannel(ctx, message, company.CompanyID, pageID, "facebook")
-	if err != nil {
-		slog.Warn("Failed to fetch RAG context from vector DB", "error", err)
-		// Continue without RAG context
-	} else if ragContext != "" {
-		slog.Info("RAG context retrieved from vector DB",
-			"contextLength", len(ragContext),
-			"companyID", company.CompanyID,
-			"pageID", pageID,
-			"channel", "facebook",
-		)
+	var retrieval *models.RetrievalConfidence
+
+	// Try to get relevant context from vector database unless retrieval is switched off for the channel
+	if channelConfig.RAGEnabled {
+		// Search in the knowledge base language when the commenter writes in another one
+		ragQuery := services.TranslateQueryForKnowledge(ctx, message, language.Language, company, pageConfig)
+		var confidence models.RetrievalConfidence
+		ragContext, confidence, err = services.GetRAGContextWithConfidence(ctx, ragQuery, company.CompanyID, pageID, "facebook")
+		if err != nil {
+			slog.Warn("Failed to fetch RAG context from vector DB", "error", err)
+			// Continue without RAG context
+		} else {
+			// Tell the model how well the knowledge base matched so it does not invent answers
+			retrieval = &confidence
+			ctx = services.WithRetrievalConfidence(ctx, confidence)
+
+			if ragContext != "" {
+				slog.Info("RAG context retrieved from vector DB",
+					"contextLength", len(ragContext),
+					"companyID", company.CompanyID,
+					"pageID", pageID,
+					"channel", "facebook",
+				)
+			} else {
+				slog.Debug("No relevant RAG documents found in vector DB",
+					"query", message,
+					"pageID", pageID,
+					"channel", "facebook",
+				)
+			}
+		}
 	} else {
-		slog.Debug("No relevant RAG documents found in vector DB",
-			"query", message,
+		slog.Debug("RAG disabled for channel, skipping retrieval",
 			"pageID", pageID,
 			"channel", "facebook",
+			"source", channelConfig.RAGSource,
 		)
 	}
 
@@ -272,14 +329,31 @@ func HandleComment(change ChangeValue, pageID string) {
 		messageType = "reply"
 	}
 
+	ctx, trace := services.WithReplyTrace(ctx)
 	aiResponse, _, err := services.GetClaudeResponseWithToolUse(ctx, contextStr, messageType, company, pageConfig, commentHistory, ragContext)
 	if err != nil {
 		slog.Error("Failed to get Claude response", "error", err)
 		if isReply {
-			aiResponse = "Thank you for your reply!"
+			aiResponse = services.LocalizedMessage(services.MessageKeyReplyThanks, language.Language)
 		} else {
-			aiResponse = "Thank you for your comment!"
+			aiResponse = services.LocalizedMessage(services.MessageKeyCommentThanks, language.Language)
 		}
+
+		// Every model in the fallback chain failed, flag the comment for a human to follow up
+		services.GetWebSocketManager().BroadcastToCompany(company.CompanyID, services.BroadcastMessage{
+			CompanyID: company.CompanyID,
+			PageID:    pageID,
+			Type:      "comment_needs_agent",
+			Data: map[string]interface{}{
+				"comment_id":    commentID,
+				"post_id":       postID,
+				"sender_id":     senderID,
+				"customer_name": senderName,
+				"message":       message,
+				"reason":        "model_unavailable",
+				"timestamp":     time.Now().Unix(),
+			},
+		})
 	}
 
 	// For comments, we don't do agent handoff - remove any CUSTOMER_WANTS_REAL_PERSON marker
@@ -294,6 +368,53 @@ func HandleComment(change ChangeValue, pageID string) {
 			"pageID", pageID)
 	}
 
+	// Leave questions the knowledge base cannot answer to a human when the page asks for it
+	if err == nil {
+		var escalate bool
+		aiResponse, escalate = checkAnswerability(company, pageConfig, "facebook", senderID, message, language.Language, aiResponse, trace, retrieval)
+		if escalate {
+			services.GetWebSocketManager().BroadcastToCompany(company.CompanyID, services.BroadcastMessage{
+				CompanyID: company.CompanyID,
+				PageID:    pageID,
+				Type:      "comment_needs_agent",
+				Data: map[string]interface{}{
+					"comment_id":    commentID,
+					"post_id":       postID,
+					"sender_id":     senderID,
+					"customer_name": senderName,
+					"message":       message,
+					"reason":        models.EscalationReasonUnanswerable,
+					"timestamp":     time.Now().Unix(),
+				},
+			})
+			return
+		}
+	}
+
+	// Check the reply against the output guardrails before it is posted publicly
+	aiResponse, escalate := guardReply(ctx, company, pageConfig, "facebook", senderID, aiResponse, ragContext, trace, func(feedback string) (string, error) {
+		reply, _, err := services.GetClaudeResponseWithToolUse(ctx, contextStr+"\n\n"+feedback, messageType, company, pageConfig, commentHistory, ragContext)
+		return reply, err
+	})
+	if escalate {
+		// Leave the comment for a human instead of posting a reply that failed the guardrails
+		services.GetWebSocketManager().BroadcastToCompany(company.CompanyID, services.BroadcastMessage{
+			CompanyID: company.CompanyID,
+			PageID:    pageID,
+			Type:      "comment_needs_agent",
+			Data: map[string]interface{}{
+				"comment_id":    commentID,
+				"post_id":       postID,
+				"sender_id":     senderID,
+				"customer_name": senderName,
+				"message":       message,
+				"reason":        "guardrail_blocked",
+				"timestamp":     time.Now().Unix(),
+			},
+		})
+		return
+	}
+
 	// Response delay removed for faster processing
 	// Reply to the comment on Facebook immediately
 	responseData, err := services.ReplyToCommentWithResponse(ctx, commentID, aiResponse, pageConfig.PageAccessToken)
@@ -327,6 +448,11 @@ func HandleComment(change ChangeValue, pageID string) {
 		Original:   message,
 		Response:   aiResponse,
 		Timestamp:  time.Now(),
+
+		PromptVersion: trace.PromptVersion,
+		CompanyID:     company.CompanyID,
+		Tier:          trace.Tier,
+		Model:         trace.Model,
 	}
 
 	if err := services.SaveResponse(ctx, responseDoc); err != nil {
@@ -359,8 +485,8 @@ func processPostContentAsRAG(companyID, pageID, postID, content string) {
 		"contentLength", len(content),
 	)
 
-	// Split content into chunks using the same algorithm as document uploads
-	chunks := splitPostIntoChunks(content, 2000) // 2000 chars per chunk
+	// Split content into chunks the same way as document uploads
+	chunks := services.ChunkDocument(ctx, companyID, pageID, "", content)
 
 	// Metadata for the post
 	metadata := map[string]string{
@@ -377,13 +503,7 @@ func processPostContentAsRAG(companyID, pageID, postID, content string) {
 
 	for i, chunk := range chunks {
 		// Add chunk info to metadata
-		chunkMetadata := make(map[string]string)
-		for k, v := range metadata {
-			chunkMetadata[k] = v
-		}
-		if len(chunks) > 1 {
-			chunkMetadata["chunk"] = fmt.Sprintf("%d/%d", i+1, len(chunks))
-		}
+		chunkMetadata := services.ChunkMetadata(metadata, chunk)
 
 		// Store embedding for this chunk with channels
 		err := services.StoreEmbeddingsWithChannelsAndOptions(
@@ -391,7 +511,7 @@ func processPostContentAsRAG(companyID, pageID, postID, content string) {
 			companyID,
 			pageID,
 			channels,
-			chunk,
+			chunk.Text,
 			"facebook_post",
 			chunkMetadata,
 			"",   // No CRM URL for posts
@@ -437,38 +557,3 @@ func processPostContentAsRAG(companyID, pageID, postID, content string) {
 		)
 	}
 }
-
-// splitPostIntoChunks splits post content into chunks (same algorithm as document uploads)
-func splitPostIntoChunks(text string, chunkSize int) []string {
-	if len(text) <= chunkSize {
-		return []string{text}
-	}
-
-	var chunks []string
-	words := strings.Fields(text)
-
-	var currentChunk strings.Builder
-	for _, word := range words {
-		// Check if adding this word would exceed chunk size
-		if currentChunk.Len()+len(word)+1 > chunkSize {
-			// Save current chunk if it has content
-			if currentChunk.Len() > 0 {
-				chunks = append(chunks, currentChunk.String())
-				currentChunk.Reset()
-			}
-		}
-
-		// Add word to current chunk
-		if currentChunk.Len() > 0 {
-			currentChunk.WriteString(" ")
-		}
-		currentChunk.WriteString(word)
-	}
-
-	// Add the last chunk if it has content
-	if currentChunk.Len() > 0 {
-		chunks = append(chunks, currentChunk.String())
-	}
-
-	return chunks
-}
@@ -239,6 +239,14 @@ func GetCustomerStats(c *fiber.Ctx) error {
 		stats["stopped_customers"] = stoppedCustomers
 	}
 
+	// Add the customers' latest sentiment and who is most upset
+	sentimentStats, err := services.GetSentimentStats(ctx, companyID.(string), pageID)
+	if err != nil {
+		slog.Warn("Failed to get sentiment stats", "error", err)
+	} else {
+		stats["sentiment"] = sentimentStats
+	}
+
 	return c.JSON(stats)
 }
 
@@ -450,8 +458,9 @@ func SendMessageToCustomer(c *fiber.Ctx) error {
 
 	// Parse request body
 	var reqBody struct {
-		PageID  string `json:"page_id"`
-		Message string `json:"message"`
+		PageID       string `json:"page_id"`
+		Message      string `json:"message"`
+		SuggestionID string `json:"suggestion_id,omitempty"` // Reply suggestion the message started from
 	}
 
 	if err := c.BodyParser(&reqBody); err != nil {
@@ -575,6 +584,14 @@ func SendMessageToCustomer(c *fiber.Ctx) error {
 		Timestamp:   time.Now(),
 	}
 
+	recordAgentActivity(ctx, customerID, reqBody.PageID)
+
+	// Track whether the agent sent one of the drafted replies
+	suggestion := resolveReplySuggestions(ctx, companyID.(string), reqBody.PageID, customerID, reqBody.SuggestionID, reqBody.Message)
+	if suggestion != nil {
+		messageDoc.SuggestionID = suggestion.ID.Hex()
+	}
+
 	if err := services.SaveMessage(ctx, messageDoc); err != nil {
 		slog.Error("Failed to save dashboard message", "error", err)
 		// Don't return error since message was sent successfully
@@ -606,15 +623,21 @@ func SendMessageToCustomer(c *fiber.Ctx) error {
 		"agentEmail", agentEmail,
 		"companyID", companyID)
 
+	data := fiber.Map{
+		"customer_id": customerID,
+		"page_id":     reqBody.PageID,
+		"message":     reqBody.Message,
+		"agent":       agentEmail,
+		"timestamp":   time.Now().Unix(),
+	}
+	if suggestion != nil {
+		data["suggestion_id"] = suggestion.ID.Hex()
+		data["suggestion_status"] = suggestion.Status
+	}
+
 	return c.JSON(fiber.Map{
 		"message": "Message sent successfully",
-		"data": fiber.Map{
-			"customer_id": customerID,
-			"page_id":     reqBody.PageID,
-			"message":     reqBody.Message,
-			"agent":       agentEmail,
-			"timestamp":   time.Now().Unix(),
-		},
+		"data":    data,
 	})
 }
 
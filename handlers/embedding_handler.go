@@ -106,39 +106,31 @@ func TestVoyageEmbedding(c *fiber.Ctx) error {
 	}
 
 	// Get first page for embedding configuration
-	var embeddingModel string
-	var embeddingProvider string
-	if len(company.Pages) > 0 {
-		if company.Pages[0].GPTAPIKey != "" {
-			embeddingProvider = "OpenAI GPT"
-			embeddingModel = company.Pages[0].GPTModel
-			if embeddingModel == "" {
-				embeddingModel = "text-embedding-3-large"
-			}
-		} else if company.Pages[0].VoyageAPIKey != "" {
-			embeddingProvider = "Voyage AI"
-			embeddingModel = company.Pages[0].VoyageModel
-			if embeddingModel == "" {
-				embeddingModel = "voyage-2"
-			}
-		} else {
-			embeddingProvider = "Mock"
-			embeddingModel = "mock-embeddings"
-		}
+	if len(company.Pages) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "No pages configured for this company",
+		})
+	}
+	embedder, err := services.PageEmbedder(&company.Pages[0])
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Embedding provider not configured: " + err.Error(),
+		})
 	}
 
-	// Generate embedding (use empty pageID to get default page)
-	embedding, err := services.GetEmbeddings(ctx, req.Text, companyID, "")
+	ctx = services.WithUsageScope(ctx, services.UsageScope{CompanyID: companyID, PageID: company.Pages[0].PageID})
+	embeddings, err := embedder.Embed(ctx, []string{req.Text}, services.EmbeddingInputDocument)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate embedding: " + err.Error(),
 		})
 	}
+	embedding := embeddings[0]
 
 	return c.JSON(fiber.Map{
 		"message":        "Embedding generated successfully",
-		"provider":       embeddingProvider,
-		"model":          embeddingModel,
+		"provider":       embedder.Provider(),
+		"model":          embedder.Model(),
 		"text":           req.Text,
 		"embedding_size": len(embedding),
 		"sample":         embedding[:10], // Show first 10 values as sample
@@ -149,26 +141,3 @@ func TestVoyageEmbedding(c *fiber.Ctx) error {
 func TestEmbedding(c *fiber.Ctx) error {
 	return TestVoyageEmbedding(c)
 }
-
-// ReindexDocuments reindexes all documents with new embeddings
-func ReindexDocuments(c *fiber.Ctx) error {
-	companyID := c.Params("companyID")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
-
-	// Get company configuration
-	_, err := services.GetCompanyByID(ctx, companyID)
-	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Company not found",
-		})
-	}
-
-	// Note: Reindexing logic has been removed as CRM processing is no longer supported
-
-	return c.JSON(fiber.Map{
-		"message":    "Reindexing not available - CRM processing has been removed",
-		"company_id": companyID,
-	})
-}
@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"facebook-bot/models"
+	"facebook-bot/services"
+)
+
+// evalRunTimeout bounds a run started from the admin API, every case is a model call
+const evalRunTimeout = 30 * time.Minute
+
+// EvalSetRequest represents an evaluation set to create or replace
+type EvalSetRequest struct {
+	PageID      string            `json:"page_id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Channel     string            `json:"channel,omitempty"` // messenger (default) or facebook
+	Cases       []models.EvalCase `json:"cases"`
+}
+
+// EvalRunRequest represents the configuration to run an evaluation set with
+type EvalRunRequest struct {
+	Label string `json:"label,omitempty"`
+	models.EvalOverrides
+}
+
+// GetEvalSets lists the company's evaluation sets
+func GetEvalSets(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sets, err := services.GetEvalSets(ctx, companyID.(string), c.Query("page_id"))
+	if err != nil {
+		slog.Error("Failed to get evaluation sets", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "შეფასების ნაკრებების მიღება ვერ მოხერხდა",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"sets":  sets,
+		"count": len(sets),
+	})
+}
+
+// GetEvalSet returns one evaluation set with its cases
+func GetEvalSet(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	set, ok, err := loadEvalSet(ctx, c, companyID.(string))
+	if !ok {
+		return err
+	}
+	return c.JSON(set)
+}
+
+// CreateEvalSet saves a new evaluation set for a company page
+func CreateEvalSet(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	var req EvalSetRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "არასწორი მოთხოვნის ტექსტი",
+			"details": err.Error(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	set := &models.EvalSet{
+		CompanyID:   companyID.(string),
+		PageID:      req.PageID,
+		Name:        req.Name,
+		Description: req.Description,
+		Channel:     req.Channel,
+		Cases:       req.Cases,
+	}
+	if username, ok := c.Locals("username").(string); ok {
+		set.CreatedBy = username
+	}
+
+	if ok, err := validateEvalSet(ctx, c, set); !ok {
+		return err
+	}
+
+	if err := services.CreateEvalSet(ctx, set); err != nil {
+		slog.Error("Failed to create evaluation set", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "შეფასების ნაკრების შენახვა ვერ მოხერხდა",
+		})
+	}
+
+	slog.Info("Evaluation set created",
+		"setID", set.ID.Hex(),
+		"pageID", set.PageID,
+		"cases", len(set.Cases))
+
+	return c.Status(fiber.StatusCreated).JSON(set)
+}
+
+// UpdateEvalSet replaces the name, description, channel and cases of an evaluation set.
+// Results of earlier runs stay comparable for cases that keep their ID.
+func UpdateEvalSet(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	var req EvalSetRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "არასწორი მოთხოვნის ტექსტი",
+			"details": err.Error(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	set, ok, err := loadEvalSet(ctx, c, companyID.(string))
+	if !ok {
+		return err
+	}
+
+	// The page of a set does not change, its runs would no longer be comparable
+	set.Name = req.Name
+	set.Description = req.Description
+	set.Channel = req.Channel
+	set.Cases = req.Cases
+	if ok, err := validateEvalSet(ctx, c, set); !ok {
+		return err
+	}
+
+	if err := services.UpdateEvalSet(ctx, set); err != nil {
+		slog.Error("Failed to update evaluation set", "setID", set.ID.Hex(), "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "შეფასების ნაკრების განახლება ვერ მოხერხდა",
+		})
+	}
+
+	return c.JSON(set)
+}
+
+// DeleteEvalSet deletes an evaluation set, its runs are kept
+func DeleteEvalSet(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	deleted, err := services.DeleteEvalSet(ctx, c.Params("setID"), companyID.(string))
+	if err != nil {
+		slog.Error("Failed to delete evaluation set", "setID", c.Params("setID"), "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "შეფასების ნაკრების წაშლა ვერ მოხერხდა",
+		})
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "შეფასების ნაკრები ვერ მოიძებნა",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "შეფასების ნაკრები წაიშალა",
+	})
+}
+
+// StartEvalRun runs an evaluation set in the background with optional overrides of the page
+// configuration. Returns the run right away, its results fill in as cases finish.
+func StartEvalRun(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	var req EvalRunRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "არასწორი მოთხოვნის ტექსტი",
+				"details": err.Error(),
+			})
+		}
+	}
+	if req.MaxTokens < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "max_tokens არ შეიძლება იყოს უარყოფითი",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	set, ok, err := loadEvalSet(ctx, c, companyID.(string))
+	if !ok {
+		return err
+	}
+
+	startedBy, _ := c.Locals("username").(string)
+	run, err := services.StartEvalRun(ctx, set, req.Label, req.EvalOverrides, startedBy)
+	switch {
+	case errors.Is(err, services.ErrEvalPageNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "გვერდი კომპანიაში ვერ მოიძებნა ან არააქტიურია",
+		})
+	case errors.Is(err, services.ErrEvalPromptNotFound):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "პრომპტის შაბლონი ვერ მოიძებნა ან არ ეკუთვნის ამ გვერდს",
+		})
+	case errors.Is(err, services.ErrEvalBudgetExceeded):
+		return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+			"error": "თვიური ბიუჯეტი ამოწურულია",
+		})
+	case err != nil:
+		slog.Error("Failed to start evaluation run", "setID", set.ID.Hex(), "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "შეფასების გაშვება ვერ მოხერხდა",
+		})
+	}
+
+	go func() {
+		runCtx, cancel := context.WithTimeout(context.Background(), evalRunTimeout)
+		defer cancel()
+
+		if err := services.ExecuteEvalRun(runCtx, set, run); err != nil {
+			slog.Error("Evaluation run failed", "runID", run.ID.Hex(), "error", err)
+		}
+	}()
+
+	return c.Status(fiber.StatusAccepted).JSON(run)
+}
+
+// GetEvalRuns lists the company's evaluation runs without their per-case results
+func GetEvalRuns(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 {
+		limit = 50
+	}
+	if limit > 200 {
+		limit = 200
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	runs, err := services.GetEvalRuns(ctx, companyID.(string), c.Query("set_id"), c.Query("page_id"), limit)
+	if err != nil {
+		slog.Error("Failed to get evaluation runs", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "შეფასებების მიღება ვერ მოხერხდა",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"runs":  runs,
+		"count": len(runs),
+	})
+}
+
+// GetEvalRun returns one evaluation run with its per-case results
+func GetEvalRun(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	run, ok, err := loadEvalRun(ctx, c, c.Params("runID"), companyID.(string))
+	if !ok {
+		return err
+	}
+	return c.JSON(run)
+}
+
+// CompareEvalRuns puts two runs of the same evaluation set side by side
+func CompareEvalRuns(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	if c.Query("base") == "" || c.Query("candidate") == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "base და candidate პარამეტრები აუცილებელია",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	base, ok, err := loadEvalRun(ctx, c, c.Query("base"), companyID.(string))
+	if !ok {
+		return err
+	}
+	candidate, ok, err := loadEvalRun(ctx, c, c.Query("candidate"), companyID.(string))
+	if !ok {
+		return err
+	}
+
+	comparison, err := services.CompareEvalRuns(base, candidate)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "შეფასებები სხვადასხვა ნაკრებს ეკუთვნის",
+		})
+	}
+
+	return c.JSON(comparison)
+}
+
+// loadEvalSet loads the evaluation set named in the route.
+// Returns ok=false with the sent error response when it is missing.
+func loadEvalSet(ctx context.Context, c *fiber.Ctx, companyID string) (*models.EvalSet, bool, error) {
+	set, err := services.GetEvalSet(ctx, c.Params("setID"), companyID)
+	if err != nil {
+		return nil, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "შეფასების ნაკრების მიღება ვერ მოხერხდა",
+			"details": err.Error(),
+		})
+	}
+	if set == nil {
+		return nil, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "შეფასების ნაკრები ვერ მოიძებნა",
+		})
+	}
+	return set, true, nil
+}
+
+// loadEvalRun loads an evaluation run of the company.
+// Returns ok=false with the sent error response when it is missing.
+func loadEvalRun(ctx context.Context, c *fiber.Ctx, runID, companyID string) (*models.EvalRun, bool, error) {
+	run, err := services.GetEvalRun(ctx, runID, companyID)
+	if err != nil {
+		return nil, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "შეფასების მიღება ვერ მოხერხდა",
+			"details": err.Error(),
+		})
+	}
+	if run == nil {
+		return nil, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "შეფასება ვერ მოიძებნა",
+		})
+	}
+	return run, true, nil
+}
+
+// validateEvalSet checks an evaluation set and that its page belongs to the company.
+// Returns ok=false with the sent error response when it is invalid.
+func validateEvalSet(ctx context.Context, c *fiber.Ctx, set *models.EvalSet) (bool, error) {
+	if err := services.ValidateEvalSet(set); err != nil {
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "შეფასების ნაკრები არასწორია",
+			"details": err.Error(),
+		})
+	}
+	if _, err := services.ValidatePageOwnership(ctx, set.PageID, set.CompanyID); err != nil {
+		return false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "გვერდი კომპანიაში ვერ მოიძებნა",
+		})
+	}
+	return true, nil
+}
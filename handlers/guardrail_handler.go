@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"facebook-bot/models"
+	"facebook-bot/services"
+)
+
+// GetGuardrailViolations returns the company's guardrail violation log
+func GetGuardrailViolations(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Company ID not found in session",
+		})
+	}
+
+	pageID := c.Query("page_id")
+	violationType := c.Query("type")
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 50)
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 50
+	}
+	if limit > 200 {
+		limit = 200
+	}
+	skip := (page - 1) * limit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if pageID != "" {
+		if _, err := services.ValidatePageOwnership(ctx, pageID, companyID.(string)); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Page not found or access denied",
+			})
+		}
+	}
+
+	violations, totalCount, err := services.GetGuardrailViolations(ctx, companyID.(string), pageID, violationType, limit, skip)
+	if err != nil {
+		slog.Error("Failed to get guardrail violations", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve guardrail violations",
+		})
+	}
+
+	totalPages := (int(totalCount) + limit - 1) / limit
+	hasMore := page < totalPages
+
+	return c.JSON(fiber.Map{
+		"violations": violations,
+		"pagination": fiber.Map{
+			"page":        page,
+			"limit":       limit,
+			"total":       totalCount,
+			"total_pages": totalPages,
+			"has_more":    hasMore,
+		},
+	})
+}
+
+// guardReply runs the output guardrails on a generated reply before it is sent.
+// Blocked replies are regenerated once with feedback, or escalated if the page is configured to
+// escalate or the regenerated reply is blocked too. Returns the reply to send, or escalate=true
+// when no reply should be sent and the conversation needs a human.
+func guardReply(ctx context.Context, company *models.Company, pageConfig *models.FacebookPage, channel, customerID, reply, ragContext string, trace *services.ReplyTrace, regenerate func(feedback string) (string, error)) (string, bool) {
+	if reply == "" {
+		return reply, false
+	}
+
+	onBlock := pageConfig.GuardrailOnBlock
+	if !models.IsValidGuardrailOnBlock(onBlock) {
+		onBlock = models.GuardrailOnBlockRegenerate
+	}
+
+	check := services.GuardrailCheck{
+		Channel:       channel,
+		PageConfig:    pageConfig,
+		SystemPrompt:  trace.SystemPrompt,
+		KnowledgeBase: ragContext,
+	}
+
+	var violations []models.GuardrailViolation
+	record := func(result services.GuardrailResult, original string, attempt int, action string) {
+		for _, violation := range result.Violations {
+			violation.CompanyID = company.CompanyID
+			violation.PageID = pageConfig.PageID
+			violation.CustomerID = customerID
+			violation.Channel = channel
+			violation.Attempt = attempt
+			violation.Action = action
+			violation.Original = services.MaskSecrets(original, pageConfig)
+			violations = append(violations, violation)
+		}
+	}
+	defer func() {
+		services.RecordGuardrailViolations(violations)
+	}()
+
+	result := services.CheckReplyGuardrails(reply, check)
+	if !result.Blocked {
+		record(result, reply, 1, models.GuardrailActionRedacted)
+		return result.Reply, false
+	}
+
+	slog.Warn("Reply blocked by guardrails",
+		"pageID", pageConfig.PageID,
+		"customerID", customerID,
+		"channel", channel,
+		"violations", len(result.Violations),
+		"onBlock", onBlock)
+
+	if onBlock == models.GuardrailOnBlockEscalate || regenerate == nil {
+		record(result, reply, 1, models.GuardrailActionEscalated)
+		return "", true
+	}
+	record(result, reply, 1, models.GuardrailActionRegenerated)
+
+	regenerated, err := regenerate(services.GuardrailFeedback(result.Violations))
+	if err != nil {
+		slog.Error("Failed to regenerate blocked reply", "error", err, "pageID", pageConfig.PageID)
+		return "", true
+	}
+
+	result = services.CheckReplyGuardrails(regenerated, check)
+	if result.Blocked {
+		slog.Warn("Regenerated reply blocked by guardrails, escalating",
+			"pageID", pageConfig.PageID,
+			"customerID", customerID,
+			"channel", channel)
+		record(result, regenerated, 2, models.GuardrailActionEscalated)
+		return "", true
+	}
+
+	record(result, regenerated, 2, models.GuardrailActionRedacted)
+	return result.Reply, false
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"facebook-bot/models"
+	"facebook-bot/services"
+)
+
+// ResolveConversation marks a human conversation resolved and hands the customer back to the bot
+func ResolveConversation(c *fiber.Ctx) error {
+	customerID := c.Params("customerID")
+	if customerID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Customer ID is required",
+		})
+	}
+
+	var reqBody struct {
+		PageID string `json:"page_id"`
+	}
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if reqBody.PageID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Page ID is required",
+		})
+	}
+
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Company ID not found in session",
+		})
+	}
+
+	agentID, _ := c.Locals("user_id").(string)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	customer, status, err := resolveConversation(ctx, companyID.(string), reqBody.PageID, customerID, agentID)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":  "Conversation resolved and handed back to the bot",
+		"customer": customer,
+	})
+}
+
+// resolveConversation checks that the agent may resolve a customer's conversation and hands it
+// back to the bot. Returns the HTTP status and a message safe to show to the agent on failure.
+func resolveConversation(ctx context.Context, companyID, pageID, customerID, agentID string) (*models.Customer, int, error) {
+	if _, err := services.ValidatePageOwnership(ctx, pageID, companyID); err != nil {
+		return nil, fiber.StatusForbidden, errors.New("Page not found or access denied")
+	}
+
+	company, err := services.GetCompanyByPageID(ctx, pageID)
+	if err != nil {
+		slog.Error("Failed to get company configuration", "error", err, "pageID", pageID)
+		return nil, fiber.StatusInternalServerError, errors.New("Failed to load page configuration")
+	}
+	pageConfig, err := services.GetPageConfig(company, pageID)
+	if err != nil {
+		return nil, fiber.StatusNotFound, errors.New("Page not found")
+	}
+
+	customer, err := services.GetCustomer(ctx, customerID, pageID)
+	if err != nil || customer == nil {
+		return nil, fiber.StatusNotFound, errors.New("Customer not found")
+	}
+	if !customer.Stop {
+		return nil, fiber.StatusBadRequest, errors.New("Customer is already talking to the bot")
+	}
+	if customer.AgentID != "" && customer.AgentID != agentID {
+		return nil, fiber.StatusForbidden, fmt.Errorf("Customer is assigned to %s", customer.AgentEmail)
+	}
+
+	updated, err := services.ResolveConversation(ctx, pageConfig, customer)
+	if err != nil {
+		if errors.Is(err, services.ErrResolveDisabled) {
+			return nil, fiber.StatusBadRequest, errors.New("Resolving conversations is not enabled for this page")
+		}
+		slog.Error("Failed to resolve conversation",
+			"error", err,
+			"customerID", customerID,
+			"pageID", pageID)
+		return nil, fiber.StatusInternalServerError, errors.New("Failed to resolve conversation")
+	}
+	if updated == nil {
+		return nil, fiber.StatusConflict, errors.New("Customer is already talking to the bot")
+	}
+
+	slog.Info("Conversation resolved by agent",
+		"customerID", customerID,
+		"pageID", pageID,
+		"agentID", agentID)
+
+	return updated, fiber.StatusOK, nil
+}
+
+// recordAgentActivity restarts the hand-back inactivity timer after an agent message
+func recordAgentActivity(ctx context.Context, customerID, pageID string) {
+	if err := services.RecordAgentActivity(ctx, customerID, pageID); err != nil {
+		slog.Warn("Failed to record agent activity",
+			"error", err,
+			"customerID", customerID,
+			"pageID", pageID)
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"facebook-bot/services"
+)
+
+// GetKnowledgeDocuments lists the uploaded files with their active and latest versions
+func GetKnowledgeDocuments(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Company ID not found in session",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	documents, err := services.GetKnowledgeDocuments(ctx, companyID.(string), c.Query("page_id"))
+	if err != nil {
+		slog.Error("Failed to get knowledge documents", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get documents",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"documents": documents,
+		"count":     len(documents),
+	})
+}
+
+// GetKnowledgeDocumentVersions returns a file's version history, newest first, with the diff of each
+// version to the one that was active when it was uploaded
+func GetKnowledgeDocumentVersions(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Company ID not found in session",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	document, err := services.GetKnowledgeDocument(ctx, c.Params("documentID"), companyID.(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Failed to get document",
+			"details": err.Error(),
+		})
+	}
+	if document == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Document not found",
+		})
+	}
+
+	versions, err := services.GetKnowledgeDocumentVersions(ctx, document.ID)
+	if err != nil {
+		slog.Error("Failed to get knowledge document versions", "documentID", document.ID.Hex(), "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get document versions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"document": document,
+		"versions": versions,
+	})
+}
+
+// RollbackKnowledgeDocument restores an earlier version of a file as a new version. Its chunks replace
+// the active ones in the background, once any chunks embedded with another model since are embedded
+// again.
+func RollbackKnowledgeDocument(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Company ID not found in session",
+		})
+	}
+
+	var req struct {
+		Version int `json:"version"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Version <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "version is required",
+		})
+	}
+
+	userEmail, _ := c.Locals("user_email").(string)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	version, err := services.RestoreKnowledgeDocumentVersion(ctx, companyID.(string), c.Params("documentID"), req.Version, userEmail)
+	switch {
+	case errors.Is(err, services.ErrKnowledgeDocumentNotFound), errors.Is(err, services.ErrKnowledgeVersionNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrKnowledgeVersionActive), errors.Is(err, services.ErrKnowledgeVersionNotRestorable):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case err != nil:
+		slog.Error("Failed to restore knowledge document version", "documentID", c.Params("documentID"), "version", req.Version, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to restore version",
+			"details": err.Error(),
+		})
+	}
+
+	go processRAGDocumentInBackground(version, version.Metadata["filename"])
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Version restored and queued for processing",
+		"version": version,
+	})
+}
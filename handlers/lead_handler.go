@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"facebook-bot/models"
+	"facebook-bot/services"
+)
+
+// GetLeads returns customers with captured lead data for the company
+func GetLeads(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Company ID not found in session",
+		})
+	}
+
+	pageID := c.Query("page_id")
+	stage := c.Query("stage")
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 50)
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 50
+	}
+	if limit > 200 {
+		limit = 200
+	}
+	skip := (page - 1) * limit
+
+	if stage != "" && !models.IsValidLeadStage(stage) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid qualification stage",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if pageID != "" {
+		if _, err := services.ValidatePageOwnership(ctx, pageID, companyID.(string)); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Page not found or access denied",
+			})
+		}
+	}
+
+	leads, totalCount, err := services.GetLeads(ctx, companyID.(string), pageID, stage, limit, skip)
+	if err != nil {
+		slog.Error("Failed to get leads", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve leads",
+		})
+	}
+
+	totalPages := (int(totalCount) + limit - 1) / limit
+	hasMore := page < totalPages
+
+	return c.JSON(fiber.Map{
+		"leads": leads,
+		"pagination": fiber.Map{
+			"page":        page,
+			"limit":       limit,
+			"total":       totalCount,
+			"total_pages": totalPages,
+			"has_more":    hasMore,
+		},
+	})
+}
+
+// ExportLeads exports the company's leads as a CSV file
+func ExportLeads(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Company ID not found in session",
+		})
+	}
+
+	pageID := c.Query("page_id")
+	stage := c.Query("stage")
+
+	if stage != "" && !models.IsValidLeadStage(stage) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid qualification stage",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if pageID != "" {
+		if _, err := services.ValidatePageOwnership(ctx, pageID, companyID.(string)); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Page not found or access denied",
+			})
+		}
+	}
+
+	// Limit 0 exports all leads
+	leads, _, err := services.GetLeads(ctx, companyID.(string), pageID, stage, 0, 0)
+	if err != nil {
+		slog.Error("Failed to get leads for export", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to export leads",
+		})
+	}
+
+	// Collect custom attribute names so every lead gets the same columns
+	attributeSet := make(map[string]bool)
+	for _, customer := range leads {
+		for key := range customer.Lead.Attributes {
+			attributeSet[key] = true
+		}
+	}
+	attributeKeys := make([]string, 0, len(attributeSet))
+	for key := range attributeSet {
+		attributeKeys = append(attributeKeys, key)
+	}
+	sort.Strings(attributeKeys)
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	header := []string{
+		"customer_id", "customer_name", "page_id", "page_name",
+		"phone", "email", "budget", "preferences", "qualification_stage",
+	}
+	header = append(header, attributeKeys...)
+	header = append(header, "captured_at", "updated_at")
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, customer := range leads {
+		lead := customer.Lead
+		row := []string{
+			customer.CustomerID,
+			customer.CustomerName,
+			customer.PageID,
+			customer.PageName,
+			lead.Phone,
+			lead.Email,
+			lead.Budget,
+			lead.Preferences,
+			lead.QualificationStage,
+		}
+		for _, key := range attributeKeys {
+			row = append(row, lead.Attributes[key])
+		}
+		row = append(row, lead.CapturedAt.Format(time.RFC3339), lead.UpdatedAt.Format(time.RFC3339))
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		slog.Error("Failed to write leads CSV", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to export leads",
+		})
+	}
+
+	filename := fmt.Sprintf("leads_%s.csv", time.Now().Format("2006-01-02"))
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	return c.Send(buf.Bytes())
+}
+
+// captureLeadFromMessage extracts lead data from a customer message and stores it on the customer.
+// Runs in the background so it never delays the reply.
+func captureLeadFromMessage(company *models.Company, senderID, senderName, pageID, messageText string, pageConfig *models.FacebookPage, history []services.ChatHistory) {
+	if !pageConfig.LeadCaptureEnabled || strings.TrimSpace(messageText) == "" {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if services.IsBudgetExceeded(ctx, company) {
+			return
+		}
+
+		ctx = services.WithUsageScope(ctx, services.UsageScope{
+			CompanyID:  company.CompanyID,
+			PageID:     pageID,
+			CustomerID: senderID,
+		})
+
+		lead, err := services.ExtractLeadDetails(ctx, messageText, history, pageConfig)
+		if err != nil {
+			slog.Warn("Failed to extract lead details",
+				"customerID", senderID,
+				"pageID", pageID,
+				"error", err)
+			return
+		}
+		if lead == nil {
+			return
+		}
+
+		customer, changed, err := services.SaveCustomerLead(ctx, senderID, pageID, lead)
+		if err != nil {
+			slog.Error("Failed to save customer lead",
+				"customerID", senderID,
+				"pageID", pageID,
+				"error", err)
+			return
+		}
+		if !changed {
+			return
+		}
+
+		services.GetWebSocketManager().BroadcastToCompany(company.CompanyID, services.BroadcastMessage{
+			CompanyID: company.CompanyID,
+			PageID:    pageID,
+			Type:      "lead_captured",
+			Data: map[string]interface{}{
+				"customer_id":   senderID,
+				"customer_name": senderName,
+				"lead":          customer.Lead,
+				"timestamp":     time.Now().Unix(),
+			},
+		})
+	}()
+}
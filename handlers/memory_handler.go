@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"facebook-bot/models"
+	"facebook-bot/services"
+)
+
+// GetCustomerMemory returns the rolling conversation summary of a customer
+func GetCustomerMemory(c *fiber.Ctx) error {
+	customerID := c.Params("customerID")
+	if customerID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Customer ID is required",
+		})
+	}
+
+	pageID := c.Query("page_id")
+	if pageID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Page ID is required",
+		})
+	}
+
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Company ID not found in session",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := services.ValidatePageOwnership(ctx, pageID, companyID.(string)); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Page not found or access denied",
+		})
+	}
+
+	customer, err := services.GetCustomer(ctx, customerID, pageID)
+	if err != nil {
+		slog.Error("Failed to get customer", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve customer",
+		})
+	}
+	if customer == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Customer not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"customer_id": customerID,
+		"page_id":     pageID,
+		"memory":      customer.Memory,
+	})
+}
+
+// UpdateCustomerMemory replaces a customer's conversation summary with an agent's edit
+func UpdateCustomerMemory(c *fiber.Ctx) error {
+	customerID := c.Params("customerID")
+	if customerID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Customer ID is required",
+		})
+	}
+
+	var reqBody struct {
+		PageID  string `json:"page_id"`
+		Summary string `json:"summary"`
+	}
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if reqBody.PageID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Page ID is required",
+		})
+	}
+	if len([]rune(reqBody.Summary)) > services.MaxMemoryLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":      "Summary is too long",
+			"max_length": services.MaxMemoryLength,
+		})
+	}
+
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Company ID not found in session",
+		})
+	}
+	agentEmail, _ := c.Locals("user_email").(string)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := services.ValidatePageOwnership(ctx, reqBody.PageID, companyID.(string)); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Page not found or access denied",
+		})
+	}
+
+	memory, err := services.UpdateConversationMemory(ctx, customerID, reqBody.PageID, reqBody.Summary, agentEmail)
+	if err != nil {
+		slog.Error("Failed to update conversation memory", "error", err, "customerID", customerID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update conversation memory",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Conversation memory updated successfully",
+		"memory":  memory,
+	})
+}
+
+// RefreshCustomerMemory folds the latest messages into a customer's summary right away
+func RefreshCustomerMemory(c *fiber.Ctx) error {
+	customerID := c.Params("customerID")
+	if customerID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Customer ID is required",
+		})
+	}
+
+	var reqBody struct {
+		PageID string `json:"page_id"`
+	}
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if reqBody.PageID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Page ID is required",
+		})
+	}
+
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Company ID not found in session",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	if _, err := services.ValidatePageOwnership(ctx, reqBody.PageID, companyID.(string)); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Page not found or access denied",
+		})
+	}
+
+	company, err := services.GetCompanyByPageID(ctx, reqBody.PageID)
+	if err != nil {
+		slog.Error("Failed to get company configuration", "error", err, "pageID", reqBody.PageID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load page configuration",
+		})
+	}
+	pageConfig, err := services.GetPageConfig(company, reqBody.PageID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Page not found",
+		})
+	}
+
+	if services.IsBudgetExceeded(ctx, company) {
+		return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+			"error": "Monthly budget exceeded",
+		})
+	}
+
+	ctx = services.WithUsageScope(ctx, services.UsageScope{
+		CompanyID:  company.CompanyID,
+		PageID:     reqBody.PageID,
+		CustomerID: customerID,
+	})
+
+	memory, err := services.RefreshConversationMemory(ctx, company, pageConfig, customerID)
+	if err != nil {
+		if errors.Is(err, services.ErrMemoryChanged) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Conversation memory was edited during the refresh, please try again",
+			})
+		}
+		slog.Error("Failed to refresh conversation memory", "error", err, "customerID", customerID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to refresh conversation memory",
+		})
+	}
+	if memory == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Conversation memory is already being refreshed",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Conversation memory refreshed successfully",
+		"memory":  memory,
+	})
+}
+
+// refreshMemoryInBackground refreshes the customer's conversation summary every few messages.
+// Runs in the background so it never delays the reply.
+func refreshMemoryInBackground(company *models.Company, pageConfig *models.FacebookPage, customer *models.Customer) {
+	if !services.ShouldRefreshConversationMemory(customer) {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+
+		if services.IsBudgetExceeded(ctx, company) {
+			return
+		}
+
+		ctx = services.WithUsageScope(ctx, services.UsageScope{
+			CompanyID:  company.CompanyID,
+			PageID:     pageConfig.PageID,
+			CustomerID: customer.CustomerID,
+		})
+
+		memory, err := services.RefreshConversationMemory(ctx, company, pageConfig, customer.CustomerID)
+		if err != nil {
+			slog.Warn("Failed to refresh conversation memory",
+				"customerID", customer.CustomerID,
+				"pageID", pageConfig.PageID,
+				"error", err)
+			return
+		}
+		if memory == nil {
+			return
+		}
+
+		services.GetWebSocketManager().BroadcastToCompany(company.CompanyID, services.BroadcastMessage{
+			CompanyID: company.CompanyID,
+			PageID:    pageConfig.PageID,
+			Type:      "customer_memory_updated",
+			Data: map[string]interface{}{
+				"customer_id": customer.CustomerID,
+				"memory":      memory,
+				"timestamp":   time.Now().Unix(),
+			},
+		})
+	}()
+}
@@ -75,12 +75,29 @@ func HandleMessage(messaging Messaging, pageID string) {
 		return
 	}
 
-	// Check if Messenger is enabled for this page
-	if pageConfig.MessengerConfig != nil && !pageConfig.MessengerConfig.IsEnabled {
+	// Resolve the effective channel configuration (channel overrides page overrides company)
+	channelConfig := services.ResolveChannelConfig(company, pageConfig, "messenger")
+	if !channelConfig.IsEnabled {
 		slog.Info("Messenger is disabled for this page, skipping bot response",
-			"pageID", pageID)
+			"pageID", pageID,
+			"source", channelConfig.EnabledSource)
 		return
 	}
+	pageConfig = services.ApplyChannelConfig(pageConfig, channelConfig)
+
+	// Bill all model calls made while handling this message to the customer
+	ctx = services.WithUsageScope(ctx, services.UsageScope{
+		CompanyID:  company.CompanyID,
+		PageID:     pageID,
+		CustomerID: senderID,
+	})
+
+	// Detect the customer's language, falling back to the company default for short or ambiguous messages
+	language := services.ResolveLanguage(messageText, channelConfig.DefaultLanguage)
+	ctx = services.WithCustomerLanguage(ctx, language.Language)
+
+	// Score the customer's mood with the lexicon; the reply model refines it when it answers
+	sentiment := services.ClassifySentiment(messageText)
 
 	slog.Info("Handling message",
 		"senderID", senderID,
@@ -88,6 +105,8 @@ func HandleMessage(messaging Messaging, pageID string) {
 		"pageName", pageConfig.PageName,
 		"companyID", company.CompanyID,
 		"message", messageText,
+		"language", language.Language,
+		"languageSource", language.Source,
 	)
 
 	// Fetch user details (first name and last name) from Facebook synchronously
@@ -166,6 +185,8 @@ func HandleMessage(messaging Messaging, pageID string) {
 			PageID:      pageID,
 			PageName:    pageConfig.PageName,
 			Message:     messageText,
+			Language:    language.Language,
+			Sentiment:   &sentiment,
 			IsBot:       false,
 			Timestamp:   time.Now(),
 			UpdatedAt:   time.Now(),
@@ -174,6 +195,7 @@ func HandleMessage(messaging Messaging, pageID string) {
 		if err := services.SaveMessage(ctx, messageDoc); err != nil {
 			slog.Error("Failed to save user message", "error", err)
 		}
+		scoreCustomerMessage(ctx, messageDoc, nil)
 
 		// Broadcast the message via WebSocket for dashboard monitoring
 		wsManager := services.GetWebSocketManager()
@@ -193,6 +215,10 @@ func HandleMessage(messaging Messaging, pageID string) {
 			},
 		})
 
+		// Keep capturing lead details and the conversation memory while a human handles the conversation
+		captureLeadFromMessage(company, senderID, senderName, pageID, messageText, pageConfig, nil)
+		refreshMemoryInBackground(company, pageConfig, customer)
+
 		// Exit early - don't process with bot
 		return
 	}
@@ -209,6 +235,8 @@ func HandleMessage(messaging Messaging, pageID string) {
 		PageID:      pageID,
 		PageName:    pageConfig.PageName,
 		Message:     messageText,
+		Language:    language.Language,
+		Sentiment:   &sentiment,
 		IsBot:       false,
 		Source:      "facebook", // Mark source as facebook
 		Timestamp:   time.Now(),
@@ -219,6 +247,9 @@ func HandleMessage(messaging Messaging, pageID string) {
 		slog.Error("Failed to save user message", "error", err)
 	}
 
+	// Fold older messages into the customer's rolling summary every few messages
+	refreshMemoryInBackground(company, pageConfig, customer)
+
 	// Broadcast incoming message to WebSocket clients
 	wsManager := services.GetWebSocketManager()
 	wsManager.BroadcastToCompany(company.CompanyID, services.BroadcastMessage{
@@ -236,6 +267,13 @@ func HandleMessage(messaging Messaging, pageID string) {
 		},
 	})
 
+	// Skip model calls when the company has used up its monthly budget
+	if services.IsBudgetExceeded(ctx, company) {
+		scoreCustomerMessage(ctx, messageDoc, nil)
+		handleBudgetExceededMessage(ctx, company, pageConfig, senderID, senderName, messageText, language.Language)
+		return
+	}
+
 	// Fetch chat history for context (limit to 5 messages to prevent timeouts)
 	chatHistory, err := services.GetChatHistory(ctx, senderID, pageID, 5)
 	if err != nil {
@@ -250,35 +288,103 @@ func HandleMessage(messaging Messaging, pageID string) {
 		"pageID", pageID,
 	)
 
+	// Extract lead details in the background if enabled for this page
+	captureLeadFromMessage(company, senderID, senderName, pageID, messageText, pageConfig, chatHistory)
+
+	// Send the summary of earlier conversations alongside the recent turns
+	if customer != nil && customer.Memory != nil && customer.Memory.Summary != "" {
+		ctx = services.WithConversationMemory(ctx, customer.Memory.Summary)
+	}
+
 	// Check vector database for available RAG documents and retrieve context if found
 	var ragContext string
-
-	// Try to get relevant context from vector database
-	ragContext, err = services.GetRAGContextForChannel(ctx, messageText, company.CompanyID, pageID, "messenger")
-	if err != nil {
-		slog.Warn("Failed to fetch RAG context from vector DB", "error", err)
-		// Continue without RAG context
-	} else if ragContext != "" {
-		slog.Info("RAG context retrieved from vector DB",
-			"contextLength", len(ragContext),
-			"companyID", company.CompanyID,
-			"pageID", pageID,
-			"channel", "messenger",
-		)
+	var retrieval *models.RetrievalConfidence
+
+	// Try to get relevant context from vector database unless retrieval is switched off for the channel
+	if channelConfig.RAGEnabled {
+		// Search in the knowledge base language when the customer writes in another one
+		ragQuery := services.TranslateQueryForKnowledge(ctx, messageText, language.Language, company, pageConfig)
+		var confidence models.RetrievalConfidence
+		ragContext, confidence, err = services.GetRAGContextWithConfidence(ctx, ragQuery, company.CompanyID, pageID, "messenger")
+		if err != nil {
+			slog.Warn("Failed to fetch RAG context from vector DB", "error", err)
+			// Continue without RAG context
+		} else {
+			// Tell the model how well the knowledge base matched so it does not invent answers
+			retrieval = &confidence
+			ctx = services.WithRetrievalConfidence(ctx, confidence)
+
+			if ragContext != "" {
+				slog.Info("RAG context retrieved from vector DB",
+					"contextLength", len(ragContext),
+					"companyID", company.CompanyID,
+					"pageID", pageID,
+					"channel", "messenger",
+				)
+			} else {
+				slog.Debug("No relevant RAG documents found in vector DB",
+					"query", messageText,
+					"pageID", pageID,
+					"channel", "messenger",
+				)
+			}
+		}
 	} else {
-		slog.Debug("No relevant RAG documents found in vector DB",
-			"query", messageText,
+		slog.Debug("RAG disabled for channel, skipping retrieval",
 			"pageID", pageID,
 			"channel", "messenger",
+			"source", channelConfig.RAGSource,
 		)
 	}
 
 	// Get AI response from Claude with tool use for agent detection
+	ctx, trace := services.WithReplyTrace(ctx)
 	aiResponse, wantsAgent, err := services.GetClaudeResponseWithToolUse(ctx, messageText, "chat", company, pageConfig, chatHistory, ragContext)
+
+	// Message sent to the customer when the conversation is handed to a human, and why
+	var handoffReply, handoffReason string
 	if err != nil {
-		slog.Error("Failed to get Claude response", "error", err)
-		aiResponse = "I apologize, but I'm having trouble processing your message right now. Please try again later."
-		wantsAgent = false
+		// Every model in the page's fallback chain failed, the last tier is a human
+		slog.Error("Failed to get Claude response, handing off to human", "error", err)
+		aiResponse = ""
+		wantsAgent = true
+		handoffReply = services.LocalizedMessage(services.MessageKeyHumanHandoff, language.Language)
+		handoffReason = "model_unavailable"
+	}
+
+	// Track the customer's mood and hand upset or hurried customers to a human when the page's rules say so
+	messageSentiment, trend := scoreCustomerMessage(ctx, messageDoc, trace.Sentiment)
+	if err == nil && !wantsAgent {
+		if reason := services.CheckEscalation(pageConfig, messageSentiment, trend); reason != "" {
+			wantsAgent = true
+			handoffReply = services.LocalizedMessage(services.MessageKeyHumanHandoff, language.Language)
+			handoffReason = reason
+		}
+	}
+
+	// Escalate or ask for details when the knowledge base has no answer, and log the question for gap analysis
+	if err == nil && !wantsAgent {
+		var escalate bool
+		aiResponse, escalate = checkAnswerability(company, pageConfig, "messenger", senderID, messageText, language.Language, aiResponse, trace, retrieval)
+		if escalate {
+			wantsAgent = true
+			handoffReply = services.LocalizedMessage(services.MessageKeyHumanHandoff, language.Language)
+			handoffReason = models.EscalationReasonUnanswerable
+		}
+	}
+
+	// Check the reply against the output guardrails before anything is sent
+	if err == nil && !wantsAgent {
+		var escalate bool
+		aiResponse, escalate = guardReply(ctx, company, pageConfig, "messenger", senderID, aiResponse, ragContext, trace, func(feedback string) (string, error) {
+			reply, _, err := services.GetClaudeResponseWithToolUse(ctx, messageText+"\n\n"+feedback, "chat", company, pageConfig, chatHistory, ragContext)
+			return reply, err
+		})
+		if escalate {
+			// Hand the conversation to a human instead of sending a reply that failed the guardrails
+			wantsAgent = true
+			handoffReason = "guardrail_blocked"
+		}
 	}
 
 	// Check if tool detected that customer wants to talk to a real person
@@ -294,20 +400,24 @@ func HandleMessage(messaging Messaging, pageID string) {
 				"pageID", pageID)
 		}
 
-		// Clear the AI response - don't send any message to customer when they want a real agent
-		aiResponse = ""
+		// Clear the AI response - only a handoff notice is sent when the customer is handed to a real agent
+		aiResponse = handoffReply
 
 		// Broadcast notification about human assistance request
+		requestData := map[string]interface{}{
+			"chat_id":       senderID,
+			"customer_name": senderName,
+			"message":       messageText,
+			"timestamp":     time.Now().Unix(),
+		}
+		if handoffReason != "" {
+			requestData["reason"] = handoffReason
+		}
 		wsManager.BroadcastToCompany(company.CompanyID, services.BroadcastMessage{
 			CompanyID: company.CompanyID,
 			PageID:    pageID,
 			Type:      "agent_requested",
-			Data: map[string]interface{}{
-				"chat_id":       senderID,
-				"customer_name": senderName,
-				"message":       messageText,
-				"timestamp":     time.Now().Unix(),
-			},
+			Data:      requestData,
 		})
 
 		// Also broadcast the customer status update
@@ -377,6 +487,11 @@ func HandleMessage(messaging Messaging, pageID string) {
 		Original:  messageText,
 		Response:  aiResponse,
 		Timestamp: time.Now(),
+
+		PromptVersion: trace.PromptVersion,
+		CompanyID:     company.CompanyID,
+		Tier:          trace.Tier,
+		Model:         trace.Model,
 	}
 
 	if err := services.SaveResponse(ctx, responseDoc); err != nil {
@@ -384,6 +499,106 @@ func HandleMessage(messaging Messaging, pageID string) {
 	}
 }
 
+// scoreCustomerMessage stores the sentiment of a customer message and folds it into the customer's trend.
+// The model's classification replaces the lexicon score saved with the message when there is one.
+func scoreCustomerMessage(ctx context.Context, messageDoc *models.Message, modelSentiment *models.MessageSentiment) (models.MessageSentiment, *models.SentimentTrend) {
+	sentiment := *messageDoc.Sentiment
+	if modelSentiment != nil {
+		sentiment = *modelSentiment
+		if err := services.UpdateMessageSentiment(ctx, messageDoc.ID, sentiment); err != nil {
+			slog.Warn("Failed to save message sentiment", "error", err, "messageID", messageDoc.ID)
+		}
+	}
+
+	trend, err := services.UpdateSentimentTrend(ctx, messageDoc.SenderID, messageDoc.PageID, sentiment)
+	if err != nil {
+		slog.Warn("Failed to update customer sentiment trend", "error", err, "customerID", messageDoc.SenderID)
+	}
+	return sentiment, trend
+}
+
+// handleBudgetExceededMessage answers a message without calling the model,
+// either with the company's fallback reply or by handing the customer over to a human
+func handleBudgetExceededMessage(ctx context.Context, company *models.Company, pageConfig *models.FacebookPage, senderID, senderName, messageText, language string) {
+	wsManager := services.GetWebSocketManager()
+	pageID := pageConfig.PageID
+
+	if services.GetBudgetExceededAction(company) == models.BudgetActionHumanOnly {
+		updatedCustomer, err := services.UpdateCustomerStopStatus(ctx, senderID, pageID, true)
+		if err != nil {
+			slog.Error("Failed to update customer stop status", "error", err)
+		} else {
+			slog.Info("Customer handed over to human because budget is exceeded",
+				"customerID", senderID,
+				"pageID", pageID)
+		}
+
+		wsManager.BroadcastToCompany(company.CompanyID, services.BroadcastMessage{
+			CompanyID: company.CompanyID,
+			PageID:    pageID,
+			Type:      "agent_requested",
+			Data: map[string]interface{}{
+				"chat_id":       senderID,
+				"customer_name": senderName,
+				"message":       messageText,
+				"reason":        "budget_exceeded",
+				"timestamp":     time.Now().Unix(),
+			},
+		})
+
+		if updatedCustomer != nil {
+			wsManager.BroadcastToCompany(company.CompanyID, services.BroadcastMessage{
+				CompanyID: company.CompanyID,
+				PageID:    pageID,
+				Type:      "customer_stop_status_changed",
+				Data: map[string]interface{}{
+					"customer":  updatedCustomer,
+					"stop":      true,
+					"timestamp": time.Now().Unix(),
+				},
+			})
+		}
+		return
+	}
+
+	reply := services.GetBudgetFallbackMessage(company, language)
+	if err := services.SendMessengerReply(ctx, senderID, reply, pageConfig.PageAccessToken); err != nil {
+		slog.Error("Failed to send budget fallback reply", "error", err)
+		return
+	}
+
+	botMessageDoc := &models.Message{
+		Type:        "chat",
+		ChatID:      senderID,
+		SenderID:    pageID,
+		RecipientID: senderID,
+		PageID:      pageID,
+		PageName:    pageConfig.PageName,
+		Message:     reply,
+		IsBot:       true,
+		Source:      "bot",
+		Timestamp:   time.Now(),
+	}
+	if err := services.SaveMessage(ctx, botMessageDoc); err != nil {
+		slog.Error("Failed to save bot message", "error", err)
+	}
+
+	wsManager.BroadcastToCompany(company.CompanyID, services.BroadcastMessage{
+		CompanyID: company.CompanyID,
+		PageID:    pageID,
+		Type:      "new_message",
+		Data: map[string]interface{}{
+			"chat_id":      senderID,
+			"sender_id":    pageID,
+			"sender_name":  pageConfig.PageName,
+			"recipient_id": senderID,
+			"message":      reply,
+			"is_bot":       true,
+			"timestamp":    time.Now().Unix(),
+		},
+	})
+}
+
 // GetAllMessagesByPage retrieves all messages for a specific page with pagination
 func GetAllMessagesByPage(c *fiber.Ctx) error {
 	// Get page_id from URL params
@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"facebook-bot/models"
+	"facebook-bot/services"
+)
+
+// PromptTemplateRequest represents a new prompt template version
+type PromptTemplateRequest struct {
+	Key         string `json:"key"`
+	Layer       string `json:"layer"`
+	Vertical    string `json:"vertical,omitempty"` // Required for the vertical layer
+	PageID      string `json:"page_id,omitempty"`  // Required for the page layer
+	Content     string `json:"content"`
+	Description string `json:"description,omitempty"`
+}
+
+// PromptPreviewRequest represents a prompt preview with sample data
+type PromptPreviewRequest struct {
+	PageID     string `json:"page_id"`
+	Key        string `json:"key,omitempty"`
+	TemplateID string `json:"template_id,omitempty"` // Stored version to preview in place of the published one
+	Layer      string `json:"layer,omitempty"`       // With content: unsaved layer to preview
+	Content    string `json:"content,omitempty"`
+
+	// Sample data, defaults to the page configuration
+	PageName         string  `json:"page_name,omitempty"`
+	CompanyName      string  `json:"company_name,omitempty"`
+	CustomPrompt     *string `json:"custom_prompt,omitempty"`
+	MessageType      string  `json:"message_type,omitempty"`
+	HasKnowledgeBase *bool   `json:"has_knowledge_base,omitempty"`
+}
+
+// PromptRollbackRequest identifies the prompt layer to roll back
+type PromptRollbackRequest struct {
+	Key      string `json:"key"`
+	Layer    string `json:"layer"`
+	Vertical string `json:"vertical,omitempty"`
+	PageID   string `json:"page_id,omitempty"`
+	Version  int    `json:"version,omitempty"` // 0 restores the previously published version
+}
+
+// GetPromptTemplates lists the company's prompt template versions and the shared layers
+func GetPromptTemplates(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	templates, err := services.GetPromptTemplates(ctx, companyID.(string), c.Query("key"), c.Query("layer"), c.Query("page_id"))
+	if err != nil {
+		slog.Error("Failed to get prompt templates", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "პრომპტის შაბლონების მიღება ვერ მოხერხდა",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"templates": templates,
+		"count":     len(templates),
+	})
+}
+
+// CreatePromptTemplate saves a new draft version of a company prompt layer
+func CreatePromptTemplate(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	var req PromptTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "არასწორი მოთხოვნის ტექსტი",
+			"details": err.Error(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	template := &models.PromptTemplate{
+		Key:         req.Key,
+		Layer:       req.Layer,
+		Vertical:    req.Vertical,
+		CompanyID:   companyID.(string),
+		PageID:      req.PageID,
+		Content:     req.Content,
+		Description: req.Description,
+	}
+	if username, ok := c.Locals("username").(string); ok {
+		template.CreatedBy = username
+	}
+
+	if errResponse := validatePromptIdentity(ctx, c, template); errResponse != nil {
+		return errResponse
+	}
+	if template.Content == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "შაბლონის შინაარსი აუცილებელია",
+		})
+	}
+
+	if err := services.ValidatePromptTemplate(template); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "შაბლონი არასწორია",
+			"details": err.Error(),
+		})
+	}
+
+	if err := services.CreatePromptTemplate(ctx, template); err != nil {
+		slog.Error("Failed to create prompt template", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "შაბლონის შენახვა ვერ მოხერხდა",
+			"details": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":  "შაბლონის მონახაზი შენახულია",
+		"template": template,
+	})
+}
+
+// PreviewPromptTemplate renders a page's prompt with sample data, optionally with a draft layer
+func PreviewPromptTemplate(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	var req PromptPreviewRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "არასწორი მოთხოვნის ტექსტი",
+			"details": err.Error(),
+		})
+	}
+	if req.Key == "" {
+		req.Key = models.PromptKeyReplySystem
+	}
+	if !models.IsValidPromptKey(req.Key) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "არასწორი შაბლონის გასაღები",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	company, err := services.GetCompanyByID(ctx, companyID.(string))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "კომპანია ვერ მოიძებნა",
+			"details": err.Error(),
+		})
+	}
+
+	pageConfig := findCompanyPage(company, req.PageID)
+	if pageConfig == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "გვერდი კომპანიაში ვერ მოიძებნა",
+		})
+	}
+
+	// The draft can be a stored version or unsaved content
+	var draft *models.PromptTemplate
+	if req.TemplateID != "" {
+		draft, err = services.GetPromptTemplate(ctx, req.TemplateID, company.CompanyID)
+		if err != nil || draft == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "შაბლონი ვერ მოიძებნა",
+			})
+		}
+	} else if req.Content != "" {
+		if !models.IsValidPromptLayer(req.Layer) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "არასწორი შაბლონის ფენა",
+			})
+		}
+		draft = &models.PromptTemplate{
+			Key:       req.Key,
+			Layer:     req.Layer,
+			Vertical:  services.PageVertical(pageConfig),
+			CompanyID: company.CompanyID,
+			PageID:    pageConfig.PageID,
+			Content:   req.Content,
+		}
+	}
+
+	if draft != nil {
+		if draft.Key != req.Key {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "შაბლონის გასაღები არ ემთხვევა",
+			})
+		}
+		if (draft.Layer == models.PromptLayerVertical && draft.Vertical != services.PageVertical(pageConfig)) ||
+			(draft.Layer == models.PromptLayerPage && draft.PageID != pageConfig.PageID) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "შაბლონი ამ გვერდს არ ეხება",
+			})
+		}
+	}
+
+	data := services.SamplePromptData(pageConfig.PageName, company.CompanyName, pageConfig.SystemPrompt)
+	if req.PageName != "" {
+		data.PageName = req.PageName
+	}
+	if req.CompanyName != "" {
+		data.CompanyName = req.CompanyName
+	}
+	if req.CustomPrompt != nil {
+		data.CustomPrompt = *req.CustomPrompt
+	}
+	if req.MessageType != "" {
+		data.MessageType = req.MessageType
+	}
+	if req.HasKnowledgeBase != nil {
+		data.HasKnowledgeBase = *req.HasKnowledgeBase
+	}
+
+	prompt, version, err := services.PreviewPrompt(ctx, req.Key, company.CompanyID, pageConfig, draft, data)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "შაბლონის გენერირება ვერ მოხერხდა",
+			"details": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"prompt":         prompt,
+		"prompt_version": version,
+		"vertical":       services.PageVertical(pageConfig),
+		"data":           data,
+	})
+}
+
+// PublishPromptTemplate publishes a draft or archived version of a company prompt layer
+func PublishPromptTemplate(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	template, err := services.GetPromptTemplate(ctx, c.Params("templateID"), companyID.(string))
+	if err != nil || template == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "შაბლონი ვერ მოიძებნა",
+		})
+	}
+
+	if template.Status == models.PromptStatusPublished {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "შაბლონი უკვე გამოქვეყნებულია",
+		})
+	}
+
+	if err := services.PublishPromptTemplate(ctx, template); err != nil {
+		slog.Error("Failed to publish prompt template", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "შაბლონის გამოქვეყნება ვერ მოხერხდა",
+			"details": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":  "შაბლონი გამოქვეყნდა",
+		"template": template,
+	})
+}
+
+// RollbackPromptTemplate restores an earlier version of a company prompt layer
+func RollbackPromptTemplate(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	var req PromptRollbackRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "არასწორი მოთხოვნის ტექსტი",
+			"details": err.Error(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	identity := &models.PromptTemplate{
+		Key:       req.Key,
+		Layer:     req.Layer,
+		Vertical:  req.Vertical,
+		CompanyID: companyID.(string),
+		PageID:    req.PageID,
+	}
+	if errResponse := validatePromptIdentity(ctx, c, identity); errResponse != nil {
+		return errResponse
+	}
+
+	template, err := services.RollbackPromptTemplate(ctx, identity, req.Version)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "შაბლონის დაბრუნება ვერ მოხერხდა",
+			"details": err.Error(),
+		})
+	}
+
+	if template == nil {
+		return c.JSON(fiber.Map{
+			"message": "კომპანიის შაბლონი გაუქმდა, გამოიყენება საერთო შაბლონი",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":  "შაბლონი დაბრუნდა წინა ვერსიაზე",
+		"template": template,
+	})
+}
+
+// validatePromptIdentity checks the key, layer, vertical and page of a company prompt layer.
+// Returns a response to send if the identity is invalid.
+func validatePromptIdentity(ctx context.Context, c *fiber.Ctx, template *models.PromptTemplate) error {
+	if !models.IsValidPromptKey(template.Key) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":      "არასწორი შაბლონის გასაღები",
+			"valid_keys": []string{models.PromptKeyReplySystem},
+		})
+	}
+	if !models.IsValidPromptLayer(template.Layer) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "არასწორი შაბლონის ფენა",
+			"valid_layers": []string{
+				models.PromptLayerBase,
+				models.PromptLayerVertical,
+				models.PromptLayerPage,
+			},
+		})
+	}
+
+	switch template.Layer {
+	case models.PromptLayerBase:
+		template.Vertical = ""
+		template.PageID = ""
+	case models.PromptLayerVertical:
+		if !models.IsValidVertical(template.Vertical) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":           "არასწორი ვერტიკალი",
+				"valid_verticals": []string{models.VerticalStore, models.VerticalRealEstate},
+			})
+		}
+		template.PageID = ""
+	case models.PromptLayerPage:
+		if template.PageID == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "გვერდის ID აუცილებელია",
+			})
+		}
+		if _, err := services.ValidatePageOwnership(ctx, template.PageID, template.CompanyID); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "გვერდი ვერ მოიძებნა ან წვდომა აკრძალულია",
+			})
+		}
+		template.Vertical = ""
+	}
+
+	return nil
+}
+
+// findCompanyPage returns the company's page with the given ID
+func findCompanyPage(company *models.Company, pageID string) *models.FacebookPage {
+	for i := range company.Pages {
+		if company.Pages[i].PageID == pageID {
+			return &company.Pages[i]
+		}
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 
+	"facebook-bot/models"
 	"facebook-bot/services"
 )
 
@@ -44,10 +45,11 @@ func TestRAGRetrieval(c *fiber.Ctx) error {
 	// Test vector search - use page-specific search if page ID provided
 	var results []services.SearchResult
 	var ragContext string
+	var retrieval *models.RetrievalConfidence
 
 	if req.PageID != "" {
-		// Search with page ID filter
-		results, err = services.SearchSimilarDocumentsByPage(ctx, req.Query, companyID, req.PageID, 5)
+		// Search the page as replies do, fusing vector and keyword rankings
+		results, err = services.SearchWithStoredEmbeddings(ctx, req.Query, companyID, req.PageID, 5)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to search documents by page: " + err.Error(),
@@ -55,7 +57,9 @@ func TestRAGRetrieval(c *fiber.Ctx) error {
 		}
 
 		// Get RAG context with page ID filter
-		ragContext, err = services.GetRAGContext(ctx, req.Query, companyID, req.PageID)
+		var confidence models.RetrievalConfidence
+		ragContext, confidence, err = services.GetRAGContextWithConfidence(ctx, req.Query, companyID, req.PageID, "")
+		retrieval = &confidence
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to get RAG context: " + err.Error(),
@@ -79,6 +83,33 @@ func TestRAGRetrieval(c *fiber.Ctx) error {
 		}
 	}
 
+	// The page's embedder and the models its documents were embedded with, to spot documents
+	// left out of search after a model change
+	var embedder services.Embedder
+	var hybridSearch *models.HybridSearch
+	var reranker *models.RerankerConfig
+	embeddingProvider, embeddingModel, embeddingError := "", "", ""
+	for i := range company.Pages {
+		if company.Pages[i].PageID == req.PageID || (req.PageID == "" && i == 0) {
+			hybridSearch = company.Pages[i].HybridSearch
+			reranker = company.Pages[i].Reranker
+			embedder, err = services.PageEmbedder(&company.Pages[i])
+			if err != nil {
+				embeddingError = err.Error()
+			} else {
+				embeddingProvider = embedder.Provider()
+				embeddingModel = embedder.Model()
+			}
+			break
+		}
+	}
+	modelStats, err := services.GetEmbeddingModelStats(ctx, companyID, req.PageID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count documents by embedding model: " + err.Error(),
+		})
+	}
+
 	// Format results for response
 	var searchResults []map[string]interface{}
 	for _, result := range results {
@@ -89,10 +120,11 @@ func TestRAGRetrieval(c *fiber.Ctx) error {
 		}
 
 		searchResults = append(searchResults, map[string]interface{}{
-			"score":    result.Score,
-			"source":   result.Source,
-			"content":  content,
-			"metadata": result.Metadata,
+			"score":     result.Score,
+			"source":    result.Source,
+			"content":   content,
+			"metadata":  result.Metadata,
+			"breakdown": result.Breakdown, // Vector and keyword scores and ranks, page searches only
 		})
 	}
 
@@ -104,33 +136,14 @@ func TestRAGRetrieval(c *fiber.Ctx) error {
 		"search_results":       searchResults,
 		"rag_context_length":   len(ragContext),
 		"rag_context":          ragContext,
-		"embedding_configured": len(company.Pages) > 0 && (company.Pages[0].VoyageAPIKey != "" || company.Pages[0].GPTAPIKey != ""),
-		"embedding_provider": func() string {
-			if len(company.Pages) > 0 {
-				if company.Pages[0].GPTAPIKey != "" {
-					return "OpenAI GPT"
-				} else if company.Pages[0].VoyageAPIKey != "" {
-					return "Voyage AI"
-				}
-			}
-			return "Mock"
-		}(),
-		"embedding_model": func() string {
-			if len(company.Pages) > 0 {
-				if company.Pages[0].GPTAPIKey != "" {
-					if company.Pages[0].GPTModel != "" {
-						return company.Pages[0].GPTModel
-					}
-					return "text-embedding-3-large"
-				} else if company.Pages[0].VoyageAPIKey != "" {
-					if company.Pages[0].VoyageModel != "" {
-						return company.Pages[0].VoyageModel
-					}
-					return "voyage-2"
-				}
-			}
-			return "mock-embeddings"
-		}(),
+		"embedding_configured": embedder != nil,
+		"embedding_provider":   embeddingProvider,
+		"embedding_model":      embeddingModel,
+		"embedding_error":      embeddingError,
+		"embedding_models":     modelStats,
+		"hybrid_search":        hybridSearch, // Equal weights when null
+		"reranker":             reranker,     // Stats of the rerank stage are in retrieval.rerank
+		"retrieval":            retrieval,
 	})
 }
 
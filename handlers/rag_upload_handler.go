@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 
+	"facebook-bot/models"
 	"facebook-bot/services"
 )
 
@@ -158,7 +160,7 @@ func UploadRAGDocument(c *fiber.Ctx) error {
 	}
 
 	// Process file based on type
-	content, err := extractTextFromFile(file)
+	content, report, err := extractTextFromFile(file)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": fmt.Sprintf("Failed to extract text from file: %v", err),
@@ -171,9 +173,12 @@ func UploadRAGDocument(c *fiber.Ctx) error {
 		})
 	}
 
-	// Store metadata about the file
+	// Store metadata about the file, with what extraction found in it
 	metadata["filename"] = file.Filename
 	metadata["upload_time"] = time.Now().Format(time.RFC3339)
+	for key, value := range report.Metadata() {
+		metadata[key] = value
+	}
 
 	// Get user email if available
 	userEmail := ""
@@ -188,179 +193,95 @@ func UploadRAGDocument(c *fiber.Ctx) error {
 		"pageID", pageID,
 		"filename", file.Filename,
 		"contentLength", len(content),
+		"extractor", report.Extractor,
+		"pages", report.Pages,
+		"warnings", report.Warnings,
 	)
 
+	// Chunk the file into the next version of the page's document with its name. Its chunks replace
+	// the previous version's once all of them are embedded.
+	version, err := services.AddKnowledgeDocumentVersion(ctx, services.KnowledgeUpload{
+		CompanyID:  company.CompanyID,
+		PageID:     pageID,
+		Filename:   file.Filename,
+		Source:     source,
+		Channels:   channels,
+		Text:       content,
+		Metadata:   metadata,
+		UploadedBy: userEmail,
+	})
+	if errors.Is(err, services.ErrKnowledgeDocumentEmpty) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "No text content found in file",
+		})
+	}
+	if err != nil {
+		slog.Error("Failed to add document version", "filename", file.Filename, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to add document version: %v", err),
+		})
+	}
+
 	// Process embeddings in background
-	go processRAGDocumentInBackground(
-		company.CompanyID,
-		pageID,
-		channels,
-		content,
-		source,
-		metadata,
-		file.Filename,
-		userEmail,
-	)
+	go processRAGDocumentInBackground(version, file.Filename)
 
 	// Return immediately
 	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
-		"message":  "File received and queued for processing",
-		"filename": file.Filename,
-		"size":     file.Size,
-		"source":   source,
-		"page_id":  pageID,
-		"channels": channels,
-		"status":   "processing",
+		"message":     "File received and queued for processing",
+		"filename":    file.Filename,
+		"size":        file.Size,
+		"source":      source,
+		"page_id":     pageID,
+		"channels":    channels,
+		"status":      "processing",
+		"extraction":  report,
+		"document_id": version.DocumentID.Hex(),
+		"version":     version,
 	})
 }
 
-// processRAGDocumentInBackground processes document embeddings in the background
-func processRAGDocumentInBackground(companyID, pageID string, channels []string, content, source string, metadata map[string]string, filename, userEmail string) {
+// processRAGDocumentInBackground embeds a document version's chunks in the background and switches
+// the document to it
+func processRAGDocumentInBackground(version *models.KnowledgeDocumentVersion, filename string) {
 	// Create a new context for background processing
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
 	defer cancel()
 
 	slog.Info("Starting background RAG document processing",
-		"companyID", companyID,
-		"pageID", pageID,
+		"companyID", version.CompanyID,
+		"pageID", version.PageID,
 		"filename", filename,
-		"contentLength", len(content),
+		"version", version.Version,
+		"chunks", version.Chunks,
+		"reused", version.Reused,
 	)
 
-	// Split content into chunks if it's too large
-	chunks := splitIntoChunks(content, 2000) // 2000 chars per chunk
-
-	var storedCount int
-	var errors []string
-
-	for i, chunk := range chunks {
-		// Add chunk info to metadata
-		chunkMetadata := make(map[string]string)
-		for k, v := range metadata {
-			chunkMetadata[k] = v
-		}
-		if len(chunks) > 1 {
-			chunkMetadata["chunk"] = fmt.Sprintf("%d/%d", i+1, len(chunks))
-		}
-
-		// Store embedding for this chunk with channels
-		err := services.StoreEmbeddingsWithChannelsAndOptions(
-			ctx,
-			companyID,
-			pageID,
-			channels,
-			chunk,
-			source,
-			chunkMetadata,
-			"",   // No CRM URL for manual uploads
-			true, // Set as active by default
-		)
-
-		if err != nil {
-			errors = append(errors, fmt.Sprintf("Chunk %d: %v", i+1, err))
-			slog.Error("Failed to store embedding for chunk",
-				"chunk", i+1,
-				"error", err,
-				"companyID", companyID,
-				"pageID", pageID,
-				"filename", filename,
-			)
-		} else {
-			storedCount++
-			slog.Debug("Stored embedding for chunk",
-				"chunk", i+1,
-				"total", len(chunks),
-				"filename", filename,
-			)
-		}
-	}
-
-	// Log completion
-	if len(errors) > 0 {
-		slog.Warn("RAG document processing completed with errors",
-			"companyID", companyID,
-			"pageID", pageID,
-			"filename", filename,
-			"chunks_total", len(chunks),
-			"chunks_stored", storedCount,
-			"errors", len(errors),
-			"error_details", errors,
-		)
-	} else {
-		slog.Info("RAG document processing completed successfully",
-			"companyID", companyID,
-			"pageID", pageID,
+	// The version's status, progress and error are stored on it and sent to the dashboard
+	if err := services.RunKnowledgeDocumentVersion(ctx, version); err != nil {
+		slog.Error("RAG document processing failed, previous version kept",
+			"companyID", version.CompanyID,
+			"pageID", version.PageID,
 			"filename", filename,
-			"chunks_total", len(chunks),
-			"chunks_stored", storedCount,
+			"version", version.Version,
+			"error", err,
 		)
 	}
-
-	// TODO: You could send a webhook or notification here to inform about completion
 }
 
-// extractTextFromFile extracts text content from uploaded file
-func extractTextFromFile(file *multipart.FileHeader) (string, error) {
+// extractTextFromFile extracts text content from uploaded file with the extractor for its type
+func extractTextFromFile(file *multipart.FileHeader) (string, services.ExtractionReport, error) {
 	// Open the file
 	src, err := file.Open()
 	if err != nil {
-		return "", fmt.Errorf("failed to open file: %w", err)
+		return "", services.ExtractionReport{}, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer src.Close()
 
-	// Check file extension
-	filename := strings.ToLower(file.Filename)
-
-	// For now, we'll support plain text files
-	// You can add support for PDF, DOCX, etc. later
-	if strings.HasSuffix(filename, ".txt") ||
-		strings.HasSuffix(filename, ".md") ||
-		strings.HasSuffix(filename, ".csv") ||
-		strings.HasSuffix(filename, ".json") {
-		// Read text content
-		content, err := io.ReadAll(src)
-		if err != nil {
-			return "", fmt.Errorf("failed to read file: %w", err)
-		}
-		return string(content), nil
-	}
-
-	return "", fmt.Errorf("unsupported file type. Supported types: .txt, .md, .csv, .json")
-}
-
-// splitIntoChunks splits text into chunks of specified size
-func splitIntoChunks(text string, chunkSize int) []string {
-	if len(text) <= chunkSize {
-		return []string{text}
-	}
-
-	var chunks []string
-	words := strings.Fields(text)
-
-	var currentChunk strings.Builder
-	for _, word := range words {
-		// Check if adding this word would exceed chunk size
-		if currentChunk.Len()+len(word)+1 > chunkSize {
-			// Save current chunk if it has content
-			if currentChunk.Len() > 0 {
-				chunks = append(chunks, currentChunk.String())
-				currentChunk.Reset()
-			}
-		}
-
-		// Add word to current chunk
-		if currentChunk.Len() > 0 {
-			currentChunk.WriteString(" ")
-		}
-		currentChunk.WriteString(word)
-	}
-
-	// Add the last chunk if it has content
-	if currentChunk.Len() > 0 {
-		chunks = append(chunks, currentChunk.String())
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return "", services.ExtractionReport{}, fmt.Errorf("failed to read file: %w", err)
 	}
-
-	return chunks
+	return services.ExtractFileText(file.Filename, file.Header.Get("Content-Type"), data)
 }
 
 // DeleteRAGDocument deletes a document from vector database
@@ -419,8 +340,11 @@ func DeleteRAGDocument(c *fiber.Ctx) error {
 	// Delete document based on provided criteria
 	var deletedCount int64
 	if req.Filename != "" {
-		// Delete by filename in metadata
-		deletedCount, err = services.DeleteVectorDocumentsByMetadata(ctx, company.CompanyID, req.PageID, "filename", req.Filename)
+		// Delete by filename in metadata, with the file's version history
+		err = services.DeleteKnowledgeDocument(ctx, company.CompanyID, req.PageID, req.Filename)
+		if err == nil {
+			deletedCount, err = services.DeleteVectorDocumentsByMetadata(ctx, company.CompanyID, req.PageID, "filename", req.Filename)
+		}
 	} else if req.Content != "" {
 		// Delete by content
 		deletedCount, err = services.DeleteVectorDocumentByContent(ctx, company.CompanyID, req.PageID, req.Content)
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"facebook-bot/models"
+	"facebook-bot/services"
+)
+
+// ReindexRequest selects the page to re-embed and the model to embed it with
+type ReindexRequest struct {
+	PageID            string `json:"page_id"`
+	EmbeddingProvider string `json:"embedding_provider,omitempty"` // The page's current provider when empty
+	EmbeddingModel    string `json:"embedding_model,omitempty"`    // The provider's default model when empty
+}
+
+// ReindexDocuments starts a background job re-embedding every document of a page, e.g. after
+// switching its embedding model. Progress is sent over the WebSocket as reindex_progress events.
+func ReindexDocuments(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	var req ReindexRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "არასწორი მოთხოვნის ტექსტი",
+			"details": err.Error(),
+		})
+	}
+	if req.PageID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "page_id აუცილებელია",
+		})
+	}
+	if req.EmbeddingProvider != "" && !models.IsValidEmbeddingProvider(req.EmbeddingProvider) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":           "არასწორი ემბედინგის პროვაიდერი",
+			"valid_providers": models.EmbeddingProviders(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	startedBy, _ := c.Locals("username").(string)
+	job, err := services.StartReindexJob(ctx, companyID.(string), req.PageID, req.EmbeddingProvider, req.EmbeddingModel, startedBy)
+	switch {
+	case errors.Is(err, services.ErrReindexPageNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "გვერდი კომპანიაში ვერ მოიძებნა ან არააქტიურია",
+		})
+	case errors.Is(err, services.ErrNoEmbeddingProvider):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "ემბედინგის პროვაიდერის API გასაღები არ არის მითითებული",
+			"details": err.Error(),
+		})
+	case errors.Is(err, services.ErrReindexJobRunning):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "ამ გვერდისთვის ხელახალი ინდექსაცია უკვე მიმდინარეობს",
+		})
+	case err != nil:
+		slog.Error("Failed to start re-embedding job", "pageID", req.PageID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "ხელახალი ინდექსაციის დაწყება ვერ მოხერხდა",
+		})
+	}
+
+	go func() {
+		if err := services.RunReindexJob(context.Background(), job); err != nil {
+			slog.Error("Re-embedding job failed", "jobID", job.ID.Hex(), "error", err)
+		}
+	}()
+
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// GetReindexJobs lists the company's re-embedding jobs
+func GetReindexJobs(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	jobs, err := services.GetReindexJobs(ctx, companyID.(string), c.Query("page_id"), limit)
+	if err != nil {
+		slog.Error("Failed to get re-embedding jobs", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "ხელახალი ინდექსაციის სამუშაოების მიღება ვერ მოხერხდა",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"jobs":  jobs,
+		"count": len(jobs),
+	})
+}
+
+// GetReindexJob returns one re-embedding job with its progress
+func GetReindexJob(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := services.GetReindexJob(ctx, c.Params("jobID"), companyID.(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "ხელახალი ინდექსაციის მიღება ვერ მოხერხდა",
+			"details": err.Error(),
+		})
+	}
+	if job == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "ხელახალი ინდექსაცია ვერ მოიძებნა",
+		})
+	}
+	return c.JSON(job)
+}
+
+// CancelReindexJob stops a running re-embedding job
+func CancelReindexJob(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := services.CancelReindexJob(ctx, c.Params("jobID"), companyID.(string))
+	switch {
+	case errors.Is(err, services.ErrReindexJobFinished):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":  "ხელახალი ინდექსაცია უკვე დასრულებულია",
+			"status": job.Status,
+		})
+	case err != nil:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "ხელახალი ინდექსაციის გაუქმება ვერ მოხერხდა",
+			"details": err.Error(),
+		})
+	case job == nil:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "ხელახალი ინდექსაცია ვერ მოიძებნა",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "ხელახალი ინდექსაცია გაუქმდება მიმდინარე პაკეტის შემდეგ",
+		"job":     job,
+	})
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"facebook-bot/models"
+	"facebook-bot/services"
+)
+
+// SuggestReply drafts replies to a customer in human mode without sending anything
+func SuggestReply(c *fiber.Ctx) error {
+	customerID := c.Params("customerID")
+	if customerID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Customer ID is required",
+		})
+	}
+
+	var reqBody struct {
+		PageID string `json:"page_id"`
+		Count  int    `json:"count,omitempty"`
+	}
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if reqBody.PageID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Page ID is required",
+		})
+	}
+
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Company ID not found in session",
+		})
+	}
+
+	agentID, _ := c.Locals("user_id").(string)
+	agentEmail, _ := c.Locals("user_email").(string)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	suggestion, status, err := draftReplySuggestion(ctx, companyID.(string), reqBody.PageID, customerID, reqBody.Count, agentID, agentEmail)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"suggestion": suggestion,
+	})
+}
+
+// draftReplySuggestion checks that a customer is waiting for an agent and drafts replies for them.
+// Returns the HTTP status and a message safe to show to the agent when drafting fails.
+func draftReplySuggestion(ctx context.Context, companyID, pageID, customerID string, count int, agentID, agentEmail string) (*models.ReplySuggestion, int, error) {
+	if _, err := services.ValidatePageOwnership(ctx, pageID, companyID); err != nil {
+		return nil, fiber.StatusForbidden, errors.New("Page not found or access denied")
+	}
+
+	company, err := services.GetCompanyByPageID(ctx, pageID)
+	if err != nil {
+		slog.Error("Failed to get company configuration", "error", err, "pageID", pageID)
+		return nil, fiber.StatusInternalServerError, errors.New("Failed to load page configuration")
+	}
+	pageConfig, err := services.GetPageConfig(company, pageID)
+	if err != nil {
+		return nil, fiber.StatusNotFound, errors.New("Page not found")
+	}
+
+	customer, err := services.GetCustomer(ctx, customerID, pageID)
+	if err != nil || customer == nil {
+		return nil, fiber.StatusNotFound, errors.New("Customer not found")
+	}
+	if !customer.Stop {
+		return nil, fiber.StatusBadRequest, errors.New("Customer has not requested human assistance")
+	}
+	if customer.AgentID != "" && customer.AgentID != agentID {
+		return nil, fiber.StatusForbidden, fmt.Errorf("Customer is already assigned to %s", customer.AgentEmail)
+	}
+
+	if services.IsBudgetExceeded(ctx, company) {
+		return nil, fiber.StatusPaymentRequired, errors.New("Monthly budget exceeded")
+	}
+
+	ctx = services.WithUsageScope(ctx, services.UsageScope{
+		CompanyID:  company.CompanyID,
+		PageID:     pageID,
+		CustomerID: customerID,
+	})
+	if customer.Memory != nil && customer.Memory.Summary != "" {
+		ctx = services.WithConversationMemory(ctx, customer.Memory.Summary)
+	}
+
+	suggestion, err := services.SuggestReplies(ctx, company, pageConfig, customerID, count, agentID, agentEmail)
+	if err != nil {
+		if errors.Is(err, services.ErrNoCustomerMessage) {
+			return nil, fiber.StatusBadRequest, errors.New("The customer has not sent a message yet")
+		}
+		slog.Error("Failed to draft reply suggestions",
+			"error", err,
+			"customerID", customerID,
+			"pageID", pageID)
+		return nil, fiber.StatusBadGateway, errors.New("Failed to draft reply suggestions")
+	}
+
+	return suggestion, fiber.StatusOK, nil
+}
+
+// resolveReplySuggestions records how an agent's message relates to the suggestions they were shown
+func resolveReplySuggestions(ctx context.Context, companyID, pageID, customerID, suggestionID, message string) *models.ReplySuggestion {
+	suggestion, err := services.ResolveReplySuggestions(ctx, companyID, pageID, customerID, suggestionID, message)
+	if err != nil {
+		slog.Warn("Failed to record reply suggestion outcome",
+			"error", err,
+			"customerID", customerID,
+			"suggestionID", suggestionID)
+	}
+	return suggestion
+}
+
+// GetReplySuggestionStats returns how often agents sent, edited or ignored reply suggestions
+func GetReplySuggestionStats(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Company ID not found in session",
+		})
+	}
+
+	from, to, errMsg := usageDateRange(c)
+	if errMsg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errMsg,
+		})
+	}
+
+	pageID := c.Query("page_id")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if pageID != "" {
+		if _, err := services.ValidatePageOwnership(ctx, pageID, companyID.(string)); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Page not found or access denied",
+			})
+		}
+	}
+
+	stats, err := services.GetReplySuggestionStats(ctx, companyID.(string), pageID, from, to)
+	if err != nil {
+		slog.Error("Failed to get reply suggestion stats", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve reply suggestion stats",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"from":    from.Format("2006-01-02"),
+		"to":      to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"page_id": pageID,
+		"stats":   stats,
+	})
+}
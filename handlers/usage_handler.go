@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"facebook-bot/services"
+)
+
+// GetUsageByDay returns token usage and cost per day
+func GetUsageByDay(c *fiber.Ctx) error {
+	return getUsageSummary(c, "day")
+}
+
+// GetUsageByPage returns token usage and cost per page
+func GetUsageByPage(c *fiber.Ctx) error {
+	return getUsageSummary(c, "page")
+}
+
+// GetUsageByModel returns token usage and cost per model
+func GetUsageByModel(c *fiber.Ctx) error {
+	return getUsageSummary(c, "model")
+}
+
+// getUsageSummary aggregates usage for the company over the requested date range.
+// Query parameters: from and to (YYYY-MM-DD, defaults to the last 30 days) and optional page_id.
+func getUsageSummary(c *fiber.Ctx, groupBy string) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Company ID not found in session",
+		})
+	}
+
+	from, to, errMsg := usageDateRange(c)
+	if errMsg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errMsg,
+		})
+	}
+
+	pageID := c.Query("page_id")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if pageID != "" {
+		if _, err := services.ValidatePageOwnership(ctx, pageID, companyID.(string)); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Page not found or access denied",
+			})
+		}
+	}
+
+	summaries, err := services.GetUsageSummary(ctx, companyID.(string), groupBy, pageID, from, to)
+	if err != nil {
+		slog.Error("Failed to get usage summary", "error", err, "groupBy", groupBy)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve usage",
+		})
+	}
+
+	var totalCost, totalCacheSavings float64
+	var totalTokens, totalRequests, totalCacheReadTokens int64
+	for _, summary := range summaries {
+		totalCost += summary.Cost
+		totalTokens += summary.TotalTokens
+		totalRequests += summary.Requests
+		totalCacheReadTokens += summary.CacheReadTokens
+		totalCacheSavings += summary.CacheSavings
+	}
+
+	return c.JSON(fiber.Map{
+		"group_by": groupBy,
+		"from":     from.Format("2006-01-02"),
+		"to":       to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"page_id":  pageID,
+		"usage":    summaries,
+		"totals": fiber.Map{
+			"requests":          totalRequests,
+			"tokens":            totalTokens,
+			"cost":              totalCost,
+			"cache_read_tokens": totalCacheReadTokens,
+			"cache_savings":     totalCacheSavings,
+		},
+	})
+}
+
+// usageDateRange parses the from and to query parameters (YYYY-MM-DD, defaults to the last 30 days).
+// Returns the half-open range and an error message for invalid input.
+func usageDateRange(c *fiber.Ctx) (time.Time, time.Time, string) {
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	from := to.AddDate(0, 0, -30)
+
+	if fromStr := c.Query("from"); fromStr != "" {
+		parsed, err := time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			return from, to, "Invalid 'from' date, expected YYYY-MM-DD"
+		}
+		from = parsed
+	}
+	if toStr := c.Query("to"); toStr != "" {
+		parsed, err := time.Parse("2006-01-02", toStr)
+		if err != nil {
+			return from, to, "Invalid 'to' date, expected YYYY-MM-DD"
+		}
+		// Include the whole end day
+		to = parsed.AddDate(0, 0, 1)
+	}
+
+	if !from.Before(to) {
+		return from, to, "'from' must be before 'to'"
+	}
+	return from, to, ""
+}
+
+// GetReplyTiers returns how many replies each tier of the fallback chain served,
+// together with the current state of the model circuit breakers
+func GetReplyTiers(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Company ID not found in session",
+		})
+	}
+
+	from, to, errMsg := usageDateRange(c)
+	if errMsg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errMsg,
+		})
+	}
+
+	pageID := c.Query("page_id")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if pageID != "" {
+		if _, err := services.ValidatePageOwnership(ctx, pageID, companyID.(string)); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Page not found or access denied",
+			})
+		}
+	}
+
+	tiers, err := services.GetReplyTierSummary(ctx, companyID.(string), pageID, from, to)
+	if err != nil {
+		slog.Error("Failed to get reply tier summary", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve reply tiers",
+		})
+	}
+
+	var total int64
+	for _, tier := range tiers {
+		total += tier.Replies
+	}
+
+	return c.JSON(fiber.Map{
+		"from":     from.Format("2006-01-02"),
+		"to":       to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"page_id":  pageID,
+		"tiers":    tiers,
+		"total":    total,
+		"circuits": services.GetCircuitStatuses(),
+	})
+}
+
+// GetUsageBudget returns the company's monthly budget and current spend
+func GetUsageBudget(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Company ID not found in session",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	company, err := services.GetCompanyByID(ctx, companyID.(string))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Company not found",
+		})
+	}
+
+	spent, err := services.GetMonthlySpend(ctx, company.CompanyID)
+	if err != nil {
+		slog.Error("Failed to get monthly spend", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve monthly spend",
+		})
+	}
+
+	var remaining interface{}
+	if company.MonthlyBudget > 0 {
+		remaining = company.MonthlyBudget - spent
+	}
+
+	return c.JSON(fiber.Map{
+		"month":            time.Now().Format("2006-01"),
+		"monthly_budget":   company.MonthlyBudget,
+		"spent":            spent,
+		"remaining":        remaining,
+		"exceeded":         company.MonthlyBudget > 0 && spent >= company.MonthlyBudget,
+		"exceeded_action":  services.GetBudgetExceededAction(company),
+		"fallback_message": services.GetBudgetFallbackMessage(company, company.DefaultLanguage),
+	})
+}
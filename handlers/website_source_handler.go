@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"facebook-bot/models"
+	"facebook-bot/services"
+)
+
+// WebsiteSourceRequest represents a website to crawl into a page's knowledge base
+type WebsiteSourceRequest struct {
+	PageID          string   `json:"page_id"`
+	Name            string   `json:"name,omitempty"`
+	SeedURL         string   `json:"seed_url"` // Page to start from, or a sitemap
+	IncludePatterns []string `json:"include_patterns,omitempty"`
+	ExcludePatterns []string `json:"exclude_patterns,omitempty"`
+	MaxDepth        *int     `json:"max_depth,omitempty"`     // 3 when not set, 0 crawls the seed or sitemap pages only
+	MaxPages        int      `json:"max_pages,omitempty"`     // 100 when not set
+	RefreshHours    int      `json:"refresh_hours,omitempty"` // 24 when not set
+	Channels        []string `json:"channels,omitempty"`
+	IsActive        *bool    `json:"is_active,omitempty"` // true when not set
+}
+
+// GetWebsiteSources lists the company's website sources
+func GetWebsiteSources(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sources, err := services.GetWebsiteSources(ctx, companyID.(string), c.Query("page_id"))
+	if err != nil {
+		slog.Error("Failed to get website sources", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "ვებსაიტის წყაროების მიღება ვერ მოხერხდა",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"sources": sources,
+		"count":   len(sources),
+	})
+}
+
+// GetWebsiteSource returns a website source with its last crawl and the pages stored from it
+func GetWebsiteSource(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	source, ok, err := loadWebsiteSource(ctx, c, companyID.(string))
+	if !ok {
+		return err
+	}
+
+	pages, err := services.GetWebsitePages(ctx, source.ID)
+	if err != nil {
+		slog.Error("Failed to get website pages", "sourceID", source.ID.Hex(), "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "ვებსაიტის გვერდების მიღება ვერ მოხერხდა",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"source": source,
+		"pages":  pages,
+	})
+}
+
+// CreateWebsiteSource adds a website to a page's knowledge base and starts crawling it in the
+// background. The crawl's summary is sent over the WebSocket as a website_crawl_finished event.
+func CreateWebsiteSource(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	var req WebsiteSourceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "არასწორი მოთხოვნის ტექსტი",
+			"details": err.Error(),
+		})
+	}
+	if req.PageID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "page_id აუცილებელია",
+		})
+	}
+
+	source := &models.WebsiteSource{
+		CompanyID: companyID.(string),
+		PageID:    req.PageID,
+		MaxDepth:  models.DefaultWebsiteMaxDepth,
+		IsActive:  true,
+	}
+	applyWebsiteSourceRequest(source, &req)
+	source.CreatedBy, _ = c.Locals("username").(string)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := services.CreateWebsiteSource(ctx, source)
+	switch {
+	case errors.Is(err, services.ErrInvalidWebsiteSource):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "ვებსაიტის წყარო არასწორია",
+			"details": err.Error(),
+		})
+	case errors.Is(err, services.ErrWebsitePageNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "გვერდი კომპანიაში ვერ მოიძებნა ან არააქტიურია",
+		})
+	case err != nil:
+		slog.Error("Failed to create website source", "pageID", req.PageID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "ვებსაიტის წყაროს შენახვა ვერ მოხერხდა",
+		})
+	}
+
+	if source.IsActive {
+		if claimed, err := services.StartWebsiteCrawl(ctx, source.ID.Hex(), source.CompanyID); err == nil && claimed != nil {
+			source = claimed
+			go runWebsiteCrawl(claimed)
+		}
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(source)
+}
+
+// UpdateWebsiteSource replaces the settings of a website source. Changed crawl settings are applied
+// by a crawl started right away.
+func UpdateWebsiteSource(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	var req WebsiteSourceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "არასწორი მოთხოვნის ტექსტი",
+			"details": err.Error(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	source, ok, err := loadWebsiteSource(ctx, c, companyID.(string))
+	if !ok {
+		return err
+	}
+
+	// The page of a source does not change, its documents belong to it
+	applyWebsiteSourceRequest(source, &req)
+	err = services.UpdateWebsiteSource(ctx, source)
+	switch {
+	case errors.Is(err, services.ErrInvalidWebsiteSource):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "ვებსაიტის წყარო არასწორია",
+			"details": err.Error(),
+		})
+	case err != nil:
+		slog.Error("Failed to update website source", "sourceID", source.ID.Hex(), "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "ვებსაიტის წყაროს განახლება ვერ მოხერხდა",
+		})
+	}
+
+	return c.JSON(source)
+}
+
+// DeleteWebsiteSource deletes a website source and the documents crawled from it
+func DeleteWebsiteSource(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	source, ok, err := loadWebsiteSource(ctx, c, companyID.(string))
+	if !ok {
+		return err
+	}
+
+	deleted, err := services.DeleteWebsiteSource(ctx, source.ID.Hex(), source.CompanyID)
+	switch {
+	case errors.Is(err, services.ErrWebsiteCrawlRunning):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "ვებსაიტის სკანირება მიმდინარეობს, სცადეთ მისი დასრულების შემდეგ",
+		})
+	case err != nil:
+		slog.Error("Failed to delete website source", "sourceID", source.ID.Hex(), "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "ვებსაიტის წყაროს წაშლა ვერ მოხერხდა",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":           "ვებსაიტის წყარო წაიშალა",
+		"deleted_documents": deleted,
+	})
+}
+
+// CrawlWebsiteSource crawls a website source now instead of at its next scheduled refresh
+func CrawlWebsiteSource(c *fiber.Ctx) error {
+	companyID := c.Locals("company_id")
+	if companyID == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "კომპანიის ID სესიაში ვერ მოიძებნა",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	source, err := services.StartWebsiteCrawl(ctx, c.Params("sourceID"), companyID.(string))
+	switch {
+	case errors.Is(err, services.ErrWebsiteCrawlRunning):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":  "ვებსაიტის სკანირება უკვე მიმდინარეობს",
+			"source": source,
+		})
+	case err != nil:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "ვებსაიტის სკანირების დაწყება ვერ მოხერხდა",
+			"details": err.Error(),
+		})
+	case source == nil:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "ვებსაიტის წყარო ვერ მოიძებნა",
+		})
+	}
+
+	go runWebsiteCrawl(source)
+
+	return c.Status(fiber.StatusAccepted).JSON(source)
+}
+
+// runWebsiteCrawl crawls a claimed source in the background
+func runWebsiteCrawl(source *models.WebsiteSource) {
+	if err := services.RunWebsiteCrawl(context.Background(), source); err != nil {
+		slog.Error("Website crawl failed", "sourceID", source.ID.Hex(), "error", err)
+	}
+}
+
+// applyWebsiteSourceRequest copies the settings of a request onto a source
+func applyWebsiteSourceRequest(source *models.WebsiteSource, req *WebsiteSourceRequest) {
+	source.Name = req.Name
+	source.SeedURL = req.SeedURL
+	source.IncludePatterns = req.IncludePatterns
+	source.ExcludePatterns = req.ExcludePatterns
+	source.MaxPages = req.MaxPages
+	source.RefreshHours = req.RefreshHours
+	source.Channels = req.Channels
+	if req.MaxDepth != nil {
+		source.MaxDepth = *req.MaxDepth
+	}
+	if req.IsActive != nil {
+		source.IsActive = *req.IsActive
+	}
+}
+
+// loadWebsiteSource loads the website source named in the route.
+// Returns ok=false with the sent error response when it is missing.
+func loadWebsiteSource(ctx context.Context, c *fiber.Ctx, companyID string) (*models.WebsiteSource, bool, error) {
+	source, err := services.GetWebsiteSource(ctx, c.Params("sourceID"), companyID)
+	if err != nil {
+		return nil, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "ვებსაიტის წყაროს მიღება ვერ მოხერხდა",
+			"details": err.Error(),
+		})
+	}
+	if source == nil {
+		return nil, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "ვებსაიტის წყარო ვერ მოიძებნა",
+		})
+	}
+	return source, true, nil
+}
@@ -22,6 +22,9 @@ type WebSocketMessage struct {
 	PageID     string          `json:"page_id,omitempty"`
 	Message    string          `json:"message,omitempty"`
 	Data       json.RawMessage `json:"data,omitempty"`
+
+	// Reply suggestion a send_message started from, for acceptance tracking
+	SuggestionID string `json:"suggestion_id,omitempty"`
 }
 
 // WebSocketUpgrade upgrades HTTP connection to WebSocket
@@ -174,6 +177,14 @@ func handleWebSocketReceive(conn *services.WebSocketConnection) {
 			// Handle sending message from dashboard to customer
 			handleDashboardMessage(conn, msg)
 
+		case "suggest_reply":
+			// Draft replies for the agent without sending anything
+			handleSuggestReply(conn, msg)
+
+		case "resolve_conversation":
+			// Mark the conversation resolved and hand the customer back to the bot
+			handleResolveConversation(conn, msg)
+
 		case "get_stopped_customers":
 			// Handle request for customers who want to talk to real person
 			handleGetStoppedCustomers(conn, msg)
@@ -310,6 +321,14 @@ func handleDashboardMessage(conn *services.WebSocketConnection, msg WebSocketMes
 		Timestamp:   time.Now(),
 	}
 
+	recordAgentActivity(ctx, msg.CustomerID, msg.PageID)
+
+	// Track whether the agent sent one of the drafted replies
+	suggestion := resolveReplySuggestions(ctx, conn.CompanyID, msg.PageID, msg.CustomerID, msg.SuggestionID, msg.Message)
+	if suggestion != nil {
+		messageDoc.SuggestionID = suggestion.ID.Hex()
+	}
+
 	if err := services.SaveMessage(ctx, messageDoc); err != nil {
 		slog.Error("Failed to save dashboard message", "error", err)
 	}
@@ -322,6 +341,10 @@ func handleDashboardMessage(conn *services.WebSocketConnection, msg WebSocketMes
 		"message":     msg.Message,
 		"timestamp":   time.Now().Unix(),
 	}
+	if suggestion != nil {
+		successMsg["suggestion_id"] = suggestion.ID.Hex()
+		successMsg["suggestion_status"] = suggestion.Status
+	}
 
 	if successData, err := json.Marshal(successMsg); err == nil {
 		conn.Send <- successData
@@ -364,6 +387,76 @@ func sendWebSocketError(conn *services.WebSocketConnection, errorMessage string)
 	}
 }
 
+// handleSuggestReply drafts replies to a customer for the requesting agent
+func handleSuggestReply(conn *services.WebSocketConnection, msg WebSocketMessage) {
+	if msg.CustomerID == "" || msg.PageID == "" {
+		sendWebSocketError(conn, "Missing required fields: customer_id and page_id")
+		return
+	}
+
+	var params struct {
+		Count int `json:"count,omitempty"`
+	}
+	if msg.Data != nil {
+		if err := json.Unmarshal(msg.Data, &params); err != nil {
+			sendWebSocketError(conn, "Invalid request data")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 45*time.Second)
+	defer cancel()
+
+	suggestion, _, err := draftReplySuggestion(ctx, conn.CompanyID, msg.PageID, msg.CustomerID, params.Count, conn.UserID, conn.UserEmail)
+	if err != nil {
+		sendWebSocketError(conn, err.Error())
+		return
+	}
+
+	response := map[string]interface{}{
+		"type": "reply_suggestions",
+		"data": map[string]interface{}{
+			"customer_id": msg.CustomerID,
+			"page_id":     msg.PageID,
+			"suggestion":  suggestion,
+		},
+		"timestamp": time.Now().Unix(),
+	}
+
+	if responseData, err := json.Marshal(response); err == nil {
+		conn.Send <- responseData
+	}
+}
+
+// handleResolveConversation hands a resolved conversation back to the bot
+func handleResolveConversation(conn *services.WebSocketConnection, msg WebSocketMessage) {
+	if msg.CustomerID == "" || msg.PageID == "" {
+		sendWebSocketError(conn, "Missing required fields: customer_id and page_id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	customer, _, err := resolveConversation(ctx, conn.CompanyID, msg.PageID, msg.CustomerID, conn.UserID)
+	if err != nil {
+		sendWebSocketError(conn, err.Error())
+		return
+	}
+
+	response := map[string]interface{}{
+		"type": "conversation_resolved",
+		"data": map[string]interface{}{
+			"customer": customer,
+		},
+		"timestamp": time.Now().Unix(),
+	}
+
+	if responseData, err := json.Marshal(response); err == nil {
+		conn.Send <- responseData
+	}
+}
+
 // handleGetStoppedCustomers handles requests for customers who want to talk to a real person
 func handleGetStoppedCustomers(conn *services.WebSocketConnection, msg WebSocketMessage) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -42,6 +42,22 @@ func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
 
+	// Point the API clients at proxies or fake servers when configured
+	services.SetAPIEndpoints(services.APIEndpoints{
+		AnthropicBaseURL: cfg.AnthropicAPIURL,
+		OpenAIBaseURL:    cfg.OpenAIAPIURL,
+		GraphAPIBaseURL:  cfg.GraphAPIURL,
+	})
+
+	// Select where knowledge base vectors are searched
+	if err := services.SetVectorIndex(services.VectorIndexConfig{
+		Backend:        cfg.VectorIndex,
+		AtlasIndexName: cfg.AtlasVectorIndexName,
+	}); err != nil {
+		slog.Error("Invalid vector index configuration", "error", err)
+		os.Exit(1)
+	}
+
 	// Initialize MongoDB
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -61,18 +77,85 @@ func main() {
 	defer cancelCleanup()
 	services.StartSessionCleanup(cleanupCtx)
 
+	// Return stalled human conversations to the bot according to page hand-back policies
+	services.StartHandBackScheduler(cleanupCtx)
+
 	// Create indexes for customers collection
 	if err := services.CreateIndexesForCustomers(ctx); err != nil {
 		slog.Error("Failed to create customer indexes", "error", err)
 		// Continue anyway - the app can still work without indexes
 	}
 
+	// Create indexes for usage events collection
+	if err := services.CreateIndexesForUsage(ctx); err != nil {
+		slog.Error("Failed to create usage indexes", "error", err)
+		// Continue anyway - the app can still work without indexes
+	}
+
+	// Create indexes for guardrail violations collection
+	if err := services.CreateIndexesForGuardrails(ctx); err != nil {
+		slog.Error("Failed to create guardrail indexes", "error", err)
+		// Continue anyway - the app can still work without indexes
+	}
+
+	// Create indexes for reply suggestions collection
+	if err := services.CreateIndexesForReplySuggestions(ctx); err != nil {
+		slog.Error("Failed to create reply suggestion indexes", "error", err)
+		// Continue anyway - the app can still work without indexes
+	}
+
+	// Create indexes for unanswered questions collection
+	if err := services.CreateIndexesForUnansweredQuestions(ctx); err != nil {
+		slog.Error("Failed to create unanswered question indexes", "error", err)
+		// Continue anyway - the app can still work without indexes
+	}
+
+	// Create indexes for evaluation sets and runs
+	if err := services.CreateIndexesForEvaluations(ctx); err != nil {
+		slog.Error("Failed to create evaluation indexes", "error", err)
+		// Continue anyway - the app can still work without indexes
+	}
+
+	// Create indexes for re-embedding jobs collection
+	if err := services.CreateIndexesForReindexJobs(ctx); err != nil {
+		slog.Error("Failed to create re-embedding job indexes", "error", err)
+		// Continue anyway - the app can still work without indexes
+	}
+
+	// Create indexes for website sources and their crawled pages
+	if err := services.CreateIndexesForWebsiteSources(ctx); err != nil {
+		slog.Error("Failed to create website source indexes", "error", err)
+		// Continue anyway - the app can still work without indexes
+	}
+
+	// Create indexes for uploaded documents, their versions and chunks
+	if err := services.CreateIndexesForKnowledgeDocuments(ctx); err != nil {
+		slog.Error("Failed to create knowledge document indexes", "error", err)
+		// Continue anyway - the app can still work without indexes
+	}
+
+	// Seed built-in prompt templates and create their indexes
+	if err := services.InitPromptTemplates(ctx); err != nil {
+		slog.Error("Failed to initialize prompt templates", "error", err)
+		// Continue anyway - built-in prompts are used when none are stored
+	}
+
 	// Initialize vector database
 	if err := services.InitVectorDB(ctx); err != nil {
 		slog.Error("Failed to initialize vector DB", "error", err)
 		// Continue anyway - vector DB is optional
 	}
 
+	// Build the vector index in the background, search scans the documents until it is ready
+	go func() {
+		if err := services.BuildVectorIndex(context.Background()); err != nil {
+			slog.Error("Failed to build vector index", "error", err)
+		}
+	}()
+
+	// Resume re-embedding jobs left running by a stopped instance
+	services.StartReindexWorker(cleanupCtx)
+
 	// Initialize CRM data before starting server
 	slog.Info("Initializing CRM data...")
 	if err := services.InitializeCRMData(ctx); err != nil {
@@ -85,6 +168,9 @@ func main() {
 	defer cancelScheduler()
 	services.StartCRMUpdateScheduler(schedulerCtx)
 
+	// Crawl website sources when their refresh is due
+	services.StartWebsiteCrawlScheduler(schedulerCtx)
+
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
@@ -132,21 +218,48 @@ func main() {
 
 	// Company management endpoints (all users can view company info)
 	admin.Get("/company", handlers.GetCompany)
+	admin.Get("/company/pages/:pageID/effective-config", handlers.GetEffectivePageConfig) // Resolved per-channel configuration
 
 	// Super admin endpoint to create new companies (requires special privileges)
 	admin.Post("/company", middleware.RequireCompanyAdmin, handlers.CreateCompany) // TODO: Add super admin middleware when needed
 
 	// Company admin only endpoints
 	admin.Post("/company/pages", middleware.RequireCompanyAdmin, handlers.AddPageToCompany)
-	admin.Post("/company/pages/full", middleware.RequireCompanyAdmin, handlers.AddPageWithFullDetails)    // Add page with all configuration
-	admin.Put("/company/pages/:pageID", middleware.RequireCompanyAdmin, handlers.UpdatePageConfiguration) // Update page configuration
+	admin.Post("/company/pages/full", middleware.RequireCompanyAdmin, handlers.AddPageWithFullDetails)         // Add page with all configuration
+	admin.Put("/company/pages/:pageID", middleware.RequireCompanyAdmin, handlers.UpdatePageConfiguration)      // Update page configuration
+	admin.Put("/company/budget", middleware.RequireCompanyAdmin, handlers.UpdateCompanyBudget)                 // Update monthly usage budget
+	admin.Put("/company/settings", middleware.RequireCompanyAdmin, handlers.UpdateCompanySettings)             // Update company-wide defaults such as the system prompt
+	admin.Post("/prompts", middleware.RequireCompanyAdmin, handlers.CreatePromptTemplate)                      // Save a draft prompt template version
+	admin.Post("/prompts/rollback", middleware.RequireCompanyAdmin, handlers.RollbackPromptTemplate)           // Restore an earlier prompt version
+	admin.Post("/prompts/:templateID/publish", middleware.RequireCompanyAdmin, handlers.PublishPromptTemplate) // Publish a prompt version
+	admin.Post("/eval-sets", middleware.RequireCompanyAdmin, handlers.CreateEvalSet)
+	admin.Put("/eval-sets/:setID", middleware.RequireCompanyAdmin, handlers.UpdateEvalSet)
+	admin.Delete("/eval-sets/:setID", middleware.RequireCompanyAdmin, handlers.DeleteEvalSet)
+	admin.Post("/eval-sets/:setID/runs", middleware.RequireCompanyAdmin, handlers.StartEvalRun)          // Run an evaluation set, optionally with another model or draft prompt
+	admin.Post("/reindex", middleware.RequireCompanyAdmin, handlers.ReindexDocuments)                    // Re-embed a page's documents in the background, e.g. with a new model
+	admin.Post("/reindex-jobs/:jobID/cancel", middleware.RequireCompanyAdmin, handlers.CancelReindexJob) // Stop a running re-embedding job
+	admin.Post("/website-sources", middleware.RequireCompanyAdmin, handlers.CreateWebsiteSource)         // Crawl a website into a page's knowledge base
+	admin.Put("/website-sources/:sourceID", middleware.RequireCompanyAdmin, handlers.UpdateWebsiteSource)
+	admin.Delete("/website-sources/:sourceID", middleware.RequireCompanyAdmin, handlers.DeleteWebsiteSource)
+	admin.Post("/website-sources/:sourceID/crawl", middleware.RequireCompanyAdmin, handlers.CrawlWebsiteSource) // Refresh a website now
 	admin.Post("/users", middleware.RequireCompanyAdmin, handlers.CreateUser)
 	admin.Post("/users/admin", middleware.RequireCompanyAdmin, handlers.AdminCreateUser) // Admin endpoint to create users with pre-hashed passwords
 	admin.Put("/users/:userID/role", middleware.RequireCompanyAdmin, handlers.UpdateUserRole)
 
 	// User viewing endpoints (all authenticated users)
 	admin.Get("/users", handlers.GetCompanyUsers)
+	admin.Get("/prompts", handlers.GetPromptTemplates)
+	admin.Post("/prompts/preview", handlers.PreviewPromptTemplate)
 	admin.Get("/users/:userID", handlers.GetUser)
+	admin.Get("/eval-sets", handlers.GetEvalSets)
+	admin.Get("/eval-sets/:setID", handlers.GetEvalSet)
+	admin.Get("/eval-runs", handlers.GetEvalRuns)
+	admin.Get("/eval-runs/compare", handlers.CompareEvalRuns) // Side-by-side comparison of two runs of the same set
+	admin.Get("/eval-runs/:runID", handlers.GetEvalRun)
+	admin.Get("/reindex-jobs", handlers.GetReindexJobs)
+	admin.Get("/reindex-jobs/:jobID", handlers.GetReindexJob) // Progress of a re-embedding job
+	admin.Get("/website-sources", handlers.GetWebsiteSources)
+	admin.Get("/website-sources/:sourceID", handlers.GetWebsiteSource) // Last crawl and stored pages of a website
 
 	// Dashboard API endpoints (protected)
 	dashboard := app.Group("/api/dashboard", middleware.RequireAuth, middleware.ExtractCompanyPages)
@@ -181,6 +294,32 @@ func main() {
 	dashboard.Put("/customers/:customerID/agent", handlers.UpdateCustomerAgentName)             // Update customer agent name
 	dashboard.Delete("/customers/:customerID/agent", handlers.UnassignAgentFromCustomer)        // Remove agent assignment from customer
 	dashboard.Put("/customers/:customerID/assignment", handlers.UpdateCustomerAssignmentStatus) // Update is_assigned status
+	dashboard.Get("/customers/:customerID/memory", handlers.GetCustomerMemory)                  // Get conversation summary
+	dashboard.Put("/customers/:customerID/memory", handlers.UpdateCustomerMemory)               // Edit conversation summary
+	dashboard.Post("/customers/:customerID/memory/refresh", handlers.RefreshCustomerMemory)     // Refresh conversation summary now
+	dashboard.Post("/customers/:customerID/suggest-reply", handlers.SuggestReply)               // Draft replies for the agent
+	dashboard.Post("/customers/:customerID/resolve", handlers.ResolveConversation)              // Mark resolved and hand back to the bot
+
+	// Lead endpoints
+	dashboard.Get("/leads", handlers.GetLeads)           // Get captured leads
+	dashboard.Get("/leads/export", handlers.ExportLeads) // Export leads as CSV
+
+	// Usage and cost endpoints
+	dashboard.Get("/usage/daily", handlers.GetUsageByDay)    // Usage per day
+	dashboard.Get("/usage/pages", handlers.GetUsageByPage)   // Usage per page
+	dashboard.Get("/usage/models", handlers.GetUsageByModel) // Usage per model
+	dashboard.Get("/usage/budget", handlers.GetUsageBudget)  // Monthly budget status
+	dashboard.Get("/usage/tiers", handlers.GetReplyTiers)    // Replies per fallback tier and circuit breaker states
+
+	// Output guardrail endpoints
+	dashboard.Get("/guardrails/violations", handlers.GetGuardrailViolations) // Replies that failed a guardrail
+
+	// Knowledge base gap analysis endpoints
+	dashboard.Get("/knowledge/unanswered", handlers.GetUnansweredQuestions) // Questions the knowledge base could not answer
+	dashboard.Get("/knowledge/gaps", handlers.GetKnowledgeGaps)             // Unanswered questions grouped by how often they were asked
+
+	// Agent reply suggestion endpoints
+	dashboard.Get("/suggestions/stats", handlers.GetReplySuggestionStats) // How agents used reply suggestions
 
 	dashboard.Get("/posts", handlers.GetPostsList)
 	dashboard.Get("/posts/company", handlers.GetPostIDsByCompanyHandler) // Get posts for company
@@ -191,10 +330,13 @@ func main() {
 	dashboard.Put("/pages/:pageID/crm-links", handlers.UpdateCRMLink)        // Update or add CRM link
 
 	// RAG Document Management endpoints
-	dashboard.Post("/rag/upload", handlers.UploadRAGDocument)                     // Upload file for RAG processing
-	dashboard.Delete("/rag/document", handlers.DeleteRAGDocument)                 // Delete RAG document
-	dashboard.Put("/rag/document/toggle-channel", handlers.ToggleDocumentChannel) // Simple toggle for document channel
-	dashboard.Get("/rag/files", handlers.GetAllRAGFiles)                          // Get all RAG files with channel data
+	dashboard.Post("/rag/upload", handlers.UploadRAGDocument)                                             // Upload file for RAG processing
+	dashboard.Delete("/rag/document", handlers.DeleteRAGDocument)                                         // Delete RAG document
+	dashboard.Put("/rag/document/toggle-channel", handlers.ToggleDocumentChannel)                         // Simple toggle for document channel
+	dashboard.Get("/rag/files", handlers.GetAllRAGFiles)                                                  // Get all RAG files with channel data
+	dashboard.Get("/rag/knowledge-documents", handlers.GetKnowledgeDocuments)                             // Uploaded files with their active versions
+	dashboard.Get("/rag/knowledge-documents/:documentID/versions", handlers.GetKnowledgeDocumentVersions) // Version history with diff stats
+	dashboard.Post("/rag/knowledge-documents/:documentID/rollback", handlers.RollbackKnowledgeDocument)   // Restore an earlier version
 
 	// New CRM and RAG Management endpoints
 	dashboard.Get("/crm-links", handlers.GetCRMLinksForChannel)      // Get CRM links for a specific channel
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Answerability of a customer message as reported by the reply model
+const (
+	AnswerabilityAnswerable   = "answerable"   // The knowledge base or conversation contains the answer
+	AnswerabilityPartial      = "partial"      // Only part of the question can be answered
+	AnswerabilityUnanswerable = "unanswerable" // The information needed to answer is missing
+	AnswerabilityNotQuestion  = "not_question" // Greeting, thanks or small talk that needs no facts
+)
+
+// Levels of how well the knowledge base matched a question
+const (
+	RetrievalLevelNone   = "none"   // Nothing was retrieved
+	RetrievalLevelLow    = "low"    // Results are unlikely to answer the question
+	RetrievalLevelMedium = "medium" // Results may answer the question
+	RetrievalLevelHigh   = "high"   // Results very likely answer the question
+)
+
+// How the knowledge base was searched
+const (
+	SearchModeQueryEmbedding   = "query_embedding"   // Documents ranked by similarity to the embedded query
+	SearchModeKeywordReference = "keyword_reference" // Degraded: the best keyword match's embedding stands in for the query
+	SearchModeTextOnly         = "text_only"         // No embeddings stored, keyword scores only
+)
+
+// What a page does when the knowledge base has no answer to a question
+const (
+	AnswerabilityActionAnswer   = "answer"   // Send the model's reply, which tells the customer it does not know
+	AnswerabilityActionClarify  = "clarify"  // Ask the customer a clarifying question
+	AnswerabilityActionEscalate = "escalate" // Hand the conversation to a human
+)
+
+// Why a question was logged as unanswered
+const (
+	UnansweredReasonUnanswerable = "unanswerable"  // The model reported the knowledge base has no answer
+	UnansweredReasonPartial      = "partial"       // The model could answer only part of the question
+	UnansweredReasonLowRetrieval = "low_retrieval" // Retrieval scored below the page's minimum
+)
+
+// EscalationReasonUnanswerable is the handoff reason when the knowledge base has no answer
+const EscalationReasonUnanswerable = "unanswerable_question"
+
+// RetrievalConfidence describes how well the knowledge base results match a question
+type RetrievalConfidence struct {
+	TopScore float32 `bson:"top_score" json:"top_score"`           // Score of the best result
+	Results  int     `bson:"results" json:"results"`               // Results retrieved
+	Coverage float64 `bson:"coverage" json:"coverage"`             // 0-1 share of the question's words found in the results
+	Level    string  `bson:"level" json:"level"`                   // none, low, medium or high
+	Mode     string  `bson:"mode,omitempty" json:"mode,omitempty"` // How the knowledge base was searched
+
+	// Documents left out of the search as they were embedded with another model than the page's
+	MismatchedVectors int `bson:"mismatched_vectors,omitempty" json:"mismatched_vectors,omitempty"`
+
+	// Rerank stage, nil when the page does not rerank
+	Rerank *RerankStats `bson:"rerank,omitempty" json:"rerank,omitempty"`
+}
+
+// AnswerabilityPolicy decides what happens when the knowledge base cannot answer a customer,
+// instead of letting the model refuse generically or invent an answer
+type AnswerabilityPolicy struct {
+	Enabled        bool    `bson:"enabled" json:"enabled"`
+	OnUnanswerable string  `bson:"on_unanswerable" json:"on_unanswerable"`                 // answer, clarify or escalate
+	MinTopScore    float64 `bson:"min_top_score,omitempty" json:"min_top_score,omitempty"` // Treat answers as unanswered when the best result scores lower, 0 disables
+}
+
+// UnansweredQuestion is a customer question the knowledge base could not answer, kept for gap analysis
+type UnansweredQuestion struct {
+	ID            primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	CompanyID     string              `bson:"company_id" json:"company_id"`
+	PageID        string              `bson:"page_id" json:"page_id"`
+	CustomerID    string              `bson:"customer_id,omitempty" json:"customer_id,omitempty"`
+	Channel       string              `bson:"channel" json:"channel"` // facebook or messenger
+	Question      string              `bson:"question" json:"question"`
+	Normalized    string              `bson:"normalized" json:"-"` // Lowercased question without punctuation, groups repeated questions
+	Language      string              `bson:"language,omitempty" json:"language,omitempty"`
+	Answerability string              `bson:"answerability,omitempty" json:"answerability,omitempty"` // As reported by the model
+	Reason        string              `bson:"reason" json:"reason"`
+	Action        string              `bson:"action" json:"action"` // What the bot did about it
+	Retrieval     RetrievalConfidence `bson:"retrieval" json:"retrieval"`
+	Reply         string              `bson:"reply,omitempty" json:"reply,omitempty"` // Reply the model generated, with secrets masked
+	Timestamp     time.Time           `bson:"timestamp" json:"timestamp"`
+}
+
+// KnowledgeGap is a question customers asked repeatedly that the knowledge base could not answer
+type KnowledgeGap struct {
+	Question  string    `bson:"question" json:"question"` // Latest wording of the question
+	Count     int64     `bson:"count" json:"count"`
+	Customers int64     `bson:"customers" json:"customers"` // Distinct customers who asked
+	LastAsked time.Time `bson:"last_asked" json:"last_asked"`
+}
+
+// IsValidAnswerability checks if an answerability label is valid
+func IsValidAnswerability(answerability string) bool {
+	switch answerability {
+	case AnswerabilityAnswerable, AnswerabilityPartial, AnswerabilityUnanswerable, AnswerabilityNotQuestion:
+		return true
+	}
+	return false
+}
+
+// IsValidAnswerabilityAction checks if an unanswerable-question setting is valid
+func IsValidAnswerabilityAction(action string) bool {
+	switch action {
+	case AnswerabilityActionAnswer, AnswerabilityActionClarify, AnswerabilityActionEscalate:
+		return true
+	}
+	return false
+}
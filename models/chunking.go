@@ -0,0 +1,9 @@
+package models
+
+// ChunkingConfig sizes the chunks a page's knowledge base documents are split into before they are
+// embedded. Sizes are in estimated tokens, so Georgian and English chunks hold a similar amount of
+// meaning. Changes apply to documents added afterwards.
+type ChunkingConfig struct {
+	MaxTokens     int  `bson:"max_tokens,omitempty" json:"max_tokens,omitempty"`         // Largest chunk, 500 when 0
+	OverlapTokens *int `bson:"overlap_tokens,omitempty" json:"overlap_tokens,omitempty"` // Text repeated from the previous chunk of a section, 50 when not set
+}
@@ -19,6 +19,12 @@ type Company struct {
 	IsActive        bool   `bson:"is_active,omitempty" json:"is_active,omitempty"`
 	ResponseDelay   int    `bson:"response_delay,omitempty" json:"response_delay,omitempty"`     // in seconds
 	DefaultLanguage string `bson:"default_language,omitempty" json:"default_language,omitempty"` // e.g., "en", "ka", "ru"
+	SystemPrompt    string `bson:"system_prompt,omitempty" json:"system_prompt,omitempty"`       // Used by pages and channels without their own prompt
+
+	// Usage budget (USD per calendar month, 0 means unlimited)
+	MonthlyBudget         float64 `bson:"monthly_budget,omitempty" json:"monthly_budget,omitempty"`
+	BudgetExceededAction  string  `bson:"budget_exceeded_action,omitempty" json:"budget_exceeded_action,omitempty"`   // fallback_reply or human_only
+	BudgetFallbackMessage string  `bson:"budget_fallback_message,omitempty" json:"budget_fallback_message,omitempty"` // Reply used when action is fallback_reply
 
 	CreatedAt time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
@@ -36,10 +42,56 @@ type FacebookPage struct {
 	VoyageModel     string `bson:"voyage_model,omitempty" json:"voyage_model,omitempty"`
 	GPTAPIKey       string `bson:"gpt_api_key,omitempty" json:"gpt_api_key,omitempty"`
 	GPTModel        string `bson:"gpt_model,omitempty" json:"gpt_model,omitempty"`
+	CohereAPIKey    string `bson:"cohere_api_key,omitempty" json:"cohere_api_key,omitempty"`
 	SystemPrompt    string `bson:"system_prompt,omitempty" json:"system_prompt,omitempty"`
 	IsActive        bool   `bson:"is_active" json:"is_active"`
 	MaxTokens       int    `bson:"max_tokens" json:"max_tokens"`
 
+	// Knowledge base embeddings: "openai", "voyage", "cohere" or "mock", with the provider's key set above.
+	// Empty keeps the original choice of OpenAI when a GPT key is set, else Voyage. The model defaults to
+	// GPTModel or VoyageModel, then to the provider's default. Documents embedded with another model are
+	// left out of vector search until they are embedded again
+	EmbeddingProvider string `bson:"embedding_provider,omitempty" json:"embedding_provider,omitempty"`
+	EmbeddingModel    string `bson:"embedding_model,omitempty" json:"embedding_model,omitempty"`
+
+	// Weights of the vector and keyword rankings fused in knowledge base search, equal when nil
+	HybridSearch *HybridSearch `bson:"hybrid_search,omitempty" json:"hybrid_search,omitempty"`
+
+	// Second-stage reranking of retrieved chunks before they are put in the reply context, off when nil
+	Reranker *RerankerConfig `bson:"reranker,omitempty" json:"reranker,omitempty"`
+
+	// Chunk sizes of knowledge base documents, 500 tokens with 50 of overlap when nil
+	Chunking *ChunkingConfig `bson:"chunking,omitempty" json:"chunking,omitempty"`
+
+	// Lead capture: extract contact details and qualification data from messages
+	LeadCaptureEnabled bool `bson:"lead_capture_enabled,omitempty" json:"lead_capture_enabled,omitempty"`
+
+	// Output guardrails: hosts replies may link to, and what happens when a reply is blocked
+	LinkAllowlist    []string `bson:"link_allowlist,omitempty" json:"link_allowlist,omitempty"`         // e.g. "example.com", subdomains included
+	GuardrailOnBlock string   `bson:"guardrail_on_block,omitempty" json:"guardrail_on_block,omitempty"` // regenerate (default) or escalate
+
+	// Business vertical selecting the prompt layer ("store" or "real_estate", defaults to store)
+	Vertical string `bson:"vertical,omitempty" json:"vertical,omitempty"`
+
+	// Language the knowledge base is written in; queries in other languages are translated before retrieval.
+	// Defaults to the company default language
+	KnowledgeLanguage string `bson:"knowledge_language,omitempty" json:"knowledge_language,omitempty"`
+
+	// Models tried in order when the primary Claude model fails. Defaults to Claude Haiku, then GPT-4o mini
+	// when an OpenAI key is set. The customer is handed to a human when every model fails
+	FallbackChain []FallbackModel `bson:"fallback_chain,omitempty" json:"fallback_chain,omitempty"`
+
+	// Hand conversations to a human when customers are upset or in a hurry. Disabled when nil
+	EscalationRules *EscalationRules `bson:"escalation_rules,omitempty" json:"escalation_rules,omitempty"`
+
+	// Return customers from human mode to the bot after agent inactivity, outside business hours or on resolve.
+	// Customers stay with agents until someone switches them back when nil
+	HandBackPolicy *HandBackPolicy `bson:"hand_back_policy,omitempty" json:"hand_back_policy,omitempty"`
+
+	// Answer, ask a clarifying question or escalate when the knowledge base has no answer.
+	// The model's reply is sent as is when nil
+	AnswerabilityPolicy *AnswerabilityPolicy `bson:"answerability_policy,omitempty" json:"answerability_policy,omitempty"`
+
 	// Separate CRM and RAG Configuration for Facebook Comments and Messenger
 	FacebookConfig  *ChannelConfig `bson:"facebook_config,omitempty" json:"facebook_config,omitempty"`
 	MessengerConfig *ChannelConfig `bson:"messenger_config,omitempty" json:"messenger_config,omitempty"`
@@ -56,10 +108,10 @@ type ChannelConfig struct {
 	// CRM Links for this channel
 	CRMLinks []CRMLink `bson:"crm_links,omitempty" json:"crm_links,omitempty"`
 
-	// RAG Documents settings for this channel
+	// RAG Documents settings for this channel (retrieval is enabled when the channel has no config)
 	RAGEnabled bool `bson:"rag_enabled" json:"rag_enabled"`
 
-	// Optional channel-specific system prompt
+	// Optional channel-specific system prompt, overrides the page and company prompts
 	SystemPrompt string `bson:"system_prompt,omitempty" json:"system_prompt,omitempty"`
 }
 
@@ -8,27 +8,45 @@ import (
 
 // Customer represents a Facebook user who has sent messages to a page
 type Customer struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	CustomerID   string             `bson:"customer_id" json:"customer_id"`     // Facebook user ID
-	CustomerName string             `bson:"customer_name" json:"customer_name"` // Full name
-	FirstName    string             `bson:"first_name,omitempty" json:"first_name,omitempty"`
-	LastName     string             `bson:"last_name,omitempty" json:"last_name,omitempty"`
-	PageID       string             `bson:"page_id" json:"page_id"`                               // The page they're messaging
-	PageName     string             `bson:"page_name" json:"page_name"`                           // Page name for reference
-	CompanyID    string             `bson:"company_id" json:"company_id"`                         // Company that owns the page
-	MessageCount int                `bson:"message_count" json:"message_count"`                   // Total messages sent
-	LastMessage  string             `bson:"last_message,omitempty" json:"last_message,omitempty"` // Last message text
-	LastSeen     time.Time          `bson:"last_seen" json:"last_seen"`                           // Last interaction time
-	FirstSeen    time.Time          `bson:"first_seen" json:"first_seen"`                         // First interaction time
-	Stop         bool               `bson:"stop" json:"stop"`                                     // Whether customer wants to talk to real person
-	StoppedAt    *time.Time         `bson:"stopped_at,omitempty" json:"stopped_at,omitempty"`     // When customer requested real person
-	IsAssigned   bool               `bson:"is_assigned" json:"is_assigned"`                       // Whether an agent is currently assigned
-	AgentName    string             `bson:"agent_name,omitempty" json:"agent_name,omitempty"`     // Name of the agent handling the customer
-	AgentID      string             `bson:"agent_id,omitempty" json:"agent_id,omitempty"`         // ID of the agent currently handling
-	AgentEmail   string             `bson:"agent_email,omitempty" json:"agent_email,omitempty"`   // Email of the agent currently handling
-	AssignedAt   *time.Time         `bson:"assigned_at,omitempty" json:"assigned_at,omitempty"`   // When agent was assigned
-	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+	ID           primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	CustomerID   string              `bson:"customer_id" json:"customer_id"`     // Facebook user ID
+	CustomerName string              `bson:"customer_name" json:"customer_name"` // Full name
+	FirstName    string              `bson:"first_name,omitempty" json:"first_name,omitempty"`
+	LastName     string              `bson:"last_name,omitempty" json:"last_name,omitempty"`
+	PageID       string              `bson:"page_id" json:"page_id"`                               // The page they're messaging
+	PageName     string              `bson:"page_name" json:"page_name"`                           // Page name for reference
+	CompanyID    string              `bson:"company_id" json:"company_id"`                         // Company that owns the page
+	MessageCount int                 `bson:"message_count" json:"message_count"`                   // Total messages sent
+	LastMessage  string              `bson:"last_message,omitempty" json:"last_message,omitempty"` // Last message text
+	LastSeen     time.Time           `bson:"last_seen" json:"last_seen"`                           // Last interaction time
+	FirstSeen    time.Time           `bson:"first_seen" json:"first_seen"`                         // First interaction time
+	Stop         bool                `bson:"stop" json:"stop"`                                     // Whether customer wants to talk to real person
+	StoppedAt    *time.Time          `bson:"stopped_at,omitempty" json:"stopped_at,omitempty"`     // When customer requested real person
+	IsAssigned   bool                `bson:"is_assigned" json:"is_assigned"`                       // Whether an agent is currently assigned
+	AgentName    string              `bson:"agent_name,omitempty" json:"agent_name,omitempty"`     // Name of the agent handling the customer
+	AgentID      string              `bson:"agent_id,omitempty" json:"agent_id,omitempty"`         // ID of the agent currently handling
+	AgentEmail   string              `bson:"agent_email,omitempty" json:"agent_email,omitempty"`   // Email of the agent currently handling
+	AssignedAt   *time.Time          `bson:"assigned_at,omitempty" json:"assigned_at,omitempty"`   // When agent was assigned
+	Lead         *Lead               `bson:"lead,omitempty" json:"lead,omitempty"`                 // Contact and qualification data captured from conversations
+	Memory       *ConversationMemory `bson:"memory,omitempty" json:"memory,omitempty"`             // Rolling summary of earlier conversations
+	Sentiment    *SentimentTrend     `bson:"sentiment,omitempty" json:"sentiment,omitempty"`       // Sentiment trend across the customer's messages
+	CreatedAt    time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time           `bson:"updated_at" json:"updated_at"`
+
+	// Hand-back from human agents to the bot
+	AgentActiveAt  *time.Time `bson:"agent_active_at,omitempty" json:"agent_active_at,omitempty"`   // Last message an agent sent to the customer
+	HandedBackAt   *time.Time `bson:"handed_back_at,omitempty" json:"handed_back_at,omitempty"`     // When the conversation last returned to the bot
+	HandBackReason string     `bson:"hand_back_reason,omitempty" json:"hand_back_reason,omitempty"` // Why the conversation last returned to the bot
+}
+
+// ConversationMemory is a rolling summary of a customer's earlier conversations.
+// The bot refreshes it in the background every few messages and agents can edit it in the dashboard.
+type ConversationMemory struct {
+	Summary      string    `bson:"summary" json:"summary"`
+	MessageCount int       `bson:"message_count" json:"message_count"`   // Customer message count when the summary was last refreshed
+	CoveredUntil time.Time `bson:"covered_until" json:"covered_until"`   // Timestamp of the newest message folded into the summary
+	EditedBy     string    `bson:"edited_by,omitempty" json:"edited_by"` // Email of the agent who last edited it, empty if written by the bot
+	UpdatedAt    time.Time `bson:"updated_at" json:"updated_at"`
 }
 
 // CustomerPage represents the relationship between a customer and multiple pages
@@ -0,0 +1,29 @@
+package models
+
+// EmbeddingProviderMock selects mock embeddings. They carry no meaning, so search falls back to keyword
+// matching; only for demos and tests without an embedding API key.
+const EmbeddingProviderMock = "mock"
+
+// EmbeddingProviders returns the providers a page can embed its knowledge base with
+func EmbeddingProviders() []string {
+	return []string{UsageProviderOpenAI, UsageProviderVoyage, UsageProviderCohere, EmbeddingProviderMock}
+}
+
+// IsValidEmbeddingProvider checks if a page can select an embedding provider
+func IsValidEmbeddingProvider(provider string) bool {
+	for _, valid := range EmbeddingProviders() {
+		if provider == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// EmbeddingModelStats is the number of a page's active documents embedded with one model
+type EmbeddingModelStats struct {
+	Provider  string `bson:"provider" json:"provider"`   // Empty for documents stored before models were recorded
+	Model     string `bson:"model" json:"model"`         // Empty for documents stored before models were recorded
+	Dimension int    `bson:"dimension" json:"dimension"` // Vector length
+	Documents int64  `bson:"documents" json:"documents"`
+	Current   bool   `bson:"-" json:"current"` // Embedded with the page's current embedding model
+}
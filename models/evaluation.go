@@ -0,0 +1,167 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Evaluation run statuses
+const (
+	EvalStatusRunning   = "running"
+	EvalStatusCompleted = "completed"
+	EvalStatusFailed    = "failed"
+)
+
+// How a case changed between two evaluation runs
+const (
+	EvalChangeImproved  = "improved"  // Failed in the base run, passed in the candidate
+	EvalChangeRegressed = "regressed" // Passed in the base run, failed in the candidate
+	EvalChangeUnchanged = "unchanged"
+	EvalChangeAdded     = "added"   // Only in the candidate run
+	EvalChangeRemoved   = "removed" // Only in the base run
+)
+
+// MaxEvalCases limits the size of an evaluation set, every case costs a model call
+const MaxEvalCases = 200
+
+// EvalSet is a page's golden set of questions, used to check prompt, model and
+// knowledge base changes offline before customers see them
+type EvalSet struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID   string             `bson:"company_id" json:"company_id"`
+	PageID      string             `bson:"page_id" json:"page_id"`
+	Name        string             `bson:"name" json:"name"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	Channel     string             `bson:"channel" json:"channel"` // messenger or facebook, decides the retrieval channel and message type
+	Cases       []EvalCase         `bson:"cases" json:"cases"`
+	CreatedBy   string             `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// EvalCase is one question with what a good reply looks like
+type EvalCase struct {
+	ID             string   `bson:"id" json:"id"` // Stable within the set, used to compare runs
+	Question       string   `bson:"question" json:"question"`
+	ExpectedFacts  []string `bson:"expected_facts,omitempty" json:"expected_facts,omitempty"` // Facts the reply must mention, e.g. a price or opening hours
+	ShouldEscalate bool     `bson:"should_escalate" json:"should_escalate"`                   // The bot should hand this question to a human
+	Language       string   `bson:"language,omitempty" json:"language,omitempty"`             // Expected reply language, detected from the question when empty
+}
+
+// EvalOverrides change the page configuration for one run without saving it
+type EvalOverrides struct {
+	Model            string  `bson:"model,omitempty" json:"model,omitempty"`
+	MaxTokens        int     `bson:"max_tokens,omitempty" json:"max_tokens,omitempty"`
+	SystemPrompt     *string `bson:"system_prompt,omitempty" json:"system_prompt,omitempty"`           // Replaces the channel's custom prompt
+	PromptTemplateID string  `bson:"prompt_template_id,omitempty" json:"prompt_template_id,omitempty"` // Draft prompt template version to use instead of the published one
+}
+
+// EvalConfig records the configuration a run was made with
+type EvalConfig struct {
+	Model         string `bson:"model" json:"model"`
+	MaxTokens     int    `bson:"max_tokens" json:"max_tokens"`
+	PromptVersion string `bson:"prompt_version,omitempty" json:"prompt_version,omitempty"`
+	Channel       string `bson:"channel" json:"channel"`
+	RAGEnabled    bool   `bson:"rag_enabled" json:"rag_enabled"`
+}
+
+// EvalRun is one execution of an evaluation set
+type EvalRun struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SetID      primitive.ObjectID `bson:"set_id" json:"set_id"`
+	SetName    string             `bson:"set_name" json:"set_name"`
+	CompanyID  string             `bson:"company_id" json:"company_id"`
+	PageID     string             `bson:"page_id" json:"page_id"`
+	Label      string             `bson:"label,omitempty" json:"label,omitempty"` // Free text to tell runs apart, e.g. "haiku + new prompt"
+	Status     string             `bson:"status" json:"status"`
+	Overrides  EvalOverrides      `bson:"overrides" json:"overrides"`
+	Config     EvalConfig         `bson:"config" json:"config"`
+	Results    []EvalResult       `bson:"results" json:"results,omitempty"`
+	Summary    EvalSummary        `bson:"summary" json:"summary"`
+	Error      string             `bson:"error,omitempty" json:"error,omitempty"`
+	StartedBy  string             `bson:"started_by,omitempty" json:"started_by,omitempty"`
+	StartedAt  time.Time          `bson:"started_at" json:"started_at"`
+	FinishedAt *time.Time         `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// EvalResult is the outcome of one case in a run
+type EvalResult struct {
+	CaseID           string               `bson:"case_id" json:"case_id"`
+	Question         string               `bson:"question" json:"question"`
+	Reply            string               `bson:"reply" json:"reply"`
+	Passed           bool                 `bson:"passed" json:"passed"`
+	Error            string               `bson:"error,omitempty" json:"error,omitempty"`
+	FactsFound       []string             `bson:"facts_found,omitempty" json:"facts_found,omitempty"`
+	FactsMissing     []string             `bson:"facts_missing,omitempty" json:"facts_missing,omitempty"`
+	FactScore        float64              `bson:"fact_score" json:"fact_score"` // 0-1 share of expected facts in the reply
+	ShouldEscalate   bool                 `bson:"should_escalate" json:"should_escalate"`
+	Escalated        bool                 `bson:"escalated" json:"escalated"`
+	EscalationReason string               `bson:"escalation_reason,omitempty" json:"escalation_reason,omitempty"`
+	ExpectedLanguage string               `bson:"expected_language" json:"expected_language"`
+	ReplyLanguage    string               `bson:"reply_language,omitempty" json:"reply_language,omitempty"` // Empty when the reply is too short to detect
+	LanguageMatch    bool                 `bson:"language_match" json:"language_match"`
+	Answerability    string               `bson:"answerability,omitempty" json:"answerability,omitempty"`
+	Retrieval        *RetrievalConfidence `bson:"retrieval,omitempty" json:"retrieval,omitempty"`
+	Tier             string               `bson:"tier,omitempty" json:"tier,omitempty"`
+	Model            string               `bson:"model,omitempty" json:"model,omitempty"`
+	LatencyMs        int64                `bson:"latency_ms" json:"latency_ms"` // Retrieval and generation
+	InputTokens      int                  `bson:"input_tokens" json:"input_tokens"`
+	OutputTokens     int                  `bson:"output_tokens" json:"output_tokens"`
+	Cost             float64              `bson:"cost" json:"cost"` // USD
+}
+
+// EvalSummary aggregates the results of a run
+type EvalSummary struct {
+	Cases              int     `bson:"cases" json:"cases"`
+	Passed             int     `bson:"passed" json:"passed"`
+	Errors             int     `bson:"errors" json:"errors"`
+	PassRate           float64 `bson:"pass_rate" json:"pass_rate"`
+	FactScore          float64 `bson:"fact_score" json:"fact_score"` // Average over cases with expected facts that should not escalate
+	EscalationAccuracy float64 `bson:"escalation_accuracy" json:"escalation_accuracy"`
+	LanguageMatchRate  float64 `bson:"language_match_rate" json:"language_match_rate"`
+	AvgLatencyMs       int64   `bson:"avg_latency_ms" json:"avg_latency_ms"`
+	P95LatencyMs       int64   `bson:"p95_latency_ms" json:"p95_latency_ms"`
+	InputTokens        int     `bson:"input_tokens" json:"input_tokens"`
+	OutputTokens       int     `bson:"output_tokens" json:"output_tokens"`
+	TotalCost          float64 `bson:"total_cost" json:"total_cost"` // USD
+}
+
+// EvalComparison puts two runs of the same set side by side
+type EvalComparison struct {
+	Base      EvalRunInfo          `json:"base"`
+	Candidate EvalRunInfo          `json:"candidate"`
+	Delta     EvalSummaryDelta     `json:"delta"` // Candidate minus base
+	Cases     []EvalCaseComparison `json:"cases"`
+}
+
+// EvalRunInfo describes a run without its results
+type EvalRunInfo struct {
+	ID        primitive.ObjectID `json:"id"`
+	Label     string             `json:"label,omitempty"`
+	Config    EvalConfig         `json:"config"`
+	Summary   EvalSummary        `json:"summary"`
+	StartedAt time.Time          `json:"started_at"`
+}
+
+// EvalSummaryDelta is the change of the summary metrics between two runs
+type EvalSummaryDelta struct {
+	PassRate           float64 `json:"pass_rate"`
+	FactScore          float64 `json:"fact_score"`
+	EscalationAccuracy float64 `json:"escalation_accuracy"`
+	LanguageMatchRate  float64 `json:"language_match_rate"`
+	AvgLatencyMs       int64   `json:"avg_latency_ms"`
+	P95LatencyMs       int64   `json:"p95_latency_ms"`
+	TotalCost          float64 `json:"total_cost"`
+	Improved           int     `json:"improved"`
+	Regressed          int     `json:"regressed"`
+}
+
+// EvalCaseComparison is one case's result in both runs
+type EvalCaseComparison struct {
+	CaseID    string      `json:"case_id"`
+	Question  string      `json:"question"`
+	Change    string      `json:"change"`
+	Base      *EvalResult `json:"base,omitempty"`
+	Candidate *EvalResult `json:"candidate,omitempty"`
+}
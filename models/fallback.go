@@ -0,0 +1,27 @@
+package models
+
+// Reply tiers record which step of a page's fallback chain served a reply
+const (
+	ReplyTierPrimary   = "primary"   // The page's configured Claude model
+	ReplyTierFallback  = "fallback"  // Another model of the same provider, usually cheaper
+	ReplyTierAlternate = "alternate" // A model of another provider
+	ReplyTierHuman     = "human"     // No model could answer, the customer was handed to a human
+)
+
+// FallbackModel is a model tried when the models before it in a page's fallback chain fail
+type FallbackModel struct {
+	Provider string `bson:"provider" json:"provider"` // "anthropic" or "openai"
+	Model    string `bson:"model" json:"model"`
+}
+
+// IsValidFallbackProvider checks if a provider can serve replies
+func IsValidFallbackProvider(provider string) bool {
+	return provider == UsageProviderAnthropic || provider == UsageProviderOpenAI
+}
+
+// ReplyTierSummary is the number of replies served by a tier and model
+type ReplyTierSummary struct {
+	Tier    string `bson:"tier" json:"tier"`
+	Model   string `bson:"model" json:"model"`
+	Replies int64  `bson:"replies" json:"replies"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Guardrail violation types
+const (
+	GuardrailViolationPII        = "pii"         // Phone number, email or ID number in a public reply
+	GuardrailViolationLink       = "link"        // Link to a host that is not on the page allowlist
+	GuardrailViolationPromptLeak = "prompt_leak" // Reply repeats the system prompt
+	GuardrailViolationSecret     = "secret"      // Reply contains an API key or token
+)
+
+// Actions taken for a guarded reply
+const (
+	GuardrailActionRedacted    = "redacted"    // Offending text was removed and the reply was sent
+	GuardrailActionRegenerated = "regenerated" // Reply was blocked and generated again
+	GuardrailActionEscalated   = "escalated"   // Reply was blocked and the conversation was handed to a human
+)
+
+// Page settings for replies that fail a blocking guardrail
+const (
+	GuardrailOnBlockRegenerate = "regenerate" // Generate a new reply once, escalate if it fails again
+	GuardrailOnBlockEscalate   = "escalate"   // Hand the conversation to a human straight away
+)
+
+// GuardrailViolation records a reply that failed an output guardrail
+type GuardrailViolation struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID  string             `bson:"company_id" json:"company_id"`
+	PageID     string             `bson:"page_id" json:"page_id"`
+	CustomerID string             `bson:"customer_id,omitempty" json:"customer_id,omitempty"`
+	Channel    string             `bson:"channel" json:"channel"` // facebook or messenger
+	Type       string             `bson:"type" json:"type"`
+	Action     string             `bson:"action" json:"action"`
+	Detail     string             `bson:"detail,omitempty" json:"detail,omitempty"` // What matched, with secrets masked
+	Attempt    int                `bson:"attempt" json:"attempt"`                   // 1 for the first reply, 2 for a regenerated one
+	Original   string             `bson:"original" json:"original"`                 // Reply as generated, with secrets masked
+	Timestamp  time.Time          `bson:"timestamp" json:"timestamp"`
+}
+
+// IsValidGuardrailOnBlock checks if a blocked-reply setting is valid
+func IsValidGuardrailOnBlock(action string) bool {
+	return action == GuardrailOnBlockRegenerate || action == GuardrailOnBlockEscalate
+}
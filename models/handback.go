@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Reasons a conversation is handed back from a human agent to the bot
+const (
+	HandBackReasonInactivity = "agent_inactive"         // No agent activity for the configured time
+	HandBackReasonAfterHours = "outside_business_hours" // Business hours ended while the customer waited
+	HandBackReasonResolved   = "resolved"               // The agent marked the conversation resolved
+)
+
+// DefaultBusinessTimezone is used when business hours do not name a timezone
+const DefaultBusinessTimezone = "Asia/Tbilisi"
+
+// HandBackPolicy returns customers from human mode to the bot so conversations do not stall
+type HandBackPolicy struct {
+	Enabled              bool           `bson:"enabled" json:"enabled"`
+	InactivityMinutes    int            `bson:"inactivity_minutes" json:"inactivity_minutes"`         // Minutes without agent activity before hand-back, 0 disables
+	OutsideBusinessHours bool           `bson:"outside_business_hours" json:"outside_business_hours"` // Hand back when business hours end
+	BusinessHours        *BusinessHours `bson:"business_hours,omitempty" json:"business_hours,omitempty"`
+	OnResolved           bool           `bson:"on_resolved" json:"on_resolved"`                                   // Hand back when the agent marks the conversation resolved
+	TransitionMessage    string         `bson:"transition_message,omitempty" json:"transition_message,omitempty"` // Sent to the customer on hand-back, nothing is sent when empty
+}
+
+// BusinessHours are the weekly opening hours of a page's support team
+type BusinessHours struct {
+	Timezone string        `bson:"timezone,omitempty" json:"timezone,omitempty"` // IANA timezone, defaults to Asia/Tbilisi
+	Days     []BusinessDay `bson:"days" json:"days"`
+}
+
+// BusinessDay is the opening time of one weekday, e.g. {"weekday": 1, "open": "09:00", "close": "18:00"}
+type BusinessDay struct {
+	Weekday time.Weekday `bson:"weekday" json:"weekday"` // 0 is Sunday
+	Open    string       `bson:"open" json:"open"`       // HH:MM
+	Close   string       `bson:"close" json:"close"`     // HH:MM, after Open
+}
@@ -0,0 +1,15 @@
+package models
+
+// Default weights of the rankings fused into knowledge base results
+const (
+	DefaultHybridVectorWeight  = 1.0
+	DefaultHybridLexicalWeight = 1.0
+)
+
+// HybridSearch weighs the two rankings knowledge base search fuses: documents ranked by similarity to
+// the query embedding and by BM25 keyword relevance. Raise the lexical weight for catalogs searched by
+// product codes and exact names; a weight of 0 leaves that ranking out.
+type HybridSearch struct {
+	VectorWeight  float64 `bson:"vector_weight" json:"vector_weight"`
+	LexicalWeight float64 `bson:"lexical_weight" json:"lexical_weight"`
+}
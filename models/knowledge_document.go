@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Knowledge document version statuses
+const (
+	KnowledgeVersionProcessing = "processing" // Chunks are being embedded, the active version is still searched
+	KnowledgeVersionActive     = "active"     // Its chunks are the ones searched
+	KnowledgeVersionSuperseded = "superseded" // Replaced by a newer version, kept for rollback
+	KnowledgeVersionFailed     = "failed"     // Not all chunks could be embedded, the active version was kept
+)
+
+// KnowledgeDocument is a file uploaded to a page's knowledge base. Uploading a file with the same name
+// adds a version of it; the chunks of the active version are the documents search uses, and they are
+// only replaced once all chunks of a new version are embedded.
+type KnowledgeDocument struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID     string             `bson:"company_id" json:"company_id"`
+	PageID        string             `bson:"page_id" json:"page_id"`
+	Filename      string             `bson:"filename" json:"filename"`
+	Source        string             `bson:"source" json:"source"`
+	ActiveVersion int                `bson:"active_version" json:"active_version"` // 0 until the first version is embedded
+	LatestVersion int                `bson:"latest_version" json:"latest_version"`
+	CreatedBy     string             `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// KnowledgeDocumentVersion is one upload of a knowledge document, or a rollback to an earlier one
+type KnowledgeDocumentVersion struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	DocumentID   primitive.ObjectID `bson:"document_id" json:"document_id"`
+	CompanyID    string             `bson:"company_id" json:"company_id"`
+	PageID       string             `bson:"page_id" json:"page_id"`
+	Version      int                `bson:"version" json:"version"`
+	Status       string             `bson:"status" json:"status"`
+	RestoredFrom int                `bson:"restored_from,omitempty" json:"restored_from,omitempty"` // Version whose chunks a rollback restored
+	Source       string             `bson:"source" json:"source"`
+	Channels     []string           `bson:"channels" json:"channels"`
+	Metadata     map[string]string  `bson:"metadata,omitempty" json:"metadata,omitempty"` // Stored with every chunk, e.g. the extraction report
+	ContentHash  string             `bson:"content_hash" json:"content_hash"`             // sha256 hex of the chunks, equal for identical versions
+	Characters   int                `bson:"characters" json:"characters"`
+	Chunks       int                `bson:"chunks" json:"chunks"`
+	Embedded     int                `bson:"embedded" json:"embedded"` // Chunks embedded so far
+	Reused       int                `bson:"reused" json:"reused"`     // Chunks whose vectors were taken from earlier versions instead
+	Diff         *KnowledgeDiff     `bson:"diff,omitempty" json:"diff,omitempty"`
+	Error        string             `bson:"error,omitempty" json:"error,omitempty"`
+	Pruned       bool               `bson:"pruned,omitempty" json:"pruned,omitempty"` // Its chunks were deleted, it can no longer be restored
+	UploadedBy   string             `bson:"uploaded_by,omitempty" json:"uploaded_by,omitempty"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	HeartbeatAt  time.Time          `bson:"heartbeat_at" json:"heartbeat_at"` // Refreshed while chunks are embedded, a stale one was interrupted
+	ActivatedAt  *time.Time         `bson:"activated_at,omitempty" json:"activated_at,omitempty"`
+	FinishedAt   *time.Time         `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// KnowledgeDiff compares a version's chunks with the version that was active when it was added
+type KnowledgeDiff struct {
+	BaseVersion      int `bson:"base_version" json:"base_version"` // 0 for a document's first version
+	ChunksAdded      int `bson:"chunks_added" json:"chunks_added"`
+	ChunksRemoved    int `bson:"chunks_removed" json:"chunks_removed"`
+	ChunksUnchanged  int `bson:"chunks_unchanged" json:"chunks_unchanged"`
+	CharactersBefore int `bson:"characters_before" json:"characters_before"`
+	CharactersAfter  int `bson:"characters_after" json:"characters_after"`
+}
+
+// KnowledgeChunk is a chunk of one version of a knowledge document with its vector. The chunks of the
+// active version are also stored as vector documents for search.
+type KnowledgeChunk struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	DocumentID        primitive.ObjectID `bson:"document_id" json:"document_id"`
+	Version           int                `bson:"version" json:"version"`
+	Index             int                `bson:"index" json:"index"`
+	Content           string             `bson:"content" json:"content"`
+	ContentHash       string             `bson:"content_hash" json:"content_hash"`
+	Metadata          map[string]string  `bson:"metadata" json:"metadata"` // What the chunker found, e.g. its heading path
+	Embedding         []float32          `bson:"embedding" json:"-"`
+	EmbeddingProvider string             `bson:"embedding_provider" json:"embedding_provider"`
+	EmbeddingModel    string             `bson:"embedding_model" json:"embedding_model"`
+}
@@ -0,0 +1,35 @@
+package models
+
+// Supported languages (ISO 639-1 codes)
+const (
+	LanguageGeorgian  = "ka"
+	LanguageEnglish   = "en"
+	LanguageRussian   = "ru"
+	LanguageUkrainian = "uk"
+	LanguageTurkish   = "tr"
+)
+
+// languageNames are the English names used in prompts
+var languageNames = map[string]string{
+	LanguageGeorgian:  "Georgian",
+	LanguageEnglish:   "English",
+	LanguageRussian:   "Russian",
+	LanguageUkrainian: "Ukrainian",
+	LanguageTurkish:   "Turkish",
+}
+
+// SupportedLanguages returns the codes of all supported languages
+func SupportedLanguages() []string {
+	return []string{LanguageGeorgian, LanguageEnglish, LanguageRussian, LanguageUkrainian, LanguageTurkish}
+}
+
+// IsSupportedLanguage checks if a language code is supported
+func IsSupportedLanguage(code string) bool {
+	_, ok := languageNames[code]
+	return ok
+}
+
+// LanguageName returns the English name of a language, or "" if it is not supported
+func LanguageName(code string) string {
+	return languageNames[code]
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// Lead qualification stages, ordered from least to most qualified
+const (
+	LeadStageNew         = "new"          // Contact details only, no stated need yet
+	LeadStageInterested  = "interested"   // Customer described what they are looking for
+	LeadStageQualified   = "qualified"    // Budget and requirements are known
+	LeadStageReadyToBuy  = "ready_to_buy" // Customer asked for a viewing, reservation or purchase
+	LeadStageUnqualified = "unqualified"  // Not a real prospect (spam, wrong audience, etc.)
+)
+
+// Lead holds structured contact and qualification data captured from a conversation
+type Lead struct {
+	Phone              string            `bson:"phone,omitempty" json:"phone,omitempty"`
+	Email              string            `bson:"email,omitempty" json:"email,omitempty"`
+	Budget             string            `bson:"budget,omitempty" json:"budget,omitempty"`           // Free text as stated by the customer, e.g. "120 000$"
+	Preferences        string            `bson:"preferences,omitempty" json:"preferences,omitempty"` // What the customer is looking for
+	QualificationStage string            `bson:"qualification_stage,omitempty" json:"qualification_stage,omitempty"`
+	Attributes         map[string]string `bson:"attributes,omitempty" json:"attributes,omitempty"`         // Custom attributes such as rooms or location
+	SourceMessage      string            `bson:"source_message,omitempty" json:"source_message,omitempty"` // Message the latest data was extracted from
+	CapturedAt         time.Time         `bson:"captured_at" json:"captured_at"`                           // When the lead was first captured
+	UpdatedAt          time.Time         `bson:"updated_at" json:"updated_at"`
+}
+
+// IsValidLeadStage checks if a qualification stage is valid
+func IsValidLeadStage(stage string) bool {
+	switch stage {
+	case LeadStageNew, LeadStageInterested, LeadStageQualified, LeadStageReadyToBuy, LeadStageUnqualified:
+		return true
+	}
+	return false
+}
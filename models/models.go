@@ -19,6 +19,8 @@ type Message struct {
 	PageID        string                 `bson:"page_id" json:"page_id"`
 	PageName      string                 `bson:"page_name" json:"page_name"`
 	Message       string                 `bson:"message" json:"message"`
+	Language      string                 `bson:"language,omitempty" json:"language,omitempty"`             // Detected language of customer messages
+	Sentiment     *MessageSentiment      `bson:"sentiment,omitempty" json:"sentiment,omitempty"`           // Sentiment and urgency of customer messages
 	ProcessedData map[string]interface{} `bson:"processed_data,omitempty" json:"processed_data,omitempty"` // For CRM data processing results
 	IsBot         bool                   `bson:"is_bot" json:"is_bot"`                                     // true if message is from bot
 	IsHuman       bool                   `bson:"is_human" json:"is_human"`                                 // true if message is from human agent via dashboard
@@ -26,6 +28,7 @@ type Message struct {
 	AgentID       string                 `bson:"agent_id,omitempty" json:"agent_id,omitempty"`             // ID of human agent who sent the message
 	AgentEmail    string                 `bson:"agent_email,omitempty" json:"agent_email,omitempty"`       // Email of human agent
 	AgentName     string                 `bson:"agent_name,omitempty" json:"agent_name,omitempty"`         // Name of human agent
+	SuggestionID  string                 `bson:"suggestion_id,omitempty" json:"suggestion_id,omitempty"`   // Reply suggestion the agent started from
 	Timestamp     time.Time              `bson:"timestamp" json:"timestamp"`
 	UpdatedAt     time.Time              `bson:"updated_at,omitempty" json:"updated_at,omitempty"` // Last update time
 }
@@ -43,6 +46,7 @@ type Comment struct {
 	PageID      string             `bson:"page_id" json:"page_id"`
 	PageName    string             `bson:"page_name" json:"page_name"`
 	Message     string             `bson:"message" json:"message"`
+	Language    string             `bson:"language,omitempty" json:"language,omitempty"` // Detected language of customer comments
 	PostContent string             `bson:"post_content,omitempty" json:"post_content,omitempty"`
 	IsReply     bool               `bson:"is_reply" json:"is_reply"`                   // True if this is a reply
 	IsBot       bool               `bson:"is_bot" json:"is_bot"`                       // True if this comment is from the bot
@@ -64,6 +68,12 @@ type Response struct {
 	Original   string             `bson:"original" json:"original"`
 	Response   string             `bson:"response" json:"response"`
 	Timestamp  time.Time          `bson:"timestamp" json:"timestamp"`
+
+	PromptVersion string `bson:"prompt_version,omitempty" json:"prompt_version,omitempty"` // Prompt template layers and versions used, e.g. "base@1,vertical:store@2,page@3"
+
+	CompanyID string `bson:"company_id,omitempty" json:"company_id,omitempty"`
+	Tier      string `bson:"tier,omitempty" json:"tier,omitempty"`   // Fallback chain tier that served the reply, e.g. "primary"
+	Model     string `bson:"model,omitempty" json:"model,omitempty"` // Model that generated the reply
 }
 
 // PageCache represents cached page information
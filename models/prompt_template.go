@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Prompt template keys identify which prompt a template renders
+const (
+	PromptKeyReplySystem = "reply_system" // System prompt for bot replies to messages and comments
+)
+
+// Prompt layers, applied in this order. Later layers override blocks defined by earlier ones
+// using {{define "name"}}...{{end}}, or replace the whole prompt if they contain other text.
+const (
+	PromptLayerBase     = "base"
+	PromptLayerVertical = "vertical"
+	PromptLayerPage     = "page"
+)
+
+// Business verticals with their own prompt layer
+const (
+	VerticalStore      = "store"
+	VerticalRealEstate = "real_estate"
+)
+
+// Prompt template statuses
+const (
+	PromptStatusDraft     = "draft"
+	PromptStatusPublished = "published" // At most one published version per key, layer and scope
+	PromptStatusArchived  = "archived"  // Previously published, can be restored with a rollback
+)
+
+// PromptTemplate is a versioned text/template prompt layer
+type PromptTemplate struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Key         string             `bson:"key" json:"key"`
+	Layer       string             `bson:"layer" json:"layer"`
+	Vertical    string             `bson:"vertical,omitempty" json:"vertical,omitempty"` // Vertical layer only
+	CompanyID   string             `bson:"company_id" json:"company_id,omitempty"`       // Empty for built-in layers shared by all companies
+	PageID      string             `bson:"page_id,omitempty" json:"page_id,omitempty"`   // Page layer only
+	Version     int                `bson:"version" json:"version"`
+	Status      string             `bson:"status" json:"status"`
+	Content     string             `bson:"content" json:"content"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	CreatedBy   string             `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	PublishedAt *time.Time         `bson:"published_at,omitempty" json:"published_at,omitempty"`
+}
+
+// IsValidPromptKey checks if a prompt key is known
+func IsValidPromptKey(key string) bool {
+	return key == PromptKeyReplySystem
+}
+
+// IsValidPromptLayer checks if a prompt layer is valid
+func IsValidPromptLayer(layer string) bool {
+	switch layer {
+	case PromptLayerBase, PromptLayerVertical, PromptLayerPage:
+		return true
+	}
+	return false
+}
+
+// IsValidVertical checks if a business vertical is valid
+func IsValidVertical(vertical string) bool {
+	return vertical == VerticalStore || vertical == VerticalRealEstate
+}
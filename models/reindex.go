@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Re-embedding job statuses
+const (
+	ReindexStatusRunning   = "running"
+	ReindexStatusCompleted = "completed"
+	ReindexStatusFailed    = "failed"
+	ReindexStatusCancelled = "cancelled"
+)
+
+// ReindexJob re-embeds every document of a page with one embedding model. New vectors are staged
+// next to the current ones and swapped in together once all are embedded, so search keeps using
+// the old model until then.
+type ReindexJob struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID         string             `bson:"company_id" json:"company_id"`
+	PageID            string             `bson:"page_id" json:"page_id"`
+	EmbeddingProvider string             `bson:"embedding_provider" json:"embedding_provider"`                   // Provider the documents are embedded with
+	EmbeddingModel    string             `bson:"embedding_model" json:"embedding_model"`                         // Model the documents are embedded with
+	PreviousProvider  string             `bson:"previous_provider,omitempty" json:"previous_provider,omitempty"` // The page's provider when the job started
+	PreviousModel     string             `bson:"previous_model,omitempty" json:"previous_model,omitempty"`       // The page's model when the job started
+	Status            string             `bson:"status" json:"status"`
+	Total             int64              `bson:"total" json:"total"`         // Documents of the page
+	Processed         int64              `bson:"processed" json:"processed"` // Documents embedded with the new model, or failed
+	Failed            int64              `bson:"failed" json:"failed"`       // Documents that could not be embedded and keep their old vector
+	Batches           int                `bson:"batches" json:"batches"`
+	Swapped           int64              `bson:"swapped" json:"swapped"`                           // New vectors swapped in
+	SwappedAt         *time.Time         `bson:"swapped_at,omitempty" json:"swapped_at,omitempty"` // When the page switched to the new model
+	CancelRequested   bool               `bson:"cancel_requested,omitempty" json:"cancel_requested,omitempty"`
+	Error             string             `bson:"error,omitempty" json:"error,omitempty"`
+	StartedBy         string             `bson:"started_by,omitempty" json:"started_by,omitempty"`
+	StartedAt         time.Time          `bson:"started_at" json:"started_at"`
+	HeartbeatAt       time.Time          `bson:"heartbeat_at" json:"heartbeat_at"` // Refreshed while an instance works on the job, a stale one is resumed
+	FinishedAt        *time.Time         `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
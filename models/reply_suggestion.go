@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Outcomes of a reply suggestion shown to an agent
+const (
+	SuggestionStatusPending  = "pending"  // Not used yet
+	SuggestionStatusAccepted = "accepted" // A draft was sent unchanged
+	SuggestionStatusEdited   = "edited"   // A draft was edited before sending
+	SuggestionStatusRejected = "rejected" // The agent sent their own reply instead
+)
+
+// ReplySuggestion is a set of draft replies generated for a human agent. Nothing is sent
+// to the customer; the agent edits a draft and sends it through the normal send path.
+type ReplySuggestion struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID       string             `bson:"company_id" json:"company_id"`
+	PageID          string             `bson:"page_id" json:"page_id"`
+	CustomerID      string             `bson:"customer_id" json:"customer_id"`
+	AgentID         string             `bson:"agent_id,omitempty" json:"agent_id,omitempty"`
+	AgentEmail      string             `bson:"agent_email,omitempty" json:"agent_email,omitempty"`
+	CustomerMessage string             `bson:"customer_message" json:"customer_message"` // Latest customer message the drafts answer
+	Drafts          []SuggestedDraft   `bson:"drafts" json:"drafts"`
+	Snippets        []KnowledgeSnippet `bson:"snippets" json:"snippets"` // Knowledge base excerpts given to the model
+	Tier            string             `bson:"tier,omitempty" json:"tier,omitempty"`
+	Model           string             `bson:"model,omitempty" json:"model,omitempty"`
+	Status          string             `bson:"status" json:"status"`
+	DraftIndex      int                `bson:"draft_index" json:"draft_index"`                       // Draft closest to the sent message, -1 when none was used
+	SentMessage     string             `bson:"sent_message,omitempty" json:"sent_message,omitempty"` // What the agent actually sent
+	Similarity      float64            `bson:"similarity,omitempty" json:"similarity,omitempty"`     // 0-1 overlap of the sent message with the closest draft
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+	ResolvedAt      *time.Time         `bson:"resolved_at,omitempty" json:"resolved_at,omitempty"`
+}
+
+// SuggestedDraft is one draft reply and the knowledge snippets it is based on
+type SuggestedDraft struct {
+	Text     string `bson:"text" json:"text"`
+	Snippets []int  `bson:"snippets" json:"snippets"` // Indexes into ReplySuggestion.Snippets
+}
+
+// KnowledgeSnippet is a knowledge base excerpt used to draft replies
+type KnowledgeSnippet struct {
+	Source   string            `bson:"source" json:"source"`
+	Content  string            `bson:"content" json:"content"`
+	Score    float32           `bson:"score" json:"score"`
+	Metadata map[string]string `bson:"metadata,omitempty" json:"metadata,omitempty"`
+}
+
+// ReplySuggestionStats counts how agents used reply suggestions
+type ReplySuggestionStats struct {
+	Total          int64   `json:"total"`
+	Pending        int64   `json:"pending"`
+	Accepted       int64   `json:"accepted"`
+	Edited         int64   `json:"edited"`
+	Rejected       int64   `json:"rejected"`
+	AcceptanceRate float64 `json:"acceptance_rate"` // Share of resolved suggestions sent as is or edited
+	AvgSimilarity  float64 `json:"avg_similarity"`  // Average overlap of edited drafts with what was sent
+}
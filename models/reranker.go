@@ -0,0 +1,48 @@
+package models
+
+// Reranker providers. Voyage and Cohere use the page's API key of that provider; the local scorer
+// needs none.
+const (
+	RerankerProviderVoyage = UsageProviderVoyage
+	RerankerProviderCohere = UsageProviderCohere
+	RerankerProviderLocal  = "local"
+)
+
+// Defaults and limits of the rerank stage
+const (
+	DefaultRerankCandidates = 50  // Retrieved chunks re-scored
+	DefaultRerankTopN       = 5   // Chunks kept for the reply context
+	MaxRerankCandidates     = 200 // Providers bill and slow down with every document sent
+)
+
+// RerankerConfig re-scores a wider set of retrieved knowledge base chunks against the question before
+// the best ones are put in the reply context. Retrieval ranks each chunk by itself; a reranker reads the
+// question and the chunk together, which keeps loosely related CRM records out of the context.
+type RerankerConfig struct {
+	Enabled    bool    `bson:"enabled" json:"enabled"`
+	Provider   string  `bson:"provider" json:"provider"`                         // voyage, cohere or local
+	Model      string  `bson:"model,omitempty" json:"model,omitempty"`           // Provider's default when empty
+	Candidates int     `bson:"candidates,omitempty" json:"candidates,omitempty"` // Chunks retrieved for reranking, 50 when 0
+	TopN       int     `bson:"top_n,omitempty" json:"top_n,omitempty"`           // Chunks kept for the context, 5 when 0
+	MinScore   float64 `bson:"min_score,omitempty" json:"min_score,omitempty"`   // Chunks the reranker scores lower are dropped, 0 keeps all
+}
+
+// RerankStats describes the rerank stage of one retrieval
+type RerankStats struct {
+	Provider   string  `bson:"provider" json:"provider"`
+	Model      string  `bson:"model" json:"model"`
+	Candidates int     `bson:"candidates" json:"candidates"` // Chunks re-scored
+	Kept       int     `bson:"kept" json:"kept"`             // Chunks put in the context
+	LatencyMs  int64   `bson:"latency_ms" json:"latency_ms"`
+	Cost       float64 `bson:"cost" json:"cost"`                       // USD, also recorded as a usage event
+	Error      string  `bson:"error,omitempty" json:"error,omitempty"` // Set when reranking failed and the retrieval order was kept
+}
+
+// IsValidRerankerProvider checks if a reranker provider is supported
+func IsValidRerankerProvider(provider string) bool {
+	switch provider {
+	case RerankerProviderVoyage, RerankerProviderCohere, RerankerProviderLocal:
+		return true
+	}
+	return false
+}
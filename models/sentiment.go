@@ -0,0 +1,104 @@
+package models
+
+import "time"
+
+// Sentiment labels of a customer message, from most positive to most negative
+const (
+	SentimentPositive = "positive"
+	SentimentNeutral  = "neutral"
+	SentimentNegative = "negative"
+	SentimentAngry    = "angry"
+)
+
+// Urgency levels of a customer message
+const (
+	UrgencyLow    = "low"
+	UrgencyMedium = "medium"
+	UrgencyHigh   = "high"
+)
+
+// Where a message's sentiment came from
+const (
+	SentimentSourceModel   = "model"   // Classified by the reply model through the agent detection tool
+	SentimentSourceLexicon = "lexicon" // Scored with word lists when the model did not classify the message
+)
+
+// Directions of a customer's sentiment trend
+const (
+	SentimentImproving = "improving"
+	SentimentWorsening = "worsening"
+	SentimentStable    = "stable"
+)
+
+// Reasons a conversation is escalated to a human by the page's escalation rules
+const (
+	EscalationReasonAngry          = "angry_customer"
+	EscalationReasonUrgent         = "urgent_request"
+	EscalationReasonNegativeStreak = "negative_streak"
+	EscalationReasonNegativeTrend  = "negative_trend"
+)
+
+// MessageSentiment is the sentiment and urgency of a single customer message
+type MessageSentiment struct {
+	Sentiment string  `bson:"sentiment" json:"sentiment"`
+	Score     float64 `bson:"score" json:"score"` // -1 (angry) to 1 (positive)
+	Urgency   string  `bson:"urgency" json:"urgency"`
+	Source    string  `bson:"source" json:"source"` // model or lexicon
+}
+
+// SentimentTrend follows a customer's sentiment across their messages
+type SentimentTrend struct {
+	Score          float64   `bson:"score" json:"score"`                     // Moving average of message scores, recent messages weigh more
+	Direction      string    `bson:"direction" json:"direction"`             // improving, worsening or stable
+	LastSentiment  string    `bson:"last_sentiment" json:"last_sentiment"`   // Sentiment of the latest message
+	LastUrgency    string    `bson:"last_urgency" json:"last_urgency"`       // Urgency of the latest message
+	NegativeStreak int       `bson:"negative_streak" json:"negative_streak"` // Consecutive negative or angry messages
+	Messages       int       `bson:"messages" json:"messages"`               // Messages scored so far
+	UpdatedAt      time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// EscalationRules hand a conversation to a human when a customer is upset or in a hurry,
+// before they ask for one
+type EscalationRules struct {
+	Enabled        bool    `bson:"enabled" json:"enabled"`
+	OnAngry        bool    `bson:"on_angry" json:"on_angry"`               // Escalate on a single angry message
+	OnHighUrgency  bool    `bson:"on_high_urgency" json:"on_high_urgency"` // Escalate on a highly urgent message
+	NegativeStreak int     `bson:"negative_streak" json:"negative_streak"` // Consecutive negative messages that escalate, 0 disables
+	TrendBelow     float64 `bson:"trend_below" json:"trend_below"`         // Escalate when the trend score drops to this value (-1 to 0), 0 disables
+}
+
+// SentimentScore returns the score of a sentiment label
+func SentimentScore(sentiment string) float64 {
+	switch sentiment {
+	case SentimentPositive:
+		return 0.6
+	case SentimentNegative:
+		return -0.5
+	case SentimentAngry:
+		return -1
+	}
+	return 0
+}
+
+// IsNegativeSentiment checks if a sentiment label is negative or angry
+func IsNegativeSentiment(sentiment string) bool {
+	return sentiment == SentimentNegative || sentiment == SentimentAngry
+}
+
+// IsValidSentiment checks if a sentiment label is valid
+func IsValidSentiment(sentiment string) bool {
+	switch sentiment {
+	case SentimentPositive, SentimentNeutral, SentimentNegative, SentimentAngry:
+		return true
+	}
+	return false
+}
+
+// IsValidUrgency checks if an urgency level is valid
+func IsValidUrgency(urgency string) bool {
+	switch urgency {
+	case UrgencyLow, UrgencyMedium, UrgencyHigh:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Usage providers
+const (
+	UsageProviderAnthropic = "anthropic"
+	UsageProviderOpenAI    = "openai"
+	UsageProviderVoyage    = "voyage"
+	UsageProviderCohere    = "cohere"
+)
+
+// Usage purposes describe why a model call was made
+const (
+	UsagePurposeReply           = "reply"                // Main bot reply generation
+	UsagePurposeReplyFollowUp   = "reply_follow_up"      // Second call when the first one only used a tool
+	UsagePurposeIntentDetection = "intent_detection"     // Human agent request detection
+	UsagePurposeLeadExtraction  = "lead_extraction"      // Lead capture tool call
+	UsagePurposeEmbedding       = "embedding"            // Document or query embeddings
+	UsagePurposeTranslation     = "query_translation"    // Knowledge base query translation
+	UsagePurposeSummary         = "conversation_summary" // Rolling customer memory refresh
+	UsagePurposeSuggestion      = "reply_suggestion"     // Draft replies for human agents
+	UsagePurposeEvaluation      = "evaluation"           // Offline evaluation runs of golden question sets
+	UsagePurposeRerank          = "rerank"               // Second-stage reranking of knowledge base results
+)
+
+// Actions taken when a company exceeds its monthly budget
+const (
+	BudgetActionFallbackReply = "fallback_reply" // Reply with a fixed message without calling the model
+	BudgetActionHumanOnly     = "human_only"     // Hand every conversation over to a human agent
+)
+
+// UsageEvent records a single LLM or embedding API call
+type UsageEvent struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID    string             `bson:"company_id" json:"company_id"`
+	PageID       string             `bson:"page_id,omitempty" json:"page_id,omitempty"`
+	CustomerID   string             `bson:"customer_id,omitempty" json:"customer_id,omitempty"`
+	Provider     string             `bson:"provider" json:"provider"`
+	Model        string             `bson:"model" json:"model"`
+	Purpose      string             `bson:"purpose" json:"purpose"`
+	InputTokens  int                `bson:"input_tokens" json:"input_tokens"` // Uncached input tokens
+	OutputTokens int                `bson:"output_tokens" json:"output_tokens"`
+	TotalTokens  int                `bson:"total_tokens" json:"total_tokens"`
+	Cost         float64            `bson:"cost" json:"cost"` // USD, computed from the price table at record time
+	Timestamp    time.Time          `bson:"timestamp" json:"timestamp"`
+
+	// Prompt caching (Anthropic only)
+	CacheCreationTokens int     `bson:"cache_creation_tokens,omitempty" json:"cache_creation_tokens,omitempty"` // Input tokens written to the cache
+	CacheReadTokens     int     `bson:"cache_read_tokens,omitempty" json:"cache_read_tokens,omitempty"`         // Input tokens served from the cache
+	CacheSavings        float64 `bson:"cache_savings,omitempty" json:"cache_savings,omitempty"`                 // USD saved compared to sending the same tokens uncached
+}
+
+// UsageSummary is an aggregated view of usage events grouped by day, page or model
+type UsageSummary struct {
+	Key          string  `bson:"_id" json:"key"`
+	Requests     int64   `bson:"requests" json:"requests"`
+	InputTokens  int64   `bson:"input_tokens" json:"input_tokens"`
+	OutputTokens int64   `bson:"output_tokens" json:"output_tokens"`
+	TotalTokens  int64   `bson:"total_tokens" json:"total_tokens"`
+	Cost         float64 `bson:"cost" json:"cost"`
+
+	CacheCreationTokens int64   `bson:"cache_creation_tokens" json:"cache_creation_tokens"`
+	CacheReadTokens     int64   `bson:"cache_read_tokens" json:"cache_read_tokens"`
+	CacheSavings        float64 `bson:"cache_savings" json:"cache_savings"`
+}
+
+// IsValidBudgetAction checks if a budget exceeded action is valid
+func IsValidBudgetAction(action string) bool {
+	return action == BudgetActionFallbackReply || action == BudgetActionHumanOnly
+}
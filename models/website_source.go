@@ -0,0 +1,92 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Website source crawl statuses
+const (
+	WebsiteStatusPending  = "pending" // Not crawled yet
+	WebsiteStatusCrawling = "crawling"
+	WebsiteStatusIdle     = "idle" // Last crawl finished, waiting for the next refresh
+	WebsiteStatusFailed   = "failed"
+)
+
+// Website crawl limits
+const (
+	DefaultWebsiteMaxDepth     = 3
+	MaxWebsiteMaxDepth         = 10
+	DefaultWebsiteMaxPages     = 100
+	MaxWebsiteMaxPages         = 1000
+	DefaultWebsiteRefreshHours = 24
+	MinWebsiteRefreshHours     = 1
+)
+
+// WebsiteDocumentSource is the source of the vector documents crawled from websites
+const WebsiteDocumentSource = "website"
+
+// WebsiteSource is a client website crawled into a page's knowledge base. Its pages are chunked,
+// embedded and stored as vector documents with source "website" and the page URL in their metadata,
+// and refreshed on a schedule; only pages whose content changed are embedded again.
+type WebsiteSource struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID string             `bson:"company_id" json:"company_id"`
+	PageID    string             `bson:"page_id" json:"page_id"`
+	Name      string             `bson:"name" json:"name"`
+	SeedURL   string             `bson:"seed_url" json:"seed_url"` // Page the crawl starts from, or a sitemap listing the pages
+
+	// URL patterns where * matches any characters, e.g. "/faq/*" or "*/products/*". Patterns starting
+	// with / match the URL path and query, the others the whole URL.
+	IncludePatterns []string `bson:"include_patterns,omitempty" json:"include_patterns,omitempty"` // Pages to store; all when empty
+	ExcludePatterns []string `bson:"exclude_patterns,omitempty" json:"exclude_patterns,omitempty"` // Pages never fetched
+
+	MaxDepth     int      `bson:"max_depth" json:"max_depth"`                   // Links followed from the seed, 0 crawls the seed or sitemap pages only
+	MaxPages     int      `bson:"max_pages" json:"max_pages"`                   // Pages fetched per crawl
+	RefreshHours int      `bson:"refresh_hours" json:"refresh_hours"`           // Hours between scheduled crawls
+	Channels     []string `bson:"channels,omitempty" json:"channels,omitempty"` // "facebook", "messenger"; both when empty
+	IsActive     bool     `bson:"is_active" json:"is_active"`                   // Inactive sources are not refreshed and their documents are not searched
+
+	Status      string        `bson:"status" json:"status"`
+	LastCrawl   *WebsiteCrawl `bson:"last_crawl,omitempty" json:"last_crawl,omitempty"`
+	NextCrawlAt time.Time     `bson:"next_crawl_at" json:"next_crawl_at"`
+	HeartbeatAt time.Time     `bson:"heartbeat_at,omitempty" json:"heartbeat_at,omitempty"` // Refreshed while an instance crawls, a stale crawl is taken over
+
+	CreatedBy string    `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// WebsiteCrawl summarizes one crawl of a website source
+type WebsiteCrawl struct {
+	StartedAt  time.Time  `bson:"started_at" json:"started_at"`
+	FinishedAt *time.Time `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+	Fetched    int        `bson:"fetched" json:"fetched"`                         // Pages requested
+	Added      int        `bson:"added" json:"added"`                             // Pages stored for the first time
+	Changed    int        `bson:"changed" json:"changed"`                         // Pages whose content changed and was embedded again
+	Unchanged  int        `bson:"unchanged" json:"unchanged"`                     // Pages kept as they were
+	Removed    int        `bson:"removed" json:"removed"`                         // Pages gone from the site, excluded or marked noindex
+	Skipped    int        `bson:"skipped" json:"skipped"`                         // Links robots.txt, the patterns or the page limit left out
+	Failed     int        `bson:"failed" json:"failed"`                           // Pages that could not be fetched or stored
+	Chunks     int        `bson:"chunks" json:"chunks"`                           // Chunks embedded
+	Truncated  bool       `bson:"truncated,omitempty" json:"truncated,omitempty"` // The page limit was reached
+	Errors     []string   `bson:"errors,omitempty" json:"errors,omitempty"`       // First errors of the crawl
+	Error      string     `bson:"error,omitempty" json:"error,omitempty"`         // Why the crawl failed as a whole
+}
+
+// WebsitePage is the state of one crawled URL, kept to detect changes between crawls
+type WebsitePage struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SourceID     primitive.ObjectID `bson:"source_id" json:"source_id"`
+	CompanyID    string             `bson:"company_id" json:"company_id"`
+	PageID       string             `bson:"page_id" json:"page_id"`
+	URL          string             `bson:"url" json:"url"`
+	Title        string             `bson:"title,omitempty" json:"title,omitempty"`
+	ContentHash  string             `bson:"content_hash" json:"content_hash"` // SHA-256 of the extracted text
+	ETag         string             `bson:"etag,omitempty" json:"etag,omitempty"`
+	LastModified string             `bson:"last_modified,omitempty" json:"last_modified,omitempty"`
+	Chunks       int                `bson:"chunks" json:"chunks"`
+	CrawledAt    time.Time          `bson:"crawled_at" json:"crawled_at"`
+	ChangedAt    time.Time          `bson:"changed_at" json:"changed_at"`
+}
@@ -0,0 +1,352 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"facebook-bot/models"
+)
+
+const (
+	// Retrieval confidence thresholds. Search always returns its best documents, so the share of
+	// question words found in them matters as much as the score
+	retrievalHighScore    = 0.6
+	retrievalHighCoverage = 0.5
+	retrievalLowScore     = 0.4
+	retrievalLowCoverage  = 0.25
+
+	// questionWordMinLength skips short words like articles and prepositions when measuring coverage
+	questionWordMinLength = 3
+)
+
+// retrievalConfidence measures how well search results match a query
+func retrievalConfidence(query string, results []SearchResult, mode string) models.RetrievalConfidence {
+	confidence := models.RetrievalConfidence{
+		Results: len(results),
+		Level:   models.RetrievalLevelNone,
+		Mode:    mode,
+	}
+	if len(results) == 0 {
+		return confidence
+	}
+	confidence.TopScore = results[0].Score
+
+	words := questionWords(query)
+	if len(words) > 0 {
+		var content strings.Builder
+		for _, result := range results {
+			content.WriteString(strings.ToLower(result.Content))
+			content.WriteString("\n")
+		}
+		retrieved := content.String()
+
+		found := 0
+		for _, word := range words {
+			if strings.Contains(retrieved, wordStem(word)) {
+				found++
+			}
+		}
+		confidence.Coverage = math.Round(float64(found)/float64(len(words))*100) / 100
+	}
+
+	switch {
+	case float64(confidence.TopScore) >= retrievalHighScore && (len(words) == 0 || confidence.Coverage >= retrievalHighCoverage):
+		confidence.Level = models.RetrievalLevelHigh
+	case float64(confidence.TopScore) < retrievalLowScore || (len(words) > 0 && confidence.Coverage < retrievalLowCoverage):
+		confidence.Level = models.RetrievalLevelLow
+	default:
+		confidence.Level = models.RetrievalLevelMedium
+	}
+
+	// Without a query embedding the scores are measured against a stand-in document, so they never count as high
+	if mode != models.SearchModeQueryEmbedding && confidence.Level == models.RetrievalLevelHigh {
+		confidence.Level = models.RetrievalLevelMedium
+	}
+	return confidence
+}
+
+// questionWords returns the distinct words of a question long enough to carry meaning
+func questionWords(text string) []string {
+	seen := make(map[string]bool)
+	var words []string
+	for _, token := range sentimentTokens(text) {
+		if len([]rune(token)) < questionWordMinLength || seen[token] {
+			continue
+		}
+		seen[token] = true
+		words = append(words, token)
+	}
+	return words
+}
+
+// wordStem drops the last letters of longer words so inflected forms still match,
+// e.g. "delivery" matches "delivered" and Georgian case endings are ignored
+func wordStem(word string) string {
+	runes := []rune(word)
+	if len(runes) <= 5 {
+		return word
+	}
+	return string(runes[:len(runes)-2])
+}
+
+type retrievalConfidenceKey struct{}
+
+// WithRetrievalConfidence attaches how well the knowledge base matched the customer's message
+// so the reply model is told about it
+func WithRetrievalConfidence(ctx context.Context, confidence models.RetrievalConfidence) context.Context {
+	return context.WithValue(ctx, retrievalConfidenceKey{}, confidence)
+}
+
+// retrievalConfidenceFromContext returns the retrieval confidence attached to the context,
+// or nil when the knowledge base was not searched
+func retrievalConfidenceFromContext(ctx context.Context) *models.RetrievalConfidence {
+	if confidence, ok := ctx.Value(retrievalConfidenceKey{}).(models.RetrievalConfidence); ok {
+		return &confidence
+	}
+	return nil
+}
+
+// answerabilityFromTool reads the answerability the reply model reported with the agent detection tool.
+// Returns "" when the model left it out.
+func answerabilityFromTool(input ToolUse) string {
+	if !models.IsValidAnswerability(input.Answerability) {
+		return ""
+	}
+	return input.Answerability
+}
+
+// knowledgeMatchNote tells the reply model how well the knowledge base matched the message
+// and what to do when it cannot answer
+func knowledgeMatchNote(confidence models.RetrievalConfidence, policy *models.AnswerabilityPolicy) string {
+	var note strings.Builder
+	if confidence.Results == 0 {
+		note.WriteString("KNOWLEDGE BASE MATCH: none - nothing relevant was found.\n")
+	} else {
+		note.WriteString(fmt.Sprintf("KNOWLEDGE BASE MATCH: %s - best result relevance %.2f, %d results, %d%% of the question's words found.\n",
+			confidence.Level, confidence.TopScore, confidence.Results, int(confidence.Coverage*100)))
+	}
+	note.WriteString("Report answerability in detect_agent_request. Never present facts that are not in the knowledge base or the conversation. ")
+
+	action := models.AnswerabilityActionAnswer
+	if policy != nil && policy.Enabled {
+		action = policy.OnUnanswerable
+	}
+	switch action {
+	case models.AnswerabilityActionClarify:
+		note.WriteString("If you cannot answer, ask the customer one short clarifying question instead of guessing.")
+	case models.AnswerabilityActionEscalate:
+		note.WriteString("If you cannot answer, do not guess: tell the customer a colleague will help them.")
+	default:
+		note.WriteString("If you cannot answer, say so honestly instead of guessing.")
+	}
+	return note.String()
+}
+
+// CheckAnswerability decides whether a message went unanswered and what the page does about it.
+// Returns the reason it counts as unanswered and the action to take, or "" when the reply stands.
+// Nothing is checked when the knowledge base was not searched (confidence is nil).
+func CheckAnswerability(pageConfig *models.FacebookPage, answerability string, confidence *models.RetrievalConfidence) (string, string) {
+	if confidence == nil {
+		return "", ""
+	}
+	policy := pageConfig.AnswerabilityPolicy
+	enabled := policy != nil && policy.Enabled
+
+	reason := ""
+	switch answerability {
+	case models.AnswerabilityUnanswerable:
+		reason = models.UnansweredReasonUnanswerable
+	case models.AnswerabilityPartial:
+		reason = models.UnansweredReasonPartial
+	case models.AnswerabilityNotQuestion:
+		return "", ""
+	default:
+		// The model claims an answer, but retrieval found too little to back it up
+		if enabled && policy.MinTopScore > 0 && float64(confidence.TopScore) < policy.MinTopScore {
+			reason = models.UnansweredReasonLowRetrieval
+		}
+	}
+	if reason == "" {
+		return "", ""
+	}
+
+	// Partial answers still help the customer, they are only logged
+	action := models.AnswerabilityActionAnswer
+	if enabled && reason != models.UnansweredReasonPartial && models.IsValidAnswerabilityAction(policy.OnUnanswerable) {
+		action = policy.OnUnanswerable
+	}
+
+	slog.Info("Knowledge base could not answer the message",
+		"pageID", pageConfig.PageID,
+		"reason", reason,
+		"action", action,
+		"answerability", answerability,
+		"topScore", confidence.TopScore,
+		"coverage", confidence.Coverage)
+	return reason, action
+}
+
+// ApplyAnswerabilityAction returns the reply to send for a message the knowledge base could not answer,
+// or escalate=true when the conversation should go to a human instead
+func ApplyAnswerabilityAction(reason, action, reply, language string) (string, bool) {
+	switch action {
+	case models.AnswerabilityActionEscalate:
+		return "", true
+	case models.AnswerabilityActionClarify:
+		// The model asks for details itself when it knows it cannot answer, but not when it
+		// believed it could and retrieval says otherwise
+		if reason == models.UnansweredReasonLowRetrieval || reply == "" {
+			reply = LocalizedMessage(MessageKeyClarify, language)
+		}
+	}
+	return reply, false
+}
+
+// ValidateAnswerabilityPolicy checks the settings of an answerability policy
+func ValidateAnswerabilityPolicy(policy *models.AnswerabilityPolicy) bool {
+	if policy == nil || !policy.Enabled {
+		return true
+	}
+	return models.IsValidAnswerabilityAction(policy.OnUnanswerable) && policy.MinTopScore >= 0
+}
+
+// normalizeQuestion lowercases a question and drops punctuation so repeated questions group together
+func normalizeQuestion(question string) string {
+	return strings.Join(sentimentTokens(question), " ")
+}
+
+// RecordUnansweredQuestion stores a question the knowledge base could not answer in the background
+func RecordUnansweredQuestion(question models.UnansweredQuestion) {
+	if question.Timestamp.IsZero() {
+		question.Timestamp = time.Now()
+	}
+	question.Normalized = normalizeQuestion(question.Question)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := GetDatabase().Collection("unanswered_questions").InsertOne(ctx, question); err != nil {
+			slog.Error("Failed to record unanswered question",
+				"pageID", question.PageID,
+				"error", err)
+		}
+	}()
+}
+
+// GetUnansweredQuestions returns a company's unanswered questions, newest first.
+// pageID and reason are optional filters.
+func GetUnansweredQuestions(ctx context.Context, companyID, pageID, reason string, limit, skip int) ([]models.UnansweredQuestion, int64, error) {
+	collection := GetDatabase().Collection("unanswered_questions")
+
+	filter := bson.M{"company_id": companyID}
+	if pageID != "" {
+		filter["page_id"] = pageID
+	}
+	if reason != "" {
+		filter["reason"] = reason
+	}
+
+	totalCount, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+		SetLimit(int64(limit)).
+		SetSkip(int64(skip))
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	questions := []models.UnansweredQuestion{}
+	if err := cursor.All(ctx, &questions); err != nil {
+		return nil, 0, err
+	}
+
+	return questions, totalCount, nil
+}
+
+// GetKnowledgeGaps groups a company's unanswered questions between from and to, most asked first,
+// so the knowledge base can be extended where customers need it most
+func GetKnowledgeGaps(ctx context.Context, companyID, pageID string, from, to time.Time, limit int) ([]models.KnowledgeGap, error) {
+	match := bson.M{
+		"company_id": companyID,
+		"timestamp":  bson.M{"$gte": from, "$lt": to},
+		"reason":     bson.M{"$ne": models.UnansweredReasonPartial},
+	}
+	if pageID != "" {
+		match["page_id"] = pageID
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: bson.D{{Key: "timestamp", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        "$normalized",
+			"question":   bson.M{"$first": "$question"},
+			"count":      bson.M{"$sum": 1},
+			"customers":  bson.M{"$addToSet": "$customer_id"},
+			"last_asked": bson.M{"$first": "$timestamp"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"question":   1,
+			"count":      1,
+			"customers":  bson.M{"$size": "$customers"},
+			"last_asked": 1,
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "last_asked", Value: -1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+
+	cursor, err := GetDatabase().Collection("unanswered_questions").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	gaps := []models.KnowledgeGap{}
+	if err := cursor.All(ctx, &gaps); err != nil {
+		return nil, err
+	}
+	return gaps, nil
+}
+
+// CreateIndexesForUnansweredQuestions creates indexes for the unanswered_questions collection
+func CreateIndexesForUnansweredQuestions(ctx context.Context) error {
+	_, err := GetDatabase().Collection("unanswered_questions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "company_id", Value: 1},
+				{Key: "timestamp", Value: -1},
+			},
+		},
+		{
+			Keys: bson.D{
+				{Key: "company_id", Value: 1},
+				{Key: "page_id", Value: 1},
+				{Key: "reason", Value: 1},
+				{Key: "timestamp", Value: -1},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to create indexes for unanswered_questions collection", "error", err)
+		return err
+	}
+
+	slog.Info("Successfully created indexes for unanswered_questions collection")
+	return nil
+}
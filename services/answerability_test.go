@@ -0,0 +1,109 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"facebook-bot/models"
+)
+
+func TestRetrievalConfidence(t *testing.T) {
+	const query = "What is the delivery price to Batumi?"
+	matching := "Delivery price for Batumi is 10 GEL"
+	unrelated := "Opening hours are 10:00 to 19:00"
+
+	tests := []struct {
+		name         string
+		results      []SearchResult
+		wantLevel    string
+		wantCoverage float64
+	}{
+		{"nothing found", nil, models.RetrievalLevelNone, 0},
+		{"strong match", []SearchResult{{Content: matching, Score: 0.72}}, models.RetrievalLevelHigh, 0.6},
+		{"moderate score", []SearchResult{{Content: matching, Score: 0.5}}, models.RetrievalLevelMedium, 0.6},
+		{"low score", []SearchResult{{Content: matching, Score: 0.3}}, models.RetrievalLevelLow, 0.6},
+		{"high score without the question's words", []SearchResult{{Content: unrelated, Score: 0.9}}, models.RetrievalLevelLow, 0},
+		{"words spread over results", []SearchResult{{Content: unrelated, Score: 0.65}, {Content: matching, Score: 0.5}}, models.RetrievalLevelHigh, 0.6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := retrievalConfidence(query, tt.results, models.SearchModeQueryEmbedding)
+			if got.Level != tt.wantLevel || got.Coverage != tt.wantCoverage || got.Results != len(tt.results) || got.Mode != models.SearchModeQueryEmbedding {
+				t.Errorf("retrievalConfidence = %+v, want level %s with coverage %v", got, tt.wantLevel, tt.wantCoverage)
+			}
+		})
+	}
+}
+
+func TestCheckAnswerability(t *testing.T) {
+	escalate := &models.FacebookPage{AnswerabilityPolicy: &models.AnswerabilityPolicy{
+		Enabled:        true,
+		OnUnanswerable: models.AnswerabilityActionEscalate,
+		MinTopScore:    0.5,
+	}}
+	noPolicy := &models.FacebookPage{}
+	weak := &models.RetrievalConfidence{TopScore: 0.3, Results: 2, Level: models.RetrievalLevelLow}
+	strong := &models.RetrievalConfidence{TopScore: 0.8, Results: 3, Level: models.RetrievalLevelHigh}
+
+	tests := []struct {
+		name          string
+		page          *models.FacebookPage
+		answerability string
+		confidence    *models.RetrievalConfidence
+		wantReason    string
+		wantAction    string
+	}{
+		{"not searched", escalate, models.AnswerabilityUnanswerable, nil, "", ""},
+		{"answered", escalate, models.AnswerabilityAnswerable, strong, "", ""},
+		{"small talk with weak retrieval", escalate, models.AnswerabilityNotQuestion, weak, "", ""},
+		{"unanswerable", escalate, models.AnswerabilityUnanswerable, strong, models.UnansweredReasonUnanswerable, models.AnswerabilityActionEscalate},
+		{"partial is only logged", escalate, models.AnswerabilityPartial, strong, models.UnansweredReasonPartial, models.AnswerabilityActionAnswer},
+		{"answer below minimum score", escalate, models.AnswerabilityAnswerable, weak, models.UnansweredReasonLowRetrieval, models.AnswerabilityActionEscalate},
+		{"unreported below minimum score", escalate, "", weak, models.UnansweredReasonLowRetrieval, models.AnswerabilityActionEscalate},
+		{"unanswerable without policy", noPolicy, models.AnswerabilityUnanswerable, strong, models.UnansweredReasonUnanswerable, models.AnswerabilityActionAnswer},
+		{"weak retrieval without policy", noPolicy, models.AnswerabilityAnswerable, weak, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, action := CheckAnswerability(tt.page, tt.answerability, tt.confidence)
+			if reason != tt.wantReason || action != tt.wantAction {
+				t.Errorf("CheckAnswerability = %q, %q; want %q, %q", reason, action, tt.wantReason, tt.wantAction)
+			}
+		})
+	}
+}
+
+func TestKnowledgeMatchNote(t *testing.T) {
+	note := knowledgeMatchNote(models.RetrievalConfidence{}, nil)
+	if !strings.Contains(note, "KNOWLEDGE BASE MATCH: none") || !strings.Contains(note, "say so honestly") {
+		t.Errorf("note without results = %q", note)
+	}
+
+	confidence := models.RetrievalConfidence{TopScore: 0.62, Results: 3, Coverage: 0.75, Level: models.RetrievalLevelHigh}
+	policy := &models.AnswerabilityPolicy{Enabled: true, OnUnanswerable: models.AnswerabilityActionClarify}
+	note = knowledgeMatchNote(confidence, policy)
+	if !strings.Contains(note, "KNOWLEDGE BASE MATCH: high - best result relevance 0.62, 3 results, 75%") || !strings.Contains(note, "clarifying question") {
+		t.Errorf("note with a clarify policy = %q", note)
+	}
+}
+
+func TestValidateAnswerabilityPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *models.AnswerabilityPolicy
+		want   bool
+	}{
+		{"none", nil, true},
+		{"disabled with bad values", &models.AnswerabilityPolicy{OnUnanswerable: "shrug", MinTopScore: -1}, true},
+		{"escalate", &models.AnswerabilityPolicy{Enabled: true, OnUnanswerable: models.AnswerabilityActionEscalate, MinTopScore: 0.4}, true},
+		{"unknown action", &models.AnswerabilityPolicy{Enabled: true, OnUnanswerable: "shrug"}, false},
+		{"negative score", &models.AnswerabilityPolicy{Enabled: true, OnUnanswerable: models.AnswerabilityActionAnswer, MinTopScore: -0.1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateAnswerabilityPolicy(tt.policy); got != tt.want {
+				t.Errorf("ValidateAnswerabilityPolicy = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"facebook-bot/models"
+)
+
+// Sources of an effective setting, reported by the admin API
+const (
+	ConfigSourceChannel = "channel"
+	ConfigSourcePage    = "page"
+	ConfigSourceCompany = "company"
+	ConfigSourceDefault = "default"
+)
+
+// EffectiveChannelConfig is the configuration the bot actually uses for one channel of a page.
+//
+// Precedence, from highest to lowest:
+//   - enabled: the page must be active and the channel must not be disabled
+//   - system prompt: channel prompt, then page prompt, then company prompt, then the built-in role
+//   - RAG: the channel switch if the channel is configured, otherwise enabled
+type EffectiveChannelConfig struct {
+	Channel            string           `json:"channel"`
+	IsEnabled          bool             `json:"is_enabled"`
+	EnabledSource      string           `json:"enabled_source"`
+	SystemPrompt       string           `json:"system_prompt"`
+	SystemPromptSource string           `json:"system_prompt_source"`
+	RAGEnabled         bool             `json:"rag_enabled"`
+	RAGSource          string           `json:"rag_source"`
+	CRMLinks           []models.CRMLink `json:"crm_links"`
+	Vertical           string           `json:"vertical"`
+	ClaudeModel        string           `json:"claude_model"`
+	MaxTokens          int              `json:"max_tokens"`
+	DefaultLanguage    string           `json:"default_language,omitempty"`
+}
+
+// GetChannelConfig returns the page's configuration for a channel, or nil if it has none
+func GetChannelConfig(pageConfig *models.FacebookPage, channel string) *models.ChannelConfig {
+	switch normalizeChannel(channel) {
+	case "facebook":
+		return pageConfig.FacebookConfig
+	case "messenger":
+		return pageConfig.MessengerConfig
+	}
+	return nil
+}
+
+// ResolveChannelConfig resolves the effective configuration for a channel of a page
+func ResolveChannelConfig(company *models.Company, pageConfig *models.FacebookPage, channel string) EffectiveChannelConfig {
+	channel = normalizeChannel(channel)
+	channelConfig := GetChannelConfig(pageConfig, channel)
+
+	effective := EffectiveChannelConfig{
+		Channel:         channel,
+		IsEnabled:       true,
+		EnabledSource:   ConfigSourceDefault,
+		RAGEnabled:      true,
+		RAGSource:       ConfigSourceDefault,
+		CRMLinks:        pageConfig.CRMLinks,
+		Vertical:        PageVertical(pageConfig),
+		ClaudeModel:     pageConfig.ClaudeModel,
+		MaxTokens:       pageConfig.MaxTokens,
+		DefaultLanguage: company.DefaultLanguage,
+	}
+
+	if effective.MaxTokens == 0 {
+		effective.MaxTokens = 1024
+	}
+
+	// Enabled
+	switch {
+	case !pageConfig.IsActive:
+		effective.IsEnabled = false
+		effective.EnabledSource = ConfigSourcePage
+	case channelConfig != nil:
+		effective.IsEnabled = channelConfig.IsEnabled
+		effective.EnabledSource = ConfigSourceChannel
+	}
+
+	// System prompt
+	switch {
+	case channelConfig != nil && channelConfig.SystemPrompt != "":
+		effective.SystemPrompt = channelConfig.SystemPrompt
+		effective.SystemPromptSource = ConfigSourceChannel
+	case pageConfig.SystemPrompt != "":
+		effective.SystemPrompt = pageConfig.SystemPrompt
+		effective.SystemPromptSource = ConfigSourcePage
+	case company.SystemPrompt != "":
+		effective.SystemPrompt = company.SystemPrompt
+		effective.SystemPromptSource = ConfigSourceCompany
+	default:
+		effective.SystemPromptSource = ConfigSourceDefault
+	}
+
+	// RAG and CRM links
+	if channelConfig != nil {
+		effective.RAGEnabled = channelConfig.RAGEnabled
+		effective.RAGSource = ConfigSourceChannel
+		if len(channelConfig.CRMLinks) > 0 {
+			effective.CRMLinks = channelConfig.CRMLinks
+		}
+	}
+
+	return effective
+}
+
+// ApplyChannelConfig returns a copy of the page configuration with channel settings applied,
+// so the reply pipeline uses the effective system prompt for the channel
+func ApplyChannelConfig(pageConfig *models.FacebookPage, effective EffectiveChannelConfig) *models.FacebookPage {
+	applied := *pageConfig
+	applied.SystemPrompt = effective.SystemPrompt
+	applied.MaxTokens = effective.MaxTokens
+	return &applied
+}
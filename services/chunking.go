@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+
+	"facebook-bot/chunking"
+	"facebook-bot/models"
+)
+
+// ChunkDocument splits a knowledge base text into chunks with the page's chunk sizes and the strategy
+// for its file. name is the file name or URL path the text came from, empty for prose.
+func ChunkDocument(ctx context.Context, companyID, pageID, name, text string) []chunking.Chunk {
+	return ChunkText(ctx, companyID, pageID, chunking.StrategyFor(name), text)
+}
+
+// ChunkText splits a knowledge base text into chunks with the page's chunk sizes and the given
+// strategy, for texts without a file name such as CRM feeds
+func ChunkText(ctx context.Context, companyID, pageID string, strategy chunking.Strategy, text string) []chunking.Chunk {
+	opts := pageChunkingOptions(ctx, companyID, pageID)
+	opts.Strategy = strategy
+	return chunking.Split(text, opts)
+}
+
+// ChunkMetadata returns a chunk's document metadata: the document's own with what is known about the
+// chunk added
+func ChunkMetadata(metadata map[string]string, chunk chunking.Chunk) map[string]string {
+	chunkMetadata := make(map[string]string, len(metadata)+4)
+	for k, v := range metadata {
+		chunkMetadata[k] = v
+	}
+	for k, v := range chunk.Metadata() {
+		chunkMetadata[k] = v
+	}
+	return chunkMetadata
+}
+
+// pageChunkingOptions returns the page's chunk sizes, with defaults for the ones it does not set
+func pageChunkingOptions(ctx context.Context, companyID, pageID string) chunking.Options {
+	opts := chunking.Options{
+		MaxTokens:     chunking.DefaultMaxTokens,
+		OverlapTokens: chunking.DefaultOverlapTokens,
+	}
+	pageConfig, err := embeddingPageConfig(ctx, companyID, pageID)
+	if err != nil || pageConfig.Chunking == nil {
+		return opts
+	}
+	if pageConfig.Chunking.MaxTokens > 0 {
+		opts.MaxTokens = pageConfig.Chunking.MaxTokens
+	}
+	if pageConfig.Chunking.OverlapTokens != nil {
+		opts.OverlapTokens = *pageConfig.Chunking.OverlapTokens
+	}
+	return opts
+}
+
+// ValidateChunking checks the chunk sizes sent for a page. nil leaves them unchanged.
+func ValidateChunking(config *models.ChunkingConfig) bool {
+	if config == nil {
+		return true
+	}
+	if config.MaxTokens != 0 && (config.MaxTokens < chunking.MinMaxTokens || config.MaxTokens > chunking.MaxMaxTokens) {
+		return false
+	}
+	if config.OverlapTokens == nil {
+		return true
+	}
+	maxTokens := config.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = chunking.DefaultMaxTokens
+	}
+	return *config.OverlapTokens >= 0 && *config.OverlapTokens <= maxTokens/2
+}
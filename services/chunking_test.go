@@ -0,0 +1,54 @@
+package services
+
+import (
+	"testing"
+
+	"facebook-bot/chunking"
+	"facebook-bot/models"
+)
+
+func TestValidateChunking(t *testing.T) {
+	overlap := func(tokens int) *int { return &tokens }
+	tests := []struct {
+		name   string
+		config *models.ChunkingConfig
+		want   bool
+	}{
+		{"unchanged", nil, true},
+		{"defaults", &models.ChunkingConfig{}, true},
+		{"max tokens", &models.ChunkingConfig{MaxTokens: 800, OverlapTokens: overlap(100)}, true},
+		{"no overlap", &models.ChunkingConfig{OverlapTokens: overlap(0)}, true},
+		{"overlap against the default size", &models.ChunkingConfig{OverlapTokens: overlap(chunking.DefaultMaxTokens / 2)}, true},
+		{"too small", &models.ChunkingConfig{MaxTokens: chunking.MinMaxTokens - 1}, false},
+		{"too large", &models.ChunkingConfig{MaxTokens: chunking.MaxMaxTokens + 1}, false},
+		{"negative overlap", &models.ChunkingConfig{OverlapTokens: overlap(-1)}, false},
+		{"overlap over half", &models.ChunkingConfig{MaxTokens: 200, OverlapTokens: overlap(101)}, false},
+	}
+	for _, tt := range tests {
+		if got := ValidateChunking(tt.config); got != tt.want {
+			t.Errorf("%s: ValidateChunking() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChunkMetadata(t *testing.T) {
+	metadata := map[string]string{"filename": "prices.csv", "chunk": "stale"}
+	chunk := chunking.Chunk{Tokens: 42, Index: 1, Total: 3, Strategy: chunking.StrategyCSV, RowStart: 2, RowEnd: 9}
+
+	got := ChunkMetadata(metadata, chunk)
+	want := map[string]string{
+		"filename":       "prices.csv",
+		"chunk":          "2/3",
+		"chunk_strategy": string(chunking.StrategyCSV),
+		"chunk_tokens":   "42",
+		"rows":           "2-9",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("metadata[%q] = %q, want %q", k, got[k], v)
+		}
+	}
+	if metadata["chunk"] != "stale" {
+		t.Error("ChunkMetadata changed the document's metadata")
+	}
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"    // Requests go through
+	CircuitOpen     = "open"      // Requests are skipped until the cool-down ends
+	CircuitHalfOpen = "half_open" // One probe request is let through to test recovery
+)
+
+const (
+	// circuitFailureThreshold is the number of outage errors within circuitFailureWindow that trips a breaker
+	circuitFailureThreshold = 5
+	circuitFailureWindow    = time.Minute
+	// circuitOpenDuration is how long a tripped breaker skips requests before probing again
+	circuitOpenDuration = 30 * time.Second
+)
+
+// circuitBreaker tracks outages of one provider model shared by all pages
+type circuitBreaker struct {
+	mu           sync.Mutex
+	provider     string
+	model        string
+	state        string
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+	probing      bool
+	trips        int
+	lastError    string
+}
+
+// CircuitStatus is a snapshot of a circuit breaker for the dashboard
+type CircuitStatus struct {
+	Provider  string     `json:"provider"`
+	Model     string     `json:"model"`
+	State     string     `json:"state"`
+	Failures  int        `json:"failures"`
+	Trips     int        `json:"trips"`
+	OpenedAt  *time.Time `json:"opened_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+var (
+	circuitBreakers   = make(map[string]*circuitBreaker)
+	circuitBreakersMu sync.Mutex
+)
+
+// getCircuitBreaker returns the breaker of a provider model, creating it on first use
+func getCircuitBreaker(provider, model string) *circuitBreaker {
+	key := provider + "|" + model
+
+	circuitBreakersMu.Lock()
+	defer circuitBreakersMu.Unlock()
+
+	breaker, ok := circuitBreakers[key]
+	if !ok {
+		breaker = &circuitBreaker{provider: provider, model: model, state: CircuitClosed}
+		circuitBreakers[key] = breaker
+	}
+	return breaker
+}
+
+// allow reports whether a request may be sent. After the cool-down a single probe is let through.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < circuitOpenDuration {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return true
+	case CircuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// recordSuccess closes the breaker
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != CircuitClosed {
+		slog.Info("Circuit breaker closed", "provider", b.provider, "model", b.model)
+	}
+	b.state = CircuitClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// recordFailure counts an outage error and trips the breaker when there are too many.
+// A failed probe reopens it right away.
+func (b *circuitBreaker) recordFailure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.lastError = err.Error()
+
+	if b.state == CircuitHalfOpen {
+		b.state = CircuitOpen
+		b.openedAt = now
+		b.probing = false
+		b.trips++
+		slog.Warn("Circuit breaker probe failed, reopened",
+			"provider", b.provider,
+			"model", b.model,
+			"error", err)
+		return
+	}
+
+	if b.failures == 0 || now.Sub(b.firstFailure) > circuitFailureWindow {
+		b.failures = 0
+		b.firstFailure = now
+	}
+	b.failures++
+
+	if b.state == CircuitClosed && b.failures >= circuitFailureThreshold {
+		b.state = CircuitOpen
+		b.openedAt = now
+		b.trips++
+		slog.Warn("Circuit breaker tripped",
+			"provider", b.provider,
+			"model", b.model,
+			"failures", b.failures,
+			"openFor", circuitOpenDuration,
+			"error", err)
+	}
+}
+
+// releaseProbe lets another probe through when a probe ended with an error that says nothing about an outage
+func (b *circuitBreaker) releaseProbe() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// GetCircuitStatuses returns the state of every circuit breaker
+func GetCircuitStatuses() []CircuitStatus {
+	circuitBreakersMu.Lock()
+	breakers := make([]*circuitBreaker, 0, len(circuitBreakers))
+	for _, breaker := range circuitBreakers {
+		breakers = append(breakers, breaker)
+	}
+	circuitBreakersMu.Unlock()
+
+	statuses := make([]CircuitStatus, 0, len(breakers))
+	for _, breaker := range breakers {
+		breaker.mu.Lock()
+		status := CircuitStatus{
+			Provider:  breaker.provider,
+			Model:     breaker.model,
+			State:     breaker.state,
+			Failures:  breaker.failures,
+			Trips:     breaker.trips,
+			LastError: breaker.lastError,
+		}
+		if breaker.state != CircuitClosed {
+			openedAt := breaker.openedAt
+			status.OpenedAt = &openedAt
+		}
+		breaker.mu.Unlock()
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Provider != statuses[j].Provider {
+			return statuses[i].Provider < statuses[j].Provider
+		}
+		return statuses[i].Model < statuses[j].Model
+	})
+	return statuses
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTripsAndResets(t *testing.T) {
+	breaker := &circuitBreaker{provider: "anthropic", model: "test-model", state: CircuitClosed}
+	outage := errors.New("anthropic API error: 529 - overloaded")
+
+	for i := 1; i < circuitFailureThreshold; i++ {
+		breaker.recordFailure(outage)
+		if breaker.state != CircuitClosed || !breaker.allow() {
+			t.Fatalf("breaker %s after %d failures, want closed", breaker.state, i)
+		}
+	}
+	breaker.recordFailure(outage)
+	if breaker.state != CircuitOpen || breaker.trips != 1 {
+		t.Fatalf("breaker %s with %d trips after %d failures, want open once", breaker.state, breaker.trips, circuitFailureThreshold)
+	}
+	if breaker.allow() {
+		t.Error("open breaker let a request through during its cool-down")
+	}
+
+	// After the cool-down a single probe goes through
+	breaker.openedAt = time.Now().Add(-circuitOpenDuration)
+	if !breaker.allow() || breaker.state != CircuitHalfOpen {
+		t.Fatalf("breaker %s after its cool-down, want a half-open probe", breaker.state)
+	}
+	if breaker.allow() {
+		t.Error("half-open breaker let a second probe through")
+	}
+
+	// A failed probe reopens it at once
+	breaker.recordFailure(outage)
+	if breaker.state != CircuitOpen || breaker.trips != 2 || breaker.allow() {
+		t.Fatalf("breaker %s with %d trips after a failed probe, want open again", breaker.state, breaker.trips)
+	}
+
+	// A successful probe closes it
+	breaker.openedAt = time.Now().Add(-circuitOpenDuration)
+	if !breaker.allow() {
+		t.Fatal("breaker let no probe through after its second cool-down")
+	}
+	breaker.recordSuccess()
+	if breaker.state != CircuitClosed || breaker.failures != 0 || !breaker.allow() {
+		t.Errorf("breaker %s with %d failures after a successful probe, want closed", breaker.state, breaker.failures)
+	}
+}
+
+func TestCircuitBreakerForgetsFailuresOutsideWindow(t *testing.T) {
+	breaker := &circuitBreaker{provider: "anthropic", model: "test-model", state: CircuitClosed}
+	outage := errors.New("timeout")
+
+	for i := 1; i < circuitFailureThreshold; i++ {
+		breaker.recordFailure(outage)
+	}
+	breaker.firstFailure = time.Now().Add(-circuitFailureWindow - time.Second)
+	breaker.recordFailure(outage)
+	if breaker.state != CircuitClosed || breaker.failures != 1 {
+		t.Errorf("breaker %s with %d failures, want closed counting again from 1", breaker.state, breaker.failures)
+	}
+}
+
+func TestCircuitBreakerReleasesProbe(t *testing.T) {
+	breaker := &circuitBreaker{provider: "anthropic", model: "test-model", state: CircuitOpen}
+	if !breaker.allow() {
+		t.Fatal("breaker opened long ago let no probe through")
+	}
+	// A probe that ended with a rejected request says nothing about the outage
+	breaker.releaseProbe()
+	if !breaker.allow() {
+		t.Error("breaker let no probe through after the previous one was released")
+	}
+}
+
+func TestIsOutageError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"overloaded", &ProviderError{Provider: "anthropic", StatusCode: 529}, true},
+		{"server error", &ProviderError{Provider: "openai", StatusCode: 500}, true},
+		{"rate limited", &ProviderError{Provider: "anthropic", StatusCode: 429}, true},
+		{"bad request", &ProviderError{Provider: "anthropic", StatusCode: 400}, false},
+		{"retries exhausted", fmt.Errorf("Claude API failed after 2 attempts: %w", &ProviderError{Provider: "anthropic", StatusCode: 503}), true},
+		{"connection refused", &url.Error{Op: "Post", URL: "https://api.anthropic.com", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}, true},
+		{"timeout", &url.Error{Op: "Post", URL: "https://api.anthropic.com", Err: context.DeadlineExceeded}, true},
+		{"connection closed", &url.Error{Op: "Post", URL: "https://api.anthropic.com", Err: io.EOF}, true},
+		{"cancelled by caller", &url.Error{Op: "Post", URL: "https://api.anthropic.com", Err: context.Canceled}, false},
+		{"unsupported scheme", &url.Error{Op: "Post", URL: "ftp://api.anthropic.com", Err: errors.New("unsupported protocol scheme \"ftp\"")}, false},
+		{"invalid response", json.Unmarshal([]byte("{"), &ClaudeResponse{}), false},
+		{"request not built", errors.New("unsupported message content type int for OpenAI"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isOutageError(tt.err); got != tt.want {
+				t.Errorf("isOutageError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
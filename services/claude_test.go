@@ -0,0 +1,33 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReplySystemBlocks(t *testing.T) {
+	const (
+		instructions = "YOUR TASK: answer the customer"
+		knowledge    = "Opening hours: 10:00-19:00"
+		retrieved    = "[Result 1] Opening hours: 10:00-19:00"
+	)
+
+	blocks := replySystemBlocks(instructions, knowledge, retrieved)
+	if len(blocks) != 3 {
+		t.Fatalf("got %d blocks, want 3: %+v", len(blocks), blocks)
+	}
+	if blocks[0].Text != instructions || blocks[0].CacheControl != nil {
+		t.Errorf("first block = %+v, want the uncached instructions", blocks[0])
+	}
+	if !strings.Contains(blocks[1].Text, knowledge) || blocks[1].CacheControl == nil {
+		t.Errorf("second block = %+v, want the page knowledge ending the cached prefix", blocks[1])
+	}
+	if !strings.Contains(blocks[2].Text, retrieved) || blocks[2].CacheControl != nil {
+		t.Errorf("third block = %+v, want the retrieved context uncached", blocks[2])
+	}
+
+	blocks = replySystemBlocks(instructions, "", "")
+	if len(blocks) != 1 || blocks[0].Text != instructions || blocks[0].CacheControl == nil {
+		t.Errorf("blocks without knowledge = %+v, want only the cached instructions", blocks)
+	}
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"facebook-bot/models"
+)
+
+const (
+	// memoryRefreshEvery is the number of customer messages between summary refreshes
+	memoryRefreshEvery = 10
+	// memoryMaxMessages is the most messages folded into the summary in one refresh
+	memoryMaxMessages = 60
+	// MaxMemoryLength is the longest summary stored, in characters
+	MaxMemoryLength = 4000
+)
+
+// ErrMemoryChanged is returned when the summary was edited while a refresh was running
+var ErrMemoryChanged = errors.New("conversation memory changed during refresh")
+
+// memoryRefreshing holds the customers whose summary is being refreshed, keyed by customer|page
+var memoryRefreshing sync.Map
+
+// ShouldRefreshConversationMemory checks if enough new customer messages arrived since the last refresh
+func ShouldRefreshConversationMemory(customer *models.Customer) bool {
+	if customer == nil {
+		return false
+	}
+	summarized := 0
+	if customer.Memory != nil {
+		summarized = customer.Memory.MessageCount
+	}
+	return customer.MessageCount-summarized >= memoryRefreshEvery
+}
+
+// RefreshConversationMemory folds the messages since the last refresh into the customer's summary.
+// The previous summary, including agent edits, is kept as the starting point.
+func RefreshConversationMemory(ctx context.Context, company *models.Company, pageConfig *models.FacebookPage, customerID string) (*models.ConversationMemory, error) {
+	key := customerID + "|" + pageConfig.PageID
+	if _, running := memoryRefreshing.LoadOrStore(key, struct{}{}); running {
+		return nil, nil
+	}
+	defer memoryRefreshing.Delete(key)
+
+	customer, err := GetCustomer(ctx, customerID, pageConfig.PageID)
+	if err != nil {
+		return nil, err
+	}
+	if customer == nil {
+		return nil, fmt.Errorf("customer %s not found", customerID)
+	}
+
+	previous := customer.Memory
+	var since time.Time
+	previousSummary := ""
+	if previous != nil {
+		since = previous.CoveredUntil
+		previousSummary = previous.Summary
+	}
+
+	messages, err := getConversationSince(ctx, customerID, pageConfig.PageID, since, memoryMaxMessages)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return previous, nil
+	}
+
+	summary, err := summarizeConversation(ctx, company, pageConfig, previousSummary, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	memory := &models.ConversationMemory{
+		Summary:      truncateMemory(summary),
+		MessageCount: customer.MessageCount,
+		CoveredUntil: messages[len(messages)-1].Timestamp,
+		UpdatedAt:    time.Now(),
+	}
+
+	// Only replace the summary the refresh started from, so agent edits made meanwhile are kept
+	filter := bson.M{
+		"customer_id": customerID,
+		"page_id":     pageConfig.PageID,
+	}
+	if previous != nil {
+		filter["memory.updated_at"] = previous.UpdatedAt
+	} else {
+		filter["memory"] = bson.M{"$exists": false}
+	}
+
+	result, err := GetDatabase().Collection("customers").UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{"memory": memory},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrMemoryChanged
+	}
+
+	slog.Info("Conversation memory refreshed",
+		"customerID", customerID,
+		"pageID", pageConfig.PageID,
+		"messages", len(messages),
+		"summaryLength", len(memory.Summary))
+
+	return memory, nil
+}
+
+// UpdateConversationMemory replaces a customer's summary with an agent's edit
+func UpdateConversationMemory(ctx context.Context, customerID, pageID, summary, editedBy string) (*models.ConversationMemory, error) {
+	customer, err := GetCustomer(ctx, customerID, pageID)
+	if err != nil {
+		return nil, err
+	}
+	if customer == nil {
+		return nil, fmt.Errorf("customer %s not found", customerID)
+	}
+
+	memory := &models.ConversationMemory{
+		Summary:      truncateMemory(strings.TrimSpace(summary)),
+		MessageCount: customer.MessageCount,
+		CoveredUntil: time.Now(),
+		EditedBy:     editedBy,
+		UpdatedAt:    time.Now(),
+	}
+	if customer.Memory != nil {
+		// The edit does not cover messages the bot has not summarized yet
+		memory.MessageCount = customer.Memory.MessageCount
+		memory.CoveredUntil = customer.Memory.CoveredUntil
+	}
+
+	_, err = GetDatabase().Collection("customers").UpdateOne(ctx, bson.M{
+		"customer_id": customerID,
+		"page_id":     pageID,
+	}, bson.M{
+		"$set": bson.M{
+			"memory":     memory,
+			"updated_at": time.Now(),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Conversation memory edited",
+		"customerID", customerID,
+		"pageID", pageID,
+		"editedBy", editedBy)
+
+	return memory, nil
+}
+
+// getConversationSince returns the oldest messages of a conversation after a point in time,
+// including human agent messages, oldest first
+func getConversationSince(ctx context.Context, customerID, pageID string, since time.Time, limit int) ([]ChatHistory, error) {
+	filter := bson.M{
+		"page_id": pageID,
+		"chat_id": customerID,
+		"type":    "chat",
+	}
+	if !since.IsZero() {
+		filter["timestamp"] = bson.M{"$gt": since}
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.M{"timestamp": 1}).
+		SetLimit(int64(limit))
+
+	cursor, err := GetDatabase().Collection("messages").Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var messages []models.Message
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+
+	history := make([]ChatHistory, 0, len(messages))
+	for _, msg := range messages {
+		role := "user"
+		if msg.IsBot || msg.IsHuman || msg.SenderID == pageID {
+			role = "assistant"
+		}
+		history = append(history, ChatHistory{
+			Role:      role,
+			Content:   msg.Message,
+			Timestamp: msg.Timestamp,
+		})
+	}
+	return history, nil
+}
+
+// summarizeConversation asks Claude to merge new messages into the previous summary
+func summarizeConversation(ctx context.Context, company *models.Company, pageConfig *models.FacebookPage, previousSummary string, messages []ChatHistory) (string, error) {
+	if pageConfig.ClaudeAPIKey == "" {
+		return "", fmt.Errorf("Claude API key not configured for page %s", pageConfig.PageID)
+	}
+
+	summaryLanguage := "English"
+	if company != nil && models.LanguageName(company.DefaultLanguage) != "" {
+		summaryLanguage = models.LanguageName(company.DefaultLanguage)
+	}
+
+	var conversation strings.Builder
+	if previousSummary != "" {
+		conversation.WriteString("CURRENT SUMMARY:\n")
+		conversation.WriteString(previousSummary)
+		conversation.WriteString("\n\n")
+	}
+	conversation.WriteString("NEW MESSAGES:\n")
+	for _, msg := range messages {
+		speaker := "Customer"
+		if msg.Role == "assistant" {
+			speaker = "Business"
+		}
+		conversation.WriteString(fmt.Sprintf("[%s] %s: %s\n", msg.Timestamp.Format("2006-01-02 15:04"), speaker, msg.Content))
+	}
+
+	if pageConfig.ClaudeAPIKey == "TEST_MODE" {
+		return strings.TrimSpace(previousSummary + "\n" + fmt.Sprintf("- %d new messages", len(messages))), nil
+	}
+
+	model := pageConfig.ClaudeModel
+	if model == "" {
+		model = "claude-3-haiku-20240307"
+	}
+
+	requestBody := ClaudeRequest{
+		Model:     model,
+		MaxTokens: 600,
+		System: systemText("You maintain a short memory of a customer's conversations with a business. " +
+			"Merge the new messages into the current summary and return only the updated summary as at most 12 short bullet points. " +
+			"Keep what matters for future conversations: who the customer is, what they need, preferences, budget, products or properties discussed, " +
+			"orders, open questions and anything the business promised. Drop greetings and small talk. " +
+			"Never invent details. Keep facts from the current summary unless the new messages contradict them. " +
+			"Write in " + summaryLanguage + ", keeping names and product names as written."),
+		Messages: []Message{
+			{
+				Role:    "user",
+				Content: conversation.String(),
+			},
+		},
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", claudeAPIURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", err
+	}
+
+	resp, body, err := callClaudeAPIWithRetry(req, pageConfig.ClaudeAPIKey, 2)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Claude API error: %s - %s", resp.Status, string(body))
+	}
+
+	var claudeResp ClaudeResponse
+	if err := json.Unmarshal(body, &claudeResp); err != nil {
+		return "", err
+	}
+
+	recordClaudeUsage(ctx, models.UsagePurposeSummary, &claudeResp)
+
+	var summary strings.Builder
+	for _, content := range claudeResp.Content {
+		if content.Type == "text" {
+			summary.WriteString(content.Text)
+		}
+	}
+	if strings.TrimSpace(summary.String()) == "" {
+		return "", fmt.Errorf("no response content from Claude for conversation summary")
+	}
+
+	return strings.TrimSpace(summary.String()), nil
+}
+
+// truncateMemory cuts a summary to MaxMemoryLength characters
+func truncateMemory(summary string) string {
+	runes := []rune(summary)
+	if len(runes) <= MaxMemoryLength {
+		return summary
+	}
+	return string(runes[:MaxMemoryLength])
+}
+
+type conversationMemoryKey struct{}
+
+// WithConversationMemory attaches a customer's conversation summary to a context so it is sent
+// with the reply prompt alongside the recent turns
+func WithConversationMemory(ctx context.Context, summary string) context.Context {
+	return context.WithValue(ctx, conversationMemoryKey{}, summary)
+}
+
+// conversationMemoryFromContext returns the summary attached to the context, or ""
+func conversationMemoryFromContext(ctx context.Context) string {
+	summary, _ := ctx.Value(conversationMemoryKey{}).(string)
+	return summary
+}
@@ -12,6 +12,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 
+	"facebook-bot/chunking"
 	"facebook-bot/models"
 )
 
@@ -297,36 +298,12 @@ func FetchAndStoreCRMDataForChannelWithID(ctx context.Context, companyID, pageID
 		return fmt.Errorf("failed to read response: %w", err)
 	}
 
-	// Parse JSON to extract text content
-	var data interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		// If not JSON, use raw text
-		content := string(body)
-
-		// Store as embeddings with channel
-		metadata := map[string]string{
-			"crm_url":    crmLink.URL,
-			"crm_name":   crmLink.Name,
-			"fetch_time": time.Now().Format(time.RFC3339),
-		}
-
-		return StoreEmbeddingsWithCRMID(
-			ctx,
-			companyID,
-			pageID,
-			channel,
-			content,
-			"crm",
-			metadata,
-			crmLink.URL,
-			crmID,
-			crmLink.IsActive,
-		)
+	// JSON feeds get a chunk per record, anything else is split as prose
+	strategy := chunking.StrategyRecursive
+	if json.Valid(body) {
+		strategy = chunking.StrategyJSON
 	}
 
-	// Convert JSON to readable text
-	content := formatJSONAsText(data, "")
-
 	// Store as embeddings with channel
 	metadata := map[string]string{
 		"crm_url":    crmLink.URL,
@@ -334,18 +311,48 @@ func FetchAndStoreCRMDataForChannelWithID(ctx context.Context, companyID, pageID
 		"fetch_time": time.Now().Format(time.RFC3339),
 	}
 
-	return StoreEmbeddingsWithCRMID(
-		ctx,
-		companyID,
-		pageID,
-		channel,
-		content,
-		"crm",
-		metadata,
-		crmLink.URL,
-		crmID,
-		crmLink.IsActive,
-	)
+	channels := []string{}
+	if channel != "" {
+		channels = []string{channel}
+	}
+	_, err = storeCRMContent(ctx, companyID, pageID, channels, strategy, string(body), metadata, crmLink.URL, crmID, crmLink.IsActive)
+	return err
+}
+
+// storeCRMContent chunks the content fetched from a CRM URL with the page's chunk sizes and stores
+// the chunks as the URL's documents. Chunks an earlier fetch of the URL stored that are not part of
+// this one are deleted, so records dropped from the feed are no longer retrieved. Returns the number
+// of chunks stored.
+func storeCRMContent(ctx context.Context, companyID, pageID string, channels []string, strategy chunking.Strategy, content string, metadata map[string]string, crmURL, crmID string, isActive bool) (int, error) {
+	chunks := ChunkText(ctx, companyID, pageID, strategy, content)
+	if len(chunks) == 0 {
+		return 0, fmt.Errorf("no content to store from %s", crmURL)
+	}
+
+	contents := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		contents[i] = chunk.Text
+		if err := StoreEmbeddingsWithChannelsAndCRMID(ctx, companyID, pageID, channels, chunk.Text, "crm",
+			ChunkMetadata(metadata, chunk), crmURL, crmID, isActive); err != nil {
+			// Chunks of the earlier fetch are kept, the next fetch stores the feed again
+			return i, err
+		}
+	}
+
+	// Chunks of the earlier fetch, or the whole feed as it was stored before feeds were chunked
+	stale := bson.M{
+		"company_id": companyID,
+		"page_id":    pageID,
+		"crm_url":    crmURL,
+		"content":    bson.M{"$nin": contents},
+	}
+	ids := vectorDocumentIDs(ctx, stale)
+	if _, err := database.Collection("vector_documents").DeleteMany(ctx, stale); err != nil {
+		return len(chunks), fmt.Errorf("failed to delete replaced CRM documents: %w", err)
+	}
+	vectorIndex.Remove(ids...)
+	invalidateLexicalIndexes(stale)
+	return len(chunks), nil
 }
 
 // SyncVectorDocumentsWithCRMLink syncs vector documents when CRM link status changes
@@ -370,6 +377,7 @@ func SyncVectorDocumentsWithCRMLink(ctx context.Context, companyID, pageID, chan
 	if err != nil {
 		return fmt.Errorf("failed to sync vector documents: %w", err)
 	}
+	syncVectorIndex(ctx, filter)
 
 	slog.Info("Synced vector documents with CRM link",
 		"crmURL", crmURL,
@@ -391,10 +399,14 @@ func DeleteVectorDocumentsByCRMURL(ctx context.Context, companyID, pageID, chann
 		"crm_url":    crmURL,
 	}
 
+	ids := vectorDocumentIDs(ctx, filter)
+
 	result, err := collection.DeleteMany(ctx, filter)
 	if err != nil {
 		return fmt.Errorf("failed to delete vector documents: %w", err)
 	}
+	vectorIndex.Remove(ids...)
+	invalidateLexicalIndexes(filter)
 
 	slog.Info("Deleted vector documents for CRM URL",
 		"crmURL", crmURL,
@@ -487,31 +499,3 @@ func GenerateCRMID(pageID, crmURL string) string {
 	// Use a combination of page ID and URL to create a unique ID
 	return fmt.Sprintf("%s_%s", pageID, crmURL)
 }
-
-// formatJSONAsText converts JSON data to readable text format
-func formatJSONAsText(data interface{}, prefix string) string {
-	result := ""
-
-	switch v := data.(type) {
-	case map[string]interface{}:
-		for key, value := range v {
-			if prefix != "" {
-				result += fmt.Sprintf("%s.%s: %s\n", prefix, key, formatJSONAsText(value, ""))
-			} else {
-				result += fmt.Sprintf("%s: %s\n", key, formatJSONAsText(value, ""))
-			}
-		}
-	case []interface{}:
-		for i, item := range v {
-			itemPrefix := fmt.Sprintf("%s[%d]", prefix, i)
-			if prefix == "" {
-				itemPrefix = fmt.Sprintf("Item %d", i+1)
-			}
-			result += formatJSONAsText(item, itemPrefix)
-		}
-	default:
-		result = fmt.Sprintf("%v", v)
-	}
-
-	return result
-}
@@ -283,6 +283,27 @@ func CreateIndexesForCustomers(ctx context.Context) error {
 		{
 			Keys: bson.D{{Key: "last_seen", Value: -1}},
 		},
+		// Index for lead listing and export
+		{
+			Keys: bson.D{
+				{Key: "company_id", Value: 1},
+				{Key: "lead.updated_at", Value: -1},
+			},
+		},
+		// Index for the hand-back scheduler finding waiting customers of a page
+		{
+			Keys: bson.D{
+				{Key: "page_id", Value: 1},
+				{Key: "stop", Value: 1},
+			},
+		},
+		// Index for finding the most upset customers
+		{
+			Keys: bson.D{
+				{Key: "company_id", Value: 1},
+				{Key: "sentiment.score", Value: 1},
+			},
+		},
 		// Text index for searching
 		{
 			Keys: bson.D{
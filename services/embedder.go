@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"facebook-bot/models"
+)
+
+// Embedding input types. Some providers embed documents and the search queries for them differently.
+const (
+	EmbeddingInputDocument = "document"
+	EmbeddingInputQuery    = "query"
+)
+
+// Default embedding models
+const (
+	DefaultOpenAIEmbeddingModel = "text-embedding-3-large"
+	DefaultVoyageEmbeddingModel = "voyage-2"
+	DefaultCohereEmbeddingModel = "embed-multilingual-v3.0" // Covers Georgian, unlike the English models
+	MockEmbeddingModel          = "mock-embeddings"
+)
+
+// ErrNoEmbeddingProvider is returned when a page has no embedding API configured
+var ErrNoEmbeddingProvider = errors.New("no embedding provider configured")
+
+// Embedder turns texts into vectors with one model of one provider. Vectors of different embedders
+// cannot be compared, so documents record the provider and model they were embedded with.
+type Embedder interface {
+	// Provider returns models.UsageProviderOpenAI, UsageProviderVoyage, UsageProviderCohere or EmbeddingProviderMock
+	Provider() string
+
+	// Model returns the embedding model
+	Model() string
+
+	// Embed returns one vector per text. inputType is EmbeddingInputDocument or EmbeddingInputQuery.
+	Embed(ctx context.Context, texts []string, inputType string) ([][]float32, error)
+}
+
+// PageEmbedder returns the embedder a page's knowledge base is embedded with. Returns an error
+// wrapping ErrNoEmbeddingProvider when the page has none or lacks the selected provider's API key.
+func PageEmbedder(pageConfig *models.FacebookPage) (Embedder, error) {
+	provider := pageConfig.EmbeddingProvider
+	if provider == "" {
+		// Pages configured before the provider could be selected
+		switch {
+		case pageConfig.GPTAPIKey != "":
+			provider = models.UsageProviderOpenAI
+		case pageConfig.VoyageAPIKey != "":
+			provider = models.UsageProviderVoyage
+		default:
+			return nil, ErrNoEmbeddingProvider
+		}
+	}
+
+	embedder := apiEmbedder{provider: provider, model: pageConfig.EmbeddingModel}
+	switch provider {
+	case models.UsageProviderOpenAI:
+		embedder.apiKey = pageConfig.GPTAPIKey
+		embedder.model = firstNonEmpty(embedder.model, pageConfig.GPTModel, DefaultOpenAIEmbeddingModel)
+	case models.UsageProviderVoyage:
+		embedder.apiKey = pageConfig.VoyageAPIKey
+		embedder.model = firstNonEmpty(embedder.model, pageConfig.VoyageModel, DefaultVoyageEmbeddingModel)
+	case models.UsageProviderCohere:
+		embedder.apiKey = pageConfig.CohereAPIKey
+		embedder.model = firstNonEmpty(embedder.model, DefaultCohereEmbeddingModel)
+	case models.EmbeddingProviderMock:
+		return mockEmbedder{}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown provider %q", ErrNoEmbeddingProvider, provider)
+	}
+
+	if embedder.apiKey == "" {
+		return nil, fmt.Errorf("%w: %s selected without an API key", ErrNoEmbeddingProvider, provider)
+	}
+	return embedder, nil
+}
+
+// apiEmbedder embeds with a provider's API
+type apiEmbedder struct {
+	provider string
+	model    string
+	apiKey   string
+}
+
+func (e apiEmbedder) Provider() string {
+	return e.provider
+}
+
+func (e apiEmbedder) Model() string {
+	return e.model
+}
+
+func (e apiEmbedder) Embed(ctx context.Context, texts []string, inputType string) ([][]float32, error) {
+	var embeddings [][]float32
+	var err error
+	switch e.provider {
+	case models.UsageProviderOpenAI:
+		embeddings, err = GetOpenAIEmbeddings(ctx, texts, e.apiKey, e.model)
+	case models.UsageProviderVoyage:
+		embeddings, err = GetVoyageEmbeddings(ctx, texts, e.apiKey, e.model)
+	case models.UsageProviderCohere:
+		cohereInputType := "search_document"
+		if inputType == EmbeddingInputQuery {
+			cohereInputType = "search_query"
+		}
+		embeddings, err = getCohereEmbeddings(ctx, texts, e.apiKey, e.model, cohereInputType)
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q", e.provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddings) != len(texts) {
+		return nil, fmt.Errorf("%s returned %d embeddings for %d texts", e.provider, len(embeddings), len(texts))
+	}
+	for _, embedding := range embeddings {
+		if len(embedding) == 0 {
+			return nil, fmt.Errorf("no embeddings generated")
+		}
+	}
+	return embeddings, nil
+}
+
+// mockEmbedder returns vectors derived from the text length, for pages that explicitly select mock embeddings
+type mockEmbedder struct{}
+
+func (mockEmbedder) Provider() string {
+	return models.EmbeddingProviderMock
+}
+
+func (mockEmbedder) Model() string {
+	return MockEmbeddingModel
+}
+
+func (mockEmbedder) Embed(ctx context.Context, texts []string, inputType string) ([][]float32, error) {
+	return GetMockEmbeddings(texts), nil
+}
+
+// GetEmbeddingModelStats counts a page's active documents by the model they were embedded with, so
+// documents left behind by a model change can be found and embedded again
+func GetEmbeddingModelStats(ctx context.Context, companyID, pageID string) ([]models.EmbeddingModelStats, error) {
+	match := bson.M{"company_id": companyID, "is_active": true}
+	if pageID != "" {
+		match["page_id"] = pageID
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"provider":  "$embedding_provider",
+				"model":     "$embedding_model",
+				"dimension": bson.M{"$size": bson.M{"$ifNull": bson.A{"$embedding", bson.A{}}}},
+			},
+			"documents": bson.M{"$sum": 1},
+		}}},
+	}
+
+	cursor, err := database.Collection("vector_documents").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count documents by embedding model: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		ID struct {
+			Provider  string `bson:"provider"`
+			Model     string `bson:"model"`
+			Dimension int    `bson:"dimension"`
+		} `bson:"_id"`
+		Documents int64 `bson:"documents"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to read embedding model counts: %w", err)
+	}
+
+	// The page's current model tells which documents search uses
+	var current Embedder
+	if pageConfig, err := embeddingPageConfig(ctx, companyID, pageID); err == nil {
+		current, _ = PageEmbedder(pageConfig)
+	}
+
+	stats := make([]models.EmbeddingModelStats, len(rows))
+	for i, row := range rows {
+		stats[i] = models.EmbeddingModelStats{
+			Provider:  row.ID.Provider,
+			Model:     row.ID.Model,
+			Dimension: row.ID.Dimension,
+			Documents: row.Documents,
+		}
+		if current != nil && row.ID.Provider == current.Provider() && row.ID.Model == current.Model() {
+			stats[i].Current = true
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Documents > stats[j].Documents
+	})
+	return stats, nil
+}
+
+// vectorMatchesEmbedder checks if a stored vector can be compared with vectors of an embedder.
+// Documents stored before models were recorded only need the same dimension.
+func vectorMatchesEmbedder(doc VectorDocument, provider, model string, dimension int) bool {
+	if len(doc.Embedding) != dimension {
+		return false
+	}
+	if doc.EmbeddingProvider == "" && doc.EmbeddingModel == "" {
+		return true
+	}
+	return doc.EmbeddingProvider == provider && doc.EmbeddingModel == model
+}
+
+// sameEmbeddingModel checks if two documents were embedded with the same model
+func sameEmbeddingModel(a, b VectorDocument) bool {
+	return len(a.Embedding) == len(b.Embedding) &&
+		a.EmbeddingProvider == b.EmbeddingProvider &&
+		a.EmbeddingModel == b.EmbeddingModel
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
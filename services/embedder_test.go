@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"facebook-bot/models"
+)
+
+func TestPageEmbedder(t *testing.T) {
+	tests := []struct {
+		name         string
+		page         models.FacebookPage
+		wantProvider string
+		wantModel    string
+	}{
+		{"legacy openai key", models.FacebookPage{GPTAPIKey: "sk"}, models.UsageProviderOpenAI, DefaultOpenAIEmbeddingModel},
+		{"legacy voyage key", models.FacebookPage{VoyageAPIKey: "pa", VoyageModel: "voyage-3"}, models.UsageProviderVoyage, "voyage-3"},
+		{"legacy openai preferred", models.FacebookPage{GPTAPIKey: "sk", GPTModel: "text-embedding-3-small", VoyageAPIKey: "pa"}, models.UsageProviderOpenAI, "text-embedding-3-small"},
+		{"selected provider", models.FacebookPage{EmbeddingProvider: models.UsageProviderVoyage, GPTAPIKey: "sk", VoyageAPIKey: "pa"}, models.UsageProviderVoyage, DefaultVoyageEmbeddingModel},
+		{"selected model", models.FacebookPage{EmbeddingProvider: models.UsageProviderOpenAI, EmbeddingModel: "text-embedding-3-small", GPTModel: "text-embedding-ada-002", GPTAPIKey: "sk"}, models.UsageProviderOpenAI, "text-embedding-3-small"},
+		{"cohere", models.FacebookPage{EmbeddingProvider: models.UsageProviderCohere, CohereAPIKey: "co"}, models.UsageProviderCohere, DefaultCohereEmbeddingModel},
+		{"mock", models.FacebookPage{EmbeddingProvider: models.EmbeddingProviderMock}, models.EmbeddingProviderMock, MockEmbeddingModel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			embedder, err := PageEmbedder(&tt.page)
+			if err != nil {
+				t.Fatalf("PageEmbedder: %v", err)
+			}
+			if embedder.Provider() != tt.wantProvider || embedder.Model() != tt.wantModel {
+				t.Errorf("embedder = %s %s, want %s %s", embedder.Provider(), embedder.Model(), tt.wantProvider, tt.wantModel)
+			}
+		})
+	}
+
+	for _, page := range []models.FacebookPage{
+		{},
+		{EmbeddingProvider: models.UsageProviderCohere, GPTAPIKey: "sk"},
+		{EmbeddingProvider: "word2vec", GPTAPIKey: "sk"},
+	} {
+		if _, err := PageEmbedder(&page); !errors.Is(err, ErrNoEmbeddingProvider) {
+			t.Errorf("PageEmbedder(%+v) error = %v, want ErrNoEmbeddingProvider", page, err)
+		}
+	}
+}
+
+func TestVectorMatchesEmbedder(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  VectorDocument
+		want bool
+	}{
+		{"same model", VectorDocument{Embedding: make([]float32, 4), EmbeddingProvider: models.UsageProviderOpenAI, EmbeddingModel: "text-embedding-3-small"}, true},
+		{"other model", VectorDocument{Embedding: make([]float32, 4), EmbeddingProvider: models.UsageProviderOpenAI, EmbeddingModel: "text-embedding-ada-002"}, false},
+		{"other provider", VectorDocument{Embedding: make([]float32, 4), EmbeddingProvider: models.UsageProviderVoyage, EmbeddingModel: "text-embedding-3-small"}, false},
+		{"unrecorded model", VectorDocument{Embedding: make([]float32, 4)}, true},
+		{"unrecorded model of another dimension", VectorDocument{Embedding: make([]float32, 8)}, false},
+	}
+	for _, tt := range tests {
+		if got := vectorMatchesEmbedder(tt.doc, models.UsageProviderOpenAI, "text-embedding-3-small", 4); got != tt.want {
+			t.Errorf("%s: vectorMatchesEmbedder = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEmbedderProviderOutage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"overloaded"}}`, http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	defaultURL := openAIEmbeddingsURL
+	openAIEmbeddingsURL = server.URL + "/v1/embeddings"
+	defer func() { openAIEmbeddingsURL = defaultURL }()
+
+	embedder := apiEmbedder{provider: models.UsageProviderOpenAI, model: "text-embedding-3-small", apiKey: "sk"}
+	_, err := embedder.Embed(context.Background(), []string{"When can I visit?"}, EmbeddingInputQuery)
+
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) || providerErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Embed error = %v, want a provider error with status 503", err)
+	}
+	if !isOutageError(err) {
+		t.Error("a 503 from the embedding provider is not treated as an outage")
+	}
+}
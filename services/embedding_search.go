@@ -2,12 +2,17 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sort"
-	"strings"
+	"sync"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"facebook-bot/models"
 )
 
 // SearchWithStoredEmbeddings searches using cosine similarity against stored embeddings
@@ -17,168 +22,162 @@ func SearchWithStoredEmbeddings(ctx context.Context, query string, companyID str
 
 // SearchWithStoredEmbeddingsAndCRMID searches using cosine similarity against stored embeddings with optional CRM ID filter
 func SearchWithStoredEmbeddingsAndCRMID(ctx context.Context, query string, companyID string, pageID string, crmID string, limit int) ([]SearchResult, error) {
-	collection := database.Collection("vector_documents")
+	results, _, err := searchStoredEmbeddings(ctx, query, VectorQuery{
+		CompanyID: companyID,
+		PageID:    pageID,
+		CRMID:     crmID,
+	}, limit)
+	return results, err
+}
 
-	// Fetch all active documents for the page with their embeddings
-	filter := bson.M{
-		"company_id": companyID,
-		"page_id":    pageID,
-		"is_active":  true,
-	}
+// searchInfo describes how a search ran
+type searchInfo struct {
+	mode       string // models.SearchMode*
+	mismatched int    // Documents embedded with another model than the query, left out of vector search
+}
 
-	// Add CRM ID filter if provided
-	if crmID != "" {
-		filter["crm_id"] = crmID
+// searchStoredEmbeddings ranks the documents the scope selects against the query. The query is embedded
+// with the page's provider and its nearest documents of the same embedding model are taken from the
+// vector index; when that is not possible the documents are scanned, with the best keyword match's
+// embedding standing in for the query embedding if there is none. The vector ranking is fused with
+// the documents' BM25 keyword ranking, weighted by the page's hybrid search settings.
+func searchStoredEmbeddings(ctx context.Context, query string, scope VectorQuery, limit int) ([]SearchResult, searchInfo, error) {
+	companyID, pageID := scope.CompanyID, scope.PageID
+	info := searchInfo{mode: models.SearchModeQueryEmbedding}
+	weights := hybridWeights(ctx, companyID, pageID)
+
+	queryEmbedding, embedder, embedErr := embedQuery(ctx, query, companyID, pageID)
+	if embedErr == nil {
+		scope.Embedding = queryEmbedding
+		scope.EmbeddingProvider = embedder.Provider()
+		scope.EmbeddingModel = embedder.Model()
+		scope.K = vectorCandidateCount(limit)
+		if candidates, ok := indexedCandidates(ctx, scope); ok {
+			info.mismatched = mismatchedVectorCount(ctx, scope)
+			var lexical []lexicalHit
+			if weights.LexicalWeight > 0 {
+				lexical = pageLexicalHits(ctx, query, scope)
+				candidates = addLexicalCandidates(ctx, candidates, lexical, scope)
+			}
+			results := fuseRankings(candidates, queryEmbedding, lexical, weights, limit)
+
+			slog.Info("Vector index search completed",
+				"query", query,
+				"companyID", companyID,
+				"pageID", pageID,
+				"backend", vectorIndex.Name(),
+				"resultsFound", len(results),
+				"candidates", len(candidates),
+				"lexicalHits", len(lexical),
+				"mismatchedVectors", info.mismatched,
+				"topScore", func() float32 {
+					if len(results) > 0 {
+						return results[0].Score
+					}
+					return 0
+				}(),
+			)
+
+			return results, info, nil
+		}
 	}
 
+	filter := scope.filter()
+	collection := database.Collection("vector_documents")
+
 	cursor, err := collection.Find(ctx, filter)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch documents: %w", err)
+		return nil, info, fmt.Errorf("failed to fetch documents: %w", err)
 	}
 	defer cursor.Close(ctx)
 
 	var documents []VectorDocument
 	if err := cursor.All(ctx, &documents); err != nil {
-		return nil, fmt.Errorf("failed to read documents: %w", err)
+		return nil, info, fmt.Errorf("failed to read documents: %w", err)
 	}
 
 	if len(documents) == 0 {
 		slog.Info("No documents found for page",
 			"pageID", pageID,
 			"companyID", companyID,
+			"filter", filter,
 		)
-		return []SearchResult{}, nil
+		return []SearchResult{}, info, nil
 	}
 
-	// Find the document that best matches the query text
-	queryLower := strings.ToLower(query)
-	queryWords := strings.Fields(queryLower)
-
-	// First, find documents that contain query keywords to use as reference
-	var referenceEmbedding []float32
-	bestTextScore := float32(0)
-
-	for _, doc := range documents {
-		contentLower := strings.ToLower(doc.Content)
-		score := float32(0)
+	// The scanned documents are all in scope, so they are keyword ranked among themselves
+	lexical := newLexicalIndex(documents).Search(query, len(documents), VectorQuery{})
 
-		// Calculate text matching score
-		for _, word := range queryWords {
-			if len(word) < 2 {
-				continue
-			}
-			if strings.Contains(contentLower, word) {
-				score += 1.0
+	var ranked []VectorDocument
+	switch {
+	case errors.Is(embedErr, ErrNoEmbeddingProvider):
+		// Pages without an embedding API or with mock embeddings, similarity means nothing
+		info.mode = models.SearchModeKeywordReference
+	case embedErr != nil:
+		slog.Warn("Query embedding unavailable, falling back to keyword reference search",
+			"pageID", pageID,
+			"error", embedErr)
+		info.mode = models.SearchModeKeywordReference
+	default:
+		for _, doc := range documents {
+			if vectorMatchesEmbedder(doc, embedder.Provider(), embedder.Model(), len(queryEmbedding)) {
+				ranked = append(ranked, doc)
 			}
 		}
-
-		// Bonus for exact phrase match
-		if strings.Contains(contentLower, queryLower) {
-			score += float32(len(queryWords))
-		}
-
-		// If this is the best match so far, use its embedding as reference
-		if score > bestTextScore && len(doc.Embedding) > 0 {
-			bestTextScore = score
-			referenceEmbedding = doc.Embedding
+		info.mismatched = len(documents) - len(ranked)
+		if len(ranked) == 0 {
+			slog.Warn("No documents embedded with the page's embedding model, falling back to keyword reference search",
+				"pageID", pageID,
+				"provider", embedder.Provider(),
+				"model", embedder.Model(),
+				"queryDimension", len(queryEmbedding))
+			info.mode = models.SearchModeKeywordReference
 		}
 	}
 
-	// If no text match found, use the first document's embedding as reference
-	if len(referenceEmbedding) == 0 && len(documents) > 0 && len(documents[0].Embedding) > 0 {
-		referenceEmbedding = documents[0].Embedding
-		slog.Info("No text match found, using first document as reference")
+	referenceEmbedding := queryEmbedding
+	if info.mode == models.SearchModeKeywordReference {
+		// Only documents of the stand-in's model can be compared with it
+		reference, ok := keywordReferenceDocument(documents, lexical)
+		referenceEmbedding = reference.Embedding
+		ranked = nil
+		if ok {
+			for _, doc := range documents {
+				if sameEmbeddingModel(doc, reference) {
+					ranked = append(ranked, doc)
+				}
+			}
+		}
 	}
 
 	// If still no embedding, fall back to text-only search
 	if len(referenceEmbedding) == 0 {
-		slog.Warn("No embeddings found, falling back to text search")
-		return searchByTextOnly(documents, query, limit), nil
+		slog.Warn("No embeddings found, falling back to text search", "pageID", pageID)
+		info.mode = models.SearchModeTextOnly
+		return rankByKeywords(documents, lexical, limit), info, nil
 	}
 
-	// Calculate cosine similarity for all documents using the reference embedding
-	type scoredDoc struct {
-		doc           VectorDocument
-		cosineSim     float32
-		textScore     float32
-		combinedScore float32
-	}
-
-	var scoredDocs []scoredDoc
-
-	for _, doc := range documents {
-		if len(doc.Embedding) == 0 {
-			continue
-		}
-
-		// Calculate cosine similarity
-		cosineSim := CosineSimilarity(referenceEmbedding, doc.Embedding)
-
-		// Calculate text relevance score
-		contentLower := strings.ToLower(doc.Content)
-		textScore := float32(0)
-
-		for _, word := range queryWords {
-			if len(word) < 2 {
-				continue
-			}
-			count := strings.Count(contentLower, word)
-			if count > 0 {
-				textScore += 1.0 + float32(count-1)*0.2 // Diminishing returns for multiple occurrences
-			}
-		}
-
-		// Bonus for exact phrase
-		if strings.Contains(contentLower, queryLower) {
-			textScore += 2.0
-		}
-
-		// Normalize text score
-		if len(queryWords) > 0 {
-			textScore = textScore / float32(len(queryWords))
-		}
-
-		// Combine cosine similarity and text score
-		// Weight: 70% cosine similarity, 30% text match
-		combinedScore := (cosineSim * 0.7) + (textScore * 0.3)
-
-		scoredDocs = append(scoredDocs, scoredDoc{
-			doc:           doc,
-			cosineSim:     cosineSim,
-			textScore:     textScore,
-			combinedScore: combinedScore,
-		})
+	if info.mismatched > 0 {
+		slog.Warn("Documents embedded with another model left out of search, embed them again",
+			"companyID", companyID,
+			"pageID", pageID,
+			"mismatchedVectors", info.mismatched,
+			"searchedVectors", len(ranked))
 	}
 
-	// Sort by combined score in descending order
-	sort.Slice(scoredDocs, func(i, j int) bool {
-		return scoredDocs[i].combinedScore > scoredDocs[j].combinedScore
-	})
-
-	// Take top N results
-	var results []SearchResult
-	for i := 0; i < limit && i < len(scoredDocs); i++ {
-		results = append(results, SearchResult{
-			Content:  scoredDocs[i].doc.Content,
-			Score:    scoredDocs[i].combinedScore,
-			Source:   scoredDocs[i].doc.Source,
-			Metadata: scoredDocs[i].doc.Metadata,
-		})
-
-		slog.Debug("Search result",
-			"rank", i+1,
-			"cosineSim", scoredDocs[i].cosineSim,
-			"textScore", scoredDocs[i].textScore,
-			"combinedScore", scoredDocs[i].combinedScore,
-		)
+	if weights.LexicalWeight == 0 {
+		lexical = nil
 	}
+	results := fuseRankings(ranked, referenceEmbedding, lexical, weights, limit)
 
 	slog.Info("Cosine similarity search completed with stored embeddings",
 		"query", query,
 		"companyID", companyID,
 		"pageID", pageID,
+		"mode", info.mode,
 		"resultsFound", len(results),
 		"totalDocuments", len(documents),
+		"lexicalHits", len(lexical),
 		"topScore", func() float32 {
 			if len(results) > 0 {
 				return results[0].Score
@@ -187,251 +186,330 @@ func SearchWithStoredEmbeddingsAndCRMID(ctx context.Context, query string, compa
 		}(),
 	)
 
-	return results, nil
+	return results, info, nil
 }
 
-// searchByTextOnly performs text-only search when embeddings are not available
-func searchByTextOnly(documents []VectorDocument, query string, limit int) []SearchResult {
-	queryLower := strings.ToLower(query)
-	queryWords := strings.Fields(queryLower)
-
-	type scoredDoc struct {
-		doc   VectorDocument
-		score float32
-	}
-
-	var scoredDocs []scoredDoc
-
-	for _, doc := range documents {
-		contentLower := strings.ToLower(doc.Content)
-		score := float32(0)
-
-		// Calculate score based on word matches
-		for _, word := range queryWords {
-			if len(word) < 2 {
-				continue
-			}
-
-			count := strings.Count(contentLower, word)
-			if count > 0 {
-				score += 1.0 + float32(count-1)*0.2
-			}
-		}
-
-		// Bonus for exact phrase
-		if strings.Contains(contentLower, queryLower) {
-			score += 3.0
-		}
-
-		// Normalize by query length
-		if len(queryWords) > 0 {
-			score = score / float32(len(queryWords))
-		}
-
-		if score > 0 {
-			scoredDocs = append(scoredDocs, scoredDoc{doc: doc, score: score})
+// hybridWeights returns the page's weights of the vector and keyword rankings
+func hybridWeights(ctx context.Context, companyID, pageID string) models.HybridSearch {
+	pageConfig, err := embeddingPageConfig(ctx, companyID, pageID)
+	if err != nil || pageConfig.HybridSearch == nil {
+		return models.HybridSearch{
+			VectorWeight:  models.DefaultHybridVectorWeight,
+			LexicalWeight: models.DefaultHybridLexicalWeight,
 		}
 	}
+	return *pageConfig.HybridSearch
+}
 
-	// If no matches, include all with low score
-	if len(scoredDocs) == 0 {
-		for _, doc := range documents {
-			scoredDocs = append(scoredDocs, scoredDoc{doc: doc, score: 0.1})
-		}
+// ValidateHybridSearch checks the weights of a page's hybrid search settings
+func ValidateHybridSearch(settings *models.HybridSearch) bool {
+	if settings == nil {
+		return true
 	}
+	return settings.VectorWeight >= 0 && settings.LexicalWeight >= 0 && settings.VectorWeight+settings.LexicalWeight > 0
+}
 
-	// Sort by score
-	sort.Slice(scoredDocs, func(i, j int) bool {
-		return scoredDocs[i].score > scoredDocs[j].score
-	})
-
-	// Take top results
-	var results []SearchResult
-	for i := 0; i < limit && i < len(scoredDocs); i++ {
-		results = append(results, SearchResult{
-			Content:  scoredDocs[i].doc.Content,
-			Score:    scoredDocs[i].score,
-			Source:   scoredDocs[i].doc.Source,
-			Metadata: scoredDocs[i].doc.Metadata,
-		})
+// pageLexicalHits returns the documents of the query's page best matching its keywords. Returns nil
+// for searches across pages and when the page's keyword index cannot be built.
+func pageLexicalHits(ctx context.Context, query string, scope VectorQuery) []lexicalHit {
+	if scope.PageID == "" {
+		return nil
 	}
-
-	return results
+	index, err := pageLexicalIndex(ctx, scope.CompanyID, scope.PageID)
+	if err != nil {
+		slog.Warn("Failed to build keyword index, ranking by vectors only",
+			"companyID", scope.CompanyID,
+			"pageID", scope.PageID,
+			"error", err)
+		return nil
+	}
+	return index.Search(query, scope.K, scope)
 }
 
-// SearchWithStoredEmbeddingsForChannel searches using cosine similarity against stored embeddings filtered by channel
-func SearchWithStoredEmbeddingsForChannel(ctx context.Context, query string, companyID string, pageID string, channel string, limit int) ([]SearchResult, error) {
-	collection := database.Collection("vector_documents")
-
-	// Normalize the channel name
-	channel = normalizeChannel(channel)
-
-	// Fetch all active documents that have this channel enabled
-	filter := bson.M{
-		"company_id":          companyID,
-		"page_id":             pageID,
-		"channels." + channel: true, // Check if the channel is enabled in the channels map
-		"is_active":           true,
+// addLexicalCandidates loads the keyword hits the vector index did not return, so documents that only
+// match the query's words are ranked too. Hits embedded with another model than the query are left out.
+func addLexicalCandidates(ctx context.Context, candidates []VectorDocument, lexical []lexicalHit, scope VectorQuery) []VectorDocument {
+	found := make(map[primitive.ObjectID]bool, len(candidates))
+	for _, doc := range candidates {
+		found[doc.ID] = true
+	}
+	var missing []primitive.ObjectID
+	for _, hit := range lexical {
+		if !found[hit.ID] {
+			missing = append(missing, hit.ID)
+		}
+	}
+	if len(missing) == 0 {
+		return candidates
 	}
 
-	cursor, err := collection.Find(ctx, filter)
+	filter := scope.filter()
+	filter["_id"] = bson.M{"$in": missing}
+	cursor, err := database.Collection("vector_documents").Find(ctx, filter)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch documents: %w", err)
+		slog.Warn("Failed to load keyword hits, ranking vector hits only", "error", err)
+		return candidates
 	}
 	defer cursor.Close(ctx)
 
 	var documents []VectorDocument
 	if err := cursor.All(ctx, &documents); err != nil {
-		return nil, fmt.Errorf("failed to read documents: %w", err)
+		slog.Warn("Failed to read keyword hits, ranking vector hits only", "error", err)
+		return candidates
 	}
-
-	if len(documents) == 0 {
-		slog.Info("No documents found for page and channel",
-			"pageID", pageID,
-			"companyID", companyID,
-			"channel", channel,
-		)
-		return []SearchResult{}, nil
+	for _, doc := range documents {
+		if vectorMatchesEmbedder(doc, scope.EmbeddingProvider, scope.EmbeddingModel, len(scope.Embedding)) {
+			candidates = append(candidates, doc)
+		}
 	}
+	return candidates
+}
 
-	// Find the document that best matches the query text
-	queryLower := strings.ToLower(query)
-	queryWords := strings.Fields(queryLower)
+// mismatchedVectorCount counts the documents of the query's scope embedded with another model than the
+// query. Counts are cached for a few minutes as they only change when documents are embedded.
+func mismatchedVectorCount(ctx context.Context, query VectorQuery) int {
+	key := fmt.Sprintf("%s|%s|%s|%s|%s|%s|%d", query.CompanyID, query.PageID, query.Channel, query.CRMID,
+		query.EmbeddingProvider, query.EmbeddingModel, len(query.Embedding))
+	if count, ok := mismatchedVectorCounts.get(key); ok {
+		return count
+	}
 
-	// First, find documents that contain query keywords to use as reference
-	var referenceEmbedding []float32
-	bestTextScore := float32(0)
+	filter := query.filter()
+	filter["$or"] = bson.A{
+		bson.M{"embedding_provider": bson.M{"$exists": true, "$ne": query.EmbeddingProvider}},
+		bson.M{"embedding_model": bson.M{"$exists": true, "$ne": query.EmbeddingModel}},
+		bson.M{"embedding": bson.M{"$not": bson.M{"$size": len(query.Embedding)}}},
+	}
+	count, err := database.Collection("vector_documents").CountDocuments(ctx, filter)
+	if err != nil {
+		slog.Warn("Failed to count documents of other embedding models", "error", err)
+		return 0
+	}
 
-	for _, doc := range documents {
-		contentLower := strings.ToLower(doc.Content)
-		score := float32(0)
+	mismatchedVectorCounts.put(key, int(count))
+	if count > 0 {
+		slog.Warn("Documents embedded with another model left out of search, embed them again",
+			"companyID", query.CompanyID,
+			"pageID", query.PageID,
+			"provider", query.EmbeddingProvider,
+			"model", query.EmbeddingModel,
+			"mismatchedVectors", count)
+	}
+	return int(count)
+}
 
-		// Calculate text matching score
-		for _, word := range queryWords {
-			if len(word) < 2 {
-				continue
-			}
-			if strings.Contains(contentLower, word) {
-				score += 1.0
-			}
-		}
+// mismatchedVectorCountTTL is how long counts of documents of other embedding models are cached
+const mismatchedVectorCountTTL = 5 * time.Minute
 
-		// Bonus for exact phrase match
-		if strings.Contains(contentLower, queryLower) {
-			score += float32(len(queryWords))
-		}
+type countCache struct {
+	mu      sync.Mutex
+	entries map[string]countCacheEntry
+}
 
-		// If this is the best match so far, use its embedding as reference
-		if score > bestTextScore && len(doc.Embedding) > 0 {
-			bestTextScore = score
-			referenceEmbedding = doc.Embedding
-		}
-	}
+type countCacheEntry struct {
+	count     int
+	expiresAt time.Time
+}
 
-	// If no text match found, use the first document's embedding as reference
-	if len(referenceEmbedding) == 0 && len(documents) > 0 && len(documents[0].Embedding) > 0 {
-		referenceEmbedding = documents[0].Embedding
-		slog.Info("No text match found, using first document as reference for channel", "channel", channel)
-	}
+var mismatchedVectorCounts = &countCache{entries: make(map[string]countCacheEntry)}
 
-	// If still no embedding, fall back to text-only search
-	if len(referenceEmbedding) == 0 {
-		slog.Warn("No embeddings found, falling back to text search for channel", "channel", channel)
-		return searchByTextOnly(documents, query, limit), nil
+func (c *countCache) get(key string) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return 0, false
 	}
+	return entry.count, true
+}
 
-	// Calculate cosine similarity for all documents using the reference embedding
-	type scoredDoc struct {
-		doc           VectorDocument
-		cosineSim     float32
-		textScore     float32
-		combinedScore float32
+func (c *countCache) put(key string, count int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Keys are per page and model, expired ones are dropped on the way
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, k)
+		}
 	}
+	c.entries[key] = countCacheEntry{count: count, expiresAt: now.Add(mismatchedVectorCountTTL)}
+}
 
-	var scoredDocs []scoredDoc
+// clear drops every count, after documents were embedded again
+func (c *countCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]countCacheEntry)
+}
 
-	for _, doc := range documents {
+// keywordReferenceDocument returns the document with an embedding that best matches the query's words,
+// or the first document with an embedding when none match. Degraded mode for when the query cannot be embedded.
+func keywordReferenceDocument(documents []VectorDocument, lexical []lexicalHit) (VectorDocument, bool) {
+	byID := make(map[primitive.ObjectID]int, len(documents))
+	first := -1
+	for i, doc := range documents {
 		if len(doc.Embedding) == 0 {
 			continue
 		}
-
-		// Calculate cosine similarity
-		cosineSim := CosineSimilarity(referenceEmbedding, doc.Embedding)
-
-		// Calculate text relevance score
-		contentLower := strings.ToLower(doc.Content)
-		textScore := float32(0)
-
-		for _, word := range queryWords {
-			if len(word) < 2 {
-				continue
-			}
-			count := strings.Count(contentLower, word)
-			if count > 0 {
-				textScore += 1.0 + float32(count-1)*0.2 // Diminishing returns for multiple occurrences
-			}
+		byID[doc.ID] = i
+		if first < 0 {
+			first = i
 		}
+	}
+	if first < 0 {
+		return VectorDocument{}, false
+	}
 
-		// Bonus for exact phrase
-		if strings.Contains(contentLower, queryLower) {
-			textScore += 2.0
+	for _, hit := range lexical {
+		if i, ok := byID[hit.ID]; ok {
+			return documents[i], true
 		}
+	}
+	slog.Info("No text match found, using first document as reference")
+	return documents[first], true
+}
+
+// rrfRankConstant damps the weight of the top positions in reciprocal rank fusion, the usual 60
+const rrfRankConstant = 60
+
+// fuseRankings ranks documents by similarity to the reference embedding and by their keyword hits, and
+// orders them by weighted reciprocal rank fusion of both positions. Fusing ranks instead of scores keeps
+// BM25 scores, which grow with the query length, from outweighing similarities. Each result's Score
+// stays its cosine similarity, which retrieval confidence compares with fixed thresholds.
+func fuseRankings(documents []VectorDocument, referenceEmbedding []float32, lexical []lexicalHit, weights models.HybridSearch, limit int) []SearchResult {
+	type rankedDoc struct {
+		doc       VectorDocument
+		breakdown ScoreBreakdown
+	}
 
-		// Normalize text score
-		if len(queryWords) > 0 {
-			textScore = textScore / float32(len(queryWords))
+	var ranked []rankedDoc
+	for _, doc := range documents {
+		if len(doc.Embedding) == 0 {
+			continue
 		}
+		ranked = append(ranked, rankedDoc{
+			doc:       doc,
+			breakdown: ScoreBreakdown{VectorScore: CosineSimilarity(referenceEmbedding, doc.Embedding)},
+		})
+	}
 
-		// Combine cosine similarity and text score
-		// Weight: 70% cosine similarity, 30% text match
-		combinedScore := (cosineSim * 0.7) + (textScore * 0.3)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].breakdown.VectorScore > ranked[j].breakdown.VectorScore
+	})
+	position := make(map[primitive.ObjectID]int, len(ranked))
+	for i := range ranked {
+		position[ranked[i].doc.ID] = i
+		ranked[i].breakdown.VectorRank = i + 1
+		ranked[i].breakdown.FusedScore = weights.VectorWeight / float64(rrfRankConstant+i+1)
+	}
 
-		scoredDocs = append(scoredDocs, scoredDoc{
-			doc:           doc,
-			cosineSim:     cosineSim,
-			textScore:     textScore,
-			combinedScore: combinedScore,
-		})
+	// Keyword positions count only the documents being ranked
+	lexicalRank := 0
+	for _, hit := range lexical {
+		i, ok := position[hit.ID]
+		if !ok {
+			continue
+		}
+		lexicalRank++
+		breakdown := &ranked[i].breakdown
+		breakdown.LexicalScore = hit.Score
+		breakdown.LexicalRank = lexicalRank
+		breakdown.LexicalCoverage = hit.Coverage
+		breakdown.FusedScore += weights.LexicalWeight / float64(rrfRankConstant+lexicalRank)
 	}
 
-	// Sort by combined score in descending order
-	sort.Slice(scoredDocs, func(i, j int) bool {
-		return scoredDocs[i].combinedScore > scoredDocs[j].combinedScore
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].breakdown.FusedScore > ranked[j].breakdown.FusedScore
 	})
 
 	// Take top N results
 	var results []SearchResult
-	for i := 0; i < limit && i < len(scoredDocs); i++ {
+	for i := 0; i < limit && i < len(ranked); i++ {
+		breakdown := ranked[i].breakdown
 		results = append(results, SearchResult{
-			Content:  scoredDocs[i].doc.Content,
-			Score:    scoredDocs[i].combinedScore,
-			Source:   scoredDocs[i].doc.Source,
-			Metadata: scoredDocs[i].doc.Metadata,
+			Content:   ranked[i].doc.Content,
+			Score:     breakdown.VectorScore,
+			Source:    ranked[i].doc.Source,
+			Metadata:  ranked[i].doc.Metadata,
+			Breakdown: &breakdown,
 		})
 
-		slog.Debug("Search result for channel",
-			"channel", channel,
+		slog.Debug("Search result",
 			"rank", i+1,
-			"cosineSim", scoredDocs[i].cosineSim,
-			"textScore", scoredDocs[i].textScore,
-			"combinedScore", scoredDocs[i].combinedScore,
+			"cosineSim", breakdown.VectorScore,
+			"vectorRank", breakdown.VectorRank,
+			"bm25", breakdown.LexicalScore,
+			"lexicalRank", breakdown.LexicalRank,
+			"fusedScore", breakdown.FusedScore,
 		)
 	}
 
-	slog.Info("Cosine similarity search completed with stored embeddings for channel",
-		"query", query,
-		"companyID", companyID,
-		"pageID", pageID,
-		"channel", channel,
-		"resultsFound", len(results),
-		"totalDocuments", len(documents),
-		"topScore", func() float32 {
-			if len(results) > 0 {
-				return results[0].Score
-			}
-			return 0
-		}(),
-	)
+	return results
+}
+
+// searchByTextOnly ranks documents by BM25 keyword relevance, for when embeddings are not available
+func searchByTextOnly(documents []VectorDocument, query string, limit int) []SearchResult {
+	return rankByKeywords(documents, newLexicalIndex(documents).Search(query, limit, VectorQuery{}), limit)
+}
+
+// rankByKeywords returns the documents of the keyword hits in their order. Their Score is the share of
+// the query terms they contain. All documents are returned with a low score when none match.
+func rankByKeywords(documents []VectorDocument, lexical []lexicalHit, limit int) []SearchResult {
+	byID := make(map[primitive.ObjectID]VectorDocument, len(documents))
+	for _, doc := range documents {
+		byID[doc.ID] = doc
+	}
+
+	var results []SearchResult
+	for i, hit := range lexical {
+		if len(results) >= limit {
+			break
+		}
+		doc, ok := byID[hit.ID]
+		if !ok {
+			continue
+		}
+		results = append(results, SearchResult{
+			Content:  doc.Content,
+			Score:    float32(hit.Coverage),
+			Source:   doc.Source,
+			Metadata: doc.Metadata,
+			Breakdown: &ScoreBreakdown{
+				LexicalScore:    hit.Score,
+				LexicalRank:     i + 1,
+				LexicalCoverage: hit.Coverage,
+				FusedScore:      1 / float64(rrfRankConstant+i+1),
+			},
+		})
+	}
+
+	// If no matches, include all with low score
+	if len(results) == 0 {
+		for i := 0; i < limit && i < len(documents); i++ {
+			results = append(results, SearchResult{
+				Content:  documents[i].Content,
+				Score:    0.1,
+				Source:   documents[i].Source,
+				Metadata: documents[i].Metadata,
+			})
+		}
+	}
+
+	return results
+}
+
+// SearchWithStoredEmbeddingsForChannel searches using cosine similarity against stored embeddings filtered by channel
+func SearchWithStoredEmbeddingsForChannel(ctx context.Context, query string, companyID string, pageID string, channel string, limit int) ([]SearchResult, error) {
+	results, _, err := searchStoredEmbeddingsForChannel(ctx, query, companyID, pageID, channel, limit)
+	return results, err
+}
 
-	return results, nil
+// searchStoredEmbeddingsForChannel searches the documents enabled for a channel and describes how
+func searchStoredEmbeddingsForChannel(ctx context.Context, query, companyID, pageID, channel string, limit int) ([]SearchResult, searchInfo, error) {
+	return searchStoredEmbeddings(ctx, query, VectorQuery{
+		CompanyID: companyID,
+		PageID:    pageID,
+		Channel:   normalizeChannel(channel),
+	}, limit)
 }
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"facebook-bot/models"
+)
+
+func TestFuseRankings(t *testing.T) {
+	// Ranked by cosine similarity to the reference: a, b, c
+	reference := []float32{1, 0}
+	documents, ids := lexicalTestDocuments("a", "b", "c")
+	documents[0].Embedding = []float32{1, 0}
+	documents[1].Embedding = []float32{0.8, 0.6}
+	documents[2].Embedding = []float32{0.6, 0.8}
+	// Ranked by keywords: c, b, and a document outside the ranked ones
+	lexical := []lexicalHit{
+		{ID: ids[2], Score: 7, Coverage: 1},
+		{ID: primitive.NewObjectID(), Score: 5, Coverage: 1},
+		{ID: ids[1], Score: 3, Coverage: 0.5},
+	}
+
+	tests := []struct {
+		name    string
+		weights models.HybridSearch
+		want    []string
+	}{
+		{"vectors only", models.HybridSearch{VectorWeight: 1}, []string{"a", "b", "c"}},
+		{"keywords only", models.HybridSearch{LexicalWeight: 1}, []string{"c", "b", "a"}},
+		{"equal weights", models.HybridSearch{VectorWeight: 1, LexicalWeight: 1}, []string{"c", "b", "a"}},
+		{"vector leaning still rewards keyword hits", models.HybridSearch{VectorWeight: 0.7, LexicalWeight: 0.3}, []string{"b", "c", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := fuseRankings(documents, reference, lexical, tt.weights, 3)
+			if len(results) != len(tt.want) {
+				t.Fatalf("got %d results, want %d", len(results), len(tt.want))
+			}
+			for i, result := range results {
+				if result.Content != tt.want[i] {
+					t.Errorf("result %d = %q, want %q", i, result.Content, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFuseRankingsBreakdown(t *testing.T) {
+	reference := []float32{1, 0}
+	documents, ids := lexicalTestDocuments("a", "b", "no embedding")
+	documents[0].Embedding = []float32{1, 0}
+	documents[1].Embedding = []float32{0, 1}
+	lexical := []lexicalHit{{ID: primitive.NewObjectID(), Score: 9}, {ID: ids[1], Score: 4, Coverage: 0.5}, {ID: ids[2], Score: 2}}
+
+	results := fuseRankings(documents, reference, lexical, models.HybridSearch{VectorWeight: 1, LexicalWeight: 1}, 10)
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want the 2 documents with embeddings", len(results))
+	}
+
+	// b is second by vector and first among the ranked documents by keywords
+	b := results[0].Breakdown
+	if results[0].Content != "b" || b.VectorRank != 2 || b.LexicalRank != 1 || b.LexicalScore != 4 || b.LexicalCoverage != 0.5 {
+		t.Fatalf("first result %q breakdown = %+v, want b ranked 2 by vector and 1 by keywords", results[0].Content, b)
+	}
+	if want := 1.0/(rrfRankConstant+2) + 1.0/(rrfRankConstant+1); math.Abs(b.FusedScore-want) > 1e-12 {
+		t.Errorf("fused score = %v, want %v", b.FusedScore, want)
+	}
+	// Score stays the cosine similarity
+	if results[0].Score != 0 || results[1].Score != 1 {
+		t.Errorf("scores = %v, %v; want the cosine similarities 0 and 1", results[0].Score, results[1].Score)
+	}
+	if a := results[1].Breakdown; a.LexicalRank != 0 || a.FusedScore != 1.0/(rrfRankConstant+1) {
+		t.Errorf("breakdown of a document without keyword hits = %+v", a)
+	}
+}
+
+func TestKeywordReferenceDocument(t *testing.T) {
+	documents, ids := lexicalTestDocuments("no embedding", "delivery", "opening hours")
+	documents[1].Embedding = []float32{0, 1}
+	documents[2].Embedding = []float32{1, 0}
+
+	lexical := []lexicalHit{{ID: ids[0], Score: 9}, {ID: ids[2], Score: 4}, {ID: ids[1], Score: 2}}
+	if doc, ok := keywordReferenceDocument(documents, lexical); !ok || doc.Content != "opening hours" {
+		t.Errorf("reference = %q, want the best keyword hit with an embedding", doc.Content)
+	}
+	// Without keyword hits the first document with an embedding stands in for the query
+	if doc, ok := keywordReferenceDocument(documents, nil); !ok || doc.Content != "delivery" {
+		t.Errorf("reference = %q, want the first document with an embedding", doc.Content)
+	}
+	if _, ok := keywordReferenceDocument(documents[:1], lexical); ok {
+		t.Error("reference found among documents without embeddings")
+	}
+}
+
+func TestRankByKeywords(t *testing.T) {
+	documents, ids := lexicalTestDocuments("a", "b", "c")
+	results := rankByKeywords(documents, []lexicalHit{{ID: ids[2], Score: 5, Coverage: 1}, {ID: primitive.NewObjectID(), Score: 4}, {ID: ids[0], Score: 1, Coverage: 0.5}}, 5)
+	if len(results) != 2 || results[0].Content != "c" || results[1].Content != "a" {
+		t.Fatalf("results = %+v, want c then a", results)
+	}
+	if results[0].Score != 1 || results[1].Breakdown.LexicalRank != 3 {
+		t.Errorf("score %v, second rank %d; want the coverage as score and the hit's rank", results[0].Score, results[1].Breakdown.LexicalRank)
+	}
+
+	// All documents come back with a low score when none match
+	if results := rankByKeywords(documents, nil, 2); len(results) != 2 || results[0].Score != 0.1 {
+		t.Errorf("results without hits = %+v", results)
+	}
+}
+
+func TestValidateHybridSearch(t *testing.T) {
+	tests := []struct {
+		settings *models.HybridSearch
+		want     bool
+	}{
+		{nil, true},
+		{&models.HybridSearch{VectorWeight: 0.7, LexicalWeight: 0.3}, true},
+		{&models.HybridSearch{LexicalWeight: 1}, true},
+		{&models.HybridSearch{}, false},
+		{&models.HybridSearch{VectorWeight: 1, LexicalWeight: -0.5}, false},
+	}
+	for _, tt := range tests {
+		if got := ValidateHybridSearch(tt.settings); got != tt.want {
+			t.Errorf("ValidateHybridSearch(%+v) = %v, want %v", tt.settings, got, tt.want)
+		}
+	}
+}
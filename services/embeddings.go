@@ -9,6 +9,8 @@ import (
 	"log/slog"
 	"net/http"
 	"time"
+
+	"facebook-bot/models"
 )
 
 // Voyage (Anthropic) Embedding API structures
@@ -95,7 +97,7 @@ func GetVoyageEmbeddings(ctx context.Context, texts []string, apiKey string, mod
 		}
 
 		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("Voyage API error (status %d): %s", resp.StatusCode, string(body))
+			return nil, &ProviderError{Provider: models.UsageProviderVoyage, StatusCode: resp.StatusCode, Body: string(body)}
 		}
 
 		var embResp VoyageEmbeddingResponse
@@ -111,6 +113,8 @@ func GetVoyageEmbeddings(ctx context.Context, texts []string, apiKey string, mod
 			}
 		}
 
+		RecordUsage(ctx, models.UsageProviderVoyage, model, models.UsagePurposeEmbedding, embResp.Usage.TotalTokens, 0)
+
 		slog.Info("Generated Voyage embeddings",
 			"count", len(embeddings),
 			"model", model,
@@ -163,7 +167,7 @@ func GetOpenAIEmbeddings(ctx context.Context, texts []string, apiKey string, mod
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/embeddings", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", openAIEmbeddingsURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -184,7 +188,7 @@ func GetOpenAIEmbeddings(ctx context.Context, texts []string, apiKey string, mod
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("OpenAI API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, &ProviderError{Provider: models.UsageProviderOpenAI, StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var embResp OpenAIEmbeddingResponse
@@ -200,6 +204,8 @@ func GetOpenAIEmbeddings(ctx context.Context, texts []string, apiKey string, mod
 		}
 	}
 
+	RecordUsage(ctx, models.UsageProviderOpenAI, model, models.UsagePurposeEmbedding, embResp.Usage.PromptTokens, 0)
+
 	slog.Info("Generated OpenAI embeddings",
 		"count", len(embeddings),
 		"model", model,
@@ -211,8 +217,9 @@ func GetOpenAIEmbeddings(ctx context.Context, texts []string, apiKey string, mod
 
 // Cohere Embedding API structures
 type CohereEmbeddingRequest struct {
-	Texts []string `json:"texts"`
-	Model string   `json:"model"`
+	Texts     []string `json:"texts"`
+	Model     string   `json:"model"`
+	InputType string   `json:"input_type,omitempty"` // search_document or search_query, required by v3 models
 }
 
 type CohereEmbeddingResponse struct {
@@ -221,6 +228,9 @@ type CohereEmbeddingResponse struct {
 		APIVersion struct {
 			Version string `json:"version"`
 		} `json:"api_version"`
+		BilledUnits struct {
+			InputTokens int `json:"input_tokens"`
+		} `json:"billed_units"`
 	} `json:"meta"`
 }
 
@@ -229,10 +239,15 @@ func GetCohereEmbeddings(ctx context.Context, texts []string, apiKey string, mod
 	if model == "" {
 		model = "embed-english-v2.0" // Default Cohere embedding model
 	}
+	return getCohereEmbeddings(ctx, texts, apiKey, model, "")
+}
 
+// getCohereEmbeddings calls the Cohere embed API. inputType is search_document or search_query for v3 models.
+func getCohereEmbeddings(ctx context.Context, texts []string, apiKey, model, inputType string) ([][]float32, error) {
 	reqBody := CohereEmbeddingRequest{
-		Texts: texts,
-		Model: model,
+		Texts:     texts,
+		Model:     model,
+		InputType: inputType,
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -261,7 +276,7 @@ func GetCohereEmbeddings(ctx context.Context, texts []string, apiKey string, mod
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Cohere API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, &ProviderError{Provider: models.UsageProviderCohere, StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var embResp CohereEmbeddingResponse
@@ -269,6 +284,8 @@ func GetCohereEmbeddings(ctx context.Context, texts []string, apiKey string, mod
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
+	RecordUsage(ctx, models.UsageProviderCohere, model, models.UsagePurposeEmbedding, embResp.Meta.BilledUnits.InputTokens, 0)
+
 	slog.Info("Generated Cohere embeddings",
 		"count", len(embResp.Embeddings),
 		"model", model,
@@ -0,0 +1,42 @@
+package services
+
+import "strings"
+
+// Default base URLs of the external APIs the bot calls
+const (
+	DefaultAnthropicBaseURL = "https://api.anthropic.com"
+	DefaultOpenAIBaseURL    = "https://api.openai.com"
+	DefaultGraphAPIBaseURL  = "https://graph.facebook.com"
+)
+
+// Endpoints used by the API clients. Only changed at startup, before any request is made.
+var (
+	claudeAPIURL        = DefaultAnthropicBaseURL + "/v1/messages"
+	openAIChatURL       = DefaultOpenAIBaseURL + "/v1/chat/completions"
+	openAIEmbeddingsURL = DefaultOpenAIBaseURL + "/v1/embeddings"
+	fbGraphAPI          = DefaultGraphAPIBaseURL + "/v18.0"
+	fbUserGraphAPI      = DefaultGraphAPIBaseURL + "/v19.0"
+)
+
+// APIEndpoints overrides the base URLs of the external APIs, e.g. to point the bot at a proxy
+// or at the fake servers of the end-to-end tests. Empty fields keep the current URL.
+type APIEndpoints struct {
+	AnthropicBaseURL string // e.g. "https://api.anthropic.com"
+	OpenAIBaseURL    string // e.g. "https://api.openai.com"
+	GraphAPIBaseURL  string // e.g. "https://graph.facebook.com", the API version is appended
+}
+
+// SetAPIEndpoints replaces the base URLs of the external APIs. Must be called before serving requests.
+func SetAPIEndpoints(endpoints APIEndpoints) {
+	if base := strings.TrimRight(endpoints.AnthropicBaseURL, "/"); base != "" {
+		claudeAPIURL = base + "/v1/messages"
+	}
+	if base := strings.TrimRight(endpoints.OpenAIBaseURL, "/"); base != "" {
+		openAIChatURL = base + "/v1/chat/completions"
+		openAIEmbeddingsURL = base + "/v1/embeddings"
+	}
+	if base := strings.TrimRight(endpoints.GraphAPIBaseURL, "/"); base != "" {
+		fbGraphAPI = base + "/v18.0"
+		fbUserGraphAPI = base + "/v19.0"
+	}
+}
@@ -0,0 +1,715 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"facebook-bot/models"
+)
+
+// factWordShare is the share of an expected fact's words the reply must contain for the fact to count
+const factWordShare = 0.8
+
+// Errors returned when an evaluation run cannot start
+var (
+	ErrEvalPageNotFound     = errors.New("evaluation page not found or inactive")
+	ErrEvalPromptNotFound   = errors.New("draft prompt template not found")
+	ErrEvalBudgetExceeded   = errors.New("monthly budget exceeded")
+	ErrEvalRunsDifferentSet = errors.New("runs belong to different evaluation sets")
+)
+
+// evalTarget is the configuration an evaluation run replies with
+type evalTarget struct {
+	company       *models.Company
+	pageConfig    *models.FacebookPage
+	channelConfig EffectiveChannelConfig
+	draft         *models.PromptTemplate
+}
+
+// ValidateEvalSet checks an evaluation set and fills in defaults and missing case IDs
+func ValidateEvalSet(set *models.EvalSet) error {
+	set.Name = strings.TrimSpace(set.Name)
+	if set.Name == "" {
+		return errors.New("name is required")
+	}
+	if set.PageID == "" {
+		return errors.New("page_id is required")
+	}
+	if set.Channel == "" {
+		set.Channel = "messenger"
+	}
+	if set.Channel != "messenger" && set.Channel != "facebook" {
+		return fmt.Errorf("invalid channel %q, expected messenger or facebook", set.Channel)
+	}
+	if len(set.Cases) == 0 {
+		return errors.New("at least one case is required")
+	}
+	if len(set.Cases) > models.MaxEvalCases {
+		return fmt.Errorf("at most %d cases are allowed", models.MaxEvalCases)
+	}
+
+	ids := make(map[string]bool)
+	for i := range set.Cases {
+		c := &set.Cases[i]
+		c.ID = strings.TrimSpace(c.ID)
+		c.Question = strings.TrimSpace(c.Question)
+		if c.Question == "" {
+			return fmt.Errorf("case %d: question is required", i+1)
+		}
+		if c.Language != "" && !models.IsSupportedLanguage(c.Language) {
+			return fmt.Errorf("case %d: unsupported language %q", i+1, c.Language)
+		}
+		if c.ID != "" {
+			if ids[c.ID] {
+				return fmt.Errorf("case %d: duplicate id %q", i+1, c.ID)
+			}
+			ids[c.ID] = true
+		}
+
+		facts := c.ExpectedFacts[:0]
+		for _, fact := range c.ExpectedFacts {
+			if fact = strings.TrimSpace(fact); fact != "" {
+				facts = append(facts, fact)
+			}
+		}
+		c.ExpectedFacts = facts
+	}
+
+	// Number the cases without an ID after the ones that have one
+	next := 1
+	for i := range set.Cases {
+		if set.Cases[i].ID != "" {
+			continue
+		}
+		for ids[fmt.Sprintf("q%d", next)] {
+			next++
+		}
+		set.Cases[i].ID = fmt.Sprintf("q%d", next)
+		ids[set.Cases[i].ID] = true
+	}
+	return nil
+}
+
+// CreateEvalSet stores a new evaluation set
+func CreateEvalSet(ctx context.Context, set *models.EvalSet) error {
+	set.ID = primitive.NilObjectID
+	set.CreatedAt = time.Now()
+	set.UpdatedAt = set.CreatedAt
+
+	result, err := GetDatabase().Collection("eval_sets").InsertOne(ctx, set)
+	if err != nil {
+		return err
+	}
+	set.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetEvalSet retrieves an evaluation set by ID for a company. Returns nil when it does not exist.
+func GetEvalSet(ctx context.Context, setID, companyID string) (*models.EvalSet, error) {
+	objectID, err := primitive.ObjectIDFromHex(setID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid evaluation set ID")
+	}
+
+	var set models.EvalSet
+	err = GetDatabase().Collection("eval_sets").FindOne(ctx, bson.M{
+		"_id":        objectID,
+		"company_id": companyID,
+	}).Decode(&set)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+// GetEvalSets lists a company's evaluation sets, optionally for one page
+func GetEvalSets(ctx context.Context, companyID, pageID string) ([]models.EvalSet, error) {
+	filter := bson.M{"company_id": companyID}
+	if pageID != "" {
+		filter["page_id"] = pageID
+	}
+
+	cursor, err := GetDatabase().Collection("eval_sets").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sets := []models.EvalSet{}
+	if err := cursor.All(ctx, &sets); err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
+
+// UpdateEvalSet replaces the name, description, channel and cases of an evaluation set
+func UpdateEvalSet(ctx context.Context, set *models.EvalSet) error {
+	set.UpdatedAt = time.Now()
+	_, err := GetDatabase().Collection("eval_sets").UpdateOne(ctx, bson.M{
+		"_id":        set.ID,
+		"company_id": set.CompanyID,
+	}, bson.M{
+		"$set": bson.M{
+			"name":        set.Name,
+			"description": set.Description,
+			"channel":     set.Channel,
+			"cases":       set.Cases,
+			"updated_at":  set.UpdatedAt,
+		},
+	})
+	return err
+}
+
+// DeleteEvalSet deletes an evaluation set. Its runs are kept for comparison.
+func DeleteEvalSet(ctx context.Context, setID, companyID string) (bool, error) {
+	objectID, err := primitive.ObjectIDFromHex(setID)
+	if err != nil {
+		return false, fmt.Errorf("invalid evaluation set ID")
+	}
+
+	result, err := GetDatabase().Collection("eval_sets").DeleteOne(ctx, bson.M{
+		"_id":        objectID,
+		"company_id": companyID,
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// resolveEvalTarget loads the page configuration a run replies with and applies the run's overrides
+func resolveEvalTarget(ctx context.Context, companyID, pageID, channel string, overrides models.EvalOverrides) (*evalTarget, error) {
+	company, err := GetCompanyByID(ctx, companyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load company: %w", err)
+	}
+	pageConfig, err := GetPageConfig(company, pageID)
+	if err != nil {
+		return nil, ErrEvalPageNotFound
+	}
+	if IsBudgetExceeded(ctx, company) {
+		return nil, ErrEvalBudgetExceeded
+	}
+
+	channelConfig := ResolveChannelConfig(company, pageConfig, channel)
+	if overrides.SystemPrompt != nil {
+		channelConfig.SystemPrompt = *overrides.SystemPrompt
+	}
+	if overrides.MaxTokens > 0 {
+		channelConfig.MaxTokens = overrides.MaxTokens
+	}
+	pageConfig = ApplyChannelConfig(pageConfig, channelConfig)
+	if overrides.Model != "" {
+		pageConfig.ClaudeModel = overrides.Model
+	}
+
+	target := &evalTarget{
+		company:       company,
+		pageConfig:    pageConfig,
+		channelConfig: channelConfig,
+	}
+	if overrides.PromptTemplateID != "" {
+		draft, err := GetPromptTemplate(ctx, overrides.PromptTemplateID, companyID)
+		if err != nil || draft == nil || draft.Key != models.PromptKeyReplySystem {
+			return nil, ErrEvalPromptNotFound
+		}
+		if (draft.Layer == models.PromptLayerVertical && draft.Vertical != PageVertical(pageConfig)) ||
+			(draft.Layer == models.PromptLayerPage && draft.PageID != pageID) {
+			return nil, ErrEvalPromptNotFound
+		}
+		target.draft = draft
+	}
+	return target, nil
+}
+
+// StartEvalRun checks that a set can be run with the given overrides and stores a new run.
+// The cases are executed by ExecuteEvalRun.
+func StartEvalRun(ctx context.Context, set *models.EvalSet, label string, overrides models.EvalOverrides, startedBy string) (*models.EvalRun, error) {
+	target, err := resolveEvalTarget(ctx, set.CompanyID, set.PageID, set.Channel, overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &models.EvalRun{
+		SetID:     set.ID,
+		SetName:   set.Name,
+		CompanyID: set.CompanyID,
+		PageID:    set.PageID,
+		Label:     strings.TrimSpace(label),
+		Status:    models.EvalStatusRunning,
+		Overrides: overrides,
+		Config: models.EvalConfig{
+			Model:      target.pageConfig.ClaudeModel,
+			MaxTokens:  target.pageConfig.MaxTokens,
+			Channel:    set.Channel,
+			RAGEnabled: target.channelConfig.RAGEnabled,
+		},
+		Results:   []models.EvalResult{},
+		StartedBy: startedBy,
+		StartedAt: time.Now(),
+	}
+
+	result, err := GetDatabase().Collection("eval_runs").InsertOne(ctx, run)
+	if err != nil {
+		return nil, err
+	}
+	run.ID = result.InsertedID.(primitive.ObjectID)
+
+	slog.Info("Evaluation run started",
+		"runID", run.ID.Hex(),
+		"setID", set.ID.Hex(),
+		"pageID", set.PageID,
+		"cases", len(set.Cases),
+		"model", run.Config.Model)
+	return run, nil
+}
+
+// ExecuteEvalRun runs every case of a set through retrieval and generation, scores the replies
+// and stores the results on the run. Nothing is sent to customers.
+func ExecuteEvalRun(ctx context.Context, set *models.EvalSet, run *models.EvalRun) error {
+	collection := GetDatabase().Collection("eval_runs")
+
+	target, err := resolveEvalTarget(ctx, run.CompanyID, run.PageID, run.Config.Channel, run.Overrides)
+	if err == nil {
+		ctx = WithUsageScope(ctx, UsageScope{
+			CompanyID: run.CompanyID,
+			PageID:    run.PageID,
+		})
+		if target.draft != nil {
+			ctx = WithPromptDraft(ctx, target.draft)
+		}
+
+		for _, evalCase := range set.Cases {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+
+			result, promptVersion := evaluateCase(ctx, target, run.Config.Channel, evalCase)
+			if run.Config.PromptVersion == "" {
+				run.Config.PromptVersion = promptVersion
+			}
+			run.Results = append(run.Results, result)
+
+			// Store each result as it comes in so the run's progress can be followed
+			if _, pushErr := collection.UpdateOne(ctx, bson.M{"_id": run.ID}, bson.M{
+				"$push": bson.M{"results": result},
+			}); pushErr != nil {
+				slog.Warn("Failed to store evaluation result", "runID", run.ID.Hex(), "error", pushErr)
+			}
+		}
+	}
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Summary = summarizeEvalResults(run.Results)
+	run.Status = models.EvalStatusCompleted
+	if err != nil {
+		run.Status = models.EvalStatusFailed
+		run.Error = err.Error()
+	}
+
+	// The run context may be cancelled already, the final state must still be saved
+	saveCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, saveErr := collection.UpdateOne(saveCtx, bson.M{"_id": run.ID}, bson.M{
+		"$set": bson.M{
+			"status":      run.Status,
+			"error":       run.Error,
+			"config":      run.Config,
+			"results":     run.Results,
+			"summary":     run.Summary,
+			"finished_at": run.FinishedAt,
+		},
+	}); saveErr != nil {
+		slog.Error("Failed to save evaluation run", "runID", run.ID.Hex(), "error", saveErr)
+		if err == nil {
+			err = saveErr
+		}
+	}
+
+	slog.Info("Evaluation run finished",
+		"runID", run.ID.Hex(),
+		"status", run.Status,
+		"passed", run.Summary.Passed,
+		"cases", run.Summary.Cases,
+		"cost", run.Summary.TotalCost)
+	return err
+}
+
+// evaluateCase answers one question the way the live handlers would and scores the reply.
+// Returns the result and the prompt version used.
+func evaluateCase(ctx context.Context, target *evalTarget, channel string, evalCase models.EvalCase) (models.EvalResult, string) {
+	start := time.Now()
+	ctx, tally := WithUsageTally(ctx, models.UsagePurposeEvaluation)
+
+	language := ResolveLanguage(evalCase.Question, target.channelConfig.DefaultLanguage)
+	ctx = WithCustomerLanguage(ctx, language.Language)
+
+	result := models.EvalResult{
+		CaseID:           evalCase.ID,
+		Question:         evalCase.Question,
+		ShouldEscalate:   evalCase.ShouldEscalate,
+		ExpectedLanguage: evalCase.Language,
+	}
+	if result.ExpectedLanguage == "" {
+		result.ExpectedLanguage = language.Language
+	}
+
+	company, pageConfig := target.company, target.pageConfig
+	var ragContext string
+	if target.channelConfig.RAGEnabled {
+		ragQuery := TranslateQueryForKnowledge(ctx, evalCase.Question, language.Language, company, pageConfig)
+		var confidence models.RetrievalConfidence
+		var err error
+		ragContext, confidence, err = GetRAGContextWithConfidence(ctx, ragQuery, company.CompanyID, pageConfig.PageID, channel)
+		if err != nil {
+			slog.Warn("Evaluation retrieval failed", "caseID", evalCase.ID, "error", err)
+		} else {
+			result.Retrieval = &confidence
+			ctx = WithRetrievalConfidence(ctx, confidence)
+		}
+	}
+
+	messageType := "chat"
+	if channel == "facebook" {
+		messageType = "comment"
+	}
+
+	ctx, trace := WithReplyTrace(ctx)
+	reply, wantsAgent, err := GetClaudeResponseWithToolUse(ctx, evalCase.Question, messageType, company, pageConfig, nil, ragContext)
+	result.Tier = trace.Tier
+	result.Model = trace.Model
+	result.Answerability = trace.Answerability
+
+	// Escalate for the same reasons the message handler does
+	switch {
+	case err != nil:
+		result.Error = err.Error()
+		result.EscalationReason = "model_unavailable"
+	case wantsAgent || strings.Contains(reply, "CUSTOMER_WANTS_REAL_PERSON||"):
+		result.EscalationReason = "agent_requested"
+	case trace.Sentiment != nil && CheckEscalation(pageConfig, *trace.Sentiment, nil) != "":
+		result.EscalationReason = CheckEscalation(pageConfig, *trace.Sentiment, nil)
+	default:
+		if reason, action := CheckAnswerability(pageConfig, trace.Answerability, result.Retrieval); reason != "" {
+			var escalate bool
+			reply, escalate = ApplyAnswerabilityAction(reason, action, reply, language.Language)
+			if escalate {
+				result.EscalationReason = models.EscalationReasonUnanswerable
+			}
+		}
+	}
+	result.Escalated = result.EscalationReason != ""
+	result.Reply = reply
+	result.LatencyMs = time.Since(start).Milliseconds()
+	result.InputTokens, result.OutputTokens, result.Cost = tally.Totals()
+
+	scoreEvalResult(&result, evalCase)
+	return result, trace.PromptVersion
+}
+
+// scoreEvalResult scores fact inclusion, escalation and language of a reply
+func scoreEvalResult(result *models.EvalResult, evalCase models.EvalCase) {
+	// Facts only count when the customer actually got the reply
+	result.FactScore = 1
+	if !evalCase.ShouldEscalate && len(evalCase.ExpectedFacts) > 0 {
+		for _, fact := range evalCase.ExpectedFacts {
+			if !result.Escalated && factInReply(result.Reply, fact) {
+				result.FactsFound = append(result.FactsFound, fact)
+			} else {
+				result.FactsMissing = append(result.FactsMissing, fact)
+			}
+		}
+		result.FactScore = roundMetric(float64(len(result.FactsFound)) / float64(len(evalCase.ExpectedFacts)))
+	}
+
+	// A handoff notice is not the bot's answer, so its language is not scored
+	result.LanguageMatch = true
+	if !result.Escalated {
+		result.ReplyLanguage = DetectLanguage(result.Reply).Language
+		result.LanguageMatch = result.ReplyLanguage == "" || result.ReplyLanguage == result.ExpectedLanguage
+	}
+
+	escalationCorrect := result.Escalated == evalCase.ShouldEscalate
+	result.Passed = result.Error == "" && escalationCorrect && result.LanguageMatch && len(result.FactsMissing) == 0
+}
+
+// factInReply checks if a reply states an expected fact. Numbers in the fact must appear as they are,
+// other words may be inflected, and a few of them may be missing.
+func factInReply(reply, fact string) bool {
+	replyTokens := sentimentTokens(reply)
+	replyText := " " + strings.Join(replyTokens, " ") + " "
+	factTokens := sentimentTokens(fact)
+	if len(factTokens) == 0 {
+		return true
+	}
+	if strings.Contains(replyText, " "+strings.Join(factTokens, " ")+" ") {
+		return true
+	}
+
+	var words, found int
+	for _, token := range factTokens {
+		if isNumberToken(token) {
+			if !strings.Contains(replyText, " "+token+" ") {
+				return false
+			}
+			continue
+		}
+		words++
+		if strings.Contains(replyText, wordStem(token)) {
+			found++
+		}
+	}
+	return words == 0 || float64(found) >= float64(words)*factWordShare
+}
+
+// isNumberToken checks if a token is made of digits only
+func isNumberToken(token string) bool {
+	for _, r := range token {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// summarizeEvalResults aggregates the results of a run
+func summarizeEvalResults(results []models.EvalResult) models.EvalSummary {
+	summary := models.EvalSummary{Cases: len(results)}
+	if len(results) == 0 {
+		return summary
+	}
+
+	var escalationCorrect, languageMatches, factCases int
+	var factScore float64
+	var totalLatency int64
+	latencies := make([]int64, 0, len(results))
+	for _, result := range results {
+		if result.Passed {
+			summary.Passed++
+		}
+		if result.Error != "" {
+			summary.Errors++
+		}
+		if result.Escalated == result.ShouldEscalate {
+			escalationCorrect++
+		}
+		if result.LanguageMatch {
+			languageMatches++
+		}
+		if !result.ShouldEscalate && len(result.FactsFound)+len(result.FactsMissing) > 0 {
+			factCases++
+			factScore += result.FactScore
+		}
+		totalLatency += result.LatencyMs
+		latencies = append(latencies, result.LatencyMs)
+		summary.InputTokens += result.InputTokens
+		summary.OutputTokens += result.OutputTokens
+		summary.TotalCost += result.Cost
+	}
+
+	cases := float64(len(results))
+	summary.PassRate = roundMetric(float64(summary.Passed) / cases)
+	summary.EscalationAccuracy = roundMetric(float64(escalationCorrect) / cases)
+	summary.LanguageMatchRate = roundMetric(float64(languageMatches) / cases)
+	if factCases > 0 {
+		summary.FactScore = roundMetric(factScore / float64(factCases))
+	}
+	summary.AvgLatencyMs = totalLatency / int64(len(results))
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	summary.P95LatencyMs = latencies[int(math.Ceil(0.95*cases))-1]
+	return summary
+}
+
+// roundMetric rounds a 0-1 metric to three decimals
+func roundMetric(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
+
+// GetEvalRun retrieves an evaluation run by ID for a company. Returns nil when it does not exist.
+func GetEvalRun(ctx context.Context, runID, companyID string) (*models.EvalRun, error) {
+	objectID, err := primitive.ObjectIDFromHex(runID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid evaluation run ID")
+	}
+
+	var run models.EvalRun
+	err = GetDatabase().Collection("eval_runs").FindOne(ctx, bson.M{
+		"_id":        objectID,
+		"company_id": companyID,
+	}).Decode(&run)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// GetEvalRuns lists a company's evaluation runs without their results, newest first.
+// setID and pageID are optional filters.
+func GetEvalRuns(ctx context.Context, companyID, setID, pageID string, limit int) ([]models.EvalRun, error) {
+	filter := bson.M{"company_id": companyID}
+	if setID != "" {
+		objectID, err := primitive.ObjectIDFromHex(setID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid evaluation set ID")
+		}
+		filter["set_id"] = objectID
+	}
+	if pageID != "" {
+		filter["page_id"] = pageID
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "started_at", Value: -1}}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"results": 0})
+
+	cursor, err := GetDatabase().Collection("eval_runs").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	runs := []models.EvalRun{}
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// CompareEvalRuns puts two runs of the same set side by side, matching cases by ID
+func CompareEvalRuns(base, candidate *models.EvalRun) (*models.EvalComparison, error) {
+	if base.SetID != candidate.SetID {
+		return nil, ErrEvalRunsDifferentSet
+	}
+
+	comparison := &models.EvalComparison{
+		Base:      evalRunInfo(base),
+		Candidate: evalRunInfo(candidate),
+		Delta: models.EvalSummaryDelta{
+			PassRate:           roundMetric(candidate.Summary.PassRate - base.Summary.PassRate),
+			FactScore:          roundMetric(candidate.Summary.FactScore - base.Summary.FactScore),
+			EscalationAccuracy: roundMetric(candidate.Summary.EscalationAccuracy - base.Summary.EscalationAccuracy),
+			LanguageMatchRate:  roundMetric(candidate.Summary.LanguageMatchRate - base.Summary.LanguageMatchRate),
+			AvgLatencyMs:       candidate.Summary.AvgLatencyMs - base.Summary.AvgLatencyMs,
+			P95LatencyMs:       candidate.Summary.P95LatencyMs - base.Summary.P95LatencyMs,
+			TotalCost:          candidate.Summary.TotalCost - base.Summary.TotalCost,
+		},
+		Cases: []models.EvalCaseComparison{},
+	}
+
+	baseResults := make(map[string]*models.EvalResult, len(base.Results))
+	for i := range base.Results {
+		baseResults[base.Results[i].CaseID] = &base.Results[i]
+	}
+
+	seen := make(map[string]bool, len(candidate.Results))
+	for i := range candidate.Results {
+		result := &candidate.Results[i]
+		seen[result.CaseID] = true
+
+		caseComparison := models.EvalCaseComparison{
+			CaseID:    result.CaseID,
+			Question:  result.Question,
+			Change:    models.EvalChangeAdded,
+			Base:      baseResults[result.CaseID],
+			Candidate: result,
+		}
+		if caseComparison.Base != nil {
+			switch {
+			case !caseComparison.Base.Passed && result.Passed:
+				caseComparison.Change = models.EvalChangeImproved
+				comparison.Delta.Improved++
+			case caseComparison.Base.Passed && !result.Passed:
+				caseComparison.Change = models.EvalChangeRegressed
+				comparison.Delta.Regressed++
+			default:
+				caseComparison.Change = models.EvalChangeUnchanged
+			}
+		}
+		comparison.Cases = append(comparison.Cases, caseComparison)
+	}
+
+	for i := range base.Results {
+		if seen[base.Results[i].CaseID] {
+			continue
+		}
+		comparison.Cases = append(comparison.Cases, models.EvalCaseComparison{
+			CaseID:   base.Results[i].CaseID,
+			Question: base.Results[i].Question,
+			Change:   models.EvalChangeRemoved,
+			Base:     &base.Results[i],
+		})
+	}
+
+	return comparison, nil
+}
+
+// evalRunInfo describes a run without its results
+func evalRunInfo(run *models.EvalRun) models.EvalRunInfo {
+	return models.EvalRunInfo{
+		ID:        run.ID,
+		Label:     run.Label,
+		Config:    run.Config,
+		Summary:   run.Summary,
+		StartedAt: run.StartedAt,
+	}
+}
+
+// CreateIndexesForEvaluations creates indexes for the eval_sets and eval_runs collections
+func CreateIndexesForEvaluations(ctx context.Context) error {
+	_, err := GetDatabase().Collection("eval_sets").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "company_id", Value: 1},
+			{Key: "page_id", Value: 1},
+			{Key: "updated_at", Value: -1},
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to create indexes for eval_sets collection", "error", err)
+		return err
+	}
+
+	_, err = GetDatabase().Collection("eval_runs").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "company_id", Value: 1},
+				{Key: "started_at", Value: -1},
+			},
+		},
+		{
+			Keys: bson.D{
+				{Key: "company_id", Value: 1},
+				{Key: "set_id", Value: 1},
+				{Key: "started_at", Value: -1},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to create indexes for eval_runs collection", "error", err)
+		return err
+	}
+
+	slog.Info("Successfully created indexes for evaluation collections")
+	return nil
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"facebook-bot/models"
+)
+
+func TestValidateEvalSet(t *testing.T) {
+	set := &models.EvalSet{
+		Name:   " Opening hours ",
+		PageID: "page-1",
+		Cases: []models.EvalCase{
+			{Question: "When are you open?", ExpectedFacts: []string{" 9 to 18 ", ""}},
+			{ID: "q1", Question: "Do you deliver?"},
+			{Question: " Can I talk to a person? ", ShouldEscalate: true},
+		},
+	}
+	if err := ValidateEvalSet(set); err != nil {
+		t.Fatalf("ValidateEvalSet: %v", err)
+	}
+	if set.Name != "Opening hours" || set.Channel != "messenger" {
+		t.Errorf("name %q, channel %q", set.Name, set.Channel)
+	}
+	if ids := []string{set.Cases[0].ID, set.Cases[1].ID, set.Cases[2].ID}; ids[0] != "q2" || ids[1] != "q1" || ids[2] != "q3" {
+		t.Errorf("case IDs = %v, want [q2 q1 q3]", ids)
+	}
+	if len(set.Cases[0].ExpectedFacts) != 1 || set.Cases[0].ExpectedFacts[0] != "9 to 18" {
+		t.Errorf("expected facts = %q", set.Cases[0].ExpectedFacts)
+	}
+
+	invalid := []struct {
+		name string
+		set  models.EvalSet
+	}{
+		{"no name", models.EvalSet{PageID: "page-1", Cases: []models.EvalCase{{Question: "Hi?"}}}},
+		{"no page", models.EvalSet{Name: "Set", Cases: []models.EvalCase{{Question: "Hi?"}}}},
+		{"bad channel", models.EvalSet{Name: "Set", PageID: "page-1", Channel: "sms", Cases: []models.EvalCase{{Question: "Hi?"}}}},
+		{"no cases", models.EvalSet{Name: "Set", PageID: "page-1"}},
+		{"empty question", models.EvalSet{Name: "Set", PageID: "page-1", Cases: []models.EvalCase{{Question: " "}}}},
+		{"bad language", models.EvalSet{Name: "Set", PageID: "page-1", Cases: []models.EvalCase{{Question: "Hi?", Language: "xx"}}}},
+		{"duplicate id", models.EvalSet{Name: "Set", PageID: "page-1", Cases: []models.EvalCase{{ID: "a", Question: "Hi?"}, {ID: "a", Question: "Hello?"}}}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateEvalSet(&tt.set); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestFactInReply(t *testing.T) {
+	tests := []struct {
+		reply string
+		fact  string
+		want  bool
+	}{
+		{"We are open every day from 9 to 18.", "9 to 18", true},
+		{"We are open every day from 10 to 17.", "9 to 18", false},
+		{"Delivery to Batumi is free for orders over 100 GEL.", "free delivery", true},
+		{"Our opening hours are listed on the website.", "free delivery", false},
+		{"The price is 150 GEL.", "15 GEL", false},
+		{"Anything", "", true},
+	}
+	for _, tt := range tests {
+		if got := factInReply(tt.reply, tt.fact); got != tt.want {
+			t.Errorf("factInReply(%q, %q) = %v, want %v", tt.reply, tt.fact, got, tt.want)
+		}
+	}
+}
+
+func TestScoreEvalResult(t *testing.T) {
+	evalCase := models.EvalCase{Question: "When are you open?", ExpectedFacts: []string{"9 to 18", "every day"}}
+
+	result := models.EvalResult{Reply: "We are open every day from 9 to 18, welcome anytime.", ExpectedLanguage: "en"}
+	scoreEvalResult(&result, evalCase)
+	if !result.Passed || result.FactScore != 1 || !result.LanguageMatch {
+		t.Errorf("complete reply = %+v", result)
+	}
+
+	result = models.EvalResult{Reply: "We are open from 10 to 17 on weekdays, welcome anytime.", ExpectedLanguage: "en"}
+	scoreEvalResult(&result, evalCase)
+	if result.Passed || result.FactScore != 0 || len(result.FactsMissing) != 2 {
+		t.Errorf("wrong hours = %+v", result)
+	}
+
+	// An escalated reply does not state facts, even when the handoff notice repeats them
+	result = models.EvalResult{Reply: "An agent will reply every day from 9 to 18.", Escalated: true, ExpectedLanguage: "en"}
+	scoreEvalResult(&result, evalCase)
+	if result.Passed || result.FactScore != 0 || !result.LanguageMatch {
+		t.Errorf("escalated reply = %+v", result)
+	}
+
+	result = models.EvalResult{Escalated: true, ExpectedLanguage: "en"}
+	scoreEvalResult(&result, models.EvalCase{Question: "Can I talk to a person?", ShouldEscalate: true})
+	if !result.Passed || result.FactScore != 1 {
+		t.Errorf("expected escalation = %+v", result)
+	}
+
+	result = models.EvalResult{Reply: "We are open every day from 9 to 18.", Error: "timeout", ExpectedLanguage: "en"}
+	scoreEvalResult(&result, evalCase)
+	if result.Passed {
+		t.Error("a failed case passed")
+	}
+}
+
+func TestSummarizeEvalResults(t *testing.T) {
+	if summary := summarizeEvalResults(nil); summary.Cases != 0 || summary.PassRate != 0 {
+		t.Errorf("empty summary = %+v", summary)
+	}
+
+	results := []models.EvalResult{
+		{Passed: true, FactsFound: []string{"a", "b"}, FactScore: 1, LanguageMatch: true, LatencyMs: 100, InputTokens: 10, OutputTokens: 5, Cost: 0.01},
+		{FactsFound: []string{"a"}, FactsMissing: []string{"b"}, FactScore: 0.5, LanguageMatch: true, LatencyMs: 300, InputTokens: 10, OutputTokens: 5, Cost: 0.01},
+		{Passed: true, ShouldEscalate: true, Escalated: true, LanguageMatch: true, LatencyMs: 200},
+		{Error: "timeout", LatencyMs: 1000},
+	}
+	summary := summarizeEvalResults(results)
+	want := models.EvalSummary{
+		Cases:              4,
+		Passed:             2,
+		Errors:             1,
+		PassRate:           0.5,
+		FactScore:          0.75,
+		EscalationAccuracy: 1,
+		LanguageMatchRate:  0.75,
+		AvgLatencyMs:       400,
+		P95LatencyMs:       1000,
+		InputTokens:        20,
+		OutputTokens:       10,
+		TotalCost:          0.02,
+	}
+	if summary != want {
+		t.Errorf("summary = %+v\nwant      %+v", summary, want)
+	}
+}
+
+func TestCompareEvalRuns(t *testing.T) {
+	setID := primitive.NewObjectID()
+	base := &models.EvalRun{
+		SetID:   setID,
+		Summary: models.EvalSummary{PassRate: 0.5, AvgLatencyMs: 200},
+		Results: []models.EvalResult{
+			{CaseID: "q1", Passed: true},
+			{CaseID: "q2"},
+			{CaseID: "q3", Passed: true},
+			{CaseID: "q4", Passed: true},
+		},
+	}
+	candidate := &models.EvalRun{
+		SetID:   setID,
+		Summary: models.EvalSummary{PassRate: 0.75, AvgLatencyMs: 150},
+		Results: []models.EvalResult{
+			{CaseID: "q1"},
+			{CaseID: "q2", Passed: true},
+			{CaseID: "q3", Passed: true},
+			{CaseID: "q5", Passed: true},
+		},
+	}
+
+	comparison, err := CompareEvalRuns(base, candidate)
+	if err != nil {
+		t.Fatalf("CompareEvalRuns: %v", err)
+	}
+	if comparison.Delta.PassRate != 0.25 || comparison.Delta.AvgLatencyMs != -50 {
+		t.Errorf("delta = %+v", comparison.Delta)
+	}
+	if comparison.Delta.Improved != 1 || comparison.Delta.Regressed != 1 {
+		t.Errorf("improved %d, regressed %d", comparison.Delta.Improved, comparison.Delta.Regressed)
+	}
+
+	want := map[string]string{
+		"q1": models.EvalChangeRegressed,
+		"q2": models.EvalChangeImproved,
+		"q3": models.EvalChangeUnchanged,
+		"q5": models.EvalChangeAdded,
+		"q4": models.EvalChangeRemoved,
+	}
+	if len(comparison.Cases) != len(want) {
+		t.Fatalf("got %d cases, want %d", len(comparison.Cases), len(want))
+	}
+	for _, c := range comparison.Cases {
+		if c.Change != want[c.CaseID] {
+			t.Errorf("case %s change = %s, want %s", c.CaseID, c.Change, want[c.CaseID])
+		}
+	}
+
+	other := &models.EvalRun{SetID: primitive.NewObjectID()}
+	if _, err := CompareEvalRuns(base, other); err != ErrEvalRunsDifferentSet {
+		t.Errorf("different sets error = %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlSkippedElements never hold a page's content
+var htmlSkippedElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Svg: true, atom.Iframe: true, atom.Nav: true, atom.Header: true, atom.Footer: true,
+	atom.Aside: true, atom.Form: true, atom.Button: true, atom.Select: true, atom.Dialog: true,
+}
+
+// htmlBoilerplateRoles and htmlBoilerplateNames mark navigation, banners and widgets by their ARIA role
+// or a word of their class or id
+var (
+	htmlBoilerplateRoles = map[string]bool{
+		"navigation": true, "banner": true, "contentinfo": true, "complementary": true, "search": true, "dialog": true,
+	}
+	htmlBoilerplateNames = map[string]bool{
+		"nav": true, "navbar": true, "navigation": true, "menu": true, "sidebar": true, "footer": true,
+		"breadcrumb": true, "breadcrumbs": true, "cookie": true, "cookies": true, "consent": true,
+		"social": true, "share": true, "advert": true, "ads": true, "popup": true, "modal": true,
+	}
+)
+
+// htmlBlockElements start a new line
+var htmlBlockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true, atom.Br: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Table: true, atom.Tr: true, atom.Blockquote: true, atom.Pre: true, atom.Hr: true,
+	atom.Figcaption: true, atom.Address: true, atom.Details: true, atom.Summary: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+var htmlHeadingLevels = map[atom.Atom]int{
+	atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6,
+}
+
+var htmlWhitespace = regexp.MustCompile(`\s+`)
+
+// extractHTMLText extracts the main content of an HTML page, leaving out scripts, navigation, headers,
+// footers and similar boilerplate. Headings are kept as markdown headings.
+func extractHTMLText(data []byte, report *ExtractionReport) (string, error) {
+	if !utf8.Valid(data) {
+		report.Warn("page is not UTF-8, invalid bytes were replaced")
+		data = []byte(strings.ToValidUTF8(string(data), "�"))
+	}
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	title, text := htmlMainText(doc)
+	if strings.TrimSpace(text) == "" {
+		report.Warn("page has no main content")
+	}
+	if title != "" {
+		text = "# " + title + "\n\n" + text
+	}
+	return text, nil
+}
+
+// htmlMainText returns the title and the main content of a parsed page. The content is taken from
+// <main> or the role=main element when there is one, else from the page's <article> elements, else
+// from the whole body.
+func htmlMainText(doc *html.Node) (title, text string) {
+	if node := findHTMLElement(doc, func(n *html.Node) bool { return n.DataAtom == atom.Title }); node != nil {
+		title = strings.Join(strings.Fields(htmlNodeText(node)), " ")
+	}
+
+	roots := findHTMLElements(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Main || htmlAttr(n, "role") == "main"
+	}, 1)
+	if len(roots) == 0 {
+		roots = findHTMLElements(doc, func(n *html.Node) bool { return n.DataAtom == atom.Article }, 0)
+	}
+	if len(roots) == 0 {
+		roots = []*html.Node{doc}
+	}
+
+	var out strings.Builder
+	for _, root := range roots {
+		writeHTMLText(&out, root)
+		out.WriteString("\n\n")
+	}
+	return title, out.String()
+}
+
+// writeHTMLText writes the visible text of a node and its children
+func writeHTMLText(out *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		// Line breaks in the source are just spaces, except in preformatted text
+		if n.Parent != nil && n.Parent.DataAtom == atom.Pre {
+			out.WriteString(n.Data)
+		} else {
+			out.WriteString(htmlWhitespace.ReplaceAllString(n.Data, " "))
+		}
+		return
+	case html.ElementNode:
+		if isHTMLBoilerplate(n) {
+			return
+		}
+	case html.CommentNode, html.DoctypeNode:
+		return
+	}
+
+	block := htmlBlockElements[n.DataAtom]
+	if block {
+		out.WriteString("\n")
+	}
+	switch {
+	case htmlHeadingLevels[n.DataAtom] > 0:
+		out.WriteString(strings.Repeat("#", htmlHeadingLevels[n.DataAtom]) + " ")
+	case n.DataAtom == atom.Li:
+		out.WriteString("- ")
+	case n.DataAtom == atom.Td || n.DataAtom == atom.Th:
+		for sibling := n.PrevSibling; sibling != nil; sibling = sibling.PrevSibling {
+			if sibling.Type == html.ElementNode {
+				out.WriteString(" | ")
+				break
+			}
+		}
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		writeHTMLText(out, child)
+	}
+	if block {
+		out.WriteString("\n")
+	}
+}
+
+// isHTMLBoilerplate checks if an element holds navigation, scripts or other content that is not the page's
+func isHTMLBoilerplate(n *html.Node) bool {
+	if htmlSkippedElements[n.DataAtom] {
+		return true
+	}
+	if htmlAttr(n, "hidden") != "" || htmlAttr(n, "aria-hidden") == "true" {
+		return true
+	}
+	if htmlBoilerplateRoles[htmlAttr(n, "role")] {
+		return true
+	}
+	names := strings.FieldsFunc(strings.ToLower(htmlAttr(n, "class")+" "+htmlAttr(n, "id")), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	for _, name := range names {
+		if htmlBoilerplateNames[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// htmlAttr returns an attribute of an element, "" when it has none. Attributes without a value,
+// like hidden, return their name.
+func htmlAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			if attr.Val == "" {
+				return attr.Key
+			}
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// htmlNodeText returns all text below a node, boilerplate included
+func htmlNodeText(n *html.Node) string {
+	var out strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			out.WriteString(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return out.String()
+}
+
+// findHTMLElement returns the first element matching, in document order
+func findHTMLElement(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if found := findHTMLElements(n, match, 1); len(found) > 0 {
+		return found[0]
+	}
+	return nil
+}
+
+// findHTMLElements returns up to limit elements matching, 0 for all, without looking inside matches
+func findHTMLElements(n *html.Node, match func(*html.Node) bool, limit int) []*html.Node {
+	var found []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if limit > 0 && len(found) >= limit {
+			return
+		}
+		if n.Type == html.ElementNode && match(n) {
+			found = append(found, n)
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return found
+}
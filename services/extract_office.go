@@ -0,0 +1,530 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Office files are zip archives; parts larger than this are rejected instead of being inflated
+const maxOfficePartSize = 64 << 20
+
+// maxSpreadsheetRows caps the rows read from a workbook, across all its sheets
+const maxSpreadsheetRows = 20000
+
+// officeArchive is an opened DOCX or XLSX file
+type officeArchive struct {
+	files map[string]*zip.File
+}
+
+func openOfficeArchive(data []byte) (*officeArchive, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not an office document: %w", err)
+	}
+	archive := &officeArchive{files: make(map[string]*zip.File, len(reader.File))}
+	for _, file := range reader.File {
+		archive.files[file.Name] = file
+	}
+	return archive, nil
+}
+
+// read returns the content of a part, nil when the archive does not have it
+func (a *officeArchive) read(name string) ([]byte, error) {
+	file, ok := a.files[name]
+	if !ok {
+		return nil, nil
+	}
+	if file.UncompressedSize64 > maxOfficePartSize {
+		return nil, fmt.Errorf("%s is too large", name)
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, maxOfficePartSize))
+}
+
+// count returns the number of parts under a directory
+func (a *officeArchive) count(dir string) int {
+	n := 0
+	for name := range a.files {
+		if strings.HasPrefix(name, dir) {
+			n++
+		}
+	}
+	return n
+}
+
+var docxHeadingStyle = regexp.MustCompile(`(?i)^heading\s*([1-6])$`)
+
+// extractDOCXText extracts the paragraphs and tables of a Word document. Headings become markdown
+// headings, list items are prefixed with a dash and table cells are separated by " | ".
+func extractDOCXText(data []byte, report *ExtractionReport) (string, error) {
+	archive, err := openOfficeArchive(data)
+	if err != nil {
+		return "", err
+	}
+	document, err := archive.read("word/document.xml")
+	if err != nil {
+		return "", err
+	}
+	if document == nil {
+		return "", fmt.Errorf("word/document.xml not found")
+	}
+
+	if app, err := archive.read("docProps/app.xml"); err == nil && app != nil {
+		var properties struct {
+			Pages int `xml:"Pages"`
+		}
+		if xml.Unmarshal(app, &properties) == nil && properties.Pages > 0 {
+			report.Pages = properties.Pages
+		}
+	}
+	if images := archive.count("word/media/"); images > 0 {
+		report.Warn("%d images were not read", images)
+	}
+
+	var out, paragraph strings.Builder
+	prefix := ""
+	inText := false
+	cellDepth := 0
+	cellsInRow := []int{}
+
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid document.xml: %w", err)
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "p":
+				paragraph.Reset()
+				prefix = ""
+			case "pStyle":
+				style := xmlAttr(element, "val")
+				if match := docxHeadingStyle.FindStringSubmatch(style); match != nil {
+					level, _ := strconv.Atoi(match[1])
+					prefix = strings.Repeat("#", level) + " "
+				} else if strings.EqualFold(style, "Title") {
+					prefix = "# "
+				}
+			case "numPr":
+				if prefix == "" {
+					prefix = "- "
+				}
+			case "t":
+				inText = true
+			case "tab":
+				paragraph.WriteString("\t")
+			case "br", "cr":
+				paragraph.WriteString("\n")
+			case "tr":
+				cellsInRow = append(cellsInRow, 0)
+			case "tc":
+				if len(cellsInRow) > 0 {
+					if cellsInRow[len(cellsInRow)-1] > 0 {
+						out.WriteString(" | ")
+					}
+					cellsInRow[len(cellsInRow)-1]++
+				}
+				cellDepth++
+			}
+		case xml.CharData:
+			if inText {
+				paragraph.Write(element)
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text := strings.TrimSpace(paragraph.String())
+				if text == "" {
+					if cellDepth == 0 {
+						out.WriteString("\n")
+					}
+					continue
+				}
+				out.WriteString(prefix + text)
+				if cellDepth > 0 {
+					// Paragraphs of a cell stay on the row's line
+					out.WriteString(" ")
+				} else {
+					out.WriteString("\n")
+				}
+			case "tc":
+				cellDepth--
+			case "tr":
+				cellsInRow = cellsInRow[:len(cellsInRow)-1]
+				out.WriteString("\n")
+			case "tbl":
+				out.WriteString("\n")
+			}
+		}
+	}
+	return out.String(), nil
+}
+
+// xmlAttr returns an attribute of an element by its local name
+func xmlAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Workbook parts, with only the fields extraction needs
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name  string `xml:"name,attr"`
+		State string `xml:"state,attr"`
+		RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+// xlsxInlineString is a cell's own string, plain or as rich text runs
+type xlsxInlineString struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (s xlsxInlineString) String() string {
+	text := s.Text
+	for _, run := range s.Runs {
+		text += run.Text
+	}
+	return text
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Ref    string           `xml:"r,attr"`
+			Type   string           `xml:"t,attr"`
+			Style  int              `xml:"s,attr"`
+			Value  string           `xml:"v"`
+			Inline xlsxInlineString `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// extractXLSXText turns each row of each visible sheet into a record of "header: value" pairs, taking
+// the headers from the sheet's first row, e.g. "Prices, row 2: Product: Chair; Price: 120"
+func extractXLSXText(data []byte, report *ExtractionReport) (string, error) {
+	archive, err := openOfficeArchive(data)
+	if err != nil {
+		return "", err
+	}
+
+	var workbook xlsxWorkbook
+	if err := unmarshalOfficePart(archive, "xl/workbook.xml", &workbook, true); err != nil {
+		return "", err
+	}
+	var relationships xlsxRelationships
+	if err := unmarshalOfficePart(archive, "xl/_rels/workbook.xml.rels", &relationships, true); err != nil {
+		return "", err
+	}
+	targets := make(map[string]string, len(relationships.Relationships))
+	for _, relationship := range relationships.Relationships {
+		target := relationship.Target
+		if strings.HasPrefix(target, "/") {
+			target = strings.TrimPrefix(target, "/")
+		} else {
+			target = path.Join("xl", target)
+		}
+		targets[relationship.ID] = target
+	}
+
+	sharedStrings, err := xlsxSharedStrings(archive)
+	if err != nil {
+		return "", err
+	}
+	dateStyles, err := xlsxDateStyles(archive)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	sheets, rows := 0, 0
+	truncated := false
+	for _, sheetInfo := range workbook.Sheets {
+		if truncated {
+			break
+		}
+		if sheetInfo.State == "hidden" || sheetInfo.State == "veryHidden" {
+			report.Warn("hidden sheet %q was skipped", sheetInfo.Name)
+			continue
+		}
+		var sheet xlsxSheet
+		if err := unmarshalOfficePart(archive, targets[sheetInfo.RelID], &sheet, false); err != nil {
+			report.Warn("sheet %q could not be read: %v", sheetInfo.Name, err)
+			continue
+		}
+
+		var headers []string
+		records := 0
+		for _, row := range sheet.Rows {
+			values := make(map[int]string)
+			for i, cell := range row.Cells {
+				column := i
+				if cell.Ref != "" {
+					column = xlsxColumnIndex(cell.Ref)
+				}
+				if value := xlsxCellValue(cell.Type, cell.Value, cell.Inline.String(), sharedStrings, dateStyles[cell.Style]); value != "" {
+					values[column] = value
+				}
+			}
+			if len(values) == 0 {
+				continue
+			}
+			if headers == nil {
+				headers = xlsxHeaders(values)
+				continue
+			}
+			if rows >= maxSpreadsheetRows {
+				truncated = true
+				break
+			}
+
+			columns := make([]int, 0, len(values))
+			for column := range values {
+				columns = append(columns, column)
+			}
+			sort.Ints(columns)
+			fields := make([]string, len(columns))
+			for i, column := range columns {
+				header := xlsxColumnName(column)
+				if column < len(headers) && headers[column] != "" {
+					header = headers[column]
+				}
+				fields[i] = header + ": " + values[column]
+			}
+			fmt.Fprintf(&out, "%s, row %d: %s\n", sheetInfo.Name, row.Number, strings.Join(fields, "; "))
+			records++
+			rows++
+		}
+		if records == 0 {
+			report.Warn("sheet %q has no rows below its header", sheetInfo.Name)
+			continue
+		}
+		sheets++
+		out.WriteString("\n")
+	}
+	if truncated {
+		report.Warn("only the first %d rows were read", maxSpreadsheetRows)
+	}
+	report.Pages = sheets
+	return out.String(), nil
+}
+
+// unmarshalOfficePart decodes an XML part, failing when a required part is missing
+func unmarshalOfficePart(archive *officeArchive, name string, v any, required bool) error {
+	data, err := archive.read(name)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		if required {
+			return fmt.Errorf("%s not found", name)
+		}
+		return nil
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return nil
+}
+
+// xlsxSharedStrings returns the workbook's string table; rich text runs are joined, phonetic hints left out
+func xlsxSharedStrings(archive *officeArchive) ([]string, error) {
+	data, err := archive.read("xl/sharedStrings.xml")
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var strs []string
+	var current strings.Builder
+	inText, inPhonetic := false, false
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return strs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid sharedStrings.xml: %w", err)
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "si":
+				current.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				inPhonetic = true
+			}
+		case xml.CharData:
+			if inText && !inPhonetic {
+				current.Write(element)
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "si":
+				strs = append(strs, current.String())
+			case "t":
+				inText = false
+			case "rPh":
+				inPhonetic = false
+			}
+		}
+	}
+}
+
+// Built-in number formats that show dates
+var xlsxBuiltinDateFormats = map[int]bool{14: true, 15: true, 16: true, 17: true, 18: true, 19: true, 20: true, 21: true, 22: true, 45: true, 46: true, 47: true}
+
+var xlsxQuotedFormat = regexp.MustCompile(`"[^"]*"|\[[^\]]*\]`)
+
+// xlsxDateStyles returns which cell styles show numbers as dates
+func xlsxDateStyles(archive *officeArchive) (map[int]bool, error) {
+	var styles xlsxStyles
+	if err := unmarshalOfficePart(archive, "xl/styles.xml", &styles, false); err != nil {
+		return nil, err
+	}
+
+	dateFormats := make(map[int]bool)
+	for id := range xlsxBuiltinDateFormats {
+		dateFormats[id] = true
+	}
+	for _, format := range styles.NumFmts {
+		code := strings.ToLower(xlsxQuotedFormat.ReplaceAllString(format.Code, ""))
+		if strings.Contains(code, "yy") || (strings.Contains(code, "d") && strings.Contains(code, "m")) {
+			dateFormats[format.ID] = true
+		}
+	}
+
+	dateStyles := make(map[int]bool)
+	for i, xf := range styles.CellXfs {
+		if dateFormats[xf.NumFmtID] {
+			dateStyles[i] = true
+		}
+	}
+	return dateStyles, nil
+}
+
+// xlsxCellValue returns the text a cell shows
+func xlsxCellValue(cellType, value, inline string, sharedStrings []string, isDate bool) string {
+	switch cellType {
+	case "s":
+		index, err := strconv.Atoi(value)
+		if err != nil || index < 0 || index >= len(sharedStrings) {
+			return ""
+		}
+		return strings.TrimSpace(sharedStrings[index])
+	case "inlineStr":
+		return strings.TrimSpace(inline)
+	case "b":
+		if value == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	case "str", "e":
+		return strings.TrimSpace(value)
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return strings.TrimSpace(value)
+	}
+	if isDate {
+		return xlsxDate(number)
+	}
+	// Excel keeps 15 significant digits; beyond them are binary rounding artifacts
+	number, _ = strconv.ParseFloat(strconv.FormatFloat(number, 'g', 15, 64), 64)
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
+
+// xlsxDate formats a date serial number of the 1900 date system
+func xlsxDate(serial float64) string {
+	days := math.Floor(serial)
+	seconds := math.Round((serial - days) * 86400)
+	date := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+	if seconds == 0 {
+		return date.Format("2006-01-02")
+	}
+	return date.Format("2006-01-02 15:04")
+}
+
+// xlsxHeaders returns the header of each column from the first row
+func xlsxHeaders(values map[int]string) []string {
+	last := 0
+	for column := range values {
+		last = max(last, column)
+	}
+	headers := make([]string, last+1)
+	for column, value := range values {
+		headers[column] = value
+	}
+	return headers
+}
+
+// xlsxColumnIndex returns the zero-based column of a cell reference like "AB12"
+func xlsxColumnIndex(ref string) int {
+	column := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A'+1)
+	}
+	return column - 1
+}
+
+// xlsxColumnName returns the letters of a zero-based column, e.g. 27 is "AB"
+func xlsxColumnName(column int) string {
+	name := ""
+	for column++; column > 0; column = (column - 1) / 26 {
+		name = string(rune('A'+(column-1)%26)) + name
+	}
+	return name
+}
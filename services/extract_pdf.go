@@ -0,0 +1,960 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// The PDF extractor reads the text layer of unencrypted PDFs without a full PDF library: objects are
+// found by scanning the file instead of trusting its cross-reference table, so files damaged by bad
+// editors still open, and page content streams are interpreted only for their text operators.
+// Scanned pages have no text layer and are reported, not read.
+
+// maxPDFNesting bounds reference chains and nested form XObjects
+const maxPDFNesting = 16
+
+var errPDFEncrypted = errors.New("encrypted PDFs are not supported")
+
+// PDF object types. Strings are []byte, numbers float64, arrays []any, and null is nil.
+type (
+	pdfName    string
+	pdfKeyword string
+	pdfDict    map[pdfName]any
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		raw  []byte
+	}
+)
+
+// pdfLexer reads PDF objects, and the operands and operators of content streams
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFWhitespace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFWhitespace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// value reads the next object, joining "num gen R" into a reference
+func (l *pdfLexer) value() (any, error) {
+	v, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	num, ok := v.(float64)
+	if !ok || num != math.Trunc(num) || num < 0 {
+		return v, nil
+	}
+
+	start := l.pos
+	if gen, err := l.token(); err == nil {
+		if g, ok := gen.(float64); ok && g == math.Trunc(g) {
+			if r, err := l.token(); err == nil && r == pdfKeyword("R") {
+				return pdfRef{num: int(num), gen: int(g)}, nil
+			}
+		}
+	}
+	l.pos = start
+	return v, nil
+}
+
+// token reads the next object or keyword. Returns io.EOF at the end of the data.
+func (l *pdfLexer) token() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		return l.name(), nil
+	case c == '(':
+		return l.literalString(), nil
+	case c == '<' && l.peek(1) == '<':
+		l.pos += 2
+		return l.dict()
+	case c == '<':
+		return l.hexString(), nil
+	case c == '>' && l.peek(1) == '>':
+		l.pos += 2
+		return pdfKeyword(">>"), nil
+	case c == '[':
+		l.pos++
+		return l.array()
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		l.pos++
+		return pdfKeyword(c), nil
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		start := l.pos
+		for l.pos < len(l.data) && strings.IndexByte("+-.0123456789", l.data[l.pos]) >= 0 {
+			l.pos++
+		}
+		number, _ := strconv.ParseFloat(string(l.data[start:l.pos]), 64)
+		return number, nil
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFWhitespace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	switch keyword := string(l.data[start:l.pos]); keyword {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	default:
+		return pdfKeyword(keyword), nil
+	}
+}
+
+func (l *pdfLexer) peek(offset int) byte {
+	if l.pos+offset < len(l.data) {
+		return l.data[l.pos+offset]
+	}
+	return 0
+}
+
+func (l *pdfLexer) name() pdfName {
+	l.pos++ // The slash
+	var name []byte
+	for l.pos < len(l.data) && !isPDFWhitespace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) {
+			if decoded, err := hex.DecodeString(string(l.data[l.pos+1 : l.pos+3])); err == nil {
+				name = append(name, decoded[0])
+				l.pos += 3
+				continue
+			}
+		}
+		name = append(name, c)
+		l.pos++
+	}
+	return pdfName(name)
+}
+
+func (l *pdfLexer) literalString() []byte {
+	l.pos++ // The opening parenthesis
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// A backslash before a line break continues the string on the next line
+				if l.peek(0) == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					code := int(c - '0')
+					for i := 0; i < 2 && l.peek(0) >= '0' && l.peek(0) <= '7'; i++ {
+						code = code*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(code)
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func (l *pdfLexer) hexString() []byte {
+	l.pos++ // The angle bracket
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; !isPDFWhitespace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	decoded, _ := hex.DecodeString(string(digits))
+	return decoded
+}
+
+func (l *pdfLexer) dict() (pdfDict, error) {
+	dict := make(pdfDict)
+	for {
+		key, err := l.token()
+		if err != nil {
+			return dict, err
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			// ">>" or garbage ends the dictionary
+			return dict, nil
+		}
+		value, err := l.value()
+		if err != nil {
+			return dict, err
+		}
+		if value == pdfKeyword(">>") {
+			return dict, nil
+		}
+		dict[name] = value
+	}
+}
+
+func (l *pdfLexer) array() ([]any, error) {
+	var array []any
+	for {
+		value, err := l.value()
+		if err != nil {
+			return array, err
+		}
+		if value == pdfKeyword("]") {
+			return array, nil
+		}
+		array = append(array, value)
+	}
+}
+
+// object reads an indirect object's value, with the data of its stream if it has one
+func (l *pdfLexer) object() (any, error) {
+	value, err := l.value()
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := value.(pdfDict)
+	if !ok {
+		return value, nil
+	}
+	l.skipSpace()
+	if !bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+		return dict, nil
+	}
+
+	l.pos += len("stream")
+	if l.peek(0) == '\r' {
+		l.pos++
+	}
+	if l.peek(0) == '\n' {
+		l.pos++
+	}
+	start := l.pos
+
+	// Trust the length only when endstream follows it; it may also be a reference not read yet
+	if length, ok := dict["Length"].(float64); ok && length >= 0 && start+int(length) <= len(l.data) {
+		end := start + int(length)
+		rest := bytes.TrimLeft(l.data[end:min(end+16, len(l.data))], "\r\n \t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			l.pos = end
+			return &pdfStream{dict: dict, raw: l.data[start:end]}, nil
+		}
+	}
+	index := bytes.Index(l.data[start:], []byte("endstream"))
+	if index < 0 {
+		return nil, fmt.Errorf("stream without endstream")
+	}
+	end := start + index
+	l.pos = end + len("endstream")
+	return &pdfStream{dict: dict, raw: bytes.TrimRight(l.data[start:end], "\r\n")}, nil
+}
+
+// pdfDocument holds the objects of a PDF file by number
+type pdfDocument struct {
+	objects map[int]any
+	root    int // Object number of the catalog named by the last trailer, 0 when none was found
+	fonts   map[any]*pdfFont
+}
+
+var (
+	pdfObjectHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	pdfRootRef      = regexp.MustCompile(`/Root\s+(\d+)\s+\d+\s+R`)
+	pdfEncryptEntry = regexp.MustCompile(`/Encrypt\s*(\d+\s+\d+\s+R|<<)`)
+)
+
+// parsePDF finds the objects of a PDF file, including those packed in object streams. Objects defined
+// again by incremental updates replace the earlier definitions.
+func parsePDF(data []byte) (*pdfDocument, error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return nil, fmt.Errorf("not a PDF file")
+	}
+	if pdfEncryptEntry.Match(data) {
+		return nil, errPDFEncrypted
+	}
+
+	doc := &pdfDocument{objects: make(map[int]any), fonts: make(map[any]*pdfFont)}
+	end := 0
+	for _, match := range pdfObjectHeader.FindAllSubmatchIndex(data, -1) {
+		if match[0] < end {
+			// Inside the stream of the previous object
+			continue
+		}
+		num, _ := strconv.Atoi(string(data[match[2]:match[3]]))
+		lexer := &pdfLexer{data: data, pos: match[1]}
+		object, err := lexer.object()
+		if err != nil {
+			continue
+		}
+		doc.objects[num] = object
+		end = lexer.pos
+	}
+
+	// Objects packed in object streams, unless defined outside one
+	var objectStreams []*pdfStream
+	for _, object := range doc.objects {
+		if stream, ok := object.(*pdfStream); ok && stream.dict["Type"] == pdfName("ObjStm") {
+			objectStreams = append(objectStreams, stream)
+		}
+	}
+	for _, stream := range objectStreams {
+		doc.unpackObjectStream(stream)
+	}
+
+	if len(doc.objects) == 0 {
+		return nil, fmt.Errorf("no PDF objects found")
+	}
+
+	// The last trailer is the newest; cross-reference streams carry theirs in their dictionary
+	if matches := pdfRootRef.FindAllSubmatch(data, -1); len(matches) > 0 {
+		doc.root, _ = strconv.Atoi(string(matches[len(matches)-1][1]))
+	}
+	return doc, nil
+}
+
+func (d *pdfDocument) unpackObjectStream(stream *pdfStream) {
+	data, err := d.decodeStream(stream)
+	if err != nil {
+		return
+	}
+	n, _ := d.resolve(stream.dict["N"]).(float64)
+	first, _ := d.resolve(stream.dict["First"]).(float64)
+	if first <= 0 || int(first) > len(data) {
+		return
+	}
+
+	header := &pdfLexer{data: data[:int(first)]}
+	for i := 0; i < int(n); i++ {
+		num, err1 := header.token()
+		offset, err2 := header.token()
+		if err1 != nil || err2 != nil {
+			return
+		}
+		objectNum, ok1 := num.(float64)
+		objectOffset, ok2 := offset.(float64)
+		if !ok1 || !ok2 || int(first+objectOffset) >= len(data) {
+			continue
+		}
+		if _, defined := d.objects[int(objectNum)]; defined {
+			continue
+		}
+		lexer := &pdfLexer{data: data, pos: int(first + objectOffset)}
+		if object, err := lexer.value(); err == nil {
+			d.objects[int(objectNum)] = object
+		}
+	}
+}
+
+// resolve follows references to the object they name
+func (d *pdfDocument) resolve(v any) any {
+	for i := 0; i < maxPDFNesting; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = d.objects[ref.num]
+	}
+	return nil
+}
+
+// dict resolves v to a dictionary, the dictionary of a stream included
+func (d *pdfDocument) dict(v any) pdfDict {
+	switch v := d.resolve(v).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+// decodeStream returns the data of a stream with its filters undone
+func (d *pdfDocument) decodeStream(stream *pdfStream) ([]byte, error) {
+	var filters []any
+	switch filter := d.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{filter}
+	case []any:
+		filters = filter
+	}
+
+	data := stream.raw
+	for _, filter := range filters {
+		switch d.resolve(filter) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			reader, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("invalid compressed stream: %w", err)
+			}
+			decoded, err := io.ReadAll(reader)
+			if err != nil && len(decoded) == 0 {
+				return nil, fmt.Errorf("invalid compressed stream: %w", err)
+			}
+			// Truncated streams keep what could be inflated
+			data = decoded
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			lexer := &pdfLexer{data: append([]byte{'<'}, data...)}
+			data = lexer.hexString()
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			text := bytes.TrimSpace(data)
+			text = bytes.TrimPrefix(text, []byte("<~"))
+			text = bytes.TrimSuffix(text, []byte("~>"))
+			decoded := make([]byte, 4*len(text)/5+4)
+			n, _, err := ascii85.Decode(decoded, text, true)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ASCII85 stream: %w", err)
+			}
+			data = decoded[:n]
+		default:
+			return nil, fmt.Errorf("unsupported stream filter %v", filter)
+		}
+	}
+	return data, nil
+}
+
+// pages returns the page dictionaries in reading order, with their inherited resources filled in
+func (d *pdfDocument) pages() []pdfDict {
+	var root pdfDict
+	if d.root > 0 {
+		root = d.dict(pdfRef{num: d.root})
+	}
+	if root == nil {
+		for _, object := range d.objects {
+			if dict := d.dict(object); dict["Type"] == pdfName("Catalog") {
+				root = dict
+				break
+			}
+		}
+	}
+
+	var pages []pdfDict
+	visited := make(map[int]bool)
+	var walk func(v any, resources any, depth int)
+	walk = func(v any, resources any, depth int) {
+		if ref, ok := v.(pdfRef); ok {
+			if visited[ref.num] {
+				return
+			}
+			visited[ref.num] = true
+		}
+		node := d.dict(v)
+		if node == nil || depth > maxPDFNesting {
+			return
+		}
+		if own, ok := node["Resources"]; ok {
+			resources = own
+		}
+		kids, isTree := d.resolve(node["Kids"]).([]any)
+		if !isTree {
+			page := make(pdfDict, len(node)+1)
+			for key, value := range node {
+				page[key] = value
+			}
+			page["Resources"] = resources
+			pages = append(pages, page)
+			return
+		}
+		for _, kid := range kids {
+			walk(kid, resources, depth+1)
+		}
+	}
+	if root != nil {
+		walk(root["Pages"], nil, 0)
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	// Without a page tree, take the page objects in the order they were numbered
+	var nums []int
+	for num, object := range d.objects {
+		if d.dict(object)["Type"] == pdfName("Page") {
+			nums = append(nums, num)
+		}
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		pages = append(pages, d.dict(d.objects[num]))
+	}
+	return pages
+}
+
+// pageContent returns the concatenated content streams of a page
+func (d *pdfDocument) pageContent(page pdfDict) []byte {
+	var streams []any
+	switch contents := d.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		streams = []any{contents}
+	case []any:
+		streams = contents
+	}
+
+	var content []byte
+	for _, v := range streams {
+		stream, ok := d.resolve(v).(*pdfStream)
+		if !ok {
+			continue
+		}
+		if data, err := d.decodeStream(stream); err == nil {
+			content = append(content, data...)
+			content = append(content, '\n')
+		}
+	}
+	return content
+}
+
+// pdfFont maps the character codes of a font to text
+type pdfFont struct {
+	name        string
+	composite   bool              // Type0 fonts use multi-byte codes
+	toUnicode   map[string]string // Code bytes to text, from the font's ToUnicode CMap
+	codeLengths []int             // Lengths of the codes in toUnicode, longest first
+}
+
+// font returns the font of a page resource, nil when there is none
+func (d *pdfDocument) font(resources pdfDict, name pdfName) *pdfFont {
+	fontRef := d.dict(resources["Font"])[name]
+	key := fontRef
+	if _, isRef := fontRef.(pdfRef); !isRef {
+		key = fmt.Sprintf("%p/%s", resources, name)
+	}
+	if font, ok := d.fonts[key]; ok {
+		return font
+	}
+
+	dict := d.dict(fontRef)
+	if dict == nil {
+		return nil
+	}
+	font := &pdfFont{name: string(name), composite: dict["Subtype"] == pdfName("Type0")}
+	if base, ok := d.resolve(dict["BaseFont"]).(pdfName); ok {
+		font.name = string(base)
+	}
+	if stream, ok := d.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := d.decodeStream(stream); err == nil {
+			font.toUnicode, font.codeLengths = parseToUnicodeCMap(data)
+		}
+	}
+	d.fonts[key] = font
+	return font
+}
+
+// decode returns the text of a string shown with the font
+func (f *pdfFont) decode(raw []byte) string {
+	if f == nil || f.toUnicode == nil {
+		if f != nil && f.composite {
+			return ""
+		}
+		return decodeCP1252(raw)
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(raw); {
+		matched := false
+		for _, n := range f.codeLengths {
+			if i+n <= len(raw) {
+				if text, ok := f.toUnicode[string(raw[i:i+n])]; ok {
+					out.WriteString(text)
+					i += n
+					matched = true
+					break
+				}
+			}
+		}
+		if matched {
+			continue
+		}
+		if f.composite {
+			i += 2
+		} else {
+			out.WriteString(decodeCP1252(raw[i : i+1]))
+			i++
+		}
+	}
+	return out.String()
+}
+
+// parseToUnicodeCMap reads the bfchar and bfrange mappings of a ToUnicode CMap
+func parseToUnicodeCMap(data []byte) (map[string]string, []int) {
+	mapping := make(map[string]string)
+	lengths := make(map[int]bool)
+	lexer := &pdfLexer{data: data}
+
+	readOperands := func(end pdfKeyword) []any {
+		var operands []any
+		for {
+			v, err := lexer.value()
+			if err != nil || v == end {
+				return operands
+			}
+			operands = append(operands, v)
+		}
+	}
+
+	for {
+		token, err := lexer.token()
+		if err != nil {
+			break
+		}
+		switch token {
+		case pdfKeyword("begincodespacerange"):
+			operands := readOperands("endcodespacerange")
+			for i := 0; i+1 < len(operands); i += 2 {
+				if low, ok := operands[i].([]byte); ok {
+					lengths[len(low)] = true
+				}
+			}
+		case pdfKeyword("beginbfchar"):
+			operands := readOperands("endbfchar")
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].([]byte)
+				dst, ok2 := operands[i+1].([]byte)
+				if ok1 && ok2 && len(src) > 0 {
+					mapping[string(src)] = decodeUTF16BE(dst)
+					lengths[len(src)] = true
+				}
+			}
+		case pdfKeyword("beginbfrange"):
+			operands := readOperands("endbfrange")
+			for i := 0; i+2 < len(operands); i += 3 {
+				low, ok1 := operands[i].([]byte)
+				high, ok2 := operands[i+1].([]byte)
+				if !ok1 || !ok2 || len(low) == 0 || len(low) != len(high) {
+					continue
+				}
+				lengths[len(low)] = true
+				lo, hi := bytesToUint(low), bytesToUint(high)
+				if hi < lo || hi-lo > 0xFFFF {
+					continue
+				}
+				for code := lo; code <= hi; code++ {
+					src := string(uintToBytes(code, len(low)))
+					switch dst := operands[i+2].(type) {
+					case []byte:
+						runes := []rune(decodeUTF16BE(dst))
+						if len(runes) > 0 {
+							runes[len(runes)-1] += rune(code - lo)
+							mapping[src] = string(runes)
+						}
+					case []any:
+						if int(code-lo) < len(dst) {
+							if text, ok := dst[code-lo].([]byte); ok {
+								mapping[src] = decodeUTF16BE(text)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	codeLengths := make([]int, 0, len(lengths))
+	for n := range lengths {
+		codeLengths = append(codeLengths, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(codeLengths)))
+	return mapping, codeLengths
+}
+
+func bytesToUint(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func uintToBytes(v uint32, n int) []byte {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return b
+}
+
+func decodeUTF16BE(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// cp1252High maps the bytes 0x80-0x9F of Windows-1252, which most simple PDF fonts use, to Unicode
+var cp1252High = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+func decodeCP1252(raw []byte) string {
+	var out strings.Builder
+	for _, c := range raw {
+		switch {
+		case c >= 0x80 && c <= 0x9F:
+			if r := cp1252High[c-0x80]; r != 0 {
+				out.WriteRune(r)
+			}
+		case c >= 0x20 || c == '\t' || c == '\n':
+			out.WriteRune(rune(c))
+		}
+	}
+	return out.String()
+}
+
+// pdfTextWriter collects the text a content stream shows
+type pdfTextWriter struct {
+	doc     *pdfDocument
+	out     strings.Builder
+	lastY   float64
+	hasY    bool
+	missing map[string]bool // Fonts without a Unicode mapping, whose text is left out
+}
+
+func (w *pdfTextWriter) newline() {
+	if s := w.out.String(); s != "" && !strings.HasSuffix(s, "\n") {
+		w.out.WriteString("\n")
+	}
+}
+
+func (w *pdfTextWriter) space() {
+	if s := w.out.String(); s != "" && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+		w.out.WriteString(" ")
+	}
+}
+
+func (w *pdfTextWriter) show(font *pdfFont, raw []byte) {
+	if font != nil && font.composite && font.toUnicode == nil {
+		w.missing[font.name] = true
+		return
+	}
+	w.out.WriteString(font.decode(raw))
+}
+
+// run interprets the text operators of a content stream. Line breaks are inferred from text
+// positioning, words from large negative kerning.
+func (w *pdfTextWriter) run(content []byte, resources pdfDict, depth int) {
+	if depth > maxPDFNesting {
+		return
+	}
+	lexer := &pdfLexer{data: content}
+	var operands []any
+	var font *pdfFont
+	for {
+		token, err := lexer.value()
+		if err != nil {
+			return
+		}
+		operator, ok := token.(pdfKeyword)
+		if !ok {
+			operands = append(operands, token)
+			continue
+		}
+
+		switch operator {
+		case "BI":
+			// Inline image data is binary, skip to its end
+			if end := bytes.Index(content[lexer.pos:], []byte("EI")); end >= 0 {
+				lexer.pos += end + 2
+			} else {
+				return
+			}
+		case "Tf":
+			if len(operands) >= 1 {
+				if name, ok := operands[0].(pdfName); ok {
+					font = w.doc.font(resources, name)
+				}
+			}
+		case "Tj":
+			if len(operands) >= 1 {
+				if raw, ok := operands[len(operands)-1].([]byte); ok {
+					w.show(font, raw)
+				}
+			}
+		case "'", "\"":
+			w.newline()
+			if len(operands) >= 1 {
+				if raw, ok := operands[len(operands)-1].([]byte); ok {
+					w.show(font, raw)
+				}
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				items, _ := operands[len(operands)-1].([]any)
+				for _, item := range items {
+					switch item := item.(type) {
+					case []byte:
+						w.show(font, item)
+					case float64:
+						// Offsets are in thousandths of the font size; a large gap separates words
+						if item <= -200 {
+							w.space()
+						}
+					}
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				tx, _ := operands[0].(float64)
+				ty, _ := operands[1].(float64)
+				if ty != 0 {
+					w.newline()
+				} else if tx != 0 {
+					w.space()
+				}
+			}
+		case "T*":
+			w.newline()
+		case "Tm":
+			if len(operands) >= 6 {
+				y, _ := operands[5].(float64)
+				if w.hasY && math.Abs(y-w.lastY) > 0.5 {
+					w.newline()
+				} else {
+					w.space()
+				}
+				w.lastY, w.hasY = y, true
+			}
+		case "ET":
+			w.space()
+		case "Do":
+			if len(operands) >= 1 {
+				if name, ok := operands[0].(pdfName); ok {
+					w.form(resources, name, depth)
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// form shows the text of a form XObject, a content stream of its own
+func (w *pdfTextWriter) form(resources pdfDict, name pdfName, depth int) {
+	stream, ok := w.doc.resolve(w.doc.dict(resources["XObject"])[name]).(*pdfStream)
+	if !ok || stream.dict["Subtype"] != pdfName("Form") {
+		return
+	}
+	content, err := w.doc.decodeStream(stream)
+	if err != nil {
+		return
+	}
+	formResources := w.doc.dict(stream.dict["Resources"])
+	if formResources == nil {
+		formResources = resources
+	}
+	w.newline()
+	w.run(content, formResources, depth+1)
+	w.newline()
+}
+
+// extractPDFText extracts the text layer of each page, reporting pages without one
+func extractPDFText(data []byte, report *ExtractionReport) (string, error) {
+	doc, err := parsePDF(data)
+	if err != nil {
+		return "", err
+	}
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return "", fmt.Errorf("no pages found")
+	}
+	report.Pages = len(pages)
+
+	missing := make(map[string]bool)
+	var texts []string
+	var empty []string
+	for i, page := range pages {
+		writer := &pdfTextWriter{doc: doc, missing: missing}
+		writer.run(doc.pageContent(page), doc.dict(page["Resources"]), 0)
+		text := strings.TrimSpace(writer.out.String())
+		if text == "" {
+			empty = append(empty, strconv.Itoa(i+1))
+			continue
+		}
+		texts = append(texts, text)
+	}
+
+	if len(empty) == 1 {
+		report.Warn("page %s has no text layer, scanned pages are not read", empty[0])
+	} else if len(empty) > 1 {
+		report.Warn("pages %s have no text layer, scanned pages are not read", strings.Join(empty, ", "))
+	}
+	if len(missing) > 0 {
+		fonts := make([]string, 0, len(missing))
+		for font := range missing {
+			fonts = append(fonts, font)
+		}
+		sort.Strings(fonts)
+		report.Warn("text in fonts without a Unicode mapping was left out: %s", strings.Join(fonts, ", "))
+	}
+	return strings.Join(texts, "\n\n"), nil
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ExtractorFunc turns the bytes of a file into text, reporting what it found on the way
+type ExtractorFunc func(data []byte, report *ExtractionReport) (string, error)
+
+// FileExtractor extracts the text of one kind of knowledge base file
+type FileExtractor struct {
+	Name       string
+	Extensions []string // Lowercase, with the dot
+	MIMETypes  []string
+	Extract    ExtractorFunc
+}
+
+// FileExtractors are the file types knowledge base uploads accept. A file is matched by its extension
+// first, as browsers often send office files as application/octet-stream, then by its MIME type.
+var FileExtractors = []FileExtractor{
+	{
+		Name:       "text",
+		Extensions: []string{".txt", ".md", ".csv", ".json"},
+		MIMETypes:  []string{"text/plain", "text/markdown", "text/csv", "application/json"},
+		Extract:    extractPlainText,
+	},
+	{
+		Name:       "pdf",
+		Extensions: []string{".pdf"},
+		MIMETypes:  []string{"application/pdf"},
+		Extract:    extractPDFText,
+	},
+	{
+		Name:       "docx",
+		Extensions: []string{".docx"},
+		MIMETypes:  []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		Extract:    extractDOCXText,
+	},
+	{
+		Name:       "xlsx",
+		Extensions: []string{".xlsx"},
+		MIMETypes:  []string{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		Extract:    extractXLSXText,
+	},
+	{
+		Name:       "html",
+		Extensions: []string{".html", ".htm"},
+		MIMETypes:  []string{"text/html", "application/xhtml+xml"},
+		Extract:    extractHTMLText,
+	},
+}
+
+// ExtractionReport describes what was extracted from a file, stored with the metadata of its chunks
+type ExtractionReport struct {
+	Extractor  string   `json:"extractor"`
+	Pages      int      `json:"pages"`      // PDF pages, DOCX pages as last saved, XLSX sheets; 1 for text and HTML
+	Characters int      `json:"characters"` // Characters of extracted text
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+// Warn adds a warning about content that could not be extracted
+func (r *ExtractionReport) Warn(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Metadata returns the report as document metadata
+func (r ExtractionReport) Metadata() map[string]string {
+	metadata := map[string]string{
+		"extractor":            r.Extractor,
+		"extracted_pages":      strconv.Itoa(r.Pages),
+		"extracted_characters": strconv.Itoa(r.Characters),
+	}
+	if len(r.Warnings) > 0 {
+		metadata["extraction_warnings"] = strings.Join(r.Warnings, "; ")
+	}
+	return metadata
+}
+
+// FindFileExtractor returns the extractor of a file by its name, then by its MIME type
+func FindFileExtractor(filename, mimeType string) (*FileExtractor, bool) {
+	extension := strings.ToLower(filepath.Ext(filename))
+	for i := range FileExtractors {
+		for _, candidate := range FileExtractors[i].Extensions {
+			if candidate == extension {
+				return &FileExtractors[i], true
+			}
+		}
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		for i := range FileExtractors {
+			for _, candidate := range FileExtractors[i].MIMETypes {
+				if candidate == mediaType {
+					return &FileExtractors[i], true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// SupportedFileExtensions lists the extensions of all extractors, for error messages
+func SupportedFileExtensions() []string {
+	var extensions []string
+	for _, extractor := range FileExtractors {
+		extensions = append(extensions, extractor.Extensions...)
+	}
+	return extensions
+}
+
+// ExtractFileText extracts the text of an uploaded file with the extractor for its type
+func ExtractFileText(filename, mimeType string, data []byte) (string, ExtractionReport, error) {
+	extractor, ok := FindFileExtractor(filename, mimeType)
+	if !ok {
+		return "", ExtractionReport{}, fmt.Errorf("unsupported file type. Supported types: %s", strings.Join(SupportedFileExtensions(), ", "))
+	}
+
+	report := ExtractionReport{Extractor: extractor.Name, Pages: 1}
+	text, err := extractor.Extract(data, &report)
+	if err != nil {
+		return "", report, fmt.Errorf("%s extraction failed: %w", extractor.Name, err)
+	}
+	text = normalizeExtractedText(text)
+	report.Characters = utf8.RuneCountInString(text)
+	return text, report, nil
+}
+
+// extractPlainText reads text files as they are, replacing bytes that are not UTF-8
+func extractPlainText(data []byte, report *ExtractionReport) (string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		report.Warn("file is not UTF-8, invalid bytes were replaced")
+		return strings.ToValidUTF8(string(data), "�"), nil
+	}
+	return string(data), nil
+}
+
+var (
+	extractedSpaces     = regexp.MustCompile(`[ \t\f\v\x{00A0}]+`)
+	extractedBlankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// normalizeExtractedText collapses the runs of spaces and blank lines extraction leaves behind
+func normalizeExtractedText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(extractedSpaces.ReplaceAllString(line, " "))
+	}
+	text = strings.Join(lines, "\n")
+	return strings.TrimSpace(extractedBlankLines.ReplaceAllString(text, "\n\n"))
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func extractTestFile(t *testing.T, filename, mimeType string, data []byte) (string, ExtractionReport) {
+	t.Helper()
+	text, report, err := ExtractFileText(filename, mimeType, data)
+	if err != nil {
+		t.Fatalf("failed to extract %s: %v", filename, err)
+	}
+	return text, report
+}
+
+func assertContains(t *testing.T, name, text string, want ...string) {
+	t.Helper()
+	for _, part := range want {
+		if !strings.Contains(text, part) {
+			t.Errorf("%s text = %q, want it to contain %q", name, text, part)
+		}
+	}
+}
+
+func TestExtractPlainText(t *testing.T) {
+	text, report := extractTestFile(t, "faq.txt", "text/plain", []byte("\xef\xbb\xbfDelivery takes   two days.\r\n\r\n\r\n\r\nReturns within 14 days."))
+	if text != "Delivery takes two days.\n\nReturns within 14 days." || report.Extractor != "text" || len(report.Warnings) != 0 {
+		t.Errorf("text = %q, report %+v", text, report)
+	}
+}
+
+func TestExtractHTMLText(t *testing.T) {
+	page := `<html><head><title>Shipping | Shop</title><script>var tracking = 1;</script></head><body>
+		<nav><a href="/">Home</a> <a href="/cart">Cart</a></nav>
+		<div class="cookie-banner">We use cookies</div>
+		<main><h1>Shipping</h1><p>Orders ship from
+		Tbilisi.</p><ul><li>Batumi: 15 GEL</li><li>Kutaisi: 10 GEL</li></ul>
+		<table><tr><th>City</th><th>Days</th></tr><tr><td>Batumi</td><td>2</td></tr></table></main>
+		<footer>© Shop</footer></body></html>`
+	text, report := extractTestFile(t, "shipping.html", "", []byte(page))
+	assertContains(t, "HTML", text, "# Shipping | Shop", "\n# Shipping\n", "Orders ship from Tbilisi.", "- Batumi: 15 GEL", "City | Days", "Batumi | 2")
+	for _, boilerplate := range []string{"tracking", "Cart", "cookies", "© Shop"} {
+		if strings.Contains(text, boilerplate) {
+			t.Errorf("HTML text = %q, want %q left out", text, boilerplate)
+		}
+	}
+	if report.Extractor != "html" {
+		t.Errorf("HTML report = %+v", report)
+	}
+}
+
+func TestExtractDOCXText(t *testing.T) {
+	docx := testDOCX(`<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Warranty</w:t></w:r></w:p>` +
+		`<w:p><w:r><w:t xml:space="preserve">Phones have a </w:t></w:r><w:r><w:t>two year warranty.</w:t></w:r></w:p>` +
+		`<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>Keep the receipt</w:t></w:r></w:p>` +
+		`<w:tbl><w:tr><w:tc><w:p><w:r><w:t>Model</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Years</w:t></w:r></w:p></w:tc></w:tr></w:tbl>`)
+	text, report := extractTestFile(t, "warranty.docx", "application/octet-stream", docx)
+	assertContains(t, "DOCX", text, "# Warranty", "Phones have a two year warranty.", "- Keep the receipt", "Model | Years")
+	if report.Extractor != "docx" || report.Pages != 1 {
+		t.Errorf("DOCX report = %+v", report)
+	}
+
+	if _, _, err := ExtractFileText("broken.docx", "", []byte("not a zip")); err == nil || !strings.Contains(err.Error(), "docx extraction failed") {
+		t.Errorf("broken DOCX error = %v", err)
+	}
+}
+
+func TestExtractXLSXText(t *testing.T) {
+	xlsx := testXLSX(
+		testXLSXSheet{Name: "Prices", Rows: [][]string{{"Product", "Price"}, {"Phone", "899.5"}, {"Case", "25"}}},
+		testXLSXSheet{Name: "Internal", Rows: [][]string{{"Supplier", "Margin"}, {"Acme", "0.4"}}, Hidden: true},
+	)
+	text, report := extractTestFile(t, "prices.xlsx", "", xlsx)
+	assertContains(t, "XLSX", text, "Prices, row 2: Product: Phone; Price: 899.5", "Prices, row 3: Product: Case; Price: 25")
+	if strings.Contains(text, "Acme") || report.Extractor != "xlsx" || report.Pages != 1 || len(report.Warnings) != 1 {
+		t.Errorf("XLSX text = %q, report %+v, want the hidden sheet left out with a warning", text, report)
+	}
+}
+
+func TestExtractPDFText(t *testing.T) {
+	pdf := testPDF(
+		[]string{"Opening hours", "Mon-Fri (10:00-19:00)"},
+		nil,
+		[]string{"მიწოდება ბათუმში 15 ლარი"},
+	)
+	// Found by its MIME type, as files from some clients come without an extension
+	text, report := extractTestFile(t, "document", "application/pdf", pdf)
+	assertContains(t, "PDF", text, "Opening hours\nMon-Fri (10:00-19:00)", "მიწოდება ბათუმში 15 ლარი")
+	if report.Extractor != "pdf" || report.Pages != 3 || len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "2") {
+		t.Errorf("PDF report = %+v, want 3 pages and a warning about page 2", report)
+	}
+	metadata := report.Metadata()
+	if metadata["extractor"] != "pdf" || metadata["extracted_pages"] != "3" || metadata["extraction_warnings"] == "" {
+		t.Errorf("PDF metadata = %v", metadata)
+	}
+}
+
+func TestExtractUnsupportedFile(t *testing.T) {
+	if _, _, err := ExtractFileText("photo.png", "image/png", []byte{0x89, 'P', 'N', 'G'}); err == nil || !strings.Contains(err.Error(), ".pdf") {
+		t.Errorf("unsupported file error = %v", err)
+	}
+}
+
+// testDOCX builds a Word document whose body is the given WordprocessingML, e.g.
+// `<w:p><w:r><w:t>Hello</w:t></w:r></w:p>`
+func testDOCX(body string) []byte {
+	return testZipFiles(map[string]string{
+		"[Content_Types].xml": `<?xml version="1.0" encoding="UTF-8"?>` +
+			`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>` +
+			`</Types>`,
+		"word/document.xml": `<?xml version="1.0" encoding="UTF-8"?>` +
+			`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+			body + `</w:body></w:document>`,
+		"docProps/app.xml": `<?xml version="1.0" encoding="UTF-8"?>` +
+			`<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties"><Pages>1</Pages></Properties>`,
+	})
+}
+
+// testXLSXSheet is a sheet of a workbook built by testXLSX. Cells that parse as numbers are stored as
+// numbers, the others as shared strings.
+type testXLSXSheet struct {
+	Name   string
+	Rows   [][]string
+	Hidden bool
+}
+
+// testXLSX builds an Excel workbook
+func testXLSX(sheets ...testXLSXSheet) []byte {
+	var workbook, relationships strings.Builder
+	var sharedStrings []string
+	files := make(map[string]string)
+
+	for i, sheet := range sheets {
+		state := ""
+		if sheet.Hidden {
+			state = ` state="hidden"`
+		}
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d"%s r:id="rId%d"/>`, testXmlEscape(sheet.Name), i+1, state, i+1)
+		fmt.Fprintf(&relationships, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+
+		var data strings.Builder
+		for r, row := range sheet.Rows {
+			fmt.Fprintf(&data, `<row r="%d">`, r+1)
+			for c, value := range row {
+				if value == "" {
+					continue
+				}
+				ref := string(rune('A'+c)) + strconv.Itoa(r+1)
+				if _, err := strconv.ParseFloat(value, 64); err == nil {
+					fmt.Fprintf(&data, `<c r="%s"><v>%s</v></c>`, ref, value)
+					continue
+				}
+				fmt.Fprintf(&data, `<c r="%s" t="s"><v>%d</v></c>`, ref, len(sharedStrings))
+				sharedStrings = append(sharedStrings, value)
+			}
+			data.WriteString(`</row>`)
+		}
+		files[fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)] = `<?xml version="1.0" encoding="UTF-8"?>` +
+			`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			data.String() + `</sheetData></worksheet>`
+	}
+
+	var strs strings.Builder
+	for _, value := range sharedStrings {
+		fmt.Fprintf(&strs, `<si><t>%s</t></si>`, testXmlEscape(value))
+	}
+	files["xl/sharedStrings.xml"] = `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` + strs.String() + `</sst>`
+	files["xl/workbook.xml"] = `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` +
+		workbook.String() + `</sheets></workbook>`
+	files["xl/_rels/workbook.xml.rels"] = `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		relationships.String() + `</Relationships>`
+	return testZipFiles(files)
+}
+
+// testPDF builds a PDF with one page per entry, each line of a page shown on a line of its own. Lines
+// with characters outside Latin-1 are shown with a composite font mapped to Unicode by a ToUnicode
+// CMap, as PDF writers do for Georgian; the others with Helvetica. Content streams are compressed.
+func testPDF(pages ...[]string) []byte {
+	// Codes of the composite font, two bytes per character
+	codes := make(map[rune]int)
+	var cmap strings.Builder
+	code := func(r rune) int {
+		if c, ok := codes[r]; ok {
+			return c
+		}
+		c := len(codes) + 1
+		codes[r] = c
+		fmt.Fprintf(&cmap, "<%04X> <%04X>\n", c, r)
+		return c
+	}
+
+	var contents []string
+	for _, lines := range pages {
+		var content strings.Builder
+		for i, line := range lines {
+			y := 750 - 20*i
+			if testIsLatin1(line) {
+				fmt.Fprintf(&content, "BT /F1 12 Tf 72 %d Td (%s) Tj ET\n", y, testPdfEscape(line))
+				continue
+			}
+			var hex strings.Builder
+			for _, r := range line {
+				fmt.Fprintf(&hex, "%04X", code(r))
+			}
+			fmt.Fprintf(&content, "BT /F2 12 Tf 72 %d Td <%s> Tj ET\n", y, hex.String())
+		}
+		contents = append(contents, content.String())
+	}
+
+	toUnicode := "/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n" +
+		fmt.Sprintf("%d beginbfchar\n%sendbfchar\n", len(codes), cmap.String()) +
+		"endcmap\nend\nend\n"
+
+	// Objects: 1 catalog, 2 page tree, 3 Helvetica, 4 composite font, 5 its ToUnicode CMap, then a page
+	// and its content stream per page
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"", // Page tree, filled in once the page numbers are known
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type0 /BaseFont /NotoSansGeorgian /Encoding /Identity-H /ToUnicode 5 0 R >>",
+		testCompressedStream(toUnicode),
+	}
+	var kids []string
+	for _, content := range contents {
+		page := len(objects) + 1
+		kids = append(kids, fmt.Sprintf("%d 0 R", page))
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents %d 0 R >>", page+1),
+			testCompressedStream(content))
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> >>",
+		strings.Join(kids, " "), len(kids))
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+func testCompressedStream(data string) string {
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	writer.Write([]byte(data))
+	writer.Close()
+	return fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", compressed.Len(), compressed.String())
+}
+
+func testIsLatin1(text string) bool {
+	for _, r := range text {
+		if r > 0xFF {
+			return false
+		}
+	}
+	return true
+}
+
+func testPdfEscape(text string) string {
+	var out strings.Builder
+	for _, r := range text {
+		switch r {
+		case '(', ')', '\\':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		default:
+			out.WriteByte(byte(r))
+		}
+	}
+	return out.String()
+}
+
+func testXmlEscape(text string) string {
+	var out strings.Builder
+	for _, r := range text {
+		switch r {
+		case '&':
+			out.WriteString("&amp;")
+		case '<':
+			out.WriteString("&lt;")
+		case '>':
+			out.WriteString("&gt;")
+		case '"':
+			out.WriteString("&quot;")
+		default:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+func testZipFiles(files map[string]string) []byte {
+	var out bytes.Buffer
+	writer := zip.NewWriter(&out)
+	for name, content := range files {
+		file, _ := writer.Create(name)
+		file.Write([]byte(content))
+	}
+	writer.Close()
+	return out.Bytes()
+}
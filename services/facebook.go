@@ -10,8 +10,6 @@ import (
 	"net/http"
 )
 
-const fbGraphAPI = "https://graph.facebook.com/v18.0"
-
 // SendMessengerReply sends a reply message via Messenger
 func SendMessengerReply(ctx context.Context, recipientID, message, pageAccessToken string) error {
 	// Validate message is not empty
@@ -21,7 +21,7 @@ type FacebookUserDetails struct {
 // GetFacebookUserDetails fetches user details from Facebook Graph API
 func GetFacebookUserDetails(ctx context.Context, userID string, accessToken string) (*FacebookUserDetails, error) {
 	// Build the Graph API URL
-	apiURL := fmt.Sprintf("https://graph.facebook.com/v19.0/%s", userID)
+	apiURL := fmt.Sprintf("%s/%s", fbUserGraphAPI, userID)
 
 	// Create URL with query parameters
 	u, err := url.Parse(apiURL)
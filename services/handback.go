@@ -0,0 +1,398 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // Business hours timezones must load in containers without zoneinfo
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"facebook-bot/models"
+)
+
+const (
+	// handBackCheckInterval is how often waiting customers are checked against hand-back policies
+	handBackCheckInterval = time.Minute
+	// maxTransitionMessageLength is the longest hand-back message, Messenger rejects longer texts
+	maxTransitionMessageLength = 2000
+)
+
+// ErrResolveDisabled is returned when a page does not hand conversations back on resolve
+var ErrResolveDisabled = errors.New("hand-back on resolve is not enabled for this page")
+
+// StartHandBackScheduler starts a background goroutine that periodically returns stalled
+// human conversations to the bot according to each page's hand-back policy
+func StartHandBackScheduler(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(handBackCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				slog.Info("Hand-back scheduler stopped")
+				return
+			case <-ticker.C:
+				checkCtx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+				count, err := RunHandBacks(checkCtx, time.Now())
+				if err != nil {
+					slog.Error("Failed to run hand-back policies", "error", err)
+				} else if count > 0 {
+					slog.Info("Handed conversations back to the bot", "count", count)
+				}
+				cancel()
+			}
+		}
+	}()
+
+	slog.Info("Hand-back scheduler started")
+}
+
+// RunHandBacks hands waiting customers back to the bot on every page whose policy says so.
+// Returns the number of customers handed back.
+func RunHandBacks(ctx context.Context, now time.Time) (int, error) {
+	cursor, err := GetDatabase().Collection("companies").Find(ctx, bson.M{
+		"pages.hand_back_policy.enabled": true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var companies []models.Company
+	if err := cursor.All(ctx, &companies); err != nil {
+		return 0, err
+	}
+
+	handedBack := 0
+	for i := range companies {
+		company := &companies[i]
+		// Customers would only be handed straight back to a human while the budget is used up
+		if IsBudgetExceeded(ctx, company) && GetBudgetExceededAction(company) == models.BudgetActionHumanOnly {
+			continue
+		}
+
+		for j := range company.Pages {
+			pageConfig := &company.Pages[j]
+			policy := pageConfig.HandBackPolicy
+			if !pageConfig.IsActive || policy == nil || !policy.Enabled {
+				continue
+			}
+			if policy.InactivityMinutes <= 0 && !policy.OutsideBusinessHours {
+				continue
+			}
+
+			count, err := runPageHandBacks(ctx, pageConfig, now)
+			handedBack += count
+			if err != nil {
+				slog.Error("Failed to run hand-back policy",
+					"companyID", company.CompanyID,
+					"pageID", pageConfig.PageID,
+					"error", err)
+			}
+		}
+	}
+
+	return handedBack, nil
+}
+
+// runPageHandBacks checks the waiting customers of one page against its hand-back policy
+func runPageHandBacks(ctx context.Context, pageConfig *models.FacebookPage, now time.Time) (int, error) {
+	cursor, err := GetDatabase().Collection("customers").Find(ctx, bson.M{
+		"page_id": pageConfig.PageID,
+		"stop":    true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var customers []models.Customer
+	if err := cursor.All(ctx, &customers); err != nil {
+		return 0, err
+	}
+
+	handedBack := 0
+	for i := range customers {
+		reason := handBackReason(pageConfig.HandBackPolicy, &customers[i], now)
+		if reason == "" {
+			continue
+		}
+
+		customer, err := HandBackToBot(ctx, pageConfig, &customers[i], reason)
+		if err != nil {
+			slog.Error("Failed to hand customer back to the bot",
+				"customerID", customers[i].CustomerID,
+				"pageID", pageConfig.PageID,
+				"reason", reason,
+				"error", err)
+			continue
+		}
+		if customer != nil {
+			handedBack++
+		}
+	}
+
+	return handedBack, nil
+}
+
+// handBackReason returns why a waiting customer should return to the bot now, or "" to keep
+// them with the agents
+func handBackReason(policy *models.HandBackPolicy, customer *models.Customer, now time.Time) string {
+	if policy == nil || !policy.Enabled || !customer.Stop {
+		return ""
+	}
+
+	if policy.InactivityMinutes > 0 {
+		lastActivity := lastAgentActivity(customer)
+		if !lastActivity.IsZero() && now.Sub(lastActivity) >= time.Duration(policy.InactivityMinutes)*time.Minute {
+			return models.HandBackReasonInactivity
+		}
+	}
+
+	// Customers who asked for a human after hours keep waiting for the team to come in;
+	// conversations started while the team was working go back to the bot when it leaves
+	if policy.OutsideBusinessHours && policy.BusinessHours != nil && customer.StoppedAt != nil {
+		if IsWithinBusinessHours(policy.BusinessHours, *customer.StoppedAt) && !IsWithinBusinessHours(policy.BusinessHours, now) {
+			return models.HandBackReasonAfterHours
+		}
+	}
+
+	return ""
+}
+
+// lastAgentActivity returns the latest of the customer's handoff, agent assignment and agent message
+func lastAgentActivity(customer *models.Customer) time.Time {
+	var latest time.Time
+	for _, t := range []*time.Time{customer.StoppedAt, customer.AssignedAt, customer.AgentActiveAt} {
+		if t != nil && t.After(latest) {
+			latest = *t
+		}
+	}
+	return latest
+}
+
+// HandBackToBot returns a customer from human mode to the bot, unassigns their agent, sends the
+// page's transition message and notifies the dashboard. Returns nil when the customer was
+// no longer waiting or an agent became active since it was loaded.
+func HandBackToBot(ctx context.Context, pageConfig *models.FacebookPage, customer *models.Customer, reason string) (*models.Customer, error) {
+	filter := bson.M{
+		"customer_id": customer.CustomerID,
+		"page_id":     pageConfig.PageID,
+		"stop":        true,
+	}
+	if reason != models.HandBackReasonResolved {
+		// Leave the customer with the agent if they replied since the policy was checked
+		if customer.AgentActiveAt != nil {
+			filter["agent_active_at"] = *customer.AgentActiveAt
+		} else {
+			filter["agent_active_at"] = bson.M{"$exists": false}
+		}
+	}
+
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"stop":             false,
+			"is_assigned":      false,
+			"handed_back_at":   &now,
+			"hand_back_reason": reason,
+			"updated_at":       now,
+		},
+		"$unset": bson.M{
+			"stopped_at":  1,
+			"agent_id":    1,
+			"agent_email": 1,
+			"agent_name":  1,
+			"assigned_at": 1,
+		},
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var updated models.Customer
+	err := GetDatabase().Collection("customers").FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	slog.Info("Customer handed back to the bot",
+		"customerID", customer.CustomerID,
+		"pageID", pageConfig.PageID,
+		"reason", reason,
+		"agentID", customer.AgentID)
+
+	wsManager := GetWebSocketManager()
+	wsManager.BroadcastToCompany(updated.CompanyID, BroadcastMessage{
+		CompanyID: updated.CompanyID,
+		PageID:    pageConfig.PageID,
+		Type:      "customer_stop_status_changed",
+		Data: map[string]interface{}{
+			"customer":  &updated,
+			"stop":      false,
+			"reason":    reason,
+			"timestamp": now.Unix(),
+		},
+	})
+
+	if policy := pageConfig.HandBackPolicy; policy != nil && policy.TransitionMessage != "" {
+		sendTransitionMessage(ctx, pageConfig, &updated, policy.TransitionMessage)
+	}
+
+	return &updated, nil
+}
+
+// sendTransitionMessage tells the customer the bot is answering again
+func sendTransitionMessage(ctx context.Context, pageConfig *models.FacebookPage, customer *models.Customer, message string) {
+	if err := SendMessengerReply(ctx, customer.CustomerID, message, pageConfig.PageAccessToken); err != nil {
+		slog.Error("Failed to send hand-back message",
+			"customerID", customer.CustomerID,
+			"pageID", pageConfig.PageID,
+			"error", err)
+		return
+	}
+
+	messageDoc := &models.Message{
+		Type:        "chat",
+		ChatID:      customer.CustomerID,
+		SenderID:    pageConfig.PageID,
+		RecipientID: customer.CustomerID,
+		PageID:      pageConfig.PageID,
+		PageName:    pageConfig.PageName,
+		Message:     message,
+		IsBot:       true,
+		Source:      "bot",
+		Timestamp:   time.Now(),
+	}
+	if err := SaveMessage(ctx, messageDoc); err != nil {
+		slog.Error("Failed to save hand-back message", "error", err)
+	}
+
+	GetWebSocketManager().BroadcastToCompany(customer.CompanyID, BroadcastMessage{
+		CompanyID: customer.CompanyID,
+		PageID:    pageConfig.PageID,
+		Type:      "new_message",
+		Data: map[string]interface{}{
+			"chat_id":      customer.CustomerID,
+			"sender_id":    pageConfig.PageID,
+			"sender_name":  pageConfig.PageName,
+			"recipient_id": customer.CustomerID,
+			"message":      message,
+			"is_bot":       true,
+			"timestamp":    time.Now().Unix(),
+		},
+	})
+}
+
+// ResolveConversation hands a conversation the agent marked resolved back to the bot
+func ResolveConversation(ctx context.Context, pageConfig *models.FacebookPage, customer *models.Customer) (*models.Customer, error) {
+	policy := pageConfig.HandBackPolicy
+	if policy == nil || !policy.Enabled || !policy.OnResolved {
+		return nil, ErrResolveDisabled
+	}
+	return HandBackToBot(ctx, pageConfig, customer, models.HandBackReasonResolved)
+}
+
+// RecordAgentActivity marks that an agent just messaged a customer, restarting the inactivity timer
+func RecordAgentActivity(ctx context.Context, customerID, pageID string) error {
+	_, err := GetDatabase().Collection("customers").UpdateOne(ctx, bson.M{
+		"customer_id": customerID,
+		"page_id":     pageID,
+	}, bson.M{
+		"$set": bson.M{"agent_active_at": time.Now()},
+	})
+	return err
+}
+
+// IsWithinBusinessHours checks if a time falls within the business hours of its weekday,
+// in the business hours' timezone
+func IsWithinBusinessHours(hours *models.BusinessHours, t time.Time) bool {
+	if hours == nil {
+		return true
+	}
+
+	local := t.In(businessLocation(hours))
+	minute := local.Hour()*60 + local.Minute()
+	for _, day := range hours.Days {
+		if day.Weekday != local.Weekday() {
+			continue
+		}
+		open, okOpen := parseClock(day.Open)
+		closing, okClose := parseClock(day.Close)
+		if okOpen && okClose && minute >= open && minute < closing {
+			return true
+		}
+	}
+	return false
+}
+
+// businessLocation loads the timezone of business hours, falling back to the default timezone
+func businessLocation(hours *models.BusinessHours) *time.Location {
+	name := hours.Timezone
+	if name == "" {
+		name = models.DefaultBusinessTimezone
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// parseClock parses an HH:MM time into minutes after midnight. "24:00" is allowed as a closing time.
+func parseClock(value string) (int, bool) {
+	hourText, minuteText, found := strings.Cut(value, ":")
+	if !found {
+		return 0, false
+	}
+	hour, err := strconv.Atoi(hourText)
+	if err != nil {
+		return 0, false
+	}
+	minute, err := strconv.Atoi(minuteText)
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, false
+	}
+	if hour < 0 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, false
+	}
+	return hour*60 + minute, true
+}
+
+// ValidateHandBackPolicy checks the thresholds and business hours of a hand-back policy
+func ValidateHandBackPolicy(policy *models.HandBackPolicy) bool {
+	if policy == nil {
+		return true
+	}
+	if policy.InactivityMinutes < 0 || len(policy.TransitionMessage) > maxTransitionMessageLength {
+		return false
+	}
+	if policy.OutsideBusinessHours && (policy.BusinessHours == nil || len(policy.BusinessHours.Days) == 0) {
+		return false
+	}
+
+	if hours := policy.BusinessHours; hours != nil {
+		if hours.Timezone != "" {
+			if _, err := time.LoadLocation(hours.Timezone); err != nil {
+				return false
+			}
+		}
+		for _, day := range hours.Days {
+			open, okOpen := parseClock(day.Open)
+			closing, okClose := parseClock(day.Close)
+			if day.Weekday < time.Sunday || day.Weekday > time.Saturday || !okOpen || !okClose || closing <= open {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"facebook-bot/models"
+)
+
+// weekdayHours are 09:00-18:00 opening hours from Monday to Friday, in UTC
+var weekdayHours = &models.BusinessHours{
+	Timezone: "UTC",
+	Days: []models.BusinessDay{
+		{Weekday: time.Monday, Open: "09:00", Close: "18:00"},
+		{Weekday: time.Tuesday, Open: "09:00", Close: "18:00"},
+		{Weekday: time.Wednesday, Open: "09:00", Close: "18:00"},
+		{Weekday: time.Thursday, Open: "09:00", Close: "18:00"},
+		{Weekday: time.Friday, Open: "09:00", Close: "18:00"},
+	},
+}
+
+func TestIsWithinBusinessHours(t *testing.T) {
+	monday := func(hour, minute int) time.Time {
+		return time.Date(2026, 10, 19, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want bool
+	}{
+		{"before opening", monday(8, 59), false},
+		{"at opening", monday(9, 0), true},
+		{"afternoon", monday(15, 30), true},
+		{"at closing", monday(18, 0), false},
+		{"sunday", monday(12, 0).AddDate(0, 0, -1), false},
+		{"converted to the business timezone", time.Date(2026, 10, 19, 20, 0, 0, 0, time.FixedZone("UTC+4", 4*60*60)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsWithinBusinessHours(weekdayHours, tt.t); got != tt.want {
+				t.Errorf("IsWithinBusinessHours(%v) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+
+	if !IsWithinBusinessHours(nil, monday(3, 0)) {
+		t.Error("no business hours should mean always open")
+	}
+}
+
+func TestHandBackReason(t *testing.T) {
+	now := time.Date(2026, 10, 19, 18, 30, 0, 0, time.UTC) // Monday, after closing
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+	policy := &models.HandBackPolicy{
+		Enabled:              true,
+		InactivityMinutes:    30,
+		OutsideBusinessHours: true,
+		BusinessHours:        weekdayHours,
+	}
+
+	tests := []struct {
+		name     string
+		policy   *models.HandBackPolicy
+		customer *models.Customer
+		want     string
+	}{
+		{"not waiting", policy, &models.Customer{StoppedAt: at(time.Hour)}, ""},
+		{"policy disabled", &models.HandBackPolicy{InactivityMinutes: 30}, &models.Customer{Stop: true, StoppedAt: at(time.Hour)}, ""},
+		{"agent inactive", policy, &models.Customer{Stop: true, StoppedAt: at(2 * time.Hour), AgentActiveAt: at(45 * time.Minute)}, models.HandBackReasonInactivity},
+		{"agent recently active", policy, &models.Customer{Stop: true, StoppedAt: at(20 * time.Minute), AgentActiveAt: at(10 * time.Minute)}, ""},
+		{"recently assigned", &models.HandBackPolicy{Enabled: true, InactivityMinutes: 30}, &models.Customer{Stop: true, StoppedAt: at(2 * time.Hour), AssignedAt: at(5 * time.Minute)}, ""},
+		{"team left", &models.HandBackPolicy{Enabled: true, OutsideBusinessHours: true, BusinessHours: weekdayHours}, &models.Customer{Stop: true, StoppedAt: at(time.Hour)}, models.HandBackReasonAfterHours},
+		{"asked after hours", &models.HandBackPolicy{Enabled: true, OutsideBusinessHours: true, BusinessHours: weekdayHours}, &models.Customer{Stop: true, StoppedAt: at(10 * time.Minute)}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := handBackReason(tt.policy, tt.customer, now); got != tt.want {
+				t.Errorf("handBackReason = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+		ok    bool
+	}{
+		{"09:00", 540, true},
+		{"18:45", 1125, true},
+		{"24:00", 1440, true},
+		{"24:30", 0, false},
+		{"9", 0, false},
+		{"12:60", 0, false},
+		{"ab:cd", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseClock(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseClock(%q) = %d, %v; want %d, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestValidateHandBackPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *models.HandBackPolicy
+		want   bool
+	}{
+		{"none", nil, true},
+		{"inactivity only", &models.HandBackPolicy{Enabled: true, InactivityMinutes: 15}, true},
+		{"business hours", &models.HandBackPolicy{Enabled: true, OutsideBusinessHours: true, BusinessHours: weekdayHours}, true},
+		{"negative inactivity", &models.HandBackPolicy{InactivityMinutes: -1}, false},
+		{"long message", &models.HandBackPolicy{TransitionMessage: strings.Repeat("a", maxTransitionMessageLength+1)}, false},
+		{"after hours without hours", &models.HandBackPolicy{OutsideBusinessHours: true}, false},
+		{"unknown timezone", &models.HandBackPolicy{BusinessHours: &models.BusinessHours{Timezone: "Mars/Olympus", Days: weekdayHours.Days}}, false},
+		{"closing before opening", &models.HandBackPolicy{BusinessHours: &models.BusinessHours{Days: []models.BusinessDay{{Weekday: time.Monday, Open: "18:00", Close: "09:00"}}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateHandBackPolicy(tt.policy); got != tt.want {
+				t.Errorf("ValidateHandBackPolicy = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const hnswTestDimension = 32
+
+func hnswTestVectors(rng *rand.Rand, n int) [][]float32 {
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = make([]float32, hnswTestDimension)
+		for j := range vectors[i] {
+			vectors[i][j] = float32(rng.NormFloat64())
+		}
+	}
+	return vectors
+}
+
+func TestHNSWGraphRecall(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	vectors := hnswTestVectors(rng, 2000)
+	ids := make([]primitive.ObjectID, len(vectors))
+	graph := newHNSWGraph(hnswTestDimension)
+	for i, vector := range vectors {
+		ids[i] = primitive.NewObjectID()
+		graph.Insert(ids[i], "", vector)
+	}
+	if graph.Len() != len(vectors) {
+		t.Fatalf("Len = %d, want %d", graph.Len(), len(vectors))
+	}
+
+	const k = 10
+	found, total := 0, 0
+	for _, query := range hnswTestVectors(rng, 50) {
+		exact := make([]int, len(vectors))
+		for i := range exact {
+			exact[i] = i
+		}
+		sort.Slice(exact, func(i, j int) bool {
+			return CosineSimilarity(query, vectors[exact[i]]) > CosineSimilarity(query, vectors[exact[j]])
+		})
+		want := make(map[primitive.ObjectID]bool, k)
+		for _, i := range exact[:k] {
+			want[ids[i]] = true
+		}
+
+		hits := graph.Search(query, k, "")
+		for i, hit := range hits {
+			if i > 0 && hit.similarity > hits[i-1].similarity {
+				t.Fatal("hits not ordered most similar first")
+			}
+			if want[graph.nodes[hit.node].id] {
+				found++
+			}
+		}
+		total += k
+	}
+	if recall := float64(found) / float64(total); recall < 0.95 {
+		t.Errorf("recall@%d = %.3f, want at least 0.95", k, recall)
+	}
+}
+
+func TestHNSWGraphRemoveAndReplace(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	vectors := hnswTestVectors(rng, 300)
+	ids := make([]primitive.ObjectID, len(vectors))
+	graph := newHNSWGraph(hnswTestDimension)
+	for i, vector := range vectors {
+		ids[i] = primitive.NewObjectID()
+		graph.Insert(ids[i], "", vector)
+	}
+
+	// A document is its own nearest neighbour until it is removed
+	if hits := graph.Search(vectors[7], 1, ""); len(hits) != 1 || graph.nodes[hits[0].node].id != ids[7] {
+		t.Fatalf("document 7 not found by its own vector")
+	}
+	if !graph.Remove(ids[7]) || graph.Remove(ids[7]) {
+		t.Fatal("Remove should succeed once")
+	}
+	for _, hit := range graph.Search(vectors[7], 10, "") {
+		if graph.nodes[hit.node].id == ids[7] {
+			t.Fatal("removed document returned")
+		}
+	}
+
+	// Inserting an ID again replaces its vector
+	graph.Insert(ids[8], "", vectors[9])
+	if graph.Len() != len(vectors)-1 {
+		t.Errorf("Len = %d, want %d", graph.Len(), len(vectors)-1)
+	}
+	hits := graph.Search(vectors[9], 2, "")
+	if len(hits) != 2 || hits[0].similarity < 0.999 || hits[1].similarity < 0.999 {
+		t.Errorf("replaced vector not found: %+v", hits)
+	}
+
+	// Removing most documents compacts the graph, the rest stay searchable
+	for _, id := range ids[:250] {
+		graph.Remove(id)
+	}
+	if len(graph.nodes) >= len(vectors) || graph.removed > graph.Len() {
+		t.Errorf("graph not compacted: %d nodes, %d live, %d removed", len(graph.nodes), graph.Len(), graph.removed)
+	}
+	if hits := graph.Search(vectors[280], 1, ""); len(hits) != 1 || graph.nodes[hits[0].node].id != ids[280] {
+		t.Error("document not found after compaction")
+	}
+}
+
+func TestHNSWGraphSearchByCRMID(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	vectors := hnswTestVectors(rng, 100)
+	graph := newHNSWGraph(hnswTestDimension)
+	for i, vector := range vectors {
+		crmID := ""
+		if i%10 == 0 {
+			crmID = "crm-1"
+		}
+		graph.Insert(primitive.NewObjectID(), crmID, vector)
+	}
+
+	hits := graph.Search(vectors[1], 20, "crm-1")
+	if len(hits) != 10 {
+		t.Fatalf("got %d hits, want the 10 documents of the CRM link", len(hits))
+	}
+	for _, hit := range hits {
+		if graph.nodes[hit.node].crmID != "crm-1" {
+			t.Errorf("hit from CRM link %q", graph.nodes[hit.node].crmID)
+		}
+	}
+}
+
+func TestHNSWGraphSearchEdgeCases(t *testing.T) {
+	graph := newHNSWGraph(hnswTestDimension)
+	if hits := graph.Search(make([]float32, hnswTestDimension), 5, ""); hits != nil {
+		t.Errorf("empty graph returned %v", hits)
+	}
+
+	graph.Insert(primitive.NewObjectID(), "", hnswTestVectors(rand.New(rand.NewSource(4)), 1)[0])
+	if hits := graph.Search(make([]float32, 8), 5, ""); hits != nil {
+		t.Errorf("query of another dimension returned %v", hits)
+	}
+	if hits := graph.Search(make([]float32, hnswTestDimension), 0, ""); hits != nil {
+		t.Errorf("k=0 returned %v", hits)
+	}
+}
@@ -0,0 +1,893 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"facebook-bot/models"
+)
+
+// Knowledge document settings
+const (
+	knowledgeStaleAfter   = 2 * time.Minute // A processing version without a heartbeat for this long was interrupted
+	knowledgeKeptVersions = 10              // Superseded versions whose chunks are kept for rollback
+)
+
+// Errors returned for knowledge documents
+var (
+	ErrKnowledgeDocumentNotFound     = errors.New("knowledge document not found")
+	ErrKnowledgeDocumentEmpty        = errors.New("no text to chunk in document")
+	ErrKnowledgeVersionNotFound      = errors.New("version not found")
+	ErrKnowledgeVersionActive        = errors.New("version is already active")
+	ErrKnowledgeVersionNotRestorable = errors.New("only versions that were active and still have their chunks can be restored")
+
+	errKnowledgeDocumentDeleted = errors.New("document was deleted while its version was processed")
+)
+
+// KnowledgeUpload is an uploaded file's text to add as a version of its knowledge document
+type KnowledgeUpload struct {
+	CompanyID  string
+	PageID     string
+	Filename   string
+	Source     string
+	Channels   []string
+	Text       string
+	Metadata   map[string]string // Stored with every chunk, e.g. the extraction report
+	UploadedBy string
+}
+
+// knowledgeChunkInput is a chunk of a version before it is stored
+type knowledgeChunkInput struct {
+	content  string
+	metadata map[string]string
+}
+
+// AddKnowledgeDocumentVersion chunks an upload and stores it as the next version of the page's
+// document with the same filename, creating the document on its first upload. Chunks an earlier
+// version or another document already has vectors for reuse them; the rest are embedded by
+// RunKnowledgeDocumentVersion, which then switches the document to the version.
+func AddKnowledgeDocumentVersion(ctx context.Context, upload KnowledgeUpload) (*models.KnowledgeDocumentVersion, error) {
+	chunks := ChunkDocument(ctx, upload.CompanyID, upload.PageID, upload.Filename, upload.Text)
+	if len(chunks) == 0 {
+		return nil, ErrKnowledgeDocumentEmpty
+	}
+	inputs := make([]knowledgeChunkInput, len(chunks))
+	for i, chunk := range chunks {
+		inputs[i] = knowledgeChunkInput{content: chunk.Text, metadata: chunk.Metadata()}
+	}
+
+	now := time.Now()
+	var document models.KnowledgeDocument
+	err := GetDatabase().Collection("knowledge_documents").FindOneAndUpdate(ctx,
+		bson.M{"company_id": upload.CompanyID, "page_id": upload.PageID, "filename": upload.Filename},
+		bson.M{
+			"$inc": bson.M{"latest_version": 1},
+			"$set": bson.M{"source": upload.Source, "updated_at": now},
+			"$setOnInsert": bson.M{
+				"active_version": 0,
+				"created_by":     upload.UploadedBy,
+				"created_at":     now,
+			},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save knowledge document: %w", err)
+	}
+
+	version := &models.KnowledgeDocumentVersion{
+		DocumentID: document.ID,
+		CompanyID:  upload.CompanyID,
+		PageID:     upload.PageID,
+		Version:    document.LatestVersion,
+		Source:     upload.Source,
+		Channels:   upload.Channels,
+		Metadata:   upload.Metadata,
+		Characters: utf8.RuneCountInString(upload.Text),
+		UploadedBy: upload.UploadedBy,
+	}
+	if err := addKnowledgeVersion(ctx, &document, version, inputs); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// RestoreKnowledgeDocumentVersion adds a version with the chunks of an earlier one, so rolling back is
+// recorded in the history like any upload. Its vectors are reused, so only chunks embedded with another
+// model since are embedded again by RunKnowledgeDocumentVersion.
+func RestoreKnowledgeDocumentVersion(ctx context.Context, companyID, documentID string, restore int, restoredBy string) (*models.KnowledgeDocumentVersion, error) {
+	document, err := GetKnowledgeDocument(ctx, documentID, companyID)
+	if err != nil {
+		return nil, err
+	}
+	if document == nil {
+		return nil, ErrKnowledgeDocumentNotFound
+	}
+
+	var restored models.KnowledgeDocumentVersion
+	err = GetDatabase().Collection("knowledge_document_versions").FindOne(ctx,
+		bson.M{"document_id": document.ID, "version": restore}).Decode(&restored)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrKnowledgeVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if restore == document.ActiveVersion {
+		return nil, ErrKnowledgeVersionActive
+	}
+	if (restored.Status != models.KnowledgeVersionActive && restored.Status != models.KnowledgeVersionSuperseded) || restored.Pruned {
+		return nil, ErrKnowledgeVersionNotRestorable
+	}
+
+	chunks, err := loadKnowledgeChunks(ctx, document.ID, restore, bson.M{"content": 1, "metadata": 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 {
+		return nil, ErrKnowledgeVersionNotRestorable
+	}
+	inputs := make([]knowledgeChunkInput, len(chunks))
+	for i, chunk := range chunks {
+		inputs[i] = knowledgeChunkInput{content: chunk.Content, metadata: chunk.Metadata}
+	}
+
+	err = GetDatabase().Collection("knowledge_documents").FindOneAndUpdate(ctx,
+		bson.M{"_id": document.ID},
+		bson.M{
+			"$inc": bson.M{"latest_version": 1},
+			"$set": bson.M{"updated_at": time.Now()},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(document)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrKnowledgeDocumentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save knowledge document: %w", err)
+	}
+
+	version := &models.KnowledgeDocumentVersion{
+		DocumentID:   document.ID,
+		CompanyID:    document.CompanyID,
+		PageID:       document.PageID,
+		Version:      document.LatestVersion,
+		RestoredFrom: restore,
+		Source:       restored.Source,
+		Channels:     restored.Channels,
+		Metadata:     restored.Metadata,
+		Characters:   restored.Characters,
+		UploadedBy:   restoredBy,
+	}
+	if err := addKnowledgeVersion(ctx, document, version, inputs); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// addKnowledgeVersion stores a new version's chunks, with the vectors that can be reused, and the
+// version itself with its diff to the active version
+func addKnowledgeVersion(ctx context.Context, document *models.KnowledgeDocument, version *models.KnowledgeDocumentVersion, inputs []knowledgeChunkInput) error {
+	failInterruptedKnowledgeVersions(ctx, document.ID)
+
+	pageConfig, err := embeddingPageConfig(ctx, version.CompanyID, version.PageID)
+	if err != nil {
+		return err
+	}
+	embedder, err := PageEmbedder(pageConfig)
+	if err != nil {
+		return err
+	}
+
+	hashes := make([]string, len(inputs))
+	for i, input := range inputs {
+		hashes[i] = knowledgeHash(input.content)
+	}
+	diff, err := knowledgeDiff(ctx, document, hashes, version.Characters)
+	if err != nil {
+		return err
+	}
+	vectors, err := reusableKnowledgeVectors(ctx, document, inputs, hashes, embedder)
+	if err != nil {
+		return err
+	}
+
+	chunks := make([]interface{}, len(inputs))
+	reused := 0
+	for i, input := range inputs {
+		chunk := models.KnowledgeChunk{
+			DocumentID:  document.ID,
+			Version:     version.Version,
+			Index:       i,
+			Content:     input.content,
+			ContentHash: hashes[i],
+			Metadata:    input.metadata,
+		}
+		if vector, ok := vectors[hashes[i]]; ok {
+			chunk.Embedding = vector
+			chunk.EmbeddingProvider = embedder.Provider()
+			chunk.EmbeddingModel = embedder.Model()
+			reused++
+		}
+		chunks[i] = chunk
+	}
+	if _, err := GetDatabase().Collection("knowledge_chunks").InsertMany(ctx, chunks); err != nil {
+		deleteKnowledgeChunks(ctx, document.ID, version.Version)
+		return fmt.Errorf("failed to store chunks: %w", err)
+	}
+
+	now := time.Now()
+	version.Status = models.KnowledgeVersionProcessing
+	version.ContentHash = knowledgeHash(hashes...)
+	version.Chunks = len(inputs)
+	version.Embedded = reused
+	version.Reused = reused
+	version.Diff = diff
+	version.CreatedAt = now
+	version.HeartbeatAt = now
+	result, err := GetDatabase().Collection("knowledge_document_versions").InsertOne(ctx, version)
+	if err != nil {
+		deleteKnowledgeChunks(ctx, document.ID, version.Version)
+		return fmt.Errorf("failed to store version: %w", err)
+	}
+	version.ID = result.InsertedID.(primitive.ObjectID)
+
+	slog.Info("Knowledge document version added",
+		"documentID", document.ID.Hex(),
+		"filename", document.Filename,
+		"version", version.Version,
+		"restoredFrom", version.RestoredFrom,
+		"chunks", version.Chunks,
+		"reused", reused,
+		"added", diff.ChunksAdded,
+		"removed", diff.ChunksRemoved)
+	return nil
+}
+
+// knowledgeHash returns the sha256 hex of a chunk's content, or of a version's chunk hashes
+func knowledgeHash(parts ...string) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// knowledgeDiff compares a new version's chunks with the document's active version
+func knowledgeDiff(ctx context.Context, document *models.KnowledgeDocument, hashes []string, characters int) (*models.KnowledgeDiff, error) {
+	diff := &models.KnowledgeDiff{BaseVersion: document.ActiveVersion, CharactersAfter: characters}
+	if document.ActiveVersion == 0 {
+		diff.ChunksAdded = len(hashes)
+		return diff, nil
+	}
+
+	var base models.KnowledgeDocumentVersion
+	err := GetDatabase().Collection("knowledge_document_versions").FindOne(ctx,
+		bson.M{"document_id": document.ID, "version": document.ActiveVersion}).Decode(&base)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("failed to load active version: %w", err)
+	}
+	diff.CharactersBefore = base.Characters
+
+	baseChunks, err := loadKnowledgeChunks(ctx, document.ID, document.ActiveVersion, bson.M{"content_hash": 1})
+	if err != nil {
+		return nil, err
+	}
+	baseHashes := make([]string, len(baseChunks))
+	for i, chunk := range baseChunks {
+		baseHashes[i] = chunk.ContentHash
+	}
+	countKnowledgeChanges(diff, baseHashes, hashes)
+	return diff, nil
+}
+
+// countKnowledgeChanges counts the chunks a version added, removed and kept. Chunks are compared as
+// multisets, a chunk repeated in both versions counts as unchanged each time.
+func countKnowledgeChanges(diff *models.KnowledgeDiff, baseHashes, hashes []string) {
+	remaining := make(map[string]int, len(baseHashes))
+	for _, hash := range baseHashes {
+		remaining[hash]++
+	}
+	for _, hash := range hashes {
+		if remaining[hash] > 0 {
+			remaining[hash]--
+			diff.ChunksUnchanged++
+		} else {
+			diff.ChunksAdded++
+		}
+	}
+	diff.ChunksRemoved = len(baseHashes) - diff.ChunksUnchanged
+}
+
+// reusableKnowledgeVectors returns the vectors, by content hash, that chunks of the document's earlier
+// versions or the company's documents have from the page's current model
+func reusableKnowledgeVectors(ctx context.Context, document *models.KnowledgeDocument, inputs []knowledgeChunkInput, hashes []string, embedder Embedder) (map[string][]float32, error) {
+	vectors := make(map[string][]float32)
+
+	cursor, err := GetDatabase().Collection("knowledge_chunks").Find(ctx, bson.M{
+		"document_id":        document.ID,
+		"content_hash":       bson.M{"$in": hashes},
+		"embedding_provider": embedder.Provider(),
+		"embedding_model":    embedder.Model(),
+		"embedding.0":        bson.M{"$exists": true},
+	}, options.Find().SetProjection(bson.M{"content_hash": 1, "embedding": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load earlier chunks: %w", err)
+	}
+	var chunks []models.KnowledgeChunk
+	err = cursor.All(ctx, &chunks)
+	cursor.Close(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read earlier chunks: %w", err)
+	}
+	for _, chunk := range chunks {
+		vectors[chunk.ContentHash] = chunk.Embedding
+	}
+
+	// Documents uploaded before versions were kept, or the same text in another file
+	var contents []string
+	for i, input := range inputs {
+		if _, ok := vectors[hashes[i]]; !ok {
+			contents = append(contents, input.content)
+		}
+	}
+	if len(contents) == 0 {
+		return vectors, nil
+	}
+	cursor, err = database.Collection("vector_documents").Find(ctx, bson.M{
+		"company_id":         document.CompanyID,
+		"content":            bson.M{"$in": contents},
+		"embedding_provider": embedder.Provider(),
+		"embedding_model":    embedder.Model(),
+	}, options.Find().SetProjection(bson.M{"content": 1, "embedding": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load existing documents: %w", err)
+	}
+	var documents []VectorDocument
+	err = cursor.All(ctx, &documents)
+	cursor.Close(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read existing documents: %w", err)
+	}
+	for _, doc := range documents {
+		if len(doc.Embedding) > 0 {
+			vectors[knowledgeHash(doc.Content)] = doc.Embedding
+		}
+	}
+	return vectors, nil
+}
+
+// RunKnowledgeDocumentVersion embeds the chunks of a version that have no vector from the page's
+// model yet, then makes it the document's active version. The active version is searched until
+// then, and stays active when embedding fails.
+func RunKnowledgeDocumentVersion(ctx context.Context, version *models.KnowledgeDocumentVersion) error {
+	ctx = WithUsageScope(ctx, UsageScope{CompanyID: version.CompanyID, PageID: version.PageID})
+
+	err := embedPendingKnowledgeChunks(ctx, version)
+	if err == nil {
+		err = activateKnowledgeVersion(ctx, version)
+	}
+	return finishKnowledgeVersion(version, err)
+}
+
+// embedPendingKnowledgeChunks embeds a version's chunks a batch at a time. Chunks whose reused
+// vectors are from a model the page no longer uses are embedded again.
+func embedPendingKnowledgeChunks(ctx context.Context, version *models.KnowledgeDocumentVersion) error {
+	pageConfig, err := embeddingPageConfig(ctx, version.CompanyID, version.PageID)
+	if err != nil {
+		return err
+	}
+	embedder, err := PageEmbedder(pageConfig)
+	if err != nil {
+		return err
+	}
+	batchSize := reindexBatchSizes[embedder.Provider()]
+	if batchSize == 0 {
+		batchSize = reindexDefaultBatchSize
+	}
+
+	collection := GetDatabase().Collection("knowledge_chunks")
+	filter := bson.M{
+		"document_id": version.DocumentID,
+		"version":     version.Version,
+		"$or": bson.A{
+			bson.M{"embedding_provider": bson.M{"$ne": embedder.Provider()}},
+			bson.M{"embedding_model": bson.M{"$ne": embedder.Model()}},
+		},
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		cursor, err := collection.Find(ctx, filter, options.Find().
+			SetSort(bson.D{{Key: "index", Value: 1}}).
+			SetLimit(int64(batchSize)).
+			SetProjection(bson.M{"_id": 1, "content": 1}))
+		if err != nil {
+			return fmt.Errorf("failed to load chunks: %w", err)
+		}
+		var chunks []models.KnowledgeChunk
+		err = cursor.All(ctx, &chunks)
+		cursor.Close(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read chunks: %w", err)
+		}
+		if len(chunks) == 0 {
+			return nil
+		}
+
+		texts := make([]string, len(chunks))
+		for i, chunk := range chunks {
+			texts[i] = chunk.Content
+		}
+		// A version is only switched to with all its chunks, so one the provider rejects fails it
+		embeddings, err := embedReindexBatch(ctx, embedder, texts)
+		if err != nil {
+			return fmt.Errorf("%s embedding failed: %w", embedder.Provider(), err)
+		}
+		if len(embeddings) != len(chunks) {
+			return fmt.Errorf("%s returned %d vectors for %d chunks", embedder.Provider(), len(embeddings), len(chunks))
+		}
+
+		writes := make([]mongo.WriteModel, len(chunks))
+		for i, chunk := range chunks {
+			writes[i] = mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": chunk.ID}).
+				SetUpdate(bson.M{"$set": bson.M{
+					"embedding":          embeddings[i],
+					"embedding_provider": embedder.Provider(),
+					"embedding_model":    embedder.Model(),
+				}})
+		}
+		if _, err := collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+			return fmt.Errorf("failed to store vectors: %w", err)
+		}
+
+		version.Embedded = min(version.Embedded+len(chunks), version.Chunks)
+		if _, err := GetDatabase().Collection("knowledge_document_versions").UpdateOne(ctx,
+			bson.M{"_id": version.ID},
+			bson.M{"$set": bson.M{"embedded": version.Embedded, "heartbeat_at": time.Now()}}); err != nil {
+			return fmt.Errorf("failed to record progress: %w", err)
+		}
+		broadcastKnowledgeVersion(version, "knowledge_version_progress")
+	}
+}
+
+// activateKnowledgeVersion replaces the document's vector documents with the version's chunks, in one
+// transaction where the deployment supports them, so search never sees a mix of two versions. A
+// version finishing after a newer one was activated is superseded instead.
+func activateKnowledgeVersion(ctx context.Context, version *models.KnowledgeDocumentVersion) error {
+	var document models.KnowledgeDocument
+	err := GetDatabase().Collection("knowledge_documents").FindOne(ctx, bson.M{"_id": version.DocumentID}).Decode(&document)
+	if err == mongo.ErrNoDocuments {
+		return errKnowledgeDocumentDeleted
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load knowledge document: %w", err)
+	}
+
+	chunks, err := loadKnowledgeChunks(ctx, document.ID, version.Version, nil)
+	if err != nil {
+		return err
+	}
+
+	// The document's other versions, and documents of the file uploaded before versions were kept.
+	// Documents of other files with the same text are left alone.
+	stale := bson.M{
+		"company_id": document.CompanyID,
+		"page_id":    document.PageID,
+		"$or": bson.A{
+			bson.M{"knowledge_document_id": document.ID, "document_version": bson.M{"$ne": version.Version}},
+			bson.M{"metadata.filename": document.Filename, "knowledge_document_id": bson.M{"$exists": false}},
+		},
+	}
+	staleIDs := vectorDocumentIDs(ctx, stale)
+
+	now := time.Now()
+	activated := false
+	err = withTransaction(ctx, func(ctx context.Context) error {
+		result, err := GetDatabase().Collection("knowledge_documents").UpdateOne(ctx,
+			bson.M{"_id": document.ID, "active_version": bson.M{"$lt": version.Version}},
+			bson.M{"$set": bson.M{"active_version": version.Version, "updated_at": now}})
+		if err != nil {
+			return fmt.Errorf("failed to switch active version: %w", err)
+		}
+		if result.MatchedCount == 0 {
+			activated = false
+			return nil
+		}
+		activated = true
+
+		channels := channelMapOf(version.Channels)
+		writes := make([]mongo.WriteModel, len(chunks))
+		for i, chunk := range chunks {
+			doc := VectorDocument{
+				KnowledgeChunkID:    &chunk.ID,
+				KnowledgeDocumentID: &document.ID,
+				DocumentVersion:     version.Version,
+
+				CompanyID: document.CompanyID,
+				PageID:    document.PageID,
+				Channels:  channels,
+				Content:   chunk.Content,
+				Embedding: chunk.Embedding,
+				Metadata:  knowledgeChunkMetadata(version, chunk),
+				Source:    version.Source,
+				IsActive:  true,
+				CreatedAt: now,
+				UpdatedAt: now,
+
+				EmbeddingProvider:  chunk.EmbeddingProvider,
+				EmbeddingModel:     chunk.EmbeddingModel,
+				EmbeddingDimension: len(chunk.Embedding),
+			}
+			// Keyed by chunk, so identical chunks stay documents of their own. A vector staged by a
+			// running re-embedding job was made from an earlier model.
+			writes[i] = mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"knowledge_chunk_id": chunk.ID}).
+				SetUpdate(bson.M{
+					"$set":   doc,
+					"$unset": bson.M{"reindex_job_id": "", "reindex_embedding": "", "reindex_provider": "", "reindex_model": ""},
+				}).
+				SetUpsert(true)
+		}
+		if _, err := database.Collection("vector_documents").BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+			return fmt.Errorf("failed to store chunks: %w", err)
+		}
+		if _, err := database.Collection("vector_documents").DeleteMany(ctx, stale); err != nil {
+			return fmt.Errorf("failed to delete replaced chunks: %w", err)
+		}
+
+		versions := GetDatabase().Collection("knowledge_document_versions")
+		if _, err := versions.UpdateMany(ctx,
+			bson.M{"document_id": document.ID, "status": models.KnowledgeVersionActive},
+			bson.M{"$set": bson.M{"status": models.KnowledgeVersionSuperseded}}); err != nil {
+			return fmt.Errorf("failed to supersede active version: %w", err)
+		}
+		if _, err := versions.UpdateOne(ctx,
+			bson.M{"_id": version.ID},
+			bson.M{"$set": bson.M{"status": models.KnowledgeVersionActive, "activated_at": now}}); err != nil {
+			return fmt.Errorf("failed to activate version: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !activated {
+		version.Status = models.KnowledgeVersionSuperseded
+		return nil
+	}
+	version.Status = models.KnowledgeVersionActive
+	version.ActivatedAt = &now
+
+	vectorIndex.Remove(staleIDs...)
+	syncVectorIndex(ctx, bson.M{
+		"company_id":            document.CompanyID,
+		"page_id":               document.PageID,
+		"knowledge_document_id": document.ID,
+	})
+	pruneKnowledgeVersions(ctx, document.ID)
+	return nil
+}
+
+// knowledgeChunkMetadata returns a chunk's vector document metadata: the version's, what the chunker
+// found and which version of which document it belongs to
+func knowledgeChunkMetadata(version *models.KnowledgeDocumentVersion, chunk models.KnowledgeChunk) map[string]string {
+	metadata := make(map[string]string, len(version.Metadata)+len(chunk.Metadata)+2)
+	for k, v := range version.Metadata {
+		metadata[k] = v
+	}
+	for k, v := range chunk.Metadata {
+		metadata[k] = v
+	}
+	metadata["knowledge_document_id"] = version.DocumentID.Hex()
+	metadata["document_version"] = strconv.Itoa(version.Version)
+	return metadata
+}
+
+// finishKnowledgeVersion saves a version's final state. A failed version's chunks are deleted, the
+// document keeps its active version.
+func finishKnowledgeVersion(version *models.KnowledgeDocumentVersion, err error) error {
+	// The processing context may be cancelled already, the final state must still be saved
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	finishedAt := time.Now()
+	version.FinishedAt = &finishedAt
+	if err != nil {
+		version.Status = models.KnowledgeVersionFailed
+		version.Error = err.Error()
+		deleteKnowledgeChunks(ctx, version.DocumentID, version.Version)
+	}
+
+	if _, saveErr := GetDatabase().Collection("knowledge_document_versions").UpdateOne(ctx, bson.M{"_id": version.ID}, bson.M{
+		"$set": bson.M{
+			"status":      version.Status,
+			"error":       version.Error,
+			"embedded":    version.Embedded,
+			"finished_at": version.FinishedAt,
+		},
+	}); saveErr != nil {
+		slog.Error("Failed to save knowledge document version", "versionID", version.ID.Hex(), "error", saveErr)
+		if err == nil {
+			err = saveErr
+		}
+	}
+
+	broadcastKnowledgeVersion(version, "knowledge_version_finished")
+	slog.Info("Knowledge document version finished",
+		"documentID", version.DocumentID.Hex(),
+		"pageID", version.PageID,
+		"version", version.Version,
+		"status", version.Status,
+		"chunks", version.Chunks,
+		"embedded", version.Embedded,
+		"reused", version.Reused,
+		"error", version.Error)
+	return err
+}
+
+// broadcastKnowledgeVersion sends a version's progress to the company's dashboards
+func broadcastKnowledgeVersion(version *models.KnowledgeDocumentVersion, eventType string) {
+	GetWebSocketManager().BroadcastToCompany(version.CompanyID, BroadcastMessage{
+		CompanyID: version.CompanyID,
+		PageID:    version.PageID,
+		Type:      eventType,
+		Data:      version,
+	})
+}
+
+// failInterruptedKnowledgeVersions fails the document's processing versions whose instance stopped,
+// e.g. on a restart or deploy, and deletes their chunks
+func failInterruptedKnowledgeVersions(ctx context.Context, documentID primitive.ObjectID) {
+	versions := GetDatabase().Collection("knowledge_document_versions")
+	for {
+		var version models.KnowledgeDocumentVersion
+		err := versions.FindOneAndUpdate(ctx,
+			bson.M{
+				"document_id":  documentID,
+				"status":       models.KnowledgeVersionProcessing,
+				"heartbeat_at": bson.M{"$lt": time.Now().Add(-knowledgeStaleAfter)},
+			},
+			bson.M{"$set": bson.M{
+				"status":      models.KnowledgeVersionFailed,
+				"error":       "processing was interrupted",
+				"finished_at": time.Now(),
+			}}).Decode(&version)
+		if err != nil {
+			if err != mongo.ErrNoDocuments {
+				slog.Warn("Failed to fail interrupted knowledge versions", "documentID", documentID.Hex(), "error", err)
+			}
+			return
+		}
+		deleteKnowledgeChunks(ctx, documentID, version.Version)
+		slog.Info("Interrupted knowledge document version failed", "documentID", documentID.Hex(), "version", version.Version)
+	}
+}
+
+// pruneKnowledgeVersions deletes the chunks of superseded versions beyond the most recent
+// knowledgeKeptVersions. Their history is kept.
+func pruneKnowledgeVersions(ctx context.Context, documentID primitive.ObjectID) {
+	versions := GetDatabase().Collection("knowledge_document_versions")
+	cursor, err := versions.Find(ctx,
+		bson.M{
+			"document_id": documentID,
+			"status":      models.KnowledgeVersionSuperseded,
+			"pruned":      bson.M{"$ne": true},
+		},
+		options.Find().
+			SetSort(bson.D{{Key: "version", Value: -1}}).
+			SetSkip(knowledgeKeptVersions).
+			SetProjection(bson.M{"_id": 1, "version": 1}))
+	if err != nil {
+		slog.Warn("Failed to find knowledge versions to prune", "documentID", documentID.Hex(), "error", err)
+		return
+	}
+	var pruned []models.KnowledgeDocumentVersion
+	err = cursor.All(ctx, &pruned)
+	cursor.Close(ctx)
+	if err != nil {
+		slog.Warn("Failed to read knowledge versions to prune", "documentID", documentID.Hex(), "error", err)
+		return
+	}
+
+	for _, version := range pruned {
+		deleteKnowledgeChunks(ctx, documentID, version.Version)
+		if _, err := versions.UpdateOne(ctx, bson.M{"_id": version.ID}, bson.M{"$set": bson.M{"pruned": true}}); err != nil {
+			slog.Warn("Failed to mark knowledge version pruned", "documentID", documentID.Hex(), "version", version.Version, "error", err)
+		}
+	}
+}
+
+// loadKnowledgeChunks returns a version's chunks in order. projection limits the fields loaded, all
+// when nil.
+func loadKnowledgeChunks(ctx context.Context, documentID primitive.ObjectID, version int, projection bson.M) ([]models.KnowledgeChunk, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "index", Value: 1}})
+	if projection != nil {
+		opts.SetProjection(projection)
+	}
+	cursor, err := GetDatabase().Collection("knowledge_chunks").Find(ctx,
+		bson.M{"document_id": documentID, "version": version}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chunks: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var chunks []models.KnowledgeChunk
+	if err := cursor.All(ctx, &chunks); err != nil {
+		return nil, fmt.Errorf("failed to read chunks: %w", err)
+	}
+	return chunks, nil
+}
+
+// deleteKnowledgeChunks deletes a version's chunks
+func deleteKnowledgeChunks(ctx context.Context, documentID primitive.ObjectID, version int) {
+	if _, err := GetDatabase().Collection("knowledge_chunks").DeleteMany(ctx,
+		bson.M{"document_id": documentID, "version": version}); err != nil {
+		slog.Warn("Failed to delete knowledge chunks", "documentID", documentID.Hex(), "version", version, "error", err)
+	}
+}
+
+// DeleteKnowledgeDocument deletes the page's knowledge document with the filename, its versions and
+// their chunks. Its vector documents are deleted by filename with DeleteVectorDocumentsByMetadata.
+func DeleteKnowledgeDocument(ctx context.Context, companyID, pageID, filename string) error {
+	var document models.KnowledgeDocument
+	err := GetDatabase().Collection("knowledge_documents").FindOneAndDelete(ctx,
+		bson.M{"company_id": companyID, "page_id": pageID, "filename": filename}).Decode(&document)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete knowledge document: %w", err)
+	}
+
+	if _, err := GetDatabase().Collection("knowledge_chunks").DeleteMany(ctx, bson.M{"document_id": document.ID}); err != nil {
+		return fmt.Errorf("failed to delete knowledge chunks: %w", err)
+	}
+	if _, err := GetDatabase().Collection("knowledge_document_versions").DeleteMany(ctx, bson.M{"document_id": document.ID}); err != nil {
+		return fmt.Errorf("failed to delete knowledge document versions: %w", err)
+	}
+	return nil
+}
+
+// GetKnowledgeDocument retrieves a knowledge document by ID for a company. Returns nil when it does
+// not exist.
+func GetKnowledgeDocument(ctx context.Context, documentID, companyID string) (*models.KnowledgeDocument, error) {
+	objectID, err := primitive.ObjectIDFromHex(documentID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid knowledge document ID")
+	}
+
+	var document models.KnowledgeDocument
+	err = GetDatabase().Collection("knowledge_documents").FindOne(ctx, bson.M{
+		"_id":        objectID,
+		"company_id": companyID,
+	}).Decode(&document)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+// GetKnowledgeDocuments lists a company's knowledge documents, most recently changed first. pageID is
+// an optional filter.
+func GetKnowledgeDocuments(ctx context.Context, companyID, pageID string) ([]models.KnowledgeDocument, error) {
+	filter := bson.M{"company_id": companyID}
+	if pageID != "" {
+		filter["page_id"] = pageID
+	}
+
+	cursor, err := GetDatabase().Collection("knowledge_documents").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	documents := []models.KnowledgeDocument{}
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// GetKnowledgeDocumentVersions lists a document's versions, newest first
+func GetKnowledgeDocumentVersions(ctx context.Context, documentID primitive.ObjectID) ([]models.KnowledgeDocumentVersion, error) {
+	cursor, err := GetDatabase().Collection("knowledge_document_versions").Find(ctx,
+		bson.M{"document_id": documentID},
+		options.Find().SetSort(bson.D{{Key: "version", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	versions := []models.KnowledgeDocumentVersion{}
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// CreateIndexesForKnowledgeDocuments creates indexes for the knowledge_documents,
+// knowledge_document_versions and knowledge_chunks collections
+func CreateIndexesForKnowledgeDocuments(ctx context.Context) error {
+	if _, err := GetDatabase().Collection("knowledge_documents").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			// One document per file name on a page
+			Keys: bson.D{
+				{Key: "company_id", Value: 1},
+				{Key: "page_id", Value: 1},
+				{Key: "filename", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "company_id", Value: 1},
+				{Key: "updated_at", Value: -1},
+			},
+		},
+	}); err != nil {
+		slog.Error("Failed to create indexes for knowledge_documents collection", "error", err)
+		return err
+	}
+
+	if _, err := GetDatabase().Collection("knowledge_document_versions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "document_id", Value: 1},
+				{Key: "version", Value: -1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "document_id", Value: 1},
+				{Key: "status", Value: 1},
+			},
+		},
+	}); err != nil {
+		slog.Error("Failed to create indexes for knowledge_document_versions collection", "error", err)
+		return err
+	}
+
+	if _, err := GetDatabase().Collection("knowledge_chunks").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "document_id", Value: 1},
+				{Key: "version", Value: 1},
+				{Key: "index", Value: 1},
+			},
+		},
+		{
+			// Vectors reused across versions
+			Keys: bson.D{
+				{Key: "document_id", Value: 1},
+				{Key: "content_hash", Value: 1},
+			},
+		},
+	}); err != nil {
+		slog.Error("Failed to create indexes for knowledge_chunks collection", "error", err)
+		return err
+	}
+
+	slog.Info("Successfully created indexes for knowledge document collections")
+	return nil
+}
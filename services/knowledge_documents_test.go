@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"facebook-bot/models"
+)
+
+func TestKnowledgeHash(t *testing.T) {
+	if knowledgeHash("Returns within 14 days") != knowledgeHash("Returns within 14 days") {
+		t.Error("equal content hashed differently")
+	}
+	if knowledgeHash("ab", "c") == knowledgeHash("a", "bc") {
+		t.Error("a version's chunk boundaries should change its hash")
+	}
+	if knowledgeHash("a", "b") == knowledgeHash("b", "a") {
+		t.Error("a version's chunk order should change its hash")
+	}
+	if len(knowledgeHash()) != 64 {
+		t.Errorf("knowledgeHash() = %q, want sha256 hex", knowledgeHash())
+	}
+}
+
+func TestKnowledgeDiffFirstVersion(t *testing.T) {
+	diff, err := knowledgeDiff(context.Background(), &models.KnowledgeDocument{}, []string{"a", "b", "a"}, 120)
+	if err != nil {
+		t.Fatalf("knowledgeDiff() error = %v", err)
+	}
+	want := models.KnowledgeDiff{ChunksAdded: 3, CharactersAfter: 120}
+	if *diff != want {
+		t.Errorf("diff = %+v, want %+v", *diff, want)
+	}
+}
+
+func TestCountKnowledgeChanges(t *testing.T) {
+	tests := []struct {
+		name       string
+		base, next []string
+		want       models.KnowledgeDiff
+	}{
+		{"identical", []string{"a", "b"}, []string{"a", "b"}, models.KnowledgeDiff{ChunksUnchanged: 2}},
+		{"reordered", []string{"a", "b"}, []string{"b", "a"}, models.KnowledgeDiff{ChunksUnchanged: 2}},
+		{"edited", []string{"a", "b", "c"}, []string{"a", "x", "c"}, models.KnowledgeDiff{ChunksAdded: 1, ChunksRemoved: 1, ChunksUnchanged: 2}},
+		{"grown", []string{"a"}, []string{"a", "b", "c"}, models.KnowledgeDiff{ChunksAdded: 2, ChunksUnchanged: 1}},
+		{"emptied", []string{"a", "b"}, nil, models.KnowledgeDiff{ChunksRemoved: 2}},
+		{"repeated chunk", []string{"a", "a", "b"}, []string{"a", "b", "b"}, models.KnowledgeDiff{ChunksAdded: 1, ChunksRemoved: 1, ChunksUnchanged: 2}},
+	}
+	for _, tt := range tests {
+		var diff models.KnowledgeDiff
+		countKnowledgeChanges(&diff, tt.base, tt.next)
+		if diff != tt.want {
+			t.Errorf("%s: diff = %+v, want %+v", tt.name, diff, tt.want)
+		}
+	}
+}
+
+func TestKnowledgeChunkMetadata(t *testing.T) {
+	version := &models.KnowledgeDocumentVersion{
+		DocumentID: primitive.NewObjectID(),
+		Version:    3,
+		Metadata:   map[string]string{"filename": "faq.md", "extractor": "markdown", "document_version": "stale"},
+	}
+	chunk := models.KnowledgeChunk{Metadata: map[string]string{"heading_path": "Returns", "chunk": "2/4"}}
+
+	metadata := knowledgeChunkMetadata(version, chunk)
+	want := map[string]string{
+		"filename":              "faq.md",
+		"extractor":             "markdown",
+		"heading_path":          "Returns",
+		"chunk":                 "2/4",
+		"knowledge_document_id": version.DocumentID.Hex(),
+		"document_version":      "3",
+	}
+	if len(metadata) != len(want) {
+		t.Errorf("metadata = %v, want %v", metadata, want)
+	}
+	for k, v := range want {
+		if metadata[k] != v {
+			t.Errorf("metadata[%q] = %q, want %q", k, metadata[k], v)
+		}
+	}
+	if version.Metadata["document_version"] != "stale" {
+		t.Error("knowledgeChunkMetadata changed the version's metadata")
+	}
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+
+	"facebook-bot/models"
+)
+
+// Sources of a detected language
+const (
+	LanguageSourceScript  = "script"  // Decided by the writing system alone
+	LanguageSourceNgram   = "ngram"   // Decided by n-gram profiles
+	LanguageSourceDefault = "default" // Input too short or ambiguous, company default used
+)
+
+// LanguageDetection is the result of detecting the language of a text
+type LanguageDetection struct {
+	Language   string  `json:"language"` // "" if nothing could be detected
+	Confidence float64 `json:"confidence"`
+	Source     string  `json:"source"`
+}
+
+const (
+	// minNgramLetters is the fewest letters an n-gram decision is trusted for
+	minNgramLetters = 8
+	// minNgramConfidence is the lowest confidence an n-gram decision is trusted at
+	minNgramConfidence = 0.5
+	// ngramSize is the length of the character n-grams in the profiles
+	ngramSize = 3
+)
+
+// languageProfile holds smoothed log probabilities of a language's n-grams
+type languageProfile struct {
+	language   string
+	script     string
+	logProbs   map[string]float64
+	unseenProb float64
+}
+
+var (
+	languageProfiles     []*languageProfile
+	languageProfilesOnce sync.Once
+)
+
+// loadLanguageProfiles builds the n-gram profiles from the training samples
+func loadLanguageProfiles() {
+	for _, sample := range languageSamples {
+		counts := make(map[string]int)
+		total := 0
+		for _, gram := range textNgrams(sample.text) {
+			counts[gram]++
+			total++
+		}
+
+		// Add-one smoothing
+		vocabulary := len(counts) + 1
+		profile := &languageProfile{
+			language:   sample.language,
+			script:     sample.script,
+			logProbs:   make(map[string]float64, len(counts)),
+			unseenProb: math.Log(1 / float64(total+vocabulary)),
+		}
+		for gram, count := range counts {
+			profile.logProbs[gram] = math.Log(float64(count+1) / float64(total+vocabulary))
+		}
+
+		languageProfiles = append(languageProfiles, profile)
+	}
+}
+
+// DetectLanguage detects the language of a text from its script and character n-grams.
+// Language is empty when the text has no letters or is too short or ambiguous to decide.
+func DetectLanguage(text string) LanguageDetection {
+	languageProfilesOnce.Do(loadLanguageProfiles)
+
+	script, letters := dominantScript(text)
+	if letters == 0 {
+		return LanguageDetection{}
+	}
+
+	// Georgian script is only used for Georgian
+	if script == scriptGeorgian {
+		return LanguageDetection{
+			Language:   models.LanguageGeorgian,
+			Confidence: 1,
+			Source:     LanguageSourceScript,
+		}
+	}
+
+	// Letters that only exist in one of the Cyrillic languages
+	if script == scriptCyrillic {
+		lower := strings.ToLower(text)
+		if strings.ContainsAny(lower, "іїєґ") {
+			return LanguageDetection{Language: models.LanguageUkrainian, Confidence: 1, Source: LanguageSourceScript}
+		}
+		if strings.ContainsAny(lower, "ыэъё") {
+			return LanguageDetection{Language: models.LanguageRussian, Confidence: 1, Source: LanguageSourceScript}
+		}
+	}
+
+	grams := textNgrams(text)
+	if len(grams) == 0 {
+		return LanguageDetection{}
+	}
+
+	// Score each profile written in the text's script
+	best, second := math.Inf(-1), math.Inf(-1)
+	bestLanguage := ""
+	for _, profile := range languageProfiles {
+		if profile.script != script {
+			continue
+		}
+
+		score := 0.0
+		for _, gram := range grams {
+			if logProb, ok := profile.logProbs[gram]; ok {
+				score += logProb
+			} else {
+				score += profile.unseenProb
+			}
+		}
+		score /= float64(len(grams))
+
+		if score > best {
+			best, second = score, best
+			bestLanguage = profile.language
+		} else if score > second {
+			second = score
+		}
+	}
+
+	if bestLanguage == "" {
+		return LanguageDetection{}
+	}
+
+	// Confidence grows with the per n-gram margin over the runner-up and with the input length
+	confidence := 1.0
+	if !math.IsInf(second, -1) {
+		margin := (best - second) * float64(len(grams))
+		confidence = 1 - math.Exp(-margin/2)
+	}
+
+	detection := LanguageDetection{
+		Language:   bestLanguage,
+		Confidence: confidence,
+		Source:     LanguageSourceNgram,
+	}
+	if letters < minNgramLetters || confidence < minNgramConfidence {
+		detection.Language = ""
+	}
+
+	return detection
+}
+
+// ResolveLanguage detects the language of a customer's text, falling back to the company
+// default language for short or ambiguous input
+func ResolveLanguage(text, defaultLanguage string) LanguageDetection {
+	detection := DetectLanguage(text)
+	if detection.Language != "" {
+		return detection
+	}
+
+	if models.IsSupportedLanguage(defaultLanguage) {
+		return LanguageDetection{
+			Language:   defaultLanguage,
+			Confidence: detection.Confidence,
+			Source:     LanguageSourceDefault,
+		}
+	}
+
+	return detection
+}
+
+// dominantScript returns the writing system most letters of the text use and the letter count
+func dominantScript(text string) (string, int) {
+	counts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Georgian, r):
+			counts[scriptGeorgian]++
+		case unicode.Is(unicode.Cyrillic, r):
+			counts[scriptCyrillic]++
+		case unicode.Is(unicode.Latin, r):
+			counts[scriptLatin]++
+		}
+	}
+
+	script := ""
+	for _, candidate := range []string{scriptGeorgian, scriptCyrillic, scriptLatin} {
+		if counts[candidate] > counts[script] {
+			script = candidate
+		}
+	}
+	return script, letters
+}
+
+// textNgrams splits text into lowercase words and returns their character n-grams,
+// with word boundaries marked by spaces
+func textNgrams(text string) []string {
+	var grams []string
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, word := range words {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+ngramSize <= len(runes); i++ {
+			grams = append(grams, string(runes[i:i+ngramSize]))
+		}
+	}
+	return grams
+}
+
+type customerLanguageKey struct{}
+
+// WithCustomerLanguage attaches the customer's language to a context so replies and
+// fallbacks use it without detecting it again
+func WithCustomerLanguage(ctx context.Context, language string) context.Context {
+	return context.WithValue(ctx, customerLanguageKey{}, language)
+}
+
+// customerLanguageFromContext returns the customer's language attached to the context, or ""
+func customerLanguageFromContext(ctx context.Context) string {
+	language, _ := ctx.Value(customerLanguageKey{}).(string)
+	return language
+}
+
+// customerLanguage returns the customer's language attached to the context, detecting it from
+// the input when the caller did not attach one
+func customerLanguage(ctx context.Context, input string, company *models.Company) string {
+	if language := customerLanguageFromContext(ctx); language != "" {
+		return language
+	}
+	defaultLanguage := ""
+	if company != nil {
+		defaultLanguage = company.DefaultLanguage
+	}
+	return ResolveLanguage(input, defaultLanguage).Language
+}
+
+// languageInstruction returns the prompt rule telling the model which language to answer in
+func languageInstruction(language string) string {
+	name := models.LanguageName(language)
+	if name == "" {
+		return "CRITICAL LANGUAGE RULE: You MUST respond in the SAME LANGUAGE the customer used in their message. Match their language exactly."
+	}
+	return fmt.Sprintf("CRITICAL LANGUAGE RULE: The customer writes in %s. You MUST respond in %s, even if the knowledge base is written in another language.", name, name)
+}
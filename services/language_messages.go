@@ -0,0 +1,68 @@
+package services
+
+import "facebook-bot/models"
+
+// Keys of canned messages sent without calling the model
+const (
+	MessageKeyCommentThanks  = "comment_thanks"  // Model call failed for a comment
+	MessageKeyReplyThanks    = "reply_thanks"    // Model call failed for a comment reply
+	MessageKeyBudgetFallback = "budget_fallback" // Monthly budget exceeded
+	MessageKeyStoreRejection = "store_rejection" // Question outside the online store's topics
+	MessageKeyHumanHandoff   = "human_handoff"   // No model could answer, a human takes over
+	MessageKeyClarify        = "clarify"         // The knowledge base has no answer, the customer is asked for details
+)
+
+// cannedMessages holds canned messages per key and language
+var cannedMessages = map[string]map[string]string{
+	MessageKeyCommentThanks: {
+		models.LanguageEnglish:   "Thank you for your comment!",
+		models.LanguageGeorgian:  "გმადლობთ კომენტარისთვის!",
+		models.LanguageRussian:   "Спасибо за ваш комментарий!",
+		models.LanguageUkrainian: "Дякуємо за ваш коментар!",
+		models.LanguageTurkish:   "Yorumunuz için teşekkürler!",
+	},
+	MessageKeyReplyThanks: {
+		models.LanguageEnglish:   "Thank you for your reply!",
+		models.LanguageGeorgian:  "გმადლობთ პასუხისთვის!",
+		models.LanguageRussian:   "Спасибо за ваш ответ!",
+		models.LanguageUkrainian: "Дякуємо за вашу відповідь!",
+		models.LanguageTurkish:   "Yanıtınız için teşekkürler!",
+	},
+	MessageKeyBudgetFallback: {
+		models.LanguageEnglish:   "Thank you for your message! Our team will get back to you as soon as possible.",
+		models.LanguageGeorgian:  "გმადლობთ შეტყობინებისთვის! ჩვენი გუნდი მალე დაგიკავშირდებათ.",
+		models.LanguageRussian:   "Спасибо за ваше сообщение! Наша команда свяжется с вами в ближайшее время.",
+		models.LanguageUkrainian: "Дякуємо за ваше повідомлення! Наша команда зв'яжеться з вами найближчим часом.",
+		models.LanguageTurkish:   "Mesajınız için teşekkürler! Ekibimiz en kısa sürede size dönüş yapacak.",
+	},
+	MessageKeyStoreRejection: {
+		models.LanguageEnglish:   "I am an online store assistant. I can only help with questions about our products, orders, shipping, and store policies. Please ask me about our store.",
+		models.LanguageGeorgian:  "მე ვარ ონლაინ მაღაზიის ასისტენტი. შემიძლია დაგეხმაროთ მხოლოდ ჩვენი პროდუქტების, შეკვეთების, მიწოდებისა და მაღაზიის პოლიტიკის შესახებ კითხვებზე.",
+		models.LanguageRussian:   "Я ассистент интернет-магазина. Могу помочь только с вопросами о наших товарах, заказах, доставке и политике магазина.",
+		models.LanguageUkrainian: "Я асистент інтернет-магазину. Можу допомогти лише з питаннями про наші товари, замовлення, доставку та політику магазину.",
+		models.LanguageTurkish:   "Ben bir online mağaza asistanıyım. Yalnızca ürünlerimiz, siparişler, kargo ve mağaza politikaları hakkındaki sorulara yardımcı olabilirim.",
+	},
+	MessageKeyHumanHandoff: {
+		models.LanguageEnglish:   "Thank you for your message! A member of our team will reply to you shortly.",
+		models.LanguageGeorgian:  "გმადლობთ შეტყობინებისთვის! ჩვენი გუნდის წევრი მალე გიპასუხებთ.",
+		models.LanguageRussian:   "Спасибо за ваше сообщение! Сотрудник нашей команды скоро вам ответит.",
+		models.LanguageUkrainian: "Дякуємо за ваше повідомлення! Співробітник нашої команди незабаром вам відповість.",
+		models.LanguageTurkish:   "Mesajınız için teşekkürler! Ekibimizden biri kısa süre içinde size yanıt verecek.",
+	},
+	MessageKeyClarify: {
+		models.LanguageEnglish:   "Could you tell me a little more about what you are looking for? Then I can help you better.",
+		models.LanguageGeorgian:  "შეგიძლიათ ცოტა უფრო დაწვრილებით მომწეროთ, რას ეძებთ? ასე უკეთ დაგეხმარებით.",
+		models.LanguageRussian:   "Не могли бы вы немного подробнее рассказать, что именно вы ищете? Так я смогу помочь вам лучше.",
+		models.LanguageUkrainian: "Чи могли б ви трохи детальніше розповісти, що саме ви шукаєте? Так я зможу допомогти вам краще.",
+		models.LanguageTurkish:   "Ne aradığınızı biraz daha ayrıntılı anlatabilir misiniz? Böylece size daha iyi yardımcı olabilirim.",
+	},
+}
+
+// LocalizedMessage returns a canned message in the given language, falling back to English
+func LocalizedMessage(key, language string) string {
+	messages := cannedMessages[key]
+	if message, ok := messages[language]; ok {
+		return message
+	}
+	return messages[models.LanguageEnglish]
+}
@@ -0,0 +1,96 @@
+package services
+
+import "facebook-bot/models"
+
+// languageSample is training text for a language's n-gram profile
+type languageSample struct {
+	language string
+	script   string
+	text     string
+}
+
+// Scripts a profile is written in
+const (
+	scriptLatin    = "latin"
+	scriptCyrillic = "cyrillic"
+	scriptGeorgian = "georgian"
+)
+
+// languageSamples are short customer service style texts used to build the n-gram profiles.
+// Georgian is also commonly written in Latin letters, so it has a Latin profile too.
+var languageSamples = []languageSample{
+	{
+		language: models.LanguageEnglish,
+		script:   scriptLatin,
+		text: `Hello, how are you? I would like to know the price of this apartment and whether it is still available.
+Can you tell me more about the delivery options and how long shipping takes to my city?
+Thank you very much for your help, I really appreciate it. What are your working hours?
+Is there a discount if I buy two of them? Please send me the details and the address of your store.
+I want to order this product, how can I pay? Do you accept credit cards or only cash on delivery?
+We are looking for a two bedroom flat near the center with a balcony and parking space.
+When can we schedule a viewing? I am free tomorrow afternoon or on the weekend.
+Could you please call me back, I have some questions about the contract and the payment plan.
+The item I received was damaged, I would like to return it and get a refund.
+Where is my order? It has been a week and I still have not received anything from you.
+Good morning, is this still for sale? How much does it cost with the furniture included?
+That sounds great, thanks. Let me think about it and I will get back to you later today.`,
+	},
+	{
+		language: models.LanguageGeorgian,
+		script:   scriptLatin,
+		text: `gamarjoba rogor khar ra ghirs es bina kidev gaqvt tu ara
+gamarjobat mainteresebs fasi da sad mdebareobs es obieqti shegidzliat damikavshirdet
+madloba didi dakhmarebistvis dzalian kargia rodis shegvidzlia vnakhot bina
+mitana gaqvt tbilisshi ramdeni dghe sachiroa shekvetis mosatanad
+minda shevukveto es produqti rogor gadavikhado baratit tu nagdi fulit
+ra fasad aris ori otakhiani bina centrshi aivnit da parkingit
+khval shemidzlia mosvla saghamos an shabat kviras tu giprobt
+damirekhet tu sheidzleba kitkhvebi maqvs kontraktis da gadakhdis grapikis shesakheb
+sad aris chemi shekveta kvira gavida da jer araperi mimighia
+dila mshvidobisa kidev iyideba es ramdeni ghirs aveji tu shedis fasshi
+kargi gasagebia madloba movipiqreb da mogvianebit mogts pasukhs
+ki ara ar vici ra vqna momts rcheva romeli jobia chemtvis`,
+	},
+	{
+		language: models.LanguageTurkish,
+		script:   scriptLatin,
+		text: `Merhaba, nasılsınız? Bu dairenin fiyatını ve hala müsait olup olmadığını öğrenmek istiyorum.
+Teslimat seçenekleri hakkında daha fazla bilgi verebilir misiniz, kargo ne kadar sürer?
+Yardımınız için çok teşekkür ederim. Çalışma saatleriniz nedir?
+İki tane alırsam indirim var mı? Lütfen bana detayları ve mağazanızın adresini gönderin.
+Bu ürünü sipariş etmek istiyorum, nasıl ödeme yapabilirim? Kredi kartı kabul ediyor musunuz?
+Merkeze yakın, balkonlu ve otoparklı iki yatak odalı bir daire arıyoruz.
+Ne zaman görmeye gelebiliriz? Yarın öğleden sonra veya hafta sonu müsaitim.
+Beni geri arayabilir misiniz, sözleşme ve ödeme planı hakkında bazı sorularım var.
+Siparişim nerede? Bir hafta oldu ve hala hiçbir şey almadım.
+Günaydın, bu hala satılık mı? Mobilya dahil fiyatı ne kadar?`,
+	},
+	{
+		language: models.LanguageRussian,
+		script:   scriptCyrillic,
+		text: `Здравствуйте, как дела? Я хотел бы узнать цену этой квартиры и доступна ли она еще.
+Расскажите подробнее о вариантах доставки и сколько времени занимает доставка в мой город?
+Большое спасибо за помощь, я очень ценю это. Какие у вас часы работы?
+Есть ли скидка, если я куплю две штуки? Пожалуйста, пришлите мне подробности и адрес вашего магазина.
+Я хочу заказать этот товар, как я могу оплатить? Вы принимаете кредитные карты или только наличные?
+Мы ищем двухкомнатную квартиру недалеко от центра с балконом и парковкой.
+Когда можно посмотреть? Я свободен завтра после обеда или в выходные.
+Перезвоните мне, пожалуйста, у меня есть вопросы по договору и графику платежей.
+Где мой заказ? Прошла неделя, а я до сих пор ничего не получил.
+Доброе утро, это еще продается? Сколько стоит вместе с мебелью?`,
+	},
+	{
+		language: models.LanguageUkrainian,
+		script:   scriptCyrillic,
+		text: `Добрий день, як справи? Я хотів би дізнатися ціну цієї квартири і чи вона ще доступна.
+Розкажіть детальніше про варіанти доставки і скільки часу займає доставка до мого міста?
+Щиро дякую за допомогу, я дуже це ціную. Які у вас години роботи?
+Чи є знижка, якщо я куплю дві штуки? Будь ласка, надішліть мені деталі та адресу вашого магазину.
+Я хочу замовити цей товар, як я можу оплатити? Ви приймаєте кредитні картки чи тільки готівку?
+Ми шукаємо двокімнатну квартиру неподалік від центру з балконом і паркуванням.
+Коли можна подивитися? Я вільний завтра після обіду або у вихідні.
+Передзвоніть мені, будь ласка, у мене є питання щодо договору та графіка платежів.
+Де моє замовлення? Минув тиждень, а я досі нічого не отримав.
+Доброго ранку, це ще продається? Скільки коштує разом з меблями?`,
+	},
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"testing"
+
+	"facebook-bot/models"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		want   string
+		source string
+	}{
+		{"georgian script", "გამარჯობა, რა ღირს მიწოდება?", models.LanguageGeorgian, LanguageSourceScript},
+		{"georgian with latin code", "AB-1234 რა ღირს?", models.LanguageGeorgian, LanguageSourceScript},
+		{"ukrainian letters", "Скільки коштує доставка до Києва?", models.LanguageUkrainian, LanguageSourceScript},
+		{"russian letters", "Сколько стоит доставка в Тбилиси? Объясните, пожалуйста", models.LanguageRussian, LanguageSourceScript},
+		{"english trigrams", "Hello, what are your opening hours today?", models.LanguageEnglish, LanguageSourceNgram},
+		{"turkish trigrams", "Merhaba, bugün mağaza kaçta kapanıyor acaba?", models.LanguageTurkish, LanguageSourceNgram},
+		{"too short", "ok", "", LanguageSourceNgram},
+		{"no letters", "12345 !!!", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DetectLanguage(tt.text)
+			if got.Language != tt.want || got.Source != tt.source {
+				t.Errorf("DetectLanguage(%q) = %+v, want %q from %q", tt.text, got, tt.want, tt.source)
+			}
+		})
+	}
+}
+
+func TestResolveLanguage(t *testing.T) {
+	tests := []struct {
+		name            string
+		text            string
+		defaultLanguage string
+		want            string
+		source          string
+	}{
+		{"detected", "Hello, what are your opening hours today?", models.LanguageGeorgian, models.LanguageEnglish, LanguageSourceNgram},
+		{"short text uses the default", "ok", models.LanguageGeorgian, models.LanguageGeorgian, LanguageSourceDefault},
+		{"unsupported default", "ok", "xx", "", LanguageSourceNgram},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ResolveLanguage(tt.text, tt.defaultLanguage)
+			if got.Language != tt.want || got.Source != tt.source {
+				t.Errorf("ResolveLanguage(%q, %q) = %+v, want %q from %q", tt.text, tt.defaultLanguage, got, tt.want, tt.source)
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"facebook-bot/models"
+)
+
+var (
+	leadEmailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	leadPhonePattern = regexp.MustCompile(`\+?\(?\d[\d\s\-().]{6,}\d`)
+
+	// leadGroupedNumberPattern matches amounts written with thousands separators, e.g. "120 000 000"
+	leadGroupedNumberPattern = regexp.MustCompile(`^[1-9]\d{0,2}([\s.]\d{3})+$`)
+)
+
+// leadPhonePrefixes maps the prefixes a phone number written without "+" may start with
+// to the digit count a full number with that prefix has
+var leadPhonePrefixes = []struct {
+	prefix string
+	digits []int
+}{
+	{prefix: "995", digits: []int{12}}, // Georgia
+	{prefix: "380", digits: []int{12}}, // Ukraine
+	{prefix: "90", digits: []int{12}},  // Turkey
+	{prefix: "7", digits: []int{11}},   // Russia, Kazakhstan
+	{prefix: "8", digits: []int{11}},   // Post-Soviet trunk prefix
+	{prefix: "0", digits: []int{9, 10, 11}},
+}
+
+// leadCaptureTool is the tool Claude uses to return structured lead data
+var leadCaptureTool = Tool{
+	Name:        "capture_lead",
+	Description: "Record contact details and buying intent the customer shared in the conversation. Leave a field empty if the customer did not mention it.",
+	InputSchema: InputSchema{
+		Type: "object",
+		Properties: map[string]Property{
+			"phone": {
+				Type:        "string",
+				Description: "Phone number exactly as the customer wrote it",
+			},
+			"email": {
+				Type:        "string",
+				Description: "Email address",
+			},
+			"budget": {
+				Type:        "string",
+				Description: "Budget including currency, e.g. '120000 USD' or 'up to 500 GEL per month'",
+			},
+			"preferences": {
+				Type:        "string",
+				Description: "Short summary of what the customer is looking for",
+			},
+			"rooms": {
+				Type:        "string",
+				Description: "Number of rooms the customer wants (real estate only)",
+			},
+			"location": {
+				Type:        "string",
+				Description: "Preferred city, district or address",
+			},
+			"qualification_stage": {
+				Type:        "string",
+				Description: "How far the customer is in the buying process",
+				Enum: []string{
+					models.LeadStageNew,
+					models.LeadStageInterested,
+					models.LeadStageQualified,
+					models.LeadStageReadyToBuy,
+					models.LeadStageUnqualified,
+				},
+			},
+		},
+		Required: []string{"qualification_stage"},
+	},
+}
+
+// ExtractLeadDetails asks Claude to extract lead information from the latest customer message.
+// Falls back to pattern matching for phone and email when Claude is unavailable.
+// Returns nil if the message contains no lead information.
+func ExtractLeadDetails(ctx context.Context, input string, history []ChatHistory, pageConfig *models.FacebookPage) (*models.Lead, error) {
+	if pageConfig.ClaudeAPIKey == "" || pageConfig.ClaudeAPIKey == "TEST_MODE" {
+		return extractLeadWithPatterns(input), nil
+	}
+
+	var conversation strings.Builder
+	if len(history) > 0 {
+		conversation.WriteString("Previous conversation:\n")
+		for _, msg := range history {
+			conversation.WriteString(fmt.Sprintf("%s: %s\n", msg.Role, msg.Content))
+		}
+		conversation.WriteString("\n")
+	}
+	conversation.WriteString("Latest customer message:\n")
+	conversation.WriteString(input)
+
+	model := pageConfig.ClaudeModel
+	if model == "" {
+		model = "claude-3-haiku-20240307"
+	}
+
+	requestBody := ClaudeRequest{
+		Model:     model,
+		MaxTokens: 300,
+		System: systemText("You extract sales lead information from customer conversations. " +
+			"Only record details the customer actually stated - never guess or invent values. " +
+			"Keep values in the customer's original language."),
+		Messages: []Message{
+			{
+				Role:    "user",
+				Content: conversation.String(),
+			},
+		},
+		Tools:      []Tool{leadCaptureTool},
+		ToolChoice: &ToolChoice{Type: "tool", Name: leadCaptureTool.Name},
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", claudeAPIURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, body, err := callClaudeAPIWithRetry(req, pageConfig.ClaudeAPIKey, 2)
+	if err != nil {
+		slog.Warn("Lead extraction request failed, using pattern matching",
+			"error", err,
+			"pageID", pageConfig.PageID)
+		return extractLeadWithPatterns(input), nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		slog.Warn("Claude API error during lead extraction, using pattern matching",
+			"status", resp.StatusCode,
+			"body", string(body),
+			"pageID", pageConfig.PageID)
+		return extractLeadWithPatterns(input), nil
+	}
+
+	var claudeResp ClaudeResponse
+	if err := json.Unmarshal(body, &claudeResp); err != nil {
+		return nil, err
+	}
+
+	recordClaudeUsage(WithUsageScope(ctx, UsageScope{PageID: pageConfig.PageID}), models.UsagePurposeLeadExtraction, &claudeResp)
+
+	for _, content := range claudeResp.Content {
+		if content.Type != "tool_use" || content.Name != leadCaptureTool.Name {
+			continue
+		}
+
+		lead := &models.Lead{
+			Phone:              strings.TrimSpace(content.Input.Phone),
+			Email:              strings.TrimSpace(content.Input.Email),
+			Budget:             strings.TrimSpace(content.Input.Budget),
+			Preferences:        strings.TrimSpace(content.Input.Preferences),
+			QualificationStage: content.Input.QualificationStage,
+		}
+		if !models.IsValidLeadStage(lead.QualificationStage) {
+			lead.QualificationStage = ""
+		}
+
+		attributes := make(map[string]string)
+		if rooms := strings.TrimSpace(content.Input.Rooms); rooms != "" {
+			attributes["rooms"] = rooms
+		}
+		if location := strings.TrimSpace(content.Input.Location); location != "" {
+			attributes["location"] = location
+		}
+		if len(attributes) > 0 {
+			lead.Attributes = attributes
+		}
+
+		if !hasLeadData(lead) {
+			return nil, nil
+		}
+
+		lead.SourceMessage = input
+		return lead, nil
+	}
+
+	return extractLeadWithPatterns(input), nil
+}
+
+// extractLeadWithPatterns extracts phone and email from text using regular expressions
+func extractLeadWithPatterns(input string) *models.Lead {
+	lead := &models.Lead{
+		Email: leadEmailPattern.FindString(input),
+	}
+
+	// Strip emails first so their digits are not mistaken for a phone number
+	withoutEmails := leadEmailPattern.ReplaceAllString(input, " ")
+	for _, candidate := range leadPhonePattern.FindAllString(withoutEmails, -1) {
+		if candidate = strings.TrimSpace(candidate); isLikelyPhone(candidate) {
+			lead.Phone = candidate
+			break
+		}
+	}
+
+	if lead.Phone == "" && lead.Email == "" {
+		return nil
+	}
+
+	lead.QualificationStage = models.LeadStageNew
+	lead.SourceMessage = input
+	return lead
+}
+
+// isLikelyPhone reports whether a number looks like a phone number rather than a price or quantity.
+// Numbers must start with "+" or a known country/trunk prefix, and thousands-grouped amounts are rejected.
+func isLikelyPhone(candidate string) bool {
+	if leadGroupedNumberPattern.MatchString(candidate) {
+		return false
+	}
+
+	var digits strings.Builder
+	for _, r := range candidate {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	number := digits.String()
+
+	if strings.HasPrefix(candidate, "+") {
+		return len(number) >= 8 && len(number) <= 15
+	}
+
+	for _, p := range leadPhonePrefixes {
+		if !strings.HasPrefix(number, p.prefix) {
+			continue
+		}
+		for _, n := range p.digits {
+			if len(number) == n {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasLeadData checks if a lead contains anything worth storing
+func hasLeadData(lead *models.Lead) bool {
+	if lead == nil {
+		return false
+	}
+	if lead.Phone != "" || lead.Email != "" || lead.Budget != "" || lead.Preferences != "" || len(lead.Attributes) > 0 {
+		return true
+	}
+	// A stage alone is only meaningful once the customer has moved past "new"
+	return lead.QualificationStage != "" && lead.QualificationStage != models.LeadStageNew
+}
+
+// SaveCustomerLead merges newly extracted lead data into the customer's existing lead.
+// Existing values are only overwritten by non-empty new values.
+// Returns the updated customer and whether anything changed.
+func SaveCustomerLead(ctx context.Context, customerID, pageID string, lead *models.Lead) (*models.Customer, bool, error) {
+	if !hasLeadData(lead) {
+		return nil, false, nil
+	}
+
+	customer, err := GetCustomer(ctx, customerID, pageID)
+	if err != nil {
+		return nil, false, err
+	}
+	if customer == nil {
+		return nil, false, fmt.Errorf("customer not found")
+	}
+
+	now := time.Now()
+	merged := customer.Lead
+	changed := false
+	if merged == nil {
+		merged = &models.Lead{CapturedAt: now}
+		changed = true
+	}
+
+	mergeField := func(current *string, value string) {
+		if value != "" && *current != value {
+			*current = value
+			changed = true
+		}
+	}
+	mergeField(&merged.Phone, lead.Phone)
+	mergeField(&merged.Email, lead.Email)
+	mergeField(&merged.Budget, lead.Budget)
+	mergeField(&merged.Preferences, lead.Preferences)
+	mergeField(&merged.QualificationStage, lead.QualificationStage)
+
+	for key, value := range lead.Attributes {
+		if value == "" {
+			continue
+		}
+		if merged.Attributes == nil {
+			merged.Attributes = make(map[string]string)
+		}
+		if merged.Attributes[key] != value {
+			merged.Attributes[key] = value
+			changed = true
+		}
+	}
+
+	if !changed {
+		return customer, false, nil
+	}
+
+	merged.SourceMessage = lead.SourceMessage
+	merged.UpdatedAt = now
+
+	collection := GetDatabase().Collection("customers")
+
+	filter := bson.M{
+		"customer_id": customerID,
+		"page_id":     pageID,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"lead":       merged,
+			"updated_at": now,
+		},
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updatedCustomer models.Customer
+	if err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updatedCustomer); err != nil {
+		slog.Error("Failed to save customer lead",
+			"customerID", customerID,
+			"pageID", pageID,
+			"error", err)
+		return nil, false, err
+	}
+
+	slog.Info("Customer lead updated",
+		"customerID", customerID,
+		"pageID", pageID,
+		"stage", merged.QualificationStage)
+
+	return &updatedCustomer, true, nil
+}
+
+// GetLeads retrieves customers with captured lead data for a company.
+// pageID and stage are optional filters.
+func GetLeads(ctx context.Context, companyID, pageID, stage string, limit, skip int) ([]models.Customer, int64, error) {
+	collection := GetDatabase().Collection("customers")
+
+	filter := bson.M{
+		"company_id": companyID,
+		"lead":       bson.M{"$exists": true},
+	}
+	if pageID != "" {
+		filter["page_id"] = pageID
+	}
+	if stage != "" {
+		filter["lead.qualification_stage"] = stage
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "lead.updated_at", Value: -1}}).
+		SetSkip(int64(skip))
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return []models.Customer{}, 0, nil
+		}
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var customers []models.Customer
+	if err := cursor.All(ctx, &customers); err != nil {
+		return nil, 0, err
+	}
+
+	return customers, total, nil
+}
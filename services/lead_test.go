@@ -0,0 +1,54 @@
+package services
+
+import "testing"
+
+func TestExtractLeadWithPatternsPhone(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string // Phone found, empty for none
+	}{
+		{"international", "Call me at +995 555 12 34 56 please", "+995 555 12 34 56"},
+		{"international grouped by three", "My number is +995 555 123 456", "+995 555 123 456"},
+		{"georgian local", "ჩემი ნომერი 0322 12 34 56", "0322 12 34 56"},
+		{"ukrainian without plus", "Телефон 380 67 123 45 67", "380 67 123 45 67"},
+		{"russian trunk prefix", "Звоните 8 (916) 123-45-67", "8 (916) 123-45-67"},
+		{"area code in brackets", "Office (032) 212-34-56", "(032) 212-34-56"},
+		{"price after phone", "Budget 120 000 000, phone +380671234567", "+380671234567"},
+
+		{"price with spaces", "My budget is 120 000 000 GEL", ""},
+		{"price with dots", "Looking for something around 1.250.000 USD", ""},
+		{"price without separators", "I can pay 350000000 for it", ""},
+		{"area and price", "Apartment of 85 m2 for 240 000 USD", ""},
+		{"order number", "Order 2024-11-05-1234 has not arrived", ""},
+		{"short number", "Room 12 34 56", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lead := extractLeadWithPatterns(tt.input)
+			if tt.want == "" {
+				if lead != nil && lead.Phone != "" {
+					t.Errorf("extractLeadWithPatterns(%q) phone = %q, want none", tt.input, lead.Phone)
+				}
+				return
+			}
+			if lead == nil || lead.Phone != tt.want {
+				t.Errorf("extractLeadWithPatterns(%q) = %+v, want phone %q", tt.input, lead, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractLeadWithPatternsEmail(t *testing.T) {
+	lead := extractLeadWithPatterns("Write to nino.b@example.ge, budget 120 000 000")
+	if lead == nil || lead.Email != "nino.b@example.ge" {
+		t.Fatalf("extractLeadWithPatterns email = %+v, want nino.b@example.ge", lead)
+	}
+	if lead.Phone != "" {
+		t.Errorf("phone = %q, want none", lead.Phone)
+	}
+
+	if lead := extractLeadWithPatterns("Do you have two-room flats in Vake?"); lead != nil {
+		t.Errorf("extractLeadWithPatterns without contacts = %+v, want nil", lead)
+	}
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2  // Term frequency saturation
+	bm25B  = 0.75 // Document length normalization
+)
+
+// lexicalIndexTTL is how long a page's keyword index is used before it is built again. Changes made
+// by this instance drop it at once; the TTL picks up changes made by other instances.
+const lexicalIndexTTL = 10 * time.Minute
+
+// lexicalIndex is a BM25 inverted index over the documents of one page
+type lexicalIndex struct {
+	documents []lexicalDocument
+	postings  map[string][]lexicalPosting
+	avgLength float64
+	builtAt   time.Time
+}
+
+// lexicalDocument is what the index keeps of a document to filter hits by the search scope
+type lexicalDocument struct {
+	id       primitive.ObjectID
+	length   int
+	channels map[string]bool
+	crmID    string
+}
+
+type lexicalPosting struct {
+	document  int
+	frequency int
+}
+
+// lexicalHit is a document matching at least one query term
+type lexicalHit struct {
+	ID       primitive.ObjectID
+	Score    float64 // BM25
+	Coverage float64 // 0-1 share of the query terms found, weighted by their IDF
+}
+
+// newLexicalIndex indexes the content of documents
+func newLexicalIndex(documents []VectorDocument) *lexicalIndex {
+	index := &lexicalIndex{
+		documents: make([]lexicalDocument, 0, len(documents)),
+		postings:  make(map[string][]lexicalPosting),
+		builtAt:   time.Now(),
+	}
+
+	totalLength := 0
+	for _, doc := range documents {
+		tokens := lexicalTokens(doc.Content)
+		position := len(index.documents)
+		index.documents = append(index.documents, lexicalDocument{
+			id:       doc.ID,
+			length:   len(tokens),
+			channels: normalizeChannels(doc.Channels),
+			crmID:    doc.CRMID,
+		})
+		totalLength += len(tokens)
+
+		frequencies := make(map[string]int)
+		for _, token := range tokens {
+			frequencies[token]++
+		}
+		for term, frequency := range frequencies {
+			index.postings[term] = append(index.postings[term], lexicalPosting{document: position, frequency: frequency})
+		}
+	}
+	if len(index.documents) > 0 {
+		index.avgLength = float64(totalLength) / float64(len(index.documents))
+	}
+	return index
+}
+
+// Search returns up to k documents the scope selects ranked by BM25 against the query, best first.
+// Documents matching no query term are not returned.
+func (index *lexicalIndex) Search(query string, k int, scope VectorQuery) []lexicalHit {
+	terms := uniqueTerms(lexicalTokens(query))
+	if len(terms) == 0 || len(index.documents) == 0 {
+		return nil
+	}
+
+	channel := normalizeChannel(scope.Channel)
+	inScope := func(doc lexicalDocument) bool {
+		if scope.Channel != "" && !doc.channels[channel] {
+			return false
+		}
+		return scope.CRMID == "" || doc.crmID == scope.CRMID
+	}
+
+	n := float64(len(index.documents))
+	scores := make(map[int]float64)
+	matched := make(map[int]float64) // IDF of the query terms each document contains
+	totalIDF := 0.0
+	for _, term := range terms {
+		postings := index.postings[term]
+		idf := math.Log(1 + (n-float64(len(postings))+0.5)/(float64(len(postings))+0.5))
+		totalIDF += idf
+		for _, posting := range postings {
+			doc := index.documents[posting.document]
+			if !inScope(doc) {
+				continue
+			}
+			tf := float64(posting.frequency)
+			norm := 1 - bm25B + bm25B*float64(doc.length)/math.Max(index.avgLength, 1)
+			scores[posting.document] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+			matched[posting.document] += idf
+		}
+	}
+
+	// Ties keep the order documents were indexed in
+	positions := make([]int, 0, len(scores))
+	for position := range scores {
+		positions = append(positions, position)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		if scores[positions[i]] != scores[positions[j]] {
+			return scores[positions[i]] > scores[positions[j]]
+		}
+		return positions[i] < positions[j]
+	})
+	if len(positions) > k {
+		positions = positions[:k]
+	}
+
+	hits := make([]lexicalHit, len(positions))
+	for i, position := range positions {
+		hits[i] = lexicalHit{
+			ID:       index.documents[position].id,
+			Score:    scores[position],
+			Coverage: matched[position] / totalIDF,
+		}
+	}
+	return hits
+}
+
+func uniqueTerms(tokens []string) []string {
+	seen := make(map[string]bool, len(tokens))
+	terms := tokens[:0]
+	for _, token := range tokens {
+		if !seen[token] {
+			seen[token] = true
+			terms = append(terms, token)
+		}
+	}
+	return terms
+}
+
+// lexicalIndexes caches the keyword index of each page, built on its first search
+var lexicalIndexes = struct {
+	sync.Mutex
+	pages      map[string]*lexicalIndex
+	generation int // Bumped when documents change, so an index built meanwhile is not cached
+}{pages: make(map[string]*lexicalIndex)}
+
+func lexicalIndexKey(companyID, pageID string) string {
+	return companyID + "|" + pageID
+}
+
+// pageLexicalIndex returns the keyword index of a page's active documents, building it when it is not
+// cached or expired
+func pageLexicalIndex(ctx context.Context, companyID, pageID string) (*lexicalIndex, error) {
+	key := lexicalIndexKey(companyID, pageID)
+	lexicalIndexes.Lock()
+	index, ok := lexicalIndexes.pages[key]
+	generation := lexicalIndexes.generation
+	lexicalIndexes.Unlock()
+	if ok && time.Since(index.builtAt) < lexicalIndexTTL {
+		return index, nil
+	}
+
+	cursor, err := database.Collection("vector_documents").Find(ctx,
+		bson.M{"company_id": companyID, "page_id": pageID, "is_active": true},
+		options.Find().SetProjection(bson.M{"content": 1, "channels": 1, "crm_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var documents []VectorDocument
+	for cursor.Next(ctx) {
+		var doc VectorDocument
+		if err := cursor.Decode(&doc); err != nil {
+			// Documents with channels in the old array format are skipped until migrated
+			continue
+		}
+		documents = append(documents, doc)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	index = newLexicalIndex(documents)
+	lexicalIndexes.Lock()
+	if lexicalIndexes.generation == generation {
+		lexicalIndexes.pages[key] = index
+	}
+	lexicalIndexes.Unlock()
+
+	slog.Debug("Keyword index built",
+		"companyID", companyID,
+		"pageID", pageID,
+		"documents", len(index.documents),
+		"terms", len(index.postings))
+	return index, nil
+}
+
+// invalidateLexicalIndexes drops the keyword indexes of the pages whose documents matching filter
+// changed. All of a company's indexes are dropped when the filter names no page, and every index when
+// it names no company.
+func invalidateLexicalIndexes(filter bson.M) {
+	companyID, _ := filter["company_id"].(string)
+	pageID, _ := filter["page_id"].(string)
+
+	lexicalIndexes.Lock()
+	defer lexicalIndexes.Unlock()
+	lexicalIndexes.generation++
+	switch {
+	case companyID == "":
+		lexicalIndexes.pages = make(map[string]*lexicalIndex)
+	case pageID == "":
+		for key := range lexicalIndexes.pages {
+			if strings.HasPrefix(key, companyID+"|") {
+				delete(lexicalIndexes.pages, key)
+			}
+		}
+	default:
+		delete(lexicalIndexes.pages, lexicalIndexKey(companyID, pageID))
+	}
+}
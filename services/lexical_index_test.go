@@ -0,0 +1,95 @@
+package services
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// lexicalTestDocuments returns documents with the given contents and their IDs in the same order
+func lexicalTestDocuments(contents ...string) ([]VectorDocument, []primitive.ObjectID) {
+	documents := make([]VectorDocument, len(contents))
+	ids := make([]primitive.ObjectID, len(contents))
+	for i, content := range contents {
+		ids[i] = primitive.NewObjectID()
+		documents[i] = VectorDocument{ID: ids[i], Content: content, Channels: map[string]bool{"facebook": true, "messenger": true}}
+	}
+	return documents, ids
+}
+
+func TestLexicalIndexRanksByBM25(t *testing.T) {
+	documents, ids := lexicalTestDocuments(
+		"Delivery in Tbilisi takes one day and costs 5 GEL.",
+		"Our delivery prices: delivery to Batumi costs 10 GEL, delivery to Kutaisi 8 GEL.",
+		"Returns are accepted within thirty days of purchase.",
+		"Product AB-1234 is an oak dining chair.",
+	)
+	index := newLexicalIndex(documents)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []primitive.ObjectID
+	}{
+		{"term frequency ranks first", "delivery prices", []primitive.ObjectID{ids[1], ids[0]}},
+		{"rare term outweighs common one", "delivery Tbilisi", []primitive.ObjectID{ids[0], ids[1]}},
+		{"stemmed plural", "return", []primitive.ObjectID{ids[2]}},
+		{"product code without connector", "ab1234", []primitive.ObjectID{ids[3]}},
+		{"stop words only", "what is the", nil},
+		{"no match", "warranty", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits := index.Search(tt.query, 10, VectorQuery{})
+			if len(hits) != len(tt.want) {
+				t.Fatalf("Search(%q) returned %d hits, want %d", tt.query, len(hits), len(tt.want))
+			}
+			for i, hit := range hits {
+				if hit.ID != tt.want[i] {
+					t.Errorf("Search(%q) hit %d = %s, want %s", tt.query, i, hit.ID.Hex(), tt.want[i].Hex())
+				}
+				if i > 0 && hit.Score > hits[i-1].Score {
+					t.Errorf("Search(%q) hit %d scores %v above hit %d", tt.query, i, hit.Score, i-1)
+				}
+			}
+		})
+	}
+}
+
+func TestLexicalIndexCoverage(t *testing.T) {
+	documents, ids := lexicalTestDocuments(
+		"Delivery to Batumi costs 10 GEL.",
+		"Delivery is free over 100 GEL.",
+		"Opening hours are 10:00 to 19:00.",
+	)
+	hits := newLexicalIndex(documents).Search("delivery Batumi", 10, VectorQuery{})
+	if len(hits) != 2 || hits[0].ID != ids[0] {
+		t.Fatalf("hits = %+v, want the Batumi document first", hits)
+	}
+	if hits[0].Coverage != 1 {
+		t.Errorf("coverage of a document with every query term = %v, want 1", hits[0].Coverage)
+	}
+	if hits[1].Coverage <= 0 || hits[1].Coverage >= 0.5 {
+		t.Errorf("coverage of a document with only the common term = %v, want below half", hits[1].Coverage)
+	}
+}
+
+func TestLexicalIndexScope(t *testing.T) {
+	documents, ids := lexicalTestDocuments("Delivery on Facebook", "Delivery on Messenger", "Delivery from the CRM feed")
+	documents[0].Channels = map[string]bool{"facebook": true, "messenger": false}
+	documents[1].Channels = map[string]bool{"facebook": false, "messenger": true}
+	documents[2].CRMID = "crm-1"
+	index := newLexicalIndex(documents)
+
+	hits := index.Search("delivery", 10, VectorQuery{Channel: "facebook"})
+	if len(hits) != 2 || hits[0].ID == ids[1] || hits[1].ID == ids[1] {
+		t.Errorf("facebook hits = %+v, want the messenger document left out", hits)
+	}
+	hits = index.Search("delivery", 10, VectorQuery{CRMID: "crm-1"})
+	if len(hits) != 1 || hits[0].ID != ids[2] {
+		t.Errorf("CRM hits = %+v, want only the CRM document", hits)
+	}
+	if hits := index.Search("delivery", 1, VectorQuery{}); len(hits) != 1 {
+		t.Errorf("Search with k 1 returned %d hits", len(hits))
+	}
+}
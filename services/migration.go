@@ -19,6 +19,11 @@ func MigrateChannelsToMap(ctx context.Context) error {
 		return fmt.Errorf("failed to migrate vector_documents: %w", err)
 	}
 
+	// Documents in the old format were skipped when the vector index was built
+	if err := BuildVectorIndex(ctx); err != nil {
+		slog.Error("Failed to rebuild vector index after migration", "error", err)
+	}
+
 	// Migrate companies collection (CRM links)
 	if err := migrateCompanies(ctx, db); err != nil {
 		return fmt.Errorf("failed to migrate companies: %w", err)
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"facebook-bot/models"
+)
+
+// Models used when a page has no fallback chain configured
+const (
+	defaultFallbackClaudeModel = "claude-3-haiku-20240307"
+	defaultFallbackOpenAIModel = "gpt-4o-mini"
+)
+
+// ErrAllModelsFailed is returned when no model in a page's fallback chain produced a reply
+var ErrAllModelsFailed = errors.New("all models in the fallback chain failed")
+
+// ProviderError is a non-200 response from a model provider
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s API error: %d - %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// isOutageError reports whether an error means the provider is down or overloaded,
+// as opposed to the request itself being rejected or abandoned by the caller.
+// Only network failures, timeouts and 429/5xx responses count; a cancelled context,
+// an unreadable response or a request that could not be built are not outages.
+func isOutageError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		// 529 is Anthropic's "overloaded" status
+		return providerErr.StatusCode >= 500 || providerErr.StatusCode == http.StatusTooManyRequests
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	// The HTTP client wraps every failure in a *url.Error, including bad request URLs,
+	// so look at the underlying error
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// ReplyTier is one step of a page's fallback chain
+type ReplyTier struct {
+	Name     string // models.ReplyTier*
+	Provider string
+	Model    string
+	apiKey   string
+}
+
+// ReplyTiers returns the models tried for a page's replies, in order. Models without an API key
+// and duplicates are left out. Human handoff is not part of the list; it happens when all tiers fail.
+func ReplyTiers(pageConfig *models.FacebookPage) []ReplyTier {
+	chain := pageConfig.FallbackChain
+	if len(chain) == 0 {
+		chain = []models.FallbackModel{
+			{Provider: models.UsageProviderAnthropic, Model: defaultFallbackClaudeModel},
+			{Provider: models.UsageProviderOpenAI, Model: defaultFallbackOpenAIModel},
+		}
+	}
+
+	tiers := []ReplyTier{{
+		Name:     models.ReplyTierPrimary,
+		Provider: models.UsageProviderAnthropic,
+		Model:    pageConfig.ClaudeModel,
+		apiKey:   pageConfig.ClaudeAPIKey,
+	}}
+	seen := map[string]bool{models.UsageProviderAnthropic + "|" + pageConfig.ClaudeModel: true}
+
+	for _, fallback := range chain {
+		key := fallback.Provider + "|" + fallback.Model
+		if fallback.Model == "" || seen[key] {
+			continue
+		}
+
+		tier := ReplyTier{Provider: fallback.Provider, Model: fallback.Model}
+		switch fallback.Provider {
+		case models.UsageProviderAnthropic:
+			tier.Name = models.ReplyTierFallback
+			tier.apiKey = pageConfig.ClaudeAPIKey
+		case models.UsageProviderOpenAI:
+			tier.Name = models.ReplyTierAlternate
+			tier.apiKey = pageConfig.GPTAPIKey
+		default:
+			continue
+		}
+		if tier.apiKey == "" {
+			continue
+		}
+
+		seen[key] = true
+		tiers = append(tiers, tier)
+	}
+
+	return tiers
+}
+
+// sendWithFallback sends a request down the page's fallback chain until a model answers.
+// Tiers whose circuit breaker is open are skipped. Returns the tier that answered, or the
+// human tier with ErrAllModelsFailed when none did.
+func sendWithFallback(ctx context.Context, pageConfig *models.FacebookPage, request ClaudeRequest) (*ClaudeResponse, ReplyTier, error) {
+	var lastErr error
+	for _, tier := range ReplyTiers(pageConfig) {
+		if !getCircuitBreaker(tier.Provider, tier.Model).allow() {
+			slog.Warn("Skipping model with open circuit breaker",
+				"pageID", pageConfig.PageID,
+				"tier", tier.Name,
+				"model", tier.Model)
+			lastErr = fmt.Errorf("circuit breaker open for %s", tier.Model)
+			continue
+		}
+
+		resp, err := callReplyTier(ctx, tier, request)
+		if err != nil {
+			slog.Error("Model call failed, trying next tier",
+				"pageID", pageConfig.PageID,
+				"tier", tier.Name,
+				"provider", tier.Provider,
+				"model", tier.Model,
+				"error", err)
+			lastErr = err
+			if errors.Is(err, context.Canceled) {
+				break
+			}
+			continue
+		}
+
+		if tier.Name != models.ReplyTierPrimary {
+			slog.Warn("Reply served by fallback tier",
+				"pageID", pageConfig.PageID,
+				"tier", tier.Name,
+				"model", tier.Model)
+		}
+		return resp, tier, nil
+	}
+
+	return nil, ReplyTier{Name: models.ReplyTierHuman}, fmt.Errorf("%w: %v", ErrAllModelsFailed, lastErr)
+}
+
+// callReplyTier sends a request to one tier's model and updates its circuit breaker
+func callReplyTier(ctx context.Context, tier ReplyTier, request ClaudeRequest) (*ClaudeResponse, error) {
+	request.Model = tier.Model
+
+	var resp *ClaudeResponse
+	var err error
+	switch tier.Provider {
+	case models.UsageProviderOpenAI:
+		resp, err = callOpenAIChat(ctx, request, tier.apiKey)
+	default:
+		resp, err = callAnthropic(ctx, request, tier.apiKey)
+	}
+
+	breaker := getCircuitBreaker(tier.Provider, tier.Model)
+	switch {
+	case err == nil:
+		breaker.recordSuccess()
+	case isOutageError(err):
+		breaker.recordFailure(err)
+	default:
+		breaker.releaseProbe()
+	}
+
+	return resp, err
+}
+
+// callAnthropic sends a request to the Claude Messages API
+func callAnthropic(ctx context.Context, request ClaudeRequest, apiKey string) (*ClaudeResponse, error) {
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", claudeAPIURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	// A single retry: slow retries would delay falling back to the next tier
+	resp, body, err := callClaudeAPIWithRetry(req, apiKey, 2)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &ProviderError{Provider: models.UsageProviderAnthropic, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var claudeResp ClaudeResponse
+	if err := json.Unmarshal(body, &claudeResp); err != nil {
+		return nil, err
+	}
+	return &claudeResp, nil
+}
+
+// recordTierUsage records the token usage of a reply under the provider that served it
+func recordTierUsage(ctx context.Context, tier ReplyTier, purpose string, resp *ClaudeResponse) {
+	if tier.Provider == models.UsageProviderOpenAI {
+		RecordUsage(ctx, models.UsageProviderOpenAI, resp.Model, purpose, resp.Usage.InputTokens, resp.Usage.OutputTokens)
+		return
+	}
+	recordClaudeUsage(ctx, purpose, resp)
+}
+
+// GetReplyTierSummary counts the replies served by each tier and model of the fallback chain
+func GetReplyTierSummary(ctx context.Context, companyID, pageID string, from, to time.Time) ([]models.ReplyTierSummary, error) {
+	match := bson.M{
+		"company_id": companyID,
+		"tier":       bson.M{"$exists": true},
+		"timestamp": bson.M{
+			"$gte": from,
+			"$lt":  to,
+		},
+	}
+	if pageID != "" {
+		match["page_id"] = pageID
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     bson.M{"tier": "$tier", "model": "$model"},
+			"replies": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":     0,
+			"tier":    "$_id.tier",
+			"model":   "$_id.model",
+			"replies": 1,
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "replies", Value: -1}}}},
+	}
+
+	cursor, err := GetDatabase().Collection("responses").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	summaries := []models.ReplyTierSummary{}
+	if err := cursor.All(ctx, &summaries); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
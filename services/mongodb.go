@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
@@ -109,6 +110,10 @@ func createIndexes() {
 
 // SaveMessage saves a message to database
 func SaveMessage(ctx context.Context, message *models.Message) error {
+	// Assign the ID up front so callers can update the message later
+	if message.ID.IsZero() {
+		message.ID = primitive.NewObjectID()
+	}
 	collection := database.Collection("messages")
 	_, err := collection.InsertOne(ctx, message)
 	return err
@@ -212,6 +217,11 @@ func SaveComment(ctx context.Context, commentID, postID, parentID, postContent,
 
 // SaveCommentWithNames saves a comment or reply to the comments collection with first and last name
 func SaveCommentWithNames(ctx context.Context, commentID, postID, parentID, postContent, senderID, senderName, firstName, lastName, pageID, pageName, message string, isBot bool) error {
+	return SaveCommentWithLanguage(ctx, commentID, postID, parentID, postContent, senderID, senderName, firstName, lastName, pageID, pageName, message, "", isBot)
+}
+
+// SaveCommentWithLanguage saves a comment or reply to the comments collection with names and detected language
+func SaveCommentWithLanguage(ctx context.Context, commentID, postID, parentID, postContent, senderID, senderName, firstName, lastName, pageID, pageName, message, language string, isBot bool) error {
 	collection := database.Collection("comments")
 
 	// Determine if this is a reply
@@ -229,6 +239,7 @@ func SaveCommentWithNames(ctx context.Context, commentID, postID, parentID, post
 		PageID:      pageID,
 		PageName:    pageName,
 		Message:     message,
+		Language:    language,
 		PostContent: postContent,
 		IsReply:     isReply,
 		IsBot:       isBot,
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"facebook-bot/models"
+)
+
+// openAIChatRequest is a Chat Completions request
+type openAIChatRequest struct {
+	Model      string              `json:"model"`
+	Messages   []openAIChatMessage `json:"messages"`
+	MaxTokens  int                 `json:"max_tokens,omitempty"`
+	Tools      []openAITool        `json:"tools,omitempty"`
+	ToolChoice interface{}         `json:"tool_choice,omitempty"`
+}
+
+type openAIChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAITool struct {
+	Type     string         `json:"type"` // Always "function"
+	Function openAIFunction `json:"function"`
+}
+
+type openAIFunction struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Parameters  InputSchema `json:"parameters"`
+}
+
+// openAIChatResponse is a Chat Completions response
+type openAIChatResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// callOpenAIChat sends a Claude request to the OpenAI Chat Completions API and converts the answer
+// back into a Claude response, so replies can fall back to OpenAI without changing the callers
+func callOpenAIChat(ctx context.Context, claudeReq ClaudeRequest, apiKey string) (*ClaudeResponse, error) {
+	chatReq := openAIChatRequest{
+		Model:     claudeReq.Model,
+		MaxTokens: claudeReq.MaxTokens,
+	}
+
+	var system strings.Builder
+	for _, block := range claudeReq.System {
+		if system.Len() > 0 {
+			system.WriteString("\n\n")
+		}
+		system.WriteString(block.Text)
+	}
+	if system.Len() > 0 {
+		chatReq.Messages = append(chatReq.Messages, openAIChatMessage{Role: "system", Content: system.String()})
+	}
+	for _, msg := range claudeReq.Messages {
+		content, ok := msg.Content.(string)
+		if !ok {
+			return nil, fmt.Errorf("unsupported message content type %T for OpenAI", msg.Content)
+		}
+		chatReq.Messages = append(chatReq.Messages, openAIChatMessage{Role: msg.Role, Content: content})
+	}
+
+	for _, tool := range claudeReq.Tools {
+		chatReq.Tools = append(chatReq.Tools, openAITool{
+			Type: "function",
+			Function: openAIFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+	if claudeReq.ToolChoice != nil {
+		switch claudeReq.ToolChoice.Type {
+		case "tool":
+			chatReq.ToolChoice = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]string{"name": claudeReq.ToolChoice.Name},
+			}
+		case "any":
+			chatReq.ToolChoice = "required"
+		default:
+			chatReq.ToolChoice = "auto"
+		}
+	}
+
+	jsonData, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", openAIChatURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	client := &http.Client{Timeout: 45 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &ProviderError{Provider: models.UsageProviderOpenAI, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var chatResp openAIChatResponse
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		return nil, err
+	}
+	if len(chatResp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in OpenAI response")
+	}
+
+	choice := chatResp.Choices[0]
+	claudeResp := &ClaudeResponse{
+		ID:         chatResp.ID,
+		Type:       "message",
+		Role:       "assistant",
+		Model:      chatResp.Model,
+		StopReason: choice.FinishReason,
+	}
+	claudeResp.Usage.InputTokens = chatResp.Usage.PromptTokens
+	claudeResp.Usage.OutputTokens = chatResp.Usage.CompletionTokens
+
+	for _, call := range choice.Message.ToolCalls {
+		block := ContentBlock{
+			Type: "tool_use",
+			ID:   call.ID,
+			Name: call.Function.Name,
+		}
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &block.Input); err != nil {
+			return nil, fmt.Errorf("invalid OpenAI tool arguments: %w", err)
+		}
+		claudeResp.Content = append(claudeResp.Content, block)
+	}
+	if choice.Message.Content != "" {
+		claudeResp.Content = append(claudeResp.Content, ContentBlock{Type: "text", Text: choice.Message.Content})
+	}
+
+	return claudeResp, nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// pageKnowledgeMaxChars caps the knowledge snapshot sent with every reply (roughly 10k tokens).
+// Documents that do not fit are only reached through retrieval.
+const pageKnowledgeMaxChars = 40000
+
+// pageKnowledgeCacheTTL matches the lifetime of Anthropic's ephemeral prompt cache, so a CRM update
+// reaches the prompt at most one cache lifetime later
+const pageKnowledgeCacheTTL = 5 * time.Minute
+
+type pageKnowledge struct {
+	text      string
+	fetchedAt time.Time
+}
+
+var (
+	pageKnowledgeCache   = make(map[string]*pageKnowledge)
+	pageKnowledgeCacheMu sync.Mutex
+)
+
+// GetPageKnowledge returns the page's active knowledge documents for a channel as one text block.
+// The text only changes when the documents change, which makes it a stable prompt prefix for caching:
+// documents are ordered by source, CRM link and creation time and joined whole until the size cap is reached.
+func GetPageKnowledge(ctx context.Context, companyID, pageID, channel string) (string, error) {
+	channel = normalizeChannel(channel)
+	key := companyID + "|" + pageID + "|" + channel
+
+	pageKnowledgeCacheMu.Lock()
+	if cached, ok := pageKnowledgeCache[key]; ok && time.Since(cached.fetchedAt) < pageKnowledgeCacheTTL {
+		text := cached.text
+		pageKnowledgeCacheMu.Unlock()
+		return text, nil
+	}
+	pageKnowledgeCacheMu.Unlock()
+
+	filter := bson.M{
+		"company_id":          companyID,
+		"page_id":             pageID,
+		"channels." + channel: true,
+		"is_active":           true,
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "source", Value: 1}, {Key: "crm_url", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetProjection(bson.M{"content": 1})
+
+	cursor, err := GetDatabase().Collection("vector_documents").Find(ctx, filter, opts)
+	if err != nil {
+		return "", err
+	}
+	defer cursor.Close(ctx)
+
+	var documents []struct {
+		Content string `bson:"content"`
+	}
+	if err := cursor.All(ctx, &documents); err != nil {
+		return "", err
+	}
+
+	contents := make([]string, 0, len(documents))
+	for _, doc := range documents {
+		contents = append(contents, doc.Content)
+	}
+	text := joinPageKnowledge(contents, pageKnowledgeMaxChars)
+
+	pageKnowledgeCacheMu.Lock()
+	pageKnowledgeCache[key] = &pageKnowledge{text: text, fetchedAt: time.Now()}
+	pageKnowledgeCacheMu.Unlock()
+
+	return text, nil
+}
+
+// joinPageKnowledge joins whole documents in order until the next one would exceed maxChars
+func joinPageKnowledge(contents []string, maxChars int) string {
+	const separator = "\n\n---\n\n"
+
+	var knowledge strings.Builder
+	for _, content := range contents {
+		content = strings.TrimSpace(content)
+		if content == "" {
+			continue
+		}
+		size := len(content)
+		if knowledge.Len() > 0 {
+			size += len(separator)
+		}
+		if knowledge.Len()+size > maxChars {
+			break
+		}
+		if knowledge.Len() > 0 {
+			knowledge.WriteString(separator)
+		}
+		knowledge.WriteString(content)
+	}
+	return knowledge.String()
+}
@@ -0,0 +1,15 @@
+package services
+
+import "testing"
+
+func TestJoinPageKnowledge(t *testing.T) {
+	contents := []string{"first document", "  ", "second document", "third document is too long to fit"}
+
+	got := joinPageKnowledge(contents, 40)
+	if want := "first document\n\n---\n\nsecond document"; got != want {
+		t.Errorf("joinPageKnowledge = %q, want %q", got, want)
+	}
+	if got := joinPageKnowledge(contents, 5); got != "" {
+		t.Errorf("joinPageKnowledge with a small cap = %q, want empty", got)
+	}
+}
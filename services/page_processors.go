@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"facebook-bot/chunking"
 	"facebook-bot/models"
 )
 
@@ -431,10 +432,9 @@ func FetchAndProcessCRMData(ctx context.Context, pageID string, companyID string
 		"totalCRMURLs", len(processor.CRMURLs),
 	)
 
-	var allProcessedText strings.Builder
-	allProcessedText.WriteString(fmt.Sprintf("Real Estate Information (Updated: %s)\n\n", time.Now().Format("2006-01-02 15:04:05")))
-
-	// Fetch and process only active CRM URLs
+	// Fetch, process and store only active CRM URLs, one set of chunks per URL
+	successCount := 0
+	totalChunks := 0
 	for _, url := range activeCRMURLs {
 		slog.Info("Fetching CRM data from active link", "url", url)
 
@@ -460,32 +460,10 @@ func FetchAndProcessCRMData(ctx context.Context, pageID string, companyID string
 			continue
 		}
 
-		allProcessedText.WriteString(processedText)
-		allProcessedText.WriteString("\n\n")
-
 		slog.Info("Successfully processed CRM data",
 			"url", url,
 			"textLength", len(processedText),
 		)
-	}
-
-	finalText := allProcessedText.String()
-	if finalText == "" {
-		slog.Warn("No CRM data was processed", "pageID", pageID)
-		return nil
-	}
-
-	// Store one document per CRM URL
-	successCount := 0
-	for _, url := range activeCRMURLs {
-		// Find if this CRM link is active
-		isActive := false
-		for _, crmLink := range pageConfig.CRMLinks {
-			if crmLink.URL == url && crmLink.IsActive {
-				isActive = true
-				break
-			}
-		}
 
 		// Store the processed text as embeddings in MongoDB
 		metadata := map[string]string{
@@ -495,8 +473,9 @@ func FetchAndProcessCRMData(ctx context.Context, pageID string, companyID string
 			"update_time": time.Now().Format(time.RFC3339),
 		}
 
-		// Store the entire content as one document per CRM URL
-		err := StoreEmbeddingsWithOptions(ctx, companyID, pageID, finalText, "crm", metadata, url, isActive)
+		// Every chunk starts with the heading, so it says what it is about out of context
+		chunks, err := storeCRMContent(ctx, companyID, pageID, nil, chunking.StrategyRecursive,
+			"# Real Estate Information\n\n"+processedText, metadata, url, "", true)
 		if err != nil {
 			slog.Error("Failed to store embeddings",
 				"error", err,
@@ -506,6 +485,7 @@ func FetchAndProcessCRMData(ctx context.Context, pageID string, companyID string
 			continue
 		}
 		successCount++
+		totalChunks += chunks
 	}
 
 	if successCount == 0 {
@@ -519,40 +499,9 @@ func FetchAndProcessCRMData(ctx context.Context, pageID string, companyID string
 	slog.Info("Successfully stored CRM embeddings",
 		"pageID", pageID,
 		"companyID", companyID,
-		"documentsStored", successCount,
-		"totalTextLength", len(finalText),
+		"urlsStored", successCount,
+		"chunksStored", totalChunks,
 	)
 
 	return nil
 }
-
-// splitTextIntoChunks splits text into chunks of specified max size
-func splitTextIntoChunks(text string, maxSize int) []string {
-	if len(text) <= maxSize {
-		return []string{text}
-	}
-
-	var chunks []string
-	lines := strings.Split(text, "\n")
-	currentChunk := ""
-
-	for _, line := range lines {
-		// If adding this line would exceed max size, start new chunk
-		if len(currentChunk)+len(line)+1 > maxSize && currentChunk != "" {
-			chunks = append(chunks, currentChunk)
-			currentChunk = line
-		} else {
-			if currentChunk != "" {
-				currentChunk += "\n"
-			}
-			currentChunk += line
-		}
-	}
-
-	// Add the last chunk
-	if currentChunk != "" {
-		chunks = append(chunks, currentChunk)
-	}
-
-	return chunks
-}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"facebook-bot/models"
+)
+
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	InputPerMillion  float64 `json:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million"`
+
+	// Prompt caching prices; when zero they are derived from the input price
+	CacheWritePerMillion float64 `json:"cache_write_per_million,omitempty"`
+	CacheReadPerMillion  float64 `json:"cache_read_per_million,omitempty"`
+}
+
+// Anthropic bills cache writes at 125% and cache reads at 10% of the base input price
+const (
+	cacheWritePriceMultiplier = 1.25
+	cacheReadPriceMultiplier  = 0.10
+)
+
+// cacheWritePrice returns the price per million tokens written to the prompt cache
+func (p ModelPrice) cacheWritePrice() float64 {
+	if p.CacheWritePerMillion > 0 {
+		return p.CacheWritePerMillion
+	}
+	return p.InputPerMillion * cacheWritePriceMultiplier
+}
+
+// cacheReadPrice returns the price per million tokens read from the prompt cache
+func (p ModelPrice) cacheReadPrice() float64 {
+	if p.CacheReadPerMillion > 0 {
+		return p.CacheReadPerMillion
+	}
+	return p.InputPerMillion * cacheReadPriceMultiplier
+}
+
+// defaultModelPrices are list prices used when no pricing file is configured.
+// Keys are matched exactly first, then as the longest model name prefix.
+var defaultModelPrices = map[string]ModelPrice{
+	// Anthropic
+	"claude-3-haiku":    {InputPerMillion: 0.25, OutputPerMillion: 1.25},
+	"claude-3-5-haiku":  {InputPerMillion: 0.80, OutputPerMillion: 4.00},
+	"claude-3-5-sonnet": {InputPerMillion: 3.00, OutputPerMillion: 15.00},
+	"claude-3-7-sonnet": {InputPerMillion: 3.00, OutputPerMillion: 15.00},
+	"claude-sonnet-4":   {InputPerMillion: 3.00, OutputPerMillion: 15.00},
+	"claude-3-opus":     {InputPerMillion: 15.00, OutputPerMillion: 75.00},
+	"claude-opus-4":     {InputPerMillion: 15.00, OutputPerMillion: 75.00},
+
+	// OpenAI chat, used as an alternate reply provider
+	"gpt-4o-mini": {InputPerMillion: 0.15, OutputPerMillion: 0.60},
+	"gpt-4o":      {InputPerMillion: 2.50, OutputPerMillion: 10.00},
+
+	// OpenAI embeddings
+	"text-embedding-3-small": {InputPerMillion: 0.02},
+	"text-embedding-3-large": {InputPerMillion: 0.13},
+	"text-embedding-ada-002": {InputPerMillion: 0.10},
+
+	// Voyage embeddings
+	"voyage-2":              {InputPerMillion: 0.10},
+	"voyage-large-2":        {InputPerMillion: 0.12},
+	"voyage-3":              {InputPerMillion: 0.06},
+	"voyage-3-lite":         {InputPerMillion: 0.02},
+	"voyage-3-large":        {InputPerMillion: 0.18},
+	"voyage-multilingual-2": {InputPerMillion: 0.12},
+
+	// Cohere embeddings
+	"embed-english-v3.0":      {InputPerMillion: 0.10},
+	"embed-multilingual-v3.0": {InputPerMillion: 0.10},
+
+	// Voyage rerankers, billed by tokens of the query and documents
+	"rerank-2":        {InputPerMillion: 0.05},
+	"rerank-2-lite":   {InputPerMillion: 0.02},
+	"rerank-2.5":      {InputPerMillion: 0.05},
+	"rerank-2.5-lite": {InputPerMillion: 0.02},
+
+	// Cohere rerankers are billed $2 per 1,000 searches. Their usage records search units (a query
+	// with up to 100 documents) as input tokens, so the price is per million searches.
+	"rerank-v3.5":              {InputPerMillion: 2000},
+	"rerank-english-v3.0":      {InputPerMillion: 2000},
+	"rerank-multilingual-v3.0": {InputPerMillion: 2000},
+}
+
+var (
+	modelPrices     map[string]ModelPrice
+	modelPricesOnce sync.Once
+)
+
+// loadModelPrices merges the default price table with overrides from MODEL_PRICING_FILE.
+// The file is a JSON object keyed by model name, e.g.
+// {"claude-3-haiku": {"input_per_million": 0.25, "output_per_million": 1.25}}
+func loadModelPrices() {
+	modelPrices = make(map[string]ModelPrice, len(defaultModelPrices))
+	for model, price := range defaultModelPrices {
+		modelPrices[model] = price
+	}
+
+	path := os.Getenv("MODEL_PRICING_FILE")
+	if path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		slog.Error("Failed to read model pricing file, using default prices", "path", path, "error", err)
+		return
+	}
+
+	var overrides map[string]ModelPrice
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		slog.Error("Failed to parse model pricing file, using default prices", "path", path, "error", err)
+		return
+	}
+
+	for model, price := range overrides {
+		modelPrices[model] = price
+	}
+
+	slog.Info("Loaded model pricing overrides", "path", path, "count", len(overrides))
+}
+
+// GetModelPrice returns the price for a model and whether it is known
+func GetModelPrice(model string) (ModelPrice, bool) {
+	modelPricesOnce.Do(loadModelPrices)
+
+	if price, ok := modelPrices[model]; ok {
+		return price, true
+	}
+
+	// Versioned model names such as "claude-3-haiku-20240307" match their family prefix
+	bestMatch := ""
+	for name := range modelPrices {
+		if strings.HasPrefix(model, name) && len(name) > len(bestMatch) {
+			bestMatch = name
+		}
+	}
+	if bestMatch != "" {
+		return modelPrices[bestMatch], true
+	}
+
+	return ModelPrice{}, false
+}
+
+// CalculateCost computes the USD cost of a usage event and, for cached prompts,
+// how much was saved compared to sending every input token uncached
+func CalculateCost(event *models.UsageEvent) (cost, cacheSavings float64) {
+	price, ok := GetModelPrice(event.Model)
+	if !ok {
+		slog.Warn("No price configured for model, recording zero cost", "model", event.Model)
+		return 0, 0
+	}
+
+	cost = (float64(event.InputTokens)*price.InputPerMillion +
+		float64(event.OutputTokens)*price.OutputPerMillion +
+		float64(event.CacheCreationTokens)*price.cacheWritePrice() +
+		float64(event.CacheReadTokens)*price.cacheReadPrice()) / 1_000_000
+
+	uncachedCost := float64(event.CacheCreationTokens+event.CacheReadTokens) * price.InputPerMillion / 1_000_000
+	cachedCost := (float64(event.CacheCreationTokens)*price.cacheWritePrice() + float64(event.CacheReadTokens)*price.cacheReadPrice()) / 1_000_000
+	cacheSavings = uncachedCost - cachedCost
+
+	return cost, cacheSavings
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"facebook-bot/models"
+)
+
+func TestGetModelPrice(t *testing.T) {
+	tests := []struct {
+		model string
+		want  float64 // Input price per million tokens
+		known bool
+	}{
+		{"claude-3-haiku", 0.25, true},
+		{"claude-3-haiku-20240307", 0.25, true},
+		{"claude-3-5-haiku-20241022", 0.80, true},
+		{"claude-sonnet-4-20250514", 3.00, true},
+		{"voyage-3-lite", 0.02, true},
+		{"voyage-3-large", 0.18, true},
+		{"rerank-2", 0.05, true},
+		{"rerank-2.5-lite", 0.02, true},
+		{"rerank-v3.5", 2000, true},
+		{"unknown-model", 0, false},
+	}
+	for _, tt := range tests {
+		price, ok := GetModelPrice(tt.model)
+		if ok != tt.known || price.InputPerMillion != tt.want {
+			t.Errorf("GetModelPrice(%q) = %v, %v; want input price %v, %v", tt.model, price.InputPerMillion, ok, tt.want, tt.known)
+		}
+	}
+}
+
+func TestCalculateCost(t *testing.T) {
+	tests := []struct {
+		name        string
+		event       models.UsageEvent
+		wantCost    float64
+		wantSavings float64
+	}{
+		{
+			name:     "uncached",
+			event:    models.UsageEvent{Model: "claude-3-haiku-20240307", InputTokens: 1_000_000, OutputTokens: 200_000},
+			wantCost: 0.25 + 0.25,
+		},
+		{
+			name:     "embedding",
+			event:    models.UsageEvent{Model: "text-embedding-3-small", InputTokens: 500_000},
+			wantCost: 0.01,
+		},
+		{
+			name:        "cache write and read",
+			event:       models.UsageEvent{Model: "claude-3-haiku-20240307", CacheCreationTokens: 1_000_000, CacheReadTokens: 1_000_000},
+			wantCost:    0.3125 + 0.025,
+			wantSavings: 0.50 - 0.3375,
+		},
+		{
+			name:     "cohere rerank search units",
+			event:    models.UsageEvent{Model: "rerank-v3.5", InputTokens: 3},
+			wantCost: 0.006,
+		},
+		{
+			name:  "unknown model",
+			event: models.UsageEvent{Model: "unknown-model", InputTokens: 1_000_000},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost, savings := CalculateCost(&tt.event)
+			if math.Abs(cost-tt.wantCost) > 1e-9 || math.Abs(savings-tt.wantSavings) > 1e-9 {
+				t.Errorf("CalculateCost = %v, %v; want %v, %v", cost, savings, tt.wantCost, tt.wantSavings)
+			}
+		})
+	}
+}
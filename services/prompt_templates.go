@@ -0,0 +1,624 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"facebook-bot/models"
+)
+
+// PromptData is the data available to prompt templates
+type PromptData struct {
+	PageName         string
+	CompanyName      string
+	CustomPrompt     string // Page system prompt configured by the company
+	MessageType      string // "chat", "comment" or "reply"
+	HasKnowledgeBase bool   // True when RAG context is sent with the request
+	Language         string // Detected customer language code, "" if unknown
+	LanguageName     string // English name of the customer language, "" if unknown
+}
+
+// promptLayer is one resolved layer of a prompt
+type promptLayer struct {
+	label   string
+	content string
+}
+
+// resolvedPrompt is the parsed composition of all layers for a page
+type resolvedPrompt struct {
+	tmpl      *template.Template
+	version   string
+	fetchedAt time.Time
+}
+
+var (
+	resolvedPromptCache   = make(map[string]*resolvedPrompt)
+	resolvedPromptCacheMu sync.RWMutex
+)
+
+const resolvedPromptCacheTTL = 5 * time.Minute
+
+// PageVertical returns the business vertical of a page, defaulting to store
+func PageVertical(pageConfig *models.FacebookPage) string {
+	if pageConfig != nil && models.IsValidVertical(pageConfig.Vertical) {
+		return pageConfig.Vertical
+	}
+	return models.VerticalStore
+}
+
+// RenderPrompt renders a prompt for a page from its base, vertical and page layers.
+// Returns the rendered text and a version string describing the layers used.
+// Falls back to the built-in layers if the stored templates cannot be loaded or rendered.
+func RenderPrompt(ctx context.Context, key, companyID string, pageConfig *models.FacebookPage, data PromptData) (string, string) {
+	if draft, ok := ctx.Value(promptDraftKey{}).(*models.PromptTemplate); ok && draft.Key == key {
+		text, version, err := PreviewPrompt(ctx, key, companyID, pageConfig, draft, data)
+		if err == nil {
+			return text, version
+		}
+		slog.Error("Failed to render draft prompt, using published prompt",
+			"key", key,
+			"pageID", pageConfig.PageID,
+			"templateID", draft.ID.Hex(),
+			"error", err)
+	}
+
+	resolved, err := resolvePrompt(ctx, key, companyID, pageConfig)
+	if err == nil {
+		text, renderErr := executePrompt(resolved.tmpl, data)
+		if renderErr == nil {
+			return text, resolved.version
+		}
+		err = renderErr
+	}
+
+	slog.Error("Failed to render stored prompt, using built-in prompt",
+		"key", key,
+		"pageID", pageConfig.PageID,
+		"error", err)
+
+	layers := builtinPromptLayers(key, PageVertical(pageConfig))
+	tmpl, parseErr := composePrompt(key, layers)
+	if parseErr != nil {
+		// Built-in templates are covered by the seed; this only happens on a programming error
+		slog.Error("Failed to parse built-in prompt", "key", key, "error", parseErr)
+		return "", "invalid"
+	}
+
+	text, renderErr := executePrompt(tmpl, data)
+	if renderErr != nil {
+		slog.Error("Failed to render built-in prompt", "key", key, "error", renderErr)
+		return "", "invalid"
+	}
+
+	return text, promptVersionLabel(layers)
+}
+
+type promptDraftKey struct{}
+
+// WithPromptDraft makes RenderPrompt use a draft template version in place of the stored layer,
+// e.g. to evaluate a prompt change before publishing it
+func WithPromptDraft(ctx context.Context, draft *models.PromptTemplate) context.Context {
+	return context.WithValue(ctx, promptDraftKey{}, draft)
+}
+
+// PreviewPrompt renders a prompt for a page with a draft layer substituted for the stored one.
+// draft may be nil to preview the currently published composition.
+func PreviewPrompt(ctx context.Context, key, companyID string, pageConfig *models.FacebookPage, draft *models.PromptTemplate, data PromptData) (string, string, error) {
+	layers, err := loadPromptLayers(ctx, key, companyID, pageConfig, draft)
+	if err != nil {
+		return "", "", err
+	}
+
+	tmpl, err := composePrompt(key, layers)
+	if err != nil {
+		return "", "", err
+	}
+
+	text, err := executePrompt(tmpl, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	return text, promptVersionLabel(layers), nil
+}
+
+// resolvePrompt returns the cached composition for a page, loading it if needed
+func resolvePrompt(ctx context.Context, key, companyID string, pageConfig *models.FacebookPage) (*resolvedPrompt, error) {
+	cacheKey := companyID + "|" + pageConfig.PageID + "|" + PageVertical(pageConfig) + "|" + key
+
+	resolvedPromptCacheMu.RLock()
+	cached, ok := resolvedPromptCache[cacheKey]
+	resolvedPromptCacheMu.RUnlock()
+	if ok && time.Since(cached.fetchedAt) < resolvedPromptCacheTTL {
+		return cached, nil
+	}
+
+	layers, err := loadPromptLayers(ctx, key, companyID, pageConfig, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := composePrompt(key, layers)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := &resolvedPrompt{
+		tmpl:      tmpl,
+		version:   promptVersionLabel(layers),
+		fetchedAt: time.Now(),
+	}
+
+	resolvedPromptCacheMu.Lock()
+	resolvedPromptCache[cacheKey] = resolved
+	resolvedPromptCacheMu.Unlock()
+
+	return resolved, nil
+}
+
+// clearResolvedPromptCache drops all cached compositions after a publish or rollback
+func clearResolvedPromptCache() {
+	resolvedPromptCacheMu.Lock()
+	resolvedPromptCache = make(map[string]*resolvedPrompt)
+	resolvedPromptCacheMu.Unlock()
+}
+
+// loadPromptLayers loads the published base, vertical and page layers for a page.
+// Company-specific base and vertical layers take precedence over the shared ones.
+// If draft is set it replaces the layer with the same identity.
+func loadPromptLayers(ctx context.Context, key, companyID string, pageConfig *models.FacebookPage, draft *models.PromptTemplate) ([]promptLayer, error) {
+	vertical := PageVertical(pageConfig)
+	collection := GetDatabase().Collection("prompt_templates")
+
+	filter := bson.M{
+		"key":    key,
+		"status": models.PromptStatusPublished,
+		"$or": []bson.M{
+			{"layer": models.PromptLayerBase, "company_id": bson.M{"$in": []string{companyID, ""}}},
+			{"layer": models.PromptLayerVertical, "vertical": vertical, "company_id": bson.M{"$in": []string{companyID, ""}}},
+			{"layer": models.PromptLayerPage, "company_id": companyID, "page_id": pageConfig.PageID},
+		},
+	}
+
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var templates []models.PromptTemplate
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, err
+	}
+
+	// Pick one template per layer, preferring the company's own version
+	selected := make(map[string]*models.PromptTemplate)
+	for i := range templates {
+		t := &templates[i]
+		current, exists := selected[t.Layer]
+		if !exists || (current.CompanyID == "" && t.CompanyID != "") {
+			selected[t.Layer] = t
+		}
+	}
+
+	if draft != nil {
+		selected[draft.Layer] = draft
+	}
+
+	var layers []promptLayer
+	for _, layer := range []string{models.PromptLayerBase, models.PromptLayerVertical, models.PromptLayerPage} {
+		if t, ok := selected[layer]; ok {
+			layers = append(layers, promptLayer{
+				label:   promptLayerLabel(t),
+				content: t.Content,
+			})
+			continue
+		}
+
+		// Nothing stored for this layer yet, use the built-in one
+		if content, ok := defaultPromptTemplate(key, layer, vertical); ok {
+			layers = append(layers, promptLayer{
+				label:   builtinLayerLabel(layer, vertical),
+				content: content,
+			})
+		}
+	}
+
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("no prompt template found for key %s", key)
+	}
+
+	return layers, nil
+}
+
+// builtinPromptLayers returns the built-in base and vertical layers
+func builtinPromptLayers(key, vertical string) []promptLayer {
+	var layers []promptLayer
+	for _, layer := range []string{models.PromptLayerBase, models.PromptLayerVertical} {
+		if content, ok := defaultPromptTemplate(key, layer, vertical); ok {
+			layers = append(layers, promptLayer{
+				label:   builtinLayerLabel(layer, vertical),
+				content: content,
+			})
+		}
+	}
+	return layers
+}
+
+// composePrompt parses all layers into one template so later layers override earlier blocks
+func composePrompt(key string, layers []promptLayer) (*template.Template, error) {
+	tmpl := template.New(key).Option("missingkey=zero")
+	for _, layer := range layers {
+		if _, err := tmpl.Parse(layer.content); err != nil {
+			return nil, fmt.Errorf("layer %s: %w", layer.label, err)
+		}
+	}
+	return tmpl, nil
+}
+
+// executePrompt renders a composed prompt
+func executePrompt(tmpl *template.Template, data PromptData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// promptLayerLabel describes a stored layer, e.g. "vertical:store@2"
+func promptLayerLabel(t *models.PromptTemplate) string {
+	name := t.Layer
+	if t.Layer == models.PromptLayerVertical {
+		name += ":" + t.Vertical
+	}
+	if t.CompanyID == "" {
+		name += "(shared)"
+	}
+	if t.ID.IsZero() {
+		return name + "@draft"
+	}
+	return fmt.Sprintf("%s@%d", name, t.Version)
+}
+
+// builtinLayerLabel describes a built-in layer that is not stored in the database
+func builtinLayerLabel(layer, vertical string) string {
+	if layer == models.PromptLayerVertical {
+		return "vertical:" + vertical + "@builtin"
+	}
+	return layer + "@builtin"
+}
+
+// promptVersionLabel joins the labels of all layers
+func promptVersionLabel(layers []promptLayer) string {
+	labels := make([]string, len(layers))
+	for i, layer := range layers {
+		labels[i] = layer.label
+	}
+	return strings.Join(labels, ",")
+}
+
+// promptIdentityFilter matches all versions of a template's layer for a company
+func promptIdentityFilter(t *models.PromptTemplate) bson.M {
+	filter := bson.M{
+		"key":        t.Key,
+		"layer":      t.Layer,
+		"company_id": t.CompanyID,
+	}
+	switch t.Layer {
+	case models.PromptLayerVertical:
+		filter["vertical"] = t.Vertical
+	case models.PromptLayerPage:
+		filter["page_id"] = t.PageID
+	}
+	return filter
+}
+
+// ValidatePromptTemplate checks that a template parses on top of the built-in layers and renders with sample data
+func ValidatePromptTemplate(t *models.PromptTemplate) error {
+	vertical := t.Vertical
+	if vertical == "" {
+		vertical = models.VerticalStore
+	}
+
+	layers := []promptLayer{}
+	for _, layer := range builtinPromptLayers(t.Key, vertical) {
+		// Only layers below the template's own layer are combined with it
+		if t.Layer == models.PromptLayerBase || (t.Layer == models.PromptLayerVertical && strings.HasPrefix(layer.label, "vertical")) {
+			continue
+		}
+		layers = append(layers, layer)
+	}
+	layers = append(layers, promptLayer{label: t.Layer + "@draft", content: t.Content})
+
+	tmpl, err := composePrompt(t.Key, layers)
+	if err != nil {
+		return err
+	}
+
+	sample := SamplePromptData("Sample Page", "Sample Company", "")
+	if _, err := executePrompt(tmpl, sample); err != nil {
+		return err
+	}
+	sample.HasKnowledgeBase = false
+	_, err = executePrompt(tmpl, sample)
+	return err
+}
+
+// SamplePromptData returns data used to preview prompts
+func SamplePromptData(pageName, companyName, customPrompt string) PromptData {
+	return PromptData{
+		PageName:         pageName,
+		CompanyName:      companyName,
+		CustomPrompt:     customPrompt,
+		MessageType:      "chat",
+		HasKnowledgeBase: true,
+	}
+}
+
+// CreatePromptTemplate stores a new draft version of a prompt layer
+func CreatePromptTemplate(ctx context.Context, t *models.PromptTemplate) error {
+	collection := GetDatabase().Collection("prompt_templates")
+
+	// Next version number for this layer
+	var latest models.PromptTemplate
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	err := collection.FindOne(ctx, promptIdentityFilter(t), opts).Decode(&latest)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	t.ID = primitive.NilObjectID
+	t.Version = latest.Version + 1
+	t.Status = models.PromptStatusDraft
+	t.CreatedAt = time.Now()
+	t.PublishedAt = nil
+
+	result, err := collection.InsertOne(ctx, t)
+	if err != nil {
+		return err
+	}
+	t.ID = result.InsertedID.(primitive.ObjectID)
+
+	slog.Info("Prompt template draft created",
+		"key", t.Key,
+		"layer", t.Layer,
+		"companyID", t.CompanyID,
+		"version", t.Version)
+
+	return nil
+}
+
+// GetPromptTemplate retrieves a prompt template by ID for a company
+func GetPromptTemplate(ctx context.Context, templateID, companyID string) (*models.PromptTemplate, error) {
+	objectID, err := primitive.ObjectIDFromHex(templateID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template ID")
+	}
+
+	var t models.PromptTemplate
+	err = GetDatabase().Collection("prompt_templates").FindOne(ctx, bson.M{
+		"_id":        objectID,
+		"company_id": companyID,
+	}).Decode(&t)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// GetPromptTemplates lists a company's prompt templates together with the shared layers.
+// key, layer and pageID are optional filters.
+func GetPromptTemplates(ctx context.Context, companyID, key, layer, pageID string) ([]models.PromptTemplate, error) {
+	filter := bson.M{
+		"company_id": bson.M{"$in": []string{companyID, ""}},
+	}
+	if key != "" {
+		filter["key"] = key
+	}
+	if layer != "" {
+		filter["layer"] = layer
+	}
+	if pageID != "" {
+		filter["page_id"] = pageID
+	}
+
+	opts := options.Find().SetSort(bson.D{
+		{Key: "key", Value: 1},
+		{Key: "layer", Value: 1},
+		{Key: "version", Value: -1},
+	})
+
+	cursor, err := GetDatabase().Collection("prompt_templates").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	templates := []models.PromptTemplate{}
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// PublishPromptTemplate makes a version the published one for its layer and archives the previous one
+func PublishPromptTemplate(ctx context.Context, t *models.PromptTemplate) error {
+	collection := GetDatabase().Collection("prompt_templates")
+	now := time.Now()
+
+	archiveFilter := promptIdentityFilter(t)
+	archiveFilter["status"] = models.PromptStatusPublished
+	archiveFilter["_id"] = bson.M{"$ne": t.ID}
+
+	if _, err := collection.UpdateMany(ctx, archiveFilter, bson.M{
+		"$set": bson.M{"status": models.PromptStatusArchived},
+	}); err != nil {
+		return err
+	}
+
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": t.ID}, bson.M{
+		"$set": bson.M{
+			"status":       models.PromptStatusPublished,
+			"published_at": now,
+		},
+	}); err != nil {
+		return err
+	}
+
+	t.Status = models.PromptStatusPublished
+	t.PublishedAt = &now
+	clearResolvedPromptCache()
+
+	slog.Info("Prompt template published",
+		"key", t.Key,
+		"layer", t.Layer,
+		"companyID", t.CompanyID,
+		"version", t.Version)
+
+	return nil
+}
+
+// RollbackPromptTemplate republishes an earlier version of a layer.
+// If version is 0 the most recent previously published version is restored.
+// If there is no earlier version the company's layer is unpublished so the shared layer applies again.
+// Returns the template that is now published, or nil if the layer was unpublished.
+func RollbackPromptTemplate(ctx context.Context, identity *models.PromptTemplate, version int) (*models.PromptTemplate, error) {
+	collection := GetDatabase().Collection("prompt_templates")
+
+	currentFilter := promptIdentityFilter(identity)
+	currentFilter["status"] = models.PromptStatusPublished
+
+	var current models.PromptTemplate
+	err := collection.FindOne(ctx, currentFilter).Decode(&current)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("no published version to roll back")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	targetFilter := promptIdentityFilter(identity)
+	if version > 0 {
+		if version == current.Version {
+			return nil, fmt.Errorf("version %d is already published", version)
+		}
+		targetFilter["version"] = version
+	} else {
+		targetFilter["version"] = bson.M{"$lt": current.Version}
+		targetFilter["published_at"] = bson.M{"$exists": true}
+	}
+
+	var target models.PromptTemplate
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	err = collection.FindOne(ctx, targetFilter, opts).Decode(&target)
+	if err == mongo.ErrNoDocuments {
+		if version > 0 {
+			return nil, fmt.Errorf("version %d not found", version)
+		}
+
+		// Nothing earlier to restore, fall back to the shared layer
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": current.ID}, bson.M{
+			"$set": bson.M{"status": models.PromptStatusArchived},
+		}); err != nil {
+			return nil, err
+		}
+		clearResolvedPromptCache()
+
+		slog.Info("Prompt template unpublished",
+			"key", current.Key,
+			"layer", current.Layer,
+			"companyID", current.CompanyID,
+			"version", current.Version)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := PublishPromptTemplate(ctx, &target); err != nil {
+		return nil, err
+	}
+
+	return &target, nil
+}
+
+// InitPromptTemplates seeds the built-in shared layers and creates indexes
+func InitPromptTemplates(ctx context.Context) error {
+	collection := GetDatabase().Collection("prompt_templates")
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "key", Value: 1},
+				{Key: "status", Value: 1},
+				{Key: "layer", Value: 1},
+				{Key: "company_id", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{
+				{Key: "company_id", Value: 1},
+				{Key: "key", Value: 1},
+				{Key: "layer", Value: 1},
+				{Key: "version", Value: -1},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to create indexes for prompt_templates collection", "error", err)
+		return err
+	}
+
+	seeds := []models.PromptTemplate{
+		{Key: models.PromptKeyReplySystem, Layer: models.PromptLayerBase},
+		{Key: models.PromptKeyReplySystem, Layer: models.PromptLayerVertical, Vertical: models.VerticalStore},
+		{Key: models.PromptKeyReplySystem, Layer: models.PromptLayerVertical, Vertical: models.VerticalRealEstate},
+	}
+
+	for _, seed := range seeds {
+		count, err := collection.CountDocuments(ctx, promptIdentityFilter(&seed))
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		content, _ := defaultPromptTemplate(seed.Key, seed.Layer, seed.Vertical)
+		now := time.Now()
+		seed.Version = 1
+		seed.Status = models.PromptStatusPublished
+		seed.Content = content
+		seed.Description = "Built-in default"
+		seed.CreatedBy = "system"
+		seed.CreatedAt = now
+		seed.PublishedAt = &now
+
+		if _, err := collection.InsertOne(ctx, seed); err != nil {
+			return err
+		}
+
+		slog.Info("Seeded built-in prompt template",
+			"key", seed.Key,
+			"layer", seed.Layer,
+			"vertical", seed.Vertical)
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"facebook-bot/models"
+)
+
+const (
+	// queryEmbeddingTimeout is the time budget for embedding a customer's message. When the provider
+	// takes longer, search falls back to keyword mode instead of delaying the reply.
+	queryEmbeddingTimeout = 2 * time.Second
+
+	// Query embeddings are cached so repeated questions skip the provider call
+	queryEmbeddingCacheSize = 5000
+	queryEmbeddingCacheTTL  = 6 * time.Hour
+)
+
+// queryEmbeddingCache is a least recently used cache of query embeddings with expiry
+type queryEmbeddingCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // Front is the most recently used
+}
+
+type queryEmbeddingEntry struct {
+	key       string
+	embedding []float32
+	expiresAt time.Time
+}
+
+var queryEmbeddings = &queryEmbeddingCache{
+	entries: make(map[string]*list.Element),
+	order:   list.New(),
+}
+
+// get returns a cached embedding that has not expired
+func (c *queryEmbeddingCache) get(key string) ([]float32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*queryEmbeddingEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.embedding, true
+}
+
+// put caches an embedding, evicting the least recently used one when the cache is full
+func (c *queryEmbeddingCache) put(key string, embedding []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(queryEmbeddingCacheTTL)
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*queryEmbeddingEntry)
+		entry.embedding = embedding
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&queryEmbeddingEntry{key: key, embedding: embedding, expiresAt: expiresAt})
+	if c.order.Len() > queryEmbeddingCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*queryEmbeddingEntry).key)
+	}
+}
+
+// EmbedQuery embeds a search query with the embedding API of the page the documents belong to.
+// Embeddings are cached, and the call is given queryEmbeddingTimeout at most. Returns
+// ErrNoEmbeddingProvider when the page has no embedding API, and an error when the provider
+// is down so search can fall back to keyword mode.
+func EmbedQuery(ctx context.Context, query, companyID, pageID string) ([]float32, error) {
+	embedding, _, err := embedQuery(ctx, query, companyID, pageID)
+	return embedding, err
+}
+
+// embedQuery embeds a search query and returns the embedder used, so only documents embedded with
+// the same model are compared with it
+func embedQuery(ctx context.Context, query, companyID, pageID string) ([]float32, Embedder, error) {
+	pageConfig, err := embeddingPageConfig(ctx, companyID, pageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	embedder, err := PageEmbedder(pageConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	if embedder.Provider() == models.EmbeddingProviderMock {
+		// Mock vectors carry no meaning, keyword matching ranks better
+		return nil, nil, fmt.Errorf("%w: mock embeddings cannot rank documents", ErrNoEmbeddingProvider)
+	}
+
+	text := strings.Join(strings.Fields(query), " ")
+	key := embedder.Provider() + "|" + embedder.Model() + "|" + text
+	if embedding, ok := queryEmbeddings.get(key); ok {
+		return embedding, embedder, nil
+	}
+
+	breaker := getCircuitBreaker(embedder.Provider(), embedder.Model())
+	if !breaker.allow() {
+		return nil, nil, fmt.Errorf("%s embeddings circuit open", embedder.Provider())
+	}
+
+	embedCtx, cancel := context.WithTimeout(ctx, queryEmbeddingTimeout)
+	defer cancel()
+	embedCtx = WithUsageScope(embedCtx, UsageScope{CompanyID: companyID, PageID: pageConfig.PageID})
+
+	start := time.Now()
+	embeddings, err := embedder.Embed(embedCtx, []string{text}, EmbeddingInputQuery)
+	switch {
+	case err == nil:
+		breaker.recordSuccess()
+	case ctx.Err() != nil:
+		// The caller gave up, that says nothing about the provider
+		breaker.releaseProbe()
+		return nil, nil, err
+	case isOutageError(err):
+		breaker.recordFailure(err)
+	default:
+		breaker.releaseProbe()
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("query embedding failed: %w", err)
+	}
+
+	slog.Debug("Embedded search query",
+		"provider", embedder.Provider(),
+		"model", embedder.Model(),
+		"latencyMs", time.Since(start).Milliseconds())
+
+	queryEmbeddings.put(key, embeddings[0])
+	return embeddings[0], embedder, nil
+}
+
+// embeddingPageConfig returns the configuration of the page whose documents are searched.
+// Without a page ID the company's first page is used, as when documents are stored.
+func embeddingPageConfig(ctx context.Context, companyID, pageID string) (*models.FacebookPage, error) {
+	var company *models.Company
+	var err error
+	if pageID != "" {
+		// Cached by page, this runs for every customer message
+		company, err = GetCompanyByPageID(ctx, pageID)
+	}
+	if pageID == "" || err != nil || company.CompanyID != companyID {
+		company, err = GetCompanyByID(ctx, companyID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get company config: %w", err)
+		}
+	}
+
+	for i := range company.Pages {
+		if company.Pages[i].PageID == pageID {
+			return &company.Pages[i], nil
+		}
+	}
+	if len(company.Pages) > 0 {
+		return &company.Pages[0], nil
+	}
+	return nil, fmt.Errorf("no page configuration found")
+}
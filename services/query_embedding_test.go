@@ -0,0 +1,41 @@
+package services
+
+import (
+	"container/list"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueryEmbeddingCache(t *testing.T) {
+	cache := &queryEmbeddingCache{entries: make(map[string]*list.Element), order: list.New()}
+
+	for i := 0; i < queryEmbeddingCacheSize; i++ {
+		cache.put(fmt.Sprintf("q%d", i), []float32{float32(i)})
+	}
+	// Using the oldest entry keeps it when the cache overflows
+	if _, ok := cache.get("q0"); !ok {
+		t.Fatal("q0 not cached")
+	}
+	cache.put("new", []float32{1})
+
+	if _, ok := cache.get("q1"); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	for _, key := range []string{"q0", "q2", "new"} {
+		if _, ok := cache.get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+	if cache.order.Len() != queryEmbeddingCacheSize || len(cache.entries) != queryEmbeddingCacheSize {
+		t.Errorf("cache holds %d entries, want %d", cache.order.Len(), queryEmbeddingCacheSize)
+	}
+
+	cache.entries["new"].Value.(*queryEmbeddingEntry).expiresAt = time.Now().Add(-time.Second)
+	if _, ok := cache.get("new"); ok {
+		t.Error("expired entry returned")
+	}
+	if _, ok := cache.entries["new"]; ok {
+		t.Error("expired entry not removed")
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"facebook-bot/models"
+)
+
+// queryTranslationModel is the model used to translate knowledge base queries
+const queryTranslationModel = "claude-3-haiku-20240307"
+
+// translatedQuery is a cached translation of a customer query
+type translatedQuery struct {
+	text      string
+	fetchedAt time.Time
+}
+
+var (
+	translatedQueryCache   = make(map[string]*translatedQuery)
+	translatedQueryCacheMu sync.RWMutex
+)
+
+const (
+	translatedQueryCacheTTL  = 30 * time.Minute
+	translatedQueryCacheSize = 5000
+)
+
+// KnowledgeLanguage returns the language a page's knowledge base is written in,
+// falling back to the company default language
+func KnowledgeLanguage(company *models.Company, pageConfig *models.FacebookPage) string {
+	if pageConfig != nil && models.IsSupportedLanguage(pageConfig.KnowledgeLanguage) {
+		return pageConfig.KnowledgeLanguage
+	}
+	if company != nil && models.IsSupportedLanguage(company.DefaultLanguage) {
+		return company.DefaultLanguage
+	}
+	return ""
+}
+
+// TranslateQueryForKnowledge translates a customer query into the knowledge base language so
+// retrieval matches documents written in another language. The original query is returned
+// when the languages match, are unknown, or the translation fails.
+func TranslateQueryForKnowledge(ctx context.Context, query, queryLanguage string, company *models.Company, pageConfig *models.FacebookPage) string {
+	knowledgeLanguage := KnowledgeLanguage(company, pageConfig)
+	if knowledgeLanguage == "" || queryLanguage == "" || queryLanguage == knowledgeLanguage {
+		return query
+	}
+	if pageConfig.ClaudeAPIKey == "" || pageConfig.ClaudeAPIKey == "TEST_MODE" {
+		return query
+	}
+
+	translated, err := TranslateText(ctx, query, queryLanguage, knowledgeLanguage, pageConfig.ClaudeAPIKey)
+	if err != nil {
+		slog.Warn("Failed to translate knowledge base query, using original",
+			"error", err,
+			"pageID", pageConfig.PageID,
+			"from", queryLanguage,
+			"to", knowledgeLanguage)
+		return query
+	}
+
+	slog.Info("Translated knowledge base query",
+		"pageID", pageConfig.PageID,
+		"from", queryLanguage,
+		"to", knowledgeLanguage)
+	return translated
+}
+
+// TranslateText translates short text between supported languages. Results are cached in memory.
+func TranslateText(ctx context.Context, text, from, to, apiKey string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || from == to {
+		return text, nil
+	}
+	if !models.IsSupportedLanguage(to) {
+		return "", fmt.Errorf("unsupported language: %s", to)
+	}
+
+	cacheKey := from + "|" + to + "|" + text
+	translatedQueryCacheMu.RLock()
+	cached, ok := translatedQueryCache[cacheKey]
+	translatedQueryCacheMu.RUnlock()
+	if ok && time.Since(cached.fetchedAt) < translatedQueryCacheTTL {
+		return cached.text, nil
+	}
+
+	prompt := fmt.Sprintf("Translate the following customer message from %s to %s. "+
+		"Keep product names, numbers and codes unchanged. Respond with ONLY the translation.\n\n%s",
+		models.LanguageName(from), models.LanguageName(to), text)
+	if models.LanguageName(from) == "" {
+		prompt = fmt.Sprintf("Translate the following customer message to %s. "+
+			"Keep product names, numbers and codes unchanged. Respond with ONLY the translation.\n\n%s",
+			models.LanguageName(to), text)
+	}
+
+	requestBody := ClaudeRequest{
+		Model:     queryTranslationModel,
+		MaxTokens: 256,
+		Messages: []Message{
+			{
+				Role:    "user",
+				Content: prompt,
+			},
+		},
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", claudeAPIURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", err
+	}
+
+	resp, body, err := callClaudeAPIWithRetry(req, apiKey, 2)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Claude API error: %s - %s", resp.Status, string(body))
+	}
+
+	var claudeResp ClaudeResponse
+	if err := json.Unmarshal(body, &claudeResp); err != nil {
+		return "", err
+	}
+
+	recordClaudeUsage(ctx, models.UsagePurposeTranslation, &claudeResp)
+
+	var translated string
+	for _, content := range claudeResp.Content {
+		if content.Type == "text" {
+			translated += content.Text
+		}
+	}
+	translated = strings.TrimSpace(translated)
+	if translated == "" {
+		return "", fmt.Errorf("no response content from Claude for translation")
+	}
+
+	translatedQueryCacheMu.Lock()
+	if len(translatedQueryCache) >= translatedQueryCacheSize {
+		// Drop expired entries, or everything if the cache is still full
+		for key, entry := range translatedQueryCache {
+			if time.Since(entry.fetchedAt) >= translatedQueryCacheTTL {
+				delete(translatedQueryCache, key)
+			}
+		}
+		if len(translatedQueryCache) >= translatedQueryCacheSize {
+			translatedQueryCache = make(map[string]*translatedQuery)
+		}
+	}
+	translatedQueryCache[cacheKey] = &translatedQuery{text: translated, fetchedAt: time.Now()}
+	translatedQueryCacheMu.Unlock()
+
+	return translated, nil
+}
@@ -0,0 +1,715 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"facebook-bot/models"
+)
+
+// Re-embedding job settings
+const (
+	reindexHeartbeatInterval = 30 * time.Second
+	reindexStaleAfter        = 2 * time.Minute // A running job without a heartbeat for this long is resumed
+	reindexCheckInterval     = time.Minute
+	reindexBatchRetries      = 3
+	reindexRetryDelay        = 10 * time.Second
+	reindexDefaultBatchSize  = 64
+)
+
+// Errors returned by re-embedding jobs
+var (
+	ErrReindexPageNotFound = errors.New("page not found")
+	ErrReindexJobRunning   = errors.New("a re-embedding job is already running for the page")
+	ErrReindexJobFinished  = errors.New("re-embedding job already finished")
+
+	errReindexCancelled = errors.New("re-embedding job cancelled")
+)
+
+// reindexBatchSizes is how many documents are embedded per request, within each provider's batch limits
+var reindexBatchSizes = map[string]int{
+	models.UsageProviderOpenAI:   128, // Up to 2048 inputs and 300k tokens per request
+	models.UsageProviderVoyage:   64,  // Up to 128 inputs per request
+	models.UsageProviderCohere:   96,  // Up to 96 texts per request
+	models.EmbeddingProviderMock: 256,
+}
+
+// reindexRateLimiters keep jobs to a share of each provider's rate limit, so replies to customers
+// still get their query embeddings. Voyage requests already wait on voyageRateLimiter.
+var reindexRateLimiters = map[string]*RateLimiter{
+	models.UsageProviderOpenAI: NewRateLimiter(60),
+	models.UsageProviderCohere: NewRateLimiter(30),
+}
+
+// reindexStagingFields hold a document's new vector until the job swaps it in
+var reindexStagingFields = bson.A{"reindex_job_id", "reindex_embedding", "reindex_provider", "reindex_model"}
+
+// runningReindexJobs cancels the jobs this instance works on
+var runningReindexJobs = struct {
+	sync.Mutex
+	cancels map[primitive.ObjectID]context.CancelFunc
+}{cancels: make(map[primitive.ObjectID]context.CancelFunc)}
+
+// StartReindexJob checks that a page's documents can be embedded with the given provider and model
+// and stores a new job. Empty provider and model re-embed with the page's current ones. The
+// documents are embedded by RunReindexJob.
+func StartReindexJob(ctx context.Context, companyID, pageID, provider, model, startedBy string) (*models.ReindexJob, error) {
+	company, err := GetCompanyByID(ctx, companyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load company: %w", err)
+	}
+	pageConfig, err := GetPageConfig(company, pageID)
+	if err != nil {
+		return nil, ErrReindexPageNotFound
+	}
+
+	target := *pageConfig
+	if provider != "" {
+		target.EmbeddingProvider = provider
+		target.EmbeddingModel = model
+	} else if model != "" {
+		target.EmbeddingModel = model
+	}
+	embedder, err := PageEmbedder(&target)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &models.ReindexJob{
+		CompanyID:         companyID,
+		PageID:            pageID,
+		EmbeddingProvider: embedder.Provider(),
+		EmbeddingModel:    embedder.Model(),
+		Status:            models.ReindexStatusRunning,
+		StartedBy:         startedBy,
+		StartedAt:         time.Now(),
+		HeartbeatAt:       time.Now(),
+	}
+	if previous, err := PageEmbedder(pageConfig); err == nil {
+		job.PreviousProvider = previous.Provider()
+		job.PreviousModel = previous.Model()
+	}
+
+	job.Total, err = database.Collection("vector_documents").CountDocuments(ctx, bson.M{
+		"company_id": companyID,
+		"page_id":    pageID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count documents: %w", err)
+	}
+
+	running, err := GetDatabase().Collection("reindex_jobs").CountDocuments(ctx, bson.M{
+		"company_id": companyID,
+		"page_id":    pageID,
+		"status":     models.ReindexStatusRunning,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if running > 0 {
+		return nil, ErrReindexJobRunning
+	}
+
+	// A unique index on running jobs keeps two jobs from swapping vectors of the same page
+	result, err := GetDatabase().Collection("reindex_jobs").InsertOne(ctx, job)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrReindexJobRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+	job.ID = result.InsertedID.(primitive.ObjectID)
+
+	slog.Info("Re-embedding job started",
+		"jobID", job.ID.Hex(),
+		"companyID", companyID,
+		"pageID", pageID,
+		"provider", job.EmbeddingProvider,
+		"model", job.EmbeddingModel,
+		"previousModel", job.PreviousModel,
+		"documents", job.Total)
+	return job, nil
+}
+
+// RunReindexJob embeds the page's documents with the job's model in batches, staging the new vectors
+// next to the current ones, then swaps them in and switches the page to the model. Documents already
+// staged by an earlier run of the job are skipped, so a job resumed after a restart continues where
+// it stopped.
+func RunReindexJob(ctx context.Context, job *models.ReindexJob) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	runningReindexJobs.Lock()
+	runningReindexJobs.cancels[job.ID] = cancel
+	runningReindexJobs.Unlock()
+	defer func() {
+		runningReindexJobs.Lock()
+		delete(runningReindexJobs.cancels, job.ID)
+		runningReindexJobs.Unlock()
+	}()
+
+	// Other instances resume the job when the heartbeat stops
+	go func() {
+		ticker := time.NewTicker(reindexHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := GetDatabase().Collection("reindex_jobs").UpdateOne(ctx,
+					bson.M{"_id": job.ID},
+					bson.M{"$set": bson.M{"heartbeat_at": time.Now()}}); err != nil && ctx.Err() == nil {
+					slog.Warn("Failed to refresh re-embedding job heartbeat", "jobID", job.ID.Hex(), "error", err)
+				}
+			}
+		}
+	}()
+
+	ctx = WithUsageScope(ctx, UsageScope{CompanyID: job.CompanyID, PageID: job.PageID})
+
+	err := errReindexCancelled
+	if !job.CancelRequested {
+		err = reindexPage(ctx, job)
+	}
+	return finishReindexJob(job, err)
+}
+
+// reindexPage runs a job's passes. The first embeds every document and swaps the page to the new
+// model; the second catches documents stored with the previous model while the first ran.
+func reindexPage(ctx context.Context, job *models.ReindexJob) error {
+	embedder, err := reindexEmbedder(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	scope := bson.M{
+		"company_id":     job.CompanyID,
+		"page_id":        job.PageID,
+		"reindex_job_id": bson.M{"$ne": job.ID},
+	}
+	if job.SwappedAt == nil {
+		if _, err := embedPendingDocuments(ctx, job, embedder, scope); err != nil {
+			return err
+		}
+		if err := swapReindexedVectors(ctx, job); err != nil {
+			return err
+		}
+	}
+
+	scope["$or"] = bson.A{
+		bson.M{"embedding_provider": bson.M{"$ne": job.EmbeddingProvider}},
+		bson.M{"embedding_model": bson.M{"$ne": job.EmbeddingModel}},
+	}
+	embedded, err := embedPendingDocuments(ctx, job, embedder, scope)
+	if err != nil {
+		return err
+	}
+	if embedded > 0 {
+		return swapReindexedVectors(ctx, job)
+	}
+	return nil
+}
+
+// reindexEmbedder returns the embedder of a job, with the page's current API keys
+func reindexEmbedder(ctx context.Context, job *models.ReindexJob) (Embedder, error) {
+	company, err := GetCompanyByID(ctx, job.CompanyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load company: %w", err)
+	}
+	pageConfig, err := GetPageConfig(company, job.PageID)
+	if err != nil {
+		return nil, ErrReindexPageNotFound
+	}
+	target := *pageConfig
+	target.EmbeddingProvider = job.EmbeddingProvider
+	target.EmbeddingModel = job.EmbeddingModel
+	return PageEmbedder(&target)
+}
+
+// embedPendingDocuments stages new vectors for the documents matching filter, a batch at a time.
+// Returns the number of documents embedded.
+func embedPendingDocuments(ctx context.Context, job *models.ReindexJob, embedder Embedder, filter bson.M) (int, error) {
+	collection := database.Collection("vector_documents")
+	batchSize := reindexBatchSizes[embedder.Provider()]
+	if batchSize == 0 {
+		batchSize = reindexDefaultBatchSize
+	}
+
+	embedded := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return embedded, err
+		}
+
+		cursor, err := collection.Find(ctx, filter, options.Find().
+			SetSort(bson.D{{Key: "_id", Value: 1}}).
+			SetLimit(int64(batchSize)).
+			SetProjection(bson.M{"_id": 1, "content": 1}))
+		if err != nil {
+			return embedded, fmt.Errorf("failed to load documents: %w", err)
+		}
+		var documents []VectorDocument
+		err = cursor.All(ctx, &documents)
+		cursor.Close(ctx)
+		if err != nil {
+			return embedded, fmt.Errorf("failed to read documents: %w", err)
+		}
+		if len(documents) == 0 {
+			return embedded, nil
+		}
+
+		texts := make([]string, len(documents))
+		for i, doc := range documents {
+			texts[i] = doc.Content
+		}
+		embeddings, err := embedReindexBatch(ctx, embedder, texts)
+		if err != nil && !isOutageError(err) && ctx.Err() == nil && len(texts) > 1 {
+			// One document the provider rejects fails the whole request, embed them one by one
+			// so only that one keeps its old vector
+			embeddings, err = embedReindexDocuments(ctx, embedder, texts)
+		}
+		if err != nil {
+			return embedded, err
+		}
+
+		// Documents that could not be embedded are marked too, so they are not picked again
+		writes := make([]mongo.WriteModel, len(documents))
+		failed := 0
+		for i, doc := range documents {
+			staged := bson.M{"reindex_job_id": job.ID}
+			if len(embeddings[i]) > 0 {
+				staged["reindex_embedding"] = embeddings[i]
+				staged["reindex_provider"] = embedder.Provider()
+				staged["reindex_model"] = embedder.Model()
+			} else {
+				failed++
+			}
+			writes[i] = mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": doc.ID}).
+				SetUpdate(bson.M{"$set": staged})
+		}
+		if _, err := collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+			return embedded, fmt.Errorf("failed to stage vectors: %w", err)
+		}
+		embedded += len(documents) - failed
+
+		if err := recordReindexProgress(ctx, job, len(documents), failed); err != nil {
+			return embedded, err
+		}
+	}
+}
+
+// embedReindexBatch embeds a batch of documents, retrying while the provider is down or rate limited
+func embedReindexBatch(ctx context.Context, embedder Embedder, texts []string) ([][]float32, error) {
+	var err error
+	for attempt := 1; attempt <= reindexBatchRetries; attempt++ {
+		if limiter := reindexRateLimiters[embedder.Provider()]; limiter != nil {
+			if err := limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		var embeddings [][]float32
+		embeddings, err = embedder.Embed(ctx, texts, EmbeddingInputDocument)
+		if err == nil {
+			return embeddings, nil
+		}
+		if ctx.Err() != nil || !isOutageError(err) || attempt == reindexBatchRetries {
+			break
+		}
+
+		slog.Warn("Re-embedding batch failed, retrying",
+			"provider", embedder.Provider(),
+			"attempt", attempt,
+			"documents", len(texts),
+			"error", err)
+		select {
+		case <-time.After(reindexRetryDelay * time.Duration(attempt)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return nil, err
+}
+
+// embedReindexDocuments embeds documents one at a time. Documents the provider rejects get no vector.
+func embedReindexDocuments(ctx context.Context, embedder Embedder, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embedding, err := embedReindexBatch(ctx, embedder, []string{text})
+		if err != nil {
+			if ctx.Err() != nil || isOutageError(err) {
+				return nil, err
+			}
+			slog.Warn("Document could not be re-embedded, keeping its old vector",
+				"provider", embedder.Provider(),
+				"model", embedder.Model(),
+				"contentLength", len(text),
+				"error", err)
+			continue
+		}
+		embeddings[i] = embedding[0]
+	}
+	return embeddings, nil
+}
+
+// recordReindexProgress stores a finished batch on the job and reports it to the dashboard.
+// Returns errReindexCancelled when the job was cancelled, possibly from another instance.
+func recordReindexProgress(ctx context.Context, job *models.ReindexJob, documents, failed int) error {
+	var updated models.ReindexJob
+	err := GetDatabase().Collection("reindex_jobs").FindOneAndUpdate(ctx,
+		bson.M{"_id": job.ID},
+		bson.M{
+			"$inc": bson.M{"processed": documents, "failed": failed, "batches": 1},
+			"$set": bson.M{"heartbeat_at": time.Now()},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if err != nil {
+		return fmt.Errorf("failed to record progress: %w", err)
+	}
+	// Documents stored while the job runs are embedded too
+	if updated.Processed > updated.Total {
+		updated.Total = updated.Processed
+	}
+	*job = updated
+
+	broadcastReindexJob(job, "reindex_progress")
+	if job.CancelRequested {
+		return errReindexCancelled
+	}
+	return nil
+}
+
+// swapReindexedVectors replaces the documents' vectors with the staged ones and switches the page to
+// the job's model, in one transaction where the deployment supports them
+func swapReindexedVectors(ctx context.Context, job *models.ReindexJob) error {
+	now := time.Now()
+	var swapped int64
+	err := withTransaction(ctx, func(ctx context.Context) error {
+		result, err := database.Collection("vector_documents").UpdateMany(ctx,
+			bson.M{
+				"company_id":          job.CompanyID,
+				"page_id":             job.PageID,
+				"reindex_job_id":      job.ID,
+				"reindex_embedding.0": bson.M{"$exists": true},
+			},
+			mongo.Pipeline{
+				{{Key: "$set", Value: bson.M{
+					"embedding":           "$reindex_embedding",
+					"embedding_provider":  "$reindex_provider",
+					"embedding_model":     "$reindex_model",
+					"embedding_dimension": bson.M{"$size": "$reindex_embedding"},
+					"updated_at":          now,
+				}}},
+				{{Key: "$unset", Value: reindexStagingFields}},
+			})
+		if err != nil {
+			return fmt.Errorf("failed to swap vectors: %w", err)
+		}
+		swapped = result.ModifiedCount
+
+		if _, err := database.Collection("companies").UpdateOne(ctx,
+			bson.M{"company_id": job.CompanyID, "pages.page_id": job.PageID},
+			bson.M{"$set": bson.M{
+				"pages.$.embedding_provider": job.EmbeddingProvider,
+				"pages.$.embedding_model":    job.EmbeddingModel,
+				"updated_at":                 now,
+			}}); err != nil {
+			return fmt.Errorf("failed to switch page embedding model: %w", err)
+		}
+
+		if _, err := GetDatabase().Collection("reindex_jobs").UpdateOne(ctx,
+			bson.M{"_id": job.ID},
+			bson.M{
+				"$inc": bson.M{"swapped": swapped},
+				"$set": bson.M{"swapped_at": now},
+			}); err != nil {
+			return fmt.Errorf("failed to record swap: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	job.Swapped += swapped
+	job.SwappedAt = &now
+	clearCompanyCache(job.CompanyID)
+	mismatchedVectorCounts.clear()
+	syncVectorIndex(ctx, bson.M{"company_id": job.CompanyID, "page_id": job.PageID})
+
+	slog.Info("Re-embedded vectors swapped in",
+		"jobID", job.ID.Hex(),
+		"pageID", job.PageID,
+		"provider", job.EmbeddingProvider,
+		"model", job.EmbeddingModel,
+		"swapped", swapped)
+	return nil
+}
+
+// withTransaction runs fn in a transaction when the deployment supports them (replica sets and
+// sharded clusters), otherwise directly, so readers may see its writes half done
+func withTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := database.Client().StartSession()
+	if err != nil {
+		slog.Warn("Could not start MongoDB session, writing without a transaction", "error", err)
+		return fn(ctx)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionCtx)
+	})
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && commandErr.Code == 20 {
+		// IllegalOperation: a standalone server has no transactions
+		slog.Warn("MongoDB server does not support transactions, writing without one")
+		return fn(ctx)
+	}
+	return err
+}
+
+// finishReindexJob saves a job's final state and drops the vectors it staged but did not swap in
+func finishReindexJob(job *models.ReindexJob, err error) error {
+	// The job context may be cancelled already, the final state must still be saved
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+	switch {
+	case err == nil:
+		job.Status = models.ReindexStatusCompleted
+	case errors.Is(err, errReindexCancelled) || errors.Is(err, context.Canceled):
+		job.Status = models.ReindexStatusCancelled
+		err = nil
+	default:
+		job.Status = models.ReindexStatusFailed
+		job.Error = err.Error()
+	}
+
+	if _, cleanupErr := database.Collection("vector_documents").UpdateMany(ctx,
+		bson.M{"company_id": job.CompanyID, "page_id": job.PageID, "reindex_job_id": job.ID},
+		mongo.Pipeline{{{Key: "$unset", Value: reindexStagingFields}}}); cleanupErr != nil {
+		slog.Warn("Failed to drop staged vectors", "jobID", job.ID.Hex(), "error", cleanupErr)
+	}
+
+	if _, saveErr := GetDatabase().Collection("reindex_jobs").UpdateOne(ctx, bson.M{"_id": job.ID}, bson.M{
+		"$set": bson.M{
+			"status":      job.Status,
+			"error":       job.Error,
+			"finished_at": job.FinishedAt,
+		},
+	}); saveErr != nil {
+		slog.Error("Failed to save re-embedding job", "jobID", job.ID.Hex(), "error", saveErr)
+		if err == nil {
+			err = saveErr
+		}
+	}
+
+	broadcastReindexJob(job, "reindex_finished")
+	slog.Info("Re-embedding job finished",
+		"jobID", job.ID.Hex(),
+		"pageID", job.PageID,
+		"status", job.Status,
+		"processed", job.Processed,
+		"failed", job.Failed,
+		"swapped", job.Swapped)
+	return err
+}
+
+// broadcastReindexJob sends a job's progress to the company's dashboards
+func broadcastReindexJob(job *models.ReindexJob, eventType string) {
+	GetWebSocketManager().BroadcastToCompany(job.CompanyID, BroadcastMessage{
+		CompanyID: job.CompanyID,
+		PageID:    job.PageID,
+		Type:      eventType,
+		Data:      job,
+	})
+}
+
+// CancelReindexJob stops a running job. Vectors staged so far are dropped and the page keeps its model
+// unless the new vectors were already swapped in. Returns nil when the job does not exist.
+func CancelReindexJob(ctx context.Context, jobID, companyID string) (*models.ReindexJob, error) {
+	objectID, err := primitive.ObjectIDFromHex(jobID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid re-embedding job ID")
+	}
+
+	var job models.ReindexJob
+	err = GetDatabase().Collection("reindex_jobs").FindOneAndUpdate(ctx,
+		bson.M{"_id": objectID, "company_id": companyID, "status": models.ReindexStatusRunning},
+		bson.M{"$set": bson.M{"cancel_requested": true}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		existing, err := GetReindexJob(ctx, jobID, companyID)
+		if err != nil || existing == nil {
+			return nil, err
+		}
+		return existing, ErrReindexJobFinished
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Jobs on other instances see the flag after their current batch
+	runningReindexJobs.Lock()
+	if cancel, ok := runningReindexJobs.cancels[objectID]; ok {
+		cancel()
+	}
+	runningReindexJobs.Unlock()
+
+	slog.Info("Re-embedding job cancellation requested", "jobID", jobID, "pageID", job.PageID)
+	return &job, nil
+}
+
+// GetReindexJob retrieves a re-embedding job by ID for a company. Returns nil when it does not exist.
+func GetReindexJob(ctx context.Context, jobID, companyID string) (*models.ReindexJob, error) {
+	objectID, err := primitive.ObjectIDFromHex(jobID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid re-embedding job ID")
+	}
+
+	var job models.ReindexJob
+	err = GetDatabase().Collection("reindex_jobs").FindOne(ctx, bson.M{
+		"_id":        objectID,
+		"company_id": companyID,
+	}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetReindexJobs lists a company's re-embedding jobs, newest first. pageID is an optional filter.
+func GetReindexJobs(ctx context.Context, companyID, pageID string, limit int) ([]models.ReindexJob, error) {
+	filter := bson.M{"company_id": companyID}
+	if pageID != "" {
+		filter["page_id"] = pageID
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "started_at", Value: -1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := GetDatabase().Collection("reindex_jobs").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	jobs := []models.ReindexJob{}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// StartReindexWorker resumes running jobs whose instance stopped, e.g. on a restart or deploy
+func StartReindexWorker(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(reindexCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			resumeCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			if count, err := ResumeStaleReindexJobs(resumeCtx); err != nil {
+				slog.Error("Failed to resume re-embedding jobs", "error", err)
+			} else if count > 0 {
+				slog.Info("Resumed re-embedding jobs", "count", count)
+			}
+			cancel()
+
+			select {
+			case <-ctx.Done():
+				slog.Info("Re-embedding worker stopped")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	slog.Info("Re-embedding worker started")
+}
+
+// ResumeStaleReindexJobs claims the running jobs without a recent heartbeat and runs them in the
+// background. Returns the number of jobs resumed.
+func ResumeStaleReindexJobs(ctx context.Context) (int, error) {
+	count := 0
+	for {
+		var job models.ReindexJob
+		err := GetDatabase().Collection("reindex_jobs").FindOneAndUpdate(ctx,
+			bson.M{
+				"status":       models.ReindexStatusRunning,
+				"heartbeat_at": bson.M{"$lt": time.Now().Add(-reindexStaleAfter)},
+			},
+			bson.M{"$set": bson.M{"heartbeat_at": time.Now()}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&job)
+		if err == mongo.ErrNoDocuments {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+
+		slog.Info("Resuming re-embedding job",
+			"jobID", job.ID.Hex(),
+			"pageID", job.PageID,
+			"processed", job.Processed,
+			"total", job.Total)
+		go func(job models.ReindexJob) {
+			if err := RunReindexJob(context.Background(), &job); err != nil {
+				slog.Error("Re-embedding job failed", "jobID", job.ID.Hex(), "error", err)
+			}
+		}(job)
+		count++
+	}
+}
+
+// CreateIndexesForReindexJobs creates indexes for the reindex_jobs collection
+func CreateIndexesForReindexJobs(ctx context.Context) error {
+	_, err := GetDatabase().Collection("reindex_jobs").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "company_id", Value: 1},
+				{Key: "started_at", Value: -1},
+			},
+		},
+		{
+			// One running job per page
+			Keys: bson.D{
+				{Key: "company_id", Value: 1},
+				{Key: "page_id", Value: 1},
+			},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": models.ReindexStatusRunning}),
+		},
+		{
+			Keys: bson.D{
+				{Key: "status", Value: 1},
+				{Key: "heartbeat_at", Value: 1},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to create indexes for reindex_jobs collection", "error", err)
+		return err
+	}
+
+	slog.Info("Successfully created indexes for reindex_jobs collection")
+	return nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"facebook-bot/models"
+)
+
+// scriptedEmbedder embeds texts with fixed vectors, rejecting texts containing "reject" and
+// failing whole requests with the queued errors first
+type scriptedEmbedder struct {
+	errs  []error
+	calls [][]string
+}
+
+func (e *scriptedEmbedder) Provider() string {
+	return models.EmbeddingProviderMock
+}
+
+func (e *scriptedEmbedder) Model() string {
+	return MockEmbeddingModel
+}
+
+func (e *scriptedEmbedder) Embed(ctx context.Context, texts []string, inputType string) ([][]float32, error) {
+	e.calls = append(e.calls, texts)
+	if len(e.errs) > 0 {
+		err := e.errs[0]
+		e.errs = e.errs[1:]
+		return nil, err
+	}
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		if strings.Contains(text, "reject") {
+			return nil, &ProviderError{Provider: models.UsageProviderOpenAI, StatusCode: http.StatusBadRequest, Body: "input too long"}
+		}
+		embeddings[i] = []float32{float32(len(text)), 1}
+	}
+	return embeddings, nil
+}
+
+func TestEmbedReindexBatchStopsOnRejection(t *testing.T) {
+	embedder := &scriptedEmbedder{}
+	_, err := embedReindexBatch(context.Background(), embedder, []string{"ok", "reject me"})
+
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) || providerErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("error = %v, want the provider's rejection", err)
+	}
+	if len(embedder.calls) != 1 {
+		t.Errorf("rejected batch sent %d times, want once", len(embedder.calls))
+	}
+}
+
+func TestEmbedReindexBatchWaitsOutOutage(t *testing.T) {
+	embedder := &scriptedEmbedder{errs: []error{&ProviderError{Provider: models.UsageProviderOpenAI, StatusCode: http.StatusServiceUnavailable}}}
+
+	// The job is cancelled while waiting to retry
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := embedReindexBatch(ctx, embedder, []string{"opening hours"})
+	if !errors.Is(err, context.DeadlineExceeded) || len(embedder.calls) != 1 {
+		t.Errorf("error = %v after %d calls, want the context's error after one call", err, len(embedder.calls))
+	}
+}
+
+func TestEmbedReindexDocumentsSkipsRejected(t *testing.T) {
+	embedder := &scriptedEmbedder{}
+	embeddings, err := embedReindexDocuments(context.Background(), embedder, []string{"opening hours", "reject me", "delivery"})
+	if err != nil {
+		t.Fatalf("embedReindexDocuments: %v", err)
+	}
+	if len(embeddings) != 3 || len(embeddings[0]) == 0 || embeddings[1] != nil || len(embeddings[2]) == 0 {
+		t.Errorf("embeddings = %v, want vectors for all but the rejected document", embeddings)
+	}
+	if len(embedder.calls) != 3 {
+		t.Errorf("provider called %d times, want once per document", len(embedder.calls))
+	}
+}
+
+func TestEmbedReindexDocumentsStopsOnOutage(t *testing.T) {
+	embedder := &scriptedEmbedder{errs: []error{&ProviderError{Provider: models.UsageProviderOpenAI, StatusCode: http.StatusTooManyRequests}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := embedReindexDocuments(ctx, embedder, []string{"opening hours", "delivery"}); err == nil {
+		t.Fatal("outage did not stop the job")
+	}
+	if len(embedder.calls) != 1 {
+		t.Errorf("provider called %d times after an outage, want once", len(embedder.calls))
+	}
+}
@@ -0,0 +1,494 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"facebook-bot/models"
+)
+
+const (
+	// MaxReplySuggestions is the most drafts generated for one request
+	MaxReplySuggestions = 3
+	// suggestionHistoryMessages is the number of recent messages the drafts are based on
+	suggestionHistoryMessages = 12
+	// suggestionSnippetCount is the number of knowledge base results given to the model
+	suggestionSnippetCount = 4
+	// suggestionSnippetLength is the longest excerpt of a knowledge base result, in characters
+	suggestionSnippetLength = 1200
+	// suggestionEditedSimilarity is the overlap with a draft above which a sent message counts as an edited draft
+	suggestionEditedSimilarity = 0.5
+)
+
+// ErrNoCustomerMessage is returned when a conversation has no customer message to draft a reply to
+var ErrNoCustomerMessage = errors.New("no customer message to reply to")
+
+// SuggestReplies drafts replies to a customer's latest message for a human agent. The drafts go
+// through the same retrieval and fallback chain as bot replies but are only stored, never sent.
+func SuggestReplies(ctx context.Context, company *models.Company, pageConfig *models.FacebookPage, customerID string, count int, agentID, agentEmail string) (*models.ReplySuggestion, error) {
+	if count < 1 || count > MaxReplySuggestions {
+		count = MaxReplySuggestions
+	}
+	if pageConfig.ClaudeAPIKey == "" {
+		return nil, fmt.Errorf("Claude API key not configured for page %s", pageConfig.PageID)
+	}
+
+	conversation, err := getRecentConversation(ctx, customerID, pageConfig.PageID, suggestionHistoryMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *models.Message
+	for i := len(conversation) - 1; i >= 0; i-- {
+		if conversation[i].SenderID == customerID {
+			latest = &conversation[i]
+			break
+		}
+	}
+	if latest == nil {
+		return nil, ErrNoCustomerMessage
+	}
+
+	language := latest.Language
+	if language == "" {
+		language = customerLanguage(ctx, latest.Message, company)
+	}
+
+	channelConfig := ResolveChannelConfig(company, pageConfig, "messenger")
+	pageConfig = ApplyChannelConfig(pageConfig, channelConfig)
+
+	snippets := []models.KnowledgeSnippet{}
+	if channelConfig.RAGEnabled {
+		query := TranslateQueryForKnowledge(ctx, latest.Message, language, company, pageConfig)
+		results, err := SearchWithStoredEmbeddingsForChannel(ctx, query, company.CompanyID, pageConfig.PageID, "messenger", suggestionSnippetCount)
+		if err != nil {
+			slog.Warn("Failed to search knowledge base for reply suggestions, drafting without it",
+				"error", err,
+				"pageID", pageConfig.PageID)
+		}
+		for _, result := range results {
+			snippets = append(snippets, models.KnowledgeSnippet{
+				Source:   result.Source,
+				Content:  extractRelevantPortion(result.Content, query, suggestionSnippetLength),
+				Score:    result.Score,
+				Metadata: result.Metadata,
+			})
+		}
+	}
+
+	suggestion := &models.ReplySuggestion{
+		CompanyID:       company.CompanyID,
+		PageID:          pageConfig.PageID,
+		CustomerID:      customerID,
+		AgentID:         agentID,
+		AgentEmail:      agentEmail,
+		CustomerMessage: latest.Message,
+		Snippets:        snippets,
+		Status:          models.SuggestionStatusPending,
+		DraftIndex:      -1,
+		CreatedAt:       time.Now(),
+	}
+
+	if pageConfig.ClaudeAPIKey == "TEST_MODE" {
+		for i := 0; i < count; i++ {
+			suggestion.Drafts = append(suggestion.Drafts, models.SuggestedDraft{
+				Text:     fmt.Sprintf("TEST DRAFT %d: reply to '%s'", i+1, latest.Message),
+				Snippets: []int{},
+			})
+		}
+	} else {
+		request := ClaudeRequest{
+			Model:     pageConfig.ClaudeModel,
+			MaxTokens: 1500,
+			System:    systemText(buildSuggestionPrompt(company, pageConfig, count, language)),
+			Messages: []Message{
+				{
+					Role:    "user",
+					Content: formatSuggestionInput(ctx, conversation, customerID, latest.Message, snippets),
+				},
+			},
+		}
+
+		resp, tier, err := sendWithFallback(ctx, pageConfig, request)
+		if err != nil {
+			return nil, err
+		}
+		recordTierUsage(withPageUsageScope(ctx, company, pageConfig), tier, models.UsagePurposeSuggestion, resp)
+
+		var text strings.Builder
+		for _, content := range resp.Content {
+			if content.Type == "text" {
+				text.WriteString(content.Text)
+			}
+		}
+
+		suggestion.Tier = tier.Name
+		suggestion.Model = tier.Model
+		suggestion.Drafts = parseSuggestedDrafts(text.String(), count, len(snippets))
+		if len(suggestion.Drafts) == 0 {
+			return nil, fmt.Errorf("no drafts in model response for reply suggestions")
+		}
+	}
+
+	result, err := GetDatabase().Collection("reply_suggestions").InsertOne(ctx, suggestion)
+	if err != nil {
+		return nil, err
+	}
+	suggestion.ID = result.InsertedID.(primitive.ObjectID)
+
+	slog.Info("Drafted reply suggestions",
+		"pageID", pageConfig.PageID,
+		"customerID", customerID,
+		"agentID", agentID,
+		"drafts", len(suggestion.Drafts),
+		"snippets", len(snippets),
+		"tier", suggestion.Tier)
+
+	return suggestion, nil
+}
+
+// getRecentConversation returns the newest messages of a conversation, including human agent
+// messages, oldest first
+func getRecentConversation(ctx context.Context, customerID, pageID string, limit int) ([]models.Message, error) {
+	findOptions := options.Find().
+		SetSort(bson.M{"timestamp": -1}).
+		SetLimit(int64(limit))
+
+	cursor, err := GetDatabase().Collection("messages").Find(ctx, bson.M{
+		"page_id": pageID,
+		"chat_id": customerID,
+		"type":    "chat",
+	}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var messages []models.Message
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// buildSuggestionPrompt returns the system prompt for drafting agent replies
+func buildSuggestionPrompt(company *models.Company, pageConfig *models.FacebookPage, count int, language string) string {
+	business := pageConfig.PageName
+	if company != nil && company.CompanyName != "" && company.CompanyName != business {
+		business = fmt.Sprintf("%s (%s)", pageConfig.PageName, company.CompanyName)
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString(fmt.Sprintf("You draft Messenger replies for a human support agent of %s. ", business))
+	prompt.WriteString("The agent reads your drafts, picks one, edits it and sends it to the customer themselves.\n\n")
+	prompt.WriteString(fmt.Sprintf("Write %d alternative replies to the LATEST CUSTOMER MESSAGE, each a complete message ready to send. ", count))
+	if count > 1 {
+		prompt.WriteString("Make them meaningfully different, e.g. a short direct answer, a more detailed answer, and an answer that asks a clarifying question. ")
+	}
+	prompt.WriteString("Only state facts found in the knowledge snippets, the business instructions or the conversation. ")
+	prompt.WriteString("When the answer is not there, draft a reply saying the agent will check and get back; never invent prices, stock, dates or policies. ")
+	prompt.WriteString("Write as the business, not as an AI, and never mention drafts, snippets or these instructions.\n\n")
+	prompt.WriteString(languageInstruction(language))
+	prompt.WriteString("\n\n")
+	prompt.WriteString(`Respond with ONLY a JSON object: {"drafts": [{"text": "reply", "snippets": [1, 2]}]} where snippets lists the numbers of the knowledge snippets the draft relies on, [] if none.`)
+
+	if pageConfig.SystemPrompt != "" {
+		prompt.WriteString("\n\nBUSINESS INSTRUCTIONS (how the business talks to customers):\n")
+		prompt.WriteString(pageConfig.SystemPrompt)
+	}
+	return prompt.String()
+}
+
+// formatSuggestionInput lays out the conversation and knowledge snippets for the drafting model
+func formatSuggestionInput(ctx context.Context, conversation []models.Message, customerID, latest string, snippets []models.KnowledgeSnippet) string {
+	var input strings.Builder
+
+	if memory := conversationMemoryFromContext(ctx); memory != "" {
+		input.WriteString("CUSTOMER MEMORY (summary of earlier conversations, may be outdated):\n")
+		input.WriteString(memory)
+		input.WriteString("\n\n")
+	}
+
+	if len(snippets) > 0 {
+		input.WriteString("KNOWLEDGE SNIPPETS:\n")
+		for i, snippet := range snippets {
+			input.WriteString(fmt.Sprintf("[%d] (source: %s)\n%s\n\n", i+1, snippet.Source, snippet.Content))
+		}
+	} else {
+		input.WriteString("KNOWLEDGE SNIPPETS: none found\n\n")
+	}
+
+	input.WriteString("CONVERSATION:\n")
+	for _, msg := range conversation {
+		speaker := "Customer"
+		switch {
+		case msg.IsHuman:
+			speaker = "Agent"
+		case msg.IsBot || msg.SenderID != customerID:
+			speaker = "Bot"
+		}
+		input.WriteString(fmt.Sprintf("%s: %s\n", speaker, msg.Message))
+	}
+
+	input.WriteString("\nLATEST CUSTOMER MESSAGE:\n")
+	input.WriteString(latest)
+	return input.String()
+}
+
+// parseSuggestedDrafts reads the drafts from the model's JSON answer. Snippet numbers are
+// converted to indexes and checked against the snippets sent. A reply that is not JSON is
+// used as a single draft.
+func parseSuggestedDrafts(text string, count, snippetCount int) []models.SuggestedDraft {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+
+	var parsed struct {
+		Drafts []struct {
+			Text     string `json:"text"`
+			Snippets []int  `json:"snippets"`
+		} `json:"drafts"`
+	}
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end <= start || json.Unmarshal([]byte(text[start:end+1]), &parsed) != nil {
+		return []models.SuggestedDraft{{Text: text, Snippets: []int{}}}
+	}
+
+	drafts := make([]models.SuggestedDraft, 0, count)
+	for _, draft := range parsed.Drafts {
+		draftText := strings.TrimSpace(draft.Text)
+		if draftText == "" {
+			continue
+		}
+
+		used := []int{}
+		seen := make(map[int]bool)
+		for _, number := range draft.Snippets {
+			index := number - 1
+			if index < 0 || index >= snippetCount || seen[index] {
+				continue
+			}
+			seen[index] = true
+			used = append(used, index)
+		}
+
+		drafts = append(drafts, models.SuggestedDraft{Text: draftText, Snippets: used})
+		if len(drafts) == count {
+			break
+		}
+	}
+	return drafts
+}
+
+// ResolveReplySuggestions records what an agent sent to a customer. The suggestion the message
+// was started from is marked accepted, edited or rejected by comparing the sent text with its
+// drafts. Other pending suggestions for the customer are rejected, since the agent answered
+// without them. Returns the resolved suggestion, or nil when suggestionID is empty or unknown.
+func ResolveReplySuggestions(ctx context.Context, companyID, pageID, customerID, suggestionID, sentMessage string) (*models.ReplySuggestion, error) {
+	collection := GetDatabase().Collection("reply_suggestions")
+	now := time.Now()
+
+	var resolved *models.ReplySuggestion
+	objectID, idErr := primitive.ObjectIDFromHex(suggestionID)
+	if suggestionID != "" && idErr == nil {
+		var suggestion models.ReplySuggestion
+		err := collection.FindOne(ctx, bson.M{
+			"_id":         objectID,
+			"company_id":  companyID,
+			"page_id":     pageID,
+			"customer_id": customerID,
+			"status":      models.SuggestionStatusPending,
+		}).Decode(&suggestion)
+		switch {
+		case err == nil:
+			suggestion.DraftIndex, suggestion.Similarity, suggestion.Status = matchSuggestedDraft(suggestion.Drafts, sentMessage)
+			suggestion.SentMessage = sentMessage
+			suggestion.ResolvedAt = &now
+
+			_, err = collection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{
+				"$set": bson.M{
+					"status":       suggestion.Status,
+					"draft_index":  suggestion.DraftIndex,
+					"similarity":   suggestion.Similarity,
+					"sent_message": sentMessage,
+					"resolved_at":  now,
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+			resolved = &suggestion
+		case !errors.Is(err, mongo.ErrNoDocuments):
+			return nil, err
+		}
+	}
+
+	filter := bson.M{
+		"company_id":  companyID,
+		"page_id":     pageID,
+		"customer_id": customerID,
+		"status":      models.SuggestionStatusPending,
+	}
+	if resolved != nil {
+		filter["_id"] = bson.M{"$ne": resolved.ID}
+	}
+	_, err := collection.UpdateMany(ctx, filter, bson.M{
+		"$set": bson.M{
+			"status":       models.SuggestionStatusRejected,
+			"sent_message": sentMessage,
+			"resolved_at":  now,
+		},
+	})
+	if err != nil {
+		return resolved, err
+	}
+
+	return resolved, nil
+}
+
+// matchSuggestedDraft finds the draft closest to a sent message and classifies the outcome
+func matchSuggestedDraft(drafts []models.SuggestedDraft, sentMessage string) (int, float64, string) {
+	sentWords := suggestionWords(sentMessage)
+
+	best, bestSimilarity := -1, 0.0
+	for i, draft := range drafts {
+		draftWords := suggestionWords(draft.Text)
+		if strings.Join(draftWords, " ") == strings.Join(sentWords, " ") {
+			return i, 1, models.SuggestionStatusAccepted
+		}
+		if similarity := wordOverlap(draftWords, sentWords); similarity > bestSimilarity {
+			best, bestSimilarity = i, similarity
+		}
+	}
+
+	bestSimilarity = math.Round(bestSimilarity*100) / 100
+	if bestSimilarity >= suggestionEditedSimilarity {
+		return best, bestSimilarity, models.SuggestionStatusEdited
+	}
+	return -1, bestSimilarity, models.SuggestionStatusRejected
+}
+
+// suggestionWords splits text into lowercase words, ignoring punctuation and spacing
+func suggestionWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// wordOverlap returns the Dice coefficient of two word multisets, from 0 (nothing shared) to 1
+func wordOverlap(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	counts := make(map[string]int, len(a))
+	for _, word := range a {
+		counts[word]++
+	}
+	shared := 0
+	for _, word := range b {
+		if counts[word] > 0 {
+			counts[word]--
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(a)+len(b))
+}
+
+// GetReplySuggestionStats counts how a company's agents used reply suggestions, optionally for one page
+func GetReplySuggestionStats(ctx context.Context, companyID, pageID string, from, to time.Time) (*models.ReplySuggestionStats, error) {
+	match := bson.M{
+		"company_id": companyID,
+		"created_at": bson.M{"$gte": from, "$lt": to},
+	}
+	if pageID != "" {
+		match["page_id"] = pageID
+	}
+
+	cursor, err := GetDatabase().Collection("reply_suggestions").Aggregate(ctx, []bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":            "$status",
+			"count":          bson.M{"$sum": 1},
+			"avg_similarity": bson.M{"$avg": "$similarity"},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		Status        string  `bson:"_id"`
+		Count         int64   `bson:"count"`
+		AvgSimilarity float64 `bson:"avg_similarity"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	stats := &models.ReplySuggestionStats{}
+	for _, group := range groups {
+		stats.Total += group.Count
+		switch group.Status {
+		case models.SuggestionStatusPending:
+			stats.Pending = group.Count
+		case models.SuggestionStatusAccepted:
+			stats.Accepted = group.Count
+		case models.SuggestionStatusEdited:
+			stats.Edited = group.Count
+			stats.AvgSimilarity = math.Round(group.AvgSimilarity*100) / 100
+		case models.SuggestionStatusRejected:
+			stats.Rejected = group.Count
+		}
+	}
+
+	if resolved := stats.Accepted + stats.Edited + stats.Rejected; resolved > 0 {
+		stats.AcceptanceRate = math.Round(float64(stats.Accepted+stats.Edited)/float64(resolved)*1000) / 1000
+	}
+	return stats, nil
+}
+
+// CreateIndexesForReplySuggestions creates indexes for the reply_suggestions collection
+func CreateIndexesForReplySuggestions(ctx context.Context) error {
+	_, err := GetDatabase().Collection("reply_suggestions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "company_id", Value: 1},
+				{Key: "page_id", Value: 1},
+				{Key: "customer_id", Value: 1},
+				{Key: "status", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{
+				{Key: "company_id", Value: 1},
+				{Key: "created_at", Value: -1},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to create indexes for reply_suggestions collection", "error", err)
+		return err
+	}
+
+	slog.Info("Successfully created indexes for reply_suggestions collection")
+	return nil
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"facebook-bot/models"
+)
+
+func TestParseSuggestedDrafts(t *testing.T) {
+	text := "Here are the drafts:\n" + `{"drafts": [
+		{"text": "We deliver in two days.", "snippets": [1, 3, 1, 9]},
+		{"text": "  ", "snippets": [2]},
+		{"text": "Delivery to Batumi is free.", "snippets": [0, 2]},
+		{"text": "A third draft", "snippets": []}
+	]}`
+
+	got := parseSuggestedDrafts(text, 2, 3)
+	want := []models.SuggestedDraft{
+		{Text: "We deliver in two days.", Snippets: []int{0, 2}},
+		{Text: "Delivery to Batumi is free.", Snippets: []int{1}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSuggestedDrafts = %+v, want %+v", got, want)
+	}
+
+	plain := parseSuggestedDrafts("We deliver in two days.", 3, 3)
+	if len(plain) != 1 || plain[0].Text != "We deliver in two days." || len(plain[0].Snippets) != 0 {
+		t.Errorf("parseSuggestedDrafts(plain text) = %+v, want a single draft", plain)
+	}
+
+	if empty := parseSuggestedDrafts("  ", 3, 3); empty != nil {
+		t.Errorf("parseSuggestedDrafts(empty) = %+v, want nil", empty)
+	}
+}
+
+func TestMatchSuggestedDraft(t *testing.T) {
+	drafts := []models.SuggestedDraft{
+		{Text: "Hello! The blue jacket is available in size M."},
+		{Text: "We deliver to Batumi within two days, free of charge."},
+	}
+
+	tests := []struct {
+		name       string
+		sent       string
+		wantIndex  int
+		wantStatus string
+	}{
+		{"sent as is", "hello, the blue jacket is available in size m", 0, models.SuggestionStatusAccepted},
+		{"edited", "We deliver to Batumi within three days, free of charge!", 1, models.SuggestionStatusEdited},
+		{"own reply", "Let me check with the warehouse and come back to you.", -1, models.SuggestionStatusRejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, similarity, status := matchSuggestedDraft(drafts, tt.sent)
+			if index != tt.wantIndex || status != tt.wantStatus {
+				t.Errorf("matchSuggestedDraft(%q) = %d, %v, %s; want %d, %s", tt.sent, index, similarity, status, tt.wantIndex, tt.wantStatus)
+			}
+			if similarity < 0 || similarity > 1 {
+				t.Errorf("similarity %v out of range", similarity)
+			}
+		})
+	}
+}
+
+func TestWordOverlap(t *testing.T) {
+	if got := wordOverlap(nil, []string{"a"}); got != 0 {
+		t.Errorf("wordOverlap with an empty side = %v, want 0", got)
+	}
+	if got := wordOverlap([]string{"a", "b", "b"}, []string{"b", "b", "c", "d"}); got != 4.0/7 {
+		t.Errorf("wordOverlap = %v, want %v", got, 4.0/7)
+	}
+}
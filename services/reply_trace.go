@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+
+	"facebook-bot/models"
+)
+
+// ReplyTrace collects details about how a reply was generated so handlers can store them with the response
+type ReplyTrace struct {
+	PromptVersion string // Layers and versions of the prompt templates used
+	SystemPrompt  string // Rendered reply prompt, used to detect prompt leaks
+	Tier          string // Fallback chain tier that served the reply
+	Model         string // Model that generated the reply
+
+	Sentiment     *models.MessageSentiment // Customer sentiment classified by the model, nil if it did not classify it
+	Answerability string                   // Whether the model could answer from the knowledge base, "" if it did not say
+}
+
+type replyTraceKey struct{}
+
+// WithReplyTrace attaches a new reply trace to the context
+func WithReplyTrace(ctx context.Context) (context.Context, *ReplyTrace) {
+	trace := &ReplyTrace{}
+	return context.WithValue(ctx, replyTraceKey{}, trace), trace
+}
+
+// replyTraceFromContext returns the reply trace attached to the context.
+// A throwaway trace is returned when none is attached so callers can always write to it.
+func replyTraceFromContext(ctx context.Context) *ReplyTrace {
+	if trace, ok := ctx.Value(replyTraceKey{}).(*ReplyTrace); ok {
+		return trace
+	}
+	return &ReplyTrace{}
+}
@@ -0,0 +1,474 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"facebook-bot/models"
+)
+
+// Default rerank models
+const (
+	DefaultVoyageRerankModel = "rerank-2"
+	DefaultCohereRerankModel = "rerank-v3.5" // Multilingual, covers Georgian
+	LocalRerankModel         = "term-proximity"
+)
+
+// rerankTimeout is the time budget of a rerank call. When the provider takes longer the retrieval order
+// is kept instead of delaying the reply.
+const rerankTimeout = 3 * time.Second
+
+// errNoQueryTerms is returned by the local reranker for queries with nothing but stop words
+var errNoQueryTerms = errors.New("query has no searchable terms")
+
+// Reranker scores how relevant documents are to a query, reading both together
+type Reranker interface {
+	// Provider returns models.RerankerProviderVoyage, RerankerProviderCohere or RerankerProviderLocal
+	Provider() string
+
+	// Model returns the rerank model
+	Model() string
+
+	// Rerank returns one relevance score per document, in the order given. units is what the provider
+	// bills for the call: tokens for Voyage, search units for Cohere, 0 for the local scorer.
+	Rerank(ctx context.Context, query string, documents []string) (scores []float64, units int, err error)
+}
+
+// PageReranker returns the reranker configured for a page, nil when the page does not rerank
+func PageReranker(pageConfig *models.FacebookPage) (Reranker, error) {
+	config := pageConfig.Reranker
+	if config == nil || !config.Enabled {
+		return nil, nil
+	}
+
+	switch config.Provider {
+	case models.RerankerProviderVoyage:
+		if pageConfig.VoyageAPIKey == "" {
+			return nil, fmt.Errorf("voyage reranker selected without an API key")
+		}
+		return voyageReranker{model: firstNonEmpty(config.Model, DefaultVoyageRerankModel), apiKey: pageConfig.VoyageAPIKey}, nil
+	case models.RerankerProviderCohere:
+		if pageConfig.CohereAPIKey == "" {
+			return nil, fmt.Errorf("cohere reranker selected without an API key")
+		}
+		return cohereReranker{model: firstNonEmpty(config.Model, DefaultCohereRerankModel), apiKey: pageConfig.CohereAPIKey}, nil
+	case models.RerankerProviderLocal:
+		return localReranker{}, nil
+	}
+	return nil, fmt.Errorf("unknown reranker provider %q", config.Provider)
+}
+
+// ValidateReranker checks the rerank settings sent for a page. nil leaves reranking unchanged.
+func ValidateReranker(config *models.RerankerConfig) bool {
+	if config == nil || !config.Enabled {
+		return true
+	}
+	if !models.IsValidRerankerProvider(config.Provider) {
+		return false
+	}
+	if config.Candidates < 0 || config.Candidates > models.MaxRerankCandidates || config.TopN < 0 {
+		return false
+	}
+	if config.Candidates > 0 && config.TopN > config.Candidates {
+		return false
+	}
+	return config.MinScore >= 0 && config.MinScore <= 1
+}
+
+// rerankSettings returns the candidate count and the number of results kept, with defaults applied
+func rerankSettings(config *models.RerankerConfig) (candidates, topN int) {
+	candidates, topN = config.Candidates, config.TopN
+	if topN <= 0 {
+		topN = models.DefaultRerankTopN
+	}
+	if candidates <= 0 {
+		candidates = max(models.DefaultRerankCandidates, topN)
+	}
+	return candidates, topN
+}
+
+// pageRerankConfig returns the reranker and settings of the page whose documents are searched, nil when
+// it does not rerank or its reranker cannot be used
+func pageRerankConfig(ctx context.Context, companyID, pageID string) (Reranker, *models.RerankerConfig) {
+	pageConfig, err := embeddingPageConfig(ctx, companyID, pageID)
+	if err != nil {
+		return nil, nil
+	}
+	reranker, err := PageReranker(pageConfig)
+	if err != nil {
+		slog.Warn("Reranker not usable, keeping the retrieval order",
+			"companyID", companyID,
+			"pageID", pageID,
+			"error", err)
+		return nil, nil
+	}
+	if reranker == nil {
+		return nil, nil
+	}
+	return reranker, pageConfig.Reranker
+}
+
+// rerankResults re-scores retrieved results against the query and keeps the best topN scoring at least
+// minScore. When the reranker fails the best topN of the retrieval order are kept, so a provider outage
+// only costs context quality. The stats record the call's latency and cost.
+func rerankResults(ctx context.Context, reranker Reranker, query string, results []SearchResult, topN int, minScore float64) ([]SearchResult, *models.RerankStats) {
+	stats := &models.RerankStats{
+		Provider:   reranker.Provider(),
+		Model:      reranker.Model(),
+		Candidates: len(results),
+	}
+	keepRetrievalOrder := func(err error) ([]SearchResult, *models.RerankStats) {
+		stats.Error = err.Error()
+		if len(results) > topN {
+			results = results[:topN]
+		}
+		stats.Kept = len(results)
+		slog.Warn("Reranking failed, keeping the retrieval order",
+			"provider", stats.Provider,
+			"model", stats.Model,
+			"error", err)
+		return results, stats
+	}
+
+	breaker := getCircuitBreaker(reranker.Provider(), reranker.Model())
+	if reranker.Provider() != models.RerankerProviderLocal && !breaker.allow() {
+		return keepRetrievalOrder(fmt.Errorf("%s rerank circuit open", reranker.Provider()))
+	}
+
+	documents := make([]string, len(results))
+	for i, result := range results {
+		documents[i] = result.Content
+	}
+
+	rerankCtx, cancel := context.WithTimeout(ctx, rerankTimeout)
+	defer cancel()
+
+	start := time.Now()
+	scores, units, err := reranker.Rerank(rerankCtx, query, documents)
+	stats.LatencyMs = time.Since(start).Milliseconds()
+	if reranker.Provider() != models.RerankerProviderLocal {
+		switch {
+		case err == nil:
+			breaker.recordSuccess()
+		case ctx.Err() != nil:
+			// The caller gave up, that says nothing about the provider
+			breaker.releaseProbe()
+		case isOutageError(err):
+			breaker.recordFailure(err)
+		default:
+			breaker.releaseProbe()
+		}
+	}
+	if err == nil && len(scores) != len(results) {
+		err = fmt.Errorf("%s returned %d scores for %d documents", reranker.Provider(), len(scores), len(results))
+	}
+	if err != nil {
+		return keepRetrievalOrder(err)
+	}
+
+	if units > 0 {
+		RecordUsage(ctx, reranker.Provider(), reranker.Model(), models.UsagePurposeRerank, units, 0)
+		stats.Cost, _ = CalculateCost(&models.UsageEvent{Model: reranker.Model(), InputTokens: units})
+	}
+
+	reranked := make([]SearchResult, len(results))
+	for i, result := range results {
+		breakdown := ScoreBreakdown{VectorScore: result.Score}
+		if result.Breakdown != nil {
+			breakdown = *result.Breakdown
+		}
+		breakdown.RetrievalRank = i + 1
+		breakdown.RerankScore = scores[i]
+		result.Breakdown = &breakdown
+		reranked[i] = result
+	}
+	// Ties keep the retrieval order
+	sort.SliceStable(reranked, func(i, j int) bool {
+		return reranked[i].Breakdown.RerankScore > reranked[j].Breakdown.RerankScore
+	})
+
+	kept := reranked[:0]
+	for _, result := range reranked {
+		if len(kept) >= topN || result.Breakdown.RerankScore < minScore {
+			break
+		}
+		kept = append(kept, result)
+	}
+	stats.Kept = len(kept)
+
+	slog.Info("Reranked knowledge base results",
+		"provider", stats.Provider,
+		"model", stats.Model,
+		"candidates", stats.Candidates,
+		"kept", stats.Kept,
+		"latencyMs", stats.LatencyMs,
+		"cost", stats.Cost)
+	return kept, stats
+}
+
+// Voyage rerank API structures
+type voyageRerankRequest struct {
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	Model     string   `json:"model"`
+}
+
+type voyageRerankResponse struct {
+	Data []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	} `json:"data"`
+	Usage struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// voyageReranker reranks with Voyage's rerank API
+type voyageReranker struct {
+	model  string
+	apiKey string
+}
+
+func (r voyageReranker) Provider() string {
+	return models.RerankerProviderVoyage
+}
+
+func (r voyageReranker) Model() string {
+	return r.model
+}
+
+func (r voyageReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, int, error) {
+	var resp voyageRerankResponse
+	err := postRerankRequest(ctx, models.RerankerProviderVoyage, "https://api.voyageai.com/v1/rerank", r.apiKey,
+		voyageRerankRequest{Query: query, Documents: documents, Model: r.model}, &resp)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	scores := make([]float64, len(documents))
+	for _, data := range resp.Data {
+		if data.Index >= 0 && data.Index < len(scores) {
+			scores[data.Index] = data.RelevanceScore
+		}
+	}
+	return scores, resp.Usage.TotalTokens, nil
+}
+
+// Cohere rerank API structures
+type cohereRerankRequest struct {
+	Model     string   `json:"model"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+}
+
+type cohereRerankResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	} `json:"results"`
+	Meta struct {
+		BilledUnits struct {
+			SearchUnits int `json:"search_units"`
+		} `json:"billed_units"`
+	} `json:"meta"`
+}
+
+// cohereReranker reranks with Cohere's rerank API
+type cohereReranker struct {
+	model  string
+	apiKey string
+}
+
+func (r cohereReranker) Provider() string {
+	return models.RerankerProviderCohere
+}
+
+func (r cohereReranker) Model() string {
+	return r.model
+}
+
+func (r cohereReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, int, error) {
+	var resp cohereRerankResponse
+	err := postRerankRequest(ctx, models.RerankerProviderCohere, "https://api.cohere.com/v2/rerank", r.apiKey,
+		cohereRerankRequest{Model: r.model, Query: query, Documents: documents}, &resp)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	scores := make([]float64, len(documents))
+	for _, result := range resp.Results {
+		if result.Index >= 0 && result.Index < len(scores) {
+			scores[result.Index] = result.RelevanceScore
+		}
+	}
+	return scores, resp.Meta.BilledUnits.SearchUnits, nil
+}
+
+// postRerankRequest sends a rerank request to a provider and decodes its response
+func postRerankRequest(ctx context.Context, provider, url, apiKey string, request, response any) error {
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s rerank API: %w", provider, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &ProviderError{Provider: provider, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	if err := json.Unmarshal(body, response); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
+
+// Weights of the local reranker's signals
+const (
+	localRerankCoverageWeight  = 0.6  // Share of the query terms found, weighted by their IDF among the candidates
+	localRerankPhraseWeight    = 0.25 // Share of the query's adjacent term pairs found next to each other
+	localRerankProximityWeight = 0.15 // How close together the found terms are
+)
+
+// localReranker scores documents without an API, by how many of the query's terms they contain, whether
+// the query's phrases appear as written and how close together the terms are. Rarer terms among the
+// candidates count more, so a record sharing only common words with the question ranks low.
+type localReranker struct{}
+
+func (localReranker) Provider() string {
+	return models.RerankerProviderLocal
+}
+
+func (localReranker) Model() string {
+	return LocalRerankModel
+}
+
+func (localReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, int, error) {
+	queryTokens := lexicalTokens(query)
+	terms := uniqueTerms(append([]string(nil), queryTokens...))
+	if len(terms) == 0 {
+		return nil, 0, errNoQueryTerms
+	}
+
+	documentTokens := make([][]string, len(documents))
+	frequencies := make(map[string]int, len(terms))
+	for i, document := range documents {
+		documentTokens[i] = lexicalTokens(document)
+		seen := make(map[string]bool)
+		for _, token := range documentTokens[i] {
+			if !seen[token] {
+				seen[token] = true
+				frequencies[token]++
+			}
+		}
+	}
+
+	n := float64(len(documents))
+	idf := make(map[string]float64, len(terms))
+	totalIDF := 0.0
+	for _, term := range terms {
+		df := float64(frequencies[term])
+		idf[term] = math.Log(1 + (n-df+0.5)/(df+0.5))
+		totalIDF += idf[term]
+	}
+
+	scores := make([]float64, len(documents))
+	for i, tokens := range documentTokens {
+		present := make(map[string]bool)
+		for _, token := range tokens {
+			if idf[token] > 0 {
+				present[token] = true
+			}
+		}
+		if len(present) == 0 {
+			continue
+		}
+
+		coverage := 0.0
+		for term := range present {
+			coverage += idf[term]
+		}
+		coverage /= totalIDF
+
+		phrase := coverage
+		if pairs := termPairs(queryTokens); len(pairs) > 0 {
+			adjacent := termPairs(tokens)
+			found := 0
+			for pair := range pairs {
+				if adjacent[pair] {
+					found++
+				}
+			}
+			phrase = float64(found) / float64(len(pairs))
+		}
+
+		proximity := coverage
+		if len(present) > 1 {
+			proximity = float64(len(present)) / float64(shortestSpan(tokens, present))
+		}
+
+		scores[i] = localRerankCoverageWeight*coverage + localRerankPhraseWeight*phrase + localRerankProximityWeight*proximity
+	}
+	return scores, 0, nil
+}
+
+// termPairs returns the adjacent pairs of distinct terms in a token sequence
+func termPairs(tokens []string) map[[2]string]bool {
+	pairs := make(map[[2]string]bool)
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i-1] != tokens[i] {
+			pairs[[2]string{tokens[i-1], tokens[i]}] = true
+		}
+	}
+	return pairs
+}
+
+// shortestSpan returns the length in tokens of the shortest run of tokens containing every term
+func shortestSpan(tokens []string, terms map[string]bool) int {
+	counts := make(map[string]int, len(terms))
+	shortest := len(tokens)
+	start := 0
+	for end, token := range tokens {
+		if !terms[token] {
+			continue
+		}
+		counts[token]++
+		for len(counts) == len(terms) {
+			if first := tokens[start]; terms[first] {
+				if end-start+1 < shortest {
+					shortest = end - start + 1
+				}
+				counts[first]--
+				if counts[first] == 0 {
+					delete(counts, first)
+				}
+			}
+			start++
+		}
+	}
+	return shortest
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"facebook-bot/models"
+)
+
+// fixedReranker returns the given scores, or err
+type fixedReranker struct {
+	scores []float64
+	err    error
+}
+
+func (r fixedReranker) Provider() string {
+	return "test-reranker"
+}
+
+func (r fixedReranker) Model() string {
+	return "test-rerank-model"
+}
+
+func (r fixedReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, int, error) {
+	return r.scores, 0, r.err
+}
+
+func rerankTestResults(contents ...string) []SearchResult {
+	results := make([]SearchResult, len(contents))
+	for i, content := range contents {
+		results[i] = SearchResult{Content: content, Score: 0.9 - float32(i)*0.1}
+	}
+	return results
+}
+
+func TestRerankResults(t *testing.T) {
+	results := rerankTestResults("a", "b", "c", "d")
+
+	kept, stats := rerankResults(context.Background(), fixedReranker{scores: []float64{0.2, 0.9, 0.05, 0.9}}, "q", results, 3, 0.3)
+	if len(kept) != 2 || kept[0].Content != "b" || kept[1].Content != "d" {
+		t.Fatalf("kept = %+v, want b and d in retrieval order, a scores below the minimum", kept)
+	}
+	if kept[0].Breakdown.RetrievalRank != 2 || kept[0].Breakdown.RerankScore != 0.9 || kept[0].Breakdown.VectorScore != results[1].Score {
+		t.Errorf("breakdown = %+v", kept[0].Breakdown)
+	}
+	if stats.Candidates != 4 || stats.Kept != 2 || stats.Error != "" {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	kept, _ = rerankResults(context.Background(), fixedReranker{scores: []float64{0.2, 0.9, 0.05, 0.9}}, "q", results, 3, 0)
+	if len(kept) != 3 || kept[2].Content != "a" {
+		t.Errorf("kept without min score = %+v", kept)
+	}
+}
+
+func TestRerankResultsKeepsRetrievalOrderOnFailure(t *testing.T) {
+	results := rerankTestResults("a", "b", "c")
+
+	for name, reranker := range map[string]fixedReranker{
+		"error":        {err: errors.New("bad request")},
+		"wrong scores": {scores: []float64{1}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			kept, stats := rerankResults(context.Background(), reranker, "q", results, 2, 0)
+			if len(kept) != 2 || kept[0].Content != "a" || kept[1].Content != "b" {
+				t.Errorf("kept = %+v, want the first 2 in retrieval order", kept)
+			}
+			if stats.Error == "" || stats.Kept != 2 {
+				t.Errorf("stats = %+v", stats)
+			}
+		})
+	}
+}
+
+func TestLocalReranker(t *testing.T) {
+	documents := []string{
+		"Our store is open every day. Delivery takes two days.",
+		"Delivery price within Tbilisi is 5 GEL.",
+		"Price list of phones and accessories.",
+	}
+	scores, units, err := localReranker{}.Rerank(context.Background(), "delivery price", documents)
+	if err != nil || units != 0 {
+		t.Fatalf("Rerank: %v, %d units", err, units)
+	}
+	if !(scores[1] > scores[0] && scores[1] > scores[2]) {
+		t.Errorf("scores = %v, want the document with the phrase first", scores)
+	}
+
+	if _, _, err := (localReranker{}).Rerank(context.Background(), "what is the", documents); !errors.Is(err, errNoQueryTerms) {
+		t.Errorf("stop words only: err = %v", err)
+	}
+}
+
+func TestShortestSpan(t *testing.T) {
+	tokens := []string{"a", "x", "b", "y", "y", "a", "b"}
+	if got := shortestSpan(tokens, map[string]bool{"a": true, "b": true}); got != 2 {
+		t.Errorf("shortestSpan = %d, want 2", got)
+	}
+}
+
+func TestPageReranker(t *testing.T) {
+	tests := []struct {
+		name      string
+		page      models.FacebookPage
+		wantModel string
+		wantErr   bool
+	}{
+		{"disabled", models.FacebookPage{Reranker: &models.RerankerConfig{Provider: models.RerankerProviderLocal}}, "", false},
+		{"voyage default model", models.FacebookPage{VoyageAPIKey: "pa", Reranker: &models.RerankerConfig{Enabled: true, Provider: models.RerankerProviderVoyage}}, DefaultVoyageRerankModel, false},
+		{"cohere model", models.FacebookPage{CohereAPIKey: "co", Reranker: &models.RerankerConfig{Enabled: true, Provider: models.RerankerProviderCohere, Model: "rerank-multilingual-v3.0"}}, "rerank-multilingual-v3.0", false},
+		{"local", models.FacebookPage{Reranker: &models.RerankerConfig{Enabled: true, Provider: models.RerankerProviderLocal}}, LocalRerankModel, false},
+		{"voyage without key", models.FacebookPage{Reranker: &models.RerankerConfig{Enabled: true, Provider: models.RerankerProviderVoyage}}, "", true},
+		{"unknown provider", models.FacebookPage{Reranker: &models.RerankerConfig{Enabled: true, Provider: "jina"}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reranker, err := PageReranker(&tt.page)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v", err)
+			}
+			model := ""
+			if reranker != nil {
+				model = reranker.Model()
+			}
+			if model != tt.wantModel {
+				t.Errorf("model = %q, want %q", model, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestValidateReranker(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *models.RerankerConfig
+		want   bool
+	}{
+		{"none", nil, true},
+		{"disabled", &models.RerankerConfig{Provider: "jina"}, true},
+		{"defaults", &models.RerankerConfig{Enabled: true, Provider: models.RerankerProviderLocal}, true},
+		{"unknown provider", &models.RerankerConfig{Enabled: true, Provider: "jina"}, false},
+		{"too many candidates", &models.RerankerConfig{Enabled: true, Provider: models.RerankerProviderLocal, Candidates: models.MaxRerankCandidates + 1}, false},
+		{"top n above candidates", &models.RerankerConfig{Enabled: true, Provider: models.RerankerProviderLocal, Candidates: 10, TopN: 20}, false},
+		{"min score above 1", &models.RerankerConfig{Enabled: true, Provider: models.RerankerProviderLocal, MinScore: 1.5}, false},
+	}
+	for _, tt := range tests {
+		if got := ValidateReranker(tt.config); got != tt.want {
+			t.Errorf("%s: ValidateReranker = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRerankSettings(t *testing.T) {
+	if candidates, topN := rerankSettings(&models.RerankerConfig{}); candidates != models.DefaultRerankCandidates || topN != models.DefaultRerankTopN {
+		t.Errorf("defaults = %d, %d", candidates, topN)
+	}
+	if candidates, topN := rerankSettings(&models.RerankerConfig{TopN: 80}); candidates != 80 || topN != 80 {
+		t.Errorf("candidates for a large top n = %d, %d", candidates, topN)
+	}
+}
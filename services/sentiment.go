@@ -0,0 +1,333 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"facebook-bot/models"
+)
+
+const (
+	// sentimentTrendWeight is the weight of the newest message in a customer's moving average
+	sentimentTrendWeight = 0.35
+	// sentimentTrendMinMessages is the number of scored messages before the trend can escalate
+	sentimentTrendMinMessages = 3
+	// sentimentDirectionDelta is the change of the moving average that counts as improving or worsening
+	sentimentDirectionDelta = 0.05
+)
+
+// sentimentFromTool reads the classification the reply model returned with the agent detection tool.
+// Returns nil when the model left it out.
+func sentimentFromTool(input ToolUse) *models.MessageSentiment {
+	if !models.IsValidSentiment(input.Sentiment) {
+		return nil
+	}
+	urgency := input.Urgency
+	if !models.IsValidUrgency(urgency) {
+		urgency = models.UrgencyLow
+	}
+	return &models.MessageSentiment{
+		Sentiment: input.Sentiment,
+		Score:     models.SentimentScore(input.Sentiment),
+		Urgency:   urgency,
+		Source:    models.SentimentSourceModel,
+	}
+}
+
+// ClassifySentiment scores a message with the sentiment lexicon. Used when the reply model
+// did not classify the message, e.g. for customers in human mode or when every model failed.
+func ClassifySentiment(text string) models.MessageSentiment {
+	tokens := sentimentTokens(text)
+
+	var positive, negative, angry, urgent float64
+	for i, token := range tokens {
+		negated := i > 0 && negationWords[tokens[i-1]]
+		switch {
+		case matchesLexicon(token, angryWords):
+			angry++
+		case matchesLexicon(token, negativeWords):
+			if negated {
+				positive += 0.5
+			} else {
+				negative++
+			}
+		case matchesLexicon(token, positiveWords):
+			if negated {
+				negative++
+			} else {
+				positive++
+			}
+		}
+		if matchesLexicon(token, urgentWords) {
+			urgent++
+		}
+	}
+	lower := strings.ToLower(text)
+	for _, phrase := range urgentPhrases {
+		if strings.Contains(lower, phrase) {
+			urgent++
+		}
+	}
+
+	exclamations := strings.Count(text, "!")
+	shouting := isShouting(text)
+
+	raw := positive - negative - 2*angry
+	if raw < 0 && (exclamations >= 2 || shouting) {
+		raw *= 1.5
+	}
+	score := math.Max(-1, math.Min(1, raw/3))
+
+	sentiment := models.SentimentNeutral
+	switch {
+	case angry > 0 || score <= -0.75:
+		sentiment = models.SentimentAngry
+	case score < -0.15:
+		sentiment = models.SentimentNegative
+	case score > 0.15:
+		sentiment = models.SentimentPositive
+	}
+
+	urgency := models.UrgencyLow
+	switch {
+	case urgent >= 2 || (urgent >= 1 && (exclamations > 0 || shouting)):
+		urgency = models.UrgencyHigh
+	case urgent >= 1:
+		urgency = models.UrgencyMedium
+	}
+
+	return models.MessageSentiment{
+		Sentiment: sentiment,
+		Score:     math.Round(score*100) / 100,
+		Urgency:   urgency,
+		Source:    models.SentimentSourceLexicon,
+	}
+}
+
+// sentimentTokens splits a message into lowercase words
+func sentimentTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+}
+
+// matchesLexicon checks if a word starts with one of the stems, so inflected Georgian
+// and Russian forms match their stem
+func matchesLexicon(token string, stems []string) bool {
+	for _, stem := range stems {
+		if strings.HasPrefix(token, stem) {
+			return true
+		}
+	}
+	return false
+}
+
+// isShouting checks if most Latin or Cyrillic letters of a message are capitals
+func isShouting(text string) bool {
+	var upper, cased int
+	for _, r := range text {
+		if unicode.IsUpper(r) {
+			upper++
+			cased++
+		} else if unicode.IsLower(r) {
+			cased++
+		}
+	}
+	return cased >= 8 && float64(upper)/float64(cased) > 0.7
+}
+
+// UpdateMessageSentiment stores the sentiment of a customer message
+func UpdateMessageSentiment(ctx context.Context, messageID primitive.ObjectID, sentiment models.MessageSentiment) error {
+	_, err := GetDatabase().Collection("messages").UpdateOne(ctx, bson.M{"_id": messageID}, bson.M{
+		"$set": bson.M{"sentiment": sentiment},
+	})
+	return err
+}
+
+// UpdateSentimentTrend folds a message's sentiment into the customer's trend and returns the new trend
+func UpdateSentimentTrend(ctx context.Context, customerID, pageID string, sentiment models.MessageSentiment) (*models.SentimentTrend, error) {
+	customer, err := GetCustomer(ctx, customerID, pageID)
+	if err != nil {
+		return nil, err
+	}
+
+	trend := nextSentimentTrend(nil, sentiment)
+	if customer != nil {
+		trend = nextSentimentTrend(customer.Sentiment, sentiment)
+	}
+
+	_, err = GetDatabase().Collection("customers").UpdateOne(ctx, bson.M{
+		"customer_id": customerID,
+		"page_id":     pageID,
+	}, bson.M{
+		"$set": bson.M{"sentiment": trend},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return trend, nil
+}
+
+// nextSentimentTrend returns the trend after one more message
+func nextSentimentTrend(previous *models.SentimentTrend, sentiment models.MessageSentiment) *models.SentimentTrend {
+	trend := &models.SentimentTrend{
+		Score:         sentiment.Score,
+		Direction:     models.SentimentStable,
+		LastSentiment: sentiment.Sentiment,
+		LastUrgency:   sentiment.Urgency,
+		Messages:      1,
+		UpdatedAt:     time.Now(),
+	}
+	if models.IsNegativeSentiment(sentiment.Sentiment) {
+		trend.NegativeStreak = 1
+	}
+	if previous == nil || previous.Messages == 0 {
+		return trend
+	}
+
+	score := previous.Score*(1-sentimentTrendWeight) + sentiment.Score*sentimentTrendWeight
+	trend.Score = math.Round(score*100) / 100
+	trend.Messages = previous.Messages + 1
+	if models.IsNegativeSentiment(sentiment.Sentiment) {
+		trend.NegativeStreak = previous.NegativeStreak + 1
+	}
+
+	switch delta := score - previous.Score; {
+	case delta > sentimentDirectionDelta:
+		trend.Direction = models.SentimentImproving
+	case delta < -sentimentDirectionDelta:
+		trend.Direction = models.SentimentWorsening
+	}
+	return trend
+}
+
+// CheckEscalation applies a page's escalation rules to a message and the customer's trend.
+// Returns the escalation reason, or "" when the bot keeps answering.
+func CheckEscalation(pageConfig *models.FacebookPage, sentiment models.MessageSentiment, trend *models.SentimentTrend) string {
+	rules := pageConfig.EscalationRules
+	if rules == nil || !rules.Enabled {
+		return ""
+	}
+
+	reason := ""
+	switch {
+	case rules.OnAngry && sentiment.Sentiment == models.SentimentAngry:
+		reason = models.EscalationReasonAngry
+	case rules.OnHighUrgency && sentiment.Urgency == models.UrgencyHigh:
+		reason = models.EscalationReasonUrgent
+	case trend != nil && rules.NegativeStreak > 0 && trend.NegativeStreak >= rules.NegativeStreak:
+		reason = models.EscalationReasonNegativeStreak
+	case trend != nil && rules.TrendBelow < 0 && trend.Messages >= sentimentTrendMinMessages && trend.Score <= rules.TrendBelow:
+		reason = models.EscalationReasonNegativeTrend
+	}
+
+	if reason != "" {
+		slog.Info("Escalation rule matched",
+			"pageID", pageConfig.PageID,
+			"reason", reason,
+			"sentiment", sentiment.Sentiment,
+			"urgency", sentiment.Urgency,
+			"source", sentiment.Source)
+	}
+	return reason
+}
+
+// ValidateEscalationRules checks the thresholds of escalation rules
+func ValidateEscalationRules(rules *models.EscalationRules) bool {
+	if rules == nil {
+		return true
+	}
+	return rules.NegativeStreak >= 0 && rules.TrendBelow >= -1 && rules.TrendBelow <= 0
+}
+
+// GetSentimentStats summarizes the latest sentiment of a company's customers, optionally for one page
+func GetSentimentStats(ctx context.Context, companyID, pageID string) (map[string]interface{}, error) {
+	collection := GetDatabase().Collection("customers")
+
+	match := bson.M{"company_id": companyID, "sentiment": bson.M{"$exists": true}}
+	if pageID != "" {
+		match["page_id"] = pageID
+	}
+
+	cursor, err := collection.Aggregate(ctx, []bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":       "$sentiment.last_sentiment",
+			"customers": bson.M{"$sum": 1},
+			"avg_score": bson.M{"$avg": "$sentiment.score"},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		Sentiment string  `bson:"_id"`
+		Customers int64   `bson:"customers"`
+		AvgScore  float64 `bson:"avg_score"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	breakdown := map[string]int64{
+		models.SentimentPositive: 0,
+		models.SentimentNeutral:  0,
+		models.SentimentNegative: 0,
+		models.SentimentAngry:    0,
+	}
+	var scored int64
+	var scoreSum float64
+	for _, group := range groups {
+		breakdown[group.Sentiment] = group.Customers
+		scored += group.Customers
+		scoreSum += group.AvgScore * float64(group.Customers)
+	}
+	averageScore := 0.0
+	if scored > 0 {
+		averageScore = math.Round(scoreSum/float64(scored)*100) / 100
+	}
+
+	// Customers whose mood is worst right now, for agents to look at first
+	atRiskMatch := bson.M{"company_id": companyID, "sentiment.score": bson.M{"$lt": 0}}
+	if pageID != "" {
+		atRiskMatch["page_id"] = pageID
+	}
+	atRiskCursor, err := collection.Aggregate(ctx, []bson.M{
+		{"$match": atRiskMatch},
+		{"$sort": bson.M{"sentiment.score": 1}},
+		{"$limit": 5},
+		{"$project": bson.M{
+			"customer_id":   1,
+			"customer_name": 1,
+			"page_id":       1,
+			"page_name":     1,
+			"stop":          1,
+			"sentiment":     1,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer atRiskCursor.Close(ctx)
+
+	atRisk := []bson.M{}
+	if err := atRiskCursor.All(ctx, &atRisk); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"breakdown":         breakdown,
+		"average_score":     averageScore,
+		"scored_customers":  scored,
+		"at_risk_customers": atRisk,
+	}, nil
+}
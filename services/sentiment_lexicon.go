@@ -0,0 +1,75 @@
+package services
+
+// Word stems of the sentiment lexicon in the supported languages. A word matches a stem it starts
+// with, so Georgian and Russian stems cover their inflected forms.
+
+var positiveWords = []string{
+	// English
+	"thank", "great", "good", "nice", "love", "perfect", "excellent", "awesome", "amazing",
+	"happy", "wonderful", "helpful", "appreciat", "glad", "best",
+	// Georgian
+	"მადლობ", "კარგ", "მშვენიერ", "სუპერ", "მომწონ", "ბედნიერ", "საუკეთესო",
+	// Russian
+	"спасибо", "благодар", "отлично", "хорош", "супер", "нрав", "замечатель", "прекрас",
+	// Ukrainian
+	"дякую", "чудов", "добр",
+	// Turkish
+	"teşekkür", "harika", "güzel", "mükemmel",
+}
+
+var negativeWords = []string{
+	// English
+	"bad", "terribl", "awful", "disappoint", "broken", "problem", "issue", "wrong", "useless",
+	"refund", "complain", "slow", "delay", "rude", "horribl", "poor", "damag", "missing",
+	"unhappy", "annoy", "frustrat", "fail",
+	// Georgian
+	"ცუდ", "საშინელ", "პრობლემ", "უკმაყოფილ", "გაფუჭებ", "დაზიანებ", "დაგვიან",
+	// Russian
+	"плох", "ужас", "проблем", "недовол", "сломан", "поврежд", "задерж", "возврат", "жалоб",
+	// Ukrainian
+	"погано", "жахлив",
+	// Turkish
+	"kötü", "berbat", "sorun", "şikayet",
+}
+
+// angryWords signal an angry customer on their own
+var angryWords = []string{
+	// English
+	"unacceptabl", "scam", "ridiculous", "furious", "worst", "fraud", "lawyer", "disgust",
+	"pathetic", "outrage", "wtf", "liar", "cheat",
+	// Georgian
+	"თაღლით", "სირცხვილ", "მატყუარ", "აღშფოთებ", "მიუღებელ",
+	// Russian
+	"обман", "мошенн", "безобраз", "возмутит", "позор", "отврат",
+	// Ukrainian
+	"шахра",
+	// Turkish
+	"rezalet", "dolandırıcı",
+}
+
+var urgentWords = []string{
+	// English
+	"urgent", "asap", "immediately", "emergency", "hurry", "quickly",
+	// Georgian
+	"სასწრაფო", "ახლავე", "დაუყოვნებლივ", "სწრაფად",
+	// Russian
+	"срочн", "немедленн", "быстрее", "скорее",
+	// Ukrainian
+	"терміново",
+	// Turkish
+	"acil", "hemen",
+}
+
+// urgentPhrases are multi-word urgency markers matched against the whole message
+var urgentPhrases = []string{
+	"right now", "as soon as possible", "right away",
+	"прямо сейчас",
+}
+
+// negationWords flip the sentiment of the word that follows them
+var negationWords = map[string]bool{
+	"not": true, "no": true, "never": true, "don't": true, "dont": true, "isn't": true,
+	"wasn't": true, "doesn't": true, "didn't": true,
+	"არ": true, "ვერ": true, "არა": true,
+	"не": true, "нет": true,
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"testing"
+
+	"facebook-bot/models"
+)
+
+func TestClassifySentiment(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		wantSentiment string
+		wantUrgency   string
+	}{
+		{"thanks", "Thank you, great service", models.SentimentPositive, models.UrgencyLow},
+		{"question", "Where is my order?", models.SentimentNeutral, models.UrgencyLow},
+		{"complaint", "The jacket arrived broken", models.SentimentNegative, models.UrgencyLow},
+		{"negated praise", "This is not good", models.SentimentNegative, models.UrgencyLow},
+		{"negated complaint", "Not bad at all", models.SentimentPositive, models.UrgencyLow},
+		{"angry word", "This shop is a scam", models.SentimentAngry, models.UrgencyLow},
+		{"shouted complaints", "BROKEN AND DAMAGED, TERRIBLE!!", models.SentimentAngry, models.UrgencyLow},
+		{"urgent request", "Can you deliver it quickly?", models.SentimentNeutral, models.UrgencyMedium},
+		{"very urgent", "Urgent, please hurry", models.SentimentNeutral, models.UrgencyHigh},
+		{"urgent with exclamation", "I need it right now!", models.SentimentNeutral, models.UrgencyHigh},
+		{"georgian complaint", "ამანათი დაზიანებული მოვიდა", models.SentimentNegative, models.UrgencyLow},
+		{"russian angry", "Это обман!", models.SentimentAngry, models.UrgencyLow},
+		{"russian thanks", "Спасибо, всё отлично", models.SentimentPositive, models.UrgencyLow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ClassifySentiment(tt.text)
+			if got.Sentiment != tt.wantSentiment || got.Urgency != tt.wantUrgency {
+				t.Errorf("ClassifySentiment(%q) = %s/%s (score %v), want %s/%s",
+					tt.text, got.Sentiment, got.Urgency, got.Score, tt.wantSentiment, tt.wantUrgency)
+			}
+			if got.Source != models.SentimentSourceLexicon {
+				t.Errorf("source = %q, want lexicon", got.Source)
+			}
+			if got.Score < -1 || got.Score > 1 {
+				t.Errorf("score %v out of range", got.Score)
+			}
+		})
+	}
+}
+
+func TestSentimentFromTool(t *testing.T) {
+	if got := sentimentFromTool(ToolUse{Intent: "continue_bot"}); got != nil {
+		t.Errorf("sentimentFromTool without a sentiment = %+v, want nil", got)
+	}
+
+	got := sentimentFromTool(ToolUse{Sentiment: models.SentimentAngry, Urgency: "extreme"})
+	if got == nil || got.Score != -1 || got.Urgency != models.UrgencyLow || got.Source != models.SentimentSourceModel {
+		t.Errorf("sentimentFromTool(angry, invalid urgency) = %+v", got)
+	}
+}
+
+func TestNextSentimentTrend(t *testing.T) {
+	negative := models.MessageSentiment{Sentiment: models.SentimentNegative, Score: -0.5}
+	angry := models.MessageSentiment{Sentiment: models.SentimentAngry, Score: -1}
+	positive := models.MessageSentiment{Sentiment: models.SentimentPositive, Score: 0.6}
+
+	trend := nextSentimentTrend(nil, negative)
+	if trend.Messages != 1 || trend.Score != -0.5 || trend.NegativeStreak != 1 || trend.Direction != models.SentimentStable {
+		t.Fatalf("first trend = %+v", trend)
+	}
+
+	trend = nextSentimentTrend(trend, angry)
+	if trend.Messages != 2 || trend.Score != -0.68 || trend.NegativeStreak != 2 || trend.Direction != models.SentimentWorsening {
+		t.Fatalf("trend after an angry message = %+v", trend)
+	}
+
+	trend = nextSentimentTrend(trend, positive)
+	if trend.Messages != 3 || trend.NegativeStreak != 0 || trend.Direction != models.SentimentImproving || trend.LastSentiment != models.SentimentPositive {
+		t.Errorf("trend after a positive message = %+v", trend)
+	}
+}
+
+func TestCheckEscalation(t *testing.T) {
+	rules := &models.EscalationRules{Enabled: true, OnAngry: true, OnHighUrgency: true, NegativeStreak: 3, TrendBelow: -0.4}
+	page := &models.FacebookPage{PageID: "page", EscalationRules: rules}
+	neutral := models.MessageSentiment{Sentiment: models.SentimentNeutral, Urgency: models.UrgencyLow}
+	negative := models.MessageSentiment{Sentiment: models.SentimentNegative, Urgency: models.UrgencyLow}
+
+	tests := []struct {
+		name      string
+		page      *models.FacebookPage
+		sentiment models.MessageSentiment
+		trend     *models.SentimentTrend
+		want      string
+	}{
+		{"no rules", &models.FacebookPage{}, models.MessageSentiment{Sentiment: models.SentimentAngry}, nil, ""},
+		{"rules disabled", &models.FacebookPage{EscalationRules: &models.EscalationRules{OnAngry: true}}, models.MessageSentiment{Sentiment: models.SentimentAngry}, nil, ""},
+		{"angry", page, models.MessageSentiment{Sentiment: models.SentimentAngry}, nil, models.EscalationReasonAngry},
+		{"urgent", page, models.MessageSentiment{Sentiment: models.SentimentNeutral, Urgency: models.UrgencyHigh}, nil, models.EscalationReasonUrgent},
+		{"calm", page, neutral, &models.SentimentTrend{Score: 0, Messages: 5}, ""},
+		{"negative streak", page, negative, &models.SentimentTrend{Score: -0.3, Messages: 3, NegativeStreak: 3}, models.EscalationReasonNegativeStreak},
+		{"negative trend", page, neutral, &models.SentimentTrend{Score: -0.45, Messages: 3}, models.EscalationReasonNegativeTrend},
+		{"trend too short", page, neutral, &models.SentimentTrend{Score: -0.8, Messages: 2}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CheckEscalation(tt.page, tt.sentiment, tt.trend); got != tt.want {
+				t.Errorf("CheckEscalation = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -10,7 +10,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 )
 
-// SearchDocumentsByText searches for documents using text matching without generating embeddings
+// SearchDocumentsByText searches for documents using BM25 keyword ranking without generating embeddings
 func SearchDocumentsByText(ctx context.Context, query string, companyID string, pageID string, limit int) ([]SearchResult, error) {
 	collection := database.Collection("vector_documents")
 
@@ -39,90 +39,8 @@ func SearchDocumentsByText(ctx context.Context, query string, companyID string,
 		return []SearchResult{}, nil
 	}
 
-	// Convert query to lowercase for case-insensitive matching
-	queryLower := strings.ToLower(query)
-	queryWords := strings.Fields(queryLower)
-
-	// Score each document based on keyword matching
-	type scoredDoc struct {
-		doc   VectorDocument
-		score float32
-	}
-
-	var scoredDocs []scoredDoc
-
-	for _, doc := range documents {
-		contentLower := strings.ToLower(doc.Content)
-		score := float32(0)
-
-		// Calculate score based on word matches
-		for _, word := range queryWords {
-			// Skip very short words
-			if len(word) < 3 {
-				continue
-			}
-
-			// Count occurrences of the word
-			count := strings.Count(contentLower, word)
-			if count > 0 {
-				// Give higher score for more occurrences, but with diminishing returns
-				wordScore := float32(1.0)
-				if count > 1 {
-					wordScore = 1.0 + (float32(count-1) * 0.2)
-				}
-				score += wordScore
-			}
-
-			// Bonus for exact phrase match
-			if strings.Contains(contentLower, queryLower) {
-				score += 3.0
-			}
-		}
-
-		// Normalize score by number of query words
-		if len(queryWords) > 0 {
-			score = score / float32(len(queryWords))
-		}
-
-		// Store if score is above zero
-		if score > 0 {
-			scoredDocs = append(scoredDocs, scoredDoc{
-				doc:   doc,
-				score: score,
-			})
-		}
-	}
-
-	// If no matches found, return all documents with low scores
-	if len(scoredDocs) == 0 {
-		slog.Info("No keyword matches found, returning all documents",
-			"query", query,
-			"pageID", pageID,
-		)
-
-		for _, doc := range documents {
-			scoredDocs = append(scoredDocs, scoredDoc{
-				doc:   doc,
-				score: 0.1, // Low default score
-			})
-		}
-	}
-
-	// Sort by score in descending order
-	sort.Slice(scoredDocs, func(i, j int) bool {
-		return scoredDocs[i].score > scoredDocs[j].score
-	})
-
-	// Take top N results
-	var results []SearchResult
-	for i := 0; i < limit && i < len(scoredDocs); i++ {
-		results = append(results, SearchResult{
-			Content:  scoredDocs[i].doc.Content,
-			Score:    scoredDocs[i].score,
-			Source:   scoredDocs[i].doc.Source,
-			Metadata: scoredDocs[i].doc.Metadata,
-		})
-	}
+	// Rank by BM25 keyword relevance; all documents come back with a low score when no word matches
+	results := searchByTextOnly(documents, query, limit)
 
 	slog.Info("Text search completed",
 		"query", query,
@@ -165,10 +83,11 @@ func GetRAGContextWithoutEmbeddings(ctx context.Context, query string, companyID
 
 	for i, result := range results {
 		// Include score information
+		// Scores are the share of the query's keywords the result contains
 		confidence := "relevant"
-		if result.Score > 2.0 {
+		if result.Score >= 0.8 {
 			confidence = "highly relevant"
-		} else if result.Score < 0.5 {
+		} else if result.Score < 0.3 {
 			confidence = "possibly relevant"
 		}
 
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenConnectors join the parts of product codes and numbers, e.g. "AB-1234" or "12.5"
+const tokenConnectors = "-_./#"
+
+// lexicalStopWords are left out of keyword search, they match nearly every document
+var lexicalStopWords = map[string]bool{
+	// English
+	"a": true, "an": true, "and": true, "are": true, "at": true, "be": true, "can": true, "do": true,
+	"does": true, "for": true, "from": true, "have": true, "has": true, "how": true, "i": true,
+	"in": true, "is": true, "it": true, "me": true, "my": true, "of": true, "on": true, "or": true,
+	"our": true, "the": true, "there": true, "this": true, "to": true, "what": true, "when": true,
+	"where": true, "which": true, "with": true, "you": true, "your": true, "we": true,
+	// Georgian
+	"და": true, "არის": true, "რა": true, "როგორ": true, "თუ": true, "ან": true, "რომ": true,
+	"ეს": true, "ის": true, "მე": true, "თქვენ": true, "ჩვენ": true, "არ": true, "კი": true,
+	"რომელი": true, "სად": true, "როდის": true, "გაქვთ": true, "მაქვს": true,
+}
+
+// lexicalTokens splits text into lowercase search terms. Words are split on anything but letters and
+// digits in any script, and stemmed where a stemmer exists for their script. Codes made of letters and
+// digits joined by connectors are also kept whole without the connectors, so "AB-1234" and "AB1234"
+// share the term "ab1234".
+func lexicalTokens(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(tokenConnectors, r)
+	})
+
+	var tokens []string
+	for _, field := range fields {
+		field = strings.Trim(field, tokenConnectors)
+		if field == "" {
+			continue
+		}
+		parts := strings.FieldsFunc(field, func(r rune) bool {
+			return strings.ContainsRune(tokenConnectors, r)
+		})
+		if len(parts) > 1 && strings.IndexFunc(field, unicode.IsDigit) >= 0 {
+			tokens = append(tokens, strings.Join(parts, ""))
+		}
+		for _, part := range parts {
+			if token, ok := lexicalTerm(part); ok {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+// lexicalTerm normalizes one word, false when it is too short or a stop word
+func lexicalTerm(word string) (string, bool) {
+	if strings.IndexFunc(word, unicode.IsDigit) >= 0 {
+		// Numbers and codes are matched exactly
+		return word, true
+	}
+	if utf8.RuneCountInString(word) < 2 || lexicalStopWords[word] {
+		return "", false
+	}
+	first, _ := utf8.DecodeRuneInString(word)
+	switch {
+	case unicode.Is(unicode.Georgian, first):
+		return stemGeorgian(word), true
+	case first < unicode.MaxASCII:
+		return stemEnglish(word), true
+	}
+	return word, true
+}
+
+// Georgian suffixes, stripped in this order: a postposition, a case ending, the stem vowel, then the
+// plural marker. Verbal nouns in -ება lose the same letters as plurals, so both end up on one stem.
+var (
+	georgianPostpositions = []string{"ისთვის", "ისგან", "თვის", "გან", "თან", "დან", "მდე", "ვით", "კენ", "ში", "ზე"}
+	georgianCaseEndings   = []string{"ით", "ის", "ად", "მა", "ს", "ო"}
+	georgianStemVowels    = []string{"ა", "ე", "ი", "ო", "უ"}
+)
+
+// stemGeorgian strips the noun endings of a Georgian word, e.g. ფასი, ფასის, ფასებში and ფასებით all
+// become ფას. A light stemmer: verbs and irregular nouns keep their forms.
+func stemGeorgian(word string) string {
+	word = trimSuffix(word, georgianPostpositions, 3)
+	word = trimSuffix(word, georgianCaseEndings, 3)
+	word = trimSuffix(word, georgianStemVowels, 2)
+	return trimSuffix(word, []string{"ებ"}, 3)
+}
+
+// stemEnglish strips plural and -ing/-ed endings of an English word, e.g. prices and priced become price
+func stemEnglish(word string) string {
+	n := len(word)
+	switch {
+	case n <= 3:
+		return word
+	case strings.HasSuffix(word, "ies") && n > 4:
+		return word[:n-3] + "y"
+	case strings.HasSuffix(word, "sses"):
+		return word[:n-2]
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"), strings.HasSuffix(word, "is"):
+		return word
+	case strings.HasSuffix(word, "s"):
+		return word[:n-1]
+	case strings.HasSuffix(word, "ing") && n > 5:
+		return restoreE(undouble(word[:n-3]))
+	case strings.HasSuffix(word, "ed") && n > 4:
+		return restoreE(undouble(word[:n-2]))
+	}
+	return word
+}
+
+// restoreE adds back the e that priced, moving and sized lost
+func restoreE(stem string) string {
+	if strings.HasSuffix(stem, "c") || strings.HasSuffix(stem, "v") || strings.HasSuffix(stem, "z") {
+		return stem + "e"
+	}
+	return stem
+}
+
+// undouble drops a doubled final consonant, so shipped and shipping stem to ship
+func undouble(stem string) string {
+	n := len(stem)
+	if n > 2 && stem[n-1] == stem[n-2] && !strings.ContainsRune("aeiouls", rune(stem[n-1])) {
+		return stem[:n-1]
+	}
+	return stem
+}
+
+// trimSuffix removes the first of suffixes the word ends with when at least minRunes letters remain
+func trimSuffix(word string, suffixes []string, minRunes int) string {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(word, suffix) && utf8.RuneCountInString(word)-utf8.RuneCountInString(suffix) >= minRunes {
+			return strings.TrimSuffix(word, suffix)
+		}
+	}
+	return word
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLexicalTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Is model AB-1234 in stock?", []string{"model", "ab1234", "ab", "1234", "stock"}},
+		{"Price: 12.5 GEL", []string{"price", "125", "12", "5", "gel"}},
+		{"მიწოდება თბილისში უფასოა?", []string{"მიწოდ", "თბილ", "უფასო"}},
+		{"What is the price of the delivery?", []string{"price", "delivery"}},
+	}
+	for _, tt := range tests {
+		if got := lexicalTokens(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lexicalTokens(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestStemEnglish(t *testing.T) {
+	tests := map[string]string{
+		"prices":     "price",
+		"priced":     "price",
+		"shipping":   "ship",
+		"shipped":    "ship",
+		"deliveries": "delivery",
+		"address":    "address",
+		"moving":     "move",
+		"bus":        "bus",
+	}
+	for word, want := range tests {
+		if got := stemEnglish(word); got != want {
+			t.Errorf("stemEnglish(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestStemGeorgian(t *testing.T) {
+	for _, word := range []string{"ფასი", "ფასის", "ფასებში", "ფასებით"} {
+		if got := stemGeorgian(word); got != "ფას" {
+			t.Errorf("stemGeorgian(%q) = %q, want ფას", word, got)
+		}
+	}
+	// Too short to lose an ending
+	if got := stemGeorgian("ცა"); got != "ცა" {
+		t.Errorf("stemGeorgian(ცა) = %q", got)
+	}
+}
@@ -0,0 +1,385 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"facebook-bot/models"
+)
+
+// UsageScope identifies who a model call is billed to
+type UsageScope struct {
+	CompanyID  string
+	PageID     string
+	CustomerID string
+}
+
+type usageScopeKey struct{}
+
+// WithUsageScope attaches billing information to a context.
+// Non-empty fields override the scope already stored in the context.
+func WithUsageScope(ctx context.Context, scope UsageScope) context.Context {
+	current := usageScopeFromContext(ctx)
+	if scope.CompanyID != "" {
+		current.CompanyID = scope.CompanyID
+	}
+	if scope.PageID != "" {
+		current.PageID = scope.PageID
+	}
+	if scope.CustomerID != "" {
+		current.CustomerID = scope.CustomerID
+	}
+	return context.WithValue(ctx, usageScopeKey{}, current)
+}
+
+// usageScopeFromContext returns the billing scope stored in a context
+func usageScopeFromContext(ctx context.Context) UsageScope {
+	if scope, ok := ctx.Value(usageScopeKey{}).(UsageScope); ok {
+		return scope
+	}
+	return UsageScope{}
+}
+
+// withPageUsageScope is a shorthand for scoping a call to a company page
+func withPageUsageScope(ctx context.Context, company *models.Company, pageConfig *models.FacebookPage) context.Context {
+	scope := UsageScope{}
+	if company != nil {
+		scope.CompanyID = company.CompanyID
+	}
+	if pageConfig != nil {
+		scope.PageID = pageConfig.PageID
+	}
+	return WithUsageScope(ctx, scope)
+}
+
+// UsageTally adds up the tokens and cost of the model calls made with a context
+type UsageTally struct {
+	mu           sync.Mutex
+	purpose      string
+	inputTokens  int
+	outputTokens int
+	cost         float64
+}
+
+type usageTallyKey struct{}
+
+// WithUsageTally attaches a new usage tally to the context. When purpose is set, the calls
+// are recorded under it instead of their own purpose, so e.g. evaluation runs do not count as replies.
+func WithUsageTally(ctx context.Context, purpose string) (context.Context, *UsageTally) {
+	tally := &UsageTally{purpose: purpose}
+	return context.WithValue(ctx, usageTallyKey{}, tally), tally
+}
+
+// usageTallyFromContext returns the usage tally attached to the context, or nil
+func usageTallyFromContext(ctx context.Context) *UsageTally {
+	tally, _ := ctx.Value(usageTallyKey{}).(*UsageTally)
+	return tally
+}
+
+// add counts a usage event
+func (t *UsageTally) add(event models.UsageEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inputTokens += event.InputTokens + event.CacheCreationTokens + event.CacheReadTokens
+	t.outputTokens += event.OutputTokens
+	t.cost += event.Cost
+}
+
+// Totals returns the tokens and cost counted so far
+func (t *UsageTally) Totals() (int, int, float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.inputTokens, t.outputTokens, t.cost
+}
+
+// RecordUsage stores a usage event for a model call in the background.
+// Company, page and customer are taken from the context scope.
+func RecordUsage(ctx context.Context, provider, model, purpose string, inputTokens, outputTokens int) {
+	recordUsageEvent(ctx, models.UsageEvent{
+		Provider:     provider,
+		Model:        model,
+		Purpose:      purpose,
+		InputTokens:  inputTokens,
+		OutputTokens: outputTokens,
+	})
+}
+
+// recordClaudeUsage records the token usage reported in a Claude response, including prompt cache tokens
+func recordClaudeUsage(ctx context.Context, purpose string, resp *ClaudeResponse) {
+	recordUsageEvent(ctx, models.UsageEvent{
+		Provider:            models.UsageProviderAnthropic,
+		Model:               resp.Model,
+		Purpose:             purpose,
+		InputTokens:         resp.Usage.InputTokens,
+		OutputTokens:        resp.Usage.OutputTokens,
+		CacheCreationTokens: resp.Usage.CacheCreationInputTokens,
+		CacheReadTokens:     resp.Usage.CacheReadInputTokens,
+	})
+
+	if resp.Usage.CacheCreationInputTokens > 0 || resp.Usage.CacheReadInputTokens > 0 {
+		slog.Debug("Claude prompt cache used",
+			"purpose", purpose,
+			"cacheCreationTokens", resp.Usage.CacheCreationInputTokens,
+			"cacheReadTokens", resp.Usage.CacheReadInputTokens)
+	}
+}
+
+// recordUsageEvent fills in scope, totals and cost, then saves the event
+func recordUsageEvent(ctx context.Context, event models.UsageEvent) {
+	scope := usageScopeFromContext(ctx)
+	if scope.CompanyID == "" {
+		slog.Warn("Usage recorded without company scope",
+			"provider", event.Provider,
+			"model", event.Model,
+			"purpose", event.Purpose)
+	}
+
+	event.CompanyID = scope.CompanyID
+	event.PageID = scope.PageID
+	event.CustomerID = scope.CustomerID
+	event.TotalTokens = event.InputTokens + event.OutputTokens + event.CacheCreationTokens + event.CacheReadTokens
+	tally := usageTallyFromContext(ctx)
+	if tally != nil && tally.purpose != "" {
+		event.Purpose = tally.purpose
+	}
+	event.Cost, event.CacheSavings = CalculateCost(&event)
+	event.Timestamp = time.Now()
+	if tally != nil {
+		tally.add(event)
+	}
+
+	addToMonthlySpendCache(event.CompanyID, event.Cost)
+
+	// Recording must never slow down or fail the request that made the call
+	go func() {
+		saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if _, err := GetDatabase().Collection("usage_events").InsertOne(saveCtx, event); err != nil {
+			slog.Error("Failed to save usage event",
+				"companyID", event.CompanyID,
+				"model", event.Model,
+				"error", err)
+		}
+	}()
+}
+
+// CreateIndexesForUsage creates indexes for the usage_events collection
+func CreateIndexesForUsage(ctx context.Context) error {
+	collection := GetDatabase().Collection("usage_events")
+
+	indexes := []mongo.IndexModel{
+		// Budget checks and daily aggregation
+		{
+			Keys: bson.D{
+				{Key: "company_id", Value: 1},
+				{Key: "timestamp", Value: -1},
+			},
+		},
+		// Per page aggregation
+		{
+			Keys: bson.D{
+				{Key: "company_id", Value: 1},
+				{Key: "page_id", Value: 1},
+				{Key: "timestamp", Value: -1},
+			},
+		},
+	}
+
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		slog.Error("Failed to create indexes for usage_events collection", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetUsageSummary aggregates a company's usage between from and to.
+// groupBy is one of "day", "page" or "model"; pageID optionally narrows to one page.
+func GetUsageSummary(ctx context.Context, companyID, groupBy, pageID string, from, to time.Time) ([]models.UsageSummary, error) {
+	collection := GetDatabase().Collection("usage_events")
+
+	match := bson.M{
+		"company_id": companyID,
+		"timestamp": bson.M{
+			"$gte": from,
+			"$lt":  to,
+		},
+	}
+	if pageID != "" {
+		match["page_id"] = pageID
+	}
+
+	var groupKey interface{}
+	sort := bson.D{{Key: "cost", Value: -1}}
+	switch groupBy {
+	case "day":
+		groupKey = bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$timestamp"}}
+		sort = bson.D{{Key: "_id", Value: 1}}
+	case "page":
+		groupKey = "$page_id"
+	default:
+		groupKey = "$model"
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":           groupKey,
+			"requests":      bson.M{"$sum": 1},
+			"input_tokens":  bson.M{"$sum": "$input_tokens"},
+			"output_tokens": bson.M{"$sum": "$output_tokens"},
+			"total_tokens":  bson.M{"$sum": "$total_tokens"},
+			"cost":          bson.M{"$sum": "$cost"},
+
+			"cache_creation_tokens": bson.M{"$sum": "$cache_creation_tokens"},
+			"cache_read_tokens":     bson.M{"$sum": "$cache_read_tokens"},
+			"cache_savings":         bson.M{"$sum": "$cache_savings"},
+		}}},
+		{{Key: "$sort", Value: sort}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	summaries := []models.UsageSummary{}
+	if err := cursor.All(ctx, &summaries); err != nil {
+		return nil, err
+	}
+
+	return summaries, nil
+}
+
+// monthlySpend caches a company's spend for the current month
+type monthlySpend struct {
+	month     string
+	amount    float64
+	fetchedAt time.Time
+}
+
+var (
+	monthlySpendCache   = make(map[string]*monthlySpend)
+	monthlySpendCacheMu sync.Mutex
+)
+
+const monthlySpendCacheTTL = 1 * time.Minute
+
+// addToMonthlySpendCache keeps the cached spend current between refreshes
+func addToMonthlySpendCache(companyID string, cost float64) {
+	monthlySpendCacheMu.Lock()
+	defer monthlySpendCacheMu.Unlock()
+
+	if cached, ok := monthlySpendCache[companyID]; ok && cached.month == time.Now().Format("2006-01") {
+		cached.amount += cost
+	}
+}
+
+// GetMonthlySpend returns a company's total cost for the current calendar month
+func GetMonthlySpend(ctx context.Context, companyID string) (float64, error) {
+	now := time.Now()
+	month := now.Format("2006-01")
+
+	monthlySpendCacheMu.Lock()
+	if cached, ok := monthlySpendCache[companyID]; ok && cached.month == month && time.Since(cached.fetchedAt) < monthlySpendCacheTTL {
+		amount := cached.amount
+		monthlySpendCacheMu.Unlock()
+		return amount, nil
+	}
+	monthlySpendCacheMu.Unlock()
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"company_id": companyID,
+			"timestamp":  bson.M{"$gte": monthStart},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":  nil,
+			"cost": bson.M{"$sum": "$cost"},
+		}}},
+	}
+
+	cursor, err := GetDatabase().Collection("usage_events").Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Cost float64 `bson:"cost"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return 0, err
+	}
+
+	var amount float64
+	if len(results) > 0 {
+		amount = results[0].Cost
+	}
+
+	monthlySpendCacheMu.Lock()
+	monthlySpendCache[companyID] = &monthlySpend{
+		month:     month,
+		amount:    amount,
+		fetchedAt: now,
+	}
+	monthlySpendCacheMu.Unlock()
+
+	return amount, nil
+}
+
+// IsBudgetExceeded checks if a company has used up its monthly budget.
+// Returns false when no budget is configured or the spend cannot be determined.
+func IsBudgetExceeded(ctx context.Context, company *models.Company) bool {
+	if company == nil || company.MonthlyBudget <= 0 {
+		return false
+	}
+
+	spent, err := GetMonthlySpend(ctx, company.CompanyID)
+	if err != nil {
+		slog.Error("Failed to get monthly spend, allowing request",
+			"companyID", company.CompanyID,
+			"error", err)
+		return false
+	}
+
+	if spent >= company.MonthlyBudget {
+		slog.Warn("Company monthly budget exceeded",
+			"companyID", company.CompanyID,
+			"budget", company.MonthlyBudget,
+			"spent", spent)
+		return true
+	}
+
+	return false
+}
+
+// GetBudgetExceededAction returns the company's configured action, defaulting to a fallback reply
+func GetBudgetExceededAction(company *models.Company) string {
+	if models.IsValidBudgetAction(company.BudgetExceededAction) {
+		return company.BudgetExceededAction
+	}
+	return models.BudgetActionFallbackReply
+}
+
+// GetBudgetFallbackMessage returns the reply sent instead of a model response when the budget is exceeded.
+// The built-in reply is localized to the customer's language.
+func GetBudgetFallbackMessage(company *models.Company, language string) string {
+	if company.BudgetFallbackMessage != "" {
+		return company.BudgetFallbackMessage
+	}
+	if language == "" {
+		language = company.DefaultLanguage
+	}
+	return LocalizedMessage(MessageKeyBudgetFallback, language)
+}
@@ -0,0 +1,545 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Vector index backends
+const (
+	VectorIndexMemory = "memory" // HNSW graphs in the app's memory, built at startup
+	VectorIndexAtlas  = "atlas"  // MongoDB Atlas $vectorSearch
+)
+
+// vectorSearchCandidates is the minimum number of nearest documents fetched per search. Results are
+// re-ranked with keyword relevance, so more candidates than results are fetched.
+const vectorSearchCandidates = 50
+
+// ErrVectorIndexNotReady is returned while the index is being built. Search falls back to scanning the documents.
+var ErrVectorIndexNotReady = errors.New("vector index not ready")
+
+// VectorQuery selects the documents to search and the embedding to search for
+type VectorQuery struct {
+	CompanyID string
+	PageID    string // Empty searches every page of the company
+	Channel   string // Empty searches the documents of every channel
+	CRMID     string // Only documents of this CRM link when set
+	Embedding []float32
+	K         int // Number of documents to return
+
+	// Provider and model the embedding was made with. Only documents of that model, or stored
+	// before models were recorded, are searched.
+	EmbeddingProvider string
+	EmbeddingModel    string
+}
+
+// VectorHit is a document found by a vector index
+type VectorHit struct {
+	ID    primitive.ObjectID
+	Score float32 // Cosine similarity to the query
+}
+
+// VectorIndex finds the active documents nearest to a query embedding
+type VectorIndex interface {
+	// Name returns the backend, VectorIndexMemory or VectorIndexAtlas
+	Name() string
+
+	// Search returns up to query.K documents, most similar first. Returns no hits when no document
+	// has an embedding of the query's model and dimension.
+	Search(ctx context.Context, query VectorQuery) ([]VectorHit, error)
+
+	// Maintained reports whether the index is kept by the app. Only then are Build, Upsert and Remove needed.
+	Maintained() bool
+
+	// Build indexes every active document
+	Build(ctx context.Context) error
+
+	// Upsert indexes documents, or removes them when they are no longer active
+	Upsert(documents ...VectorDocument)
+
+	// Remove drops deleted documents from the index
+	Remove(ids ...primitive.ObjectID)
+}
+
+// VectorIndexConfig selects the vector index backend
+type VectorIndexConfig struct {
+	Backend        string // VectorIndexMemory (default) or VectorIndexAtlas
+	AtlasIndexName string // Name of the Atlas vector search index on vector_documents
+}
+
+var vectorIndex VectorIndex = newMemoryVectorIndex()
+
+// SetVectorIndex selects the vector index backend. Must be called before serving requests.
+func SetVectorIndex(config VectorIndexConfig) error {
+	switch config.Backend {
+	case "", VectorIndexMemory:
+		vectorIndex = newMemoryVectorIndex()
+	case VectorIndexAtlas:
+		name := config.AtlasIndexName
+		if name == "" {
+			name = "vector_index"
+		}
+		vectorIndex = &atlasVectorIndex{indexName: name}
+	default:
+		return fmt.Errorf("unknown vector index backend %q", config.Backend)
+	}
+	return nil
+}
+
+// BuildVectorIndex indexes the stored documents when the index is kept by the app. Search scans
+// the documents until it finishes.
+func BuildVectorIndex(ctx context.Context) error {
+	if !vectorIndex.Maintained() {
+		slog.Info("Vector index kept by MongoDB", "backend", vectorIndex.Name())
+		return nil
+	}
+	return vectorIndex.Build(ctx)
+}
+
+// filter returns the MongoDB filter of the documents the query searches
+func (q VectorQuery) filter() bson.M {
+	filter := bson.M{
+		"company_id": q.CompanyID,
+		"is_active":  true,
+	}
+	if q.PageID != "" {
+		filter["page_id"] = q.PageID
+	}
+	if q.Channel != "" {
+		filter["channels."+normalizeChannel(q.Channel)] = true
+	}
+	if q.CRMID != "" {
+		filter["crm_id"] = q.CRMID
+	}
+	return filter
+}
+
+// vectorCandidateCount returns how many nearest documents to fetch for limit results
+func vectorCandidateCount(limit int) int {
+	return max(vectorSearchCandidates, limit*10)
+}
+
+// sortVectorHits orders hits most similar first
+func sortVectorHits(hits []VectorHit) {
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+}
+
+// indexedCandidates returns the documents nearest to the query's embedding, most similar first.
+// Returns false when the index cannot answer, e.g. while it is built or when no document has an
+// embedding of the query's model and dimension, so the caller scans the documents instead.
+func indexedCandidates(ctx context.Context, query VectorQuery) ([]VectorDocument, bool) {
+	hits, err := vectorIndex.Search(ctx, query)
+	if err != nil {
+		if !errors.Is(err, ErrVectorIndexNotReady) {
+			slog.Warn("Vector index search failed, scanning documents",
+				"backend", vectorIndex.Name(),
+				"companyID", query.CompanyID,
+				"pageID", query.PageID,
+				"error", err)
+		}
+		return nil, false
+	}
+	if len(hits) == 0 {
+		return nil, false
+	}
+
+	ids := make([]primitive.ObjectID, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+
+	// The filter is applied again in case the index lags behind a change
+	filter := query.filter()
+	filter["_id"] = bson.M{"$in": ids}
+	cursor, err := database.Collection("vector_documents").Find(ctx, filter)
+	if err != nil {
+		slog.Warn("Failed to load vector index hits, scanning documents", "error", err)
+		return nil, false
+	}
+	defer cursor.Close(ctx)
+
+	var documents []VectorDocument
+	if err := cursor.All(ctx, &documents); err != nil {
+		slog.Warn("Failed to read vector index hits, scanning documents", "error", err)
+		return nil, false
+	}
+
+	rank := make(map[primitive.ObjectID]int, len(hits))
+	for i, hit := range hits {
+		rank[hit.ID] = i
+	}
+	ordered := make([]VectorDocument, len(hits))
+	found := make([]bool, len(hits))
+	for _, doc := range documents {
+		ordered[rank[doc.ID]] = doc
+		found[rank[doc.ID]] = true
+	}
+	candidates := ordered[:0]
+	for i, doc := range ordered {
+		// Atlas does not know the models, so vectors of another model of the same dimension are dropped here
+		if query.EmbeddingModel != "" && !vectorMatchesEmbedder(doc, query.EmbeddingProvider, query.EmbeddingModel, len(query.Embedding)) {
+			continue
+		}
+		if found[i] {
+			candidates = append(candidates, doc)
+		}
+	}
+	return candidates, len(candidates) > 0
+}
+
+// syncVectorIndex re-indexes the documents matching filter after they were stored or changed, and
+// drops the keyword indexes of their pages
+func syncVectorIndex(ctx context.Context, filter bson.M) {
+	invalidateLexicalIndexes(filter)
+	if !vectorIndex.Maintained() {
+		return
+	}
+	documents, err := loadIndexableDocuments(ctx, filter)
+	if err != nil {
+		slog.Error("Failed to update vector index", "filter", filter, "error", err)
+		return
+	}
+	vectorIndex.Upsert(documents...)
+}
+
+// vectorDocumentIDs returns the IDs of the documents matching filter, to drop them from the index
+// once they are deleted. Returns nil when the index is not kept by the app.
+func vectorDocumentIDs(ctx context.Context, filter bson.M) []primitive.ObjectID {
+	if !vectorIndex.Maintained() {
+		return nil
+	}
+	cursor, err := database.Collection("vector_documents").Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		slog.Error("Failed to find documents to drop from vector index", "error", err)
+		return nil
+	}
+	defer cursor.Close(ctx)
+
+	var ids []primitive.ObjectID
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err == nil {
+			ids = append(ids, doc.ID)
+		}
+	}
+	return ids
+}
+
+// indexProjection is the part of a document the in-memory index needs
+var indexProjection = bson.M{
+	"company_id":         1,
+	"page_id":            1,
+	"embedding":          1,
+	"embedding_provider": 1,
+	"embedding_model":    1,
+	"channels":           1,
+	"crm_id":             1,
+	"is_active":          1,
+}
+
+// loadIndexableDocuments returns the index fields of the documents matching filter
+func loadIndexableDocuments(ctx context.Context, filter bson.M) ([]VectorDocument, error) {
+	cursor, err := database.Collection("vector_documents").Find(ctx, filter, options.Find().SetProjection(indexProjection))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var documents []VectorDocument
+	for cursor.Next(ctx) {
+		var doc VectorDocument
+		if err := cursor.Decode(&doc); err != nil {
+			// Documents with channels in the old array format are skipped until migrated
+			continue
+		}
+		documents = append(documents, doc)
+	}
+	return documents, cursor.Err()
+}
+
+// vectorPartition is one HNSW graph: the documents of a page enabled for a channel with embeddings
+// of one model and dimension. Channel "" holds the page's documents of every channel, model "" the
+// documents stored before models were recorded.
+type vectorPartition struct {
+	companyID string
+	pageID    string
+	channel   string
+	model     string // provider/model
+	dimension int
+}
+
+// partitionModel returns the model key of a provider's model, "" when neither is known
+func partitionModel(provider, model string) string {
+	if provider == "" && model == "" {
+		return ""
+	}
+	return provider + "/" + model
+}
+
+// indexedVector is where a document is indexed
+type indexedVector struct {
+	partitions []vectorPartition
+	crmID      string
+	embedding  []float32
+}
+
+// memoryVectorIndex keeps an HNSW graph per company, page, channel, embedding model and dimension
+type memoryVectorIndex struct {
+	mu        sync.RWMutex
+	graphs    map[vectorPartition]*hnswGraph
+	documents map[primitive.ObjectID]indexedVector
+	ready     bool
+	building  bool
+	changed   map[primitive.ObjectID]struct{} // Documents changed while building
+}
+
+func newMemoryVectorIndex() *memoryVectorIndex {
+	return &memoryVectorIndex{
+		graphs:    make(map[vectorPartition]*hnswGraph),
+		documents: make(map[primitive.ObjectID]indexedVector),
+	}
+}
+
+func (m *memoryVectorIndex) Name() string {
+	return VectorIndexMemory
+}
+
+func (m *memoryVectorIndex) Maintained() bool {
+	return true
+}
+
+func (m *memoryVectorIndex) Search(ctx context.Context, query VectorQuery) ([]VectorHit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.ready {
+		return nil, ErrVectorIndexNotReady
+	}
+
+	channel := ""
+	if query.Channel != "" {
+		channel = normalizeChannel(query.Channel)
+	}
+
+	model := partitionModel(query.EmbeddingProvider, query.EmbeddingModel)
+
+	var hits []VectorHit
+	for partition, graph := range m.graphs {
+		if partition.companyID != query.CompanyID || partition.channel != channel || partition.dimension != len(query.Embedding) {
+			continue
+		}
+		if model != "" && partition.model != model && partition.model != "" {
+			continue
+		}
+		if query.PageID != "" && partition.pageID != query.PageID {
+			continue
+		}
+		for _, hit := range graph.Search(query.Embedding, query.K, query.CRMID) {
+			hits = append(hits, VectorHit{ID: graph.nodes[hit.node].id, Score: hit.similarity})
+		}
+	}
+
+	// Searches across pages merge the best of every page
+	sortVectorHits(hits)
+	if len(hits) > query.K {
+		hits = hits[:query.K]
+	}
+	return hits, nil
+}
+
+func (m *memoryVectorIndex) Build(ctx context.Context) error {
+	m.mu.Lock()
+	if m.building {
+		m.mu.Unlock()
+		return fmt.Errorf("vector index is already being built")
+	}
+	m.building = true
+	m.changed = make(map[primitive.ObjectID]struct{})
+	m.mu.Unlock()
+
+	start := time.Now()
+	built := newMemoryVectorIndex()
+	err := func() error {
+		cursor, err := database.Collection("vector_documents").Find(ctx,
+			bson.M{"is_active": true},
+			options.Find().SetProjection(indexProjection))
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+
+		skipped := 0
+		for cursor.Next(ctx) {
+			var doc VectorDocument
+			if err := cursor.Decode(&doc); err != nil {
+				skipped++
+				continue
+			}
+			built.upsertLocked(doc)
+		}
+		if skipped > 0 {
+			slog.Warn("Skipped undecodable documents while building vector index", "skipped", skipped)
+		}
+		return cursor.Err()
+	}()
+
+	m.mu.Lock()
+	m.building = false
+	changed := m.changed
+	m.changed = nil
+	if err == nil {
+		m.graphs = built.graphs
+		m.documents = built.documents
+		m.ready = true
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to build vector index: %w", err)
+	}
+
+	// Documents changed while the build read the collection are indexed from their current state
+	if len(changed) > 0 {
+		ids := make([]primitive.ObjectID, 0, len(changed))
+		for id := range changed {
+			ids = append(ids, id)
+		}
+		documents, err := loadIndexableDocuments(ctx, bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return fmt.Errorf("failed to index documents changed during build: %w", err)
+		}
+		m.Remove(ids...)
+		m.Upsert(documents...)
+	}
+
+	m.mu.RLock()
+	slog.Info("Vector index built",
+		"backend", VectorIndexMemory,
+		"documents", len(m.documents),
+		"graphs", len(m.graphs),
+		"durationMs", time.Since(start).Milliseconds())
+	m.mu.RUnlock()
+	return nil
+}
+
+func (m *memoryVectorIndex) Upsert(documents ...VectorDocument) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, doc := range documents {
+		m.upsertLocked(doc)
+		if m.building {
+			m.changed[doc.ID] = struct{}{}
+		}
+	}
+}
+
+func (m *memoryVectorIndex) Remove(ids ...primitive.ObjectID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range ids {
+		m.removeLocked(id)
+		if m.building {
+			m.changed[id] = struct{}{}
+		}
+	}
+}
+
+// upsertLocked places a document in the graphs of its page's enabled channels
+func (m *memoryVectorIndex) upsertLocked(doc VectorDocument) {
+	if !doc.IsActive || len(doc.Embedding) == 0 {
+		m.removeLocked(doc.ID)
+		return
+	}
+
+	model := partitionModel(doc.EmbeddingProvider, doc.EmbeddingModel)
+	partitions := []vectorPartition{{companyID: doc.CompanyID, pageID: doc.PageID, model: model, dimension: len(doc.Embedding)}}
+	for channel, enabled := range normalizeChannels(doc.Channels) {
+		if enabled {
+			partitions = append(partitions, vectorPartition{
+				companyID: doc.CompanyID,
+				pageID:    doc.PageID,
+				channel:   channel,
+				model:     model,
+				dimension: len(doc.Embedding),
+			})
+		}
+	}
+
+	if existing, ok := m.documents[doc.ID]; ok {
+		if existing.crmID == doc.CRMID && samePartitions(existing.partitions, partitions) && sameVector(existing.embedding, doc.Embedding) {
+			return
+		}
+		m.removeLocked(doc.ID)
+	}
+
+	for _, partition := range partitions {
+		graph, ok := m.graphs[partition]
+		if !ok {
+			graph = newHNSWGraph(partition.dimension)
+			m.graphs[partition] = graph
+		}
+		graph.Insert(doc.ID, doc.CRMID, doc.Embedding)
+	}
+	m.documents[doc.ID] = indexedVector{partitions: partitions, crmID: doc.CRMID, embedding: doc.Embedding}
+}
+
+func (m *memoryVectorIndex) removeLocked(id primitive.ObjectID) {
+	existing, ok := m.documents[id]
+	if !ok {
+		return
+	}
+	for _, partition := range existing.partitions {
+		if graph, ok := m.graphs[partition]; ok {
+			graph.Remove(id)
+			if graph.Len() == 0 {
+				delete(m.graphs, partition)
+			}
+		}
+	}
+	delete(m.documents, id)
+}
+
+// samePartitions checks if two documents are indexed in the same graphs, in any order
+func samePartitions(a, b []vectorPartition) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, partition := range a {
+		found := false
+		for _, other := range b {
+			if partition == other {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func sameVector(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// atlasCandidateFactor is how many candidates $vectorSearch considers per returned document
+const atlasCandidateFactor = 10
+
+// atlasVectorIndex searches with MongoDB Atlas $vectorSearch. Atlas keeps the index up to date, so
+// the app does not build or update it. The search index has to be created in Atlas, see
+// docs/RAG_FEATURE_DOCUMENTATION.md.
+type atlasVectorIndex struct {
+	indexName string
+}
+
+func (a *atlasVectorIndex) Name() string {
+	return VectorIndexAtlas
+}
+
+func (a *atlasVectorIndex) Maintained() bool {
+	return false
+}
+
+func (a *atlasVectorIndex) Build(ctx context.Context) error {
+	return nil
+}
+
+func (a *atlasVectorIndex) Upsert(documents ...VectorDocument) {}
+
+func (a *atlasVectorIndex) Remove(ids ...primitive.ObjectID) {}
+
+func (a *atlasVectorIndex) Search(ctx context.Context, query VectorQuery) ([]VectorHit, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$vectorSearch", Value: bson.M{
+			"index":         a.indexName,
+			"path":          "embedding",
+			"queryVector":   query.Embedding,
+			"numCandidates": min(query.K*atlasCandidateFactor, 10000),
+			"limit":         query.K,
+			"filter":        query.filter(),
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":   1,
+			"score": bson.M{"$meta": "vectorSearchScore"},
+		}}},
+	}
+
+	cursor, err := database.Collection("vector_documents").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("$vectorSearch failed: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Score float64            `bson:"score"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to read $vectorSearch results: %w", err)
+	}
+
+	hits := make([]VectorHit, len(rows))
+	for i, row := range rows {
+		// Atlas scales cosine similarity to 0..1
+		hits[i] = VectorHit{ID: row.ID, Score: float32(row.Score*2 - 1)}
+	}
+	return hits, nil
+}
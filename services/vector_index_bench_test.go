@@ -0,0 +1,226 @@
+package services
+
+// Benchmarks of knowledge base search with and without the vector index:
+//
+//	go test ./services/ -run '^$' -bench 'VectorSearch|LexicalSearch' -benchtime 200x
+//
+// BenchmarkVectorSearchAtlas runs against a populated knowledge base in Atlas with a $vectorSearch
+// index and is skipped unless VECTOR_BENCH_ATLAS_URI is set, e.g.
+//
+//	VECTOR_BENCH_ATLAS_URI=mongodb+srv://... VECTOR_BENCH_DB=facebook_bot \
+//	VECTOR_BENCH_COMPANY=acme VECTOR_BENCH_PAGE=123456789 go test ./services/ -run '^$' -bench VectorSearchAtlas
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"facebook-bot/models"
+)
+
+const benchDimension = 1024 // voyage-2
+
+var benchSizes = []int{1000, 5000}
+
+// benchWeights ranks by vectors only, keyword ranking is measured by BenchmarkLexicalSearch
+var benchWeights = models.HybridSearch{VectorWeight: 1}
+
+// benchKnowledgeBase is a page's documents with embeddings clustered by topic, as real chunks are
+type benchKnowledgeBase struct {
+	documents []VectorDocument
+	queries   [][]float32
+	graph     *hnswGraph
+}
+
+var benchKnowledgeBases = map[int]*benchKnowledgeBase{}
+
+func benchmarkKnowledgeBase(b *testing.B, size int) *benchKnowledgeBase {
+	if kb, ok := benchKnowledgeBases[size]; ok {
+		return kb
+	}
+	b.Helper()
+
+	rng := rand.New(rand.NewSource(int64(size)))
+	topics := make([][]float32, 50)
+	for i := range topics {
+		topics[i] = randomVector(rng, nil, 1)
+	}
+	words := strings.Fields("delivery price order return hours address card payment size color warranty discount")
+
+	kb := &benchKnowledgeBase{graph: newHNSWGraph(benchDimension)}
+	for i := 0; i < size; i++ {
+		doc := VectorDocument{
+			ID:        primitive.NewObjectID(),
+			Content:   fmt.Sprintf("%s %s %s chunk %d", words[rng.Intn(len(words))], words[rng.Intn(len(words))], words[rng.Intn(len(words))], i),
+			Embedding: randomVector(rng, topics[rng.Intn(len(topics))], 0.8),
+			IsActive:  true,
+		}
+		kb.documents = append(kb.documents, doc)
+		kb.graph.Insert(doc.ID, "", doc.Embedding)
+	}
+	for i := 0; i < 100; i++ {
+		kb.queries = append(kb.queries, randomVector(rng, topics[rng.Intn(len(topics))], 0.8))
+	}
+
+	benchKnowledgeBases[size] = kb
+	return kb
+}
+
+// randomVector returns center plus gaussian noise, or pure noise without a center
+func randomVector(rng *rand.Rand, center []float32, noise float64) []float32 {
+	vector := make([]float32, benchDimension)
+	for i := range vector {
+		vector[i] = float32(rng.NormFloat64() * noise)
+		if center != nil {
+			vector[i] += center[i]
+		}
+	}
+	return vector
+}
+
+// BenchmarkVectorSearchLinear scores every document of the page, as search did before the index.
+// Loading the documents from MongoDB, which took most of the time, is not included.
+func BenchmarkVectorSearchLinear(b *testing.B) {
+	for _, size := range benchSizes {
+		kb := benchmarkKnowledgeBase(b, size)
+		b.Run(fmt.Sprintf("docs=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				fuseRankings(kb.documents, kb.queries[i%len(kb.queries)], nil, benchWeights, 5)
+			}
+		})
+	}
+}
+
+// BenchmarkVectorSearchHNSW takes the nearest candidates from the in-memory graph and ranks only those.
+// Reports the share of the exact 10 nearest documents the graph finds as recall@10.
+func BenchmarkVectorSearchHNSW(b *testing.B) {
+	for _, size := range benchSizes {
+		kb := benchmarkKnowledgeBase(b, size)
+		byID := make(map[primitive.ObjectID]VectorDocument, len(kb.documents))
+		for _, doc := range kb.documents {
+			byID[doc.ID] = doc
+		}
+
+		b.Run(fmt.Sprintf("docs=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				query := kb.queries[i%len(kb.queries)]
+				hits := kb.graph.Search(query, vectorCandidateCount(5), "")
+				candidates := make([]VectorDocument, len(hits))
+				for j, hit := range hits {
+					candidates[j] = byID[kb.graph.nodes[hit.node].id]
+				}
+				fuseRankings(candidates, query, nil, benchWeights, 5)
+			}
+			b.StopTimer()
+			b.ReportMetric(benchRecall(kb, 10), "recall@10")
+		})
+	}
+}
+
+// BenchmarkLexicalSearch ranks the page's documents by BM25 with its keyword index, as hybrid search
+// does next to the vector search
+func BenchmarkLexicalSearch(b *testing.B) {
+	queries := []string{"delivery price", "return warranty card", "discount for size 42"}
+	for _, size := range benchSizes {
+		kb := benchmarkKnowledgeBase(b, size)
+		index := newLexicalIndex(kb.documents)
+		b.Run(fmt.Sprintf("docs=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				index.Search(queries[i%len(queries)], vectorCandidateCount(5), VectorQuery{})
+			}
+		})
+	}
+}
+
+// benchRecall is the share of the exact k nearest documents the graph returns
+func benchRecall(kb *benchKnowledgeBase, k int) float64 {
+	found := 0
+	for _, query := range kb.queries {
+		similarities := make([]float32, len(kb.documents))
+		order := make([]int, len(kb.documents))
+		for i, doc := range kb.documents {
+			similarities[i] = CosineSimilarity(query, doc.Embedding)
+			order[i] = i
+		}
+		sort.Slice(order, func(i, j int) bool { return similarities[order[i]] > similarities[order[j]] })
+
+		exact := make(map[primitive.ObjectID]bool, k)
+		for _, i := range order[:k] {
+			exact[kb.documents[i].ID] = true
+		}
+		for _, hit := range kb.graph.Search(query, k, "") {
+			if exact[kb.graph.nodes[hit.node].id] {
+				found++
+			}
+		}
+	}
+	return float64(found) / float64(k*len(kb.queries))
+}
+
+// BenchmarkVectorSearchAtlas searches a page's knowledge base with $vectorSearch, including loading the hits
+func BenchmarkVectorSearchAtlas(b *testing.B) {
+	uri := os.Getenv("VECTOR_BENCH_ATLAS_URI")
+	if uri == "" {
+		b.Skip("VECTOR_BENCH_ATLAS_URI not set")
+	}
+	companyID, pageID := os.Getenv("VECTOR_BENCH_COMPANY"), os.Getenv("VECTOR_BENCH_PAGE")
+	dbName := os.Getenv("VECTOR_BENCH_DB")
+	if dbName == "" {
+		dbName = "facebook_bot"
+	}
+	indexName := os.Getenv("VECTOR_BENCH_INDEX")
+	if indexName == "" {
+		indexName = "vector_index"
+	}
+
+	ctx := context.Background()
+	client, err := InitMongoDB(ctx, uri)
+	if err != nil {
+		b.Fatalf("failed to connect to Atlas: %v", err)
+	}
+	defer client.Disconnect(ctx)
+	database = client.Database(dbName)
+
+	// Query with vectors of the stored documents' dimension
+	var sample VectorDocument
+	if err := database.Collection("vector_documents").FindOne(ctx, bson.M{
+		"company_id": companyID,
+		"page_id":    pageID,
+		"is_active":  true,
+	}).Decode(&sample); err != nil {
+		b.Fatalf("no documents for company %q page %q: %v", companyID, pageID, err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	queries := make([][]float32, 20)
+	for i := range queries {
+		queries[i] = make([]float32, len(sample.Embedding))
+		for j := range queries[i] {
+			queries[i][j] = sample.Embedding[j] + float32(rng.NormFloat64()*0.01)
+		}
+	}
+
+	previous := vectorIndex
+	vectorIndex = &atlasVectorIndex{indexName: indexName}
+	defer func() { vectorIndex = previous }()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		candidates, ok := indexedCandidates(ctx, VectorQuery{
+			CompanyID: companyID,
+			PageID:    pageID,
+			Embedding: queries[i%len(queries)],
+			K:         vectorCandidateCount(5),
+		})
+		if !ok {
+			b.Fatal("$vectorSearch returned no documents, check the search index")
+		}
+		fuseRankings(candidates, queries[i%len(queries)], nil, benchWeights, 5)
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryVectorIndex(t *testing.T) {
+	ctx := context.Background()
+	index := newMemoryVectorIndex()
+
+	if _, err := index.Search(ctx, VectorQuery{CompanyID: "c1", Embedding: []float32{1, 0}, K: 5}); !errors.Is(err, ErrVectorIndexNotReady) {
+		t.Fatalf("search before build error = %v, want ErrVectorIndexNotReady", err)
+	}
+	index.ready = true
+
+	hours := VectorDocument{ID: primitive.NewObjectID(), CompanyID: "c1", PageID: "p1", Embedding: []float32{1, 0},
+		Channels: map[string]bool{"messenger": true, "facebook": true}, IsActive: true}
+	delivery := VectorDocument{ID: primitive.NewObjectID(), CompanyID: "c1", PageID: "p1", Embedding: []float32{0, 1},
+		Channels: map[string]bool{"messenger": true, "facebook": false}, IsActive: true}
+	otherPage := VectorDocument{ID: primitive.NewObjectID(), CompanyID: "c1", PageID: "p2", Embedding: []float32{0.9, 0.1},
+		Channels: map[string]bool{"facebook": true}, IsActive: true}
+	otherCompany := VectorDocument{ID: primitive.NewObjectID(), CompanyID: "c2", PageID: "p3", Embedding: []float32{1, 0},
+		Channels: map[string]bool{"facebook": true}, IsActive: true}
+	index.Upsert(hours, delivery, otherPage, otherCompany)
+
+	search := func(query VectorQuery) []primitive.ObjectID {
+		t.Helper()
+		query.CompanyID = "c1"
+		query.K = 10
+		hits, err := index.Search(ctx, query)
+		if err != nil {
+			t.Fatalf("search failed: %v", err)
+		}
+		ids := make([]primitive.ObjectID, len(hits))
+		for i, hit := range hits {
+			ids[i] = hit.ID
+		}
+		return ids
+	}
+	same := func(got []primitive.ObjectID, want ...primitive.ObjectID) bool {
+		if len(got) != len(want) {
+			return false
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	if got := search(VectorQuery{PageID: "p1", Channel: "messenger", Embedding: []float32{1, 0}}); !same(got, hours.ID, delivery.ID) {
+		t.Errorf("messenger search = %v", got)
+	}
+	if got := search(VectorQuery{PageID: "p1", Channel: "Facebook", Embedding: []float32{0, 1}}); !same(got, hours.ID) {
+		t.Errorf("facebook search = %v, want only the document enabled for facebook", got)
+	}
+	if got := search(VectorQuery{Embedding: []float32{1, 0}}); !same(got, hours.ID, otherPage.ID, delivery.ID) {
+		t.Errorf("company-wide search = %v", got)
+	}
+	if got := search(VectorQuery{PageID: "p1", Embedding: []float32{1, 0, 0}}); len(got) != 0 {
+		t.Errorf("search with another dimension = %v", got)
+	}
+
+	// Disabling a channel and deactivating a document move them out of the results
+	delivery.Channels = map[string]bool{"messenger": false}
+	otherPage.IsActive = false
+	index.Upsert(delivery, otherPage)
+	if got := search(VectorQuery{PageID: "p1", Channel: "messenger", Embedding: []float32{0, 1}}); !same(got, hours.ID) {
+		t.Errorf("search after disabling messenger = %v", got)
+	}
+	if got := search(VectorQuery{Embedding: []float32{1, 0}}); !same(got, hours.ID, delivery.ID) {
+		t.Errorf("search after deactivating = %v", got)
+	}
+
+	index.Remove(hours.ID, delivery.ID)
+	if got := search(VectorQuery{Embedding: []float32{1, 0}}); len(got) != 0 {
+		t.Errorf("search after removing = %v", got)
+	}
+	// The other company's document is left in its page graph and its facebook graph
+	if len(index.graphs) != 2 || len(index.documents) != 1 {
+		t.Errorf("index keeps %d graphs and %d documents, want only the other company's", len(index.graphs), len(index.documents))
+	}
+}
+
+func TestVectorQueryFilter(t *testing.T) {
+	filter := VectorQuery{CompanyID: "c1", PageID: "p1", Channel: "Messenger", CRMID: "crm-1"}.filter()
+	if filter["company_id"] != "c1" || filter["page_id"] != "p1" || filter["channels.messenger"] != true ||
+		filter["crm_id"] != "crm-1" || filter["is_active"] != true {
+		t.Errorf("filter = %v", filter)
+	}
+
+	filter = VectorQuery{CompanyID: "c1"}.filter()
+	if len(filter) != 2 {
+		t.Errorf("filter without page, channel and CRM link = %v", filter)
+	}
+}
+
+func TestSetVectorIndex(t *testing.T) {
+	defer func() { vectorIndex = newMemoryVectorIndex() }()
+
+	if err := SetVectorIndex(VectorIndexConfig{Backend: VectorIndexAtlas}); err != nil || vectorIndex.Name() != VectorIndexAtlas || vectorIndex.Maintained() {
+		t.Errorf("atlas backend: err %v, index %s", err, vectorIndex.Name())
+	}
+	if err := SetVectorIndex(VectorIndexConfig{}); err != nil || vectorIndex.Name() != VectorIndexMemory {
+		t.Errorf("default backend: err %v, index %s", err, vectorIndex.Name())
+	}
+	if err := SetVectorIndex(VectorIndexConfig{Backend: "faiss"}); err == nil {
+		t.Error("unknown backend accepted")
+	}
+}
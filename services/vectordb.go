@@ -24,95 +24,84 @@ type VectorDocument struct {
 	PageID    string             `bson:"page_id" json:"page_id"`
 	Content   string             `bson:"content" json:"content"`
 	Embedding []float32          `bson:"embedding" json:"embedding"`
-	Metadata  map[string]string  `bson:"metadata" json:"metadata"`
-	Source    string             `bson:"source" json:"source"`                       // "crm", "product", "faq", etc.
-	Channels  map[string]bool    `bson:"channels" json:"channels"`                   // {"facebook": true, "messenger": false} - true means enabled for that channel
-	CRMURL    string             `bson:"crm_url,omitempty" json:"crm_url,omitempty"` // URL of the CRM link this document came from
-	CRMID     string             `bson:"crm_id,omitempty" json:"crm_id,omitempty"`   // ID of the CRM link this document belongs to
-	IsActive  bool               `bson:"is_active" json:"is_active"`                 // Whether this document should be used in searches
-	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+
+	// Model the embedding comes from; empty for documents stored before models were recorded
+	EmbeddingProvider  string `bson:"embedding_provider,omitempty" json:"embedding_provider,omitempty"`
+	EmbeddingModel     string `bson:"embedding_model,omitempty" json:"embedding_model,omitempty"`
+	EmbeddingDimension int    `bson:"embedding_dimension,omitempty" json:"embedding_dimension,omitempty"`
+
+	Metadata  map[string]string `bson:"metadata" json:"metadata"`
+	Source    string            `bson:"source" json:"source"`                       // "crm", "product", "faq", etc.
+	Channels  map[string]bool   `bson:"channels" json:"channels"`                   // {"facebook": true, "messenger": false} - true means enabled for that channel
+	CRMURL    string            `bson:"crm_url,omitempty" json:"crm_url,omitempty"` // URL of the CRM link this document came from
+	CRMID     string            `bson:"crm_id,omitempty" json:"crm_id,omitempty"`   // ID of the CRM link this document belongs to
+	IsActive  bool              `bson:"is_active" json:"is_active"`                 // Whether this document should be used in searches
+	CreatedAt time.Time         `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time         `bson:"updated_at" json:"updated_at"`
+
+	// Chunk of an uploaded document's version the document was stored from; empty for documents
+	// stored by content
+	KnowledgeChunkID    *primitive.ObjectID `bson:"knowledge_chunk_id,omitempty" json:"knowledge_chunk_id,omitempty"`
+	KnowledgeDocumentID *primitive.ObjectID `bson:"knowledge_document_id,omitempty" json:"knowledge_document_id,omitempty"`
+	DocumentVersion     int                 `bson:"document_version,omitempty" json:"document_version,omitempty"`
 }
 
 // SearchResult represents a search result from vector DB
 type SearchResult struct {
-	Content  string            `json:"content"`
-	Score    float32           `json:"score"`
-	Source   string            `json:"source"`
-	Metadata map[string]string `json:"metadata"`
+	Content   string            `json:"content"`
+	Score     float32           `json:"score"`
+	Source    string            `json:"source"`
+	Metadata  map[string]string `json:"metadata"`
+	Breakdown *ScoreBreakdown   `json:"breakdown,omitempty"` // How knowledge base search ranked the result
 }
 
-// GetEmbeddings generates embeddings for text using Voyage AI
-func GetEmbeddings(ctx context.Context, text string, companyID string, pageID string) ([]float32, error) {
-	// Get company configuration
-	company, err := GetCompanyByID(ctx, companyID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get company config: %w", err)
-	}
-
-	// Find the page configuration
-	var pageConfig *models.FacebookPage
-	for _, page := range company.Pages {
-		if page.PageID == pageID {
-			pageConfig = &page
-			break
-		}
-	}
+// ScoreBreakdown tells how a knowledge base result was ranked. Results are ordered by the fused score,
+// or by the rerank score when the page reranks them; their Score is the vector score, or the keyword
+// coverage when no embeddings could be compared.
+type ScoreBreakdown struct {
+	VectorScore     float32 `json:"vector_score"`           // Cosine similarity to the query embedding or the keyword match standing in for it
+	VectorRank      int     `json:"vector_rank,omitempty"`  // Position by vector score, 1 is best
+	LexicalScore    float64 `json:"lexical_score"`          // BM25 score of the query terms
+	LexicalRank     int     `json:"lexical_rank,omitempty"` // Position by BM25, 0 when no query term matched
+	LexicalCoverage float64 `json:"lexical_coverage"`       // 0-1 share of the query terms found, weighted by their IDF
+	FusedScore      float64 `json:"fused_score"`            // Weighted reciprocal rank fusion of both positions
+
+	RetrievalRank int     `json:"retrieval_rank,omitempty"` // Position before reranking, 0 when not reranked
+	RerankScore   float64 `json:"rerank_score,omitempty"`   // Relevance the reranker gave the result
+}
 
-	// If no pageID provided or page not found, use first page
-	if pageConfig == nil && len(company.Pages) > 0 {
-		pageConfig = &company.Pages[0]
-	}
+// GetEmbeddings generates embeddings for text with the page's configured provider. Returns an error
+// wrapping ErrNoEmbeddingProvider when the page has none.
+func GetEmbeddings(ctx context.Context, text string, companyID string, pageID string) ([]float32, error) {
+	embedding, _, err := embedText(ctx, text, companyID, pageID, EmbeddingInputDocument)
+	return embedding, err
+}
 
-	if pageConfig == nil {
-		return nil, fmt.Errorf("no page configuration found")
+// embedText embeds text with the page's embedder and returns the embedder used
+func embedText(ctx context.Context, text, companyID, pageID, inputType string) ([]float32, Embedder, error) {
+	pageConfig, err := embeddingPageConfig(ctx, companyID, pageID)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Check if GPT is configured (prioritize GPT over Voyage)
-	if pageConfig.GPTAPIKey != "" {
-		model := pageConfig.GPTModel
-		if model == "" {
-			model = "text-embedding-3-large" // Default GPT embedding model
-		}
-
-		embeddings, err := GetOpenAIEmbeddings(ctx, []string{text}, pageConfig.GPTAPIKey, model)
-		if err != nil {
-			return nil, fmt.Errorf("GPT embedding failed: %w", err)
-		}
-
-		if len(embeddings) == 0 {
-			return nil, fmt.Errorf("no embeddings generated")
-		}
-
-		return embeddings[0], nil
+	embedder, err := PageEmbedder(pageConfig)
+	if err != nil {
+		slog.Warn("No embedding provider for page",
+			"companyID", companyID,
+			"pageID", pageID,
+			"error", err,
+		)
+		return nil, nil, err
 	}
 
-	// Fall back to Voyage if configured
-	if pageConfig.VoyageAPIKey != "" {
-		model := pageConfig.VoyageModel
-		if model == "" {
-			model = "voyage-2" // Default Voyage model
-		}
-
-		embeddings, err := GetVoyageEmbeddings(ctx, []string{text}, pageConfig.VoyageAPIKey, model)
-		if err != nil {
-			return nil, fmt.Errorf("Voyage embedding failed: %w", err)
-		}
-
-		if len(embeddings) == 0 {
-			return nil, fmt.Errorf("no embeddings generated")
-		}
+	// Bill embedding calls to this company page
+	ctx = WithUsageScope(ctx, UsageScope{CompanyID: companyID, PageID: pageConfig.PageID})
 
-		return embeddings[0], nil
+	embeddings, err := embedder.Embed(ctx, []string{text}, inputType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s embedding failed: %w", embedder.Provider(), err)
 	}
-
-	// If neither GPT nor Voyage is configured, use mock embeddings
-	slog.Warn("No embedding API configured, using mock embeddings",
-		"companyID", companyID,
-		"pageID", pageID,
-	)
-	mockEmbeddings := GetMockEmbeddings([]string{text})
-	return mockEmbeddings[0], nil
+	return embeddings[0], embedder, nil
 }
 
 // CosineSimilarity calculates the cosine similarity between two vectors
@@ -177,34 +166,15 @@ func StoreEmbeddingsWithChannelsAndCRMID(ctx context.Context, companyID, pageID
 	collection := database.Collection("vector_documents")
 
 	// Generate embeddings using company's configured provider
-	embedding, err := GetEmbeddings(ctx, content, companyID, pageID)
+	embedding, embedder, err := embedText(ctx, content, companyID, pageID, EmbeddingInputDocument)
 	if err != nil {
 		return fmt.Errorf("failed to generate embeddings: %w", err)
 	}
 
-	// Convert channels array to map
-	channelMap := make(map[string]bool)
-	if len(channels) == 0 {
-		// If no channels specified, default to both enabled
-		channelMap["facebook"] = true
-		channelMap["messenger"] = true
-	} else {
-		// Initialize all channels as false first
-		channelMap["facebook"] = false
-		channelMap["messenger"] = false
-		// Then set the specified channels to true
-		for _, ch := range channels {
-			ch = normalizeChannel(ch)
-			if ch == "facebook" || ch == "messenger" {
-				channelMap[ch] = true
-			}
-		}
-	}
-
 	doc := VectorDocument{
 		CompanyID: companyID,
 		PageID:    pageID,
-		Channels:  channelMap,
+		Channels:  channelMapOf(channels),
 		Content:   content,
 		Embedding: embedding,
 		Metadata:  metadata,
@@ -214,32 +184,32 @@ func StoreEmbeddingsWithChannelsAndCRMID(ctx context.Context, companyID, pageID
 		IsActive:  isActive,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
+
+		EmbeddingProvider:  embedder.Provider(),
+		EmbeddingModel:     embedder.Model(),
+		EmbeddingDimension: len(embedding),
 	}
 
-	// Upsert based on CRM URL if provided, otherwise based on content
-	var filter bson.M
-	if crmURL != "" {
-		// For CRM documents, use URL as unique identifier
-		filter = bson.M{
-			"company_id": companyID,
-			"page_id":    pageID,
-			"crm_url":    crmURL,
-		}
-	} else {
-		// For other documents, use content as unique identifier
-		filter = bson.M{
-			"company_id": companyID,
-			"content":    content,
-		}
+	// Upsert based on content. CRM feeds are stored a chunk at a time, their stale chunks are deleted
+	// by CRM URL. Chunks of uploaded documents are stored by chunk and never replaced by content.
+	filter := bson.M{
+		"company_id":         companyID,
+		"content":            content,
+		"knowledge_chunk_id": bson.M{"$exists": false},
 	}
 
-	update := bson.M{"$set": doc}
+	// A vector staged by a running re-embedding job was made from the old content
+	update := bson.M{
+		"$set":   doc,
+		"$unset": bson.M{"reindex_job_id": "", "reindex_embedding": "", "reindex_provider": "", "reindex_model": ""},
+	}
 	opts := options.Update().SetUpsert(true)
 
 	_, err = collection.UpdateOne(ctx, filter, update, opts)
 	if err != nil {
 		return fmt.Errorf("failed to store embeddings: %w", err)
 	}
+	syncVectorIndex(ctx, filter)
 
 	slog.Info("Stored embeddings",
 		"companyID", companyID,
@@ -253,32 +223,48 @@ func StoreEmbeddingsWithChannelsAndCRMID(ctx context.Context, companyID, pageID
 	return nil
 }
 
+// channelMapOf converts a list of channels to a document's channel map
+func channelMapOf(channels []string) map[string]bool {
+	channelMap := make(map[string]bool)
+	if len(channels) == 0 {
+		// If no channels specified, default to both enabled
+		channelMap["facebook"] = true
+		channelMap["messenger"] = true
+	} else {
+		// Initialize all channels as false first
+		channelMap["facebook"] = false
+		channelMap["messenger"] = false
+		// Then set the specified channels to true
+		for _, ch := range channels {
+			ch = normalizeChannel(ch)
+			if ch == "facebook" || ch == "messenger" {
+				channelMap[ch] = true
+			}
+		}
+	}
+	return channelMap
+}
+
 // SearchSimilarDocumentsByPage searches for similar documents filtered by page ID using cosine similarity
 func SearchSimilarDocumentsByPage(ctx context.Context, query string, companyID string, pageID string, limit int) ([]SearchResult, error) {
-	collection := database.Collection("vector_documents")
-
 	// Generate query embedding using company's configured provider
-	queryEmbedding, err := GetEmbeddings(ctx, query, companyID, pageID)
+	queryEmbedding, embedder, err := embedText(ctx, query, companyID, pageID, EmbeddingInputQuery)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
 	}
 
-	// Fetch documents filtered by company, page ID, and active status
-	filter := bson.M{
-		"company_id": companyID,
-		"page_id":    pageID,
-		"is_active":  true,
-	}
-	cursor, err := collection.Find(ctx, filter)
+	// Fetch the nearest documents of the page, or all active ones when the index cannot answer
+	documents, err := vectorSearchDocuments(ctx, VectorQuery{
+		CompanyID:         companyID,
+		PageID:            pageID,
+		Embedding:         queryEmbedding,
+		K:                 vectorCandidateCount(limit),
+		EmbeddingProvider: embedder.Provider(),
+		EmbeddingModel:    embedder.Model(),
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(ctx)
-
-	var documents []VectorDocument
-	if err := cursor.All(ctx, &documents); err != nil {
-		return nil, err
-	}
 
 	if len(documents) == 0 {
 		slog.Info("No documents found for page",
@@ -374,30 +360,24 @@ func SearchSimilarDocumentsByPage(ctx context.Context, query string, companyID s
 
 // SearchSimilarDocuments searches for similar documents using vector similarity
 func SearchSimilarDocuments(ctx context.Context, query string, companyID string, limit int) ([]SearchResult, error) {
-	collection := database.Collection("vector_documents")
-
 	// Generate query embedding using company's configured provider
 	// Use empty pageID to get default page config
-	queryEmbedding, err := GetEmbeddings(ctx, query, companyID, "")
+	queryEmbedding, embedder, err := embedText(ctx, query, companyID, "", EmbeddingInputQuery)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
 	}
 
-	// Fetch all active documents for the company (in production, use vector index)
-	filter := bson.M{
-		"company_id": companyID,
-		"is_active":  true,
-	}
-	cursor, err := collection.Find(ctx, filter)
+	// Fetch the nearest documents of all the company's pages, or all active ones when the index cannot answer
+	documents, err := vectorSearchDocuments(ctx, VectorQuery{
+		CompanyID:         companyID,
+		Embedding:         queryEmbedding,
+		K:                 vectorCandidateCount(limit),
+		EmbeddingProvider: embedder.Provider(),
+		EmbeddingModel:    embedder.Model(),
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(ctx)
-
-	var documents []VectorDocument
-	if err := cursor.All(ctx, &documents); err != nil {
-		return nil, err
-	}
 
 	// Calculate similarity scores
 	type scoredDoc struct {
@@ -457,35 +437,38 @@ func SearchSimilarDocuments(ctx context.Context, query string, companyID string,
 	return results, nil
 }
 
-// splitIntoLargeChunks splits text into larger chunks by size
-func splitIntoLargeChunks(text string, maxSize int) []string {
-	if len(text) <= maxSize {
-		return []string{text}
+// vectorSearchDocuments returns the documents nearest to the query's embedding from the vector index,
+// or every document the query selects when the index cannot answer. Documents embedded with another
+// model than the query are left out.
+func vectorSearchDocuments(ctx context.Context, query VectorQuery) ([]VectorDocument, error) {
+	if documents, ok := indexedCandidates(ctx, query); ok {
+		return documents, nil
 	}
 
-	var chunks []string
-	lines := strings.Split(text, "\n")
-	currentChunk := ""
-
-	for _, line := range lines {
-		// If adding this line would exceed max size, start new chunk
-		if len(currentChunk)+len(line)+1 > maxSize && currentChunk != "" {
-			chunks = append(chunks, currentChunk)
-			currentChunk = line
-		} else {
-			if currentChunk != "" {
-				currentChunk += "\n"
-			}
-			currentChunk += line
-		}
+	cursor, err := database.Collection("vector_documents").Find(ctx, query.filter())
+	if err != nil {
+		return nil, err
 	}
+	defer cursor.Close(ctx)
 
-	// Add the last chunk
-	if currentChunk != "" {
-		chunks = append(chunks, currentChunk)
+	var documents []VectorDocument
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, err
 	}
 
-	return chunks
+	matching := documents[:0]
+	for _, doc := range documents {
+		if vectorMatchesEmbedder(doc, query.EmbeddingProvider, query.EmbeddingModel, len(query.Embedding)) {
+			matching = append(matching, doc)
+		}
+	}
+	if mismatched := len(documents) - len(matching); mismatched > 0 {
+		slog.Warn("Documents embedded with another model left out of search, embed them again",
+			"companyID", query.CompanyID,
+			"pageID", query.PageID,
+			"mismatchedVectors", mismatched)
+	}
+	return matching, nil
 }
 
 // GetRAGContext retrieves relevant context for a query using cosine similarity search
@@ -575,13 +558,38 @@ func GetRAGContext(ctx context.Context, query string, companyID string, pageID s
 
 // GetRAGContextForChannel retrieves relevant context for a query filtered by channel
 func GetRAGContextForChannel(ctx context.Context, query string, companyID string, pageID string, channel string) (string, error) {
+	ragContext, _, err := GetRAGContextWithConfidence(ctx, query, companyID, pageID, channel)
+	return ragContext, err
+}
+
+// GetRAGContextWithConfidence retrieves relevant context for a query filtered by channel,
+// along with how well the results match the query. Pages with a reranker have a wider set of
+// results re-scored before the best are put in the context.
+func GetRAGContextWithConfidence(ctx context.Context, query string, companyID string, pageID string, channel string) (string, models.RetrievalConfidence, error) {
+	// Pages with a reranker retrieve a wider candidate set and let it pick the results kept
+	limit := 5
+	reranker, rerankConfig := pageRerankConfig(ctx, companyID, pageID)
+	var topN int
+	if reranker != nil {
+		limit, topN = rerankSettings(rerankConfig)
+	}
+
 	// Search using stored embeddings with cosine similarity filtered by channel
-	results, err := SearchWithStoredEmbeddingsForChannel(ctx, query, companyID, pageID, channel, 5)
+	results, info, err := searchStoredEmbeddingsForChannel(ctx, query, companyID, pageID, channel, limit)
 	if err != nil {
 		slog.Error("Failed to search with stored embeddings", "error", err)
-		return "", err
+		return "", models.RetrievalConfidence{}, err
+	}
+
+	var rerank *models.RerankStats
+	if reranker != nil && len(results) > 0 {
+		rerankCtx := WithUsageScope(ctx, UsageScope{CompanyID: companyID, PageID: pageID})
+		results, rerank = rerankResults(rerankCtx, reranker, query, results, topN, rerankConfig.MinScore)
 	}
 
+	confidence := retrievalConfidence(query, results, info.mode)
+	confidence.MismatchedVectors = info.mismatched
+	confidence.Rerank = rerank
 	if len(results) == 0 {
 		slog.Info("No relevant context found for query",
 			"query", query,
@@ -589,7 +597,7 @@ func GetRAGContextForChannel(ctx context.Context, query string, companyID string
 			"pageID", pageID,
 			"channel", channel,
 		)
-		return "", nil
+		return "", confidence, nil
 	}
 
 	// Build context from multiple results for comprehensive coverage
@@ -643,6 +651,10 @@ func GetRAGContextForChannel(ctx context.Context, query string, companyID string
 		"contextLength", len(ragContext),
 		"sources", len(results),
 		"topScore", results[0].Score,
+		"coverage", confidence.Coverage,
+		"confidence", confidence.Level,
+		"mode", info.mode,
+		"mismatchedVectors", info.mismatched,
 		"companyID", companyID,
 		"pageID", pageID,
 		"channel", channel,
@@ -657,7 +669,7 @@ func GetRAGContextForChannel(ctx context.Context, query string, companyID string
 		slog.Debug("RAG context preview", "content", preview)
 	}
 
-	return ragContext, nil
+	return ragContext, confidence, nil
 }
 
 // extractRelevantPortion extracts the most relevant portion of content based on query
@@ -830,6 +842,7 @@ func ToggleVectorDocumentStatus(ctx context.Context, companyID, pageID, crmURL s
 	if result.MatchedCount == 0 {
 		return fmt.Errorf("vector document not found for CRM URL: %s", crmURL)
 	}
+	syncVectorIndex(ctx, filter)
 
 	slog.Info("Toggled vector document status",
 		"companyID", companyID,
@@ -920,6 +933,7 @@ func UpdateVectorDocumentChannels(ctx context.Context, companyID, pageID, filena
 	if err != nil {
 		return 0, fmt.Errorf("failed to update document channels: %w", err)
 	}
+	syncVectorIndex(ctx, filter)
 
 	slog.Info("Updated document channels",
 		"companyID", companyID,
@@ -977,6 +991,7 @@ func UpdateVectorDocumentChannelValue(ctx context.Context, companyID, pageID, fi
 	if err != nil {
 		return 0, fmt.Errorf("failed to update document channel value: %w", err)
 	}
+	syncVectorIndex(ctx, filter)
 
 	slog.Info("Updated document channel value",
 		"companyID", companyID,
@@ -1000,15 +1015,20 @@ func SyncVectorDocumentWithCRMLink(ctx context.Context, companyID, pageID, crmUR
 func DeleteVectorDocumentByContent(ctx context.Context, companyID, pageID, content string) (int64, error) {
 	collection := database.Collection("vector_documents")
 
-	result, err := collection.DeleteOne(ctx, bson.M{
+	filter := bson.M{
 		"company_id": companyID,
 		"page_id":    pageID,
 		"content":    content,
-	})
+	}
+	ids := vectorDocumentIDs(ctx, filter)
+
+	result, err := collection.DeleteOne(ctx, filter)
 
 	if err != nil {
 		return 0, fmt.Errorf("failed to delete vector document: %w", err)
 	}
+	vectorIndex.Remove(ids...)
+	invalidateLexicalIndexes(filter)
 
 	return result.DeletedCount, nil
 }
@@ -1023,10 +1043,14 @@ func DeleteVectorDocumentsByMetadata(ctx context.Context, companyID, pageID, met
 		fmt.Sprintf("metadata.%s", metadataKey): metadataValue,
 	}
 
+	ids := vectorDocumentIDs(ctx, filter)
+
 	result, err := collection.DeleteMany(ctx, filter)
 	if err != nil {
 		return 0, fmt.Errorf("failed to delete vector documents: %w", err)
 	}
+	vectorIndex.Remove(ids...)
+	invalidateLexicalIndexes(filter)
 
 	return result.DeletedCount, nil
 }
@@ -1156,6 +1180,7 @@ func ToggleVectorDocumentByID(ctx context.Context, documentID string, isActive b
 	if err != nil {
 		return 0, fmt.Errorf("failed to toggle document status: %w", err)
 	}
+	syncVectorIndex(ctx, bson.M{"_id": objID})
 
 	return result.ModifiedCount, nil
 }
@@ -1184,6 +1209,7 @@ func ToggleVectorDocumentsByMetadata(ctx context.Context, companyID, pageID, met
 	if err != nil {
 		return 0, fmt.Errorf("failed to toggle documents status: %w", err)
 	}
+	syncVectorIndex(ctx, filter)
 
 	return result.ModifiedCount, nil
 }
@@ -1192,16 +1218,36 @@ func ToggleVectorDocumentsByMetadata(ctx context.Context, companyID, pageID, met
 func InitVectorDB(ctx context.Context) error {
 	collection := database.Collection("vector_documents")
 
+	// Content was unique per company before chunks of uploaded documents were stored by chunk; a
+	// missing index is fine
+	if _, err := collection.Indexes().DropOne(ctx, "company_id_1_content_1"); err == nil {
+		slog.Info("Dropped unique content index of vector documents")
+	}
+
 	// Create indexes
 	indexes := []mongo.IndexModel{
 		{Keys: bson.M{"company_id": 1}},
 		{Keys: bson.M{"page_id": 1}},
 		{Keys: bson.M{"source": 1}},
 		{Keys: bson.M{"created_at": -1}},
+		{
+			// Documents stored by content are unique per company, chunks of uploaded documents
+			// per chunk
+			Keys: bson.D{
+				{Key: "company_id", Value: 1},
+				{Key: "content", Value: 1},
+				{Key: "knowledge_chunk_id", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{
+			{Key: "knowledge_document_id", Value: 1},
+			{Key: "document_version", Value: 1},
+		}, Options: options.Index().SetSparse(true)},
 		{Keys: bson.D{
-			{Key: "company_id", Value: 1},
-			{Key: "content", Value: 1},
-		}, Options: options.Index().SetUnique(true)},
+			{Key: "metadata.website_source_id", Value: 1},
+			{Key: "metadata.url", Value: 1},
+		}, Options: options.Index().SetSparse(true)},
 	}
 
 	_, err := collection.Indexes().CreateMany(ctx, indexes)
@@ -0,0 +1,618 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"facebook-bot/models"
+)
+
+// Website crawler settings
+const (
+	websiteCrawlerAgent     = "FacebookBot-Website-Crawler" // Product token robots.txt rules are matched against
+	websiteCrawlerUserAgent = websiteCrawlerAgent + "/1.0"
+	websiteFetchTimeout     = 20 * time.Second
+	websiteMaxRedirects     = 5
+	websiteMaxBodySize      = 5 * 1024 * 1024
+	websiteMaxSitemaps      = 50                     // Sitemaps read from a sitemap index
+	websiteCrawlDelay       = 200 * time.Millisecond // Pause between requests when robots.txt sets none
+	websiteMaxCrawlDelay    = 10 * time.Second
+)
+
+// websiteSkippedExtensions are links to files the crawler cannot read, left out without fetching them
+var websiteSkippedExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".svg": true, ".ico": true,
+	".css": true, ".js": true, ".mjs": true, ".map": true, ".woff": true, ".woff2": true, ".ttf": true,
+	".mp3": true, ".mp4": true, ".webm": true, ".mov": true, ".avi": true, ".zip": true, ".rar": true,
+	".exe": true, ".dmg": true, ".apk": true,
+}
+
+// websiteAddressAllowed decides which addresses the crawler may connect to. Tests replace it to crawl
+// servers on the loopback interface.
+var websiteAddressAllowed = isPublicAddress
+
+// errWebsiteAddressRefused is returned for connections to private network addresses
+var errWebsiteAddressRefused = errors.New("connection to a private network address refused")
+
+// errWebsiteRobotsUnavailable stops a crawl when robots.txt cannot be read, as its rules are unknown
+var errWebsiteRobotsUnavailable = errors.New("robots.txt could not be fetched")
+
+// crawledPage is a page the crawler fetched
+type crawledPage struct {
+	URL          string
+	Title        string
+	Text         string // Main content, with the title as a heading
+	ETag         string
+	LastModified string
+	Store        bool // The page matches the source's patterns and allows indexing
+	NotModified  bool // The server answered a conditional request with 304
+	Gone         bool // The server answered 404 or 410
+	Err          error
+}
+
+// websiteCrawlStats counts what a crawl left out
+type websiteCrawlStats struct {
+	Fetched   int
+	Skipped   int
+	Truncated bool
+}
+
+// websiteCrawler crawls one website source breadth first from its seed
+type websiteCrawler struct {
+	source   *models.WebsiteSource
+	client   *http.Client
+	seed     *url.URL
+	robots   *robotsRules
+	delay    time.Duration
+	previous map[string]models.WebsitePage // Pages of the last crawl, for conditional requests
+	include  []websitePattern
+	exclude  []websitePattern
+	lastHit  time.Time
+}
+
+type websiteQueueItem struct {
+	url   string
+	depth int
+}
+
+// newWebsiteCrawler checks a source's seed URL and patterns
+func newWebsiteCrawler(source *models.WebsiteSource, previous map[string]models.WebsitePage) (*websiteCrawler, error) {
+	seed, err := parseWebsiteURL(source.SeedURL)
+	if err != nil {
+		return nil, err
+	}
+	c := &websiteCrawler{
+		source:   source,
+		seed:     seed,
+		delay:    websiteCrawlDelay,
+		previous: previous,
+	}
+	if c.include, err = compileWebsitePatterns(source.IncludePatterns); err != nil {
+		return nil, err
+	}
+	if c.exclude, err = compileWebsitePatterns(source.ExcludePatterns); err != nil {
+		return nil, err
+	}
+
+	// Every connection is checked after DNS resolution, so redirects, sitemap URLs and hostnames that
+	// resolve to internal addresses cannot reach services on the server's network
+	dialer := &net.Dialer{Timeout: websiteFetchTimeout, Control: websiteDialControl}
+	c.client = &http.Client{
+		Timeout: websiteFetchTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: websiteFetchTimeout,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= websiteMaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", websiteMaxRedirects)
+			}
+			if !c.sameSite(req.URL) {
+				return fmt.Errorf("redirected off the website to %s", req.URL.Host)
+			}
+			return nil
+		},
+	}
+	return c, nil
+}
+
+// crawl fetches the seed, or the pages its sitemap lists, and follows links within the website up to
+// the source's depth and page limits. Each fetched page is passed to visit.
+func (c *websiteCrawler) crawl(ctx context.Context, visit func(crawledPage)) (websiteCrawlStats, error) {
+	var stats websiteCrawlStats
+	if err := c.loadRobots(ctx); err != nil {
+		return stats, err
+	}
+	if !c.robots.allowed(c.seed.RequestURI()) {
+		return stats, fmt.Errorf("robots.txt does not allow crawling %s", c.seed)
+	}
+
+	queue := []websiteQueueItem{{url: c.seed.String()}}
+	seen := map[string]bool{c.seed.String(): true}
+	if isSitemapURL(c.seed) {
+		urls, err := c.readSitemap(ctx, c.seed.String(), 0)
+		if err != nil {
+			return stats, fmt.Errorf("failed to read sitemap: %w", err)
+		}
+		queue = queue[:0]
+		for _, u := range urls {
+			if !seen[u] {
+				seen[u] = true
+				queue = append(queue, websiteQueueItem{url: u})
+			}
+		}
+	}
+
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		item := queue[0]
+		queue = queue[1:]
+
+		target, _ := url.Parse(item.url)
+		if c.excluded(target) || !c.robots.allowed(target.RequestURI()) {
+			stats.Skipped++
+			continue
+		}
+		if stats.Fetched >= c.maxPages() {
+			stats.Truncated = true
+			stats.Skipped += len(queue) + 1
+			break
+		}
+
+		stats.Fetched++
+		page, links := c.fetchPage(ctx, item.url)
+		visit(page)
+
+		if item.depth >= c.source.MaxDepth {
+			continue
+		}
+		for _, link := range links {
+			if !seen[link] {
+				seen[link] = true
+				queue = append(queue, websiteQueueItem{url: link, depth: item.depth + 1})
+			}
+		}
+	}
+	return stats, nil
+}
+
+// loadRobots reads the website's robots.txt. A missing one allows everything; one that cannot be
+// fetched stops the crawl.
+func (c *websiteCrawler) loadRobots(ctx context.Context) error {
+	robotsURL := &url.URL{Scheme: c.seed.Scheme, Host: c.seed.Host, Path: "/robots.txt"}
+	resp, err := c.get(ctx, robotsURL.String(), nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errWebsiteRobotsUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%w: status %d", errWebsiteRobotsUnavailable, resp.StatusCode)
+	case resp.StatusCode >= 400:
+		c.robots = &robotsRules{}
+		return nil
+	}
+	data, err := readWebsiteBody(resp)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errWebsiteRobotsUnavailable, err)
+	}
+	c.robots = parseRobotsTxt(data, websiteCrawlerAgent)
+	if c.robots.crawlDelay > 0 {
+		c.delay = c.robots.crawlDelay
+		if c.delay > websiteMaxCrawlDelay {
+			c.delay = websiteMaxCrawlDelay
+		}
+	}
+	return nil
+}
+
+// readSitemap returns the URLs of the website a sitemap lists, reading the sitemaps of a sitemap index
+func (c *websiteCrawler) readSitemap(ctx context.Context, sitemapURL string, nested int) ([]string, error) {
+	resp, err := c.get(ctx, sitemapURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", sitemapURL, resp.StatusCode)
+	}
+	data, err := readWebsiteBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(io.LimitReader(reader, websiteMaxBodySize)); err != nil {
+			return nil, err
+		}
+	}
+
+	var sitemap struct {
+		XMLName xml.Name
+		URLs    []struct {
+			Loc string `xml:"loc"`
+		} `xml:"url"`
+		Sitemaps []struct {
+			Loc string `xml:"loc"`
+		} `xml:"sitemap"`
+	}
+	if err := xml.Unmarshal(data, &sitemap); err != nil {
+		return nil, fmt.Errorf("%s is not a sitemap: %w", sitemapURL, err)
+	}
+	if sitemap.XMLName.Local != "urlset" && sitemap.XMLName.Local != "sitemapindex" {
+		return nil, fmt.Errorf("%s is not a sitemap", sitemapURL)
+	}
+
+	var urls []string
+	for _, entry := range sitemap.URLs {
+		if u, err := c.resolve(c.seed, entry.Loc); err == nil {
+			urls = append(urls, u)
+		}
+	}
+	for i, entry := range sitemap.Sitemaps {
+		if nested > 0 || i >= websiteMaxSitemaps {
+			break // Sitemap indexes do not nest
+		}
+		child, err := c.resolve(c.seed, entry.Loc)
+		if err != nil {
+			continue
+		}
+		// A sitemap that cannot be read leaves its pages to the links of the others
+		childURLs, err := c.readSitemap(ctx, child, nested+1)
+		if err != nil {
+			continue
+		}
+		urls = append(urls, childURLs...)
+	}
+	return urls, nil
+}
+
+// fetchPage fetches a page and extracts its main content and the links to follow. Documents the
+// knowledge base accepts as uploads, like PDFs, are extracted the same way.
+func (c *websiteCrawler) fetchPage(ctx context.Context, pageURL string) (crawledPage, []string) {
+	page := crawledPage{URL: pageURL}
+	header := http.Header{}
+	if previous, ok := c.previous[pageURL]; ok {
+		if previous.ETag != "" {
+			header.Set("If-None-Match", previous.ETag)
+		}
+		if previous.LastModified != "" {
+			header.Set("If-Modified-Since", previous.LastModified)
+		}
+	}
+
+	resp, err := c.get(ctx, pageURL, header)
+	if err != nil {
+		page.Err = err
+		return page, nil
+	}
+	defer resp.Body.Close()
+
+	page.ETag = resp.Header.Get("ETag")
+	page.LastModified = resp.Header.Get("Last-Modified")
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		page.NotModified = true
+		page.Store = c.included(resp.Request.URL)
+		return page, nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		page.Gone = true
+		return page, nil
+	case resp.StatusCode != http.StatusOK:
+		page.Err = fmt.Errorf("status %d", resp.StatusCode)
+		return page, nil
+	}
+
+	// Redirects within the website are stored under the URL they lead to
+	final := normalizeWebsiteURL(resp.Request.URL)
+	page.URL = final.String()
+
+	data, err := readWebsiteBody(resp)
+	if err != nil {
+		page.Err = err
+		return page, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/html" || mediaType == "application/xhtml+xml" || mediaType == "" && looksLikeHTML(data) {
+		return c.readHTMLPage(page, final, data)
+	}
+
+	if extractor, ok := FindFileExtractor(path.Base(final.Path), mediaType); ok && extractor.Name != "html" {
+		text, _, err := ExtractFileText(path.Base(final.Path), mediaType, data)
+		if err != nil {
+			page.Err = err
+			return page, nil
+		}
+		page.Title = path.Base(final.Path)
+		page.Text = text
+		page.Store = c.included(final)
+		return page, nil
+	}
+	// Images, archives and other files linked from the website are not stored
+	return page, nil
+}
+
+// readHTMLPage extracts the main content of an HTML page and its links, honoring robots meta tags
+func (c *websiteCrawler) readHTMLPage(page crawledPage, pageURL *url.URL, data []byte) (crawledPage, []string) {
+	if !utf8.Valid(data) {
+		data = []byte(strings.ToValidUTF8(string(data), "�"))
+	}
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		page.Err = err
+		return page, nil
+	}
+
+	// <meta name="robots" content="noindex, nofollow">, "none" is both
+	noIndex, noFollow := false, false
+	for _, meta := range findHTMLElements(doc, func(n *html.Node) bool { return n.DataAtom == atom.Meta }, 0) {
+		name := strings.ToLower(htmlAttr(meta, "name"))
+		if name != "robots" && name != strings.ToLower(websiteCrawlerAgent) {
+			continue
+		}
+		for _, directive := range strings.Split(strings.ToLower(htmlAttr(meta, "content")), ",") {
+			directive = strings.TrimSpace(directive)
+			noIndex = noIndex || directive == "noindex" || directive == "none"
+			noFollow = noFollow || directive == "nofollow" || directive == "none"
+		}
+	}
+
+	// Relative links resolve against <base href> when the page has one
+	base := pageURL
+	if node := findHTMLElement(doc, func(n *html.Node) bool { return n.DataAtom == atom.Base }); node != nil {
+		if href, err := pageURL.Parse(htmlAttr(node, "href")); err == nil {
+			base = href
+		}
+	}
+
+	var links []string
+	if !noFollow {
+		for _, anchor := range findHTMLElements(doc, func(n *html.Node) bool { return n.DataAtom == atom.A }, 0) {
+			if strings.Contains(strings.ToLower(htmlAttr(anchor, "rel")), "nofollow") {
+				continue
+			}
+			if link, err := c.resolve(base, htmlAttr(anchor, "href")); err == nil {
+				links = append(links, link)
+			}
+		}
+	}
+
+	title, text := htmlMainText(doc)
+	text = normalizeExtractedText(text)
+	page.Title = title
+	if title != "" && text != "" {
+		text = "# " + title + "\n\n" + text
+	}
+	page.Text = text
+	page.Store = !noIndex && c.included(pageURL)
+	return page, links
+}
+
+// get requests a URL as the crawler, waiting between requests as robots.txt asks
+func (c *websiteCrawler) get(ctx context.Context, target string, header http.Header) (*http.Response, error) {
+	if wait := c.delay - time.Since(c.lastHit); !c.lastHit.IsZero() && wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c.lastHit = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("User-Agent", websiteCrawlerUserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	return c.client.Do(req)
+}
+
+// websiteDialControl refuses connections to addresses websiteAddressAllowed does not allow
+func websiteDialControl(network, address string, _ syscall.RawConn) error {
+	addr, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errWebsiteAddressRefused, address)
+	}
+	if !websiteAddressAllowed(addr) {
+		return fmt.Errorf("%w: %s", errWebsiteAddressRefused, addr.Addr())
+	}
+	return nil
+}
+
+// isPublicAddress checks that an address is not loopback, private, link-local or unspecified
+func isPublicAddress(addr netip.AddrPort) bool {
+	ip := addr.Addr().Unmap()
+	return ip.IsValid() && !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() && !ip.IsUnspecified()
+}
+
+// resolve turns a link into an absolute, normalized URL of the website. Links to other websites,
+// other schemes and files the crawler cannot read are errors.
+func (c *websiteCrawler) resolve(base *url.URL, link string) (string, error) {
+	link = strings.TrimSpace(link)
+	if link == "" || strings.HasPrefix(link, "#") {
+		return "", errors.New("empty link")
+	}
+	target, err := base.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme %q", target.Scheme)
+	}
+	if !c.sameSite(target) {
+		return "", fmt.Errorf("link to another website %s", target.Host)
+	}
+	if websiteSkippedExtensions[strings.ToLower(path.Ext(target.Path))] {
+		return "", fmt.Errorf("link to a file the crawler cannot read")
+	}
+	return normalizeWebsiteURL(target).String(), nil
+}
+
+// sameSite checks if a URL is on the seed's host, with or without www
+func (c *websiteCrawler) sameSite(u *url.URL) bool {
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") == strings.TrimPrefix(strings.ToLower(c.seed.Hostname()), "www.")
+}
+
+// excluded checks if a URL matches one of the source's exclude patterns
+func (c *websiteCrawler) excluded(u *url.URL) bool {
+	return matchesWebsitePattern(c.exclude, u)
+}
+
+// included checks if a page is stored: it matches an include pattern, or the source has none
+func (c *websiteCrawler) included(u *url.URL) bool {
+	return len(c.include) == 0 || matchesWebsitePattern(c.include, u)
+}
+
+func (c *websiteCrawler) maxPages() int {
+	if c.source.MaxPages <= 0 {
+		return models.DefaultWebsiteMaxPages
+	}
+	return c.source.MaxPages
+}
+
+// parseWebsiteURL checks that a seed URL is an absolute http or https URL
+func parseWebsiteURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid seed URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("seed URL must be an http or https URL")
+	}
+	return normalizeWebsiteURL(u), nil
+}
+
+// checkWebsiteHost rejects a seed host that is, or resolves to, a private network address. A host
+// that cannot be resolved yet is accepted, the crawler checks every connection it makes anyway.
+func checkWebsiteHost(ctx context.Context, host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("seed URL must not point to a private network address")
+	}
+	var addrs []netip.Addr
+	if ip, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		addrs = []netip.Addr{ip}
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		addrs, _ = net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	}
+	for _, ip := range addrs {
+		if !websiteAddressAllowed(netip.AddrPortFrom(ip, 0)) {
+			return fmt.Errorf("seed URL must not point to a private network address")
+		}
+	}
+	return nil
+}
+
+// normalizeWebsiteURL drops the fragment and default port and lowercases the host, so one page is
+// crawled once however it is linked
+func normalizeWebsiteURL(u *url.URL) *url.URL {
+	normalized := *u
+	normalized.Fragment = ""
+	normalized.RawFragment = ""
+	normalized.Scheme = strings.ToLower(normalized.Scheme)
+	normalized.Host = strings.ToLower(normalized.Host)
+	if port := normalized.Port(); port == "80" && normalized.Scheme == "http" || port == "443" && normalized.Scheme == "https" {
+		normalized.Host = normalized.Hostname()
+	}
+	if normalized.Path == "" {
+		normalized.Path = "/"
+	}
+	normalized.ForceQuery = false
+	return &normalized
+}
+
+// websitePattern is a compiled include or exclude pattern of a website source
+type websitePattern struct {
+	re       *regexp.Regexp
+	pathOnly bool // The pattern starts with / and matches the path and query
+}
+
+// compileWebsitePatterns turns the source's URL patterns into regular expressions
+func compileWebsitePatterns(patterns []string) ([]websitePattern, error) {
+	compiled := make([]websitePattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile("^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, websitePattern{re: re, pathOnly: strings.HasPrefix(pattern, "/")})
+	}
+	return compiled, nil
+}
+
+// matchesWebsitePattern checks a URL against patterns
+func matchesWebsitePattern(patterns []websitePattern, u *url.URL) bool {
+	for _, pattern := range patterns {
+		subject := u.String()
+		if pattern.pathOnly {
+			subject = u.RequestURI()
+		}
+		if pattern.re.MatchString(subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSitemapURL checks if a seed URL names a sitemap rather than a page
+func isSitemapURL(u *url.URL) bool {
+	name := strings.ToLower(path.Base(u.Path))
+	return strings.HasSuffix(name, ".xml") || strings.HasSuffix(name, ".xml.gz") || strings.Contains(name, "sitemap")
+}
+
+// readWebsiteBody reads a response up to the crawler's size limit
+func readWebsiteBody(resp *http.Response) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, websiteMaxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if len(data) > websiteMaxBodySize {
+		return nil, fmt.Errorf("response larger than %d MB", websiteMaxBodySize/1024/1024)
+	}
+	return data, nil
+}
+
+// looksLikeHTML sniffs responses sent without a content type
+func looksLikeHTML(data []byte) bool {
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	return mediaType == "text/html"
+}
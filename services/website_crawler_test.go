@@ -0,0 +1,388 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"facebook-bot/models"
+)
+
+// testWebsite serves HTML pages and counts the requests for each path
+type testWebsite struct {
+	server    *httptest.Server
+	mu        sync.Mutex
+	pages     map[string]string
+	requests  map[string]int
+	userAgent string
+}
+
+func newTestWebsite(t *testing.T) *testWebsite {
+	t.Helper()
+	site := &testWebsite{pages: make(map[string]string), requests: make(map[string]int)}
+	site.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site.mu.Lock()
+		site.requests[r.URL.Path]++
+		site.userAgent = r.UserAgent()
+		page, ok := site.pages[r.URL.Path]
+		site.mu.Unlock()
+
+		switch {
+		case !ok:
+			http.NotFound(w, r)
+		case strings.HasPrefix(page, "redirect:"):
+			http.Redirect(w, r, strings.TrimPrefix(page, "redirect:"), http.StatusFound)
+		default:
+			etag := fmt.Sprintf(`"%x"`, sha256.Sum256([]byte(page)))
+			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			if strings.HasSuffix(r.URL.Path, ".txt") {
+				w.Header().Set("Content-Type", "text/plain")
+			} else if strings.HasSuffix(r.URL.Path, ".xml") {
+				w.Header().Set("Content-Type", "application/xml")
+			} else {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			}
+			w.Write([]byte(page))
+		}
+	}))
+	t.Cleanup(site.server.Close)
+	// Keep the tests fast, robots.txt sets the delay between requests
+	site.set("/robots.txt", "User-agent: *\nCrawl-delay: 0.001\n")
+	return site
+}
+
+func (s *testWebsite) set(path, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages[path] = content
+}
+
+func (s *testWebsite) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func (s *testWebsite) address() netip.AddrPort {
+	return netip.MustParseAddrPort(s.server.Listener.Addr().String())
+}
+
+// allowWebsiteAddresses lets the crawler connect to the given test servers only
+func allowWebsiteAddresses(t *testing.T, sites ...*testWebsite) {
+	t.Helper()
+	previous := websiteAddressAllowed
+	websiteAddressAllowed = func(addr netip.AddrPort) bool {
+		for _, site := range sites {
+			if addr == site.address() {
+				return true
+			}
+		}
+		return false
+	}
+	t.Cleanup(func() { websiteAddressAllowed = previous })
+}
+
+func crawlTestWebsite(t *testing.T, source *models.WebsiteSource, previous map[string]models.WebsitePage) (map[string]crawledPage, websiteCrawlStats, error) {
+	t.Helper()
+	crawler, err := newWebsiteCrawler(source, previous)
+	if err != nil {
+		t.Fatalf("newWebsiteCrawler() error = %v", err)
+	}
+	pages := make(map[string]crawledPage)
+	stats, err := crawler.crawl(context.Background(), func(page crawledPage) {
+		pages[page.URL] = page
+	})
+	return pages, stats, err
+}
+
+func TestWebsiteCrawl(t *testing.T) {
+	site := newTestWebsite(t)
+	allowWebsiteAddresses(t, site)
+	site.set("/robots.txt", "User-agent: *\nDisallow: /admin\nCrawl-delay: 0.001\n")
+	site.set("/", `<html><head><title>Shop</title></head><body>
+		<nav><a href="/faq#returns">FAQ</a> <a href="/shipping">Shipping</a> <a href="/admin/orders">Orders</a>
+		<a href="/blog/sale">Sale</a> <a href="/logo.png">Logo</a> <a href="https://other.example/">Partner</a>
+		<a href="/partners" rel="nofollow">Partners</a> <a href="mailto:shop@example.com">Mail</a></nav>
+		<main><p>Phones and accessories in Tbilisi.</p></main></body></html>`)
+	site.set("/faq", `<html><head><title>FAQ</title></head><body><main><p>Returns are accepted within 14 days.</p>
+		<a href="/deep">Deep</a></main></body></html>`)
+	site.set("/shipping", `<html><head><title>Shipping</title><meta name="robots" content="noindex"></head>
+		<body><main><p>Delivery to Batumi costs 15 GEL.</p></main></body></html>`)
+	site.set("/admin/orders", `<p>Internal order list</p>`)
+	site.set("/blog/sale", `<p>Summer sale</p>`)
+	site.set("/partners", `<p>Partners</p>`)
+	site.set("/deep", `<p>Two links away</p>`)
+
+	base := site.server.URL
+	source := &models.WebsiteSource{SeedURL: base + "/", ExcludePatterns: []string{"/blog/*"}, MaxDepth: 1}
+	pages, stats, err := crawlTestWebsite(t, source, nil)
+	if err != nil {
+		t.Fatalf("crawl error = %v", err)
+	}
+
+	if stats.Fetched != 3 || stats.Skipped != 2 || stats.Truncated {
+		t.Errorf("stats = %+v, want 3 fetched and the admin and blog links skipped", stats)
+	}
+	for _, path := range []string{"/admin/orders", "/blog/sale", "/partners", "/logo.png", "/deep"} {
+		if site.count(path) != 0 {
+			t.Errorf("crawler fetched %s", path)
+		}
+	}
+	if !strings.HasPrefix(site.userAgent, websiteCrawlerAgent) {
+		t.Errorf("user agent = %q", site.userAgent)
+	}
+
+	home := pages[base+"/"]
+	if !home.Store || !strings.HasPrefix(home.Text, "# Shop\n\n") || !strings.Contains(home.Text, "Phones and accessories") {
+		t.Errorf("home page = %+v", home)
+	}
+	if faq := pages[base+"/faq"]; !faq.Store || !strings.Contains(faq.Text, "14 days") {
+		t.Errorf("faq page = %+v", faq)
+	}
+	if shipping := pages[base+"/shipping"]; shipping.Store || shipping.ETag == "" {
+		t.Errorf("noindex page = %+v, want fetched but not stored", shipping)
+	}
+
+	// Pages fetched before are requested conditionally
+	previous := map[string]models.WebsitePage{base + "/faq": {URL: base + "/faq", ETag: pages[base+"/faq"].ETag}}
+	site.set("/", `<html><body><main><p>Phones.</p><a href="/faq">FAQ</a></main></body></html>`)
+	pages, _, err = crawlTestWebsite(t, source, previous)
+	if err != nil {
+		t.Fatalf("second crawl error = %v", err)
+	}
+	if faq := pages[base+"/faq"]; !faq.NotModified || !faq.Store {
+		t.Errorf("unchanged page = %+v, want not modified", faq)
+	}
+}
+
+func TestWebsiteCrawlSitemap(t *testing.T) {
+	site := newTestWebsite(t)
+	allowWebsiteAddresses(t, site)
+	base := site.server.URL
+	site.set("/sitemap.xml", `<?xml version="1.0"?><sitemapindex><sitemap><loc>`+base+`/pages.xml</loc></sitemap>
+		<sitemap><loc>`+base+`/missing.xml</loc></sitemap></sitemapindex>`)
+	site.set("/pages.xml", `<?xml version="1.0"?><urlset><url><loc>`+base+`/a</loc></url><url><loc>/b</loc></url>
+		<url><loc>https://other.example/c</loc></url></urlset>`)
+	site.set("/a", `<p>Page A <a href="/c">C</a></p>`)
+	site.set("/b", `<p>Page B</p>`)
+	site.set("/c", `<p>Page C</p>`)
+
+	pages, stats, err := crawlTestWebsite(t, &models.WebsiteSource{SeedURL: base + "/sitemap.xml", MaxPages: 1}, nil)
+	if err != nil {
+		t.Fatalf("crawl error = %v", err)
+	}
+	if len(pages) != 1 || !stats.Truncated || stats.Skipped != 1 {
+		t.Errorf("pages = %v, stats = %+v, want the first sitemap page and the crawl truncated", pages, stats)
+	}
+	if _, ok := pages[base+"/a"]; !ok || site.count("/c") != 0 {
+		t.Errorf("pages = %v, want /a only at depth 0", pages)
+	}
+}
+
+func TestWebsiteCrawlRobots(t *testing.T) {
+	site := newTestWebsite(t)
+	allowWebsiteAddresses(t, site)
+	site.set("/", `<p>Home</p>`)
+	site.set("/robots.txt", "redirect:/robots-error")
+
+	_, _, err := crawlTestWebsite(t, &models.WebsiteSource{SeedURL: site.server.URL + "/"}, nil)
+	if err != nil {
+		t.Errorf("robots.txt redirecting to a missing page should allow everything, got %v", err)
+	}
+
+	site.set("/robots.txt", "User-agent: *\nDisallow: /\n")
+	if _, _, err = crawlTestWebsite(t, &models.WebsiteSource{SeedURL: site.server.URL + "/"}, nil); err == nil {
+		t.Error("crawl of a seed robots.txt disallows should fail")
+	}
+	if site.count("/") != 1 {
+		t.Errorf("seed fetched %d times, want only by the first crawl", site.count("/"))
+	}
+}
+
+func TestWebsiteCrawlerRefusesPrivateAddresses(t *testing.T) {
+	site := newTestWebsite(t)
+	site.set("/", `<p>Internal service</p>`)
+
+	// The test server listens on loopback, which the crawler refuses by default
+	_, _, err := crawlTestWebsite(t, &models.WebsiteSource{SeedURL: site.server.URL + "/"}, nil)
+	if !errors.Is(err, errWebsiteRobotsUnavailable) || !strings.Contains(err.Error(), errWebsiteAddressRefused.Error()) {
+		t.Errorf("crawl error = %v, want the connection refused", err)
+	}
+	if site.count("/robots.txt") != 0 || site.count("/") != 0 {
+		t.Error("crawler reached a loopback server")
+	}
+}
+
+func TestWebsiteCrawlerRefusesRedirectsAndSitemapsToPrivateAddresses(t *testing.T) {
+	public := newTestWebsite(t)
+	internal := newTestWebsite(t)
+	internal.set("/secret", `<p>Cloud metadata</p>`)
+	// Only the public site may be reached, the internal one shares its host on another port, so
+	// same-site checks alone do not stop the crawler
+	allowWebsiteAddresses(t, public)
+
+	public.set("/", "redirect:"+internal.server.URL+"/secret")
+	pages, _, err := crawlTestWebsite(t, &models.WebsiteSource{SeedURL: public.server.URL + "/"}, nil)
+	if err != nil {
+		t.Fatalf("crawl error = %v", err)
+	}
+	if page := pages[public.server.URL+"/"]; page.Err == nil || !strings.Contains(page.Err.Error(), errWebsiteAddressRefused.Error()) {
+		t.Errorf("redirected page = %+v, want the connection refused", page)
+	}
+
+	public.set("/sitemap.xml", `<?xml version="1.0"?><urlset><url><loc>`+internal.server.URL+`/secret</loc></url></urlset>`)
+	pages, _, err = crawlTestWebsite(t, &models.WebsiteSource{SeedURL: public.server.URL + "/sitemap.xml"}, nil)
+	if err != nil {
+		t.Fatalf("sitemap crawl error = %v", err)
+	}
+	if page := pages[internal.server.URL+"/secret"]; page.Err == nil || !strings.Contains(page.Err.Error(), errWebsiteAddressRefused.Error()) {
+		t.Errorf("sitemap page = %+v, want the connection refused", page)
+	}
+
+	if internal.count("/secret") != 0 || internal.count("/robots.txt") != 0 {
+		t.Error("crawler reached the internal server")
+	}
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{"93.184.215.14:443", true},
+		{"[2606:2800:21f:cb07:6820:80da:af6b:8b2c]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"10.1.2.3:80", false},
+		{"172.16.0.1:80", false},
+		{"192.168.1.10:8080", false},
+		{"[fd00::1]:80", false},
+		{"169.254.169.254:80", false},
+		{"[fe80::1]:80", false},
+		{"0.0.0.0:80", false},
+		{"[::]:80", false},
+		{"[::ffff:10.0.0.1]:80", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicAddress(netip.MustParseAddrPort(tt.address)); got != tt.want {
+			t.Errorf("isPublicAddress(%s) = %v, want %v", tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestValidateWebsiteSource(t *testing.T) {
+	source := &models.WebsiteSource{SeedURL: "HTTPS://93.184.215.14:443/faq#top", IncludePatterns: []string{"/faq/*"}}
+	if err := ValidateWebsiteSource(source); err != nil {
+		t.Fatalf("ValidateWebsiteSource() error = %v", err)
+	}
+	if source.SeedURL != "https://93.184.215.14/faq" || source.Name != "93.184.215.14" ||
+		source.MaxPages != models.DefaultWebsiteMaxPages || source.RefreshHours != models.DefaultWebsiteRefreshHours {
+		t.Errorf("validated source = %+v", source)
+	}
+
+	invalid := []struct {
+		name   string
+		source models.WebsiteSource
+	}{
+		{"ftp seed", models.WebsiteSource{SeedURL: "ftp://93.184.215.14/"}},
+		{"relative seed", models.WebsiteSource{SeedURL: "/faq"}},
+		{"localhost", models.WebsiteSource{SeedURL: "http://localhost:8080/"}},
+		{"localhost subdomain", models.WebsiteSource{SeedURL: "http://admin.localhost/"}},
+		{"loopback", models.WebsiteSource{SeedURL: "http://127.0.0.1/"}},
+		{"loopback ipv6", models.WebsiteSource{SeedURL: "http://[::1]:3000/"}},
+		{"private", models.WebsiteSource{SeedURL: "http://10.0.0.5/"}},
+		{"mapped private", models.WebsiteSource{SeedURL: "http://[::ffff:192.168.1.1]/"}},
+		{"metadata service", models.WebsiteSource{SeedURL: "http://169.254.169.254/latest/meta-data"}},
+		{"unspecified", models.WebsiteSource{SeedURL: "http://0.0.0.0/"}},
+		{"depth", models.WebsiteSource{SeedURL: "https://93.184.215.14/", MaxDepth: models.MaxWebsiteMaxDepth + 1}},
+		{"pages", models.WebsiteSource{SeedURL: "https://93.184.215.14/", MaxPages: models.MaxWebsiteMaxPages + 1}},
+		{"refresh", models.WebsiteSource{SeedURL: "https://93.184.215.14/", RefreshHours: -1}},
+		{"channel", models.WebsiteSource{SeedURL: "https://93.184.215.14/", Channels: []string{"sms"}}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateWebsiteSource(&tt.source); !errors.Is(err, ErrInvalidWebsiteSource) {
+				t.Errorf("ValidateWebsiteSource(%q) error = %v, want ErrInvalidWebsiteSource", tt.source.SeedURL, err)
+			}
+		})
+	}
+}
+
+func TestWebsitePatterns(t *testing.T) {
+	patterns, err := compileWebsitePatterns([]string{"/faq/*", "*/products/*?color=*", " "})
+	if err != nil || len(patterns) != 2 {
+		t.Fatalf("compileWebsitePatterns() = %v, %v", patterns, err)
+	}
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://shop.example/faq/returns", true},
+		{"https://shop.example/faq", false},
+		{"https://shop.example/en/faq/returns", false}, // Path patterns are anchored at the start
+		{"https://shop.example/en/products/phone?color=red", true},
+		{"https://shop.example/en/products/phone", false},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := matchesWebsitePattern(patterns, u); got != tt.want {
+			t.Errorf("matchesWebsitePattern(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestWebsiteCrawlerResolve(t *testing.T) {
+	crawler, err := newWebsiteCrawler(&models.WebsiteSource{SeedURL: "https://www.shop.example/"}, nil)
+	if err != nil {
+		t.Fatalf("newWebsiteCrawler() error = %v", err)
+	}
+	base, _ := url.Parse("https://www.shop.example/en/catalog/")
+
+	tests := []struct {
+		link    string
+		want    string
+		wantErr bool
+	}{
+		{"phones?page=2#top", "https://www.shop.example/en/catalog/phones?page=2", false},
+		{"/faq", "https://www.shop.example/faq", false},
+		{"HTTPS://SHOP.EXAMPLE:443", "https://shop.example/", false}, // Same site without www
+		{"https://blog.shop.example/", "", true},
+		{"#reviews", "", true},
+		{"javascript:void(0)", "", true},
+		{"/images/phone.JPG", "", true},
+		{"/catalog.pdf", "https://www.shop.example/catalog.pdf", false},
+	}
+	for _, tt := range tests {
+		got, err := crawler.resolve(base, tt.link)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("resolve(%q) = %q, %v, want %q", tt.link, got, err, tt.want)
+		}
+	}
+}
+
+func TestIsSitemapURL(t *testing.T) {
+	for raw, want := range map[string]bool{
+		"https://shop.example/sitemap.xml":       true,
+		"https://shop.example/sitemap_index":     true,
+		"https://shop.example/pages.xml.gz":      true,
+		"https://shop.example/":                  false,
+		"https://shop.example/sitemaps/faq.html": false,
+	} {
+		u, _ := url.Parse(raw)
+		if got := isSitemapURL(u); got != want {
+			t.Errorf("isSitemapURL(%s) = %v, want %v", raw, got, want)
+		}
+	}
+}
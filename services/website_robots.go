@@ -0,0 +1,142 @@
+package services
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsRules are the robots.txt rules that apply to the website crawler
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// parseRobotsTxt reads the rules of the groups naming the crawler, or of the * groups when none do,
+// following RFC 9309
+func parseRobotsTxt(data []byte, agent string) *robotsRules {
+	agent = strings.ToLower(agent)
+
+	type group struct {
+		agents     []string
+		rules      []robotsRule
+		crawlDelay time.Duration
+	}
+	var groups []*group
+	var current *group
+	inAgents := false // Consecutive user-agent lines share one group
+
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				current = &group{}
+				groups = append(groups, current)
+				inAgents = true
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inAgents = false
+			if current == nil {
+				continue
+			}
+			// An empty disallow allows everything, same as no rule
+			if value != "" {
+				current.rules = append(current.rules, robotsRule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			inAgents = false
+			if current == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		default:
+			// Sitemap and unknown lines do not end the group
+		}
+	}
+
+	// Groups naming the crawler take precedence over the * groups, matching groups are merged
+	rules := &robotsRules{}
+	for _, wanted := range []string{agent, "*"} {
+		for _, g := range groups {
+			for _, name := range g.agents {
+				if name == wanted {
+					rules.rules = append(rules.rules, g.rules...)
+					if g.crawlDelay > rules.crawlDelay {
+						rules.crawlDelay = g.crawlDelay
+					}
+					break
+				}
+			}
+		}
+		if len(rules.rules) > 0 || rules.crawlDelay > 0 {
+			break
+		}
+	}
+	return rules
+}
+
+// allowed checks if the crawler may fetch a path (with its query). The rule with the longest matching
+// pattern decides, allow wins ties.
+func (r *robotsRules) allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+	allow := true
+	longest := -1
+	for _, rule := range r.rules {
+		if !robotsPatternMatches(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > longest || len(rule.pattern) == longest && rule.allow {
+			allow = rule.allow
+			longest = len(rule.pattern)
+		}
+	}
+	return allow
+}
+
+// robotsPatternMatches matches a robots.txt path pattern, where * matches any characters and a
+// trailing $ anchors the pattern at the end of the path
+func robotsPatternMatches(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			// The last part must end the path
+			return strings.HasSuffix(rest, part)
+		}
+		j := strings.Index(rest, part)
+		if j < 0 {
+			return false
+		}
+		rest = rest[j+len(part):]
+	}
+	return !anchored || rest == ""
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRobotsTxtGroups(t *testing.T) {
+	robots := []byte(`# Shop robots
+User-agent: *
+Disallow: /admin
+Crawl-delay: 1
+
+User-agent: OtherBot
+User-agent: FacebookBot-Website-Crawler
+Disallow: /private # staff only
+Allow: /private/faq
+Crawl-delay: 0.5
+Sitemap: https://shop.example/sitemap.xml
+Disallow: /tmp
+`)
+
+	rules := parseRobotsTxt(robots, websiteCrawlerAgent)
+	if rules.crawlDelay != 500*time.Millisecond {
+		t.Errorf("crawl delay = %v, want the crawler group's 500ms", rules.crawlDelay)
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/", true},
+		{"/admin", true}, // Only the * group disallows it, the crawler's own group takes precedence
+		{"/private/orders", false},
+		{"/private/faq", true},
+		{"/tmp/cache", false}, // Sitemap lines do not end the group
+	}
+	for _, tt := range tests {
+		if got := rules.allowed(tt.path); got != tt.want {
+			t.Errorf("allowed(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	other := parseRobotsTxt(robots, "SomeBot")
+	if other.allowed("/admin/orders") || !other.allowed("/private/orders") || other.crawlDelay != time.Second {
+		t.Errorf("other agents should get the * group, got %+v", other)
+	}
+}
+
+func TestParseRobotsTxtEmptyAndMissingRules(t *testing.T) {
+	var missing *robotsRules
+	if !missing.allowed("/anything") {
+		t.Error("no robots.txt should allow everything")
+	}
+
+	rules := parseRobotsTxt([]byte("User-agent: *\nDisallow:\n"), websiteCrawlerAgent)
+	if !rules.allowed("/admin") {
+		t.Error("an empty disallow should allow everything")
+	}
+
+	rules = parseRobotsTxt([]byte("Disallow: /\nUser-agent: *\nAllow: /\n"), websiteCrawlerAgent)
+	if !rules.allowed("/page") {
+		t.Error("rules before the first user-agent line should be ignored")
+	}
+}
+
+func TestRobotsRulesAllowed(t *testing.T) {
+	rules := parseRobotsTxt([]byte(`User-agent: *
+Disallow: /shop
+Allow: /shop/
+Disallow: /*.pdf$
+Disallow: /search*q=
+Allow: /page
+Disallow: /page
+`), websiteCrawlerAgent)
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/shop", false},
+		{"/shop/phones", true}, // The longer allow wins
+		{"/catalog.pdf", false},
+		{"/catalog.pdf?download=1", true}, // $ anchors the pattern at the end
+		{"/search?page=2&q=phone", false},
+		{"/search?page=2", true},
+		{"/page", true}, // Allow wins ties
+	}
+	for _, tt := range tests {
+		if got := rules.allowed(tt.path); got != tt.want {
+			t.Errorf("allowed(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
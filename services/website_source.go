@@ -0,0 +1,679 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"facebook-bot/models"
+)
+
+// Website source settings
+const (
+	websiteCrawlTimeout       = 30 * time.Minute
+	websiteHeartbeatInterval  = 30 * time.Second
+	websiteStaleAfter         = 2 * time.Minute // A crawl without a heartbeat for this long is taken over
+	websiteSchedulerInterval  = time.Minute
+	websiteMaxRecordedErrors  = 10
+	websiteMaxPatternsPerList = 50
+)
+
+// Errors returned by website sources
+var (
+	ErrWebsitePageNotFound  = errors.New("page not found")
+	ErrWebsiteCrawlRunning  = errors.New("the website is already being crawled")
+	ErrInvalidWebsiteSource = errors.New("invalid website source")
+)
+
+// ValidateWebsiteSource checks a source's settings, refuses seeds on private network addresses and
+// fills in the default limits
+func ValidateWebsiteSource(source *models.WebsiteSource) error {
+	seed, err := parseWebsiteURL(source.SeedURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWebsiteSource, err)
+	}
+	if err := checkWebsiteHost(context.Background(), seed.Hostname()); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWebsiteSource, err)
+	}
+	source.SeedURL = seed.String()
+	if source.Name == "" {
+		source.Name = seed.Host
+	}
+
+	if len(source.IncludePatterns) > websiteMaxPatternsPerList || len(source.ExcludePatterns) > websiteMaxPatternsPerList {
+		return fmt.Errorf("%w: at most %d patterns per list", ErrInvalidWebsiteSource, websiteMaxPatternsPerList)
+	}
+	for _, patterns := range [][]string{source.IncludePatterns, source.ExcludePatterns} {
+		if _, err := compileWebsitePatterns(patterns); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidWebsiteSource, err)
+		}
+	}
+
+	switch {
+	case source.MaxDepth < 0 || source.MaxDepth > models.MaxWebsiteMaxDepth:
+		return fmt.Errorf("%w: max_depth must be between 0 and %d", ErrInvalidWebsiteSource, models.MaxWebsiteMaxDepth)
+	case source.MaxPages < 0 || source.MaxPages > models.MaxWebsiteMaxPages:
+		return fmt.Errorf("%w: max_pages must be between 1 and %d", ErrInvalidWebsiteSource, models.MaxWebsiteMaxPages)
+	case source.RefreshHours < 0 || source.RefreshHours > 0 && source.RefreshHours < models.MinWebsiteRefreshHours:
+		return fmt.Errorf("%w: refresh_hours must be at least %d", ErrInvalidWebsiteSource, models.MinWebsiteRefreshHours)
+	}
+	if source.MaxPages == 0 {
+		source.MaxPages = models.DefaultWebsiteMaxPages
+	}
+	if source.RefreshHours == 0 {
+		source.RefreshHours = models.DefaultWebsiteRefreshHours
+	}
+
+	for _, channel := range source.Channels {
+		if ch := normalizeChannel(channel); ch != "facebook" && ch != "messenger" {
+			return fmt.Errorf("%w: unknown channel %q", ErrInvalidWebsiteSource, channel)
+		}
+	}
+	return nil
+}
+
+// CreateWebsiteSource stores a new website source of a company page. It is crawled right away by
+// the scheduler, or by StartWebsiteCrawl.
+func CreateWebsiteSource(ctx context.Context, source *models.WebsiteSource) error {
+	if err := ValidateWebsiteSource(source); err != nil {
+		return err
+	}
+	company, err := GetCompanyByID(ctx, source.CompanyID)
+	if err != nil {
+		return fmt.Errorf("failed to load company: %w", err)
+	}
+	if _, err := GetPageConfig(company, source.PageID); err != nil {
+		return ErrWebsitePageNotFound
+	}
+
+	now := time.Now()
+	source.ID = primitive.NilObjectID
+	source.Status = models.WebsiteStatusPending
+	source.LastCrawl = nil
+	source.NextCrawlAt = now
+	source.CreatedAt = now
+	source.UpdatedAt = now
+
+	result, err := GetDatabase().Collection("website_sources").InsertOne(ctx, source)
+	if err != nil {
+		return fmt.Errorf("failed to create website source: %w", err)
+	}
+	source.ID = result.InsertedID.(primitive.ObjectID)
+
+	slog.Info("Website source created",
+		"sourceID", source.ID.Hex(),
+		"companyID", source.CompanyID,
+		"pageID", source.PageID,
+		"seedURL", source.SeedURL)
+	return nil
+}
+
+// UpdateWebsiteSource saves a source's settings. Changed crawl settings are applied by a crawl started
+// right away; changed channels and activation apply to the stored pages at once.
+func UpdateWebsiteSource(ctx context.Context, source *models.WebsiteSource) error {
+	if err := ValidateWebsiteSource(source); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	source.UpdatedAt = now
+	update := bson.M{
+		"name":             source.Name,
+		"seed_url":         source.SeedURL,
+		"include_patterns": source.IncludePatterns,
+		"exclude_patterns": source.ExcludePatterns,
+		"max_depth":        source.MaxDepth,
+		"max_pages":        source.MaxPages,
+		"refresh_hours":    source.RefreshHours,
+		"channels":         source.Channels,
+		"is_active":        source.IsActive,
+		"updated_at":       now,
+	}
+
+	var previous models.WebsiteSource
+	err := GetDatabase().Collection("website_sources").FindOneAndUpdate(ctx,
+		bson.M{"_id": source.ID, "company_id": source.CompanyID},
+		bson.M{"$set": update}).Decode(&previous)
+	if err != nil {
+		return fmt.Errorf("failed to update website source: %w", err)
+	}
+
+	if source.SeedURL != previous.SeedURL || source.MaxDepth != previous.MaxDepth || source.MaxPages != previous.MaxPages ||
+		strings.Join(source.IncludePatterns, "\n") != strings.Join(previous.IncludePatterns, "\n") ||
+		strings.Join(source.ExcludePatterns, "\n") != strings.Join(previous.ExcludePatterns, "\n") {
+		source.NextCrawlAt = now
+		if _, err := GetDatabase().Collection("website_sources").UpdateOne(ctx,
+			bson.M{"_id": source.ID},
+			bson.M{"$set": bson.M{"next_crawl_at": now}}); err != nil {
+			return fmt.Errorf("failed to schedule crawl: %w", err)
+		}
+	}
+
+	filter := websiteDocumentsFilter(source, "")
+	if _, err := database.Collection("vector_documents").UpdateMany(ctx, filter, bson.M{"$set": bson.M{
+		"is_active":  source.IsActive,
+		"channels":   channelMapOf(source.Channels),
+		"updated_at": now,
+	}}); err != nil {
+		return fmt.Errorf("failed to update website documents: %w", err)
+	}
+	syncVectorIndex(ctx, filter)
+	return nil
+}
+
+// DeleteWebsiteSource deletes a source with the documents crawled from it. Returns the number of
+// documents deleted, and ErrWebsiteCrawlRunning while the source is being crawled.
+func DeleteWebsiteSource(ctx context.Context, sourceID, companyID string) (int64, error) {
+	source, err := GetWebsiteSource(ctx, sourceID, companyID)
+	if err != nil || source == nil {
+		return 0, err
+	}
+	// A running crawl would store its pages again
+	if source.Status == models.WebsiteStatusCrawling && time.Since(source.HeartbeatAt) < websiteStaleAfter {
+		return 0, ErrWebsiteCrawlRunning
+	}
+
+	deleted, err := deleteWebsiteDocuments(ctx, websiteDocumentsFilter(source, ""))
+	if err != nil {
+		return 0, err
+	}
+	if _, err := GetDatabase().Collection("website_pages").DeleteMany(ctx, bson.M{"source_id": source.ID}); err != nil {
+		return deleted, fmt.Errorf("failed to delete website pages: %w", err)
+	}
+	if _, err := GetDatabase().Collection("website_sources").DeleteOne(ctx, bson.M{"_id": source.ID}); err != nil {
+		return deleted, fmt.Errorf("failed to delete website source: %w", err)
+	}
+
+	slog.Info("Website source deleted", "sourceID", sourceID, "pageID", source.PageID, "documents", deleted)
+	return deleted, nil
+}
+
+// GetWebsiteSource retrieves a website source by ID for a company. Returns nil when it does not exist.
+func GetWebsiteSource(ctx context.Context, sourceID, companyID string) (*models.WebsiteSource, error) {
+	objectID, err := primitive.ObjectIDFromHex(sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid website source ID")
+	}
+
+	var source models.WebsiteSource
+	err = GetDatabase().Collection("website_sources").FindOne(ctx, bson.M{
+		"_id":        objectID,
+		"company_id": companyID,
+	}).Decode(&source)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &source, nil
+}
+
+// GetWebsiteSources lists a company's website sources, newest first. pageID is an optional filter.
+func GetWebsiteSources(ctx context.Context, companyID, pageID string) ([]models.WebsiteSource, error) {
+	filter := bson.M{"company_id": companyID}
+	if pageID != "" {
+		filter["page_id"] = pageID
+	}
+
+	cursor, err := GetDatabase().Collection("website_sources").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sources := []models.WebsiteSource{}
+	if err := cursor.All(ctx, &sources); err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+// GetWebsitePages lists the pages stored from a website source, by URL
+func GetWebsitePages(ctx context.Context, sourceID primitive.ObjectID) ([]models.WebsitePage, error) {
+	cursor, err := GetDatabase().Collection("website_pages").Find(ctx, bson.M{"source_id": sourceID},
+		options.Find().SetSort(bson.D{{Key: "url", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	pages := []models.WebsitePage{}
+	if err := cursor.All(ctx, &pages); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// StartWebsiteCrawl claims a source for a crawl to run now with RunWebsiteCrawl. Returns
+// ErrWebsiteCrawlRunning when another crawl of it is in progress and nil when it does not exist.
+func StartWebsiteCrawl(ctx context.Context, sourceID, companyID string) (*models.WebsiteSource, error) {
+	objectID, err := primitive.ObjectIDFromHex(sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid website source ID")
+	}
+
+	source, err := claimWebsiteCrawl(ctx, bson.M{
+		"_id":        objectID,
+		"company_id": companyID,
+		"$or": bson.A{
+			bson.M{"status": bson.M{"$ne": models.WebsiteStatusCrawling}},
+			bson.M{"heartbeat_at": bson.M{"$lt": time.Now().Add(-websiteStaleAfter)}},
+		},
+	})
+	if err != nil || source != nil {
+		return source, err
+	}
+
+	existing, err := GetWebsiteSource(ctx, sourceID, companyID)
+	if err != nil || existing == nil {
+		return nil, err
+	}
+	return existing, ErrWebsiteCrawlRunning
+}
+
+// claimWebsiteCrawl marks the first source matching filter as crawling. Returns nil when none matches.
+func claimWebsiteCrawl(ctx context.Context, filter bson.M) (*models.WebsiteSource, error) {
+	var source models.WebsiteSource
+	err := GetDatabase().Collection("website_sources").FindOneAndUpdate(ctx, filter,
+		bson.M{"$set": bson.M{"status": models.WebsiteStatusCrawling, "heartbeat_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&source)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &source, nil
+}
+
+// RunWebsiteCrawl crawls a claimed source and brings its documents up to date: new and changed pages
+// are chunked and embedded, unchanged ones are kept as they are and pages gone from the website are
+// deleted. The crawl's summary is saved on the source with the time of the next refresh.
+func RunWebsiteCrawl(ctx context.Context, source *models.WebsiteSource) error {
+	ctx, cancel := context.WithTimeout(ctx, websiteCrawlTimeout)
+	defer cancel()
+
+	// Other instances take the crawl over when the heartbeat stops
+	go func() {
+		ticker := time.NewTicker(websiteHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := GetDatabase().Collection("website_sources").UpdateOne(ctx,
+					bson.M{"_id": source.ID},
+					bson.M{"$set": bson.M{"heartbeat_at": time.Now()}}); err != nil && ctx.Err() == nil {
+					slog.Warn("Failed to refresh website crawl heartbeat", "sourceID", source.ID.Hex(), "error", err)
+				}
+			}
+		}
+	}()
+
+	crawl := &models.WebsiteCrawl{StartedAt: time.Now()}
+	slog.Info("Website crawl started",
+		"sourceID", source.ID.Hex(),
+		"pageID", source.PageID,
+		"seedURL", source.SeedURL)
+
+	err := crawlWebsiteSource(ctx, source, crawl)
+	return finishWebsiteCrawl(source, crawl, err)
+}
+
+// crawlWebsiteSource crawls a source, storing what changed as pages arrive
+func crawlWebsiteSource(ctx context.Context, source *models.WebsiteSource, crawl *models.WebsiteCrawl) error {
+	// Without an embedder every page would fail, so the crawl does not start
+	pageConfig, err := embeddingPageConfig(ctx, source.CompanyID, source.PageID)
+	if err != nil {
+		return err
+	}
+	if _, err := PageEmbedder(pageConfig); err != nil {
+		return err
+	}
+
+	stored, err := GetWebsitePages(ctx, source.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load website pages: %w", err)
+	}
+	previous := make(map[string]models.WebsitePage, len(stored))
+	for _, page := range stored {
+		previous[page.URL] = page
+	}
+
+	crawler, err := newWebsiteCrawler(source, previous)
+	if err != nil {
+		return err
+	}
+
+	visited := make(map[string]bool)
+	stats, err := crawler.crawl(ctx, func(page crawledPage) {
+		visited[page.URL] = true
+		existing, existed := previous[page.URL]
+
+		switch {
+		case page.Err != nil:
+			// The page keeps its documents until it can be fetched again
+			crawl.Failed++
+			addWebsiteCrawlError(crawl, page.URL, page.Err)
+		case page.Gone || !page.Store || !page.NotModified && strings.TrimSpace(page.Text) == "":
+			if existed {
+				if err := removeWebsitePage(ctx, source, existing); err != nil {
+					crawl.Failed++
+					addWebsiteCrawlError(crawl, page.URL, err)
+					return
+				}
+				crawl.Removed++
+			}
+		case page.NotModified:
+			crawl.Unchanged++
+			touchWebsitePage(ctx, existing, page)
+		default:
+			if err := storeWebsitePage(ctx, source, page, existing, existed, crawl); err != nil {
+				crawl.Failed++
+				addWebsiteCrawlError(crawl, page.URL, err)
+			}
+		}
+	})
+	crawl.Fetched = stats.Fetched
+	crawl.Skipped = stats.Skipped
+	crawl.Truncated = stats.Truncated
+	if err != nil {
+		return err
+	}
+
+	// Pages no longer linked from the website are deleted, unless the page limit cut the crawl short
+	// before reaching them
+	if !stats.Truncated {
+		for pageURL, page := range previous {
+			if visited[pageURL] {
+				continue
+			}
+			if err := removeWebsitePage(ctx, source, page); err != nil {
+				crawl.Failed++
+				addWebsiteCrawlError(crawl, pageURL, err)
+				continue
+			}
+			crawl.Removed++
+		}
+	}
+	return nil
+}
+
+// storeWebsitePage embeds a new or changed page and replaces the chunks of its earlier version.
+// A page whose text has not changed is kept as it is.
+func storeWebsitePage(ctx context.Context, source *models.WebsiteSource, page crawledPage, existing models.WebsitePage, existed bool, crawl *models.WebsiteCrawl) error {
+	hash := sha256.Sum256([]byte(page.Text))
+	contentHash := hex.EncodeToString(hash[:])
+	if existed && existing.ContentHash == contentHash {
+		crawl.Unchanged++
+		touchWebsitePage(ctx, existing, page)
+		return nil
+	}
+
+	// HTML pages start with their title as a heading, which every chunk of them starts with.
+	// Files linked from the website are chunked by their type, e.g. a JSON price list by record.
+	name := page.URL
+	if u, err := url.Parse(page.URL); err == nil {
+		name = u.Path
+	}
+	chunks := ChunkDocument(ctx, source.CompanyID, source.PageID, name, page.Text)
+	contents := make([]string, len(chunks))
+
+	now := time.Now()
+	metadata := map[string]string{
+		"source_type":       models.WebsiteDocumentSource,
+		"website_source_id": source.ID.Hex(),
+		"url":               page.URL,
+		"title":             page.Title,
+		"crawled_at":        now.Format(time.RFC3339),
+	}
+	for i, chunk := range chunks {
+		contents[i] = chunk.Text
+		if err := StoreEmbeddingsWithChannelsAndOptions(ctx, source.CompanyID, source.PageID, source.Channels,
+			chunk.Text, models.WebsiteDocumentSource, ChunkMetadata(metadata, chunk), "", source.IsActive); err != nil {
+			// The earlier version's hash is kept, so the next crawl embeds the page again
+			return err
+		}
+	}
+	crawl.Chunks += len(chunks)
+
+	// Chunks of the earlier version that are not part of this one
+	stale := websiteDocumentsFilter(source, page.URL)
+	stale["content"] = bson.M{"$nin": contents}
+	if _, err := deleteWebsiteDocuments(ctx, stale); err != nil {
+		return err
+	}
+
+	_, err := GetDatabase().Collection("website_pages").UpdateOne(ctx,
+		bson.M{"source_id": source.ID, "url": page.URL},
+		bson.M{
+			"$set": bson.M{
+				"company_id":    source.CompanyID,
+				"page_id":       source.PageID,
+				"title":         page.Title,
+				"content_hash":  contentHash,
+				"etag":          page.ETag,
+				"last_modified": page.LastModified,
+				"chunks":        len(chunks),
+				"crawled_at":    now,
+				"changed_at":    now,
+			},
+		},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save website page: %w", err)
+	}
+
+	if existed {
+		crawl.Changed++
+	} else {
+		crawl.Added++
+	}
+	return nil
+}
+
+// touchWebsitePage records that an unchanged page was crawled again
+func touchWebsitePage(ctx context.Context, existing models.WebsitePage, page crawledPage) {
+	set := bson.M{"crawled_at": time.Now()}
+	if page.ETag != "" {
+		set["etag"] = page.ETag
+	}
+	if page.LastModified != "" {
+		set["last_modified"] = page.LastModified
+	}
+	if _, err := GetDatabase().Collection("website_pages").UpdateOne(ctx, bson.M{"_id": existing.ID}, bson.M{"$set": set}); err != nil {
+		slog.Warn("Failed to update website page", "url", existing.URL, "error", err)
+	}
+}
+
+// removeWebsitePage deletes a page's documents and its crawl state
+func removeWebsitePage(ctx context.Context, source *models.WebsiteSource, page models.WebsitePage) error {
+	if _, err := deleteWebsiteDocuments(ctx, websiteDocumentsFilter(source, page.URL)); err != nil {
+		return err
+	}
+	if _, err := GetDatabase().Collection("website_pages").DeleteOne(ctx, bson.M{"_id": page.ID}); err != nil {
+		return fmt.Errorf("failed to delete website page: %w", err)
+	}
+	return nil
+}
+
+// websiteDocumentsFilter matches the documents of a source, or of one of its pages
+func websiteDocumentsFilter(source *models.WebsiteSource, pageURL string) bson.M {
+	filter := bson.M{
+		"company_id":                 source.CompanyID,
+		"page_id":                    source.PageID,
+		"metadata.website_source_id": source.ID.Hex(),
+	}
+	if pageURL != "" {
+		filter["metadata.url"] = pageURL
+	}
+	return filter
+}
+
+// deleteWebsiteDocuments deletes vector documents and drops them from the search indexes
+func deleteWebsiteDocuments(ctx context.Context, filter bson.M) (int64, error) {
+	ids := vectorDocumentIDs(ctx, filter)
+	result, err := database.Collection("vector_documents").DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete website documents: %w", err)
+	}
+	vectorIndex.Remove(ids...)
+	invalidateLexicalIndexes(filter)
+	return result.DeletedCount, nil
+}
+
+// addWebsiteCrawlError records one of the first errors of a crawl
+func addWebsiteCrawlError(crawl *models.WebsiteCrawl, pageURL string, err error) {
+	if len(crawl.Errors) < websiteMaxRecordedErrors {
+		crawl.Errors = append(crawl.Errors, pageURL+": "+err.Error())
+	}
+}
+
+// finishWebsiteCrawl saves a crawl's summary and schedules the source's next refresh
+func finishWebsiteCrawl(source *models.WebsiteSource, crawl *models.WebsiteCrawl, err error) error {
+	// The crawl context may be cancelled already, the summary must still be saved
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	crawl.FinishedAt = &now
+	source.Status = models.WebsiteStatusIdle
+	if err != nil {
+		source.Status = models.WebsiteStatusFailed
+		crawl.Error = err.Error()
+	}
+	source.LastCrawl = crawl
+	source.NextCrawlAt = now.Add(time.Duration(source.RefreshHours) * time.Hour)
+
+	if _, saveErr := GetDatabase().Collection("website_sources").UpdateOne(ctx, bson.M{"_id": source.ID}, bson.M{
+		"$set": bson.M{
+			"status":        source.Status,
+			"last_crawl":    crawl,
+			"next_crawl_at": source.NextCrawlAt,
+		},
+	}); saveErr != nil {
+		slog.Error("Failed to save website crawl", "sourceID", source.ID.Hex(), "error", saveErr)
+		if err == nil {
+			err = saveErr
+		}
+	}
+
+	GetWebSocketManager().BroadcastToCompany(source.CompanyID, BroadcastMessage{
+		CompanyID: source.CompanyID,
+		PageID:    source.PageID,
+		Type:      "website_crawl_finished",
+		Data:      source,
+	})
+	slog.Info("Website crawl finished",
+		"sourceID", source.ID.Hex(),
+		"pageID", source.PageID,
+		"status", source.Status,
+		"fetched", crawl.Fetched,
+		"added", crawl.Added,
+		"changed", crawl.Changed,
+		"unchanged", crawl.Unchanged,
+		"removed", crawl.Removed,
+		"failed", crawl.Failed,
+		"error", crawl.Error)
+	return err
+}
+
+// StartWebsiteCrawlScheduler crawls active website sources when their refresh is due, and takes over
+// crawls whose instance stopped
+func StartWebsiteCrawlScheduler(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(websiteSchedulerInterval)
+		defer ticker.Stop()
+
+		for {
+			claimCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			if count, err := StartDueWebsiteCrawls(claimCtx); err != nil {
+				slog.Error("Failed to start website crawls", "error", err)
+			} else if count > 0 {
+				slog.Info("Started scheduled website crawls", "count", count)
+			}
+			cancel()
+
+			select {
+			case <-ctx.Done():
+				slog.Info("Website crawl scheduler stopped")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	slog.Info("Website crawl scheduler started")
+}
+
+// StartDueWebsiteCrawls claims the active sources whose refresh is due, or whose crawl stopped, and
+// crawls them in the background. Returns the number of crawls started.
+func StartDueWebsiteCrawls(ctx context.Context) (int, error) {
+	count := 0
+	for {
+		now := time.Now()
+		source, err := claimWebsiteCrawl(ctx, bson.M{
+			"is_active": true,
+			"$or": bson.A{
+				bson.M{"status": bson.M{"$ne": models.WebsiteStatusCrawling}, "next_crawl_at": bson.M{"$lte": now}},
+				bson.M{"status": models.WebsiteStatusCrawling, "heartbeat_at": bson.M{"$lt": now.Add(-websiteStaleAfter)}},
+			},
+		})
+		if err != nil || source == nil {
+			return count, err
+		}
+
+		go func(source *models.WebsiteSource) {
+			if err := RunWebsiteCrawl(context.Background(), source); err != nil {
+				slog.Error("Website crawl failed", "sourceID", source.ID.Hex(), "error", err)
+			}
+		}(source)
+		count++
+	}
+}
+
+// CreateIndexesForWebsiteSources creates indexes for the website_sources and website_pages collections
+func CreateIndexesForWebsiteSources(ctx context.Context) error {
+	_, err := GetDatabase().Collection("website_sources").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "company_id", Value: 1},
+				{Key: "page_id", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{
+				{Key: "is_active", Value: 1},
+				{Key: "next_crawl_at", Value: 1},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetDatabase().Collection("website_pages").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "source_id", Value: 1},
+				{Key: "url", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	return err
+}
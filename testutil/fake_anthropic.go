@@ -0,0 +1,294 @@
+// Package testutil provides in-process fakes of the external APIs the bot calls,
+// so the reply flow can be tested end to end without network access.
+package testutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"facebook-bot/services"
+)
+
+// AnthropicReply is one scripted answer of the fake Anthropic API
+type AnthropicReply struct {
+	Status     int                     // HTTP status, 0 means 200
+	Error      string                  // Error message sent with a non-200 status
+	Content    []services.ContentBlock // Content blocks of a successful answer
+	StopReason string                  // Defaults to "end_turn", or "tool_use" when the content ends with a tool call
+	Delay      time.Duration           // Latency before the answer is sent
+	Model      string                  // Only answer requests for this model, empty matches any model
+}
+
+// TextReply answers with a text block
+func TextReply(text string) AnthropicReply {
+	return AnthropicReply{Content: []services.ContentBlock{{Type: "text", Text: text}}}
+}
+
+// ToolReply answers with a single tool call and no text, which makes the bot ask again without tools
+func ToolReply(name string, input services.ToolUse) AnthropicReply {
+	return AnthropicReply{Content: []services.ContentBlock{{Type: "tool_use", Name: name, Input: input}}}
+}
+
+// AgentIntentReply answers with a detect_agent_request call followed by a text block.
+// An empty text gives a tool-only answer.
+func AgentIntentReply(intent, text string) AnthropicReply {
+	reply := ToolReply("detect_agent_request", services.ToolUse{Intent: intent, Reason: "scripted"})
+	if text != "" {
+		reply.Content = append(reply.Content, services.ContentBlock{Type: "text", Text: text})
+	}
+	return reply
+}
+
+// ErrorReply answers with an error status, e.g. 500 for an outage or 400 for a rejected request
+func ErrorReply(status int, message string) AnthropicReply {
+	return AnthropicReply{Status: status, Error: message}
+}
+
+// WithDelay returns the reply sent after a delay
+func (r AnthropicReply) WithDelay(delay time.Duration) AnthropicReply {
+	r.Delay = delay
+	return r
+}
+
+// ForModel returns the reply only used for requests to a model
+func (r AnthropicReply) ForModel(model string) AnthropicReply {
+	r.Model = model
+	return r
+}
+
+// AnthropicUsage is the token usage the fake reported for a request
+type AnthropicUsage struct {
+	InputTokens              int
+	CacheCreationInputTokens int
+	CacheReadInputTokens     int
+}
+
+// FakeAnthropic is an in-process Anthropic Messages API. Requests are answered with the scripted
+// replies in order; when none is left the default reply is used.
+//
+// Prompt caching is simulated: a prefix ending at a cache_control block is written to the cache
+// on first use and read from it afterwards, provided it reaches the model's minimum cacheable
+// length. Tokens are estimated as four characters each.
+type FakeAnthropic struct {
+	server *httptest.Server
+
+	mu           sync.Mutex
+	script       []AnthropicReply
+	defaultReply AnthropicReply
+	requests     []services.ClaudeRequest
+	usage        []AnthropicUsage
+	cache        map[string]bool
+	nextID       int
+}
+
+// NewFakeAnthropic starts a fake Anthropic API answering "OK" until replies are scripted
+func NewFakeAnthropic() *FakeAnthropic {
+	f := &FakeAnthropic{defaultReply: TextReply("OK"), cache: make(map[string]bool)}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+// URL returns the base URL to pass as services.APIEndpoints.AnthropicBaseURL
+func (f *FakeAnthropic) URL() string {
+	return f.server.URL
+}
+
+// Close shuts the server down
+func (f *FakeAnthropic) Close() {
+	f.server.Close()
+}
+
+// Enqueue adds replies to the script
+func (f *FakeAnthropic) Enqueue(replies ...AnthropicReply) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.script = append(f.script, replies...)
+}
+
+// SetDefault sets the reply used when the script is empty
+func (f *FakeAnthropic) SetDefault(reply AnthropicReply) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.defaultReply = reply
+}
+
+// Reset clears the script and the recorded requests and restores the default reply
+func (f *FakeAnthropic) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.script = nil
+	f.requests = nil
+	f.usage = nil
+	f.cache = make(map[string]bool)
+	f.defaultReply = TextReply("OK")
+}
+
+// Requests returns the requests received so far, oldest first
+func (f *FakeAnthropic) Requests() []services.ClaudeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]services.ClaudeRequest(nil), f.requests...)
+}
+
+// Usage returns the token usage reported for each request, in the order of Requests
+func (f *FakeAnthropic) Usage() []AnthropicUsage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]AnthropicUsage(nil), f.usage...)
+}
+
+// Pending returns the number of scripted replies not used yet
+func (f *FakeAnthropic) Pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.script)
+}
+
+func (f *FakeAnthropic) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/messages" {
+		writeAnthropicError(w, http.StatusNotFound, "not_found_error", "unknown endpoint "+r.URL.Path)
+		return
+	}
+	if r.Header.Get("x-api-key") == "" {
+		writeAnthropicError(w, http.StatusUnauthorized, "authentication_error", "missing x-api-key header")
+		return
+	}
+
+	var request services.ClaudeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	reply, id, usage := f.next(request)
+
+	if reply.Delay > 0 {
+		select {
+		case <-time.After(reply.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if reply.Status != 0 && reply.Status != http.StatusOK {
+		writeAnthropicError(w, reply.Status, "api_error", reply.Error)
+		return
+	}
+
+	stopReason := reply.StopReason
+	if stopReason == "" {
+		stopReason = "end_turn"
+		if n := len(reply.Content); n > 0 && reply.Content[n-1].Type == "tool_use" {
+			stopReason = "tool_use"
+		}
+	}
+
+	content := make([]services.ContentBlock, len(reply.Content))
+	for i, block := range reply.Content {
+		if block.Type == "tool_use" && block.ID == "" {
+			block.ID = fmt.Sprintf("toolu_fake_%d_%d", id, i)
+		}
+		content[i] = block
+	}
+
+	response := services.ClaudeResponse{
+		ID:         fmt.Sprintf("msg_fake_%d", id),
+		Type:       "message",
+		Role:       "assistant",
+		Content:    content,
+		Model:      request.Model,
+		StopReason: stopReason,
+	}
+	response.Usage.InputTokens = usage.InputTokens
+	response.Usage.OutputTokens = 20
+	response.Usage.CacheCreationInputTokens = usage.CacheCreationInputTokens
+	response.Usage.CacheReadInputTokens = usage.CacheReadInputTokens
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// next records a request and takes the first scripted reply matching its model
+func (f *FakeAnthropic) next(request services.ClaudeRequest) (AnthropicReply, int, AnthropicUsage) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	usage := f.cacheUsage(request)
+	f.requests = append(f.requests, request)
+	f.usage = append(f.usage, usage)
+	f.nextID++
+
+	for i, reply := range f.script {
+		if reply.Model == "" || reply.Model == request.Model {
+			f.script = append(f.script[:i], f.script[i+1:]...)
+			return reply, f.nextID, usage
+		}
+	}
+	return f.defaultReply, f.nextID, usage
+}
+
+// cacheUsage splits a request's input tokens into cache reads, cache writes and uncached tokens.
+// Like the real API, the prefix (tools, then system blocks) up to each cache breakpoint is cached
+// separately, and prefixes shorter than the model's minimum are not cached at all.
+func (f *FakeAnthropic) cacheUsage(request services.ClaudeRequest) AnthropicUsage {
+	minTokens := 1024
+	if strings.Contains(request.Model, "haiku") {
+		minTokens = 2048
+	}
+
+	var prefix strings.Builder
+	tools, _ := json.Marshal(request.Tools)
+	prefix.Write(tools)
+
+	readTokens, cachedTokens := 0, 0
+	for _, block := range request.System {
+		prefix.WriteString(block.Text)
+		if block.CacheControl == nil {
+			continue
+		}
+		tokens := estimateTokens(prefix.String())
+		if tokens < minTokens {
+			continue
+		}
+		key := request.Model + "\x00" + prefix.String()
+		if f.cache[key] {
+			readTokens = tokens
+		}
+		f.cache[key] = true
+		cachedTokens = tokens
+	}
+
+	for _, message := range request.Messages {
+		content, _ := json.Marshal(message.Content)
+		prefix.Write(content)
+	}
+
+	return AnthropicUsage{
+		InputTokens:              estimateTokens(prefix.String()) - cachedTokens,
+		CacheCreationInputTokens: cachedTokens - readTokens,
+		CacheReadInputTokens:     readTokens,
+	}
+}
+
+// estimateTokens approximates a token count as one token per four characters
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+func writeAnthropicError(w http.ResponseWriter, status int, errorType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type": "error",
+		"error": map[string]string{
+			"type":    errorType,
+			"message": message,
+		},
+	})
+}
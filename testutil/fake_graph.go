@@ -0,0 +1,336 @@
+package testutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SentMessage is a Messenger message the bot sent through the fake Graph API
+type SentMessage struct {
+	RecipientID string
+	Text        string
+	AccessToken string
+}
+
+// CommentReply is a comment reply the bot posted through the fake Graph API
+type CommentReply struct {
+	ID          string // ID assigned to the reply
+	CommentID   string // Comment being replied to
+	Message     string
+	AccessToken string
+}
+
+// GraphUser is a Facebook user known to the fake Graph API
+type GraphUser struct {
+	FirstName string
+	LastName  string
+}
+
+// FakeGraph is an in-process Facebook Graph API covering the calls made while replying:
+// user details, post content, comment authors, Messenger sends and comment replies
+type FakeGraph struct {
+	server *httptest.Server
+
+	mu             sync.Mutex
+	pageID         string
+	pageName       string
+	users          map[string]GraphUser
+	posts          map[string]string
+	commentAuthors map[string]string
+	sent           []SentMessage
+	replies        []CommentReply
+	sendStatus     int
+	sendDelay      time.Duration
+}
+
+// NewFakeGraph starts a fake Graph API for a page
+func NewFakeGraph(pageID, pageName string) *FakeGraph {
+	f := &FakeGraph{pageID: pageID, pageName: pageName}
+	f.resetLocked()
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+// URL returns the base URL to pass as services.APIEndpoints.GraphAPIBaseURL
+func (f *FakeGraph) URL() string {
+	return f.server.URL
+}
+
+// Close shuts the server down
+func (f *FakeGraph) Close() {
+	f.server.Close()
+}
+
+// SetPage changes the page the access tokens belong to, returned by /me
+func (f *FakeGraph) SetPage(pageID, pageName string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pageID = pageID
+	f.pageName = pageName
+}
+
+// AddUser makes a user's name available to the bot
+func (f *FakeGraph) AddUser(userID string, user GraphUser) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[userID] = user
+}
+
+// AddPost sets the text of a post
+func (f *FakeGraph) AddPost(postID, message string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.posts[postID] = message
+}
+
+// AddComment records who wrote a comment, used by the bot to skip the page's own comments
+func (f *FakeGraph) AddComment(commentID, fromID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commentAuthors[commentID] = fromID
+}
+
+// FailSends makes Messenger sends and comment replies fail with a status, 0 restores success
+func (f *FakeGraph) FailSends(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sendStatus = status
+}
+
+// SetSendDelay adds latency to Messenger sends and comment replies
+func (f *FakeGraph) SetSendDelay(delay time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sendDelay = delay
+}
+
+// Reset forgets users, posts, comments and everything sent
+func (f *FakeGraph) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resetLocked()
+}
+
+func (f *FakeGraph) resetLocked() {
+	f.users = make(map[string]GraphUser)
+	f.posts = make(map[string]string)
+	f.commentAuthors = make(map[string]string)
+	f.sent = nil
+	f.replies = nil
+	f.sendStatus = 0
+	f.sendDelay = 0
+}
+
+// SentMessages returns the Messenger messages sent so far, oldest first
+func (f *FakeGraph) SentMessages() []SentMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]SentMessage(nil), f.sent...)
+}
+
+// CommentReplies returns the comment replies posted so far, oldest first
+func (f *FakeGraph) CommentReplies() []CommentReply {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]CommentReply(nil), f.replies...)
+}
+
+// WaitForMessages waits until n Messenger messages were sent to a recipient and returns them
+func (f *FakeGraph) WaitForMessages(recipientID string, n int, timeout time.Duration) ([]SentMessage, bool) {
+	var messages []SentMessage
+	ok := waitFor(timeout, func() bool {
+		messages = messages[:0]
+		for _, msg := range f.SentMessages() {
+			if msg.RecipientID == recipientID {
+				messages = append(messages, msg)
+			}
+		}
+		return len(messages) >= n
+	})
+	return messages, ok
+}
+
+// WaitForCommentReply waits until the bot replied to a comment and returns the reply
+func (f *FakeGraph) WaitForCommentReply(commentID string, timeout time.Duration) (CommentReply, bool) {
+	var found CommentReply
+	ok := waitFor(timeout, func() bool {
+		for _, reply := range f.CommentReplies() {
+			if reply.CommentID == commentID {
+				found = reply
+				return true
+			}
+		}
+		return false
+	})
+	return found, ok
+}
+
+func (f *FakeGraph) handle(w http.ResponseWriter, r *http.Request) {
+	// Paths look like /v18.0/{object}[/{edge}]; the version is not checked
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "v") {
+		writeGraphError(w, http.StatusNotFound, "Unknown path "+r.URL.Path)
+		return
+	}
+	if r.URL.Query().Get("access_token") == "" {
+		writeGraphError(w, http.StatusBadRequest, "An access token is required to request this resource.")
+		return
+	}
+	object, edge := parts[1], ""
+	if len(parts) > 2 {
+		edge = parts[2]
+	}
+
+	switch {
+	case r.Method == http.MethodPost && object == "me" && edge == "messages":
+		f.handleSend(w, r)
+	case r.Method == http.MethodPost && edge == "comments":
+		f.handleCommentReply(w, r, object)
+	case r.Method == http.MethodGet && edge == "":
+		f.handleObject(w, r, object)
+	default:
+		writeGraphError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported %s request to %s", r.Method, r.URL.Path))
+	}
+}
+
+func (f *FakeGraph) handleSend(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Recipient struct {
+			ID string `json:"id"`
+		} `json:"recipient"`
+		Message struct {
+			Text string `json:"text"`
+		} `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeGraphError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if status, failed := f.sendFailure(r); failed {
+		writeGraphError(w, status, "Scripted send failure")
+		return
+	}
+
+	f.mu.Lock()
+	f.sent = append(f.sent, SentMessage{
+		RecipientID: payload.Recipient.ID,
+		Text:        payload.Message.Text,
+		AccessToken: r.URL.Query().Get("access_token"),
+	})
+	messageID := fmt.Sprintf("m_fake_%d", len(f.sent))
+	f.mu.Unlock()
+
+	writeGraphJSON(w, map[string]string{
+		"recipient_id": payload.Recipient.ID,
+		"message_id":   messageID,
+	})
+}
+
+func (f *FakeGraph) handleCommentReply(w http.ResponseWriter, r *http.Request, commentID string) {
+	var payload struct {
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeGraphError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if status, failed := f.sendFailure(r); failed {
+		writeGraphError(w, status, "Scripted send failure")
+		return
+	}
+
+	f.mu.Lock()
+	reply := CommentReply{
+		ID:          fmt.Sprintf("%s_reply_%d", commentID, len(f.replies)+1),
+		CommentID:   commentID,
+		Message:     payload.Message,
+		AccessToken: r.URL.Query().Get("access_token"),
+	}
+	f.replies = append(f.replies, reply)
+	// The page wrote the reply, in case the bot is asked about it later
+	f.commentAuthors[reply.ID] = f.pageID
+	f.mu.Unlock()
+
+	writeGraphJSON(w, map[string]string{"id": reply.ID})
+}
+
+// sendFailure applies the scripted latency and failure of sends
+func (f *FakeGraph) sendFailure(r *http.Request) (int, bool) {
+	f.mu.Lock()
+	status, delay := f.sendStatus, f.sendDelay
+	f.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+		}
+	}
+	return status, status != 0 && status != http.StatusOK
+}
+
+// handleObject answers field reads of the page, users, posts and comments
+func (f *FakeGraph) handleObject(w http.ResponseWriter, r *http.Request, object string) {
+	fields := r.URL.Query().Get("fields")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if object == "me" || object == f.pageID {
+		writeGraphJSON(w, map[string]string{"id": f.pageID, "name": f.pageName})
+		return
+	}
+	if user, ok := f.users[object]; ok {
+		writeGraphJSON(w, map[string]string{"id": object, "first_name": user.FirstName, "last_name": user.LastName})
+		return
+	}
+	if message, ok := f.posts[object]; ok {
+		writeGraphJSON(w, map[string]string{"id": object, "message": message})
+		return
+	}
+	if fromID, ok := f.commentAuthors[object]; ok && strings.HasPrefix(fields, "from") {
+		writeGraphJSON(w, map[string]interface{}{"id": object, "from": map[string]string{"id": fromID}})
+		return
+	}
+
+	writeGraphError(w, http.StatusNotFound, fmt.Sprintf("Object with ID '%s' does not exist", object))
+}
+
+func writeGraphJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeGraphError writes an error in the Graph API format
+func writeGraphError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    "OAuthException",
+			"code":    100,
+		},
+	})
+}
+
+// waitFor polls a condition until it holds or the timeout passes
+func waitFor(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if condition() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}